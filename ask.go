@@ -0,0 +1,320 @@
+package goka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/headers"
+	"github.com/lovoo/goka/multierr"
+)
+
+const (
+	// AskCorrelationIDHeader is the header identifying a request sent by an Asker and
+	// its response, see Reply
+	AskCorrelationIDHeader = "goka-ask-correlation-id"
+	// AskReplyToHeader is the header containing the topic the response to a request
+	// sent by an Asker has to be emitted to, see Reply
+	AskReplyToHeader = "goka-ask-reply-to"
+)
+
+// ErrAskerNotRunning is returned by Asker.Ask if the asker stopped running.
+var ErrAskerNotRunning = errors.New("asker not running")
+
+// Asker sends requests to a processor and waits for their responses, implementing
+// request/response over Kafka topics. Each request is emitted with a correlation ID and
+// the response topic of the asker in its headers. The processor replies with Reply to
+// the response topic, which the asker consumes to return the response to the caller.
+// Every instance of a service should use its own response topic, otherwise the
+// instances consume each others responses.
+type Asker struct {
+	emitter       *Emitter
+	responseTopic string
+	responseCodec Codec
+	consumer      sarama.Consumer
+	tmgr          TopicManager
+	log           logger
+
+	// running is closed once the asker consumes the response topic, done once it stopped
+	running chan struct{}
+	done    chan struct{}
+
+	m       sync.Mutex
+	pending map[string]chan *sarama.ConsumerMessage
+}
+
+// NewAsker creates an asker emitting requests to requestTopic and consuming the
+// responses from responseTopic. The response topic must exist.
+func NewAsker(brokers []string, requestTopic Stream, requestCodec Codec, responseTopic Stream, responseCodec Codec, options ...AskerOption) (*Asker, error) {
+	opts := new(aoptions)
+	opts.applyOptions(requestTopic, requestCodec, responseTopic, responseCodec, options...)
+
+	emitter, err := NewEmitter(brokers, requestTopic, requestCodec,
+		WithEmitterClientID(opts.clientID),
+		WithEmitterLogger(opts.log),
+		WithEmitterHasher(opts.hasher),
+		WithEmitterProducerBuilder(opts.builders.producer),
+		WithEmitterTopicManagerBuilder(opts.builders.topicmgr),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating emitter for requests: %v", err)
+	}
+
+	consumer, err := opts.builders.consumerSarama(brokers, opts.clientID)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating sarama consumer for brokers %+v: %v", brokers, err)
+	}
+
+	tmgr, err := opts.builders.topicmgr(brokers)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating topic manager: %v", err)
+	}
+
+	return &Asker{
+		emitter:       emitter,
+		responseTopic: string(responseTopic),
+		responseCodec: responseCodec,
+		consumer:      consumer,
+		tmgr:          tmgr,
+		log:           opts.log.Prefix(fmt.Sprintf("Asker %s", responseTopic)),
+		running:       make(chan struct{}),
+		done:          make(chan struct{}),
+		pending:       make(map[string]chan *sarama.ConsumerMessage),
+	}, nil
+}
+
+// Run consumes the responses from the response topic until the context is done.
+// Requests can only be sent while the asker is running. Responses emitted before
+// Run started are ignored.
+func (a *Asker) Run(ctx context.Context) (rerr error) {
+	defer close(a.done)
+	defer func() {
+		errs := new(multierr.Errors)
+		errs.Collect(rerr)
+		if err := a.emitter.Finish(); err != nil {
+			errs.Collect(fmt.Errorf("error closing emitter: %v", err))
+		}
+		if err := a.consumer.Close(); err != nil {
+			errs.Collect(fmt.Errorf("error closing consumer: %v", err))
+		}
+		if err := a.tmgr.Close(); err != nil {
+			errs.Collect(fmt.Errorf("error closing topic manager: %v", err))
+		}
+		rerr = errs.NilOrError()
+	}()
+
+	partitions, err := a.tmgr.Partitions(a.responseTopic)
+	if err != nil {
+		return fmt.Errorf("error getting partitions of response topic %s: %v", a.responseTopic, err)
+	}
+
+	// stop the partitions already consumed if consuming another one fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errg, ctx := multierr.NewErrGroup(ctx)
+	for _, partition := range partitions {
+		hwm, err := a.tmgr.GetOffset(a.responseTopic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return fmt.Errorf("error getting newest offset of response topic %s/%d: %v", a.responseTopic, partition, err)
+		}
+		cons, err := a.consumer.ConsumePartition(a.responseTopic, partition, hwm)
+		if err != nil {
+			return fmt.Errorf("error consuming response topic %s/%d: %v", a.responseTopic, partition, err)
+		}
+		errg.Go(func() error {
+			return a.consumeResponses(ctx, cons)
+		})
+	}
+	close(a.running)
+
+	return errg.Wait().NilOrError()
+}
+
+// consumeResponses passes the responses of a partition to the pending requests
+func (a *Asker) consumeResponses(ctx context.Context, cons sarama.PartitionConsumer) error {
+	defer cons.AsyncClose()
+	for {
+		select {
+		case msg, ok := <-cons.Messages():
+			if !ok {
+				return nil
+			}
+			// the tester sends nil messages to synchronize
+			if msg == nil {
+				continue
+			}
+			a.deliver(msg)
+		case err, ok := <-cons.Errors():
+			if !ok {
+				return nil
+			}
+			return fmt.Errorf("error consuming responses: %v", err)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// deliver passes the response to the request with its correlation ID. Responses of
+// unknown requests, e.g. timed out ones, are dropped.
+func (a *Asker) deliver(msg *sarama.ConsumerMessage) {
+	id := string(headers.FromSarama(msg.Headers)[AskCorrelationIDHeader])
+
+	a.m.Lock()
+	defer a.m.Unlock()
+	response, ok := a.pending[id]
+	if !ok {
+		return
+	}
+	delete(a.pending, id)
+	response <- msg
+}
+
+// Ask emits the request with the key and returns the response of the processor.
+// If the context is done before the response arrives, the context's error is returned.
+// Ask blocks until the asker is running and can be called concurrently.
+func (a *Asker) Ask(ctx context.Context, key string, request interface{}) (interface{}, error) {
+	select {
+	case <-a.running:
+	case <-a.done:
+		return nil, ErrAskerNotRunning
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	// running stays closed after the asker stopped
+	select {
+	case <-a.done:
+		return nil, ErrAskerNotRunning
+	default:
+	}
+
+	id, err := newCorrelationID()
+	if err != nil {
+		return nil, fmt.Errorf("error creating correlation ID: %v", err)
+	}
+
+	// register before emitting, the response may arrive before the emit returns
+	response := make(chan *sarama.ConsumerMessage, 1)
+	a.m.Lock()
+	a.pending[id] = response
+	a.m.Unlock()
+	defer func() {
+		a.m.Lock()
+		defer a.m.Unlock()
+		delete(a.pending, id)
+	}()
+
+	prom, err := a.emitter.EmitWithHeaders(key, request, Headers{
+		AskCorrelationIDHeader: []byte(id),
+		AskReplyToHeader:       []byte(a.responseTopic),
+	})
+	if errors.Is(err, ErrEmitterAlreadyClosed) {
+		return nil, ErrAskerNotRunning
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error emitting request: %v", err)
+	}
+	emitted := make(chan error, 1)
+	prom.Then(func(err error) { emitted <- err })
+
+	for {
+		select {
+		case err := <-emitted:
+			if err != nil {
+				return nil, fmt.Errorf("error emitting request: %v", err)
+			}
+			emitted = nil
+		case msg := <-response:
+			if msg.Value == nil {
+				return nil, nil
+			}
+			value, err := a.responseCodec.Decode(msg.Value)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding response for key %s: %v", key, err)
+			}
+			return value, nil
+		case <-a.done:
+			return nil, ErrAskerNotRunning
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func newCorrelationID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// replier emits responses to requests
+type replier interface {
+	canReplyTo(topic string) bool
+	reply(topic string, key string, value []byte, hdr Headers)
+}
+
+// canReplyTo returns whether responses may be emitted to the topic, see WithReplyTopics.
+func (ctx *cbContext) canReplyTo(topic string) bool {
+	gg := ctx.graph
+	if gg.isLoopTopic(topic) || topic == tableName(gg.Group()) || topic == outboxName(gg.Group()) {
+		return false
+	}
+	for _, prefix := range ctx.replyTopics {
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reply emits the response to the topic without requiring it to be an output of the
+// group. Response topics are not tracked in the output stats, as they vary per asker.
+func (ctx *cbContext) reply(topic string, key string, value []byte, hdr Headers) {
+	ctx.counters.emits++
+	ctx.emitter(topic, key, value, ctx.emitterDefaultHeaders.Merged(hdr)).Then(func(err error) {
+		if err != nil {
+			err = fmt.Errorf("error replying to %s: %v", topic, err)
+		}
+		ctx.emitDone(err)
+	})
+}
+
+// Reply emits the response to the request currently processed by the callback to the
+// response topic of the Asker that sent it. The response is encoded with the codec,
+// which must match the response codec of the asker. Reply returns false without
+// emitting if the message is not a request sent by an Asker or if the processor
+// may not respond to its response topic (see WithReplyTopics).
+// Like Context.Emit, it might panic to initiate an immediate shutdown of the processor.
+func Reply(ctx Context, c Codec, response interface{}) bool {
+	hdr := ctx.Headers()
+	replyTo, id := string(hdr[AskReplyToHeader]), hdr[AskCorrelationIDHeader]
+	if replyTo == "" || len(id) == 0 {
+		return false
+	}
+	r, ok := ctx.(replier)
+	if !ok {
+		ctx.Fail(fmt.Errorf("context does not support replies"))
+	}
+	if !r.canReplyTo(replyTo) {
+		return false
+	}
+
+	var data []byte
+	if response != nil {
+		var err error
+		data, err = c.Encode(response)
+		if err != nil {
+			ctx.Fail(fmt.Errorf("error encoding response for key %s: %v", ctx.Key(), err))
+		}
+	}
+	r.reply(replyTo, ctx.Key(), data, Headers{AskCorrelationIDHeader: id})
+	return true
+}
@@ -0,0 +1,108 @@
+package goka
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// AuditRecord is the record of a produced message written to the audit topic,
+// see WithAuditTopic and WithEmitterAuditTopic. Records are JSON encoded and keyed with
+// the key of the message.
+type AuditRecord struct {
+	Topic string `json:"topic"`
+	Key   string `json:"key"`
+	// Hash is the hex encoded SHA-256 hash of the value, empty for nil values
+	Hash string `json:"hash,omitempty"`
+	// Size is the size of the value in bytes
+	Size      int       `json:"size"`
+	Timestamp time.Time `json:"timestamp"`
+	// Producer identifies the producing processor instance or emitter
+	Producer string `json:"producer"`
+}
+
+// auditProducer writes an audit record for every message successfully produced to
+// the wrapped producer
+type auditProducer struct {
+	producer   Producer
+	topic      string
+	producerID string
+	log        logger
+
+	m      sync.RWMutex
+	closed bool
+}
+
+func newAuditProducer(producer Producer, topic string, producerID string, log logger) *auditProducer {
+	return &auditProducer{
+		producer:   producer,
+		topic:      topic,
+		producerID: producerID,
+		log:        log,
+	}
+}
+
+// Emit emits the message and its audit record once the message was produced.
+func (p *auditProducer) Emit(topic string, key string, value []byte) *Promise {
+	return p.producer.Emit(topic, key, value).Then(func(err error) {
+		if err == nil {
+			p.audit(topic, key, value)
+		}
+	})
+}
+
+// EmitWithHeaders emits the message and its audit record once the message was produced.
+func (p *auditProducer) EmitWithHeaders(topic string, key string, value []byte, hdr Headers) *Promise {
+	return p.producer.EmitWithHeaders(topic, key, value, hdr).Then(func(err error) {
+		if err == nil {
+			p.audit(topic, key, value)
+		}
+	})
+}
+
+// Close closes the wrapped producer. Records of messages produced while closing are
+// not written, as the producer does not accept messages anymore.
+func (p *auditProducer) Close() error {
+	p.m.Lock()
+	p.closed = true
+	p.m.Unlock()
+	return p.producer.Close()
+}
+
+// audit emits the audit record of a message. Auditing is best effort, failing to
+// write the record does not fail the message.
+func (p *auditProducer) audit(topic string, key string, value []byte) {
+	if topic == p.topic {
+		return
+	}
+	record := AuditRecord{
+		Topic:     topic,
+		Key:       key,
+		Size:      len(value),
+		Timestamp: time.Now(),
+		Producer:  p.producerID,
+	}
+	if value != nil {
+		hash := sha256.Sum256(value)
+		record.Hash = hex.EncodeToString(hash[:])
+	}
+	data, err := json.Marshal(&record)
+	if err != nil {
+		p.log.Printf("error encoding audit record for key %s in topic %s: %v", key, topic, err)
+		return
+	}
+
+	p.m.RLock()
+	defer p.m.RUnlock()
+	if p.closed {
+		p.log.Printf("not emitting audit record for key %s in topic %s: producer closed", key, topic)
+		return
+	}
+	p.producer.Emit(p.topic, key, data).Then(func(err error) {
+		if err != nil {
+			p.log.Printf("error emitting audit record for key %s in topic %s: %v", key, topic, err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package goka
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+// failingProducer fails all messages to the failing topic
+type failingProducer struct {
+	failing string
+	emitted []string
+	records []AuditRecord
+}
+
+func (p *failingProducer) Emit(topic string, key string, value []byte) *Promise {
+	return p.EmitWithHeaders(topic, key, value, nil)
+}
+
+func (p *failingProducer) EmitWithHeaders(topic string, key string, value []byte, hdr Headers) *Promise {
+	if topic == p.failing {
+		return NewPromise().finish(nil, errors.New("failed"))
+	}
+	if topic == "audit" {
+		var record AuditRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			panic(err)
+		}
+		p.records = append(p.records, record)
+	}
+	p.emitted = append(p.emitted, topic)
+	return NewPromise().finish(nil, nil)
+}
+
+func (p *failingProducer) Close() error {
+	return nil
+}
+
+func TestAuditProducer(t *testing.T) {
+	inner := &failingProducer{failing: "failing"}
+	p := newAuditProducer(inner, "audit", "instance", defaultLogger)
+
+	test.AssertNil(t, p.Emit("output", "key", []byte("value")).err)
+	test.AssertNotNil(t, p.EmitWithHeaders("failing", "key", []byte("value"), nil).err)
+	// records are only written for produced messages
+	test.AssertEqual(t, inner.emitted, []string{"output", "audit"})
+	test.AssertEqual(t, len(inner.records), 1)
+	test.AssertEqual(t, inner.records[0].Topic, "output")
+	test.AssertEqual(t, inner.records[0].Size, 5)
+	test.AssertEqual(t, inner.records[0].Producer, "instance")
+
+	// no records are written once the producer is closed
+	test.AssertNil(t, p.Close())
+	p.Emit("output", "key", []byte("value"))
+	test.AssertEqual(t, inner.emitted, []string{"output", "audit", "output"})
+}
@@ -0,0 +1,369 @@
+package goka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// defaultBackfillChannelSize is the partition channel size of backfill processors,
+// which is larger than the default as backfills consume at full speed
+const defaultBackfillChannelSize = 10000
+
+// VersionedGroup returns the group of a version of a processor, e.g. "counter-v2" for
+// version 2 of "counter", whose group table is "counter-v2-table". Version 0 is the
+// unversioned group, so the original table can be switched to a backfilled version.
+func VersionedGroup(group Group, version int) Group {
+	if version == 0 {
+		return group
+	}
+	return Group(fmt.Sprintf("%s-v%d", group, version))
+}
+
+// Backfill rebuilds the group table of a processor by replaying its inputs into a new
+// version of the group, see VersionedGroup. The backfill runs a processor in drain mode
+// (see WithDrain), which consumes the inputs from the start up to the end offsets at the
+// time it starts, ignoring live traffic, and stops once it processed them. The partitions
+// are processed in parallel.
+//
+// The backfill writes to the table and loop topics of the new version only. Messages
+// emitted to other topics, e.g. the outputs of the group graph, are passed to the callback
+// of WithBackfillOnOutput or logged, as emitting them would deliver the results of the
+// replayed inputs to the live consumers of the outputs again. Emitting them anyway
+// requires WithBackfillEmitOutputs.
+//
+// The standard reprocessing workflow is:
+//  1. run the backfill of the new version next to the live processor of the current version
+//  2. once Run returns, start the live processor of the new version, which continues from
+//     the offsets committed by the backfill
+//  3. switch the readers of the table with ActivateTableVersion, see VersionedView
+//  4. stop the processor of the old version
+type Backfill struct {
+	processor *Processor
+	group     Group
+	version   int
+}
+
+// NewBackfill creates a backfill of the version of the group. The group graph of the
+// version is defined by define, which is passed the versioned group, so the same
+// function defines the graph of every version.
+func NewBackfill(brokers []string, group Group, version int, define func(group Group) *GroupGraph, options ...BackfillOption) (*Backfill, error) {
+	if version <= 0 {
+		return nil, fmt.Errorf("invalid backfill version %d: must be positive", version)
+	}
+	opts := new(bfoptions)
+	opts.applyOptions(options...)
+
+	gg := define(VersionedGroup(group, version))
+	if gg.Group() != VersionedGroup(group, version) {
+		return nil, fmt.Errorf("group graph defines group %s instead of %s", gg.Group(), VersionedGroup(group, version))
+	}
+
+	start := opts.start
+	outputs := func(o *poptions, gg *GroupGraph) {
+		o.backfillOutputs = !opts.emitOutputs
+		o.backfillEmit = opts.onOutput
+	}
+	processor, err := NewProcessor(brokers, gg, append([]ProcessorOption{
+		WithPartitionChannelSize(defaultBackfillChannelSize),
+		WithConsumerSaramaConfig(func(config *sarama.Config) {
+			config.Consumer.Offsets.Initial = sarama.OffsetOldest
+		}),
+	}, append(opts.processorOptions,
+		WithDrain(),
+		func(o *poptions, gg *GroupGraph) {
+			o.startTime = start
+		},
+		outputs,
+	)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating backfill processor: %v", err)
+	}
+
+	return &Backfill{
+		processor: processor,
+		group:     group,
+		version:   version,
+	}, nil
+}
+
+// Processor returns the processor running the backfill, e.g. to monitor its progress.
+func (b *Backfill) Processor() *Processor {
+	return b.processor
+}
+
+// Run runs the backfill until all partitions are processed up to the end offsets
+// captured on start. It returns an error if the backfill stopped before completion,
+// e.g. because the context was canceled. A stopped backfill can be continued by
+// running a new backfill of the same version.
+func (b *Backfill) Run(ctx context.Context) error {
+	if err := b.processor.Run(ctx); err != nil {
+		return fmt.Errorf("error running backfill of %s: %w", VersionedGroup(b.group, b.version), err)
+	}
+	if !b.processor.Drained() {
+		return fmt.Errorf("backfill of %s stopped before completion", VersionedGroup(b.group, b.version))
+	}
+	return nil
+}
+
+// backfillProducer emits the messages to the table, loop and outbox topics of the
+// backfilled group and passes all other messages to a read-only producer
+type backfillProducer struct {
+	Producer
+	topics  map[string]bool
+	outputs *readOnlyProducer
+}
+
+func newBackfillProducer(producer Producer, gg *GroupGraph, onOutput ReadOnlyEmitCallback, log logger) *backfillProducer {
+	topics := make(map[string]bool)
+	if table := gg.GroupTable(); table != nil {
+		topics[table.Topic()] = true
+	}
+	for _, topic := range gg.loopStreams().Topics() {
+		topics[topic] = true
+	}
+	if len(gg.OutboxStreams()) > 0 {
+		// the outbox table is state of the group, the messages it forwards are outputs
+		topics[outboxName(gg.Group())] = true
+	}
+	return &backfillProducer{
+		Producer: producer,
+		topics:   topics,
+		outputs:  newReadOnlyProducer(onOutput, log),
+	}
+}
+
+// Emit emits the message if it is written to the group's table, loop or outbox topic.
+func (p *backfillProducer) Emit(topic string, key string, value []byte) *Promise {
+	return p.EmitWithHeaders(topic, key, value, nil)
+}
+
+// EmitWithHeaders emits the message if it is written to the group's table, loop or outbox topic.
+func (p *backfillProducer) EmitWithHeaders(topic string, key string, value []byte, hdr Headers) *Promise {
+	if !p.topics[topic] {
+		return p.outputs.EmitWithHeaders(topic, key, value, hdr)
+	}
+	return p.Producer.EmitWithHeaders(topic, key, value, hdr)
+}
+
+// seekStartTime moves the offsets of the claimed input streams to the first message at
+// or after the start time. Offsets are only moved forward, so partitions resumed beyond
+// the start time are not reprocessed.
+func (g *Processor) seekStartTime(session sarama.ConsumerGroupSession) error {
+	millis := g.opts.startTime.UnixNano() / int64(time.Millisecond)
+	for _, edge := range g.graph.InputStreams() {
+		for _, partition := range session.Claims()[edge.Topic()] {
+			offset, err := g.tmgr.GetOffset(edge.Topic(), partition, millis)
+			if err != nil {
+				return fmt.Errorf("error getting offset of %s/%d at %v: %v", edge.Topic(), partition, g.opts.startTime, err)
+			}
+			// no message after the start time
+			if offset < 0 {
+				offset, err = g.tmgr.GetOffset(edge.Topic(), partition, sarama.OffsetNewest)
+				if err != nil {
+					return fmt.Errorf("error getting newest offset of %s/%d: %v", edge.Topic(), partition, err)
+				}
+			}
+			session.MarkOffset(edge.Topic(), partition, offset, "")
+		}
+	}
+	return nil
+}
+
+// tableVersionKey is the checkpoint storing the active table version of a group
+func tableVersionKey(group Group) string {
+	return "table-version/" + string(group)
+}
+
+// ActivateTableVersion stores the version of the group's table as active in the
+// checkpoints. Running VersionedViews of the group switch to the table of the version.
+func ActivateTableVersion(checkpoints *Checkpoints, group Group, version int) error {
+	if version < 0 {
+		return fmt.Errorf("invalid table version %d", version)
+	}
+	return checkpoints.Set(tableVersionKey(group), strconv.Itoa(version))
+}
+
+// ActiveTableVersion returns the active version of the group's table, which is 0 if no
+// version was activated.
+func ActiveTableVersion(checkpoints *Checkpoints, group Group) (int, error) {
+	value, ok, err := checkpoints.Get(tableVersionKey(group))
+	if err != nil || !ok {
+		return 0, err
+	}
+	return parseTableVersion(group, value)
+}
+
+func parseTableVersion(group Group, value string) (int, error) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid table version %q of group %s", value, group)
+	}
+	return version, nil
+}
+
+// VersionedView is a view of the active version of a group table, see ActivateTableVersion.
+// When another version is activated, the view loads the table of the version while
+// serving reads from the current one, and switches all reads at once when the new
+// table is recovered.
+type VersionedView struct {
+	brokers     []string
+	group       Group
+	codec       Codec
+	checkpoints *Checkpoints
+	options     []ViewOption
+
+	m       sync.RWMutex
+	view    *View
+	version int
+
+	recovered chan struct{}
+}
+
+// NewVersionedView creates a view of the active version of the group's table. The
+// checkpoints storing the active version must be running. The options are passed to
+// the views of the versions.
+func NewVersionedView(brokers []string, group Group, codec Codec, checkpoints *Checkpoints, options ...ViewOption) *VersionedView {
+	return &VersionedView{
+		brokers:     brokers,
+		group:       group,
+		codec:       codec,
+		checkpoints: checkpoints,
+		options:     options,
+		version:     -1,
+		recovered:   make(chan struct{}),
+	}
+}
+
+// versionedViewRun is the view of a version running in the background
+type versionedViewRun struct {
+	view   *View
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+func (r *versionedViewRun) stop() {
+	r.cancel()
+	<-r.done
+}
+
+// Run runs the view of the active version and switches to other versions once they
+// are activated, until the context is done.
+func (vv *VersionedView) Run(ctx context.Context) error {
+	if err := vv.checkpoints.WaitRecovered(ctx); err != nil {
+		return err
+	}
+	observer := vv.checkpoints.view.Changes()
+	defer observer.Stop()
+
+	version, err := ActiveTableVersion(vv.checkpoints, vv.group)
+	if err != nil {
+		return err
+	}
+	current, err := vv.switchTo(ctx, version)
+	if err != nil || current == nil {
+		return err
+	}
+	defer func() { current.stop() }()
+	close(vv.recovered)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-current.done:
+			if current.err != nil {
+				return fmt.Errorf("error running view of %s version %d: %w", vv.group, vv.Version(), current.err)
+			}
+			return nil
+		case ev, ok := <-observer.C():
+			if !ok {
+				return errors.New("checkpoints stopped")
+			}
+			if ev.Key != tableVersionKey(vv.group) || ev.Value == nil {
+				continue
+			}
+			version, err := parseTableVersion(vv.group, ev.Value.(string))
+			if err != nil {
+				return err
+			}
+			if version == vv.Version() {
+				continue
+			}
+			next, err := vv.switchTo(ctx, version)
+			if err != nil || next == nil {
+				return err
+			}
+			current.stop()
+			current = next
+		}
+	}
+}
+
+// switchTo runs the view of the version and makes it the current one once it is
+// recovered. It returns nil if the context is done before.
+func (vv *VersionedView) switchTo(ctx context.Context, version int) (*versionedViewRun, error) {
+	table := GroupTable(VersionedGroup(vv.group, version))
+	view, err := NewView(vv.brokers, table, vv.codec, vv.options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating view of %s: %v", table, err)
+	}
+
+	viewCtx, cancel := context.WithCancel(ctx)
+	run := &versionedViewRun{
+		view:   view,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(run.done)
+		run.err = view.Run(viewCtx)
+	}()
+
+	if err := view.WaitRecovered(ctx); err != nil {
+		run.stop()
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error recovering view of %s: %v", table, err)
+	}
+
+	vv.m.Lock()
+	vv.view, vv.version = view, version
+	vv.m.Unlock()
+	return run, nil
+}
+
+// WaitRecovered blocks until the view of the active version is recovered.
+func (vv *VersionedView) WaitRecovered(ctx context.Context) error {
+	select {
+	case <-vv.recovered:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Version returns the version the view reads from, or -1 if it is not recovered yet.
+func (vv *VersionedView) Version() int {
+	vv.m.RLock()
+	defer vv.m.RUnlock()
+	return vv.version
+}
+
+// Get returns the value of the key in the active version of the table.
+func (vv *VersionedView) Get(key string) (interface{}, error) {
+	vv.m.RLock()
+	view := vv.view
+	vv.m.RUnlock()
+	if view == nil {
+		return nil, errors.New("versioned view not recovered")
+	}
+	return view.Get(key)
+}
@@ -0,0 +1,33 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestBackfillProducer(t *testing.T) {
+	gg := DefineGroup("group",
+		Input("input", new(codec.String), nil),
+		Loop(new(codec.String), nil),
+		NamedLoop("retry", new(codec.String), nil),
+		Outbox("outbox-output", new(codec.String)),
+		Output("output", new(codec.String)),
+		Persist(new(codec.String)),
+	)
+
+	var emitted, outputs []string
+	producer := newReadOnlyProducer(func(topic string, key string, value []byte, hdr Headers) {
+		emitted = append(emitted, topic)
+	}, defaultLogger)
+	p := newBackfillProducer(producer, gg, func(topic string, key string, value []byte, hdr Headers) {
+		outputs = append(outputs, topic)
+	}, defaultLogger)
+
+	for _, topic := range []string{"group-table", "group-loop", "group-loop-retry", "group-outbox", "output", "outbox-output"} {
+		p.Emit(topic, "key", []byte("value"))
+	}
+	test.AssertEqual(t, emitted, []string{"group-table", "group-loop", "group-loop-retry", "group-outbox"})
+	test.AssertEqual(t, outputs, []string{"output", "outbox-output"})
+}
@@ -18,7 +18,7 @@ func DefaultProducerBuilder(brokers []string, clientID string, hasher func() has
 	return NewProducer(brokers, &config)
 }
 
-// ProducerBuilderWithConfig creates a Kafka consumer using the Sarama library.
+// ProducerBuilderWithConfig creates a Kafka producer using the Sarama library and the passed config.
 func ProducerBuilderWithConfig(config *sarama.Config) ProducerBuilder {
 	return func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
 		config.ClientID = clientID
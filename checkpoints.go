@@ -0,0 +1,111 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/storage"
+)
+
+// Checkpoints persists named markers in a compacted topic, e.g. "backfill-2021 done" or
+// "migration 3 applied", so a service can check at startup which steps it completed
+// before and run them idempotently. The markers are stored outside of any group table,
+// keyed by their name with a string value.
+//
+// The markers are read by a view on the topic, which is kept in memory by default, so
+// Run has to be running to read and write them.
+type Checkpoints struct {
+	view    *View
+	emitter *Emitter
+	timeout time.Duration
+}
+
+// NewCheckpoints creates checkpoints stored in the topic, which must be a compacted topic,
+// see TopicManager.EnsureTableExists.
+func NewCheckpoints(brokers []string, topic Table, options ...CheckpointsOption) (*Checkpoints, error) {
+	opts := new(cpoptions)
+	opts.applyOptions(options...)
+
+	view, err := NewView(brokers, topic, new(codec.String),
+		append([]ViewOption{WithViewStorageBuilder(storage.MemoryBuilder())}, opts.viewOptions...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating view for checkpoints: %v", err)
+	}
+	emitter, err := NewEmitter(brokers, Stream(topic), new(codec.String), opts.emitterOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating emitter for checkpoints: %v", err)
+	}
+	return &Checkpoints{
+		view:    view,
+		emitter: emitter,
+		timeout: opts.timeout,
+	}, nil
+}
+
+// Run loads the checkpoints and keeps them up to date until the context is done.
+func (c *Checkpoints) Run(ctx context.Context) error {
+	defer c.emitter.Finish()
+	return c.view.Run(ctx)
+}
+
+// WaitRecovered blocks until the checkpoints are loaded, see View.WaitRecovered.
+func (c *Checkpoints) WaitRecovered(ctx context.Context) error {
+	return c.view.WaitRecovered(ctx)
+}
+
+// Get returns the value of the checkpoint and whether it is set.
+func (c *Checkpoints) Get(name string) (string, bool, error) {
+	value, err := c.view.Get(name)
+	if err != nil {
+		return "", false, fmt.Errorf("error getting checkpoint %s: %v", name, err)
+	}
+	if value == nil {
+		return "", false, nil
+	}
+	return value.(string), true, nil
+}
+
+// Done returns whether the checkpoint is set.
+func (c *Checkpoints) Done(name string) (bool, error) {
+	_, ok, err := c.Get(name)
+	return ok, err
+}
+
+// Set sets the checkpoint to the value. It returns once the checkpoint is written and
+// loaded, so a following Get returns the value.
+func (c *Checkpoints) Set(name string, value string) error {
+	return c.write(name, value)
+}
+
+// Delete removes the checkpoint.
+func (c *Checkpoints) Delete(name string) error {
+	return c.write(name, nil)
+}
+
+// write emits the value and waits until the view loaded it
+func (c *Checkpoints) write(name string, value interface{}) error {
+	prom, err := c.emitter.Emit(name, value)
+	if err != nil {
+		return fmt.Errorf("error writing checkpoint %s: %v", name, err)
+	}
+	var (
+		token   ConsistencyToken
+		written = make(chan error, 1)
+	)
+	prom.ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+		if msg != nil {
+			token = ConsistencyToken{Partition: msg.Partition, Offset: msg.Offset}
+		}
+		written <- err
+	})
+	if err := <-written; err != nil {
+		return fmt.Errorf("error writing checkpoint %s: %v", name, err)
+	}
+	if _, err := c.view.GetAtLeast(name, token, c.timeout); err != nil {
+		return fmt.Errorf("error loading checkpoint %s: %w", name, err)
+	}
+	return nil
+}
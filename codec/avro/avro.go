@@ -0,0 +1,194 @@
+// Package avro provides a codec encoding values with Avro in the wire format of the
+// Confluent Schema Registry, i.e. a zero magic byte and the big endian schema ID
+// followed by the Avro binary encoding of the value:
+//
+//	registry := avro.NewRegistry("http://localhost:8081")
+//	userCodec, err := avro.NewCodec(registry, "users", `{
+//		"type": "record", "name": "User", "namespace": "com.example",
+//		"fields": [{"name": "name", "type": "string"}, {"name": "age", "type": ["null", "int"]}]
+//	}`)
+//	...
+//	goka.Input("users", userCodec, cb)
+//
+// The codec encodes values with its schema, which is registered under the subject returned
+// by the subject name strategy, and decodes values with the schema of their ID, which is
+// fetched from the registry. Values are decoded with the schema they were written with,
+// there is no schema resolution with a reader schema. Values are represented as
+//
+//	null        nil
+//	boolean     bool
+//	int         int32 (any integer when encoding)
+//	long        int64 (any integer when encoding)
+//	float       float32 (any number when encoding)
+//	double      float64 (any number when encoding)
+//	bytes       []byte
+//	string      string
+//	record      map[string]interface{}
+//	enum        string
+//	array       []interface{} (any slice when encoding)
+//	map         map[string]interface{} (any map with string keys when encoding)
+//	fixed       []byte
+//	union       the value of the branch, which is the first branch matching when encoding
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	magicByte  = 0
+	headerSize = 5
+)
+
+// SubjectNameStrategy returns the subject of the schema of values of a topic.
+type SubjectNameStrategy func(topic string, schema *Schema) string
+
+// TopicNameStrategy uses "<topic>-value" as subject. It is the default of the registry's
+// serializers and requires all values of a topic to have compatible schemas.
+func TopicNameStrategy(topic string, schema *Schema) string {
+	return topic + "-value"
+}
+
+// RecordNameStrategy uses the full name of the schema as subject, so a record type has
+// compatible schemas across topics.
+func RecordNameStrategy(topic string, schema *Schema) string {
+	return schema.Name()
+}
+
+// TopicRecordNameStrategy uses "<topic>-<full name of the schema>" as subject, so
+// a topic can contain multiple record types.
+func TopicRecordNameStrategy(topic string, schema *Schema) string {
+	return topic + "-" + schema.Name()
+}
+
+// Option configures a Codec.
+type Option func(*Codec)
+
+// WithSubjectNameStrategy sets the strategy of the subject the schema is registered under.
+// Defaults to TopicNameStrategy.
+func WithSubjectNameStrategy(strategy SubjectNameStrategy) Option {
+	return func(c *Codec) {
+		c.subjectNameStrategy = strategy
+	}
+}
+
+// WithAutoRegister sets whether the schema is registered on the first encode. Otherwise
+// the schema has to be registered already. Defaults to true.
+func WithAutoRegister(autoRegister bool) Option {
+	return func(c *Codec) {
+		c.autoRegister = autoRegister
+	}
+}
+
+// Codec encodes and decodes values in the wire format of the schema registry.
+type Codec struct {
+	registry            *Registry
+	topic               string
+	schema              *Schema
+	subjectNameStrategy SubjectNameStrategy
+	autoRegister        bool
+
+	m        sync.Mutex
+	schemaID int
+	hasID    bool
+}
+
+// NewCodec creates a codec for the values of the topic. The schema is used to encode
+// values. If it is empty, the codec can only decode values.
+func NewCodec(registry *Registry, topic string, schema string, opts ...Option) (*Codec, error) {
+	if registry == nil {
+		return nil, errors.New("avro codec needs a registry")
+	}
+	c := &Codec{
+		registry:            registry,
+		topic:               topic,
+		subjectNameStrategy: TopicNameStrategy,
+		autoRegister:        true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if schema != "" {
+		parsed, err := ParseSchema(schema)
+		if err != nil {
+			return nil, err
+		}
+		c.schema = parsed
+		if c.subjectNameStrategy(topic, parsed) == "" {
+			return nil, fmt.Errorf("empty subject for schema of topic %s", topic)
+		}
+	}
+	return c, nil
+}
+
+// Subject returns the subject of the codec's schema or an empty string if the codec
+// has no schema.
+func (c *Codec) Subject() string {
+	if c.schema == nil {
+		return ""
+	}
+	return c.subjectNameStrategy(c.topic, c.schema)
+}
+
+// id returns the ID of the codec's schema, registering it if needed
+func (c *Codec) id() (int, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.hasID {
+		return c.schemaID, nil
+	}
+	var (
+		id  int
+		err error
+	)
+	if c.autoRegister {
+		id, err = c.registry.Register(c.Subject(), c.schema)
+	} else {
+		id, err = c.registry.Lookup(c.Subject(), c.schema)
+	}
+	if err != nil {
+		return 0, err
+	}
+	c.schemaID, c.hasID = id, true
+	return id, nil
+}
+
+// Encode encodes the value with the codec's schema.
+func (c *Codec) Encode(value interface{}) ([]byte, error) {
+	if c.schema == nil {
+		return nil, errors.New("avro codec without schema cannot encode")
+	}
+	id, err := c.id()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, headerSize, 64)
+	data[0] = magicByte
+	binary.BigEndian.PutUint32(data[1:headerSize], uint32(id))
+	data, err = encode(data, c.schema, value)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding value: %v", err)
+	}
+	return data, nil
+}
+
+// Decode decodes the data with the schema of its ID.
+func (c *Codec) Decode(data []byte) (interface{}, error) {
+	if len(data) < headerSize || data[0] != magicByte {
+		return nil, errors.New("data is not in the schema registry wire format")
+	}
+	id := int(binary.BigEndian.Uint32(data[1:headerSize]))
+	schema, err := c.registry.Schema(id)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{data: data, pos: headerSize}
+	value, err := d.decode(schema)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding value with schema %d: %v", id, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,147 @@
+package avro
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+// fakeRegistry implements the registry endpoints used by the codec
+type fakeRegistry struct {
+	m        sync.Mutex
+	schemas  []string
+	subjects map[string][]int
+	requests int
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.requests++
+
+	if user, pass, _ := r.BasicAuth(); user != "user" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(&registryError{ErrorCode: 401, Message: "unauthorized"})
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/schemas/ids/"):
+		id, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/schemas/ids/"))
+		if id < 1 || id > len(f.schemas) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(&registryError{ErrorCode: 40403, Message: "Schema not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(&schemaResponse{Schema: f.schemas[id-1]})
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/subjects/"):
+		var req schemaRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		subject := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/subjects/"), "/versions")
+		for _, id := range f.subjects[subject] {
+			if f.schemas[id-1] == req.Schema {
+				json.NewEncoder(w).Encode(&schemaResponse{ID: id})
+				return
+			}
+		}
+		if !strings.HasSuffix(r.URL.Path, "/versions") {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(&registryError{ErrorCode: 40403, Message: "Schema not found"})
+			return
+		}
+		f.schemas = append(f.schemas, req.Schema)
+		f.subjects[subject] = append(f.subjects[subject], len(f.schemas))
+		json.NewEncoder(w).Encode(&schemaResponse{ID: len(f.schemas)})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestCodec(t *testing.T) {
+	fake := &fakeRegistry{subjects: make(map[string][]int)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	registry := NewRegistry(srv.URL, WithRegistryBasicAuth("user", "secret"))
+
+	c, err := NewCodec(registry, "users", testSchema)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, c.Subject(), "users-value")
+
+	user := map[string]interface{}{
+		"name":       "alice",
+		"score":      1.5,
+		"active":     true,
+		"role":       "USER",
+		"tags":       []string{},
+		"attributes": map[string]int64{},
+		"id":         []byte{1, 2},
+	}
+	data, err := c.Encode(user)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, data[:headerSize], []byte{0, 0, 0, 0, 1})
+	_, err = c.Encode(user)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, fake.requests, 1)
+
+	// a decoding codec fetches the schema by ID
+	decoding, err := NewCodec(NewRegistry(srv.URL, WithRegistryBasicAuth("user", "secret")), "users", "")
+	test.AssertNil(t, err)
+	value, err := decoding.Decode(data)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value.(map[string]interface{})["name"], "alice")
+	test.AssertEqual(t, value.(map[string]interface{})["age"], nil)
+	_, err = decoding.Decode(data)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, fake.requests, 2)
+
+	_, err = decoding.Encode(user)
+	test.AssertNotNil(t, err)
+	_, err = decoding.Decode([]byte("plain"))
+	test.AssertNotNil(t, err)
+	_, err = decoding.Decode([]byte{0, 0, 0, 0, 9})
+	test.AssertNotNil(t, err)
+}
+
+func TestCodec_SubjectNameStrategies(t *testing.T) {
+	fake := &fakeRegistry{subjects: make(map[string][]int)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	registry := NewRegistry(srv.URL, WithRegistryBasicAuth("user", "secret"))
+
+	schema := `{"type": "record", "name": "Event", "namespace": "com.example", "fields": []}`
+	for _, tc := range []struct {
+		strategy SubjectNameStrategy
+		subject  string
+	}{
+		{TopicNameStrategy, "events-value"},
+		{RecordNameStrategy, "com.example.Event"},
+		{TopicRecordNameStrategy, "events-com.example.Event"},
+	} {
+		c, err := NewCodec(registry, "events", schema, WithSubjectNameStrategy(tc.strategy))
+		test.AssertNil(t, err)
+		test.AssertEqual(t, c.Subject(), tc.subject)
+		_, err = c.Encode(map[string]interface{}{})
+		test.AssertNil(t, err)
+		test.AssertEqual(t, len(fake.subjects[tc.subject]), 1)
+	}
+
+	// primitive schemas have no name
+	_, err := NewCodec(registry, "events", `"string"`, WithSubjectNameStrategy(RecordNameStrategy))
+	test.AssertNotNil(t, err)
+
+	// without auto registering, the schema must exist
+	c, err := NewCodec(registry, "other", schema, WithAutoRegister(false))
+	test.AssertNil(t, err)
+	_, err = c.Encode(map[string]interface{}{})
+	test.AssertNotNil(t, err)
+
+	// unauthorized requests fail with the registry's message
+	_, err = NewRegistry(srv.URL).Schema(1)
+	test.AssertTrue(t, err != nil && strings.Contains(err.Error(), "unauthorized"))
+}
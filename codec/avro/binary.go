@@ -0,0 +1,466 @@
+package avro
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+var errShortBuffer = errors.New("unexpected end of data")
+
+// encode appends the binary encoding of value to buf
+func encode(buf []byte, s *Schema, value interface{}) ([]byte, error) {
+	switch s.typ {
+	case typeNull:
+		if value != nil {
+			return nil, fmt.Errorf("expected nil, got %T", value)
+		}
+		return buf, nil
+	case typeBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected bool, got %T", value)
+		}
+		if b {
+			return append(buf, 1), nil
+		}
+		return append(buf, 0), nil
+	case typeInt, typeLong:
+		n, ok := toInt64(value)
+		if !ok {
+			return nil, fmt.Errorf("expected integer for %s, got %T", s.typ, value)
+		}
+		if s.typ == typeInt && (n < math.MinInt32 || n > math.MaxInt32) {
+			return nil, fmt.Errorf("value %d overflows int", n)
+		}
+		return appendLong(buf, n), nil
+	case typeFloat:
+		f, ok := toFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("expected number for float, got %T", value)
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], math.Float32bits(float32(f)))
+		return append(buf, b[:]...), nil
+	case typeDouble:
+		f, ok := toFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("expected number for double, got %T", value)
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		return append(buf, b[:]...), nil
+	case typeBytes:
+		b, ok := value.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("expected []byte, got %T", value)
+		}
+		return append(appendLong(buf, int64(len(b))), b...), nil
+	case typeString:
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string, got %T", value)
+		}
+		return append(appendLong(buf, int64(len(str))), str...), nil
+	case typeRecord:
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected map[string]interface{} for record %s, got %T", s.name, value)
+		}
+		var err error
+		for _, f := range s.fields {
+			fieldValue, ok := record[f.name]
+			if !ok {
+				if !f.hasDefault {
+					return nil, fmt.Errorf("missing field %s of record %s", f.name, s.name)
+				}
+				fieldValue = defaultValue(f.schema, f.def)
+			}
+			if buf, err = encode(buf, f.schema, fieldValue); err != nil {
+				return nil, fmt.Errorf("error encoding field %s of record %s: %v", f.name, s.name, err)
+			}
+		}
+		return buf, nil
+	case typeEnum:
+		symbol, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected string for enum %s, got %T", s.name, value)
+		}
+		for i, sym := range s.symbols {
+			if sym == symbol {
+				return appendLong(buf, int64(i)), nil
+			}
+		}
+		return nil, fmt.Errorf("invalid symbol %q for enum %s", symbol, s.name)
+	case typeArray:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, fmt.Errorf("expected slice for array, got %T", value)
+		}
+		if v.Len() > 0 {
+			buf = appendLong(buf, int64(v.Len()))
+			var err error
+			for i := 0; i < v.Len(); i++ {
+				if buf, err = encode(buf, s.items, v.Index(i).Interface()); err != nil {
+					return nil, fmt.Errorf("error encoding array item %d: %v", i, err)
+				}
+			}
+		}
+		return appendLong(buf, 0), nil
+	case typeMap:
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("expected map with string keys, got %T", value)
+		}
+		if v.Len() > 0 {
+			buf = appendLong(buf, int64(v.Len()))
+			iter := v.MapRange()
+			var err error
+			for iter.Next() {
+				key := iter.Key().String()
+				buf = append(appendLong(buf, int64(len(key))), key...)
+				if buf, err = encode(buf, s.values, iter.Value().Interface()); err != nil {
+					return nil, fmt.Errorf("error encoding map value %s: %v", key, err)
+				}
+			}
+		}
+		return appendLong(buf, 0), nil
+	case typeFixed:
+		b, ok := value.([]byte)
+		if !ok || len(b) != s.size {
+			return nil, fmt.Errorf("expected []byte of size %d for fixed %s", s.size, s.name)
+		}
+		return append(buf, b...), nil
+	case typeUnion:
+		for i, branch := range s.branches {
+			if matches(branch, value) {
+				return encode(appendLong(buf, int64(i)), branch, value)
+			}
+		}
+		return nil, fmt.Errorf("no union branch matches %T", value)
+	default:
+		return nil, fmt.Errorf("unsupported type %s", s.typ)
+	}
+}
+
+// matches returns whether the value can be encoded with the schema of a union branch
+func matches(s *Schema, value interface{}) bool {
+	switch s.typ {
+	case typeNull:
+		return value == nil
+	case typeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case typeInt, typeLong:
+		_, ok := toInt64(value)
+		return ok
+	case typeFloat, typeDouble:
+		_, ok := toFloat64(value)
+		return ok
+	case typeBytes:
+		_, ok := value.([]byte)
+		return ok
+	case typeString:
+		_, ok := value.(string)
+		return ok
+	case typeRecord:
+		_, ok := value.(map[string]interface{})
+		return ok
+	case typeEnum:
+		symbol, ok := value.(string)
+		if !ok {
+			return false
+		}
+		for _, sym := range s.symbols {
+			if sym == symbol {
+				return true
+			}
+		}
+		return false
+	case typeArray:
+		v := reflect.ValueOf(value)
+		return v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8
+	case typeMap:
+		v := reflect.ValueOf(value)
+		return v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String
+	case typeFixed:
+		b, ok := value.([]byte)
+		return ok && len(b) == s.size
+	default:
+		return false
+	}
+}
+
+// defaultValue converts the JSON default of a field to the value representation.
+// Defaults of unions are values of the first branch.
+func defaultValue(s *Schema, def interface{}) interface{} {
+	if s.typ == typeUnion && len(s.branches) > 0 {
+		s = s.branches[0]
+	}
+	switch s.typ {
+	case typeBytes, typeFixed:
+		if str, ok := def.(string); ok {
+			// JSON encodes bytes as string of code points 0-255
+			b := make([]byte, 0, len(str))
+			for _, r := range str {
+				b = append(b, byte(r))
+			}
+			return b
+		}
+	case typeRecord:
+		if record, ok := def.(map[string]interface{}); ok {
+			converted := make(map[string]interface{}, len(record))
+			for _, f := range s.fields {
+				if v, ok := record[f.name]; ok {
+					converted[f.name] = defaultValue(f.schema, v)
+				}
+			}
+			return converted
+		}
+	case typeArray:
+		if items, ok := def.([]interface{}); ok {
+			converted := make([]interface{}, len(items))
+			for i, item := range items {
+				converted[i] = defaultValue(s.items, item)
+			}
+			return converted
+		}
+	case typeMap:
+		if values, ok := def.(map[string]interface{}); ok {
+			converted := make(map[string]interface{}, len(values))
+			for key, v := range values {
+				converted[key] = defaultValue(s.values, v)
+			}
+			return converted
+		}
+	}
+	return def
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case float64:
+		// e.g. defaults decoded from JSON
+		if v != math.Trunc(v) {
+			return 0, false
+		}
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		n, ok := toInt64(value)
+		return float64(n), ok
+	}
+}
+
+// appendLong appends the zig-zag varint encoding of n
+func appendLong(buf []byte, n int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], n)]...)
+}
+
+// decoder decodes values from binary data
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) readLong() (int64, error) {
+	n, size := binary.Varint(d.data[d.pos:])
+	if size <= 0 {
+		return 0, errShortBuffer
+	}
+	d.pos += size
+	return n, nil
+}
+
+func (d *decoder) readBytes(n int) ([]byte, error) {
+	if n < 0 || d.pos+n > len(d.data) {
+		return nil, errShortBuffer
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) readLengthPrefixed() ([]byte, error) {
+	n, err := d.readLong()
+	if err != nil {
+		return nil, err
+	}
+	return d.readBytes(int(n))
+}
+
+// readBlockCount reads the item count of an array or map block
+func (d *decoder) readBlockCount() (int64, error) {
+	count, err := d.readLong()
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		// negative counts are followed by the size of the block in bytes
+		count = -count
+		if _, err := d.readLong(); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+func (d *decoder) decode(s *Schema) (interface{}, error) {
+	switch s.typ {
+	case typeNull:
+		return nil, nil
+	case typeBoolean:
+		b, err := d.readBytes(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	case typeInt:
+		n, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		return int32(n), nil
+	case typeLong:
+		return d.readLong()
+	case typeFloat:
+		b, err := d.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float32frombits(binary.LittleEndian.Uint32(b)), nil
+	case typeDouble:
+		b, err := d.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case typeBytes:
+		b, err := d.readLengthPrefixed()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case typeString:
+		b, err := d.readLengthPrefixed()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case typeRecord:
+		record := make(map[string]interface{}, len(s.fields))
+		for _, f := range s.fields {
+			v, err := d.decode(f.schema)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding field %s of record %s: %v", f.name, s.name, err)
+			}
+			record[f.name] = v
+		}
+		return record, nil
+	case typeEnum:
+		i, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.symbols) {
+			return nil, fmt.Errorf("invalid symbol index %d for enum %s", i, s.name)
+		}
+		return s.symbols[i], nil
+	case typeArray:
+		items := []interface{}{}
+		for {
+			count, err := d.readBlockCount()
+			if err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				return items, nil
+			}
+			for ; count > 0; count-- {
+				item, err := d.decode(s.items)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+		}
+	case typeMap:
+		values := make(map[string]interface{})
+		for {
+			count, err := d.readBlockCount()
+			if err != nil {
+				return nil, err
+			}
+			if count == 0 {
+				return values, nil
+			}
+			for ; count > 0; count-- {
+				key, err := d.readLengthPrefixed()
+				if err != nil {
+					return nil, err
+				}
+				value, err := d.decode(s.values)
+				if err != nil {
+					return nil, err
+				}
+				values[string(key)] = value
+			}
+		}
+	case typeFixed:
+		b, err := d.readBytes(s.size)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case typeUnion:
+		i, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || int(i) >= len(s.branches) {
+			return nil, fmt.Errorf("invalid union branch %d", i)
+		}
+		return d.decode(s.branches[i])
+	default:
+		return nil, fmt.Errorf("unsupported type %s", s.typ)
+	}
+}
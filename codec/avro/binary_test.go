@@ -0,0 +1,150 @@
+package avro
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+const testSchema = `{
+	"type": "record", "name": "User", "namespace": "com.example",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": ["null", "int"], "default": null},
+		{"name": "score", "type": "double"},
+		{"name": "active", "type": "boolean"},
+		{"name": "role", "type": {"type": "enum", "name": "Role", "symbols": ["ADMIN", "USER"]}},
+		{"name": "tags", "type": {"type": "array", "items": "string"}},
+		{"name": "attributes", "type": {"type": "map", "values": "long"}},
+		{"name": "id", "type": {"type": "fixed", "name": "ID", "size": 2}},
+		{"name": "manager", "type": ["null", "User"], "default": null},
+		{"name": "created", "type": {"type": "long", "logicalType": "timestamp-millis"}, "default": 0}
+	]
+}`
+
+func TestEncode_Primitives(t *testing.T) {
+	// examples of the avro specification
+	for _, tc := range []struct {
+		schema   string
+		value    interface{}
+		expected []byte
+	}{
+		{`"long"`, 0, []byte{0x00}},
+		{`"long"`, -1, []byte{0x01}},
+		{`"long"`, 1, []byte{0x02}},
+		{`"long"`, -64, []byte{0x7f}},
+		{`"long"`, 64, []byte{0x80, 0x01}},
+		{`"string"`, "foo", []byte{0x06, 0x66, 0x6f, 0x6f}},
+		{`["null", "string"]`, nil, []byte{0x00}},
+		{`["null", "string"]`, "a", []byte{0x02, 0x02, 0x61}},
+		{`{"type": "array", "items": "long"}`, []int{3, 27}, []byte{0x04, 0x06, 0x36, 0x00}},
+	} {
+		s, err := ParseSchema(tc.schema)
+		test.AssertNil(t, err)
+		data, err := encode(nil, s, tc.value)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, data, tc.expected)
+	}
+}
+
+func TestEncode_Roundtrip(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, s.Type(), "record")
+	test.AssertEqual(t, s.Name(), "com.example.User")
+
+	user := map[string]interface{}{
+		"name":       "alice",
+		"age":        30,
+		"score":      1.5,
+		"active":     true,
+		"role":       "ADMIN",
+		"tags":       []string{"a", "b"},
+		"attributes": map[string]int64{"logins": 12},
+		"id":         []byte{1, 2},
+		"manager": map[string]interface{}{
+			"name":       "bob",
+			"score":      2,
+			"active":     false,
+			"role":       "USER",
+			"tags":       []interface{}{},
+			"attributes": map[string]interface{}{},
+			"id":         []byte{3, 4},
+		},
+	}
+	data, err := encode(nil, s, user)
+	test.AssertNil(t, err)
+
+	d := &decoder{data: data}
+	decoded, err := d.decode(s)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, d.pos, len(data))
+	test.AssertEqual(t, decoded, map[string]interface{}{
+		"name":       "alice",
+		"age":        int32(30),
+		"score":      1.5,
+		"active":     true,
+		"role":       "ADMIN",
+		"tags":       []interface{}{"a", "b"},
+		"attributes": map[string]interface{}{"logins": int64(12)},
+		"id":         []byte{1, 2},
+		"manager": map[string]interface{}{
+			"name":       "bob",
+			"age":        nil,
+			"score":      float64(2),
+			"active":     false,
+			"role":       "USER",
+			"tags":       []interface{}{},
+			"attributes": map[string]interface{}{},
+			"id":         []byte{3, 4},
+			"manager":    nil,
+			"created":    int64(0),
+		},
+		"created": int64(0),
+	})
+}
+
+func TestEncode_Invalid(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	test.AssertNil(t, err)
+
+	for _, value := range []interface{}{
+		"not a record",
+		map[string]interface{}{"name": "missing fields"},
+	} {
+		_, err := encode(nil, s, value)
+		test.AssertNotNil(t, err)
+	}
+
+	enum, err := ParseSchema(`{"type": "enum", "name": "E", "symbols": ["A"]}`)
+	test.AssertNil(t, err)
+	_, err = encode(nil, enum, "B")
+	test.AssertNotNil(t, err)
+
+	integer, err := ParseSchema(`"int"`)
+	test.AssertNil(t, err)
+	_, err = encode(nil, integer, int64(1)<<40)
+	test.AssertNotNil(t, err)
+
+	d := &decoder{data: []byte{0x06, 0x66}}
+	str, err := ParseSchema(`"string"`)
+	test.AssertNil(t, err)
+	_, err = d.decode(str)
+	test.AssertNotNil(t, err)
+}
+
+func TestParseSchema_Invalid(t *testing.T) {
+	for _, schema := range []string{
+		`not json`,
+		`"unknown"`,
+		`{"type": "record", "fields": []}`,
+		`{"type": "record", "name": "R", "fields": [{"name": "f", "type": "Unknown"}]}`,
+		`{"type": "enum", "name": "E"}`,
+		`{"type": "fixed", "name": "F"}`,
+		`["null", ["string"]]`,
+		`[{"type": "enum", "name": "E", "symbols": []}, {"type": "enum", "name": "E", "symbols": []}]`,
+	} {
+		_, err := ParseSchema(schema)
+		test.AssertNotNil(t, err)
+	}
+}
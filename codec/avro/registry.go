@@ -0,0 +1,170 @@
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// RegistryOption configures a Registry.
+type RegistryOption func(*Registry)
+
+// WithRegistryClient sets the HTTP client used for requests. Defaults to http.DefaultClient.
+func WithRegistryClient(client *http.Client) RegistryOption {
+	return func(r *Registry) {
+		r.client = client
+	}
+}
+
+// WithRegistryBasicAuth sets the credentials of requests.
+func WithRegistryBasicAuth(username, password string) RegistryOption {
+	return func(r *Registry) {
+		r.username = username
+		r.password = password
+	}
+}
+
+// Registry is a client of the Confluent Schema Registry. The IDs and schemas are
+// cached, as registered schemas are immutable.
+type Registry struct {
+	url      string
+	client   *http.Client
+	username string
+	password string
+
+	m       sync.Mutex
+	ids     map[string]int
+	schemas map[int]*Schema
+}
+
+// NewRegistry creates a client of the schema registry at url, e.g. "http://localhost:8081".
+func NewRegistry(url string, opts ...RegistryOption) *Registry {
+	r := &Registry{
+		url:     strings.TrimSuffix(url, "/"),
+		client:  http.DefaultClient,
+		ids:     make(map[string]int),
+		schemas: make(map[int]*Schema),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// registryError is the body of error responses
+type registryError struct {
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+type schemaRequest struct {
+	Schema string `json:"schema"`
+}
+
+type schemaResponse struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+// Register registers the schema under the subject and returns its ID. Registering
+// a schema that is already registered returns the existing ID.
+func (r *Registry) Register(subject string, schema *Schema) (int, error) {
+	return r.id(subject, schema, "/subjects/"+url.PathEscape(subject)+"/versions")
+}
+
+// Lookup returns the ID of the schema registered under the subject.
+func (r *Registry) Lookup(subject string, schema *Schema) (int, error) {
+	return r.id(subject, schema, "/subjects/"+url.PathEscape(subject))
+}
+
+func (r *Registry) id(subject string, schema *Schema, path string) (int, error) {
+	cacheKey := subject + "\x00" + schema.String()
+	r.m.Lock()
+	id, ok := r.ids[cacheKey]
+	r.m.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	body, err := json.Marshal(&schemaRequest{Schema: schema.String()})
+	if err != nil {
+		return 0, err
+	}
+	var resp schemaResponse
+	if err := r.do(http.MethodPost, path, bytes.NewReader(body), &resp); err != nil {
+		return 0, fmt.Errorf("error getting ID of schema for subject %s: %v", subject, err)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.ids[cacheKey] = resp.ID
+	if _, ok := r.schemas[resp.ID]; !ok {
+		r.schemas[resp.ID] = schema
+	}
+	return resp.ID, nil
+}
+
+// Schema returns the schema with the ID.
+func (r *Registry) Schema(id int) (*Schema, error) {
+	r.m.Lock()
+	schema, ok := r.schemas[id]
+	r.m.Unlock()
+	if ok {
+		return schema, nil
+	}
+
+	var resp schemaResponse
+	if err := r.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return nil, fmt.Errorf("error getting schema %d: %v", id, err)
+	}
+	schema, err := ParseSchema(resp.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing schema %d: %v", id, err)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.schemas[id] = schema
+	return schema, nil
+}
+
+func (r *Registry) do(method, path string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest(method, r.url+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", registryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", registryContentType)
+	}
+	if r.username != "" {
+		req.SetBasicAuth(r.username, r.password)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var regErr registryError
+		if json.Unmarshal(data, &regErr) == nil && regErr.Message != "" {
+			return fmt.Errorf("registry error %d: %s", regErr.ErrorCode, regErr.Message)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.Unmarshal(data, result)
+}
@@ -0,0 +1,219 @@
+package avro
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Avro types
+const (
+	typeNull    = "null"
+	typeBoolean = "boolean"
+	typeInt     = "int"
+	typeLong    = "long"
+	typeFloat   = "float"
+	typeDouble  = "double"
+	typeBytes   = "bytes"
+	typeString  = "string"
+	typeRecord  = "record"
+	typeEnum    = "enum"
+	typeArray   = "array"
+	typeMap     = "map"
+	typeFixed   = "fixed"
+	typeUnion   = "union"
+)
+
+// Schema is a parsed Avro schema. Logical types are encoded as their underlying type.
+type Schema struct {
+	typ string
+	// name is the full name of named types (record, enum, fixed)
+	name string
+
+	fields   []*field
+	symbols  []string
+	items    *Schema
+	values   *Schema
+	branches []*Schema
+	size     int
+
+	// source is the JSON the schema was parsed from, only set for the root schema
+	source string
+}
+
+type field struct {
+	name       string
+	schema     *Schema
+	def        interface{}
+	hasDefault bool
+}
+
+// ParseSchema parses a schema in Avro's JSON format.
+func ParseSchema(schema string) (*Schema, error) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(schema), &data); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %v", err)
+	}
+	s, err := parse(data, "", make(map[string]*Schema))
+	if err != nil {
+		return nil, err
+	}
+	s.source = schema
+	return s, nil
+}
+
+// String returns the JSON of the schema.
+func (s *Schema) String() string {
+	return s.source
+}
+
+// Type returns the Avro type of the schema, e.g. "record" or "union".
+func (s *Schema) Type() string {
+	return s.typ
+}
+
+// Name returns the full name of named schemas (records, enums and fixed) or an empty string.
+func (s *Schema) Name() string {
+	return s.name
+}
+
+func parse(data interface{}, namespace string, names map[string]*Schema) (*Schema, error) {
+	switch d := data.(type) {
+	case string:
+		switch d {
+		case typeNull, typeBoolean, typeInt, typeLong, typeFloat, typeDouble, typeBytes, typeString:
+			return &Schema{typ: d}, nil
+		}
+		if s, ok := names[fullName(d, namespace)]; ok {
+			return s, nil
+		}
+		if s, ok := names[d]; ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", d)
+	case []interface{}:
+		s := &Schema{typ: typeUnion}
+		for _, branch := range d {
+			b, err := parse(branch, namespace, names)
+			if err != nil {
+				return nil, err
+			}
+			if b.typ == typeUnion {
+				return nil, fmt.Errorf("unions must not contain unions")
+			}
+			s.branches = append(s.branches, b)
+		}
+		return s, nil
+	case map[string]interface{}:
+		return parseComplex(d, namespace, names)
+	default:
+		return nil, fmt.Errorf("invalid schema %v", data)
+	}
+}
+
+func parseComplex(d map[string]interface{}, namespace string, names map[string]*Schema) (*Schema, error) {
+	typ, ok := d["type"]
+	if !ok {
+		return nil, fmt.Errorf("schema without type: %v", d)
+	}
+	typeName, ok := typ.(string)
+	if !ok {
+		// e.g. {"type": {"type": "array", ...}}
+		return parse(typ, namespace, names)
+	}
+
+	switch typeName {
+	case typeRecord, "error", typeEnum, typeFixed:
+	case typeArray:
+		items, err := parse(d["items"], namespace, names)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array items: %v", err)
+		}
+		return &Schema{typ: typeArray, items: items}, nil
+	case typeMap:
+		values, err := parse(d["values"], namespace, names)
+		if err != nil {
+			return nil, fmt.Errorf("invalid map values: %v", err)
+		}
+		return &Schema{typ: typeMap, values: values}, nil
+	default:
+		// primitive types with attributes, e.g. logical types
+		return parse(typeName, namespace, names)
+	}
+
+	// named types
+	name, _ := d["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%s without name", typeName)
+	}
+	if ns, ok := d["namespace"].(string); ok {
+		namespace = ns
+	}
+	s := &Schema{name: fullName(name, namespace)}
+	if i := strings.LastIndex(s.name, "."); i >= 0 {
+		namespace = s.name[:i]
+	}
+	if _, exists := names[s.name]; exists {
+		return nil, fmt.Errorf("duplicate type %s", s.name)
+	}
+	names[s.name] = s
+
+	switch typeName {
+	case typeRecord, "error":
+		s.typ = typeRecord
+		fields, ok := d["fields"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record %s without fields", s.name)
+		}
+		for _, f := range fields {
+			fd, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid field in record %s: %v", s.name, f)
+			}
+			fieldName, _ := fd["name"].(string)
+			if fieldName == "" {
+				return nil, fmt.Errorf("field without name in record %s", s.name)
+			}
+			fieldSchema, err := parse(fd["type"], namespace, names)
+			if err != nil {
+				return nil, fmt.Errorf("invalid field %s in record %s: %v", fieldName, s.name, err)
+			}
+			def, hasDefault := fd["default"]
+			s.fields = append(s.fields, &field{
+				name:       fieldName,
+				schema:     fieldSchema,
+				def:        def,
+				hasDefault: hasDefault,
+			})
+		}
+	case typeEnum:
+		s.typ = typeEnum
+		symbols, ok := d["symbols"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("enum %s without symbols", s.name)
+		}
+		for _, symbol := range symbols {
+			sym, ok := symbol.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid symbol in enum %s: %v", s.name, symbol)
+			}
+			s.symbols = append(s.symbols, sym)
+		}
+	case typeFixed:
+		s.typ = typeFixed
+		size, ok := d["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed %s without valid size", s.name)
+		}
+		s.size = int(size)
+	}
+	return s, nil
+}
+
+// fullName returns the name qualified with the namespace, unless it is already qualified
+func fullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
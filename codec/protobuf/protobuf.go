@@ -0,0 +1,192 @@
+// Package protobuf provides a codec for protobuf messages, optionally framed in the
+// wire format of the Confluent Schema Registry to interoperate with producers using
+// the registry's serializers, e.g. Java or Kafka Streams applications.
+//
+// The codec does not depend on a protobuf library, the messages are marshaled by the
+// passed functions, e.g. with google.golang.org/protobuf/proto:
+//
+//	userCodec := protobuf.NewCodec(
+//		func(value interface{}) ([]byte, error) {
+//			return proto.Marshal(value.(*pb.User))
+//		},
+//		func(data []byte) (interface{}, error) {
+//			user := new(pb.User)
+//			return user, proto.Unmarshal(data, user)
+//		},
+//		protobuf.WithRegistryFraming(userSchemaID),
+//	)
+//
+// The framing consists of a zero magic byte, the big endian schema ID and the indexes
+// of the message type in the schema's proto file, followed by the serialized message.
+package protobuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	magicByte  = 0
+	headerSize = 5
+	// maxMessageIndexes limits the decoded message indexes to protect against invalid data
+	maxMessageIndexes = 100
+)
+
+// MarshalFunc serializes a message.
+type MarshalFunc func(value interface{}) ([]byte, error)
+
+// UnmarshalFunc deserializes a message.
+type UnmarshalFunc func(data []byte) (interface{}, error)
+
+// Frame is the schema registry framing of a message.
+type Frame struct {
+	// SchemaID is the ID of the schema in the registry
+	SchemaID int
+	// MessageIndexes is the path of the message type in the proto file, e.g. [0] for
+	// the first message or [1, 0] for the first nested message of the second message.
+	MessageIndexes []int
+}
+
+// AppendFrame appends the framing to buf.
+func AppendFrame(buf []byte, frame Frame) []byte {
+	var header [headerSize]byte
+	header[0] = magicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(frame.SchemaID))
+	buf = append(buf, header[:]...)
+
+	// the first message is encoded as a single 0 instead of [1, 0]
+	if len(frame.MessageIndexes) == 1 && frame.MessageIndexes[0] == 0 {
+		return appendVarint(buf, 0)
+	}
+	buf = appendVarint(buf, int64(len(frame.MessageIndexes)))
+	for _, index := range frame.MessageIndexes {
+		buf = appendVarint(buf, int64(index))
+	}
+	return buf
+}
+
+// ParseFrame parses the framing of data and returns the frame and the serialized message.
+func ParseFrame(data []byte) (Frame, []byte, error) {
+	var frame Frame
+	if len(data) < headerSize || data[0] != magicByte {
+		return frame, nil, errors.New("data is not in the schema registry wire format")
+	}
+	frame.SchemaID = int(binary.BigEndian.Uint32(data[1:headerSize]))
+	pos := headerSize
+
+	count, n := binary.Varint(data[pos:])
+	if n <= 0 {
+		return frame, nil, errors.New("invalid message indexes")
+	}
+	pos += n
+	if count == 0 {
+		frame.MessageIndexes = []int{0}
+		return frame, data[pos:], nil
+	}
+	if count < 0 || count > maxMessageIndexes {
+		return frame, nil, fmt.Errorf("invalid number of message indexes: %d", count)
+	}
+	frame.MessageIndexes = make([]int, count)
+	for i := range frame.MessageIndexes {
+		index, n := binary.Varint(data[pos:])
+		if n <= 0 || index < 0 {
+			return frame, nil, errors.New("invalid message indexes")
+		}
+		pos += n
+		frame.MessageIndexes[i] = int(index)
+	}
+	return frame, data[pos:], nil
+}
+
+// appendVarint appends the zig-zag varint encoding of n, as used by the framing
+func appendVarint(buf []byte, n int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], n)]...)
+}
+
+// Option configures a Codec.
+type Option func(*Codec)
+
+// WithRegistryFraming frames encoded messages with the schema ID and the message indexes,
+// which default to the first message of the schema. Decoded messages must be framed,
+// their schema ID and message indexes are not checked, so messages written with other
+// versions of the schema are decoded too.
+func WithRegistryFraming(schemaID int, messageIndexes ...int) Option {
+	return func(c *Codec) {
+		if len(messageIndexes) == 0 {
+			messageIndexes = []int{0}
+		}
+		c.frame = &Frame{
+			SchemaID:       schemaID,
+			MessageIndexes: messageIndexes,
+		}
+	}
+}
+
+// WithFrameUnmarshal decodes framed messages with the function, e.g. to choose the
+// message type by the message indexes. Implies registry framing for decoding.
+func WithFrameUnmarshal(unmarshal func(frame Frame, data []byte) (interface{}, error)) Option {
+	return func(c *Codec) {
+		c.frameUnmarshal = unmarshal
+	}
+}
+
+// Codec encodes and decodes protobuf messages.
+type Codec struct {
+	marshal        MarshalFunc
+	unmarshal      UnmarshalFunc
+	frame          *Frame
+	frameUnmarshal func(frame Frame, data []byte) (interface{}, error)
+}
+
+// NewCodec creates a codec using the functions to (de)serialize messages.
+func NewCodec(marshal MarshalFunc, unmarshal UnmarshalFunc, opts ...Option) *Codec {
+	c := &Codec{
+		marshal:   marshal,
+		unmarshal: unmarshal,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Encode serializes the message and frames it if configured.
+func (c *Codec) Encode(value interface{}) ([]byte, error) {
+	data, err := c.marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling protobuf message: %v", err)
+	}
+	if c.frame == nil {
+		return data, nil
+	}
+	return append(AppendFrame(make([]byte, 0, headerSize+4+len(data)), *c.frame), data...), nil
+}
+
+// Decode removes the framing if configured and deserializes the message.
+func (c *Codec) Decode(data []byte) (interface{}, error) {
+	if c.frame == nil && c.frameUnmarshal == nil {
+		return c.decode(data)
+	}
+	frame, payload, err := ParseFrame(data)
+	if err != nil {
+		return nil, err
+	}
+	if c.frameUnmarshal != nil {
+		value, err := c.frameUnmarshal(frame, payload)
+		if err != nil {
+			return nil, fmt.Errorf("error unmarshaling protobuf message of schema %d: %v", frame.SchemaID, err)
+		}
+		return value, nil
+	}
+	return c.decode(payload)
+}
+
+func (c *Codec) decode(data []byte) (interface{}, error) {
+	value, err := c.unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling protobuf message: %v", err)
+	}
+	return value, nil
+}
@@ -0,0 +1,93 @@
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+// name is a message with a single string field 1, serialized by hand
+type name struct {
+	value string
+}
+
+func marshalName(value interface{}) ([]byte, error) {
+	n, ok := value.(*name)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T", value)
+	}
+	return append([]byte{0x0a, byte(len(n.value))}, n.value...), nil
+}
+
+func unmarshalName(data []byte) (interface{}, error) {
+	if len(data) < 2 || data[0] != 0x0a || int(data[1]) != len(data)-2 {
+		return nil, errors.New("invalid message")
+	}
+	return &name{value: string(data[2:])}, nil
+}
+
+func TestCodec(t *testing.T) {
+	c := NewCodec(marshalName, unmarshalName)
+	data, err := c.Encode(&name{value: "abc"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, data, []byte{0x0a, 0x03, 'a', 'b', 'c'})
+	value, err := c.Decode(data)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, &name{value: "abc"})
+
+	_, err = c.Encode("abc")
+	test.AssertNotNil(t, err)
+	_, err = c.Decode([]byte{0x01})
+	test.AssertNotNil(t, err)
+}
+
+func TestCodec_RegistryFraming(t *testing.T) {
+	c := NewCodec(marshalName, unmarshalName, WithRegistryFraming(7))
+	data, err := c.Encode(&name{value: "a"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, data, []byte{0, 0, 0, 0, 7, 0, 0x0a, 0x01, 'a'})
+	value, err := c.Decode(data)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, &name{value: "a"})
+
+	// unframed messages fail
+	_, err = c.Decode([]byte{0x0a, 0x01, 'a'})
+	test.AssertNotNil(t, err)
+
+	c = NewCodec(marshalName, unmarshalName, WithRegistryFraming(258, 1, 0))
+	data, err = c.Encode(&name{value: "a"})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, data, []byte{0, 0, 0, 1, 2, 0x04, 0x02, 0x00, 0x0a, 0x01, 'a'})
+}
+
+func TestCodec_FrameUnmarshal(t *testing.T) {
+	var frames []Frame
+	c := NewCodec(marshalName, nil, WithFrameUnmarshal(func(frame Frame, data []byte) (interface{}, error) {
+		frames = append(frames, frame)
+		return unmarshalName(data)
+	}))
+	_, err := c.Decode([]byte{0, 0, 0, 0, 3, 0x04, 0x02, 0x00, 0x0a, 0x01, 'a'})
+	test.AssertNil(t, err)
+	_, err = c.Decode([]byte{0, 0, 0, 0, 4, 0x00, 0x0a, 0x01, 'b'})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, frames, []Frame{
+		{SchemaID: 3, MessageIndexes: []int{1, 0}},
+		{SchemaID: 4, MessageIndexes: []int{0}},
+	})
+}
+
+func TestParseFrame_Invalid(t *testing.T) {
+	for _, data := range [][]byte{
+		nil,
+		{1, 0, 0, 0, 1, 0},
+		{0, 0, 0, 0, 1},
+		{0, 0, 0, 0, 1, 0x01},
+		{0, 0, 0, 0, 1, 0x04, 0x02},
+		{0, 0, 0, 0, 1, 0x02, 0x01},
+	} {
+		_, _, err := ParseFrame(data)
+		test.AssertNotNil(t, err)
+	}
+}
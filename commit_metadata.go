@@ -0,0 +1,54 @@
+package goka
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// CommitMetadata is stored by processors alongside the offsets they commit, so
+// operators can see which instance committed a partition last, e.g. when
+// debugging rebalances.
+type CommitMetadata struct {
+	// InstanceID identifies the processor instance, see WithInstanceID
+	InstanceID string `json:"instance,omitempty"`
+	// Version of the processor, see WithInstanceVersion
+	Version string `json:"version,omitempty"`
+	// Timestamp is the time the instance started processing the partition
+	Timestamp time.Time `json:"ts"`
+}
+
+// CommittedOffset is the offset committed by a consumer group for a partition,
+// i.e. the offset of the next message to consume, with its metadata.
+type CommittedOffset struct {
+	Offset int64
+	// Metadata is nil if the offset was not committed by a goka processor
+	Metadata *CommitMetadata
+}
+
+// ParseCommitMetadata parses the metadata stored alongside committed offsets. It
+// returns nil if the metadata was not written by a goka processor.
+func ParseCommitMetadata(metadata string) *CommitMetadata {
+	if metadata == "" {
+		return nil
+	}
+	var cm CommitMetadata
+	if err := json.Unmarshal([]byte(metadata), &cm); err != nil || cm.Timestamp.IsZero() {
+		return nil
+	}
+	return &cm
+}
+
+// commitMetadata returns the metadata of the commits of a partition processor started
+// at the passed time. It is computed once, as encoding it for every message is costly.
+func (opt *poptions) commitMetadata(started time.Time) string {
+	data, err := json.Marshal(&CommitMetadata{
+		InstanceID: opt.instanceID,
+		Version:    opt.instanceVersion,
+		Timestamp:  started,
+	})
+	if err != nil {
+		// cannot happen, but don't fail the commit for metadata
+		return ""
+	}
+	return string(data)
+}
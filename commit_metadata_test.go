@@ -0,0 +1,23 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestCommitMetadata(t *testing.T) {
+	opts := &poptions{instanceID: "instance", instanceVersion: "v1"}
+
+	cm := ParseCommitMetadata(opts.commitMetadata(time.Now()))
+	test.AssertNotNil(t, cm)
+	test.AssertEqual(t, cm.InstanceID, "instance")
+	test.AssertEqual(t, cm.Version, "v1")
+	test.AssertFalse(t, cm.Timestamp.IsZero())
+
+	// metadata not written by goka
+	test.AssertNil(t, ParseCommitMetadata(""))
+	test.AssertNil(t, ParseCommitMetadata("some metadata"))
+	test.AssertNil(t, ParseCommitMetadata(`{"foo": "bar"}`))
+}
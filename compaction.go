@@ -0,0 +1,82 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// CompactionSchedule returns the next time after now to compact the local storages.
+type CompactionSchedule func(now time.Time) time.Time
+
+// DailyCompaction returns a schedule compacting the local storages once a day at
+// the given local time, e.g. DailyCompaction(3, 30) compacts at 3:30 every night.
+func DailyCompaction(hour, minute int) CompactionSchedule {
+	return func(now time.Time) time.Time {
+		next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+}
+
+// IntervalCompaction returns a schedule compacting the local storages every interval.
+func IntervalCompaction(interval time.Duration) CompactionSchedule {
+	return func(now time.Time) time.Time {
+		return now.Add(interval)
+	}
+}
+
+// CompactNow compacts the storage of the partition table if the storage
+// implements storage.Compactable. Other storages are left untouched.
+func (p *PartitionTable) CompactNow() error {
+	if p.st == nil {
+		return nil
+	}
+	st, ok := p.st.Storage.(storage.Compactable)
+	if !ok {
+		return nil
+	}
+	start := time.Now()
+	if err := st.CompactNow(); err != nil {
+		return fmt.Errorf("error compacting %s/%d: %v", p.topic, p.partition, err)
+	}
+	p.log.Debugf("compacted %s/%d in %v", p.topic, p.partition, time.Since(start))
+	return nil
+}
+
+// compactTables compacts the tables one after another to limit the load on the disk.
+func compactTables(ctx context.Context, tables []*PartitionTable) error {
+	for _, table := range tables {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if err := table.CompactNow(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCompactionSchedule compacts the tables returned by getTables at the times of
+// the schedule until the context is done. Compaction errors are logged only.
+func runCompactionSchedule(ctx context.Context, schedule CompactionSchedule, getTables func() []*PartitionTable, log logger) {
+	for {
+		timer := time.NewTimer(time.Until(schedule(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := compactTables(ctx, getTables()); err != nil && ctx.Err() == nil {
+			log.Printf("error running scheduled compaction: %v", err)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package goka
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+type compactableStorage struct {
+	storage.Storage
+	compactions int
+	err         error
+}
+
+func (s *compactableStorage) CompactNow() error {
+	s.compactions++
+	return s.err
+}
+
+func TestDailyCompaction(t *testing.T) {
+	schedule := DailyCompaction(3, 30)
+
+	now := time.Date(2020, 5, 10, 1, 0, 0, 0, time.UTC)
+	test.AssertEqual(t, schedule(now), time.Date(2020, 5, 10, 3, 30, 0, 0, time.UTC))
+
+	now = time.Date(2020, 5, 10, 3, 30, 0, 0, time.UTC)
+	test.AssertEqual(t, schedule(now), time.Date(2020, 5, 11, 3, 30, 0, 0, time.UTC))
+
+	now = time.Date(2020, 5, 31, 23, 0, 0, 0, time.UTC)
+	test.AssertEqual(t, schedule(now), time.Date(2020, 6, 1, 3, 30, 0, 0, time.UTC))
+}
+
+func TestCompactTables(t *testing.T) {
+	newTable := func(st storage.Storage) *PartitionTable {
+		return &PartitionTable{
+			topic: "table",
+			log:   defaultLogger,
+			st:    &storageProxy{Storage: st},
+		}
+	}
+
+	t.Run("compact", func(t *testing.T) {
+		st1, st2 := new(compactableStorage), new(compactableStorage)
+		tables := []*PartitionTable{
+			newTable(st1),
+			// not compactable
+			newTable(storage.NewMemory()),
+			// not set up yet
+			new(PartitionTable),
+			newTable(st2),
+		}
+		test.AssertNil(t, compactTables(context.Background(), tables))
+		test.AssertEqual(t, st1.compactions, 1)
+		test.AssertEqual(t, st2.compactions, 1)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		st1 := &compactableStorage{err: errors.New("disk full")}
+		st2 := new(compactableStorage)
+		err := compactTables(context.Background(), []*PartitionTable{newTable(st1), newTable(st2)})
+		test.AssertError(t, err, regexp.MustCompile("disk full"))
+		test.AssertEqual(t, st2.compactions, 0)
+	})
+
+	t.Run("schedule", func(t *testing.T) {
+		st := new(compactableStorage)
+		table := newTable(st)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			runCompactionSchedule(ctx, IntervalCompaction(10*time.Millisecond), func() []*PartitionTable {
+				return []*PartitionTable{table}
+			}, defaultLogger)
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		<-done
+		test.AssertTrue(t, st.compactions > 0)
+	})
+}
@@ -0,0 +1,251 @@
+package goka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ErrConsistencyTimeout is returned when a table did not load the write of a
+// consistency token in time.
+var ErrConsistencyTimeout = errors.New("timeout waiting for consistency token")
+
+// ConsistencyToken identifies a write to a table by the partition and offset of the
+// written message. Pass it to View.GetAtLeast to read your own writes,
+// see WithCtxConsistencyToken.
+type ConsistencyToken struct {
+	Partition int32
+	Offset    int64
+}
+
+// String formats the token as <partition>:<offset>, e.g. to pass it to a client.
+func (t ConsistencyToken) String() string {
+	return fmt.Sprintf("%d:%d", t.Partition, t.Offset)
+}
+
+// ParseConsistencyToken parses a token formatted with ConsistencyToken.String.
+func ParseConsistencyToken(s string) (ConsistencyToken, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return ConsistencyToken{}, fmt.Errorf("invalid consistency token %q", s)
+	}
+	partition, err := strconv.ParseInt(parts[0], 10, 32)
+	if err != nil || partition < 0 {
+		return ConsistencyToken{}, fmt.Errorf("invalid partition in consistency token %q", s)
+	}
+	offset, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || offset < 0 {
+		return ConsistencyToken{}, fmt.Errorf("invalid offset in consistency token %q", s)
+	}
+	return ConsistencyToken{Partition: int32(partition), Offset: offset}, nil
+}
+
+// offsetWaiter waits for a partition table to load an offset
+type offsetWaiter struct {
+	offset int64
+	done   chan struct{}
+}
+
+// waitForOffset blocks until the table loaded the message with the passed offset or
+// the context is done.
+func (p *PartitionTable) waitForOffset(ctx context.Context, offset int64) error {
+	w := &offsetWaiter{offset: offset, done: make(chan struct{})}
+
+	// register before checking the stored offset, so no update is missed in between
+	p.waitersM.Lock()
+	if p.notified && p.notifiedOffset >= offset {
+		p.waitersM.Unlock()
+		return nil
+	}
+	p.waiters = append(p.waiters, w)
+	p.waitersM.Unlock()
+	defer p.removeWaiter(w)
+
+	// the storage may contain offsets loaded before the table was created
+	current, err := p.GetOffset(offsetNotStored)
+	if err != nil {
+		return err
+	}
+	if current != offsetNotStored && current >= offset {
+		return nil
+	}
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *PartitionTable) removeWaiter(w *offsetWaiter) {
+	p.waitersM.Lock()
+	defer p.waitersM.Unlock()
+	for i, other := range p.waiters {
+		if other == w {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// notifyOffset notifies the waiters for offsets up to the passed offset, which was
+// loaded into or written to the table
+func (p *PartitionTable) notifyOffset(offset int64) {
+	p.waitersM.Lock()
+	defer p.waitersM.Unlock()
+	if !p.notified || offset > p.notifiedOffset {
+		p.notified, p.notifiedOffset = true, offset
+	}
+	waiters := p.waiters[:0]
+	for _, w := range p.waiters {
+		if w.offset <= offset {
+			close(w.done)
+			continue
+		}
+		waiters = append(waiters, w)
+	}
+	p.waiters = waiters
+}
+
+// GetAtLeast returns the value for the key like Get, but first waits until the view
+// loaded the write identified by the token, so a client reads its own writes. The token
+// must belong to a write of the key, i.e. to its partition.
+// If the view did not load the write within timeout, ErrConsistencyTimeout is returned.
+func (v *View) GetAtLeast(key string, token ConsistencyToken, timeout time.Duration) (interface{}, error) {
+	partTable, err := v.find(key)
+	if err != nil {
+		return nil, err
+	}
+	if partTable.partition != token.Partition {
+		return nil, fmt.Errorf("consistency token %s does not belong to key %s in partition %d", token, key, partTable.partition)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := partTable.waitForOffset(ctx, token.Offset); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("error getting value (key %s) at least at %s: %w", key, token, ErrConsistencyTimeout)
+		}
+		return nil, err
+	}
+	return v.Get(key)
+}
+
+// ConsistentValues are the values of multiple keys read by View.GetManyConsistent.
+type ConsistentValues struct {
+	// Values contains the values of the keys, nil for missing keys
+	Values map[string]interface{}
+	// Offsets contains the offset up to which the view had loaded each partition of
+	// the keys when the values were read, -1 if the partition was empty.
+	Offsets map[int32]int64
+}
+
+// maxConsistentReadAttempts is the number of times a partition is read if it
+// advanced while its keys were read
+const maxConsistentReadAttempts = 3
+
+// GetManyConsistent returns the values of the keys together with the offset of every
+// partition they were read at. The keys of a partition are read again if the partition
+// advanced while they were read, so the values of a partition usually reflect exactly
+// the writes up to its offset and always at least those writes.
+// If timeout is positive, GetManyConsistent first waits until the view loaded all
+// messages the partitions of the keys contained when it was called, so the values are
+// not older than the call. ErrConsistencyTimeout is returned if the view did not catch
+// up in time.
+func (v *View) GetManyConsistent(keys []string, timeout time.Duration) (*ConsistentValues, error) {
+	partitions := make(map[*PartitionTable][]string)
+	for _, key := range keys {
+		partTable, err := v.find(key)
+		if err != nil {
+			return nil, err
+		}
+		partitions[partTable] = append(partitions[partTable], key)
+	}
+
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		for partTable := range partitions {
+			if err := v.waitForWatermark(ctx, partTable); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	values := &ConsistentValues{
+		Values:  make(map[string]interface{}, len(keys)),
+		Offsets: make(map[int32]int64, len(partitions)),
+	}
+	for partTable, keys := range partitions {
+		data, offset, err := readConsistent(partTable, keys)
+		if err != nil {
+			return nil, err
+		}
+		values.Offsets[partTable.partition] = offset
+		for key, raw := range data {
+			if raw == nil {
+				values.Values[key] = nil
+				continue
+			}
+			value, err := v.opts.tableCodec.Decode(raw)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding value (key %s): %v", key, err)
+			}
+			values.Values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// waitForWatermark waits until the partition table loaded the newest message of its
+// partition at the time of the call
+func (v *View) waitForWatermark(ctx context.Context, partTable *PartitionTable) error {
+	hwm, err := v.tmgr.GetOffset(v.topic, partTable.partition, sarama.OffsetNewest)
+	if err != nil {
+		return fmt.Errorf("error getting newest offset of %s/%d: %v", v.topic, partTable.partition, err)
+	}
+	if hwm <= 0 {
+		return nil
+	}
+	if err := partTable.waitForOffset(ctx, hwm-1); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("error waiting for %s/%d to load offset %d: %w", v.topic, partTable.partition, hwm-1, ErrConsistencyTimeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// readConsistent reads the keys of the partition table until it did not advance during
+// the read or the attempts are exhausted. It returns the values and the offset of the table
+// after the read.
+func readConsistent(partTable *PartitionTable, keys []string) (map[string][]byte, int64, error) {
+	before, err := partTable.GetOffset(-1)
+	if err != nil {
+		return nil, 0, err
+	}
+	for attempt := 1; ; attempt++ {
+		data := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			value, err := partTable.Get(key)
+			if err != nil {
+				return nil, 0, fmt.Errorf("error getting value (key %s): %v", key, err)
+			}
+			data[key] = value
+		}
+		after, err := partTable.GetOffset(-1)
+		if err != nil {
+			return nil, 0, err
+		}
+		if after == before || attempt == maxConsistentReadAttempts {
+			return data, after, nil
+		}
+		before = after
+	}
+}
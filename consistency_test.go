@@ -0,0 +1,73 @@
+package goka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestConsistencyToken(t *testing.T) {
+	token := ConsistencyToken{Partition: 3, Offset: 42}
+	test.AssertEqual(t, token.String(), "3:42")
+
+	parsed, err := ParseConsistencyToken("3:42")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, parsed, token)
+
+	for _, invalid := range []string{"", "3", "3:x", "-1:42", "3:-1", "3:42:1"} {
+		_, err = ParseConsistencyToken(invalid)
+		test.AssertNotNil(t, err)
+	}
+}
+
+func TestPT_waitForOffset(t *testing.T) {
+	newTable := func() *PartitionTable {
+		return &PartitionTable{
+			topic: "table",
+			log:   defaultLogger,
+			st:    &storageProxy{Storage: storage.NewMemory(), update: DefaultUpdate},
+		}
+	}
+
+	t.Run("loaded", func(t *testing.T) {
+		pt := newTable()
+		test.AssertNil(t, pt.storeEvent("key", []byte("value"), 10, nil, time.Now()))
+		test.AssertNil(t, pt.waitForOffset(context.Background(), 10))
+		test.AssertEqual(t, len(pt.waiters), 0)
+	})
+	t.Run("wait", func(t *testing.T) {
+		pt := newTable()
+		errs := make(chan error, 1)
+		go func() { errs <- pt.waitForOffset(context.Background(), 10) }()
+
+		for {
+			pt.waitersM.Lock()
+			n := len(pt.waiters)
+			pt.waitersM.Unlock()
+			if n == 1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		test.AssertNil(t, pt.storeEvent("key", []byte("value"), 9, nil, time.Now()))
+		select {
+		case <-errs:
+			t.Fatalf("waiter returned before offset was loaded")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		test.AssertNil(t, pt.storeEvent("key", []byte("value"), 11, nil, time.Now()))
+		test.AssertNil(t, <-errs)
+		test.AssertEqual(t, len(pt.waiters), 0)
+	})
+	t.Run("timeout", func(t *testing.T) {
+		pt := newTable()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		test.AssertEqual(t, pt.waitForOffset(ctx, 10), context.DeadlineExceeded)
+		test.AssertEqual(t, len(pt.waiters), 0)
+	})
+}
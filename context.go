@@ -41,7 +41,7 @@ type emitter func(topic string, key string, value []byte, hdr Headers) *Promise
 // message to kafka fails due to connection errors or leader election in the cluster.
 // Those errors still shutdown the processor but will not result in a panic in the callback.
 type Context interface {
-	// Topic returns the topic of input message.
+	// Topic returns the topic of input message, without the prefix of WithTopicPrefix.
 	Topic() Stream
 
 	// Key returns the key of the input message.
@@ -53,7 +53,7 @@ type Context interface {
 	// Offset returns the offset of the input message.
 	Offset() int64
 
-	// Group returns the group of the input message
+	// Group returns the group of the input message, without the prefix of WithTopicPrefix.
 	Group() Group
 
 	// Value returns the value of the key in the group table.
@@ -78,6 +78,9 @@ type Context interface {
 	// Delete deletes a value from the group table. IMPORTANT: this deletes the
 	// value associated with the key from both the local cache and the persisted
 	// table in Kafka.
+	// The deletion is emitted as a tombstone (nil value), so log compaction
+	// eventually removes the key from the table topic. To delete keys outside
+	// of the callback, e.g. to expire state, use WithTableGC or SetValueWithTTL.
 	//
 	// This method might panic to initiate an immediate shutdown of the processor
 	// to maintain data integrity. Do not recover from that panic or
@@ -145,6 +148,14 @@ type cbContext struct {
 	emitter               emitter
 	emitterDefaultHeaders Headers
 
+	// maximum number of hops of looped back messages, unlimited if 0
+	maxLoopbackHops int
+	// prefixes of the topics Reply may respond to
+	replyTopics []string
+	// overBudget is set if the message exceeds the latency budget
+	overBudget bool
+	log        logger
+
 	asyncFailer func(err error)
 	syncFailer  func(err error)
 
@@ -152,7 +163,10 @@ type cbContext struct {
 	// lazily after the first call to Headers
 	headers Headers
 
-	table *PartitionTable
+	table  *PartitionTable
+	outbox *outbox
+	// outbox entries emitted by the callback
+	outboxEntries map[string]*outboxEntry
 	// joins
 	pviews map[string]*PartitionTable
 	// lookup tables
@@ -161,9 +175,12 @@ type cbContext struct {
 	// helper function that is provided by the partition processor to allow
 	// tracking statistics for the output topic
 	trackOutputStats func(ctx context.Context, topic string, size int)
+	// validateOutput returns whether a message may be emitted. It is optional.
+	validateOutput func(ctx context.Context, topic string, key string, value interface{}) bool
 
 	msg      *sarama.ConsumerMessage
 	done     bool
+	confirms []func(token string)
 	counters struct {
 		emits  int
 		dones  int
@@ -181,15 +198,23 @@ func (ctx *cbContext) Emit(topic Stream, key string, value interface{}, options
 	if topic == "" {
 		ctx.Fail(errors.New("cannot emit to empty topic"))
 	}
-	if loopName(ctx.graph.Group()) == string(topic) {
+	topic = Stream(ctx.graph.prefixed(string(topic)))
+	if ctx.graph.isLoopTopic(string(topic)) {
 		ctx.Fail(errors.New("cannot emit to loop topic (use Loopback instead)"))
 	}
 	if tableName(ctx.graph.Group()) == string(topic) {
 		ctx.Fail(errors.New("cannot emit to table topic (use SetValue instead)"))
 	}
-	if !ctx.graph.isOutputTopic(topic) {
+	if !ctx.graph.isOutputTopic(topic) && !ctx.graph.isOutboxTopic(topic) {
 		ctx.Fail(fmt.Errorf("topic %s is not configured for output. Did you specify goka.Output(..) when defining the processor?", topic))
 	}
+	if ctx.validateOutput != nil && !ctx.validateOutput(ctx.ctx, string(topic), key, value) {
+		return
+	}
+	if ctx.graph.isOutboxTopic(topic) {
+		ctx.emitOutbox(topic, key, value, opts.emitHeaders)
+		return
+	}
 
 	c := ctx.graph.codec(string(topic))
 	if c == nil {
@@ -210,19 +235,117 @@ func (ctx *cbContext) Emit(topic Stream, key string, value interface{}, options
 
 // Loopback sends a message to another key of the processor.
 func (ctx *cbContext) Loopback(key string, value interface{}, options ...ContextOption) {
-	opts := new(ctxOptions)
-	opts.applyOptions(options...)
 	l := ctx.graph.LoopStream()
 	if l == nil {
 		ctx.Fail(errors.New("no loop topic configured"))
 	}
+	ctx.loopback(l, key, value, 0, options...)
+}
+
+// LoopbackAfter sends a message to another key of the group like Context.Loopback,
+// but the message is not processed before delay has passed. The loop topic is
+// processed in order, so a delayed message also holds back the loop messages
+// behind it in the same partition.
+//
+// Looped back messages count their hops in the header LoopbackHopsHeader,
+// see LoopbackHops and WithMaxLoopbackHops.
+//
+// This function might panic to initiate an immediate shutdown of the processor
+// to maintain data integrity. Do not recover from that panic or
+// the processor might deadlock.
+func LoopbackAfter(ctx Context, key string, value interface{}, delay time.Duration, options ...ContextOption) {
+	l, ok := ctx.(interface {
+		loopbackAfter(key string, value interface{}, delay time.Duration, options ...ContextOption)
+	})
+	if !ok {
+		ctx.Fail(fmt.Errorf("context does not support delayed loopbacks"))
+	}
+	l.loopbackAfter(key, value, delay, options...)
+}
+
+func (ctx *cbContext) loopbackAfter(key string, value interface{}, delay time.Duration, options ...ContextOption) {
+	l := ctx.graph.LoopStream()
+	if l == nil {
+		ctx.Fail(errors.New("no loop topic configured"))
+	}
+	ctx.loopback(l, key, value, delay, options...)
+}
+
+// LoopbackTo asynchronously sends a message to another key of the group via the loop
+// defined with NamedLoop(name, ...). The value is encoded via the codec of the named
+// loop.
+//
+// This function might panic to initiate an immediate shutdown of the processor
+// to maintain data integrity. Do not recover from that panic or
+// the processor might deadlock.
+func LoopbackTo(ctx Context, name string, key string, value interface{}, options ...ContextOption) {
+	l, ok := ctx.(interface {
+		loopbackTo(name string, key string, value interface{}, options ...ContextOption)
+	})
+	if !ok {
+		ctx.Fail(fmt.Errorf("context does not support named loopbacks"))
+	}
+	l.loopbackTo(name, key, value, options...)
+}
+
+func (ctx *cbContext) loopbackTo(name string, key string, value interface{}, options ...ContextOption) {
+	l := ctx.graph.namedLoopStream(name)
+	if l == nil {
+		ctx.Fail(fmt.Errorf("no loop named %s configured", name))
+	}
+	ctx.loopback(l, key, value, 0, options...)
+}
+
+// LoopbackToAfter sends a message to another key of the group via the loop with the
+// passed name like LoopbackTo, but the message is not processed before delay has passed.
+// Like with LoopbackAfter, a delayed message holds back the messages behind it in the
+// same partition of the loop, so use a dedicated loop for delayed messages.
+//
+// This function might panic to initiate an immediate shutdown of the processor
+// to maintain data integrity. Do not recover from that panic or
+// the processor might deadlock.
+func LoopbackToAfter(ctx Context, name string, key string, value interface{}, delay time.Duration, options ...ContextOption) {
+	l, ok := ctx.(interface {
+		loopbackToAfter(name string, key string, value interface{}, delay time.Duration, options ...ContextOption)
+	})
+	if !ok {
+		ctx.Fail(fmt.Errorf("context does not support delayed named loopbacks"))
+	}
+	l.loopbackToAfter(name, key, value, delay, options...)
+}
+
+func (ctx *cbContext) loopbackToAfter(name string, key string, value interface{}, delay time.Duration, options ...ContextOption) {
+	l := ctx.graph.namedLoopStream(name)
+	if l == nil {
+		ctx.Fail(fmt.Errorf("no loop named %s configured", name))
+	}
+	ctx.loopback(l, key, value, delay, options...)
+}
+
+func (ctx *cbContext) loopback(l Edge, key string, value interface{}, delay time.Duration, options ...ContextOption) {
+	opts := new(ctxOptions)
+	opts.applyOptions(options...)
+
+	// messages looped back from a loop topic continue its hop count
+	var hops int
+	if ctx.msg != nil && ctx.graph.isLoopTopic(ctx.msg.Topic) {
+		hops = LoopbackHops(ctx.Headers())
+	}
+	hops++
+	if ctx.maxLoopbackHops > 0 && hops > ctx.maxLoopbackHops {
+		// failing would reprocess the message and fail again after restart, so drop it
+		if ctx.log != nil {
+			ctx.log.Printf("dropping loopback for key %s after %d hops (max %d)", key, hops-1, ctx.maxLoopbackHops)
+		}
+		return
+	}
 
 	data, err := l.Codec().Encode(value)
 	if err != nil {
 		ctx.Fail(fmt.Errorf("error encoding message for key %s: %v", key, err))
 	}
 
-	ctx.emit(l.Topic(), key, data, opts.emitHeaders)
+	ctx.emit(l.Topic(), key, data, opts.emitHeaders.Merged(loopbackHeaders(hops, delay, time.Now())))
 }
 
 func (ctx *cbContext) emit(topic string, key string, value []byte, hdr Headers) {
@@ -236,6 +359,47 @@ func (ctx *cbContext) emit(topic string, key string, value []byte, hdr Headers)
 	ctx.trackOutputStats(ctx.ctx, topic, len(value))
 }
 
+// emitOutbox appends the message to the outbox, which forwards it after the
+// input message is committed.
+func (ctx *cbContext) emitOutbox(topic Stream, key string, value interface{}, hdr Headers) {
+	var data []byte
+	if value != nil {
+		var err error
+		data, err = ctx.graph.codec(string(topic)).Encode(value)
+		if err != nil {
+			ctx.Fail(fmt.Errorf("error encoding message for topic %s: %v", topic, err))
+		}
+	}
+
+	id := outboxID(ctx.msg.Topic, ctx.msg.Partition, ctx.msg.Offset, len(ctx.outboxEntries))
+	entry := &outboxEntry{
+		Topic:   string(topic),
+		Key:     key,
+		Value:   data,
+		Headers: ctx.emitterDefaultHeaders.Merged(hdr),
+	}
+	encoded, err := ctx.outbox.store(id, entry)
+	if err != nil {
+		ctx.Fail(err)
+	}
+	if ctx.outboxEntries == nil {
+		ctx.outboxEntries = make(map[string]*outboxEntry)
+	}
+	ctx.outboxEntries[id] = entry
+
+	ctx.counters.emits++
+	ctx.emitter(ctx.outbox.topic, id, encoded, nil).ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+		if err == nil && msg != nil {
+			err = ctx.outbox.storeNewestOffset(msg.Offset)
+		}
+		if err != nil {
+			err = fmt.Errorf("error appending to outbox %s: %v", ctx.outbox.topic, err)
+		}
+		ctx.emitDone(err)
+	})
+	ctx.trackOutputStats(ctx.ctx, ctx.outbox.topic, len(encoded))
+}
+
 func (ctx *cbContext) Delete(options ...ContextOption) {
 	opts := new(ctxOptions)
 	opts.applyOptions(options...)
@@ -257,7 +421,37 @@ func (ctx *cbContext) Value() interface{} {
 func (ctx *cbContext) SetValue(value interface{}, options ...ContextOption) {
 	opts := new(ctxOptions)
 	opts.applyOptions(options...)
-	if err := ctx.setValueForKey(ctx.Key(), value, opts.emitHeaders); err != nil {
+	if err := ctx.setValueForKey(ctx.Key(), value, opts.emitHeaders, opts.consistencyToken); err != nil {
+		ctx.Fail(err)
+	}
+}
+
+// SetValueWithTTL updates the value of the key in the group table like Context.SetValue
+// and deletes the key once the ttl has passed, see WithTableTTL. The expiry time is
+// sent in the TableExpiresHeader of the table message. Setting the value again with
+// SetValue removes the TTL.
+//
+// This function might panic to initiate an immediate shutdown of the processor
+// to maintain data integrity. Do not recover from that panic or
+// the processor might deadlock.
+func SetValueWithTTL(ctx Context, value interface{}, ttl time.Duration, options ...ContextOption) {
+	s, ok := ctx.(interface {
+		setValueWithTTL(value interface{}, ttl time.Duration, options ...ContextOption)
+	})
+	if !ok {
+		ctx.Fail(fmt.Errorf("context does not support TTLs"))
+	}
+	s.setValueWithTTL(value, ttl, options...)
+}
+
+func (ctx *cbContext) setValueWithTTL(value interface{}, ttl time.Duration, options ...ContextOption) {
+	if ttl <= 0 {
+		ctx.Fail(fmt.Errorf("invalid TTL %v: must be positive", ttl))
+		return
+	}
+	opts := new(ctxOptions)
+	opts.applyOptions(options...)
+	if err := ctx.setValueForKeyExpiring(ctx.Key(), value, time.Now().Add(ttl), opts.emitHeaders, opts.consistencyToken); err != nil {
 		ctx.Fail(err)
 	}
 }
@@ -267,12 +461,16 @@ func (ctx *cbContext) Timestamp() time.Time {
 	return ctx.msg.Timestamp
 }
 
+func (ctx *cbContext) overLatencyBudget() bool {
+	return ctx.overBudget
+}
+
 func (ctx *cbContext) Key() string {
 	return string(ctx.msg.Key)
 }
 
 func (ctx *cbContext) Topic() Stream {
-	return Stream(ctx.msg.Topic)
+	return Stream(ctx.graph.unprefixed(ctx.msg.Topic))
 }
 
 func (ctx *cbContext) Offset() int64 {
@@ -280,7 +478,7 @@ func (ctx *cbContext) Offset() int64 {
 }
 
 func (ctx *cbContext) Group() Group {
-	return ctx.graph.Group()
+	return Group(ctx.graph.unprefixed(string(ctx.graph.Group())))
 }
 
 func (ctx *cbContext) Partition() int32 {
@@ -296,6 +494,7 @@ func (ctx *cbContext) Headers() Headers {
 }
 
 func (ctx *cbContext) Join(topic Table) interface{} {
+	topic = Table(ctx.graph.prefixed(string(topic)))
 	if ctx.pviews == nil {
 		ctx.Fail(fmt.Errorf("table %s not subscribed", topic))
 	}
@@ -317,7 +516,58 @@ func (ctx *cbContext) Join(topic Table) interface{} {
 	return value
 }
 
+// IterateJoin calls visit for every key of the copartitioned table in the partition of
+// the input message, until visit returns false.
+//
+// This function might panic to initiate an immediate shutdown of the processor
+// to maintain data integrity. Do not recover from that panic or
+// the processor might deadlock.
+func IterateJoin(ctx Context, topic Table, visit func(key string, value interface{}) bool) {
+	it, ok := ctx.(interface {
+		iterateJoin(topic Table, visit func(key string, value interface{}) bool)
+	})
+	if !ok {
+		ctx.Fail(fmt.Errorf("context does not support iterating joined tables"))
+	}
+	it.iterateJoin(topic, visit)
+}
+
+func (ctx *cbContext) iterateJoin(topic Table, visit func(key string, value interface{}) bool) {
+	topic = Table(ctx.graph.prefixed(string(topic)))
+	v, ok := ctx.pviews[string(topic)]
+	if !ok {
+		ctx.Fail(fmt.Errorf("table %s not subscribed", topic))
+	}
+	it, err := v.st.Iterator()
+	if err != nil {
+		ctx.Fail(fmt.Errorf("error iterating table %s: %v", topic, err))
+	}
+	defer it.Release()
+
+	codec := ctx.graph.codec(string(topic))
+	for it.Next() {
+		data, err := it.Value()
+		if err != nil {
+			ctx.Fail(fmt.Errorf("error reading key %s of table %s: %v", it.Key(), topic, err))
+		}
+		var value interface{}
+		if data != nil {
+			value, err = codec.Decode(data)
+			if err != nil {
+				ctx.Fail(fmt.Errorf("error decoding value key %s of table %s: %v", it.Key(), topic, err))
+			}
+		}
+		if !visit(string(it.Key()), value) {
+			return
+		}
+	}
+	if err := it.Err(); err != nil {
+		ctx.Fail(fmt.Errorf("error iterating table %s: %v", topic, err))
+	}
+}
+
 func (ctx *cbContext) Lookup(topic Table, key string) interface{} {
+	topic = Table(ctx.graph.prefixed(string(topic)))
 	if ctx.views == nil {
 		ctx.Fail(fmt.Errorf("topic %s not subscribed", topic))
 	}
@@ -358,20 +608,31 @@ func (ctx *cbContext) deleteKey(key string, hdr Headers) error {
 	}
 
 	ctx.counters.stores++
-	if err := ctx.table.Delete(key); err != nil {
-		return fmt.Errorf("error deleting key (%s) from storage: %v", key, err)
+	if err := ctx.table.deleteKey(key); err != nil {
+		return err
+	}
+
+	if ctx.graph.isEphemeralTable() {
+		return nil
 	}
 
 	ctx.counters.emits++
-	ctx.emitter(ctx.graph.GroupTable().Topic(), key, nil, hdr).Then(func(err error) {
+	ctx.emitter(ctx.graph.GroupTable().Topic(), key, nil, ctx.emitterDefaultHeaders.Merged(hdr)).Then(func(err error) {
 		ctx.emitDone(err)
 	})
 
 	return nil
 }
 
-// setValueForKey sets a value for a key in the processor state.
-func (ctx *cbContext) setValueForKey(key string, value interface{}, hdr Headers) error {
+// setValueForKey sets a value for a key in the processor state. If written is not nil,
+// it is called with the consistency token of the write once it is acknowledged.
+func (ctx *cbContext) setValueForKey(key string, value interface{}, hdr Headers, written func(ConsistencyToken)) error {
+	return ctx.setValueForKeyExpiring(key, value, time.Time{}, hdr, written)
+}
+
+// setValueForKeyExpiring sets a value for a key in the processor state that expires at
+// the passed time, the zero time meaning it does not expire.
+func (ctx *cbContext) setValueForKeyExpiring(key string, value interface{}, expires time.Time, hdr Headers, written func(ConsistencyToken)) error {
 	if ctx.graph.GroupTable() == nil {
 		return fmt.Errorf("Cannot access state in stateless processor")
 	}
@@ -379,6 +640,14 @@ func (ctx *cbContext) setValueForKey(key string, value interface{}, hdr Headers)
 	if value == nil {
 		return fmt.Errorf("cannot set nil as value")
 	}
+	if !expires.IsZero() {
+		if ctx.table.expiry == nil {
+			return fmt.Errorf("cannot set value with TTL without WithTableTTL")
+		}
+		if !expires.After(time.Now()) {
+			return fmt.Errorf("invalid expiry %v: must be in the future", expires)
+		}
+	}
 
 	encodedValue, err := ctx.graph.GroupTable().Codec().Encode(value)
 	if err != nil {
@@ -389,12 +658,26 @@ func (ctx *cbContext) setValueForKey(key string, value interface{}, hdr Headers)
 	if err = ctx.table.Set(key, encodedValue); err != nil {
 		return fmt.Errorf("error storing value: %v", err)
 	}
+	if err = ctx.table.setKeyExpiry(key, expires); err != nil {
+		return fmt.Errorf("error storing expiry: %v", err)
+	}
+
+	if ctx.graph.isEphemeralTable() {
+		ctx.table.TrackMessageWrite(ctx.ctx, len(encodedValue))
+		return nil
+	}
 
 	table := ctx.graph.GroupTable().Topic()
 	ctx.counters.emits++
-	ctx.emitter(table, key, encodedValue, hdr).ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+	ctx.emitter(table, key, encodedValue, expiryHeaders(ctx.table.versionHeaders(ctx.emitterDefaultHeaders.Merged(hdr)), expires)).ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
 		if err == nil && msg != nil {
-			err = ctx.table.storeNewestOffset(msg.Offset)
+			err = ctx.table.indexWrite(key, msg.Offset, encodedValue)
+			if err == nil {
+				err = ctx.table.storeNewestOffset(msg.Offset)
+			}
+			if err == nil && written != nil {
+				written(ConsistencyToken{Partition: ctx.table.partition, Offset: msg.Offset})
+			}
 		}
 		ctx.emitDone(err)
 	})
@@ -408,17 +691,19 @@ func (ctx *cbContext) setValueForKey(key string, value interface{}, hdr Headers)
 
 func (ctx *cbContext) emitDone(err error) {
 	ctx.m.Lock()
-	defer ctx.m.Unlock()
 	ctx.counters.dones++
-	ctx.tryCommit(err)
+	confirm := ctx.tryCommit(err)
+	ctx.m.Unlock()
+	confirm()
 }
 
 // called after all emits
 func (ctx *cbContext) finish(err error) {
 	ctx.m.Lock()
-	defer ctx.m.Unlock()
 	ctx.done = true
-	ctx.tryCommit(err)
+	confirm := ctx.tryCommit(err)
+	ctx.m.Unlock()
+	confirm()
 }
 
 // called before any emit
@@ -428,25 +713,37 @@ func (ctx *cbContext) start() {
 
 // calls ctx.commit once all emits have successfully finished, or fails context
 // if some emit failed.
-// this function must be called from a locked function.
-func (ctx *cbContext) tryCommit(err error) {
+// this function must be called from a locked function. The returned function calls the
+// confirm-on-commit callbacks and marks the context as done, and has to be called after
+// unlocking, so the callbacks do not block other emits of the context.
+func (ctx *cbContext) tryCommit(err error) func() {
 	if err != nil {
 		_ = ctx.errors.Collect(err)
 	}
 
 	// not all calls are done yet, do not send the ack upstream.
 	if !ctx.done || ctx.counters.emits > ctx.counters.dones {
-		return
+		return func() {}
 	}
 
 	// commit if no errors, otherwise fail context
+	var confirms []func(token string)
 	if ctx.errors.HasErrors() {
 		ctx.asyncFailer(ctx.errors.NilOrError())
 	} else {
 		ctx.commit()
+		if len(ctx.outboxEntries) > 0 {
+			ctx.outbox.enqueue(ctx.outboxEntries)
+		}
+		confirms = append(confirms, ctx.confirms...)
 	}
 
-	ctx.markDone()
+	return func() {
+		for _, confirm := range confirms {
+			confirm(ctx.sideEffectToken())
+		}
+		ctx.markDone()
+	}
 }
 
 // markdone marks the context as done
@@ -476,3 +773,47 @@ func (ctx *cbContext) DeferCommit() func(err error) {
 		})
 	}
 }
+
+// PrepareSideEffect runs prepare as the first phase of an external side effect, e.g.
+// staging a database upsert. The passed token uniquely identifies the input message
+// (group, topic, partition and offset) and stays the same when the message is reprocessed
+// after a crash, so it can be used to deduplicate the side effect.
+// If prepare returns an error, the processor is shut down like with Fail.
+func PrepareSideEffect(ctx Context, prepare func(token string) error) {
+	se, ok := ctx.(sideEffecter)
+	if !ok {
+		ctx.Fail(fmt.Errorf("context does not support side effects"))
+	}
+	if err := prepare(se.sideEffectToken()); err != nil {
+		ctx.Fail(fmt.Errorf("error preparing side effect: %v", err))
+	}
+}
+
+// ConfirmOnCommit registers confirm as the second phase of an external side effect.
+// confirm is called once all emits and table updates of the message succeeded and the
+// message's offset is marked for commit. It is never called if processing of the
+// message fails. confirm may be called from a different goroutine than the callback.
+func ConfirmOnCommit(ctx Context, confirm func(token string)) {
+	se, ok := ctx.(sideEffecter)
+	if !ok {
+		ctx.Fail(fmt.Errorf("context does not support side effects"))
+	}
+	se.confirmOnCommit(confirm)
+}
+
+// sideEffecter runs the phases of external side effects, see PrepareSideEffect
+type sideEffecter interface {
+	sideEffectToken() string
+	confirmOnCommit(confirm func(token string))
+}
+
+func (ctx *cbContext) confirmOnCommit(confirm func(token string)) {
+	ctx.m.Lock()
+	defer ctx.m.Unlock()
+	ctx.confirms = append(ctx.confirms, confirm)
+}
+
+// sideEffectToken returns an identifier of the input message that is stable across reprocessing
+func (ctx *cbContext) sideEffectToken() string {
+	return fmt.Sprintf("%s/%s/%d/%d", ctx.graph.Group(), ctx.msg.Topic, ctx.msg.Partition, ctx.msg.Offset)
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/lovoo/goka/codec"
 	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
 )
 
 func newEmitter(err error, done func(err error)) emitter {
@@ -350,7 +351,7 @@ func TestContext_Set(t *testing.T) {
 	ctx.emitter = newEmitter(nil, nil)
 
 	ctx.start()
-	err := ctx.setValueForKey(key, value, Headers{})
+	err := ctx.setValueForKey(key, value, Headers{}, nil)
 	test.AssertNil(t, err)
 	ctx.finish(nil)
 
@@ -450,17 +451,27 @@ func TestContext_SetErrors(t *testing.T) {
 		asyncFailer:      failer,
 	}
 
-	err := ctx.setValueForKey(key, nil, Headers{})
+	err := ctx.setValueForKey(key, nil, Headers{}, nil)
 	test.AssertNotNil(t, err)
 	test.AssertTrue(t, strings.Contains(err.Error(), "cannot set nil"))
 
-	err = ctx.setValueForKey(key, 123, Headers{}) // cannot encode 123 as string
+	err = ctx.setValueForKey(key, 123, Headers{}, nil) // cannot encode 123 as string
 	test.AssertNotNil(t, err)
 	test.AssertTrue(t, strings.Contains(err.Error(), "error encoding"))
 
+	// invalid TTLs are rejected before the storage is written
+	err = ctx.setValueForKeyExpiring(key, value, time.Now().Add(time.Minute), Headers{}, nil)
+	test.AssertNotNil(t, err)
+	test.AssertTrue(t, strings.Contains(err.Error(), "WithTableTTL"))
+	pt.expiry = newKeyExpiry(nil)
+	err = ctx.setValueForKeyExpiring(key, value, time.Now().Add(-time.Minute), Headers{}, nil)
+	test.AssertNotNil(t, err)
+	test.AssertTrue(t, strings.Contains(err.Error(), "invalid expiry"))
+	pt.expiry = nil
+
 	st.EXPECT().Set(key, []byte(value)).Return(errors.New("some-error"))
 
-	err = ctx.setValueForKey(key, value, Headers{})
+	err = ctx.setValueForKey(key, value, Headers{}, nil)
 	test.AssertNotNil(t, err)
 	test.AssertTrue(t, strings.Contains(err.Error(), "some-error"))
 
@@ -509,7 +520,7 @@ func TestContext_Loopback(t *testing.T) {
 			test.AssertEqual(t, tp, graph.LoopStream().Topic())
 			test.AssertEqual(t, string(k), key)
 			test.AssertEqual(t, string(v), value)
-			test.AssertEqual(t, h, hdr)
+			test.AssertEqual(t, h, hdr.Merged(Headers{LoopbackHopsHeader: []byte("1")}))
 			return NewPromise()
 		},
 	}
@@ -518,6 +529,114 @@ func TestContext_Loopback(t *testing.T) {
 	test.AssertTrue(t, cnt == 1)
 }
 
+func TestContext_LoopbackTo(t *testing.T) {
+	var (
+		graph  = DefineGroup("group", Persist(c), Loop(c, cb), NamedLoop("retry", new(codec.Int64), cb))
+		topics []string
+	)
+
+	ctx := &cbContext{
+		graph: graph,
+		msg: &sarama.ConsumerMessage{
+			Topic:   graph.LoopStream().Topic(),
+			Headers: []*sarama.RecordHeader{{Key: []byte(LoopbackHopsHeader), Value: []byte("2")}},
+		},
+		syncFailer:       func(err error) { panic(err) },
+		trackOutputStats: func(ctx context.Context, topic string, size int) {},
+		emitter: func(tp string, k string, v []byte, h Headers) *Promise {
+			topics = append(topics, tp)
+			test.AssertEqual(t, k, "key")
+			test.AssertEqual(t, string(v), "42")
+			test.AssertEqual(t, LoopbackHops(h), 3)
+			return NewPromise()
+		},
+	}
+
+	LoopbackTo(ctx, "retry", "key", int64(42))
+	test.AssertEqual(t, topics, []string{"group-loop-retry"})
+
+	LoopbackToAfter(ctx, "retry", "key", int64(42), time.Minute)
+	test.AssertEqual(t, topics, []string{"group-loop-retry", "group-loop-retry"})
+
+	func() {
+		defer test.PanicAssertStringContains(t, "no loop named fan-in")
+		LoopbackToAfter(ctx, "fan-in", "key", int64(42), time.Minute)
+	}()
+
+	func() {
+		defer test.PanicAssertStringContains(t, "no loop named fan-in")
+		LoopbackTo(ctx, "fan-in", "key", int64(42))
+	}()
+
+	func() {
+		defer test.PanicAssertStringContains(t, "cannot emit to loop topic")
+		ctx.Emit("group-loop-retry", "key", int64(42))
+	}()
+}
+
+func TestContext_LoopbackAfter(t *testing.T) {
+	var (
+		graph   = DefineGroup("group", Persist(c), Loop(c, cb))
+		emitted Headers
+		cnt     int
+	)
+
+	newContext := func(msg *sarama.ConsumerMessage) *cbContext {
+		return &cbContext{
+			graph:            graph,
+			msg:              msg,
+			maxLoopbackHops:  2,
+			log:              defaultLogger,
+			trackOutputStats: func(ctx context.Context, topic string, size int) {},
+			emitter: func(tp string, k string, v []byte, h Headers) *Promise {
+				cnt++
+				emitted = h
+				return NewPromise()
+			},
+		}
+	}
+
+	t.Run("input", func(t *testing.T) {
+		cnt = 0
+		before := time.Now()
+		ctx := newContext(&sarama.ConsumerMessage{Topic: "input"})
+		LoopbackAfter(ctx, "key", "value", time.Minute)
+		test.AssertEqual(t, cnt, 1)
+		test.AssertEqual(t, LoopbackHops(emitted), 1)
+
+		loopMsg := &sarama.ConsumerMessage{Headers: []*sarama.RecordHeader{{
+			Key:   []byte(LoopbackDeliverAtHeader),
+			Value: emitted[LoopbackDeliverAtHeader],
+		}}}
+		wait := loopbackWait(loopMsg, before)
+		test.AssertTrue(t, wait >= time.Minute-time.Millisecond && wait <= time.Minute+time.Second)
+		test.AssertEqual(t, loopbackWait(loopMsg, before.Add(2*time.Minute)), time.Duration(0))
+	})
+
+	t.Run("hops", func(t *testing.T) {
+		cnt = 0
+		ctx := newContext(&sarama.ConsumerMessage{
+			Topic:   graph.LoopStream().Topic(),
+			Headers: []*sarama.RecordHeader{{Key: []byte(LoopbackHopsHeader), Value: []byte("1")}},
+		})
+		ctx.Loopback("key", "value")
+		test.AssertEqual(t, cnt, 1)
+		test.AssertEqual(t, LoopbackHops(emitted), 2)
+		_, delayed := emitted[LoopbackDeliverAtHeader]
+		test.AssertFalse(t, delayed)
+	})
+
+	t.Run("max-hops", func(t *testing.T) {
+		cnt = 0
+		ctx := newContext(&sarama.ConsumerMessage{
+			Topic:   graph.LoopStream().Topic(),
+			Headers: []*sarama.RecordHeader{{Key: []byte(LoopbackHopsHeader), Value: []byte("2")}},
+		})
+		LoopbackAfter(ctx, "key", "value", time.Second)
+		test.AssertEqual(t, cnt, 0)
+	})
+}
+
 func TestContext_Join(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -567,6 +686,51 @@ func TestContext_Join(t *testing.T) {
 	}()
 }
 
+func TestContext_IterateJoin(t *testing.T) {
+	var (
+		table Table = "table"
+		st          = storage.NewMemory()
+	)
+	test.AssertNil(t, st.Set("key-1", []byte("value-1")))
+	test.AssertNil(t, st.Set("key-2", []byte("value-2")))
+
+	ctx := &cbContext{
+		graph: DefineGroup("group", Join(table, c)),
+		pviews: map[string]*PartitionTable{
+			string(table): {
+				log: defaultLogger,
+				st: &storageProxy{
+					Storage: st,
+				},
+				stats: newTableStats(),
+			},
+		},
+		syncFailer: func(err error) { panic(err) },
+	}
+
+	values := make(map[string]interface{})
+	IterateJoin(ctx, table, func(key string, value interface{}) bool {
+		values[key] = value
+		return true
+	})
+	test.AssertEqual(t, values, map[string]interface{}{
+		"key-1": "value-1",
+		"key-2": "value-2",
+	})
+
+	var visited int
+	IterateJoin(ctx, table, func(key string, value interface{}) bool {
+		visited++
+		return false
+	})
+	test.AssertEqual(t, visited, 1)
+
+	func() {
+		defer test.PanicAssertStringContains(t, "not subs")
+		IterateJoin(ctx, "other-table", func(key string, value interface{}) bool { return true })
+	}()
+}
+
 func TestContext_Lookup(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -664,3 +828,81 @@ func TestContext_Fail(t *testing.T) {
 	// this must not be executed. ctx.Fail should stop execution
 	test.AssertTrue(t, false)
 }
+
+func TestContext_SideEffect(t *testing.T) {
+	var (
+		group Group = "some-group"
+		msg         = &sarama.ConsumerMessage{Topic: "input", Partition: 1, Offset: 42}
+	)
+
+	t.Run("confirm", func(t *testing.T) {
+		var (
+			ack       = 0
+			prepared  string
+			confirmed string
+		)
+		ctx := &cbContext{
+			graph:  DefineGroup(group),
+			msg:    msg,
+			commit: func() { ack++ },
+			wg:     &sync.WaitGroup{},
+		}
+
+		ctx.start()
+		PrepareSideEffect(ctx, func(token string) error {
+			prepared = token
+			return nil
+		})
+		ConfirmOnCommit(ctx, func(token string) {
+			test.AssertEqual(t, ack, 1)
+			// the context is not locked while confirming
+			ctx.m.Lock()
+			ctx.m.Unlock()
+			confirmed = token
+		})
+		done := ctx.DeferCommit()
+		ctx.finish(nil)
+
+		test.AssertEqual(t, prepared, "some-group/input/1/42")
+		test.AssertEqual(t, confirmed, "")
+		done(nil)
+		test.AssertEqual(t, confirmed, prepared)
+	})
+
+	t.Run("no-confirm-on-error", func(t *testing.T) {
+		var confirmed bool
+		ctx := &cbContext{
+			graph:       DefineGroup(group),
+			msg:         msg,
+			commit:      func() {},
+			wg:          &sync.WaitGroup{},
+			asyncFailer: func(err error) {},
+		}
+
+		ctx.start()
+		ConfirmOnCommit(ctx, func(token string) { confirmed = true })
+		ctx.DeferCommit()(errors.New("emit failed"))
+		ctx.finish(nil)
+		test.AssertFalse(t, confirmed)
+	})
+
+	t.Run("prepare-fails", func(t *testing.T) {
+		ctx := &cbContext{
+			graph: DefineGroup(group),
+			msg:   msg,
+			syncFailer: func(err error) {
+				panic(err)
+			},
+		}
+
+		defer func() {
+			err := recover()
+			test.AssertNotNil(t, err)
+			test.AssertTrue(t, strings.Contains(fmt.Sprintf("%v", err), "db unavailable"))
+		}()
+		PrepareSideEffect(ctx, func(token string) error {
+			return errors.New("db unavailable")
+		})
+		test.AssertTrue(t, false)
+	})
+}
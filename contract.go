@@ -0,0 +1,86 @@
+package goka
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// contracts registered by topic
+var contracts = struct {
+	sync.RWMutex
+	m map[string][]*Contract
+}{
+	m: make(map[string][]*Contract),
+}
+
+// Contract defines a stream shared between groups, e.g. the output of one group
+// consumed by another group owned by a different team. Define the contract once in
+// a package shared by both sides and create the edges from it:
+//
+//	// package orders
+//	var Created = goka.NewContract("orders-created", new(OrderCodec))
+//
+//	// producing group
+//	goka.DefineGroup("checkout", ..., orders.Created.Output())
+//
+//	// consuming group
+//	goka.DefineGroup("billing", orders.Created.Input(bill))
+//
+// Processors and emitters validate on startup that all edges of a contract's
+// topic use the codec of the contract, so a group declaring the topic with a
+// different codec fails to start instead of producing or consuming incompatible
+// messages.
+type Contract struct {
+	topic Stream
+	codec Codec
+}
+
+// NewContract creates a contract for the topic and registers it, so processors and
+// emitters of the topic are validated against it.
+func NewContract(topic Stream, codec Codec) *Contract {
+	c := &Contract{topic: topic, codec: codec}
+
+	contracts.Lock()
+	defer contracts.Unlock()
+	contracts.m[string(topic)] = append(contracts.m[string(topic)], c)
+	return c
+}
+
+// Topic returns the topic of the contract.
+func (c *Contract) Topic() Stream {
+	return c.topic
+}
+
+// Codec returns the codec of the contract.
+func (c *Contract) Codec() Codec {
+	return c.codec
+}
+
+// Input returns an input edge consuming the contract's topic.
+func (c *Contract) Input(cb ProcessCallback) Edge {
+	return Input(c.topic, c.codec, cb)
+}
+
+// Output returns an output edge emitting into the contract's topic.
+func (c *Contract) Output() Edge {
+	return Output(c.topic, c.codec)
+}
+
+// String returns the topic and codec of the contract.
+func (c *Contract) String() string {
+	return fmt.Sprintf("%s/%T", c.topic, c.codec)
+}
+
+// validateContract checks that codec matches the contracts registered for the topic.
+func validateContract(topic string, codec Codec) error {
+	contracts.RLock()
+	defer contracts.RUnlock()
+
+	for _, c := range contracts.m[topic] {
+		if reflect.TypeOf(c.codec) != reflect.TypeOf(codec) {
+			return fmt.Errorf("codec %T of topic %s violates contract %s", codec, topic, c)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestContract(t *testing.T) {
+	contract := NewContract("contract-topic", new(codec.String))
+	test.AssertEqual(t, contract.Topic(), Stream("contract-topic"))
+
+	t.Run("edges", func(t *testing.T) {
+		input := contract.Input(cb)
+		test.AssertEqual(t, input.Topic(), "contract-topic")
+		test.AssertTrue(t, input.Codec() == contract.Codec())
+
+		output := contract.Output()
+		test.AssertEqual(t, output.Topic(), "contract-topic")
+		test.AssertTrue(t, output.Codec() == contract.Codec())
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		test.AssertNil(t, DefineGroup("producer", Input("input", c, cb), contract.Output()).Validate())
+		test.AssertNil(t, DefineGroup("consumer", contract.Input(cb)).Validate())
+		// the same codec type is valid as well
+		test.AssertNil(t, DefineGroup("consumer", Input("contract-topic", new(codec.String), cb)).Validate())
+	})
+
+	t.Run("codec-drift", func(t *testing.T) {
+		err := DefineGroup("consumer", Input("contract-topic", new(codec.Int64), cb)).Validate()
+		test.AssertStringContains(t, err.Error(), "violates contract")
+
+		err = DefineGroup("producer", Input("input", c, cb), Output("contract-topic", new(codec.Int64))).Validate()
+		test.AssertStringContains(t, err.Error(), "violates contract")
+
+		_, err = NewEmitter(nil, "contract-topic", new(codec.Int64))
+		test.AssertStringContains(t, err.Error(), "violates contract")
+	})
+}
@@ -0,0 +1,190 @@
+package goka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// maxRecentErrors is the number of errors kept for the debug dump
+const maxRecentErrors = 10
+
+var (
+	procStateNames = map[State]string{
+		ProcStateIdle:     "idle",
+		ProcStateStarting: "starting",
+		ProcStateSetup:    "setup",
+		ProcStateRunning:  "running",
+		ProcStateStopping: "stopping",
+	}
+	ppStateNames = map[State]string{
+		PPStateIdle:       "idle",
+		PPStateRecovering: "recovering",
+		PPStateRunning:    "running",
+		PPStateStopping:   "stopping",
+	}
+	partitionStatusNames = map[PartitionStatus]string{
+		PartitionStopped:      "stopped",
+		PartitionInitializing: "initializing",
+		PartitionConnecting:   "connecting",
+		PartitionRecovering:   "recovering",
+		PartitionPreparing:    "preparing",
+		PartitionRunning:      "running",
+	}
+	runModeNames = map[PPRunMode]string{
+		runModeActive:      "active",
+		runModePassive:     "passive",
+		runModeRecoverOnly: "recover-only",
+	}
+)
+
+// recentErrors keeps the last errors of a processor that did not stop it
+type recentErrors struct {
+	m      sync.Mutex
+	errors []timedError
+}
+
+type timedError struct {
+	time time.Time
+	err  error
+}
+
+func (r *recentErrors) add(err error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.errors = append(r.errors, timedError{time: time.Now(), err: err})
+	if len(r.errors) > maxRecentErrors {
+		r.errors = r.errors[len(r.errors)-maxRecentErrors:]
+	}
+}
+
+func (r *recentErrors) list() []timedError {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]timedError(nil), r.errors...)
+}
+
+// DebugDump writes a human readable dump of the internal state of the processor to w,
+// e.g. to attach it to a bug report: its configuration, the assigned partitions with
+// the states and offsets of their tables, the recent errors and the stats.
+// Collecting the stats is limited to 10 seconds.
+func (g *Processor) DebugDump(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Processor %s\n", g.graph.Group())
+	fmt.Fprintf(tw, "  state:\t%s\n", procStateNames[g.state.State()])
+	fmt.Fprintf(tw, "  client id:\t%s\n", g.opts.clientID)
+	fmt.Fprintf(tw, "  consumer group:\t%s\n", g.opts.consumerGroupID)
+	fmt.Fprintf(tw, "  brokers:\t%s\n", strings.Join(g.brokers, ","))
+	fmt.Fprintf(tw, "  partitions:\t%d\n", g.partitionCount)
+	fmt.Fprintf(tw, "  hot standby:\t%t\n", g.opts.hotStandby)
+	fmt.Fprintf(tw, "  recovered:\t%t\n", g.Recovered())
+
+	fmt.Fprintf(tw, "\nTopics\n")
+	for _, e := range g.graph.InputStreams() {
+		fmt.Fprintf(tw, "  input:\t%s\n", e.Topic())
+	}
+	for _, e := range g.graph.loopStreams() {
+		fmt.Fprintf(tw, "  loop:\t%s\n", e.Topic())
+	}
+	for _, e := range g.graph.JointTables() {
+		fmt.Fprintf(tw, "  join:\t%s\n", e.Topic())
+	}
+	for _, e := range g.graph.LookupTables() {
+		fmt.Fprintf(tw, "  lookup:\t%s\n", e.Topic())
+	}
+	for _, e := range g.graph.OutputStreams() {
+		fmt.Fprintf(tw, "  output:\t%s\n", e.Topic())
+	}
+	if gt := g.graph.GroupTable(); gt != nil {
+		fmt.Fprintf(tw, "  table:\t%s\n", gt.Topic())
+	}
+
+	g.mTables.RLock()
+	partitions := make([]*PartitionProcessor, 0, len(g.partitions))
+	for _, pproc := range g.partitions {
+		partitions = append(partitions, pproc)
+	}
+	g.mTables.RUnlock()
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].partition < partitions[j].partition })
+
+	fmt.Fprintf(tw, "\nAssignment\n")
+	if len(partitions) == 0 {
+		fmt.Fprintf(tw, "  none\n")
+	}
+	for _, pproc := range partitions {
+		fmt.Fprintf(tw, "  partition %d:\t%s (%s)\n", pproc.partition, ppStateNames[pproc.state.State()], runModeNames[pproc.runMode])
+		pproc.dumpTables(tw)
+	}
+
+	fmt.Fprintf(tw, "\nErrors\n")
+	errs := g.recentErrors.list()
+	if len(errs) == 0 && g.runErr == nil {
+		fmt.Fprintf(tw, "  none\n")
+	}
+	for _, err := range errs {
+		fmt.Fprintf(tw, "  %s:\t%v\n", err.time.Format(time.RFC3339), err.err)
+	}
+	select {
+	case <-g.done:
+		if g.runErr != nil {
+			fmt.Fprintf(tw, "  run:\t%v\n", g.runErr)
+		}
+	default:
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchStatsTimeout)
+	defer cancel()
+	stats, err := json.MarshalIndent(g.StatsWithContext(ctx), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling stats: %v", err)
+	}
+	_, err = fmt.Fprintf(w, "\nStats\n%s\n", stats)
+	return err
+}
+
+// dumpTables writes the group table and joined tables of the partition processor.
+// The tables are dumped while holding the table mutex, so the processing loop does not
+// modify the group table concurrently.
+func (pp *PartitionProcessor) dumpTables(w io.Writer) {
+	pp.tableMutex.Lock()
+	defer pp.tableMutex.Unlock()
+
+	if pp.table != nil {
+		dumpTable(w, "table", pp.table)
+	}
+	joins := make([]string, 0, len(pp.joins))
+	for topic := range pp.joins {
+		joins = append(joins, topic)
+	}
+	sort.Strings(joins)
+	for _, topic := range joins {
+		dumpTable(w, "join", pp.joins[topic])
+	}
+}
+
+// dumpTable writes the state, offset and storage type of a partition table. The storage
+// is only read once the table is recovered, as it may be replaced while recovering.
+func dumpTable(w io.Writer, kind string, table *PartitionTable) {
+	status := partitionStatusNames[table.CurrentState()]
+	if !table.IsRecovered() {
+		fmt.Fprintf(w, "    %s %s:\t%s\n", kind, table.topic, status)
+		return
+	}
+	offset, err := table.GetOffset(-1)
+	if err != nil {
+		fmt.Fprintf(w, "    %s %s:\t%s, error getting offset: %v\n", kind, table.topic, status, err)
+		return
+	}
+	fmt.Fprintf(w, "    %s %s:\t%s, offset %d, storage %T\n", kind, table.topic, status, offset, table.st.Storage)
+}
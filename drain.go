@@ -0,0 +1,127 @@
+package goka
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// drainTracker tracks the progress of a processor running with WithDrain.
+// It captures the end offsets of the consumed topics when the processor
+// starts and signals once all claimed partitions are processed up to them.
+type drainTracker struct {
+	m sync.Mutex
+	// end offsets (hwm) per topic and partition captured on start
+	ends map[string]map[int32]int64
+	// claimed topic partitions of the current session and whether they are drained
+	claims map[string]map[int32]bool
+	// topic partitions drained in any session
+	drained map[string]map[int32]bool
+
+	// closed once all claimed partitions are drained
+	done   chan struct{}
+	closed bool
+}
+
+func newDrainTracker() *drainTracker {
+	return &drainTracker{
+		ends:    make(map[string]map[int32]int64),
+		claims:  make(map[string]map[int32]bool),
+		drained: make(map[string]map[int32]bool),
+		done:    make(chan struct{}),
+	}
+}
+
+// capture stores the current end offsets of all partitions of the topics.
+func (d *drainTracker) capture(tmgr TopicManager, topics []string) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	for _, topic := range topics {
+		partitions, err := tmgr.Partitions(topic)
+		if err != nil {
+			return fmt.Errorf("error getting partitions of %s: %v", topic, err)
+		}
+		d.ends[topic] = make(map[int32]int64)
+		for _, partition := range partitions {
+			end, err := tmgr.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return fmt.Errorf("error getting end offset of %s/%d: %v", topic, partition, err)
+			}
+			d.ends[topic][partition] = end
+		}
+	}
+	return nil
+}
+
+// end returns the captured end offset of the topic partition. Partitions added
+// after capturing have nothing to drain.
+func (d *drainTracker) end(topic string, partition int32) int64 {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.ends[topic][partition]
+}
+
+// setClaims resets the claimed topic partitions on the start of a session.
+func (d *drainTracker) setClaims(claims map[string][]int32) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.claims = make(map[string]map[int32]bool)
+	for topic, partitions := range claims {
+		d.claims[topic] = make(map[int32]bool)
+		for _, partition := range partitions {
+			d.claims[topic][partition] = d.drained[topic][partition]
+		}
+	}
+	d.checkDone()
+}
+
+// start marks the topic partition as drained if the claim starts at or beyond its end offset.
+func (d *drainTracker) start(topic string, partition int32, offset int64) {
+	if offset >= d.end(topic, partition) {
+		d.markDrained(topic, partition)
+	}
+}
+
+// processed marks the topic partition as drained once the message before its end offset is processed.
+func (d *drainTracker) processed(topic string, partition int32, offset int64) {
+	if offset+1 >= d.end(topic, partition) {
+		d.markDrained(topic, partition)
+	}
+}
+
+func (d *drainTracker) markDrained(topic string, partition int32) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.drained[topic] == nil {
+		d.drained[topic] = make(map[int32]bool)
+	}
+	d.drained[topic][partition] = true
+	if _, ok := d.claims[topic][partition]; ok {
+		d.claims[topic][partition] = true
+	}
+	d.checkDone()
+}
+
+// checkDone closes done if all claimed partitions are drained. Must be called while holding the lock.
+func (d *drainTracker) checkDone() {
+	if d.closed || len(d.claims) == 0 {
+		return
+	}
+	for _, partitions := range d.claims {
+		for _, drained := range partitions {
+			if !drained {
+				return
+			}
+		}
+	}
+	d.closed = true
+	close(d.done)
+}
+
+// isDone returns whether all claimed partitions were drained.
+func (d *drainTracker) isDone() bool {
+	d.m.Lock()
+	defer d.m.Unlock()
+	return d.closed
+}
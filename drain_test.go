@@ -0,0 +1,65 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestDrainTracker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tmgr := NewMockTopicManager(ctrl)
+	tmgr.EXPECT().Partitions("input").Return([]int32{0, 1}, nil)
+	tmgr.EXPECT().GetOffset("input", int32(0), sarama.OffsetNewest).Return(int64(10), nil)
+	tmgr.EXPECT().GetOffset("input", int32(1), sarama.OffsetNewest).Return(int64(5), nil)
+	tmgr.EXPECT().Partitions("group-loop").Return([]int32{0, 1}, nil)
+	tmgr.EXPECT().GetOffset("group-loop", gomock.Any(), sarama.OffsetNewest).Return(int64(0), nil).Times(2)
+
+	d := newDrainTracker()
+	test.AssertNil(t, d.capture(tmgr, []string{"input", "group-loop"}))
+	test.AssertEqual(t, d.end("input", 0), int64(10))
+	test.AssertEqual(t, d.end("input", 2), int64(0))
+
+	d.setClaims(map[string][]int32{
+		"input":      {0, 1},
+		"group-loop": {0, 1},
+	})
+	d.start("input", 0, 3)
+	d.start("input", 1, 5)
+	d.start("group-loop", 0, 0)
+	d.start("group-loop", 1, 0)
+	test.AssertFalse(t, d.isDone())
+
+	d.processed("input", 0, 8)
+	test.AssertFalse(t, d.isDone())
+	d.processed("input", 0, 9)
+	test.AssertTrue(t, d.isDone())
+
+	select {
+	case <-d.done:
+	default:
+		t.Fatalf("done channel not closed")
+	}
+
+	// a new session with already drained partitions is done right away
+	d.setClaims(map[string][]int32{"input": {1}})
+	test.AssertTrue(t, d.isDone())
+}
+
+func TestDrainTracker_rebalance(t *testing.T) {
+	d := newDrainTracker()
+	d.ends["input"] = map[int32]int64{0: 10, 1: 10}
+	d.setClaims(map[string][]int32{"input": {0, 1}})
+	d.processed("input", 0, 9)
+	test.AssertFalse(t, d.isDone())
+
+	// after rebalancing, the drained partition is remembered
+	d.setClaims(map[string][]int32{"input": {0, 1}})
+	test.AssertFalse(t, d.isDone())
+	d.start("input", 1, 10)
+	test.AssertTrue(t, d.isDone())
+}
@@ -1,6 +1,7 @@
 package goka
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -18,10 +19,19 @@ type Emitter struct {
 
 	topic          string
 	defaultHeaders Headers
+	validators     []OutputValidator
 
 	wg   sync.WaitGroup
 	mu   sync.RWMutex
 	done chan struct{}
+
+	// pending counts the unfinished emits, idle is closed when it drops to zero.
+	// failed and firstErr collect the errors since the last Flush.
+	pendingM sync.Mutex
+	pending  int
+	idle     chan struct{}
+	failed   int
+	firstErr error
 }
 
 // NewEmitter creates a new emitter using passed brokers, topic, codec and possibly options.
@@ -40,21 +50,89 @@ func NewEmitter(brokers []string, topic Stream, codec Codec, options ...EmitterO
 
 	opts.applyOptions(topic, codec, options...)
 
+	if err := validateContract(string(topic), codec); err != nil {
+		return nil, err
+	}
+	if opts.batchSize > 1 && opts.linger <= 0 {
+		return nil, fmt.Errorf("emitter batch size %d requires a linger, see WithEmitterLinger", opts.batchSize)
+	}
+	topic = Stream(opts.topicPrefix) + topic
+	if opts.auditTopic != "" {
+		opts.auditTopic = Stream(opts.topicPrefix) + opts.auditTopic
+	}
+
+	if opts.ensureTopic != nil {
+		if err := ensureEmitterTopic(brokers, string(topic), opts); err != nil {
+			return nil, err
+		}
+	}
+
 	prod, err := opts.builders.producer(brokers, opts.clientID, opts.hasher)
 	if err != nil {
 		return nil, fmt.Errorf(errBuildProducer, err)
 	}
+	if opts.auditTopic != "" {
+		prod = newAuditProducer(prod, string(opts.auditTopic), opts.clientID, opts.log)
+	}
 
 	return &Emitter{
 		codec:          codec,
 		producer:       prod,
 		topic:          string(topic),
 		defaultHeaders: opts.defaultHeaders,
+		validators:     opts.validators,
 		done:           make(chan struct{}),
 	}, nil
 }
 
-func (e *Emitter) emitDone(err error) { e.wg.Done() }
+// ensureEmitterTopic creates the emitter's topic or checks that it exists
+func ensureEmitterTopic(brokers []string, topic string, opts *eoptions) error {
+	tm, err := opts.builders.topicmgr(brokers)
+	if err != nil {
+		return fmt.Errorf("Error creating topic manager: %v", err)
+	}
+	defer tm.Close()
+
+	cfg := opts.ensureTopic
+	if cfg.partitions <= 0 {
+		if _, err := tm.Partitions(topic); err != nil {
+			if err == errTopicNotFound {
+				return fmt.Errorf("topic %s of emitter does not exist", topic)
+			}
+			return fmt.Errorf("error checking topic %s of emitter: %v", topic, err)
+		}
+		return nil
+	}
+	if err := tm.EnsureTopicExists(topic, cfg.partitions, cfg.replication, cfg.configs); err != nil {
+		return fmt.Errorf("error ensuring topic %s of emitter: %v", topic, err)
+	}
+	return nil
+}
+
+func (e *Emitter) emitStarted() {
+	e.pendingM.Lock()
+	defer e.pendingM.Unlock()
+	if e.pending == 0 {
+		e.idle = make(chan struct{})
+	}
+	e.pending++
+}
+
+func (e *Emitter) emitDone(err error) {
+	e.pendingM.Lock()
+	if err != nil {
+		if e.failed == 0 {
+			e.firstErr = err
+		}
+		e.failed++
+	}
+	e.pending--
+	if e.pending == 0 {
+		close(e.idle)
+	}
+	e.pendingM.Unlock()
+	e.wg.Done()
+}
 
 // EmitWithHeaders sends a message with the given headers for the passed key using the emitter's codec.
 func (e *Emitter) EmitWithHeaders(key string, msg interface{}, hdr Headers) (*Promise, error) {
@@ -63,6 +141,12 @@ func (e *Emitter) EmitWithHeaders(key string, msg interface{}, hdr Headers) (*Pr
 		data []byte
 	)
 
+	for _, validate := range e.validators {
+		if err := validate(key, msg); err != nil {
+			return nil, fmt.Errorf("invalid message for key %s in topic %s: %w", key, e.topic, err)
+		}
+	}
+
 	if msg != nil {
 		data, err = e.codec.Encode(msg)
 		if err != nil {
@@ -79,6 +163,7 @@ func (e *Emitter) EmitWithHeaders(key string, msg interface{}, hdr Headers) (*Pr
 		return NewPromise().finish(nil, ErrEmitterAlreadyClosed), nil
 	default:
 		e.wg.Add(1)
+		e.emitStarted()
 		e.mu.RUnlock()
 	}
 
@@ -120,6 +205,33 @@ func (e *Emitter) EmitSync(key string, msg interface{}) error {
 	return e.EmitSyncWithHeaders(key, msg, nil)
 }
 
+// Flush waits until all pending messages, including messages emitted while flushing,
+// are produced or the context is done. It returns an error if messages failed since the
+// last Flush; the errors of single messages are returned by their promises.
+func (e *Emitter) Flush(ctx context.Context) error {
+	e.pendingM.Lock()
+	idle := e.idle
+	pending := e.pending
+	e.pendingM.Unlock()
+
+	if pending > 0 {
+		select {
+		case <-idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	e.pendingM.Lock()
+	defer e.pendingM.Unlock()
+	failed, firstErr := e.failed, e.firstErr
+	e.failed, e.firstErr = 0, nil
+	if failed > 0 {
+		return fmt.Errorf("%d messages failed to be emitted to topic %s, first error: %w", failed, e.topic, firstErr)
+	}
+	return nil
+}
+
 // Finish waits until the emitter is finished producing all pending messages.
 func (e *Emitter) Finish() error {
 	e.mu.Lock()
@@ -1,6 +1,7 @@
 package goka
 
 import (
+	"context"
 	"errors"
 	"hash"
 	"strconv"
@@ -57,6 +58,58 @@ func TestEmitter_NewEmitter(t *testing.T) {
 	})
 }
 
+func TestEmitter_EnsureTopic(t *testing.T) {
+	newEmitter := func(bm *builderMock, options ...EmitterOption) (*Emitter, error) {
+		return NewEmitter(emitterTestBrokers, emitterTestTopic, emitterIntCodec, append([]EmitterOption{
+			WithEmitterTopicManagerBuilder(bm.getTopicManagerBuilder()),
+			WithEmitterProducerBuilder(bm.getProducerBuilder()),
+		}, options...)...)
+	}
+	configs := map[string]string{"retention.ms": "3600000"}
+
+	t.Run("create", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		bm := newBuilderMock(ctrl)
+		bm.tmgr.EXPECT().EnsureTopicExists(string(emitterTestTopic), 10, 3, configs).Return(nil)
+		bm.tmgr.EXPECT().Close().Return(nil)
+		emitter, err := newEmitter(bm, WithEmitterEnsureTopic(10, 3, configs))
+		test.AssertNil(t, err)
+		test.AssertNotNil(t, emitter)
+	})
+	t.Run("fail_create", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		bm := newBuilderMock(ctrl)
+		bm.tmgr.EXPECT().EnsureTopicExists(string(emitterTestTopic), 10, 3, configs).Return(errors.New("not authorized"))
+		bm.tmgr.EXPECT().Close().Return(nil)
+		emitter, err := newEmitter(bm, WithEmitterEnsureTopic(10, 3, configs))
+		test.AssertNotNil(t, err)
+		test.AssertNil(t, emitter)
+	})
+	t.Run("require", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		bm := newBuilderMock(ctrl)
+		bm.tmgr.EXPECT().Partitions(string(emitterTestTopic)).Return([]int32{0, 1}, nil)
+		bm.tmgr.EXPECT().Close().Return(nil)
+		emitter, err := newEmitter(bm, WithEmitterEnsureTopic(0, 0, nil))
+		test.AssertNil(t, err)
+		test.AssertNotNil(t, emitter)
+	})
+	t.Run("fail_missing", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		bm := newBuilderMock(ctrl)
+		bm.tmgr.EXPECT().Partitions(string(emitterTestTopic)).Return(nil, errTopicNotFound)
+		bm.tmgr.EXPECT().Close().Return(nil)
+		emitter, err := newEmitter(bm, WithEmitterEnsureTopic(0, 0, nil))
+		test.AssertNotNil(t, err)
+		test.AssertNil(t, emitter)
+		test.AssertStringContains(t, err.Error(), "does not exist")
+	})
+}
+
 func TestEmitter_Emit(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		emitter, bm, ctrl := createEmitter(t)
@@ -133,6 +186,45 @@ func TestEmitter_Emit(t *testing.T) {
 		test.AssertNil(t, err)
 		test.AssertNotNil(t, promise)
 	})
+	t.Run("default_headers_merged", func(t *testing.T) {
+		emitter, bm, ctrl := createEmitter(t, WithEmitterDefaultHeaders(Headers{
+			"service": []byte("checkout"),
+			"version": []byte("1"),
+		}))
+		defer ctrl.Finish()
+
+		var (
+			key          = "some-key"
+			intVal int64 = 1312
+			data         = []byte(strconv.FormatInt(intVal, 10))
+		)
+
+		bm.producer.EXPECT().EmitWithHeaders(emitter.topic, key, data, Headers{
+			"service": []byte("checkout"),
+			"version": []byte("2"),
+			"trace":   []byte("abc"),
+		}).Return(NewPromise().finish(nil, nil))
+		promise, err := emitter.EmitWithHeaders(key, intVal, Headers{
+			"version": []byte("2"),
+			"trace":   []byte("abc"),
+		})
+		test.AssertNil(t, err)
+		test.AssertNotNil(t, promise)
+	})
+	t.Run("fail_validation", func(t *testing.T) {
+		invalid := errors.New("negative value")
+		emitter, _, ctrl := createEmitter(t, WithEmitterValidator(func(key string, value interface{}) error {
+			if value.(int64) < 0 {
+				return invalid
+			}
+			return nil
+		}))
+		defer ctrl.Finish()
+
+		promise, err := emitter.Emit("some-key", int64(-1))
+		test.AssertNil(t, promise)
+		test.AssertTrue(t, errors.Is(err, invalid))
+	})
 }
 
 func TestEmitter_EmitSync(t *testing.T) {
@@ -221,3 +313,58 @@ func TestEmitter_Finish(t *testing.T) {
 		test.AssertNil(t, err)
 	})
 }
+
+func TestEmitter_Batch(t *testing.T) {
+	t.Run("config", func(t *testing.T) {
+		eopts := new(eoptions)
+		eopts.applyOptions("topic", new(codec.String), WithEmitterBatchSize(100), WithEmitterLinger(50*time.Millisecond))
+		config := eopts.saramaConfig.config()
+		test.AssertEqual(t, config.Producer.Flush.Messages, 100)
+		test.AssertEqual(t, config.Producer.Flush.Frequency, 50*time.Millisecond)
+
+		// the linger alone keeps the default batch size
+		eopts = new(eoptions)
+		eopts.applyOptions("topic", new(codec.String), WithEmitterLinger(50*time.Millisecond))
+		config = eopts.saramaConfig.config()
+		test.AssertEqual(t, config.Producer.Flush.Messages, globalConfig.Producer.Flush.Messages)
+		test.AssertEqual(t, config.Producer.Flush.Frequency, 50*time.Millisecond)
+	})
+	t.Run("no-linger", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		bm := newBuilderMock(ctrl)
+		_, err := NewEmitter(emitterTestBrokers, emitterTestTopic, emitterIntCodec,
+			WithEmitterProducerBuilder(bm.getProducerBuilder()),
+			WithEmitterBatchSize(100),
+		)
+		test.AssertNotNil(t, err)
+	})
+}
+
+func TestEmitter_Flush(t *testing.T) {
+	var (
+		key          = "some-key"
+		intVal int64 = 1312
+		data         = []byte(strconv.FormatInt(intVal, 10))
+	)
+
+	emitter, bm, ctrl := createEmitter(t)
+	defer ctrl.Finish()
+
+	// flushing a pending message times out
+	producerPromise, finish := NewPromiseWithFinisher()
+	bm.producer.EXPECT().Emit(emitter.topic, key, data).Return(producerPromise)
+	promise, err := emitter.Emit(key, intVal)
+	test.AssertNil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	test.AssertEqual(t, emitter.Flush(ctx), context.DeadlineExceeded)
+
+	// errors since the last flush are returned
+	retErr := errors.New("some-error")
+	finish(nil, retErr)
+	test.AssertEqual(t, promise.err, retErr)
+	err = emitter.Flush(context.Background())
+	test.AssertTrue(t, errors.Is(err, retErr))
+	test.AssertNil(t, emitter.Flush(context.Background()))
+}
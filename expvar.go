@@ -0,0 +1,170 @@
+package goka
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// expvarStatsTimeout limits the time to collect the stats when the variables are read
+const expvarStatsTimeout = time.Second
+
+// expvarSources maps the names of published variables to their sources. Variables
+// cannot be removed from expvar, so a processor or view created with the name of an
+// earlier one replaces its source.
+var (
+	expvarM       sync.Mutex
+	expvarSources = make(map[string]*expvarSource)
+)
+
+type expvarSource struct {
+	m     sync.Mutex
+	value func() interface{}
+}
+
+func (s *expvarSource) get() interface{} {
+	s.m.Lock()
+	value := s.value
+	s.m.Unlock()
+	return value()
+}
+
+// publishExpvar publishes the value as the expvar variable of the name. It fails if the
+// name is used by a variable not published by goka.
+func publishExpvar(name string, value func() interface{}) error {
+	expvarM.Lock()
+	defer expvarM.Unlock()
+
+	if src, ok := expvarSources[name]; ok {
+		src.m.Lock()
+		src.value = value
+		src.m.Unlock()
+		return nil
+	}
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar variable %s is already published", name)
+	}
+	src := &expvarSource{value: value}
+	expvarSources[name] = src
+	expvar.Publish(name, expvar.Func(src.get))
+	return nil
+}
+
+// expvarInput are the published counters of an input topic.
+type expvarInput struct {
+	Count uint  `json:"count"`
+	Bytes int   `json:"bytes"`
+	Lag   int64 `json:"lag"`
+}
+
+// expvarOutput are the published counters of an output topic.
+type expvarOutput struct {
+	Count uint `json:"count"`
+	Bytes int  `json:"bytes"`
+}
+
+// expvarTable are the published counters of the partitions of a table.
+type expvarTable struct {
+	Partitions    int   `json:"partitions"`
+	Recovered     int   `json:"recovered"`
+	Lag           int64 `json:"lag"`
+	StorageMemory int64 `json:"storage_memory"`
+}
+
+func (t *expvarTable) add(stats *TableStats) {
+	t.Partitions++
+	if stats.Status == PartitionRunning {
+		t.Recovered++
+	}
+	if stats.Input != nil {
+		t.Lag += stats.Input.OffsetLag
+	}
+	t.StorageMemory += stats.StorageMemory
+}
+
+// expvarProcessor are the published counters of a processor, summed over its partitions.
+type expvarProcessor struct {
+	State  string                   `json:"state"`
+	Table  *expvarTable             `json:"table,omitempty"`
+	Input  map[string]*expvarInput  `json:"input"`
+	Output map[string]*expvarOutput `json:"output"`
+	Lookup map[string]*expvarView   `json:"lookup,omitempty"`
+}
+
+// expvarView are the published counters of a view.
+type expvarView struct {
+	expvarTable
+	Lookups int64 `json:"lookups"`
+	Hits    int64 `json:"hits"`
+}
+
+func newExpvarView(stats *ViewStats) *expvarView {
+	v := &expvarView{
+		Lookups: stats.Lookups,
+		Hits:    stats.Hits,
+	}
+	for _, tableStats := range stats.Partitions {
+		v.add(tableStats)
+	}
+	return v
+}
+
+func newExpvarProcessor(state string, stats *ProcessorStats) *expvarProcessor {
+	p := &expvarProcessor{
+		State:  state,
+		Input:  make(map[string]*expvarInput),
+		Output: make(map[string]*expvarOutput),
+		Lookup: make(map[string]*expvarView),
+	}
+	for _, partStats := range stats.Group {
+		if partStats.TableStats != nil {
+			if p.Table == nil {
+				p.Table = new(expvarTable)
+			}
+			p.Table.add(partStats.TableStats)
+		}
+		for topic, in := range partStats.Input {
+			input := p.Input[topic]
+			if input == nil {
+				input = new(expvarInput)
+				p.Input[topic] = input
+			}
+			input.Count += in.Count
+			input.Bytes += in.Bytes
+			input.Lag += in.OffsetLag
+		}
+		for topic, out := range partStats.Output {
+			output := p.Output[topic]
+			if output == nil {
+				output = new(expvarOutput)
+				p.Output[topic] = output
+			}
+			output.Count += out.Count
+			output.Bytes += out.Bytes
+		}
+	}
+	for topic, viewStats := range stats.Lookup {
+		p.Lookup[topic] = newExpvarView(viewStats)
+	}
+	return p
+}
+
+// publishExpvar publishes the counters of the processor as the expvar variable of the name.
+func (g *Processor) publishExpvar(name string) error {
+	return publishExpvar(name, func() interface{} {
+		ctx, cancel := context.WithTimeout(context.Background(), expvarStatsTimeout)
+		defer cancel()
+		return newExpvarProcessor(procStateNames[g.state.State()], g.StatsWithContext(ctx))
+	})
+}
+
+// publishExpvar publishes the counters of the view as the expvar variable of the name.
+func (v *View) publishExpvar(name string) error {
+	return publishExpvar(name, func() interface{} {
+		ctx, cancel := context.WithTimeout(context.Background(), expvarStatsTimeout)
+		defer cancel()
+		return newExpvarView(v.Stats(ctx))
+	})
+}
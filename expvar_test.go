@@ -0,0 +1,55 @@
+package goka
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestNewExpvarProcessor(t *testing.T) {
+	stats := newProcessorStats(2)
+	for partition, count := range []uint{1, 2} {
+		partStats := newPartitionProcStats([]string{"input"}, []string{"output"})
+		partStats.Input["input"].Count = count
+		partStats.Input["input"].OffsetLag = 10
+		partStats.Output["output"].Count = 2 * count
+		partStats.TableStats = newTableStats()
+		partStats.TableStats.Status = PartitionRunning
+		stats.Group[int32(partition)] = partStats
+	}
+	stats.Lookup["lookup"] = &ViewStats{
+		Partitions: map[int32]*TableStats{0: newTableStats()},
+		Lookups:    5,
+		Hits:       3,
+	}
+
+	vars := newExpvarProcessor("running", stats)
+	test.AssertEqual(t, vars.State, "running")
+	test.AssertEqual(t, *vars.Input["input"], expvarInput{Count: 3, Lag: 20})
+	test.AssertEqual(t, *vars.Output["output"], expvarOutput{Count: 6})
+	test.AssertEqual(t, *vars.Table, expvarTable{Partitions: 2, Recovered: 2})
+	test.AssertEqual(t, vars.Lookup["lookup"].Partitions, 1)
+	test.AssertEqual(t, vars.Lookup["lookup"].Recovered, 0)
+	test.AssertEqual(t, vars.Lookup["lookup"].Hits, int64(3))
+}
+
+func TestPublishExpvar(t *testing.T) {
+	read := func(name string) map[string]int {
+		var value map[string]int
+		test.AssertNil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &value))
+		return value
+	}
+
+	test.AssertNil(t, publishExpvar("goka-test", func() interface{} { return map[string]int{"count": 1} }))
+	test.AssertEqual(t, read("goka-test"), map[string]int{"count": 1})
+
+	// publishing the name again replaces the value
+	test.AssertNil(t, publishExpvar("goka-test", func() interface{} { return map[string]int{"count": 2} }))
+	test.AssertEqual(t, read("goka-test"), map[string]int{"count": 2})
+
+	// names of other variables are not replaced
+	expvar.NewInt("goka-test-other")
+	test.AssertNotNil(t, publishExpvar("goka-test-other", func() interface{} { return nil }))
+}
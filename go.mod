@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/Shopify/sarama v1.27.0
+	github.com/alicebob/miniredis/v2 v2.14.1
 	github.com/fsnotify/fsnotify v1.4.9 // indirect
 	github.com/go-stack/stack v1.8.0
 	github.com/golang/mock v1.4.3
@@ -7,8 +7,9 @@ import (
 )
 
 var (
-	tableSuffix = "-table"
-	loopSuffix  = "-loop"
+	tableSuffix  = "-table"
+	loopSuffix   = "-loop"
+	outboxSuffix = "-outbox"
 )
 
 // Stream is the name of an event stream topic in Kafka, ie, a topic with
@@ -25,7 +26,7 @@ type Table string
 // Group is the name of a consumer group in Kafka and represents a processor
 // group in Goka. A processor group may have a group table and a group loopback
 // stream. By default, the group table is named <group>-table and the loopback
-// stream <group>-loop.
+// stream <group>-loop. Named loopback streams are named <group>-loop-<name>.
 type Group string
 
 // GroupGraph is the specification of a processor group. It contains all input,
@@ -37,15 +38,22 @@ type GroupGraph struct {
 	crossTables   []Edge
 	inputStreams  []Edge
 	outputStreams []Edge
+	outboxStreams []Edge
 	loopStream    []Edge
+	namedLoops    []Edge
 	groupTable    []Edge
 
-	codecs    map[string]Codec
-	callbacks map[string]ProcessCallback
+	codecs     map[string]Codec
+	callbacks  map[string]ProcessCallback
+	prefilters map[string]Prefilter
 
 	outputStreamTopics map[Stream]struct{}
+	outboxStreamTopics map[Stream]struct{}
 
 	joinCheck map[string]bool
+
+	// topicPrefix is prepended to the group and all topics, see WithTopicPrefix
+	topicPrefix string
 }
 
 // Group returns the group name.
@@ -77,6 +85,39 @@ func (gg *GroupGraph) LoopStream() Edge {
 	return nil
 }
 
+// NamedLoopStreams returns the named loopback edges of the group.
+func (gg *GroupGraph) NamedLoopStreams() Edges {
+	return gg.namedLoops
+}
+
+// namedLoopStream returns the named loopback edge with the passed name or nil.
+func (gg *GroupGraph) namedLoopStream(name string) Edge {
+	for _, e := range gg.namedLoops {
+		if e.(*namedLoopStream).name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// loopStreams returns the loopback edge and all named loopback edges of the group.
+func (gg *GroupGraph) loopStreams() Edges {
+	return chainEdges(gg.loopStream, gg.namedLoops)
+}
+
+// isLoopTopic returns whether the topic is the loop topic or a named loop topic of the group.
+func (gg *GroupGraph) isLoopTopic(topic string) bool {
+	if topic == loopName(gg.Group()) {
+		return true
+	}
+	for _, e := range gg.namedLoops {
+		if e.Topic() == topic {
+			return true
+		}
+	}
+	return false
+}
+
 // GroupTable returns the group table edge of the group.
 func (gg *GroupGraph) GroupTable() Edge {
 	// only 1 group table is valid
@@ -86,11 +127,28 @@ func (gg *GroupGraph) GroupTable() Edge {
 	return nil
 }
 
+// isEphemeralTable returns whether the group table has no changelog topic
+func (gg *GroupGraph) isEphemeralTable() bool {
+	gt, ok := gg.GroupTable().(*groupTable)
+	return ok && gt.ephemeral
+}
+
 // OutputStreams returns the output stream edges of the group.
 func (gg *GroupGraph) OutputStreams() Edges {
 	return gg.outputStreams
 }
 
+// OutboxStreams returns the output stream edges of the group that are written via the outbox.
+func (gg *GroupGraph) OutboxStreams() Edges {
+	return gg.outboxStreams
+}
+
+// returns whether the passed topic is an output topic written via the outbox
+func (gg *GroupGraph) isOutboxTopic(topic Stream) bool {
+	_, ok := gg.outboxStreamTopics[topic]
+	return ok
+}
+
 // returns whether the passed topic is a valid group output topic
 func (gg *GroupGraph) isOutputTopic(topic Stream) bool {
 	_, ok := gg.outputStreamTopics[topic]
@@ -115,6 +173,11 @@ func (gg *GroupGraph) callback(topic string) ProcessCallback {
 	return gg.callbacks[topic]
 }
 
+// prefilter returns the prefilter of the input topic or nil
+func (gg *GroupGraph) prefilter(topic string) Prefilter {
+	return gg.prefilters[topic]
+}
+
 func (gg *GroupGraph) joint(topic string) bool {
 	return gg.joinCheck[topic]
 }
@@ -125,8 +188,10 @@ func DefineGroup(group Group, edges ...Edge) *GroupGraph {
 	gg := GroupGraph{group: string(group),
 		codecs:             make(map[string]Codec),
 		callbacks:          make(map[string]ProcessCallback),
+		prefilters:         make(map[string]Prefilter),
 		joinCheck:          make(map[string]bool),
 		outputStreamTopics: make(map[Stream]struct{}),
+		outboxStreamTopics: make(map[Stream]struct{}),
 	}
 
 	for _, e := range edges {
@@ -137,22 +202,37 @@ func DefineGroup(group Group, edges ...Edge) *GroupGraph {
 				inputStr := input.(*inputStream)
 				gg.codecs[input.Topic()] = input.Codec()
 				gg.callbacks[input.Topic()] = inputStr.cb
+				if inputStr.prefilter != nil {
+					gg.prefilters[input.Topic()] = inputStr.prefilter
+				}
 				gg.inputStreams = append(gg.inputStreams, inputStr)
 			}
 		case *inputStream:
 			gg.validateInputTopic(e.Topic())
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.callbacks[e.Topic()] = e.cb
+			if e.prefilter != nil {
+				gg.prefilters[e.Topic()] = e.prefilter
+			}
 			gg.inputStreams = append(gg.inputStreams, e)
 		case *loopStream:
 			e.setGroup(group)
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.callbacks[e.Topic()] = e.cb
 			gg.loopStream = append(gg.loopStream, e)
+		case *namedLoopStream:
+			e.setGroup(group)
+			gg.codecs[e.Topic()] = e.Codec()
+			gg.callbacks[e.Topic()] = e.cb
+			gg.namedLoops = append(gg.namedLoops, e)
 		case *outputStream:
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.outputStreams = append(gg.outputStreams, e)
 			gg.outputStreamTopics[Stream(e.Topic())] = struct{}{}
+		case *outboxStream:
+			gg.codecs[e.Topic()] = e.Codec()
+			gg.outboxStreams = append(gg.outboxStreams, e)
+			gg.outboxStreamTopics[Stream(e.Topic())] = struct{}{}
 		case *inputTable:
 			gg.codecs[e.Topic()] = e.Codec()
 			gg.inputTables = append(gg.inputTables, e)
@@ -170,6 +250,106 @@ func DefineGroup(group Group, edges ...Edge) *GroupGraph {
 	return &gg
 }
 
+// withTopicPrefix returns a copy of the group graph with the prefix prepended to the
+// group and the topics of its edges. The topics derived from the group, like the group
+// table and loop topics, are prefixed like the group.
+func (gg *GroupGraph) withTopicPrefix(prefix string) *GroupGraph {
+	prefixed := &GroupGraph{
+		group:         prefix + gg.group,
+		inputTables:   prefixEdges(gg.inputTables, prefix),
+		crossTables:   prefixEdges(gg.crossTables, prefix),
+		inputStreams:  prefixEdges(gg.inputStreams, prefix),
+		outputStreams: prefixEdges(gg.outputStreams, prefix),
+		outboxStreams: prefixEdges(gg.outboxStreams, prefix),
+		loopStream:    prefixEdges(gg.loopStream, prefix),
+		namedLoops:    prefixEdges(gg.namedLoops, prefix),
+		groupTable:    prefixEdges(gg.groupTable, prefix),
+
+		codecs:             make(map[string]Codec, len(gg.codecs)),
+		callbacks:          make(map[string]ProcessCallback, len(gg.callbacks)),
+		prefilters:         make(map[string]Prefilter, len(gg.prefilters)),
+		outputStreamTopics: make(map[Stream]struct{}, len(gg.outputStreamTopics)),
+		outboxStreamTopics: make(map[Stream]struct{}, len(gg.outboxStreamTopics)),
+		joinCheck:          make(map[string]bool, len(gg.joinCheck)),
+
+		topicPrefix: prefix,
+	}
+	for topic, codec := range gg.codecs {
+		prefixed.codecs[prefix+topic] = codec
+	}
+	for topic, cb := range gg.callbacks {
+		prefixed.callbacks[prefix+topic] = cb
+	}
+	for topic, prefilter := range gg.prefilters {
+		prefixed.prefilters[prefix+topic] = prefilter
+	}
+	for topic := range gg.outputStreamTopics {
+		prefixed.outputStreamTopics[Stream(prefix)+topic] = struct{}{}
+	}
+	for topic := range gg.outboxStreamTopics {
+		prefixed.outboxStreamTopics[Stream(prefix)+topic] = struct{}{}
+	}
+	for topic, join := range gg.joinCheck {
+		prefixed.joinCheck[prefix+topic] = join
+	}
+	return prefixed
+}
+
+// prefixEdges returns copies of the edges with the prefix prepended to their topics.
+func prefixEdges(edges []Edge, prefix string) []Edge {
+	var prefixed []Edge
+	for _, e := range edges {
+		topic := &topicDef{prefix + e.Topic(), e.Codec()}
+		switch e := e.(type) {
+		case *inputStream:
+			c := *e
+			c.topicDef = topic
+			prefixed = append(prefixed, &c)
+		case *loopStream:
+			c := *e
+			c.topicDef = topic
+			prefixed = append(prefixed, &c)
+		case *namedLoopStream:
+			c := *e
+			c.topicDef = topic
+			prefixed = append(prefixed, &c)
+		case *outputStream:
+			prefixed = append(prefixed, &outputStream{topic})
+		case *outboxStream:
+			prefixed = append(prefixed, &outboxStream{topic})
+		case *inputTable:
+			prefixed = append(prefixed, &inputTable{topic})
+		case *crossTable:
+			prefixed = append(prefixed, &crossTable{topic})
+		case *groupTable:
+			c := *e
+			c.topicDef = topic
+			prefixed = append(prefixed, &c)
+		default:
+			panic(fmt.Sprintf("cannot prefix edge of type %T", e))
+		}
+	}
+	return prefixed
+}
+
+// prefixed returns the topic in Kafka of a topic named by the callbacks.
+func (gg *GroupGraph) prefixed(topic string) string {
+	return gg.topicPrefix + topic
+}
+
+// unprefixed returns the name of a topic in Kafka as known to the callbacks. Only
+// the group and the topics of the graph's edges are prefixed, so other topics are
+// returned unchanged.
+func (gg *GroupGraph) unprefixed(topic string) string {
+	if gg.topicPrefix == "" {
+		return topic
+	}
+	if _, ok := gg.codecs[topic]; !ok && topic != gg.group {
+		return topic
+	}
+	return strings.TrimPrefix(topic, gg.topicPrefix)
+}
+
 func (gg *GroupGraph) validateInputTopic(topic string) {
 	if topic == "" {
 		panic("Input topic cannot be empty. This will not work.")
@@ -183,26 +363,53 @@ func (gg *GroupGraph) validateInputTopic(topic string) {
 // Validate validates the group graph and returns an error if invalid.
 // Main validation checks are:
 // - at most one loopback stream edge is allowed
+// - named loopback stream edges need a unique, non-empty name
 // - at most one group table edge is allowed
 // - at least one input stream is required
-// - table and loopback topics cannot be used in any other edge.
+// - table, loopback and outbox topics cannot be used in any other edge.
+// - a topic cannot be both output and outbox stream.
+// - streams shared by a contract must use the codec of the contract.
 func (gg *GroupGraph) Validate() error {
 	if len(gg.loopStream) > 1 {
 		return errors.New("more than one loop stream in group graph")
 	}
+	names := make(map[string]bool)
+	for _, e := range gg.namedLoops {
+		name := e.(*namedLoopStream).name
+		if name == "" {
+			return errors.New("named loop stream without name in group graph")
+		}
+		if names[name] {
+			return fmt.Errorf("more than one loop stream named %s in group graph", name)
+		}
+		names[name] = true
+	}
 	if len(gg.groupTable) > 1 {
 		return errors.New("more than one group table in group graph")
 	}
 	if len(gg.inputStreams) == 0 {
 		return errors.New("no input stream in group graph")
 	}
-	for _, t := range chainEdges(gg.outputStreams, gg.inputStreams, gg.inputTables, gg.crossTables) {
-		if t.Topic() == loopName(gg.Group()) {
+	for _, t := range chainEdges(gg.outputStreams, gg.outboxStreams, gg.inputStreams, gg.inputTables, gg.crossTables) {
+		if gg.isLoopTopic(t.Topic()) {
 			return errors.New("should not directly use loop stream")
 		}
 		if t.Topic() == tableName(gg.Group()) {
 			return errors.New("should not directly use group table")
 		}
+		if t.Topic() == outboxName(gg.Group()) {
+			return errors.New("should not directly use outbox table")
+		}
+	}
+	for _, t := range gg.outboxStreams {
+		if gg.isOutputTopic(Stream(t.Topic())) {
+			return fmt.Errorf("topic %s is defined as output and outbox stream", t.Topic())
+		}
+	}
+	for _, t := range chainEdges(gg.outputStreams, gg.outboxStreams, gg.inputStreams) {
+		if err := validateContract(t.Topic(), t.Codec()); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -261,7 +468,8 @@ func (t *topicDef) Codec() Codec {
 
 type inputStream struct {
 	*topicDef
-	cb ProcessCallback
+	cb        ProcessCallback
+	prefilter Prefilter
 }
 
 // Input represents an edge of an input stream topic. The edge
@@ -270,7 +478,20 @@ type inputStream struct {
 // the group and with the group table.
 // The group starts reading the topic from the newest offset.
 func Input(topic Stream, c Codec, cb ProcessCallback) Edge {
-	return &inputStream{&topicDef{string(topic), c}, cb}
+	return &inputStream{&topicDef{string(topic), c}, cb, nil}
+}
+
+// Prefilter decides on the raw key, value and headers of an input message whether the
+// message is processed. It is called before the message is decoded, see InputWithPrefilter.
+type Prefilter func(key string, value []byte, hdr Headers) bool
+
+// InputWithPrefilter represents an edge of an input stream topic like Input, but only
+// messages passing the prefilter are decoded and passed to the callback. Other messages
+// are committed without processing, so topics with mostly irrelevant messages don't pay
+// the cost of decoding them.
+// The prefilter is called in the processing loop, so it should be cheap and not block.
+func InputWithPrefilter(topic Stream, c Codec, cb ProcessCallback, prefilter Prefilter) Edge {
+	return &inputStream{&topicDef{string(topic), c}, cb, prefilter}
 }
 
 type inputStreams Edges
@@ -320,15 +541,35 @@ type loopStream inputStream
 // Loop represents the edge of the loopback topic of the group. The edge
 // specifies the codec of the messages in the topic and ProcesCallback to
 // process the messages of the topic. Context.Loopback() is used to write
-// messages into this topic from any callback of the group.
+// messages into this topic from any callback of the group, LoopbackAfter()
+// to process them after a delay, e.g. to retry work later.
 func Loop(c Codec, cb ProcessCallback) Edge {
-	return &loopStream{&topicDef{codec: c}, cb}
+	return &loopStream{&topicDef{codec: c}, cb, nil}
 }
 
 func (s *loopStream) setGroup(group Group) {
 	s.topicDef.name = loopName(group)
 }
 
+type namedLoopStream struct {
+	*topicDef
+	name string
+	cb   ProcessCallback
+}
+
+// NamedLoop represents the edge of an additional loopback topic of the group,
+// named <group>-loop-<name>. A group may define several named loops with
+// different codecs and callbacks besides the Loop, e.g. one for retries and one
+// to fan in messages re-keyed by another key. LoopbackTo() is used to
+// write messages into the topic of the loop with the passed name.
+func NamedLoop(name string, c Codec, cb ProcessCallback) Edge {
+	return &namedLoopStream{&topicDef{codec: c}, name, cb}
+}
+
+func (s *namedLoopStream) setGroup(group Group) {
+	s.topicDef.name = namedLoopName(group, s.name)
+}
+
 type inputTable struct {
 	*topicDef
 }
@@ -338,6 +579,11 @@ type inputTable struct {
 // The group starts reading the topic from the oldest offset.
 // The processing of input streams is blocked until all partitions of the table
 // are recovered.
+// The table partitions are materialized in the local storage of the processor,
+// so the group table of another processor group (see GroupTable) can be used as
+// input without copying it into an own topic. Besides accessing the value of the
+// current key via Context.Join, callbacks can iterate the whole partition with
+// IterateJoin, e.g. when triggered by a periodic tick message.
 func Join(topic Table, c Codec) Edge {
 	return &inputTable{&topicDef{string(topic), c}}
 }
@@ -357,6 +603,7 @@ func Lookup(topic Table, c Codec) Edge {
 
 type groupTable struct {
 	*topicDef
+	ephemeral bool
 }
 
 // Persist represents the edge of the group table, which is log-compacted and
@@ -371,7 +618,18 @@ type groupTable struct {
 //
 // The topic name is derived from the group name by appending "-table".
 func Persist(c Codec) Edge {
-	return &groupTable{&topicDef{codec: c}}
+	return &groupTable{topicDef: &topicDef{codec: c}}
+}
+
+// PersistEphemeral represents the edge of a group table that is only kept in the
+// local storage of the processor, i.e. no changelog is written to Kafka.
+// The table is not recovered when a partition is assigned to a processor instance,
+// so its state is either rebuilt from the input streams or accepted as lost.
+// Depending on the storage, the state of a previous assignment of the partition
+// might be kept.
+// Use it for cheap derived caches where the changelog traffic is pure cost.
+func PersistEphemeral(c Codec) Edge {
+	return &groupTable{topicDef: &topicDef{codec: c}, ephemeral: true}
 }
 
 func (t *groupTable) setGroup(group Group) {
@@ -391,11 +649,33 @@ func Output(topic Stream, c Codec) Edge {
 	return &outputStream{&topicDef{string(topic), c}}
 }
 
+type outboxStream struct {
+	*topicDef
+}
+
+// Outbox represents an edge of an output stream topic that is written via the
+// outbox of the group. Messages passed to Context.Emit() for this topic are
+// appended to the outbox table of the group (see OutboxTable) and committed
+// together with the input message. A forwarder managed by the processor emits
+// them into the topic afterwards, retrying on failures. This decouples the
+// processing from the availability of the topic.
+// Forwarded messages carry the header OutboxIDHeader, which is stable if a
+// message has to be forwarded again, so consumers can deduplicate them.
+func Outbox(topic Stream, c Codec) Edge {
+	return &outboxStream{&topicDef{string(topic), c}}
+}
+
 // GroupTable returns the name of the group table of group.
 func GroupTable(group Group) Table {
 	return Table(tableName(group))
 }
 
+// OutboxTable returns the name of the table topic holding the outbox of the group,
+// i.e. the messages emitted to outbox streams that are not forwarded yet.
+func OutboxTable(group Group) Table {
+	return Table(outboxName(group))
+}
+
 func tableName(group Group) string {
 	return string(group) + tableSuffix
 }
@@ -405,6 +685,16 @@ func loopName(group Group) string {
 	return string(group) + loopSuffix
 }
 
+// namedLoopName returns the name of the topic of the named loop of group.
+func namedLoopName(group Group, name string) string {
+	return loopName(group) + "-" + name
+}
+
+// outboxName returns the name of the outbox table topic of group.
+func outboxName(group Group) string {
+	return string(group) + outboxSuffix
+}
+
 // StringsToStreams is a simple cast/conversion functions that allows to pass a slice
 // of strings as a slice of Stream (Streams)
 // Avoids the boilerplate loop over the string array that would be necessary otherwise.
@@ -54,6 +54,40 @@ func TestGroupGraph_Validate(t *testing.T) {
 	err = g.Validate()
 	test.AssertStringContains(t, err.Error(), "loop stream")
 
+	g = DefineGroup("group",
+		Input("input-topic", c, cb),
+		Loop(c, cb),
+		NamedLoop("retry", c, cb),
+		NamedLoop("fan-in", c, cb),
+	)
+	err = g.Validate()
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(g.NamedLoopStreams()), 2)
+	test.AssertEqual(t, g.NamedLoopStreams()[0].Topic(), "group-loop-retry")
+	test.AssertTrue(t, g.isLoopTopic("group-loop-fan-in"))
+
+	g = DefineGroup("group",
+		Input("input-topic", c, cb),
+		NamedLoop("retry", c, cb),
+		NamedLoop("retry", c, cb),
+	)
+	err = g.Validate()
+	test.AssertStringContains(t, err.Error(), "more than one loop stream named retry")
+
+	g = DefineGroup("group",
+		Input("input-topic", c, cb),
+		NamedLoop("", c, cb),
+	)
+	err = g.Validate()
+	test.AssertStringContains(t, err.Error(), "without name")
+
+	g = DefineGroup("group",
+		Input(Stream(namedLoopName("group", "retry")), c, cb),
+		NamedLoop("retry", c, cb),
+	)
+	err = g.Validate()
+	test.AssertStringContains(t, err.Error(), "loop stream")
+
 	g = DefineGroup("group",
 		Input("input-topic", c, cb),
 		Join(Table(loopName("group")), c),
@@ -74,6 +108,28 @@ func TestGroupGraph_Validate(t *testing.T) {
 	)
 	err = g.Validate()
 	test.AssertStringContains(t, err.Error(), "loop stream")
+
+	g = DefineGroup("group",
+		Input("input-topic", c, cb),
+		Output(Stream(outboxName("group")), c),
+	)
+	err = g.Validate()
+	test.AssertStringContains(t, err.Error(), "outbox table")
+
+	g = DefineGroup("group",
+		Input("input-topic", c, cb),
+		Output("output-topic", c),
+		Outbox("output-topic", c),
+	)
+	err = g.Validate()
+	test.AssertStringContains(t, err.Error(), "output and outbox")
+
+	g = DefineGroup("group",
+		Input("input-topic", c, cb),
+		Outbox("output-topic", c),
+	)
+	err = g.Validate()
+	test.AssertNil(t, err)
 }
 
 func TestGroupGraph_chainEdges(t *testing.T) {
@@ -154,6 +210,47 @@ func TestGroupGraph_getters(t *testing.T) {
 	test.AssertTrue(t, len(g.JointTables()) == 4)
 	test.AssertTrue(t, len(g.LookupTables()) == 2)
 	test.AssertEqual(t, g.GroupTable().Topic(), tableName("group"))
+	test.AssertFalse(t, g.isEphemeralTable())
+
+	g = DefineGroup("group",
+		Input("t1", c, cb),
+		PersistEphemeral(c),
+	)
+	test.AssertEqual(t, g.GroupTable().Topic(), tableName("group"))
+	test.AssertTrue(t, g.isEphemeralTable())
+}
+
+func TestGroupGraph_withTopicPrefix(t *testing.T) {
+	g := DefineGroup("group",
+		Input("t1", c, cb),
+		Output("t2", c),
+		Outbox("t3", c),
+		Loop(c, cb),
+		NamedLoop("retry", c, cb),
+		Join("a1", c),
+		Lookup("b1", c),
+		PersistEphemeral(c),
+	).withTopicPrefix("staging.")
+
+	test.AssertNil(t, g.Validate())
+	test.AssertEqual(t, g.Group(), Group("staging.group"))
+	test.AssertEqual(t, g.InputStreams().Topics(), []string{"staging.t1"})
+	test.AssertEqual(t, g.OutputStreams().Topics(), []string{"staging.t2"})
+	test.AssertEqual(t, g.OutboxStreams().Topics(), []string{"staging.t3"})
+	test.AssertEqual(t, g.LoopStream().Topic(), "staging.group-loop")
+	test.AssertEqual(t, g.NamedLoopStreams().Topics(), []string{"staging.group-loop-retry"})
+	test.AssertEqual(t, g.JointTables().Topics(), []string{"staging.a1"})
+	test.AssertEqual(t, g.LookupTables().Topics(), []string{"staging.b1"})
+	test.AssertEqual(t, g.GroupTable().Topic(), "staging.group-table")
+	test.AssertTrue(t, g.isEphemeralTable())
+	test.AssertTrue(t, g.callback("staging.t1") != nil)
+
+	test.AssertEqual(t, g.prefixed("t2"), "staging.t2")
+	test.AssertEqual(t, g.unprefixed("staging.t1"), "t1")
+	test.AssertEqual(t, g.unprefixed("staging.group-loop-retry"), "group-loop-retry")
+	test.AssertEqual(t, g.unprefixed("staging.group"), "group")
+	// topics outside the graph are not unprefixed
+	test.AssertEqual(t, g.unprefixed("staging.other"), "staging.other")
 }
 
 func TestGroupGraph_Inputs(t *testing.T) {
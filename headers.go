@@ -1,9 +1,33 @@
 package goka
 
 import (
+	"github.com/Shopify/sarama"
 	"github.com/lovoo/goka/headers"
 )
 
 // Headers is an alias for headers.Headers for a more elegant import experience.
 // I.e. `goka.Headers` instead of `headers.Headers`.
 type Headers = headers.Headers
+
+// forwardedHeaders returns the headers of the message with the passed keys
+func forwardedHeaders(keys []string, msg *sarama.ConsumerMessage) Headers {
+	if len(keys) == 0 {
+		return nil
+	}
+	var hdr Headers
+	for _, recordHeader := range msg.Headers {
+		if recordHeader == nil {
+			continue
+		}
+		for _, key := range keys {
+			if string(recordHeader.Key) == key {
+				if hdr == nil {
+					hdr = make(Headers, len(keys))
+				}
+				hdr[key] = recordHeader.Value
+				break
+			}
+		}
+	}
+	return hdr
+}
@@ -0,0 +1,194 @@
+package goka
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SaltSeparator separates the original key from the shard in salted keys, see SaltKey.
+const SaltSeparator = "#"
+
+// HotKey is a key receiving a disproportionate share of the input messages of a partition.
+type HotKey struct {
+	Key string
+	// Count estimates the number of messages of the key in the current window.
+	// It overestimates by at most Error.
+	Count uint64
+	Error uint64
+	// Share is the guaranteed share (Count-Error) of the messages of the partition
+	// in the current window
+	Share float64
+}
+
+// HotKeyCallback is called when a key of the partition becomes hot, see WithHotKeyDetection.
+// It is called from the stats loop of the partition processor, so it should not block.
+type HotKeyCallback func(partition int32, key HotKey)
+
+// hotKeyCounter counts the messages of a key in the hot key sketch
+type hotKeyCounter struct {
+	key   string
+	count uint64
+	err   uint64
+	index int
+}
+
+// hotKeyHeap is a min-heap of counters ordered by count
+type hotKeyHeap []*hotKeyCounter
+
+func (h hotKeyHeap) Len() int           { return len(h) }
+func (h hotKeyHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hotKeyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hotKeyHeap) Push(x interface{}) {
+	c := x.(*hotKeyCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *hotKeyHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// hotKeyDetector finds the most frequent keys of a partition with the space-saving
+// algorithm, which counts at most capacity keys. The counts are halved on every decay,
+// so keys that are not hot anymore fade out.
+// It is not safe for concurrent use, the partition processor only uses it in the stats loop.
+type hotKeyDetector struct {
+	capacity int
+	minShare float64
+	callback HotKeyCallback
+
+	counters map[string]*hotKeyCounter
+	heap     hotKeyHeap
+	total    uint64
+	// hot keys as of the last decay, to call the callback only for new hot keys
+	hot map[string]bool
+}
+
+func newHotKeyDetector(capacity int, minShare float64, cb HotKeyCallback) *hotKeyDetector {
+	return &hotKeyDetector{
+		capacity: capacity,
+		minShare: minShare,
+		callback: cb,
+		counters: make(map[string]*hotKeyCounter, capacity),
+		hot:      make(map[string]bool),
+	}
+}
+
+// observe counts a message of key
+func (d *hotKeyDetector) observe(key string) {
+	d.total++
+	if c, ok := d.counters[key]; ok {
+		c.count++
+		heap.Fix(&d.heap, c.index)
+		return
+	}
+	if len(d.heap) < d.capacity {
+		c := &hotKeyCounter{key: key, count: 1}
+		d.counters[key] = c
+		heap.Push(&d.heap, c)
+		return
+	}
+
+	// replace the least frequent key, which the new key may have had at most as often
+	c := d.heap[0]
+	delete(d.counters, c.key)
+	c.key, c.err = key, c.count
+	c.count++
+	d.counters[key] = c
+	heap.Fix(&d.heap, 0)
+}
+
+// hotKeys returns the keys whose guaranteed share is at least minShare, most frequent first
+func (d *hotKeyDetector) hotKeys() []HotKey {
+	if d.total == 0 {
+		return nil
+	}
+	var keys []HotKey
+	for _, c := range d.heap {
+		share := float64(c.count-c.err) / float64(d.total)
+		if share < d.minShare {
+			continue
+		}
+		keys = append(keys, HotKey{Key: c.key, Count: c.count, Error: c.err, Share: share})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Count > keys[j].Count })
+	return keys
+}
+
+// decay calls the callback for keys that became hot since the last decay and halves
+// all counts.
+func (d *hotKeyDetector) decay(partition int32) {
+	hot := make(map[string]bool)
+	for _, key := range d.hotKeys() {
+		hot[key.Key] = true
+		if !d.hot[key.Key] && d.callback != nil {
+			d.callback(partition, key)
+		}
+	}
+	d.hot = hot
+
+	d.total /= 2
+	counters := d.heap[:0]
+	for _, c := range d.heap {
+		c.count /= 2
+		c.err /= 2
+		if c.count == 0 {
+			delete(d.counters, c.key)
+			continue
+		}
+		counters = append(counters, c)
+	}
+	d.heap = counters
+	// halving keeps the order, only the indexes changed by dropping counters
+	for i, c := range d.heap {
+		c.index = i
+	}
+}
+
+// SaltKey appends a random shard between 0 and shards-1 to key, so the messages of a hot
+// key are spread over multiple keys and therefore partitions. Only use it for aggregations
+// that can be computed per shard and merged afterwards, see UnsaltKey and SaltedKeys.
+func SaltKey(key string, shards int) string {
+	if shards <= 1 {
+		return key
+	}
+	return key + SaltSeparator + strconv.Itoa(rand.Intn(shards))
+}
+
+// UnsaltKey returns the original key and the shard of a key salted with SaltKey.
+// ok is false if the key is not salted.
+func UnsaltKey(salted string) (key string, shard int, ok bool) {
+	idx := strings.LastIndex(salted, SaltSeparator)
+	if idx < 0 {
+		return salted, 0, false
+	}
+	shard, err := strconv.Atoi(salted[idx+len(SaltSeparator):])
+	if err != nil || shard < 0 {
+		return salted, 0, false
+	}
+	return salted[:idx], shard, true
+}
+
+// SaltedKeys returns all salted keys of key, e.g. to look up the sub-aggregates of all
+// shards.
+func SaltedKeys(key string, shards int) []string {
+	if shards <= 1 {
+		return []string{key}
+	}
+	keys := make([]string, 0, shards)
+	for i := 0; i < shards; i++ {
+		keys = append(keys, key+SaltSeparator+strconv.Itoa(i))
+	}
+	return keys
+}
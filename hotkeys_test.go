@@ -0,0 +1,76 @@
+package goka
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestHotKeyDetector(t *testing.T) {
+	t.Run("detect", func(t *testing.T) {
+		d := newHotKeyDetector(4, 0.3, nil)
+		for i := 0; i < 100; i++ {
+			d.observe("hot")
+			d.observe(fmt.Sprintf("cold-%d", i))
+		}
+		keys := d.hotKeys()
+		test.AssertEqual(t, len(keys), 1)
+		test.AssertEqual(t, keys[0].Key, "hot")
+		test.AssertEqual(t, keys[0].Count, uint64(100))
+		test.AssertEqual(t, keys[0].Error, uint64(0))
+		test.AssertEqual(t, keys[0].Share, 0.5)
+		test.AssertEqual(t, len(d.counters), 4)
+	})
+	t.Run("callback", func(t *testing.T) {
+		var hot []string
+		d := newHotKeyDetector(4, 0.5, func(partition int32, key HotKey) {
+			test.AssertEqual(t, partition, int32(3))
+			hot = append(hot, key.Key)
+		})
+		for i := 0; i < 10; i++ {
+			d.observe("a")
+		}
+		d.decay(3)
+		d.decay(3)
+		test.AssertEqual(t, hot, []string{"a"})
+
+		// a fades out while b gets hot
+		for i := 0; i < 20; i++ {
+			d.observe("b")
+		}
+		d.decay(3)
+		test.AssertEqual(t, hot, []string{"a", "b"})
+		test.AssertEqual(t, len(d.hotKeys()), 1)
+	})
+	t.Run("decay", func(t *testing.T) {
+		d := newHotKeyDetector(4, 0.1, nil)
+		d.observe("a")
+		d.observe("b")
+		d.observe("b")
+		d.decay(0)
+		test.AssertEqual(t, d.total, uint64(1))
+		test.AssertEqual(t, len(d.heap), 1)
+		test.AssertEqual(t, d.heap[0].key, "b")
+		test.AssertEqual(t, d.heap[0].index, 0)
+		_, ok := d.counters["a"]
+		test.AssertFalse(t, ok)
+	})
+}
+
+func TestSaltKey(t *testing.T) {
+	test.AssertEqual(t, SaltKey("key", 1), "key")
+	test.AssertEqual(t, SaltedKeys("key", 3), []string{"key#0", "key#1", "key#2"})
+
+	for i := 0; i < 10; i++ {
+		key, shard, ok := UnsaltKey(SaltKey("a#key", 3))
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, key, "a#key")
+		test.AssertTrue(t, shard >= 0 && shard < 3)
+	}
+
+	_, _, ok := UnsaltKey("key")
+	test.AssertFalse(t, ok)
+	_, _, ok = UnsaltKey("key#x")
+	test.AssertFalse(t, ok)
+}
@@ -0,0 +1,150 @@
+package goka
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// prioritizedInputs queues the input messages of a partition processor in one
+// channel per priority, so messages of higher priority topics can be processed
+// before pending messages of lower priority topics. Topics with a quota get a
+// channel of their own, which is skipped while the topic exceeds its quota and
+// messages of other topics are pending.
+type prioritizedInputs struct {
+	// channels ordered by descending priority
+	channels []chan *sarama.ConsumerMessage
+	// quotaTopics contains the topic of each channel of a topic with quota
+	quotaTopics []string
+	shares      *inputShares
+	// channel of each topic
+	topics map[string]chan *sarama.ConsumerMessage
+	// default channel for topics without priority
+	fallback chan *sarama.ConsumerMessage
+}
+
+func newPrioritizedInputs(topics []string, priorities map[string]int, quotas map[string]float64, size int) *prioritizedInputs {
+	pi := &prioritizedInputs{
+		topics: make(map[string]chan *sarama.ConsumerMessage),
+		shares: newInputShares(quotas),
+	}
+	// channels of topics with quota by priority
+	quotaChannels := make(map[int][]string)
+
+	byPriority := map[int]chan *sarama.ConsumerMessage{
+		0: make(chan *sarama.ConsumerMessage, size),
+	}
+	pi.fallback = byPriority[0]
+	for _, topic := range topics {
+		prio := priorities[topic]
+		if _, ok := quotas[topic]; ok {
+			pi.topics[topic] = make(chan *sarama.ConsumerMessage, size)
+			quotaChannels[prio] = append(quotaChannels[prio], topic)
+			continue
+		}
+		if _, ok := byPriority[prio]; !ok {
+			byPriority[prio] = make(chan *sarama.ConsumerMessage, size)
+		}
+		pi.topics[topic] = byPriority[prio]
+	}
+
+	var prios []int
+	for prio := range byPriority {
+		prios = append(prios, prio)
+	}
+	for prio := range quotaChannels {
+		if _, ok := byPriority[prio]; !ok {
+			prios = append(prios, prio)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(prios)))
+	for _, prio := range prios {
+		sort.Strings(quotaChannels[prio])
+		for _, topic := range quotaChannels[prio] {
+			pi.channels = append(pi.channels, pi.topics[topic])
+			pi.quotaTopics = append(pi.quotaTopics, topic)
+		}
+		if ch, ok := byPriority[prio]; ok {
+			pi.channels = append(pi.channels, ch)
+			pi.quotaTopics = append(pi.quotaTopics, "")
+		}
+	}
+	return pi
+}
+
+// channel returns the channel messages of the passed topic have to be enqueued in.
+func (pi *prioritizedInputs) channel(topic string) chan<- *sarama.ConsumerMessage {
+	if ch, ok := pi.topics[topic]; ok {
+		return ch
+	}
+	return pi.fallback
+}
+
+// receive returns the pending message with the highest priority, blocking until
+// a message is available. It returns false if the context is done or abort is closed.
+func (pi *prioritizedInputs) receive(ctx context.Context, abort <-chan struct{}) (*sarama.ConsumerMessage, bool) {
+	// fast path: no priorities configured
+	if len(pi.channels) == 1 {
+		select {
+		case msg := <-pi.channels[0]:
+			return msg, true
+		case <-ctx.Done():
+			return nil, false
+		case <-abort:
+			return nil, false
+		}
+	}
+
+	var overQuota []chan *sarama.ConsumerMessage
+	for i, ch := range pi.channels {
+		if pi.quotaTopics[i] != "" && pi.shares.exceeded(pi.quotaTopics[i]) {
+			overQuota = append(overQuota, ch)
+			continue
+		}
+		select {
+		case msg := <-ch:
+			return msg, true
+		default:
+		}
+	}
+	// no other messages pending, so topics exceeding their quota may continue
+	for _, ch := range overQuota {
+		select {
+		case msg := <-ch:
+			return msg, true
+		default:
+		}
+	}
+
+	// nothing pending, wait for the first message of any priority
+	cases := make([]reflect.SelectCase, 0, len(pi.channels)+2)
+	cases = append(cases,
+		reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(abort)},
+	)
+	for _, ch := range pi.channels {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
+	}
+	chosen, value, _ := reflect.Select(cases)
+	if chosen < 2 {
+		return nil, false
+	}
+	return value.Interface().(*sarama.ConsumerMessage), true
+}
+
+// processed tracks the processing time of a message of the topic for the quotas.
+func (pi *prioritizedInputs) processed(topic string, elapsed time.Duration) {
+	pi.shares.track(topic, elapsed)
+}
+
+// backlog returns the number of messages queued in all channels.
+func (pi *prioritizedInputs) backlog() int {
+	var n int
+	for _, ch := range pi.channels {
+		n += len(ch)
+	}
+	return n
+}
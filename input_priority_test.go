@@ -0,0 +1,101 @@
+package goka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestPrioritizedInputs(t *testing.T) {
+	t.Run("order", func(t *testing.T) {
+		pi := newPrioritizedInputs([]string{"data", "control", "low"}, map[string]int{"control": 10, "low": -1}, nil, 10)
+		test.AssertEqual(t, len(pi.channels), 3)
+
+		for _, topic := range []string{"low", "data", "data", "control"} {
+			pi.channel(topic) <- &sarama.ConsumerMessage{Topic: topic}
+		}
+
+		var topics []string
+		for i := 0; i < 4; i++ {
+			msg, ok := pi.receive(context.Background(), nil)
+			test.AssertTrue(t, ok)
+			topics = append(topics, msg.Topic)
+		}
+		test.AssertEqual(t, topics, []string{"control", "data", "data", "low"})
+		test.AssertEqual(t, pi.backlog(), 0)
+	})
+	t.Run("backlog", func(t *testing.T) {
+		pi := newPrioritizedInputs([]string{"data", "control"}, map[string]int{"control": 1}, nil, 10)
+		pi.channel("data") <- &sarama.ConsumerMessage{Topic: "data"}
+		pi.channel("data") <- &sarama.ConsumerMessage{Topic: "data"}
+		pi.channel("control") <- &sarama.ConsumerMessage{Topic: "control"}
+		test.AssertEqual(t, pi.backlog(), 3)
+	})
+	t.Run("unknown-topic", func(t *testing.T) {
+		pi := newPrioritizedInputs([]string{"data"}, nil, nil, 1)
+		test.AssertEqual(t, len(pi.channels), 1)
+		pi.channel("other") <- &sarama.ConsumerMessage{Topic: "other"}
+		msg, ok := pi.receive(context.Background(), nil)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, msg.Topic, "other")
+	})
+	t.Run("blocking", func(t *testing.T) {
+		pi := newPrioritizedInputs([]string{"data", "control"}, map[string]int{"control": 1}, nil, 0)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			pi.channel("data") <- &sarama.ConsumerMessage{Topic: "data"}
+		}()
+		msg, ok := pi.receive(context.Background(), nil)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, msg.Topic, "data")
+	})
+	t.Run("abort", func(t *testing.T) {
+		pi := newPrioritizedInputs([]string{"data", "control"}, map[string]int{"control": 1}, nil, 0)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, ok := pi.receive(ctx, nil)
+		test.AssertFalse(t, ok)
+
+		abort := make(chan struct{})
+		close(abort)
+		_, ok = pi.receive(context.Background(), abort)
+		test.AssertFalse(t, ok)
+	})
+	t.Run("no-quota", func(t *testing.T) {
+		pi := newPrioritizedInputs([]string{"data", "control"}, map[string]int{"control": 1}, nil, 10)
+		// without quotas, the processing times are not tracked
+		test.AssertNil(t, pi.shares)
+		pi.processed("data", time.Second)
+		test.AssertEqual(t, pi.shares.share("data"), 0.0)
+	})
+	t.Run("quota", func(t *testing.T) {
+		pi := newPrioritizedInputs([]string{"data", "control"}, nil, map[string]float64{"data": 0.5}, 10)
+		test.AssertEqual(t, len(pi.channels), 2)
+
+		// data used all processing time, so control is preferred
+		pi.processed("data", time.Second)
+		test.AssertEqual(t, pi.shares.share("data"), 1.0)
+		pi.channel("data") <- &sarama.ConsumerMessage{Topic: "data"}
+		pi.channel("control") <- &sarama.ConsumerMessage{Topic: "control"}
+		msg, ok := pi.receive(context.Background(), nil)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, msg.Topic, "control")
+
+		// nothing else pending, so data continues over quota
+		msg, ok = pi.receive(context.Background(), nil)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, msg.Topic, "data")
+
+		// back within quota, data is received first again
+		pi.processed("control", 2*time.Second)
+		test.AssertTrue(t, pi.shares.share("data") < 0.5)
+		pi.channel("data") <- &sarama.ConsumerMessage{Topic: "data"}
+		pi.channel("control") <- &sarama.ConsumerMessage{Topic: "control"}
+		msg, ok = pi.receive(context.Background(), nil)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, msg.Topic, "data")
+	})
+}
@@ -0,0 +1,67 @@
+package goka
+
+import (
+	"sync"
+	"time"
+)
+
+// shareDecay is the factor the tracked processing times decay with per processed
+// message, so the shares reflect roughly the last few hundred messages
+const shareDecay = 0.99
+
+// inputShares tracks the share of the processing time each input topic of a
+// partition processor used recently and whether topics exceed their quota,
+// see WithInputQuota. A nil inputShares tracks nothing, so processors without
+// quotas do not pay for the tracking of every message.
+type inputShares struct {
+	m      sync.Mutex
+	quotas map[string]float64
+	usage  map[string]float64
+	total  float64
+}
+
+func newInputShares(quotas map[string]float64) *inputShares {
+	if len(quotas) == 0 {
+		return nil
+	}
+	return &inputShares{
+		quotas: quotas,
+		usage:  make(map[string]float64),
+	}
+}
+
+// track adds the processing time of a message of the topic.
+func (s *inputShares) track(topic string, elapsed time.Duration) {
+	if s == nil {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	for t := range s.usage {
+		s.usage[t] *= shareDecay
+	}
+	s.usage[topic] += float64(elapsed)
+	s.total = s.total*shareDecay + float64(elapsed)
+}
+
+// share returns the recent share of the processing time of the topic.
+func (s *inputShares) share(topic string) float64 {
+	if s == nil {
+		return 0
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.total <= 0 {
+		return 0
+	}
+	return s.usage[topic] / s.total
+}
+
+// exceeded returns whether the topic used more than its quota recently.
+func (s *inputShares) exceeded(topic string) bool {
+	if s == nil {
+		return false
+	}
+	quota, ok := s.quotas[topic]
+	return ok && s.share(topic) > quota
+}
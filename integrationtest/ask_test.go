@@ -0,0 +1,68 @@
+package integrationtest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+func TestAsk(t *testing.T) {
+	var (
+		gkt     = tester.New(t)
+		replied []bool
+	)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("requests", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			if msg.(string) == "ignore" {
+				return
+			}
+			replied = append(replied, goka.Reply(ctx, new(codec.String), strings.ToUpper(msg.(string))))
+		}),
+	),
+		goka.WithTester(gkt),
+		goka.WithReplyTopics("responses-"),
+	)
+
+	asker, err := goka.NewAsker(nil, "requests", new(codec.String), "responses-1", new(codec.String), goka.WithAskerTester(gkt))
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run, asker.Run)
+
+	askCtx, askCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer askCancel()
+	test.AssertNil(t, proc.WaitRunning(askCtx))
+	response, err := asker.Ask(askCtx, "key", "hello")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, response, "HELLO")
+
+	timeoutCtx, timeoutCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer timeoutCancel()
+	_, err = asker.Ask(timeoutCtx, "key", "ignore")
+	test.AssertEqual(t, err, context.DeadlineExceeded)
+
+	// messages without request headers are not replied to
+	gkt.Consume("requests", "key", "other")
+	test.AssertEqual(t, replied, []bool{true, false})
+
+	// responses to topics not allowed or owned by the group are ignored
+	for _, topic := range []string{"other", "group-table", "group-loop", "responses-1"} {
+		gkt.Consume("requests", "key", "other", tester.WithHeaders(goka.Headers{
+			goka.AskReplyToHeader:       []byte(topic),
+			goka.AskCorrelationIDHeader: []byte("id"),
+		}))
+	}
+	test.AssertEqual(t, replied, []bool{true, false, false, false, false, true})
+
+	cancel()
+	wait()
+
+	_, err = asker.Ask(context.Background(), "key", "hello")
+	test.AssertEqual(t, err, goka.ErrAskerNotRunning)
+}
@@ -0,0 +1,113 @@
+package integrationtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+func TestBackfill(t *testing.T) {
+	var (
+		gkt   = tester.New(t)
+		group = goka.Group("counter")
+	)
+
+	define := func(group goka.Group) *goka.GroupGraph {
+		return goka.DefineGroup(group,
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				var count int64
+				if val := ctx.Value(); val != nil {
+					count = val.(int64)
+				}
+				ctx.SetValue(count + 1)
+				ctx.Emit("output", ctx.Key(), "counted")
+			}),
+			goka.Output("output", new(codec.String)),
+			goka.Persist(new(codec.Int64)),
+		)
+	}
+
+	emitter, err := goka.NewEmitter(nil, "input", new(codec.String), goka.WithEmitterTester(gkt))
+	test.AssertNil(t, err)
+	for _, key := range []string{"a", "b", "a"} {
+		test.AssertNil(t, emitter.EmitSync(key, "value"))
+	}
+
+	checkpoints, err := goka.NewCheckpoints(nil, "checkpoints", goka.WithCheckpointsTester(gkt))
+	test.AssertNil(t, err)
+	// the outputs are not emitted to the live topic
+	var (
+		m       sync.Mutex
+		outputs []string
+	)
+	tracker := gkt.NewQueueTracker("output")
+	backfill, err := goka.NewBackfill(nil, group, 1, define,
+		goka.WithBackfillTester(gkt),
+		goka.WithBackfillOnOutput(func(topic string, key string, value []byte, hdr goka.Headers) {
+			m.Lock()
+			defer m.Unlock()
+			outputs = append(outputs, topic+"/"+key)
+		}),
+	)
+	test.AssertNil(t, err)
+	view := goka.NewVersionedView(nil, group, new(codec.Int64), checkpoints, goka.WithViewTester(gkt))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 3)
+	go func() { errs <- checkpoints.Run(ctx) }()
+	go func() { errs <- view.Run(ctx) }()
+	test.AssertNil(t, view.WaitRecovered(ctx))
+	test.AssertEqual(t, view.Version(), 0)
+	val, err := view.Get("a")
+	test.AssertNil(t, err)
+	test.AssertNil(t, val)
+
+	done := make(chan error, 1)
+	go func() { done <- backfill.Run(ctx) }()
+	backfill.Processor().WaitForReady()
+	gkt.Catchup()
+	select {
+	case err := <-done:
+		test.AssertNil(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatalf("backfill did not complete")
+	}
+	_, _, ok := tracker.Next()
+	test.AssertFalse(t, ok)
+	m.Lock()
+	test.AssertEqual(t, outputs, []string{"output/a", "output/b", "output/a"})
+	m.Unlock()
+
+	test.AssertNil(t, goka.ActivateTableVersion(checkpoints, group, 1))
+	version, err := goka.ActiveTableVersion(checkpoints, group)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, version, 1)
+
+	// the tester delivers the messages to the view of version 1 on catchup
+	deadline := time.Now().Add(10 * time.Second)
+	for view.Version() != 1 {
+		gkt.Catchup()
+		if time.Now().After(deadline) {
+			t.Fatalf("view did not switch to version 1")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	val, err = view.Get("a")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, val, int64(2))
+	val, err = view.Get("b")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, val, int64(1))
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		test.AssertNil(t, <-errs)
+	}
+}
@@ -0,0 +1,38 @@
+package integrationtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+func TestCheckpoints(t *testing.T) {
+	gkt := tester.New(t)
+
+	checkpoints, err := goka.NewCheckpoints(nil, "checkpoints", goka.WithCheckpointsTester(gkt))
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, checkpoints.Run)
+	test.AssertNil(t, checkpoints.WaitRecovered(context.Background()))
+
+	ok, err := checkpoints.Done("migration-1")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, ok)
+
+	test.AssertNil(t, checkpoints.Set("migration-1", "applied"))
+	value, ok, err := checkpoints.Get("migration-1")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, value, "applied")
+
+	test.AssertNil(t, checkpoints.Delete("migration-1"))
+	ok, err = checkpoints.Done("migration-1")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, ok)
+
+	cancel()
+	wait()
+}
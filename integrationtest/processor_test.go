@@ -2,12 +2,17 @@ package integrationtest
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/Shopify/sarama"
 	"github.com/lovoo/goka"
 	"github.com/lovoo/goka/codec"
 	"github.com/lovoo/goka/internal/test"
@@ -172,6 +177,975 @@ func TestHeaders(t *testing.T) {
 	<-done
 }
 
+func TestOutputDefaultHeaders(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+			ctx.Emit("output", ctx.Key(), msg, goka.WithCtxEmitHeaders(goka.Headers{
+				"version": []byte("2"),
+			}))
+		}),
+		goka.Output("output", new(codec.String)),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithOutputDefaultHeaders(goka.Headers{
+			"service": []byte("group"),
+			"version": []byte("1"),
+		}),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	output := gkt.NewQueueTracker("output")
+	changelog := gkt.NewQueueTracker(string(goka.GroupTable("group")))
+
+	gkt.Consume("input", "key", "value")
+
+	hdr, _, _, ok := output.NextWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, string(hdr["service"]), "group")
+	test.AssertEqual(t, string(hdr["version"]), "2")
+
+	hdr, _, _, ok = changelog.NextWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, string(hdr["service"]), "group")
+	test.AssertEqual(t, string(hdr["version"]), "1")
+
+	cancel()
+	wait()
+}
+
+func TestHeaderForwarding(t *testing.T) {
+	var (
+		gkt         = tester.New(t)
+		loopHeaders goka.Headers
+	)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+			ctx.Emit("output", ctx.Key(), msg, goka.WithCtxEmitHeaders(goka.Headers{
+				"tenant": []byte("override"),
+			}))
+			ctx.Loopback(ctx.Key(), msg)
+		}),
+		goka.Loop(new(codec.String), func(ctx goka.Context, msg interface{}) {
+			loopHeaders = ctx.Headers()
+		}),
+		goka.Output("output", new(codec.String)),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithOutputDefaultHeaders(goka.Headers{
+			"correlation-id": []byte("default"),
+		}),
+		goka.WithHeaderForwarding("correlation-id"),
+		goka.WithHeaderForwarding("tenant"),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	output := gkt.NewQueueTracker("output")
+	changelog := gkt.NewQueueTracker(string(goka.GroupTable("group")))
+
+	gkt.Consume("input", "key", "value", tester.WithHeaders(goka.Headers{
+		"correlation-id": []byte("123"),
+		"tenant":         []byte("t1"),
+		"other":          []byte("x"),
+	}))
+
+	hdr, _, _, ok := output.NextWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, string(hdr["correlation-id"]), "123")
+	test.AssertEqual(t, string(hdr["tenant"]), "override")
+	_, forwarded := hdr["other"]
+	test.AssertFalse(t, forwarded)
+
+	hdr, _, _, ok = changelog.NextWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, string(hdr["correlation-id"]), "123")
+	test.AssertEqual(t, string(hdr["tenant"]), "t1")
+
+	test.AssertEqual(t, string(loopHeaders["correlation-id"]), "123")
+
+	// without the header, the default is used
+	gkt.Consume("input", "key", "value")
+	hdr, _, _, ok = output.NextWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, string(hdr["correlation-id"]), "default")
+
+	cancel()
+	wait()
+}
+
+func TestAuditTopic(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.Emit("output", ctx.Key(), msg)
+			ctx.SetValue(msg)
+		}),
+		goka.Output("output", new(codec.String)),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithAuditTopic("audit"),
+		goka.WithInstanceID("instance-1"),
+	)
+	emitter, err := goka.NewEmitter(nil, "input", new(codec.String),
+		goka.WithEmitterTester(gkt),
+		goka.WithEmitterAuditTopic("audit"),
+		goka.WithEmitterClientID("emitter-1"),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	audit := gkt.NewQueueTracker("audit")
+	test.AssertNil(t, emitter.EmitSync("key", "value"))
+
+	next := func() goka.AuditRecord {
+		key, data, ok := audit.NextRaw()
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, key, "key")
+		var record goka.AuditRecord
+		test.AssertNil(t, json.Unmarshal(data, &record))
+		return record
+	}
+
+	// records are written once the messages were produced, so the record of the input
+	// may follow the records of the messages emitted while processing it
+	records := make(map[string]goka.AuditRecord)
+	for i := 0; i < 3; i++ {
+		record := next()
+		records[record.Topic] = record
+	}
+
+	hash := sha256.Sum256([]byte("value"))
+	for topic, producer := range map[string]string{
+		"input":                          "emitter-1",
+		"output":                         "instance-1",
+		string(goka.GroupTable("group")): "instance-1",
+	} {
+		record, ok := records[topic]
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, record.Producer, producer)
+		test.AssertEqual(t, record.Size, 5)
+		test.AssertEqual(t, record.Hash, hex.EncodeToString(hash[:]))
+		test.AssertFalse(t, record.Timestamp.IsZero())
+	}
+	_, _, ok := audit.NextRaw()
+	test.AssertFalse(t, ok)
+
+	cancel()
+	wait()
+}
+
+func TestLoopbackAfter(t *testing.T) {
+	var (
+		gkt   = tester.New(t)
+		delay = 50 * time.Millisecond
+		hops  []int
+	)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			goka.LoopbackAfter(ctx, ctx.Key(), msg, delay)
+		}),
+		goka.Loop(new(codec.String), func(ctx goka.Context, msg interface{}) {
+			hops = append(hops, goka.LoopbackHops(ctx.Headers()))
+			// retry forever, limited by the max hops
+			goka.LoopbackAfter(ctx, ctx.Key(), msg, delay)
+		}),
+	),
+		goka.WithTester(gkt),
+		goka.WithMaxLoopbackHops(3),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	start := time.Now()
+	gkt.Consume("input", "key", "value")
+
+	test.AssertEqual(t, hops, []int{1, 2, 3})
+	test.AssertTrue(t, time.Since(start) >= 3*delay)
+
+	cancel()
+	wait()
+}
+
+func TestNamedLoops(t *testing.T) {
+	var (
+		gkt     = tester.New(t)
+		retries []string
+	)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			// count the messages of all keys in a single key
+			goka.LoopbackTo(ctx, "fan-in", "total", int64(1))
+			goka.LoopbackTo(ctx, "retry", ctx.Key(), msg)
+		}),
+		goka.NamedLoop("fan-in", new(codec.Int64), func(ctx goka.Context, msg interface{}) {
+			var total int64
+			if val := ctx.Value(); val != nil {
+				total = val.(int64)
+			}
+			ctx.SetValue(total + msg.(int64))
+		}),
+		goka.NamedLoop("retry", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			retries = append(retries, fmt.Sprintf("%s:%v:%d", ctx.Key(), msg, goka.LoopbackHops(ctx.Headers())))
+		}),
+		goka.Persist(new(codec.Int64)),
+	),
+		goka.WithTester(gkt),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "a", "value-a")
+	gkt.Consume("input", "b", "value-b")
+
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("group"), "total"), int64(2))
+	test.AssertEqual(t, retries, []string{"a:value-a:1", "b:value-b:1"})
+
+	cancel()
+	wait()
+}
+
+func TestSaltedAggregation(t *testing.T) {
+	gkt := tester.New(t)
+
+	sum := func(agg interface{}, msg interface{}) interface{} {
+		var total int64
+		if agg != nil {
+			total = agg.(int64)
+		}
+		return total + msg.(int64)
+	}
+	agg, err := goka.NewSaltedAggregation("count", 4, 50*time.Millisecond, new(codec.Int64), new(codec.Int64), sum, sum)
+	test.AssertNil(t, err)
+
+	edges := append(agg.Edges(),
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			agg.Add(ctx, ctx.Key(), int64(1))
+		}),
+		goka.Persist(new(codec.Int64)),
+	)
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group", edges...),
+		goka.WithTester(gkt),
+		goka.WithMaxLoopbackHops(3),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	for i := 0; i < 20; i++ {
+		gkt.Consume("input", "hot", "value")
+	}
+	gkt.Consume("input", "cold", "value")
+
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("group"), "hot"), int64(20))
+	test.AssertEqual(t, gkt.TableValue(goka.GroupTable("group"), "cold"), int64(1))
+	for _, key := range goka.SaltedKeys("hot", 4) {
+		test.AssertNil(t, gkt.TableValue(goka.GroupTable("group"), key))
+	}
+
+	cancel()
+	wait()
+}
+
+func TestInputPrefilter(t *testing.T) {
+	var (
+		gkt       = tester.New(t)
+		processed []string
+	)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.InputWithPrefilter("input", new(codec.Int64), func(ctx goka.Context, msg interface{}) {
+			processed = append(processed, fmt.Sprintf("%s:%d", ctx.Key(), msg.(int64)))
+		}, func(key string, value []byte, hdr goka.Headers) bool {
+			return string(hdr["type"]) == "number"
+		}),
+	),
+		goka.WithTester(gkt),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "a", int64(1), tester.WithHeaders(goka.Headers{"type": []byte("number")}))
+	gkt.Consume("input", "b", int64(2))
+	gkt.Consume("input", "c", int64(3), tester.WithHeaders(goka.Headers{"type": []byte("number")}))
+
+	test.AssertEqual(t, processed, []string{"a:1", "c:3"})
+
+	cancel()
+	wait()
+}
+
+func TestInputRouted(t *testing.T) {
+	var (
+		gkt       = tester.New(t)
+		processed []string
+	)
+
+	route := func(name string) goka.ProcessCallback {
+		return func(ctx goka.Context, msg interface{}) {
+			processed = append(processed, fmt.Sprintf("%s:%s:%s", name, ctx.Key(), msg))
+		}
+	}
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.InputRouted("input", new(codec.String),
+			goka.RouteByHeader("type", "created", route("created")),
+			goka.RouteByHeader("type", "deleted", route("deleted")),
+			goka.RouteByKeyPrefix("admin-", route("admin")),
+		),
+	),
+		goka.WithTester(gkt),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "a", "1", tester.WithHeaders(goka.Headers{"type": []byte("created")}))
+	gkt.Consume("input", "admin-b", "2", tester.WithHeaders(goka.Headers{"type": []byte("deleted")}))
+	gkt.Consume("input", "admin-c", "3")
+	gkt.Consume("input", "d", "4", tester.WithHeaders(goka.Headers{"type": []byte("updated")}))
+
+	// the first matching route gets the message, others are skipped
+	test.AssertEqual(t, processed, []string{"created:a:1", "deleted:admin-b:2", "admin:admin-c:3"})
+
+	cancel()
+	wait()
+}
+
+func TestProcessorWaitForKeyOffset(t *testing.T) {
+	var (
+		gkt    = tester.New(t)
+		tokens = make(chan goka.ConsistencyToken, 1)
+	)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg, goka.WithCtxConsistencyToken(func(token goka.ConsistencyToken) {
+				tokens <- token
+			}))
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "key", "value")
+	token := <-tokens
+
+	test.AssertNil(t, proc.WaitForKeyOffset("key", token.Offset, 10*time.Second))
+	val, err := proc.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, val, "value")
+
+	err = proc.WaitForKeyOffset("key", token.Offset+1, 10*time.Millisecond)
+	test.AssertTrue(t, errors.Is(err, goka.ErrConsistencyTimeout))
+
+	cancel()
+	wait()
+}
+
+func TestDrain(t *testing.T) {
+	var (
+		gkt       = tester.New(t)
+		processed []string
+	)
+
+	emitter, err := goka.NewEmitter([]string{}, "input", new(codec.String), goka.WithEmitterTester(gkt))
+	test.AssertNil(t, err)
+	test.AssertNil(t, emitter.EmitSync("a", "value-1"))
+	test.AssertNil(t, emitter.EmitSync("b", "value-2"))
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			processed = append(processed, msg.(string))
+		}),
+	),
+		goka.WithTester(gkt),
+		goka.WithDrain(),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := proc.Run(context.Background()); err != nil {
+			t.Errorf("error running processor: %v", err)
+		}
+	}()
+	proc.WaitForReady()
+	gkt.Catchup()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("processor did not stop after draining")
+	}
+	test.AssertTrue(t, proc.Drained())
+	test.AssertEqual(t, processed, []string{"value-1", "value-2"})
+}
+
+func TestOutbox(t *testing.T) {
+	var (
+		gkt   = tester.New(t)
+		group = goka.Group("outbox-group")
+	)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup(group,
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.Emit("commands", ctx.Key(), fmt.Sprintf("command-1: %v", msg))
+			ctx.Emit("commands", ctx.Key(), fmt.Sprintf("command-2: %v", msg))
+		}),
+		goka.Outbox("commands", new(codec.String)),
+	),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	commands := gkt.NewQueueTracker("commands")
+	outbox := gkt.NewQueueTracker(string(goka.OutboxTable(group)))
+
+	gkt.Consume("input", "key", "msg")
+
+	// the forwarder runs asynchronously, so wait for the commands
+	var ids []string
+	for _, expected := range []string{"command-1: msg", "command-2: msg"} {
+		var (
+			hdr   goka.Headers
+			key   string
+			value interface{}
+			ok    bool
+		)
+		for start := time.Now(); !ok && time.Since(start) < 5*time.Second; {
+			hdr, key, value, ok = commands.NextWithHeaders()
+			if !ok {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, key, "key")
+		test.AssertEqual(t, value, expected)
+		test.AssertNotNil(t, hdr[goka.OutboxIDHeader])
+		ids = append(ids, string(hdr[goka.OutboxIDHeader]))
+	}
+	test.AssertNotEqual(t, ids[0], ids[1])
+
+	// both entries were appended to the outbox and then deleted
+	var appended, deleted int
+	for start := time.Now(); deleted < 2 && time.Since(start) < 5*time.Second; {
+		_, value, ok := outbox.Next()
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if data, _ := value.([]byte); data == nil {
+			deleted++
+		} else {
+			appended++
+		}
+	}
+	test.AssertEqual(t, appended, 2)
+	test.AssertEqual(t, deleted, 2)
+
+	cancel()
+	wait()
+}
+
+func TestPartitionSetupTeardown(t *testing.T) {
+	var (
+		gkt      = tester.New(t)
+		setup    = make(chan int32, 1)
+		teardown = make(chan int32, 1)
+	)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithPartitionSetup(func(partition int32, table *goka.PartitionTable) error {
+			test.AssertNotNil(t, table)
+			setup <- partition
+			return nil
+		}),
+		goka.WithPartitionTeardown(func(partition int32) {
+			teardown <- partition
+		}),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "key", "value")
+	test.AssertEqual(t, <-setup, int32(0))
+	test.AssertEqual(t, len(teardown), 0)
+
+	cancel()
+	wait()
+	test.AssertEqual(t, <-teardown, int32(0))
+}
+
+func TestPartitionSetupError(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+	),
+		goka.WithTester(gkt),
+		goka.WithPartitionSetup(func(partition int32, table *goka.PartitionTable) error {
+			return fmt.Errorf("cannot connect")
+		}),
+		goka.WithPartitionTeardown(func(partition int32) {
+			t.Errorf("teardown must not be called if setup failed")
+		}),
+	)
+	test.AssertNil(t, err)
+
+	err = proc.Run(context.Background())
+	test.AssertNotNil(t, err)
+	test.AssertStringContains(t, err.Error(), "cannot connect")
+}
+
+func TestPersistEphemeral(t *testing.T) {
+	var (
+		gkt   = tester.New(t)
+		group = goka.Group("ephemeral")
+	)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup(group,
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			if msg == "delete" {
+				ctx.Delete()
+				return
+			}
+			ctx.SetValue(msg)
+		}),
+		goka.PersistEphemeral(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	changelog := gkt.NewQueueTracker(string(goka.GroupTable(group)))
+
+	gkt.Consume("input", "key", "value")
+	gkt.Consume("input", "other", "value")
+	gkt.Consume("input", "other", "delete")
+
+	value, err := proc.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, "value")
+	value, err = proc.Get("other")
+	test.AssertNil(t, err)
+	test.AssertNil(t, value)
+
+	// nothing was written to the changelog
+	_, _, ok := changelog.Next()
+	test.AssertFalse(t, ok)
+
+	cancel()
+	wait()
+}
+
+func TestTableGC(t *testing.T) {
+	var (
+		gkt   = tester.New(t)
+		group = goka.Group("gc")
+	)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup(group,
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithTableGC(10*time.Millisecond, func(key string, value interface{}) bool {
+			return value == "expired"
+		}),
+	)
+	test.AssertNil(t, err)
+
+	changelog := gkt.NewQueueTracker(string(goka.GroupTable(group)))
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "a", "expired")
+	gkt.Consume("input", "b", "value")
+
+	// the values written by the callback
+	for _, expected := range []string{"a", "b"} {
+		key, _, ok := changelog.NextRaw()
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, key, expected)
+	}
+
+	// wait for the tombstone of the gc
+	var (
+		key   string
+		value []byte
+		ok    bool
+	)
+	for start := time.Now(); !ok && time.Since(start) < 5*time.Second; {
+		key, value, ok = changelog.NextRaw()
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "a")
+	test.AssertNil(t, value)
+
+	val, err := proc.Get("a")
+	test.AssertNil(t, err)
+	test.AssertNil(t, val)
+	val, err = proc.Get("b")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, val, "value")
+
+	cancel()
+	wait()
+}
+
+func TestTableTTL(t *testing.T) {
+	var (
+		gkt   = tester.New(t)
+		group = goka.Group("ttl")
+	)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup(group,
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			if msg == "session" {
+				goka.SetValueWithTTL(ctx, msg, 10*time.Millisecond)
+				return
+			}
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithTableTTL(10*time.Millisecond),
+	)
+	test.AssertNil(t, err)
+
+	changelog := gkt.NewQueueTracker(string(goka.GroupTable(group)))
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "a", "session")
+	gkt.Consume("input", "b", "value")
+
+	// the values written by the callback
+	for _, expected := range []string{"a", "b"} {
+		key, _, ok := changelog.NextRaw()
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, key, expected)
+	}
+
+	// wait for the tombstone of the expired key
+	var (
+		key   string
+		value []byte
+		ok    bool
+	)
+	for start := time.Now(); !ok && time.Since(start) < 5*time.Second; {
+		key, value, ok = changelog.NextRaw()
+		if !ok {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "a")
+	test.AssertNil(t, value)
+
+	val, err := proc.Get("a")
+	test.AssertNil(t, err)
+	test.AssertNil(t, val)
+	val, err = proc.Get("b")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, val, "value")
+
+	cancel()
+	wait()
+}
+
+func TestTopicPrefix(t *testing.T) {
+	var (
+		gkt    = tester.New(t)
+		group  = goka.Group("prefixed")
+		prefix = "staging."
+		topics = make(chan goka.Stream, 2)
+	)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup(group,
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			topics <- ctx.Topic()
+			test.AssertEqual(t, ctx.Group(), group)
+			ctx.SetValue(ctx.Lookup("lookup", ctx.Key()))
+			ctx.Emit("output", ctx.Key(), msg)
+		}),
+		goka.Lookup("lookup", new(codec.String)),
+		goka.Output("output", new(codec.String)),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithTopicPrefix(prefix),
+	)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, proc.Graph().Group(), goka.Group(prefix+string(group)))
+
+	view, err := goka.NewView([]string{}, goka.GroupTable(group), new(codec.String),
+		goka.WithViewTester(gkt),
+		goka.WithViewTopicPrefix(prefix),
+	)
+	test.AssertNil(t, err)
+
+	emitter, err := goka.NewEmitter([]string{}, "input", new(codec.String),
+		goka.WithEmitterTester(gkt),
+		goka.WithEmitterTopicPrefix(prefix),
+	)
+	test.AssertNil(t, err)
+
+	output := gkt.NewQueueTracker(prefix + "output")
+
+	cancel, wait := test.Run(t, proc.Run, view.Run)
+
+	// waits until the processor is running
+	gkt.SetTableValue(goka.Table(prefix+"lookup"), "key", "looked-up")
+	test.AssertNil(t, emitter.EmitSync("key", "value"))
+	test.AssertEqual(t, <-topics, goka.Stream("input"))
+
+	key, value, ok := output.Next()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "key")
+	test.AssertEqual(t, value, "value")
+	test.AssertEqual(t, gkt.TableValue(goka.Table(prefix+string(goka.GroupTable(group))), "key"), "looked-up")
+
+	val, err := view.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, val, "looked-up")
+
+	cancel()
+	wait()
+}
+
+func TestRecoveryHook(t *testing.T) {
+	var (
+		gkt       = tester.New(t)
+		recovered = make(chan int64, 1)
+	)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithRecoveryHook(func(partition int32, offset, hwm int64) {
+			if offset == hwm-1 {
+				recovered <- hwm
+			}
+		}),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "key", "value")
+	test.AssertEqual(t, <-recovered, int64(0))
+
+	stats := proc.RecoveryStats()
+	test.AssertEqual(t, len(stats), 1)
+	test.AssertEqual(t, stats[0].Topic, string(goka.GroupTable("group")))
+	test.AssertFalse(t, stats[0].Recovering)
+
+	cancel()
+	wait()
+}
+
+func TestInputSampling(t *testing.T) {
+	var (
+		gkt     = tester.New(t)
+		sampled []string
+	)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("sampling",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+	),
+		goka.WithTester(gkt),
+		goka.WithInputSampling(1, func(msg *sarama.ConsumerMessage) {
+			sampled = append(sampled, string(msg.Key))
+		}),
+		goka.WithInputMirror(1, "mirror"),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	mirror := gkt.NewQueueTracker("mirror")
+
+	gkt.Consume("input", "a", "value-a", tester.WithHeaders(goka.Headers{"origin": []byte("test")}))
+	gkt.Consume("input", "b", "value-b")
+
+	test.AssertEqual(t, sampled, []string{"a", "b"})
+
+	hdr, key, value, ok := mirror.NextRawWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "a")
+	test.AssertEqual(t, string(value), "value-a")
+	test.AssertEqual(t, string(hdr["origin"]), "test")
+	test.AssertEqual(t, string(hdr[goka.MirrorTopicHeader]), "input")
+	test.AssertEqual(t, string(hdr[goka.MirrorOffsetHeader]), "0")
+
+	_, key, _, ok = mirror.NextRawWithHeaders()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "b")
+
+	_, _, _, ok = mirror.NextRawWithHeaders()
+	test.AssertFalse(t, ok)
+
+	cancel()
+	wait()
+}
+
+func TestOutputValidator(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("validator",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.Emit("output", ctx.Key(), msg)
+		}),
+		goka.Output("output", new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithOutputValidator("output", func(key string, value interface{}) error {
+			if value == "" {
+				return fmt.Errorf("empty value")
+			}
+			return nil
+		}),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	output := gkt.NewQueueTracker("output")
+
+	gkt.Consume("input", "a", "")
+	gkt.Consume("input", "b", "value")
+
+	// the invalid message was dropped
+	key, value, ok := output.Next()
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, key, "b")
+	test.AssertEqual(t, value, "value")
+	_, _, ok = output.Next()
+	test.AssertFalse(t, ok)
+
+	cancel()
+	wait()
+}
+
+func TestCommitMetadata(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("commit-metadata",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+	),
+		goka.WithTester(gkt),
+		goka.WithInstanceID("instance-1"),
+		goka.WithInstanceVersion("v1.2.3"),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "a", "value")
+	gkt.Consume("input", "b", "value")
+
+	offsets, err := proc.CommittedOffsets("input")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(offsets), 1)
+	test.AssertEqual(t, offsets[0].Offset, int64(2))
+	test.AssertNotNil(t, offsets[0].Metadata)
+	test.AssertEqual(t, offsets[0].Metadata.InstanceID, "instance-1")
+	test.AssertEqual(t, offsets[0].Metadata.Version, "v1.2.3")
+	test.AssertFalse(t, offsets[0].Metadata.Timestamp.IsZero())
+
+	cancel()
+	wait()
+}
+
+func TestProcessor_WaitRunning(t *testing.T) {
+	t.Run("running", func(t *testing.T) {
+		gkt := tester.New(t)
+		proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		), goka.WithTester(gkt))
+		test.AssertNil(t, err)
+
+		cancel, wait := test.Run(t, proc.Run)
+
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer waitCancel()
+		test.AssertNil(t, proc.WaitRunning(waitCtx))
+
+		cancel()
+		wait()
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		gkt := tester.New(t)
+		proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		),
+			goka.WithTester(gkt),
+			goka.WithConsumerGroupBuilder(func(brokers []string, group, clientID string) (sarama.ConsumerGroup, error) {
+				return nil, fmt.Errorf("cannot connect")
+			}),
+		)
+		test.AssertNil(t, err)
+
+		go proc.Run(context.Background())
+
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer waitCancel()
+		err = proc.WaitRunning(waitCtx)
+		test.AssertNotNil(t, err)
+		test.AssertStringContains(t, err.Error(), "cannot connect")
+	})
+
+	t.Run("context-done", func(t *testing.T) {
+		gkt := tester.New(t)
+		proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		), goka.WithTester(gkt))
+		test.AssertNil(t, err)
+
+		// the processor is not started at all
+		waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer waitCancel()
+		test.AssertEqual(t, proc.WaitRunning(waitCtx), context.DeadlineExceeded)
+	})
+}
+
 /*
 import (
 	"context"
@@ -559,3 +1533,247 @@ func TestProcessor_failOnRecover(t *testing.T) {
 	//ensure.True(t, recovered > 0 && recovered < msgToRecover)
 }
 */
+
+func TestMaxMessageAge(t *testing.T) {
+	run := func(t *testing.T, policy goka.MessageAgePolicy) (*tester.Tester, []string) {
+		var (
+			gkt       = tester.New(t)
+			processed []string
+		)
+
+		proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				processed = append(processed, ctx.Key())
+			}),
+		),
+			goka.WithTester(gkt),
+			goka.WithMaxMessageAge(time.Hour, policy),
+		)
+		test.AssertNil(t, err)
+
+		cancel, wait := test.Run(t, proc.Run)
+
+		gkt.Consume("input", "old", "value", tester.WithTimestamp(time.Now().Add(-2*time.Hour)))
+		gkt.Consume("input", "recent", "value", tester.WithTimestamp(time.Now().Add(-time.Minute)))
+		gkt.Consume("input", "no-timestamp", "value")
+
+		cancel()
+		wait()
+		return gkt, processed
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		_, processed := run(t, goka.SkipTooOld())
+		test.AssertEqual(t, processed, []string{"recent", "no-timestamp"})
+	})
+
+	t.Run("dead-letter", func(t *testing.T) {
+		gkt, processed := run(t, goka.DeadLetterTooOld("too-old"))
+		test.AssertEqual(t, processed, []string{"recent", "no-timestamp"})
+
+		tracker := gkt.NewQueueTracker("too-old")
+		tracker.Seek(0)
+		hdr, key, value, ok := tracker.NextRawWithHeaders()
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, key, "old")
+		test.AssertEqual(t, string(value), "value")
+		test.AssertEqual(t, string(hdr[goka.TooOldSourceHeader]), "input/0/0")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		),
+			goka.WithTester(tester.New(t)),
+			goka.WithMaxMessageAge(time.Hour, goka.DeadLetterTooOld("input")),
+		)
+		test.AssertNotNil(t, err)
+	})
+}
+
+func TestLatencyBudget(t *testing.T) {
+	var (
+		gkt       = tester.New(t)
+		processed []string
+		degraded  []string
+	)
+
+	callback := func(ctx goka.Context, msg interface{}) {
+		processed = append(processed, ctx.Key())
+		if goka.OverLatencyBudget(ctx) {
+			degraded = append(degraded, ctx.Key())
+		}
+	}
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), callback),
+		goka.Input("low-priority", new(codec.String), callback),
+	),
+		goka.WithTester(gkt),
+		goka.WithLatencyBudget(time.Minute, goka.ShedTopics("low-priority")),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	late := tester.WithTimestamp(time.Now().Add(-time.Hour))
+	gkt.Consume("input", "late", "value", late)
+	gkt.Consume("input", "fresh", "value", tester.WithTimestamp(time.Now()))
+	gkt.Consume("low-priority", "late-low", "value", late)
+	gkt.Consume("low-priority", "fresh-low", "value", tester.WithTimestamp(time.Now()))
+
+	test.AssertEqual(t, processed, []string{"late", "fresh", "fresh-low"})
+	test.AssertEqual(t, degraded, []string{"late"})
+
+	cancel()
+	wait()
+
+	_, err = goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), callback),
+	),
+		goka.WithTester(tester.New(t)),
+		goka.WithLatencyBudget(time.Minute, nil),
+	)
+	test.AssertNotNil(t, err)
+}
+
+func TestProcessorDebugDump(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+	)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	gkt.Consume("input", "key", "value")
+
+	var dump strings.Builder
+	test.AssertNil(t, proc.DebugDump(&dump))
+	for _, expected := range []string{
+		"Processor group",
+		"input:  input",
+		"table:  group-table",
+		"partition 0:",
+		"running (active)",
+		"table group-table:",
+		"storage *storage.memory",
+		"Stats",
+	} {
+		test.AssertStringContains(t, dump.String(), expected)
+	}
+
+	cancel()
+	wait()
+}
+
+func TestProcessorPromoteStandby(t *testing.T) {
+	newProcessor := func(gkt *tester.Tester, opts ...goka.ProcessorOption) (*goka.Processor, error) {
+		return goka.NewProcessor([]string{}, goka.DefineGroup("group",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.SetValue(msg)
+			}),
+			goka.Persist(new(codec.String)),
+		), append(opts, goka.WithTester(gkt))...)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		gkt := tester.New(t)
+		_, err := newProcessor(gkt, goka.WithStandbyPromotion(nil))
+		test.AssertNotNil(t, err)
+
+		proc, err := newProcessor(gkt)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, proc.PromoteStandby(0), goka.ErrPromotionDisabled)
+
+		proc, err = newProcessor(gkt, goka.WithHotStandby(), goka.WithStandbyPromotion(nil))
+		test.AssertNil(t, err)
+		test.AssertNotNil(t, proc.PromoteStandby(5))
+	})
+
+	t.Run("rejoin", func(t *testing.T) {
+		gkt := tester.New(t)
+		sessions := make(chan goka.Assignment, 2)
+		proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				ctx.Emit("output", ctx.Key(), msg)
+			}),
+			goka.Output("output", new(codec.String)),
+		),
+			// the promotion replaces the consumer group builder, so it has to be passed
+			// before the tester
+			goka.WithStandbyPromotion(nil),
+			goka.WithTester(gkt),
+			goka.WithHotStandby(),
+			goka.WithRebalanceCallback(func(a goka.Assignment) { sessions <- a }),
+		)
+		test.AssertNil(t, err)
+		output := gkt.NewQueueTracker("output")
+
+		cancel, wait := test.Run(t, proc.Run)
+
+		gkt.Consume("input", "a", "1")
+		_, value, _ := output.Next()
+		test.AssertEqual(t, value, "1")
+
+		// the processor rejoins the group and continues processing
+		<-sessions
+		test.AssertNil(t, proc.PromoteStandby(0))
+		<-sessions
+		gkt.Consume("input", "a", "2")
+		// the tester starts each session at the beginning of the topic, so the last
+		// message is the new one
+		var last interface{}
+		for {
+			_, value, ok := output.Next()
+			if !ok {
+				break
+			}
+			last = value
+		}
+		test.AssertEqual(t, last, "2")
+
+		cancel()
+		wait()
+	})
+}
+
+func TestShutdownReport(t *testing.T) {
+	gkt := tester.New(t)
+	reports := make(chan *goka.ShutdownReport, 1)
+	proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+		goka.WithShutdownReport(func(report *goka.ShutdownReport) { reports <- report }),
+	)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, proc.ShutdownReport() == nil)
+
+	cancel, wait := test.Run(t, proc.Run)
+
+	for _, value := range []string{"a", "b", "c"} {
+		gkt.Consume("input", "key", value)
+	}
+	cancel()
+	wait()
+
+	report := <-reports
+	test.AssertTrue(t, report == proc.ShutdownReport())
+	test.AssertEqual(t, report.Name, "group")
+	test.AssertEqual(t, len(report.Errors), 0)
+	test.AssertFalse(t, report.Stopped.Before(report.Started))
+	partition := report.Partitions[0]
+	test.AssertNotNil(t, partition)
+	test.AssertEqual(t, partition.Processed, int64(3))
+	test.AssertEqual(t, partition.LastOffsets, map[string]int64{"input": 2})
+	test.AssertEqual(t, partition.StopError, "")
+	test.AssertTrue(t, strings.Contains(report.String(), "partition 0: processed 3, last offsets [input@2]"))
+}
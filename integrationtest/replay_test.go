@@ -0,0 +1,79 @@
+package integrationtest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/recording"
+	"github.com/lovoo/goka/sink"
+	"github.com/lovoo/goka/tester"
+)
+
+func TestReplay(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	consumed := []*sink.Record{
+		{Topic: "input", Partition: 1, Offset: 0, Key: "b", Value: []byte("3"), Timestamp: start.Add(2 * time.Second)},
+		{Topic: "input", Partition: 0, Offset: 0, Key: "a", Value: []byte("1"), Timestamp: start},
+		{Topic: "input", Partition: 0, Offset: 2, Key: "c", Value: []byte("4"), Timestamp: start},
+		{Topic: "input", Partition: 0, Offset: 1, Key: "a", Value: []byte("2"), Timestamp: start.Add(time.Second), Headers: goka.Headers{"source": []byte("web")}},
+	}
+
+	// the recorder writes the export format
+	var buf bytes.Buffer
+	recorder := sink.NewRecorder(&buf)
+	test.AssertNil(t, recorder.WriteBatch(context.Background(), consumed))
+	test.AssertNotNil(t, recorder.WriteBatch(context.Background(), []*sink.Record{{Topic: "input", Key: "d", Value: "decoded"}}))
+	records, err := recording.Read(&buf)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(records), 4)
+	test.AssertEqual(t, records[3].Headers["source"], []byte("web"))
+
+	replay := func(suffix string) *tester.ReplayResult {
+		gkt := tester.New(t)
+		proc, err := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+			goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+				var sum string
+				if val := ctx.Value(); val != nil {
+					sum = val.(string)
+				}
+				sum += msg.(string)
+				ctx.SetValue(sum)
+				ctx.Emit("output", ctx.Key(), fmt.Sprintf("%s@%d%s", sum, ctx.Timestamp().Unix()-start.Unix(), suffix))
+			}),
+			goka.Output("output", new(codec.String)),
+			goka.Persist(new(codec.String)),
+		),
+			goka.WithTester(gkt),
+		)
+		test.AssertNil(t, err)
+
+		cancel, wait := test.Run(t, proc.Run)
+		defer func() {
+			cancel()
+			wait()
+		}()
+		return gkt.Replay(records, "output")
+	}
+
+	result := replay("")
+	test.AssertEqual(t, result.Tables["group-table"]["a"], []byte("12"))
+	test.AssertEqual(t, result.Tables["group-table"]["b"], []byte("3"))
+	test.AssertEqual(t, result.Tables["group-table"]["c"], []byte("4"))
+	outputs := result.Outputs["output"]
+	test.AssertEqual(t, len(outputs), 4)
+	// the partitions are merged by timestamp, but keep the order of their offsets
+	test.AssertEqual(t, string(outputs[0].Value), "1@0")
+	test.AssertEqual(t, string(outputs[1].Value), "12@1")
+	test.AssertEqual(t, string(outputs[2].Value), "4@0")
+	test.AssertEqual(t, string(outputs[3].Value), "3@2")
+
+	test.AssertEqual(t, len(result.Diff(replay(""))), 0)
+	diffs := result.Diff(replay("!"))
+	test.AssertEqual(t, len(diffs), 4)
+}
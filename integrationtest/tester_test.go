@@ -0,0 +1,72 @@
+package integrationtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+// TestTester_StoppedClients checks that processors and views that stopped while the
+// tester is still used, e.g. a processor that drained its inputs, neither block nor
+// break consuming messages for the clients still running.
+func TestTester_StoppedClients(t *testing.T) {
+	gkt := tester.New(t)
+
+	var counted int
+	counter, err := goka.NewProcessor([]string{}, goka.DefineGroup("counter",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			counted++
+		}),
+	),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+	stopped, err := goka.NewProcessor([]string{}, goka.DefineGroup("stopped",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+	)
+	test.AssertNil(t, err)
+	view, err := goka.NewView(nil, goka.GroupTable("stopped"), new(codec.String), goka.WithViewTester(gkt))
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	counterDone := make(chan error, 1)
+	go func() { counterDone <- counter.Run(ctx) }()
+
+	stoppedCtx, stop := context.WithCancel(ctx)
+	stoppedDone := make(chan error, 2)
+	go func() { stoppedDone <- stopped.Run(stoppedCtx) }()
+	go func() { stoppedDone <- view.Run(stoppedCtx) }()
+
+	gkt.Consume("input", "key", "value")
+	test.AssertEqual(t, counted, 1)
+
+	stop()
+	for i := 0; i < 2; i++ {
+		test.AssertNil(t, <-stoppedDone)
+	}
+
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		gkt.Consume("input", "key", "value")
+		gkt.Catchup()
+	}()
+	select {
+	case <-consumed:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("consuming blocked on the stopped processor and view")
+	}
+	test.AssertEqual(t, counted, 2)
+
+	cancel()
+	test.AssertNil(t, <-counterDone)
+}
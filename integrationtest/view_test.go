@@ -2,7 +2,9 @@ package integrationtest
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/lovoo/goka"
 	"github.com/lovoo/goka/codec"
@@ -64,4 +66,300 @@ func TestView(t *testing.T) {
 		<-done
 	})
 
+	t.Run("get_as_of", func(t *testing.T) {
+		gkt := tester.New(t)
+
+		view, err := goka.NewView(nil, "test", new(codec.String),
+			goka.WithViewTester(gkt),
+			goka.WithViewVersions(10, 0),
+		)
+		test.AssertNil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := view.Run(ctx); err != nil {
+				panic(err)
+			}
+		}()
+
+		// versions are built from consumed messages, so we cannot use SetTableValue here
+		gkt.Consume("test", "key", "old")
+		time.Sleep(10 * time.Millisecond)
+		between := time.Now()
+		time.Sleep(10 * time.Millisecond)
+		gkt.Consume("test", "key", "new")
+
+		val, err := view.GetAsOf("key", between)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, val.(string), "old")
+
+		val, err = view.GetAsOf("key", time.Now())
+		test.AssertNil(t, err)
+		test.AssertEqual(t, val.(string), "new")
+
+		_, err = view.GetAsOf("key", between.Add(-time.Hour))
+		test.AssertTrue(t, errors.Is(err, goka.ErrVersionNotRetained))
+
+		cancel()
+		<-done
+	})
+}
+
+func TestView_WaitRecovered(t *testing.T) {
+	gkt := tester.New(t)
+
+	reports := make(chan *goka.ShutdownReport, 1)
+	view, err := goka.NewView(nil, "test", new(codec.String),
+		goka.WithViewTester(gkt),
+		goka.WithViewShutdownReport(func(report *goka.ShutdownReport) { reports <- report }),
+	)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, view.ShutdownReport() == nil)
+
+	cancel, wait := test.Run(t, view.Run)
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer waitCancel()
+	test.AssertNil(t, view.WaitRecovered(waitCtx))
+	test.AssertTrue(t, view.Recovered())
+
+	cancel()
+	wait()
+
+	// the view stopped, so it won't recover anymore
+	test.AssertNotNil(t, view.WaitRecovered(context.Background()))
+
+	report := <-reports
+	test.AssertTrue(t, report == view.ShutdownReport())
+	test.AssertEqual(t, report.Name, "test")
+	test.AssertEqual(t, len(report.Errors), 0)
+	test.AssertNotNil(t, report.Partitions[0])
+}
+
+func TestView_GetAtLeast(t *testing.T) {
+	var (
+		gkt    = tester.New(t)
+		tokens = make(chan goka.ConsistencyToken, 1)
+	)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg, goka.WithCtxConsistencyToken(func(token goka.ConsistencyToken) {
+				tokens <- token
+			}))
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+	)
+	view, err := goka.NewView(nil, goka.GroupTable("group"), new(codec.String), goka.WithViewTester(gkt))
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run, view.Run)
+
+	gkt.Consume("input", "key", "value")
+	token := <-tokens
+
+	val, err := view.GetAtLeast("key", token, 10*time.Second)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, val, "value")
+
+	token.Offset++
+	_, err = view.GetAtLeast("key", token, 10*time.Millisecond)
+	test.AssertTrue(t, errors.Is(err, goka.ErrConsistencyTimeout))
+
+	token.Partition++
+	_, err = view.GetAtLeast("key", token, 10*time.Millisecond)
+	test.AssertNotNil(t, err)
+
+	cancel()
+	wait()
+}
+
+func TestView_GetManyConsistent(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+	)
+	view, err := goka.NewView(nil, goka.GroupTable("group"), new(codec.String), goka.WithViewTester(gkt))
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run, view.Run)
+
+	gkt.Consume("input", "a", "1")
+	gkt.Consume("input", "b", "2")
+
+	values, err := view.GetManyConsistent([]string{"a", "b", "c"}, 10*time.Second)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, values.Values, map[string]interface{}{"a": "1", "b": "2", "c": nil})
+	test.AssertEqual(t, values.Offsets, map[int32]int64{0: 1})
+
+	cancel()
+	wait()
+}
+
+func TestView_IteratorSince(t *testing.T) {
+	gkt := tester.New(t)
+
+	proc, _ := goka.NewProcessor([]string{}, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {
+			ctx.SetValue(msg)
+		}),
+		goka.Persist(new(codec.String)),
+	),
+		goka.WithTester(gkt),
+	)
+	view, err := goka.NewView(nil, goka.GroupTable("group"), new(codec.String),
+		goka.WithViewTester(gkt),
+		goka.WithViewRecordMetadata(),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, proc.Run, view.Run)
+
+	// iterate returns the values and offsets of the iterator by key
+	iterate := func(since map[int32]int64) (map[string]interface{}, map[string]int64) {
+		iter, err := view.IteratorSince(since)
+		test.AssertNil(t, err)
+		defer iter.Release()
+		values := make(map[string]interface{})
+		offsets := make(map[string]int64)
+		for iter.Next() {
+			value, err := iter.Value()
+			test.AssertNil(t, err)
+			values[iter.Key()] = value
+			rit, ok := iter.(goka.RecordIterator)
+			test.AssertTrue(t, ok)
+			offsets[iter.Key()] = rit.Offset()
+			test.AssertEqual(t, rit.Partition(), int32(0))
+			test.AssertFalse(t, rit.Timestamp().IsZero())
+		}
+		test.AssertNil(t, iter.Err())
+		return values, offsets
+	}
+
+	gkt.Consume("input", "a", "1")
+	gkt.Consume("input", "b", "2")
+	_, err = view.GetManyConsistent([]string{"a", "b"}, 10*time.Second)
+	test.AssertNil(t, err)
+
+	values, offsets := iterate(nil)
+	test.AssertEqual(t, values, map[string]interface{}{"a": "1", "b": "2"})
+	test.AssertEqual(t, offsets, map[string]int64{"a": 0, "b": 1})
+
+	values, _ = iterate(map[int32]int64{0: 1})
+	test.AssertEqual(t, values, map[string]interface{}{"b": "2"})
+
+	gkt.Consume("input", "a", "3")
+	_, err = view.GetManyConsistent([]string{"a"}, 10*time.Second)
+	test.AssertNil(t, err)
+
+	values, offsets = iterate(map[int32]int64{0: 2})
+	test.AssertEqual(t, values, map[string]interface{}{"a": "3"})
+	test.AssertEqual(t, offsets, map[string]int64{"a": 2})
+
+	cancel()
+	wait()
+}
+
+func TestView_Changes(t *testing.T) {
+	gkt := tester.New(t)
+
+	// the table topic is written directly, as the tester shares the storage of a
+	// processor's table with its views
+	table := goka.GroupTable("group")
+	view, err := goka.NewView(nil, table, new(codec.String), goka.WithViewTester(gkt))
+	test.AssertNil(t, err)
+
+	obs := view.Changes()
+	defer obs.Stop()
+
+	cancel, wait := test.Run(t, view.Run)
+	test.AssertNil(t, view.WaitRecovered(context.Background()))
+
+	next := func() *goka.ChangeEvent {
+		select {
+		case event := <-obs.C():
+			return event
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for change")
+		}
+		return nil
+	}
+
+	gkt.Consume(string(table), "a", "1")
+	event := next()
+	test.AssertEqual(t, event.Key, "a")
+	test.AssertTrue(t, event.OldValue == nil)
+	test.AssertEqual(t, event.Value, "1")
+	test.AssertEqual(t, event.Offset, int64(0))
+
+	gkt.Consume(string(table), "a", "2")
+	event = next()
+	test.AssertEqual(t, event.OldValue, "1")
+	test.AssertEqual(t, event.Value, "2")
+	test.AssertEqual(t, event.Offset, int64(1))
+
+	gkt.Consume(string(table), "a", nil)
+	event = next()
+	test.AssertEqual(t, event.OldValue, "2")
+	test.AssertTrue(t, event.Value == nil)
+
+	obs.Stop()
+	_, ok := <-obs.C()
+	test.AssertFalse(t, ok)
+
+	// the view does not block on stopped observers
+	gkt.Consume(string(table), "b", "3")
+	_, err = view.GetManyConsistent([]string{"b"}, 10*time.Second)
+	test.AssertNil(t, err)
+
+	cancel()
+	wait()
+}
+
+func TestView_IterateRange(t *testing.T) {
+	gkt := tester.New(t)
+
+	view, err := goka.NewView(nil, "test", new(codec.String), goka.WithViewTester(gkt))
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, view.Run)
+	test.AssertNil(t, view.WaitRecovered(context.Background()))
+
+	for _, key := range []string{"tenant-a/1", "tenant-a/2", "tenant-b/1", "tenant-c/1"} {
+		gkt.SetTableValue("test", key, key)
+	}
+
+	keys := func(iter goka.Iterator, err error) []string {
+		test.AssertNil(t, err)
+		defer iter.Release()
+		var keys []string
+		for iter.Next() {
+			value, err := iter.Value()
+			test.AssertNil(t, err)
+			test.AssertEqual(t, value, iter.Key())
+			keys = append(keys, iter.Key())
+		}
+		test.AssertNil(t, iter.Err())
+		return keys
+	}
+
+	test.AssertEqual(t, keys(view.IteratePrefix("tenant-a/")), []string{"tenant-a/1", "tenant-a/2"})
+	test.AssertEqual(t, keys(view.IterateRange("tenant-a/2", "tenant-c/")), []string{"tenant-a/2", "tenant-b/1"})
+	test.AssertTrue(t, keys(view.IteratePrefix("tenant-d/")) == nil)
+
+	_, err = view.IterateRange("tenant-a/", "")
+	test.AssertNotNil(t, err)
+
+	cancel()
+	wait()
 }
@@ -0,0 +1,28 @@
+package test
+
+import (
+	"context"
+	"sync"
+)
+
+type Errorer interface {
+	Errorf(string, ...interface{})
+}
+
+// Run starts each of runs in its own goroutine with a shared context. cancel
+// cancels the context and wait blocks until all runs returned. The test fails
+// if any of them returns an error.
+func Run(t Errorer, runs ...func(ctx context.Context) error) (cancel func(), wait func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run func(ctx context.Context) error) {
+			defer wg.Done()
+			if err := run(ctx); err != nil {
+				t.Errorf("error running: %v", err)
+			}
+		}(run)
+	}
+	return cancel, wg.Wait
+}
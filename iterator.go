@@ -1,6 +1,8 @@
 package goka
 
 import (
+	"time"
+
 	"github.com/lovoo/goka/storage"
 )
 
@@ -27,14 +29,93 @@ type Iterator interface {
 	Seek(key string) bool
 }
 
+// RecordIterator is implemented by the iterators returned by views. It exposes the
+// message in the table topic that set the current value and can be accessed with a
+// type assertion on the Iterator.
+type RecordIterator interface {
+	Iterator
+	// Partition returns the partition of the current item
+	Partition() int32
+	// Offset returns the offset of the message in the table topic that set the
+	// current value. It returns -1 if it is not known (see WithViewRecordMetadata).
+	Offset() int64
+	// Timestamp returns the timestamp of the message in the table topic that set
+	// the current value. It returns the zero time if it is not known.
+	Timestamp() time.Time
+}
+
 type iterator struct {
 	iter  storage.Iterator
 	codec Codec
+	view  *View
+
+	// since holds the offsets per partition from which the items are returned,
+	// nil returns all items
+	since map[int32]int64
 }
 
 // Next advances the iterator to the next key.
 func (i *iterator) Next() bool {
-	return i.iter.Next()
+	for i.iter.Next() {
+		if i.selected() {
+			return true
+		}
+	}
+	return false
+}
+
+// selected returns whether the current item is at or after the since-offset of
+// its partition. Items with unknown offset are always selected.
+func (i *iterator) selected() bool {
+	if i.since == nil {
+		return true
+	}
+	since, ok := i.since[i.Partition()]
+	if !ok {
+		return true
+	}
+	offset := i.Offset()
+	return offset < 0 || offset >= since
+}
+
+// meta returns the metadata of the current item
+func (i *iterator) meta() (recordMeta, bool) {
+	if i.view == nil {
+		return recordMeta{}, false
+	}
+	key := i.Key()
+	pt, err := i.view.find(key)
+	if err != nil || pt.meta == nil {
+		return recordMeta{}, false
+	}
+	return pt.meta.get(key)
+}
+
+// Partition returns the partition of the current item.
+func (i *iterator) Partition() int32 {
+	if i.view == nil {
+		return -1
+	}
+	partition, err := i.view.PartitionFor(i.Key())
+	if err != nil {
+		return -1
+	}
+	return partition
+}
+
+// Offset returns the table topic offset of the current item or -1 if unknown.
+func (i *iterator) Offset() int64 {
+	meta, ok := i.meta()
+	if !ok {
+		return -1
+	}
+	return meta.offset
+}
+
+// Timestamp returns the timestamp of the current item or the zero time if unknown.
+func (i *iterator) Timestamp() time.Time {
+	meta, _ := i.meta()
+	return meta.ts
 }
 
 // Key returns the current key.
@@ -64,5 +145,8 @@ func (i *iterator) Release() {
 }
 
 func (i *iterator) Seek(key string) bool {
-	return i.iter.Seek([]byte(key))
+	if !i.iter.Seek([]byte(key)) {
+		return false
+	}
+	return i.selected() || i.Next()
 }
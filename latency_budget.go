@@ -0,0 +1,79 @@
+package goka
+
+import (
+	"context"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ShedAction is the decision of a SheddingPolicy for a message over the latency budget.
+type ShedAction int
+
+const (
+	// ShedProcess processes the message. The callback can check OverLatencyBudget
+	// to switch to degraded logic.
+	ShedProcess ShedAction = iota
+	// ShedSkip skips the message without processing it.
+	ShedSkip
+)
+
+// SheddingPolicy decides how to handle an input message whose latency, i.e. the time
+// since the message was produced, exceeds the latency budget, see WithLatencyBudget.
+type SheddingPolicy func(topic Stream, key string, latency time.Duration) ShedAction
+
+// DegradeOverBudget processes all messages over the latency budget, leaving it to the
+// callbacks to switch to degraded logic, see OverLatencyBudget.
+func DegradeOverBudget() SheddingPolicy {
+	return func(topic Stream, key string, latency time.Duration) ShedAction {
+		return ShedProcess
+	}
+}
+
+// ShedTopics skips the messages of the low-priority topics over the latency budget
+// and processes the messages of all other topics.
+func ShedTopics(topics ...Stream) SheddingPolicy {
+	shed := make(map[Stream]bool, len(topics))
+	for _, topic := range topics {
+		shed[topic] = true
+	}
+	return func(topic Stream, key string, latency time.Duration) ShedAction {
+		if shed[topic] {
+			return ShedSkip
+		}
+		return ShedProcess
+	}
+}
+
+// OverLatencyBudget returns whether the time since the message of the context was produced
+// exceeds the latency budget of the processor, e.g. to switch to degraded logic while
+// working through a backlog. It returns false for contexts not created by a processor
+// with WithLatencyBudget.
+func OverLatencyBudget(ctx Context) bool {
+	budgeted, ok := ctx.(interface{ overLatencyBudget() bool })
+	return ok && budgeted.overLatencyBudget()
+}
+
+// overLatencyBudget returns whether the latency of the message of an input stream exceeds
+// the latency budget. Loop topics are not checked, as delayed loopbacks are late by design.
+func (pp *PartitionProcessor) overLatencyBudget(msg *sarama.ConsumerMessage) bool {
+	if pp.opts.latencyBudget <= 0 || msg.Timestamp.IsZero() || pp.graph.isLoopTopic(msg.Topic) {
+		return false
+	}
+	return time.Since(msg.Timestamp) > pp.opts.latencyBudget
+}
+
+// shed asks the shedding policy how to handle a message over the latency budget and
+// commits the message if it is skipped. It returns whether the message was skipped.
+func (pp *PartitionProcessor) shed(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	if pp.opts.sheddingPolicy(Stream(msg.Topic), string(msg.Key), time.Since(msg.Timestamp)) != ShedSkip {
+		return false
+	}
+	pp.enqueueStatsUpdate(ctx, func() {
+		if ip := pp.stats.Input[msg.Topic]; ip != nil {
+			ip.Shed++
+		}
+	})
+	pp.commit(msg, pp.commitMeta)
+	return true
+}
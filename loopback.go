@@ -0,0 +1,85 @@
+package goka
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const (
+	// LoopbackHopsHeader is the header counting how many times a message has been
+	// looped back, see Context.Loopback and LoopbackHops
+	LoopbackHopsHeader = "goka-loop-hops"
+	// LoopbackDeliverAtHeader is the header containing the time in milliseconds since
+	// epoch before which a message of the loop topic is not processed, see LoopbackAfter
+	LoopbackDeliverAtHeader = "goka-loop-deliver-at"
+)
+
+// LoopbackHops returns the number of times the message with the passed headers has
+// been looped back. Messages of input topics other than loop topics have 0 hops.
+// Use it in the loop callback to stop retrying after a number of attempts, e.g.
+//
+//	if goka.LoopbackHops(ctx.Headers()) >= 5 {
+//		ctx.Emit(deadLetters, ctx.Key(), msg)
+//		return
+//	}
+//	goka.LoopbackAfter(ctx, ctx.Key(), msg, time.Minute)
+func LoopbackHops(hdr Headers) int {
+	hops, err := strconv.Atoi(string(hdr[LoopbackHopsHeader]))
+	if err != nil || hops < 0 {
+		return 0
+	}
+	return hops
+}
+
+// loopbackHeaders returns the headers of a message looped back with the passed
+// number of hops, to be delivered after delay
+func loopbackHeaders(hops int, delay time.Duration, now time.Time) Headers {
+	hdr := Headers{
+		LoopbackHopsHeader: []byte(strconv.Itoa(hops)),
+	}
+	if delay > 0 {
+		// round up, so the message is never delivered before the delay passed
+		deliverAt := (now.Add(delay).UnixNano() + int64(time.Millisecond) - 1) / int64(time.Millisecond)
+		hdr[LoopbackDeliverAtHeader] = []byte(strconv.FormatInt(deliverAt, 10))
+	}
+	return hdr
+}
+
+// loopbackWait returns how long the message has to wait until it may be delivered.
+// It returns 0 for messages without or with an invalid delivery time.
+func loopbackWait(msg *sarama.ConsumerMessage, now time.Time) time.Duration {
+	for _, hdr := range msg.Headers {
+		if hdr == nil || string(hdr.Key) != LoopbackDeliverAtHeader {
+			continue
+		}
+		deliverAt, err := strconv.ParseInt(string(hdr.Value), 10, 64)
+		if err != nil {
+			return 0
+		}
+		if wait := time.Unix(0, deliverAt*int64(time.Millisecond)).Sub(now); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return 0
+}
+
+// waitLoopbackDelivery blocks until the message may be delivered. It returns false
+// if ctx is done before.
+func waitLoopbackDelivery(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	wait := loopbackWait(msg, time.Now())
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/headers"
+)
+
+// TooOldSourceHeader is the header containing the topic, partition and offset
+// (<topic>/<partition>/<offset>) of a message forwarded to a dead letter topic for
+// being too old, see DeadLetterTooOld.
+const TooOldSourceHeader = "goka-too-old-source"
+
+// MessageAgePolicy defines what happens to input messages that are too old, see
+// WithMaxMessageAge.
+type MessageAgePolicy struct {
+	deadLetterTopic string
+}
+
+// SkipTooOld skips input messages that are too old without processing them.
+func SkipTooOld() MessageAgePolicy {
+	return MessageAgePolicy{}
+}
+
+// DeadLetterTooOld forwards input messages that are too old unchanged to the topic
+// instead of processing them, e.g. to process them later or to inspect them.
+// The message keeps its key, value and headers, the header TooOldSourceHeader is added.
+// The topic must exist.
+func DeadLetterTooOld(topic Stream) MessageAgePolicy {
+	return MessageAgePolicy{deadLetterTopic: string(topic)}
+}
+
+// isTooOld returns whether the message of an input stream is older than the maximum age.
+// Loop topics are not checked, as delayed loopbacks are old by design.
+func (pp *PartitionProcessor) isTooOld(msg *sarama.ConsumerMessage) bool {
+	if pp.opts.maxMessageAge <= 0 || msg.Timestamp.IsZero() || pp.graph.isLoopTopic(msg.Topic) {
+		return false
+	}
+	return time.Since(msg.Timestamp) > pp.opts.maxMessageAge
+}
+
+// handleTooOld skips or forwards a message that is too old according to the message
+// age policy and commits it.
+func (pp *PartitionProcessor) handleTooOld(ctx context.Context, wg *sync.WaitGroup, msg *sarama.ConsumerMessage, asyncFailer func(err error)) {
+	pp.enqueueStatsUpdate(ctx, func() {
+		if ip := pp.stats.Input[msg.Topic]; ip != nil {
+			ip.TooOld++
+		}
+	})
+
+	topic := pp.opts.messageAgePolicy.deadLetterTopic
+	if topic == "" {
+		pp.commit(msg, pp.commitMeta)
+		return
+	}
+
+	hdr := headers.FromSarama(msg.Headers).Merged(Headers{
+		TooOldSourceHeader: []byte(fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)),
+	})
+	wg.Add(1)
+	pp.producer.EmitWithHeaders(topic, string(msg.Key), msg.Value, hdr).Then(func(err error) {
+		defer wg.Done()
+		if err != nil {
+			asyncFailer(fmt.Errorf("error forwarding too old message for key %s from %s/%d to %s: %v", string(msg.Key), msg.Topic, msg.Partition, topic, err))
+			return
+		}
+		pp.commit(msg, pp.commitMeta)
+	})
+}
@@ -0,0 +1,125 @@
+package goka
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// offsetIndexSuffix is appended to the table topic to build the storage of its offset index
+const offsetIndexSuffix = ".offset-index"
+
+// offsetIndex maps the keys of a partition table to the offset of their latest message
+// in the table topic. It is stored in its own storage next to the table's storage and
+// updated with every recovered message and every write of a processor.
+type offsetIndex struct {
+	// the batch of the sidecar collects the entries until the offset of their messages
+	// is stored
+	sidecar
+	// complete is false if the index misses messages of the table, e.g. because the
+	// index was enabled for an existing storage
+	complete bool
+}
+
+func newOffsetIndex(builder storage.Builder) *offsetIndex {
+	return &offsetIndex{
+		sidecar:  newSidecar(builder, offsetIndexSuffix, "offset index"),
+		complete: true,
+	}
+}
+
+// check marks the index incomplete if its offset differs from the stored offset of the table.
+func (oi *offsetIndex) check(tableOffset int64) error {
+	oi.m.Lock()
+	defer oi.m.Unlock()
+	offset, err := oi.st.GetOffset(offsetNotStored)
+	if err != nil {
+		return fmt.Errorf("error reading offset of offset index: %v", err)
+	}
+	if offset != tableOffset {
+		oi.complete = false
+	}
+	return nil
+}
+
+// add adds the offset of a message of the key, which is a deletion if value is nil.
+func (oi *offsetIndex) add(key string, offset int64, value []byte) {
+	oi.m.Lock()
+	defer oi.m.Unlock()
+	if value == nil {
+		oi.batch.Delete(key)
+		return
+	}
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(offset))
+	oi.batch.Set(key, data[:])
+}
+
+// flush writes the added entries and stores the offset of their last message.
+func (oi *offsetIndex) flush(offset int64) error {
+	oi.m.Lock()
+	defer oi.m.Unlock()
+	if err := oi.writeBatch(); err != nil {
+		return err
+	}
+	stored, err := oi.st.GetOffset(offsetNotStored)
+	if err != nil {
+		return fmt.Errorf("error reading offset of offset index: %v", err)
+	}
+	if offset > stored {
+		return oi.st.SetOffset(offset)
+	}
+	return nil
+}
+
+// get returns the offset of the latest message of the key and whether the index
+// contains the key.
+func (oi *offsetIndex) get(key string) (int64, bool, error) {
+	oi.m.Lock()
+	defer oi.m.Unlock()
+	if oi.st == nil {
+		return 0, false, nil
+	}
+	data, err := oi.st.Get(key)
+	if err != nil || data == nil {
+		return 0, false, err
+	}
+	if len(data) != 8 {
+		return 0, false, fmt.Errorf("invalid offset index entry of key %s: %w", key, storage.ErrCorrupted)
+	}
+	return int64(binary.BigEndian.Uint64(data)), true, nil
+}
+
+// isComplete returns whether the index contains all keys of the table.
+func (oi *offsetIndex) isComplete() bool {
+	oi.m.Lock()
+	defer oi.m.Unlock()
+	return oi.complete
+}
+
+// KeyOffset returns the offset of the latest message of the key in the table topic and
+// whether it is known. It requires the offset index (see WithViewOffsetIndex and
+// WithTableOffsetIndex), the offset is not known for keys missing in the index.
+func (p *PartitionTable) KeyOffset(key string) (int64, bool, error) {
+	if p.index == nil {
+		return 0, false, fmt.Errorf("table %s has no offset index", p.topic)
+	}
+	return p.index.get(key)
+}
+
+// configureOffsetIndex makes the table maintain an offset index in a storage built by
+// the table's storage builder.
+func (p *PartitionTable) configureOffsetIndex() {
+	p.index = newOffsetIndex(p.builder)
+}
+
+// indexWrite adds a write of the processor to the offset index, if enabled. Writes of
+// read-only processors are not indexed, as they are not emitted to the table topic.
+func (p *PartitionTable) indexWrite(key string, offset int64, value []byte) error {
+	if p.index == nil || p.overlay != nil {
+		return nil
+	}
+	p.index.add(key, offset, value)
+	return p.index.flush(offset)
+}
@@ -0,0 +1,152 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func newTestOffsetIndex(t *testing.T) (*offsetIndex, storage.Storage) {
+	st := storage.NewMemory()
+	oi := newOffsetIndex(func(topic string, partition int32) (storage.Storage, error) {
+		test.AssertEqual(t, topic, "table"+offsetIndexSuffix)
+		return st, nil
+	})
+	test.AssertNil(t, oi.open("table", 0))
+	return oi, st
+}
+
+func TestOffsetIndex(t *testing.T) {
+	t.Run("add", func(t *testing.T) {
+		oi, st := newTestOffsetIndex(t)
+		defer oi.close()
+
+		oi.add("a", 1, []byte("1"))
+		oi.add("b", 2, []byte("2"))
+		oi.add("a", 3, []byte("3"))
+
+		// entries are not visible before they are flushed
+		_, ok, err := oi.get("a")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, ok)
+
+		test.AssertNil(t, oi.flush(3))
+		offset, ok, err := oi.get("a")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, offset, int64(3))
+		offset, ok, err = oi.get("b")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, offset, int64(2))
+
+		stored, err := st.GetOffset(offsetNotStored)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, stored, int64(3))
+
+		// deletes remove the key and do not lower the offset
+		oi.add("b", offsetNotStored, nil)
+		test.AssertNil(t, oi.flush(offsetNotStored))
+		_, ok, err = oi.get("b")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, ok)
+		stored, err = st.GetOffset(offsetNotStored)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, stored, int64(3))
+	})
+
+	t.Run("check", func(t *testing.T) {
+		oi, _ := newTestOffsetIndex(t)
+		defer oi.close()
+
+		test.AssertNil(t, oi.check(offsetNotStored))
+		test.AssertTrue(t, oi.isComplete())
+
+		// an index behind the table misses keys
+		test.AssertNil(t, oi.check(10))
+		test.AssertFalse(t, oi.isComplete())
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		oi, st := newTestOffsetIndex(t)
+		defer oi.close()
+
+		test.AssertNil(t, st.Set("a", []byte("x")))
+		_, _, err := oi.get("a")
+		test.AssertNotNil(t, err)
+	})
+
+	t.Run("table", func(t *testing.T) {
+		pt := &PartitionTable{
+			topic: "table",
+			st:    &storageProxy{Storage: storage.NewMemory(), update: DefaultUpdate},
+		}
+		_, _, err := pt.KeyOffset("a")
+		test.AssertNotNil(t, err)
+
+		pt.index, _ = newTestOffsetIndex(t)
+		defer pt.index.close()
+
+		test.AssertNil(t, pt.storeEvent("a", []byte("1"), 5, nil, time.Time{}))
+		offset, ok, err := pt.KeyOffset("a")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, offset, int64(5))
+
+		test.AssertNil(t, pt.indexWrite("a", 7, []byte("2")))
+		offset, _, err = pt.KeyOffset("a")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(7))
+
+		// tombstones remove the key
+		test.AssertNil(t, pt.storeEvent("a", nil, 8, nil, time.Time{}))
+		_, ok, err = pt.KeyOffset("a")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, ok)
+	})
+}
+
+func TestReadThrough_fetchIndexed(t *testing.T) {
+	var (
+		ctrl     = gomock.NewController(t)
+		tmgr     = NewMockTopicManager(ctrl)
+		consumer = NewMockAutoConsumer(t, nil)
+		topic    = "table"
+		rt       = newReadThrough(topic, 10*time.Second, tmgr, func() (sarama.Consumer, error) {
+			return consumer, nil
+		})
+		oi, _ = newTestOffsetIndex(t)
+	)
+	defer ctrl.Finish()
+	defer oi.close()
+
+	oi.add("key", 2, []byte("c"))
+	test.AssertNil(t, oi.flush(2))
+
+	// indexed keys are read at their offset
+	pc := consumer.ExpectConsumePartition(topic, 0, 2)
+	pc.highWaterMarkOffset = 2
+	pc.YieldMessage(&sarama.ConsumerMessage{Key: []byte("key"), Value: []byte("c")})
+	value, err := rt.fetch(0, "key", oi)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "c")
+
+	// keys missing in a complete index are not fetched
+	value, err = rt.fetch(0, "other", oi)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+
+	// outdated entries fall back to scanning the partition, which is empty here
+	pc = consumer.ExpectConsumePartition(topic, 1, 2)
+	pc.highWaterMarkOffset = 2
+	pc.YieldMessage(&sarama.ConsumerMessage{Key: []byte("other"), Value: []byte("x")})
+	tmgr.EXPECT().GetOffset(topic, int32(1), sarama.OffsetOldest).Return(int64(3), nil)
+	tmgr.EXPECT().GetOffset(topic, int32(1), sarama.OffsetNewest).Return(int64(3), nil)
+	value, err = rt.fetch(1, "key", oi)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+}
@@ -1,11 +1,14 @@
 package goka
 
 import (
+	"crypto/tls"
 	"fmt"
 	"hash"
 	"hash/fnv"
 	"log"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -40,6 +43,15 @@ type UpdateContext interface {
 	Headers() Headers
 }
 
+// TimestampedUpdateContext is implemented by update contexts that pass the timestamp of
+// the message, like the DefaultUpdateContext passed to the UpdateCallback.
+type TimestampedUpdateContext interface {
+	UpdateContext
+
+	// Timestamp returns the timestamp of the message.
+	Timestamp() time.Time
+}
+
 // UpdateCallback is invoked upon arrival of a message for a table partition.
 // The partition storage in the context shall be updated in the callback.
 type UpdateCallback func(ctx UpdateContext) error
@@ -47,6 +59,17 @@ type UpdateCallback func(ctx UpdateContext) error
 // RebalanceCallback is invoked when the processor receives a new partition assignment.
 type RebalanceCallback func(a Assignment)
 
+// PartitionSetupCallback is invoked when a partition was assigned to the processor and
+// its group table and joined tables are recovered, right before the partition starts
+// processing messages. The table is nil for stateless processors.
+// Returning an error shuts down the processor.
+type PartitionSetupCallback func(partition int32, table *PartitionTable) error
+
+// PartitionTeardownCallback is invoked after a partition set up with a
+// PartitionSetupCallback stopped processing messages, e.g. when it is revoked
+// in a rebalance or the processor shuts down.
+type PartitionTeardownCallback func(partition int32)
+
 ///////////////////////////////////////////////////////////////////////////////
 // default values
 ///////////////////////////////////////////////////////////////////////////////
@@ -78,6 +101,12 @@ func DefaultUpdate(ctx UpdateContext) error {
 		return ctx.Storage().Delete(ctx.Key())
 	}
 
+	// keep the timestamp for storages expiring values, see WithTableRetention
+	if st, ok := ctx.Storage().(storage.TimestampSetter); ok {
+		if tctx, ok := ctx.(TimestampedUpdateContext); ok {
+			return st.SetAt(ctx.Key(), ctx.Value(), tctx.Timestamp())
+		}
+	}
 	return ctx.Storage().Set(ctx.Key(), ctx.Value())
 }
 
@@ -106,6 +135,7 @@ type DefaultUpdateContext struct {
 	value         []byte
 	headers       Headers
 	saramaHeaders []*sarama.RecordHeader
+	timestamp     time.Time
 }
 
 // Storage returns the storage that should be updated with the input message.
@@ -149,6 +179,11 @@ func (ctx DefaultUpdateContext) Headers() Headers {
 	return ctx.headers
 }
 
+// Timestamp returns the timestamp of the input message.
+func (ctx DefaultUpdateContext) Timestamp() time.Time {
+	return ctx.timestamp
+}
+
 ///////////////////////////////////////////////////////////////////////////////
 // processor options
 ///////////////////////////////////////////////////////////////////////////////
@@ -158,11 +193,16 @@ type ProcessorOption func(*poptions, *GroupGraph)
 
 // processor options
 type poptions struct {
-	log      logger
-	clientID string
+	log             logger
+	clientID        string
+	consumerGroupID string
+	instanceID      string
+	instanceVersion string
 
 	updateCallback         UpdateCallback
 	rebalanceCallback      RebalanceCallback
+	partitionSetup         PartitionSetupCallback
+	partitionTeardown      PartitionTeardownCallback
 	partitionChannelSize   int
 	hasher                 func() hash.Hash32
 	nilHandling            NilHandling
@@ -170,6 +210,64 @@ type poptions struct {
 	hotStandby             bool
 	recoverAhead           bool
 	producerDefaultHeaders Headers
+	provenanceHeaders      bool
+	forwardedHeaders       []string
+	auditTopic             Stream
+	replyTopics            []string
+	maxProcessingRate      float64
+	topicProcessingRates   map[string]float64
+	inputPriorities        map[string]int
+	inputQuotas            map[string]float64
+	outboxRetryInterval    time.Duration
+	tableGCInterval        time.Duration
+	tableGCPredicate       TableGCPredicate
+	inputSamplers          []inputSampler
+	hotKeyCapacity         int
+	hotKeyMinShare         float64
+	hotKeyCallback         HotKeyCallback
+	outputValidators       map[string][]OutputValidator
+	lookupMaxStaleness     time.Duration
+	lookupWarmupTimeout    time.Duration
+	maxLookupLag           int64
+	statsInterval          time.Duration
+	statsDisabled          bool
+	compactionSchedule     CompactionSchedule
+	partitionCheckInterval time.Duration
+	partitionCountPolicy   PartitionCountPolicy
+	groupConfig            *sarama.Config
+	promotionConfig        *sarama.Config
+	partitionPins          map[string][]int32
+	maxMessageAge          time.Duration
+	messageAgePolicy       MessageAgePolicy
+	latencyBudget          time.Duration
+	sheddingPolicy         SheddingPolicy
+	removeStorage          storage.Remover
+	storageConcurrency     int
+	storageLimiter         storageLimiter
+	saramaConfig           configModifiers
+	consumerConfig         configModifiers
+	producerConfig         configModifiers
+	tableRetention         time.Duration
+	tableVersion           int
+	tableMigration         storage.Migration
+	tableMigrations        map[string]tableMigration
+	tableOffsetIndex       bool
+	tableTTLInterval       time.Duration
+	maxLoopbackHops        int
+	drain                  bool
+	preflight              bool
+	preflightPrincipal     string
+	noTopicCreation        bool
+	startTime              time.Time
+	backfillOutputs        bool
+	backfillEmit           ReadOnlyEmitCallback
+	readOnly               bool
+	readOnlyEmit           ReadOnlyEmitCallback
+	shutdownReport         func(report *ShutdownReport)
+	expvarName             string
+	topicPrefix            string
+	tester                 Tester
+	recoveryHook           func(partition int32, offset, hwm int64)
 
 	builders struct {
 		storage        storage.Builder
@@ -181,6 +279,19 @@ type poptions struct {
 	}
 }
 
+// WithRecoveryHook calls the hook with the progress of recovering the partitions of
+// the group table, i.e. the last recovered offset and the high watermark the partition
+// is recovered to. It is called at most once per second and partition while
+// recovering, and once the partition is recovered with offset hwm-1. The hook is
+// called by the recovering goroutine, so it must not block.
+// Use Processor.RecoveryStats for the progress of joined and lookup tables, and for
+// the rate and estimated remaining time of the recoveries.
+func WithRecoveryHook(hook func(partition int32, offset, hwm int64)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.recoveryHook = hook
+	}
+}
+
 // WithUpdateCallback defines the callback called upon recovering a message
 // from the log.
 func WithUpdateCallback(cb UpdateCallback) ProcessorOption {
@@ -196,6 +307,49 @@ func WithClientID(clientID string) ProcessorOption {
 	}
 }
 
+// WithConsumerGroupID overrides the ID of the Kafka consumer group, which defaults
+// to the name of the group. The group name still names the group table and loopback
+// topics, so multiple deployments of the same group graph, e.g. a canary, can consume
+// the same input topics independently. Those deployments share the group table topic,
+// so at most one of them should write into it.
+// Note that the default storage path is derived from the group name, so deployments
+// running on the same host need different storage builders.
+func WithConsumerGroupID(id string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.consumerGroupID = id
+	}
+}
+
+// WithTopicPrefix prepends the prefix, e.g. "staging.", to the group and all topics
+// of the group graph, so the same binary can run in several environments sharing a
+// Kafka cluster. The prefixed group names the consumer group (unless set by
+// WithConsumerGroupID), group table and loop topics. Topics passed to the Context, to
+// the methods of the processor and to options like WithAuditTopic or WithInputPriority
+// are prefixed as well, and Context.Topic and Context.Group return the names without
+// prefix. Other callbacks, policies and the stats see the prefixed topics.
+// Views and emitters are prefixed by WithViewTopicPrefix and WithEmitterTopicPrefix.
+func WithTopicPrefix(prefix string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.topicPrefix = prefix
+	}
+}
+
+// WithInstanceID sets the ID identifying the processor instance, e.g. in the
+// metadata of committed offsets. Defaults to the hostname.
+func WithInstanceID(id string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.instanceID = id
+	}
+}
+
+// WithInstanceVersion sets the version of the processor, e.g. the version of the
+// deployed service. It is stored in the metadata of committed offsets.
+func WithInstanceVersion(version string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.instanceVersion = version
+	}
+}
+
 // WithStorageBuilder defines a builder for the storage of each partition.
 func WithStorageBuilder(sb storage.Builder) ProcessorOption {
 	return func(o *poptions, gg *GroupGraph) {
@@ -217,6 +371,99 @@ func WithConsumerGroupBuilder(cgb ConsumerGroupBuilder) ProcessorOption {
 	}
 }
 
+// WithStandbyPromotion enables Processor.PromoteStandby. It replaces the consumer group
+// builder with one using a copy of config (or the global config if nil), whose balance
+// strategy is wrapped with PromotingStrategy. All instances of the processor must use this
+// option, as the strategy of the group leader assigns the partitions. Requires WithHotStandby.
+// If combined with WithPartitionPinning, the config passed to the first option is used.
+func WithStandbyPromotion(config *sarama.Config) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		groupConfig := o.consumerGroupConfig(config)
+		groupConfig.Consumer.Group.Rebalance.Strategy = PromotingStrategy(groupConfig.Consumer.Group.Rebalance.Strategy)
+		o.promotionConfig = groupConfig
+	}
+}
+
+// WithPartitionPinning assigns the pinned partitions to the processor instances with
+// the client IDs (see WithClientID) used as keys of pins, bypassing the balance strategy,
+// e.g. to align partitions with sharded external resources. Like WithStandbyPromotion,
+// it replaces the consumer group builder with one using a copy of config (or the global config
+// if nil), whose balance strategy is wrapped with PinningStrategy. All instances of the
+// processor must use this option with the same pins.
+func WithPartitionPinning(config *sarama.Config, pins map[string][]int32) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		groupConfig := o.consumerGroupConfig(config)
+		groupConfig.Consumer.Group.Rebalance.Strategy = PinningStrategy(groupConfig.Consumer.Group.Rebalance.Strategy, pins)
+		o.partitionPins = pins
+	}
+}
+
+// consumerGroupConfig returns the copy of config used by the consumer group builder,
+// replacing the builder on first use.
+func (opt *poptions) consumerGroupConfig(config *sarama.Config) *sarama.Config {
+	if opt.groupConfig == nil {
+		groupConfig := globalConfig
+		if config != nil {
+			groupConfig = *config
+		}
+		opt.groupConfig = &groupConfig
+		opt.builders.consumerGroup = ConsumerGroupBuilderWithConfig(opt.groupConfig)
+	}
+	return opt.groupConfig
+}
+
+// WithTLS enables TLS with the passed config (or Go's default config if nil) for the
+// connections of the default consumer, producer and topic manager builders, including
+// those of the processor's lookup tables. Builders replaced by options are not changed.
+func WithTLS(config *tls.Config) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.saramaConfig = append(o.saramaConfig, tlsConfig(config))
+	}
+}
+
+// WithSASL enables SASL authentication with PLAIN, SCRAM or OAUTHBEARER for the connections
+// of the default consumer, producer and topic manager builders, including those of the
+// processor's lookup tables. Builders replaced by options are not changed.
+// SASL is usually combined with WithTLS, as PLAIN sends the password in clear text.
+func WithSASL(sasl SASL) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.saramaConfig = append(o.saramaConfig, saslConfig(sasl))
+	}
+}
+
+// WithOAuthBearer enables SASL OAUTHBEARER with the token provider, e.g. to connect to
+// managed Kafka services with IAM or OIDC tokens. It is a shorthand for WithSASL.
+func WithOAuthBearer(provider sarama.AccessTokenProvider) ProcessorOption {
+	return WithSASL(SASL{Mechanism: sarama.SASLTypeOAuth, TokenProvider: provider})
+}
+
+// WithSaramaConfig modifies the sarama config of the default consumer, producer and
+// topic manager builders, including those of the processor's lookup tables, e.g. to set
+// the Kafka version or network timeouts. The modification is applied to a copy of the
+// global config (see ReplaceGlobalConfig) for every client that is created.
+// Builders replaced by options are not changed.
+func WithSaramaConfig(modify func(config *sarama.Config)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.saramaConfig = append(o.saramaConfig, modify)
+	}
+}
+
+// WithConsumerSaramaConfig modifies the sarama config of the default consumer group and
+// consumer builders only, e.g. to tune fetch sizes. See WithSaramaConfig.
+func WithConsumerSaramaConfig(modify func(config *sarama.Config)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.consumerConfig = append(o.consumerConfig, modify)
+	}
+}
+
+// WithProducerSaramaConfig modifies the sarama config of the default producer builder
+// only, e.g. to tune batching or compression. See WithSaramaConfig.
+func WithProducerSaramaConfig(modify func(config *sarama.Config)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.producerConfig = append(o.producerConfig, modify)
+	}
+}
+
 // WithConsumerSaramaBuilder replaces the default consumer group builder
 func WithConsumerSaramaBuilder(cgb SaramaConsumerBuilder) ProcessorOption {
 	return func(o *poptions, gg *GroupGraph) {
@@ -260,6 +507,7 @@ func WithLogger(l Logger) ProcessorOption {
 }
 
 // WithHasher sets the hash function that assigns keys to partitions.
+// See package partitioning for hashers compatible with other Kafka clients.
 func WithHasher(hasher func() hash.Hash32) ProcessorOption {
 	return func(o *poptions, gg *GroupGraph) {
 		o.hasher = hasher
@@ -277,6 +525,51 @@ func WithHotStandby() ProcessorOption {
 	}
 }
 
+// WithDrain runs the processor in drain mode for bounded, batch-style reprocessing, e.g. a
+// replay of a range of input messages started by an external scheduler. On start, the processor
+// captures the end offsets of all partitions of its input and loop topics and consumes only
+// messages before them. Once all claimed partitions are processed up to the captured offsets,
+// the processor stops and Run returns nil. Processor.Drained reports whether the processor
+// stopped because it was drained.
+// Messages looped back while draining are beyond the captured offsets and are not processed.
+// As the end offsets are captured per processor instance, a replay should be run by a single
+// instance to terminate deterministically.
+func WithDrain() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.drain = true
+	}
+}
+
+// WithPreflight checks every topic of the group graph when creating the processor and
+// fails with one error listing all problems found, instead of failing on the first
+// missing topic or surfacing missing permissions as produce or consume errors while
+// running. The preflight checks that all topics exist, except for the loop topics and
+// the group table, which are created by the processor, and that the offsets of the topics
+// to be read can be fetched.
+// If principal is set, e.g. "User:alice", the topic ACLs are evaluated as well: the
+// principal must be allowed to read the inputs and to write the outputs, and both for
+// the loop topics and the group table. Listing the ACLs requires describe permission on
+// the cluster. If the ACLs cannot be listed, e.g. because the cluster has no authorizer,
+// they are not checked.
+// Use Preflight to run the checks without creating a processor.
+func WithPreflight(principal string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.preflight = true
+		o.preflightPrincipal = principal
+	}
+}
+
+// WithNoTopicCreation disables creating the loop topics, the group table and the outbox
+// table, for clusters where clients must not create topics. Instead, the processor checks
+// that all topics of the group graph exist and fails with an error listing the missing
+// topics. The topics the processor would create must have the same number of partitions
+// as the input topics.
+func WithNoTopicCreation() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.noTopicCreation = true
+	}
+}
+
 // WithRecoverAhead configures the processor to recover joins and the processor table ahead
 // of joining the group. This reduces the processing delay that occurs when adding new instances to
 // groups with high-volume-joins/tables. If the processor does not use joins or a table, it does not have any
@@ -302,11 +595,129 @@ func WithBackoffResetTimeout(duration time.Duration) ProcessorOption {
 	}
 }
 
+// WithOutputDefaultHeaders configures default headers which are included with every
+// message the processor emits, i.e. outputs, loopbacks, outbox messages and the
+// messages of the group table's changelog, e.g. to stamp the processor's name and
+// version on all messages. Headers passed when emitting are merged with the default
+// headers, overriding defaults of the same key.
+func WithOutputDefaultHeaders(hdr Headers) ProcessorOption {
+	return func(p *poptions, graph *GroupGraph) {
+		p.producerDefaultHeaders = hdr
+	}
+}
+
+// WithProvenanceHeaders stamps the ID and version of the processor instance, its group
+// and the version of goka into the headers of all messages the processor emits, including
+// the group table's changelog (see ProvenanceInstanceHeader et al), e.g. to debug which
+// instances interleaved writes to a key. Headers configured with WithOutputDefaultHeaders
+// or passed when emitting override the provenance headers.
+func WithProvenanceHeaders() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.provenanceHeaders = true
+	}
+}
+
+// WithHeaderForwarding copies the headers with the passed keys from the message being
+// processed to all messages emitted by the callback, i.e. outputs, loopbacks, outbox
+// messages and the messages of the group table's changelog, e.g. to propagate correlation IDs.
+// Forwarded headers override the default headers (see WithOutputDefaultHeaders), headers
+// passed when emitting override forwarded headers. The option can be used multiple times.
+func WithHeaderForwarding(keys ...string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.forwardedHeaders = append(o.forwardedHeaders, keys...)
+	}
+}
+
+// WithAuditTopic writes an AuditRecord of every message the processor emits to the
+// audit topic, i.e. of outputs, loopbacks, outbox messages and the messages of the
+// group table's changelog. Records are written once the message was produced, messages
+// failing to be produced are not audited. The producer of the records is the instance ID
+// (see WithInstanceID). Auditing is best effort, failing to write a record only logs an error.
+func WithAuditTopic(topic Stream) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.auditTopic = topic
+	}
+}
+
+// WithReplyTopics allows Reply to respond to topics starting with one of the
+// prefixes. The response topic is taken from the header of the request, so Reply
+// ignores requests whose response topic does not match, as well as requests asking
+// to respond to the group table, the loop topics or the outbox of the group.
+// The option can be used multiple times.
+func WithReplyTopics(prefixes ...string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.replyTopics = append(o.replyTopics, prefixes...)
+	}
+}
+
 // WithProducerDefaultHeaders configures the producer with default headers
 // which are included with every emit.
+//
+// Deprecated: use WithOutputDefaultHeaders.
 func WithProducerDefaultHeaders(hdr Headers) ProcessorOption {
-	return func(p *poptions, graph *GroupGraph) {
-		p.producerDefaultHeaders = hdr
+	return WithOutputDefaultHeaders(hdr)
+}
+
+// WithMaxProcessingRate limits the number of messages per second the processor
+// instance consumes. If no topics are passed, the limit applies to all input streams
+// (and the loopback) of the processor combined. Otherwise the limit applies to each
+// of the passed input topics separately, across all of its partitions.
+// The option can be used multiple times to combine a global limit with limits per topic.
+// This is useful to avoid overwhelming downstream systems when replaying historical data.
+func WithMaxProcessingRate(msgsPerSecond float64, topics ...Stream) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		if len(topics) == 0 {
+			o.maxProcessingRate = msgsPerSecond
+			return
+		}
+		if o.topicProcessingRates == nil {
+			o.topicProcessingRates = make(map[string]float64)
+		}
+		for _, topic := range topics {
+			o.topicProcessingRates[string(topic)] = msgsPerSecond
+		}
+	}
+}
+
+// WithInputPriority assigns a priority to the passed input topics (or the loopback).
+// Messages of topics with a higher priority are always processed before pending
+// messages of topics with a lower priority on the same partition.
+// Topics without explicit priority have priority 0.
+// This allows e.g. a low-volume control topic to be processed promptly even if a
+// high-volume data topic has a large backlog.
+func WithInputPriority(priority int, topics ...Stream) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		if o.inputPriorities == nil {
+			o.inputPriorities = make(map[string]int)
+		}
+		for _, topic := range topics {
+			o.inputPriorities[string(topic)] = priority
+		}
+	}
+}
+
+// WithInputQuota caps the share of the processing time the passed input topics (or the
+// loopback) may use on a partition to a fraction in (0, 1], e.g. 0.5 for half of the
+// time. A topic exceeding its quota is only processed while no messages of other topics
+// are pending, so a topic with a large backlog cannot starve the other topics of the
+// group, but no capacity is left unused. The current shares are reported as
+// InputStats.Share.
+func WithInputQuota(share float64, topics ...Stream) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		if o.inputQuotas == nil {
+			o.inputQuotas = make(map[string]float64)
+		}
+		for _, topic := range topics {
+			o.inputQuotas[string(topic)] = share
+		}
+	}
+}
+
+// WithOutboxRetryInterval sets the interval after which the forwarding of outbox
+// messages is retried if it failed. Defaults to 5 seconds.
+func WithOutboxRetryInterval(interval time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.outboxRetryInterval = interval
 	}
 }
 
@@ -354,7 +765,8 @@ func WithTester(t Tester) ProcessorOption {
 		o.builders.consumerGroup = t.ConsumerGroupBuilder()
 		o.builders.consumerSarama = t.ConsumerBuilder()
 		o.partitionChannelSize = 0
-		o.clientID = t.RegisterGroupGraph(gg)
+		// the graph is registered once the topic prefix is known
+		o.tester = t
 	}
 }
 
@@ -363,34 +775,217 @@ func (opt *poptions) applyOptions(gg *GroupGraph, opts ...ProcessorOption) error
 	opt.log = defaultLogger
 	opt.hasher = DefaultHasher()
 	opt.backoffResetTime = defaultBackoffRestTime
+	opt.outboxRetryInterval = defaultOutboxRetryInterval
+	opt.statsInterval = statsHwmUpdateInterval
 
 	for _, o := range opts {
 		o(opt, gg)
 	}
 
+	if opt.tester != nil {
+		if opt.topicPrefix != "" {
+			opt.clientID = opt.tester.RegisterGroupGraph(gg.withTopicPrefix(opt.topicPrefix))
+		} else {
+			opt.clientID = opt.tester.RegisterGroupGraph(gg)
+		}
+	}
+
+	if opt.consumerGroupID == "" {
+		opt.consumerGroupID = opt.topicPrefix + string(gg.Group())
+		if opt.readOnly {
+			// don't take the partitions from the group's processors
+			opt.consumerGroupID += readOnlyGroupSuffix
+		}
+	}
+	if opt.instanceID == "" {
+		opt.instanceID, _ = os.Hostname()
+	}
+	if opt.provenanceHeaders {
+		opt.producerDefaultHeaders = opt.provenance(gg.Group()).Merged(opt.producerDefaultHeaders)
+	}
+
 	// StorageBuilder should always be set as a default option in NewProcessor
 	if opt.builders.storage == nil {
 		return fmt.Errorf("StorageBuilder not set")
 	}
 
+	if opt.promotionConfig != nil && !opt.hotStandby {
+		return fmt.Errorf("standby promotion requires hot standby (see WithHotStandby)")
+	}
+
+	if err := validatePartitionPins(opt.partitionPins); err != nil {
+		return err
+	}
+
+	if opt.storageConcurrency < 0 {
+		return fmt.Errorf("invalid storage concurrency %d: must not be negative", opt.storageConcurrency)
+	}
+	opt.storageLimiter = newStorageLimiter(opt.storageConcurrency)
+
+	if opt.maxProcessingRate < 0 {
+		return fmt.Errorf("invalid max processing rate %f: must not be negative", opt.maxProcessingRate)
+	}
+	for topic, rate := range opt.topicProcessingRates {
+		if rate <= 0 {
+			return fmt.Errorf("invalid max processing rate %f for topic %s: must be positive", rate, topic)
+		}
+		if gg.callback(topic) == nil {
+			return fmt.Errorf("cannot limit processing rate of topic %s: not an input of the group graph", topic)
+		}
+	}
+
+	for topic := range opt.inputPriorities {
+		if gg.callback(topic) == nil {
+			return fmt.Errorf("cannot set priority of topic %s: not an input of the group graph", topic)
+		}
+	}
+
+	for topic, share := range opt.inputQuotas {
+		if share <= 0 || share > 1 {
+			return fmt.Errorf("invalid quota %f for topic %s: must be in (0, 1]", share, topic)
+		}
+		if gg.callback(topic) == nil {
+			return fmt.Errorf("cannot set quota of topic %s: not an input of the group graph", topic)
+		}
+	}
+
+	for _, s := range opt.inputSamplers {
+		if s.rate <= 0 || s.rate > 1 {
+			return fmt.Errorf("invalid input sampling rate %f: must be in (0, 1]", s.rate)
+		}
+		if s.callback == nil && s.mirrorTopic == "" {
+			return fmt.Errorf("input sampling needs a callback or mirror topic")
+		}
+		if s.mirrorTopic != "" && gg.callback(s.mirrorTopic) != nil {
+			return fmt.Errorf("cannot mirror input messages to topic %s: it is an input of the group graph", s.mirrorTopic)
+		}
+	}
+
+	if opt.hotKeyCapacity < 0 {
+		return fmt.Errorf("invalid hot key capacity %d: must not be negative", opt.hotKeyCapacity)
+	}
+	if opt.hotKeyCapacity > 0 {
+		if opt.hotKeyMinShare <= 0 || opt.hotKeyMinShare > 1 {
+			return fmt.Errorf("invalid hot key share %f: must be in (0, 1]", opt.hotKeyMinShare)
+		}
+		if opt.statsDisabled {
+			return fmt.Errorf("cannot detect hot keys with disabled stats")
+		}
+	}
+	if topic := opt.messageAgePolicy.deadLetterTopic; topic != "" && gg.callback(topic) != nil {
+		return fmt.Errorf("cannot forward too old messages to topic %s: it is an input of the group graph", topic)
+	}
+	if opt.latencyBudget < 0 {
+		return fmt.Errorf("invalid latency budget %v: must not be negative", opt.latencyBudget)
+	}
+	if opt.latencyBudget > 0 && opt.sheddingPolicy == nil {
+		return fmt.Errorf("latency budget needs a shedding policy")
+	}
+
+	for topic := range opt.outputValidators {
+		if !gg.isOutputTopic(Stream(topic)) && !gg.isOutboxTopic(Stream(topic)) {
+			return fmt.Errorf("cannot validate messages to topic %s: not an output of the group graph", topic)
+		}
+	}
+
+	if opt.lookupMaxStaleness < 0 || opt.lookupWarmupTimeout < 0 {
+		return fmt.Errorf("invalid lookup warmup: staleness and timeout must not be negative")
+	}
+	if opt.lookupMaxStaleness > 0 && len(gg.LookupTables()) == 0 {
+		return fmt.Errorf("cannot warm up lookup tables: group graph has no lookup tables")
+	}
+
+	if opt.statsInterval <= 0 {
+		return fmt.Errorf("invalid stats interval %v: must be positive", opt.statsInterval)
+	}
+
+	if opt.maxLoopbackHops < 0 {
+		return fmt.Errorf("invalid max loopback hops %d: must not be negative", opt.maxLoopbackHops)
+	}
+	if opt.maxLoopbackHops > 0 && len(gg.loopStreams()) == 0 {
+		return fmt.Errorf("cannot limit loopback hops: group graph has no loop")
+	}
+
+	if opt.maxLookupLag < 0 {
+		return fmt.Errorf("invalid max lookup lag %d: must not be negative", opt.maxLookupLag)
+	}
+	if opt.maxLookupLag > 0 && len(gg.LookupTables()) == 0 {
+		return fmt.Errorf("cannot limit lookup lag: group graph has no lookup tables")
+	}
+
+	if opt.tableRetention < 0 {
+		return fmt.Errorf("invalid table retention %v: must not be negative", opt.tableRetention)
+	}
+	if opt.tableRetention > 0 && gg.GroupTable() == nil {
+		return fmt.Errorf("cannot use table retention in stateless processor")
+	}
+	if opt.tableVersion < 0 {
+		return fmt.Errorf("invalid table version %d: must not be negative", opt.tableVersion)
+	}
+	if (opt.tableVersion > 0 || opt.tableMigration != nil) && gg.GroupTable() == nil {
+		return fmt.Errorf("cannot use table versions in stateless processor")
+	}
+	if opt.tableMigration != nil && opt.tableVersion == 0 {
+		return fmt.Errorf("cannot use table migration without table version")
+	}
+	if opt.tableOffsetIndex && gg.GroupTable() == nil {
+		return fmt.Errorf("cannot use table offset index in stateless processor")
+	}
+	for table, m := range opt.tableMigrations {
+		var found bool
+		for _, topic := range chainEdges(gg.JointTables(), gg.LookupTables()).Topics() {
+			found = found || topic == table
+		}
+		if !found {
+			return fmt.Errorf("cannot use table migration of %s: not a joined or looked up table", table)
+		}
+		if m.version <= 0 {
+			return fmt.Errorf("invalid table version %d of %s: must be positive", m.version, table)
+		}
+	}
+
+	if opt.tableTTLInterval < 0 {
+		return fmt.Errorf("invalid table TTL interval %v: must not be negative", opt.tableTTLInterval)
+	}
+	if opt.tableTTLInterval > 0 && gg.GroupTable() == nil {
+		return fmt.Errorf("cannot use table TTL in stateless processor")
+	}
+	if opt.recoveryHook != nil && gg.GroupTable() == nil {
+		return fmt.Errorf("cannot use recovery hook in stateless processor")
+	}
+
+	if opt.tableGCPredicate != nil {
+		if gg.GroupTable() == nil {
+			return fmt.Errorf("cannot use table gc in stateless processor")
+		}
+		if opt.tableGCInterval <= 0 {
+			return fmt.Errorf("invalid table gc interval %v: must be positive", opt.tableGCInterval)
+		}
+	}
+
 	if globalConfig.Producer.RequiredAcks == sarama.NoResponse {
 		return fmt.Errorf("Processors do not work with `Config.Producer.RequiredAcks==sarama.NoResponse`, as it uses the response's offset to store the value")
 	}
 
 	if opt.builders.producer == nil {
-		opt.builders.producer = DefaultProducerBuilder
+		opt.builders.producer = opt.saramaConfig.with(opt.producerConfig).producerBuilder()
 	}
 
 	if opt.builders.topicmgr == nil {
-		opt.builders.topicmgr = DefaultTopicManagerBuilder
+		opt.builders.topicmgr = opt.saramaConfig.topicManagerBuilder()
 	}
 
+	consumerConfig := opt.saramaConfig.with(opt.consumerConfig)
 	if opt.builders.consumerGroup == nil {
-		opt.builders.consumerGroup = DefaultConsumerGroupBuilder
+		opt.builders.consumerGroup = consumerConfig.consumerGroupBuilder()
+	}
+	if opt.groupConfig != nil {
+		// the config of WithStandbyPromotion or WithPartitionPinning
+		consumerConfig.apply(opt.groupConfig)
 	}
 
 	if opt.builders.consumerSarama == nil {
-		opt.builders.consumerSarama = DefaultSaramaConsumerBuilder
+		opt.builders.consumerSarama = consumerConfig.saramaConsumerBuilder()
 	}
 
 	if opt.builders.backoff == nil {
@@ -400,6 +995,53 @@ func (opt *poptions) applyOptions(gg *GroupGraph, opts ...ProcessorOption) error
 	return nil
 }
 
+// prefixTopics prepends the topic prefix to the topics named in the options, see
+// WithTopicPrefix.
+func (opt *poptions) prefixTopics() {
+	prefix := opt.topicPrefix
+	for i, topic := range opt.replyTopics {
+		opt.replyTopics[i] = prefix + topic
+	}
+	if topic := opt.messageAgePolicy.deadLetterTopic; topic != "" {
+		opt.messageAgePolicy.deadLetterTopic = prefix + topic
+	}
+	for i, s := range opt.inputSamplers {
+		if s.mirrorTopic != "" {
+			opt.inputSamplers[i].mirrorTopic = prefix + s.mirrorTopic
+		}
+	}
+
+	rates := make(map[string]float64, len(opt.topicProcessingRates))
+	for topic, rate := range opt.topicProcessingRates {
+		rates[prefix+topic] = rate
+	}
+	opt.topicProcessingRates = rates
+
+	priorities := make(map[string]int, len(opt.inputPriorities))
+	for topic, priority := range opt.inputPriorities {
+		priorities[prefix+topic] = priority
+	}
+	opt.inputPriorities = priorities
+
+	quotas := make(map[string]float64, len(opt.inputQuotas))
+	for topic, share := range opt.inputQuotas {
+		quotas[prefix+topic] = share
+	}
+	opt.inputQuotas = quotas
+
+	migrations := make(map[string]tableMigration, len(opt.tableMigrations))
+	for table, m := range opt.tableMigrations {
+		migrations[prefix+table] = m
+	}
+	opt.tableMigrations = migrations
+
+	validators := make(map[string][]OutputValidator, len(opt.outputValidators))
+	for topic, validate := range opt.outputValidators {
+		validators[prefix+topic] = validate
+	}
+	opt.outputValidators = validators
+}
+
 // WithRebalanceCallback sets the callback for when a new partition assignment
 // is received. By default, this is an empty function.
 func WithRebalanceCallback(cb RebalanceCallback) ProcessorOption {
@@ -408,54 +1050,412 @@ func WithRebalanceCallback(cb RebalanceCallback) ProcessorOption {
 	}
 }
 
-///////////////////////////////////////////////////////////////////////////////
-// view options
-///////////////////////////////////////////////////////////////////////////////
-
-// ViewOption defines a configuration option to be used when creating a view.
-type ViewOption func(*voptions, Table, Codec)
-
-type voptions struct {
-	log              logger
-	clientID         string
-	tableCodec       Codec
-	updateCallback   UpdateCallback
-	hasher           func() hash.Hash32
-	autoreconnect    bool
-	backoffResetTime time.Duration
+// WithTableGC runs a garbage collection on the group table of every partition
+// every interval. All keys for which isGarbage returns true are deleted from the
+// local storage and a tombstone is emitted to the table topic, so the key is
+// also removed by log compaction.
+// Use it to expire state that is not deleted by the processor callback itself,
+// keeping both the local storage and the table topic from growing unboundedly.
+// The predicate is called concurrently to the processor callback.
+func WithTableGC(interval time.Duration, isGarbage TableGCPredicate) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tableGCInterval = interval
+		o.tableGCPredicate = isGarbage
+	}
+}
 
-	builders struct {
-		storage        storage.Builder
-		consumerSarama SaramaConsumerBuilder
-		topicmgr       TopicManagerBuilder
-		backoff        BackoffBuilder
+// WithExpvar publishes the core counters of the processor as the expvar variable of the
+// name, e.g. for scraping /debug/vars. The variable sums the counts, bytes and lags of
+// the input and output topics over the partitions and contains the recovery of the
+// group table and the lookup tables. Reading the variable collects the processor's
+// stats, so it fails after a second and contains empty counters if the stats are
+// disabled. Creating another processor with the same name replaces the published one.
+func WithExpvar(name string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.expvarName = name
 	}
 }
 
-// WithViewLogger sets the logger the view should use. By default, views
-// use the standard library logger.
-func WithViewLogger(l Logger) ViewOption {
-	return func(o *voptions, table Table, codec Codec) {
-		if prefixLogger, ok := l.(logger); ok {
-			o.log = prefixLogger
-		} else {
-			o.log = wrapLogger(l)
-		}
+// WithTableTTL enables TTLs of the keys of the group table (see SetValueWithTTL)
+// and deletes the expired keys every interval. Expired keys are deleted from the local
+// storage and a tombstone is emitted to the table topic, so the key is also removed by
+// log compaction. Expired keys are returned until they are deleted.
+// The expiry times are stored in a separate storage created by the storage builder for
+// the table topic with the suffix ".ttl" and recovered from the TableExpiresHeader of the
+// table messages, so enable TTLs before recovering the local storage.
+func WithTableTTL(interval time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tableTTLInterval = interval
 	}
 }
 
-// WithViewCallback defines the callback called upon recovering a message
-// from the log.
-func WithViewCallback(cb UpdateCallback) ViewOption {
-	return func(o *voptions, table Table, codec Codec) {
-		o.updateCallback = cb
+// WithTableRetention declares that the group table is stored in a topic with
+// cleanup.policy=compact,delete and the passed retention (see TopicManagerConfig.Table.Retention).
+// Values are expired in the local storage after the retention as well, counting from the
+// timestamp of the message they were recovered from or the time they were set, so the
+// local storage matches the table topic. Old keys missing in the table topic during recovery
+// are therefore expected and not treated as divergent, e.g. by Processor.CheckTable.
+// Expired values are hidden right away and deleted from the local storage periodically.
+//
+// The local storage stores a timestamp with each value (see storage.NewExpiring), so it
+// must be empty when enabling or disabling the retention.
+func WithTableRetention(retention time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tableRetention = retention
 	}
 }
 
-// WithViewStorageBuilder defines a builder for the storage of each partition.
-func WithViewStorageBuilder(sb storage.Builder) ViewOption {
-	return func(o *voptions, table Table, codec Codec) {
-		o.builders.storage = sb
+// WithTableVersion sets the version of the values the processor writes to the group table.
+// The version is stored with each value in the local storage and in the TableVersionHeader
+// of the table messages. Values of older versions, including table messages without the
+// header, are upgraded by the migration passed to WithTableMigration when they are
+// recovered or read from the local storage, so the table does not need to be rewritten
+// when the format of the values changes. Increase the version whenever the format changes.
+//
+// The local storage stores the version with each value (see storage.NewVersioned). Values
+// stored before enabling table versions are migrated as version 0 when the storage is
+// opened, or the storage is rebuilt from the table topic if it cannot be migrated and
+// WithStorageRebuild is used. Otherwise the partitions fail to start with
+// storage.ErrUnversionedStorage until the local storage is deleted.
+func WithTableVersion(version int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tableVersion = version
+	}
+}
+
+// WithTableMigration sets the migration upgrading values written by older versions of the
+// processor to the version set by WithTableVersion. The migration is passed the version the
+// value was written with and the raw value and returns the raw value of the current version.
+// It is called lazily for every read of an old value until the key is written again.
+func WithTableMigration(migrate func(oldVersion int, raw []byte) ([]byte, error)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tableMigration = migrate
+	}
+}
+
+// WithJoinTableMigration sets the version and the migration of a table joined or looked
+// up by the processor, which is written by a processor using WithTableVersion. Like in
+// views using WithViewTableMigration, values of older versions are upgraded by the
+// migration when they are recovered or read from the local storage.
+func WithJoinTableMigration(table Table, version int, migrate func(oldVersion int, raw []byte) ([]byte, error)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		if o.tableMigrations == nil {
+			o.tableMigrations = make(map[string]tableMigration)
+		}
+		o.tableMigrations[string(table)] = tableMigration{version: version, migrate: migrate}
+	}
+}
+
+// WithTableOffsetIndex makes the processor maintain an index of the offset of the latest
+// message of each key in the group table topic. The index is stored in a separate storage
+// created by the storage builder for the topic with the suffix ".offset-index" and
+// updated while recovering and with every write. It is complete only if it was enabled
+// before the local storage was recovered, see PartitionTable.KeyOffset.
+func WithTableOffsetIndex() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.tableOffsetIndex = true
+	}
+}
+
+// WithInputSampling passes a random share of the consumed input messages to the
+// callback, e.g. to build test fixtures from live traffic. The rate is the share of
+// messages to sample, between 0 (exclusive) and 1.
+// The callback is called in the processing loop before the message is decoded, so it
+// should not block.
+func WithInputSampling(rate float64, cb SamplingCallback) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.inputSamplers = append(o.inputSamplers, inputSampler{rate: rate, callback: cb})
+	}
+}
+
+// WithInputMirror copies a random share of the consumed input messages to the
+// passed topic, e.g. to debug a processor or to build test fixtures from live traffic.
+// The rate is the share of messages to mirror, between 0 (exclusive) and 1.
+// Messages are mirrored with their original key, value and headers. The origin of the
+// message is added as headers (see MirrorTopicHeader et al).
+// Mirroring is best effort: failing to mirror a message does not stop the processor.
+func WithInputMirror(rate float64, topic string) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.inputSamplers = append(o.inputSamplers, inputSampler{rate: rate, mirrorTopic: topic})
+	}
+}
+
+// WithHotKeyDetection detects keys receiving a disproportionate share of the input
+// messages of a partition. Each partition counts the most frequent keys in a sketch of
+// capacity keys. A key is hot if it received at least minShare (between 0 exclusive and 1)
+// of the messages of the partition. The counts are halved every stats interval (see
+// WithStatsInterval), so the detection follows the recent traffic.
+// Hot keys are reported in PartitionProcStats.HotKeys. If cb is not nil, it is called
+// whenever a key becomes hot, e.g. to start salting the key, see SaltKey.
+func WithHotKeyDetection(capacity int, minShare float64, cb HotKeyCallback) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.hotKeyCapacity = capacity
+		o.hotKeyMinShare = minShare
+		o.hotKeyCallback = cb
+	}
+}
+
+// WithOutputValidator adds a validator for messages emitted to an output stream of
+// the group, including outbox streams. Messages failing the validation are dropped
+// instead of being emitted, so malformed messages are rejected at the source instead
+// of poisoning downstream consumers. Rejected messages are logged and counted in the
+// output stats of the topic.
+// Multiple validators can be added for a topic, they are run in order.
+func WithOutputValidator(topic Stream, validate OutputValidator) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		if o.outputValidators == nil {
+			o.outputValidators = make(map[string][]OutputValidator)
+		}
+		o.outputValidators[string(topic)] = append(o.outputValidators[string(topic)], validate)
+	}
+}
+
+// WithLookupWarmup delays the start of processing until every lookup table is
+// recovered and each of its partitions contains a message not older than maxStaleness.
+// Partitions that are empty or contain all messages of their topic partition, e.g. idle
+// partitions recovered from the local storage, are not waited for. By default, the
+// processor only waits for the lookup tables to be recovered, which might
+// not be sufficient if the processor filling the table is lagging itself, e.g. after
+// a redeployment.
+// Tables without message timestamps use the time the message was loaded.
+// If timeout is positive, the processor starts anyway after the timeout, logging the
+// partitions that are still stale. Otherwise it waits until the processor is stopped.
+func WithLookupWarmup(maxStaleness time.Duration, timeout time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.lookupMaxStaleness = maxStaleness
+		o.lookupWarmupTimeout = timeout
+	}
+}
+
+// WithMaxLookupLag pauses the processing of input messages while any lookup table
+// lags more than maxLag messages behind its topic, to bound how stale the looked up
+// values can be. The lag is checked every second, see also Processor.TableLag.
+func WithMaxLookupLag(maxLag int64) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.maxLookupLag = maxLag
+	}
+}
+
+// WithStatsInterval sets the interval in which the stats of the partitions and
+// tables are updated with the high water marks of their topics. Defaults to 5 seconds.
+func WithStatsInterval(interval time.Duration) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.statsInterval = interval
+	}
+}
+
+// WithStatsDisabled disables collecting stats of the partitions and tables, which
+// reduces the overhead of processing at very high partition counts.
+// The stats returned by Processor.Stats will not contain any partition or table stats.
+func WithStatsDisabled() ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.statsDisabled = true
+	}
+}
+
+// WithCompactionSchedule compacts the local storages of the group table, joined and
+// lookup tables at the times of the schedule, e.g. WithCompactionSchedule(DailyCompaction(3, 0))
+// to compact at night instead of during peak traffic. The storages are compacted one
+// after another and only if they support compaction (see storage.Compactable).
+func WithCompactionSchedule(schedule CompactionSchedule) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.compactionSchedule = schedule
+	}
+}
+
+// WithPartitionCountCheck checks every interval whether the number of partitions of the
+// input and joined topics changed while the processor is running. The processor keeps
+// the partition count it was started with, so new partitions would never be consumed.
+// If a count changed, the processor reacts with the policy,
+// which stops it with ErrPartitionCountChanged. By default the counts are only checked
+// on startup.
+func WithPartitionCountCheck(interval time.Duration, policy PartitionCountPolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.partitionCheckInterval = interval
+		o.partitionCountPolicy = policy
+	}
+}
+
+// WithMaxMessageAge handles input messages older than maxAge according to the policy
+// instead of processing them, e.g. to skip stale events while working through a large
+// backlog. The age is computed from the timestamp of the message, messages without
+// timestamp and messages of loop topics are always processed. The skipped messages are
+// counted in InputStats.TooOld.
+func WithMaxMessageAge(maxAge time.Duration, policy MessageAgePolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.maxMessageAge = maxAge
+		o.messageAgePolicy = policy
+	}
+}
+
+// WithLatencyBudget sets the maximum latency of input messages, i.e. the time since they
+// were produced. Messages over the budget are passed to the shedding policy, which decides
+// whether to skip them, e.g. the messages of low-priority topics, or to process them.
+// Callbacks can check OverLatencyBudget to switch to degraded logic, trading
+// completeness for freshness while working through a backlog. Messages without timestamp
+// and messages of loop topics are never over the budget. Skipped messages are counted in
+// InputStats.Shed. Messages too old according to WithMaxMessageAge are handled first.
+func WithLatencyBudget(budget time.Duration, policy SheddingPolicy) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.latencyBudget = budget
+		o.sheddingPolicy = policy
+	}
+}
+
+// WithMaxLoopbackHops limits how often a message may be looped back, counting every
+// Loopback or LoopbackAfter of a callback processing a message of the loop topic as
+// another hop. Loopbacks beyond the limit are dropped and logged instead of failing the
+// processor, which would fail again on the same message after a restart. Callbacks that
+// retry work should check LoopbackHops themselves to handle the last attempt, e.g. by
+// emitting to a dead letter topic. By default the hops are not limited.
+func WithMaxLoopbackHops(n int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.maxLoopbackHops = n
+	}
+}
+
+// WithStorageRebuild rebuilds corrupted local storages of the group table and joined
+// tables instead of failing. A storage is corrupted if building or opening the storage
+// or reading the local offset fails with storage.ErrCorrupted (see also
+// storage.ChecksumBuilder), or if the local offset is beyond
+// the end of the table topic. The storage is then deleted with remove and recovered
+// from the table topic. The remover must match the storage builder, e.g.
+//
+//	goka.WithStorageBuilder(storage.DefaultBuilder(path)),
+//	goka.WithStorageRebuild(storage.DefaultRemover(path)),
+func WithStorageRebuild(remove storage.Remover) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.removeStorage = remove
+	}
+}
+
+// WithStorageConcurrency limits how many local storages of the processor's tables,
+// including its lookup tables, are opened or closed concurrently, e.g. to avoid spikes of
+// file descriptors and memory when many partitions are assigned during a rebalance.
+// Defaults to 0, which does not limit.
+func WithStorageConcurrency(concurrency int) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.storageConcurrency = concurrency
+	}
+}
+
+// WithReadOnly runs the processor in read-only mode, e.g. to debug callbacks against
+// production traffic. The processor consumes its inputs and runs the callbacks, but does
+// not commit offsets, and messages it would emit are passed to onEmit or logged if onEmit
+// is nil. Writes to the group table and their TTLs are kept in memory, so the callbacks
+// see their own writes, but the table is not modified. Iterators read the storage only.
+// The memory used is not bounded, it grows with every key written, so run read-only
+// processors for a limited time only.
+//
+// The processor joins the consumer group "<group>-readonly" unless WithConsumerGroupID is
+// set, so it does not take partitions from the group's processors. Note that the
+// tables are still recovered into the local storage, so use a separate storage path.
+func WithReadOnly(onEmit ReadOnlyEmitCallback) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.readOnly = true
+		o.readOnlyEmit = onEmit
+	}
+}
+
+// WithShutdownReport sets a callback receiving the summary of the processor's run when
+// Run returns: the messages processed and the last offsets by partition, the time it took
+// to stop the partitions and the errors encountered. Log it to verify clean shutdowns:
+//
+//	goka.WithShutdownReport(func(report *goka.ShutdownReport) {
+//		log.Println(report)
+//	})
+func WithShutdownReport(callback func(report *ShutdownReport)) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.shutdownReport = callback
+	}
+}
+
+// WithPartitionSetup sets a callback that is invoked for every partition the processor
+// starts processing. Use it to open per-partition resources like database connections
+// or caches that are tied to the lifetime of the partition assignment.
+func WithPartitionSetup(cb PartitionSetupCallback) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.partitionSetup = cb
+	}
+}
+
+// WithPartitionTeardown sets a callback that is invoked for every partition the processor
+// stops processing, to release the resources opened in the PartitionSetupCallback.
+func WithPartitionTeardown(cb PartitionTeardownCallback) ProcessorOption {
+	return func(o *poptions, gg *GroupGraph) {
+		o.partitionTeardown = cb
+	}
+}
+
+///////////////////////////////////////////////////////////////////////////////
+// view options
+///////////////////////////////////////////////////////////////////////////////
+
+// ViewOption defines a configuration option to be used when creating a view.
+type ViewOption func(*voptions, Table, Codec)
+
+type voptions struct {
+	log                logger
+	clientID           string
+	tableCodec         Codec
+	updateCallback     UpdateCallback
+	hasher             func() hash.Hash32
+	autoreconnect      bool
+	backoffResetTime   time.Duration
+	maxVersions        int
+	versionRetention   time.Duration
+	recordMetadata     bool
+	readThroughTimeout time.Duration
+	offsetIndex        bool
+	indexes            []tableIndex
+	statsInterval      time.Duration
+	statsDisabled      bool
+	compactionSchedule CompactionSchedule
+	removeStorage      storage.Remover
+	storageConcurrency int
+	storageLimiter     storageLimiter
+	saramaConfig       configModifiers
+	registry           ViewRegistry
+	expvarName         string
+	topicPrefix        string
+	tester             Tester
+	shutdownReport     func(report *ShutdownReport)
+	tableRetention     time.Duration
+	tableVersion       int
+	tableMigration     storage.Migration
+
+	builders struct {
+		storage        storage.Builder
+		consumerSarama SaramaConsumerBuilder
+		topicmgr       TopicManagerBuilder
+		backoff        BackoffBuilder
+	}
+}
+
+// WithViewLogger sets the logger the view should use. By default, views
+// use the standard library logger.
+func WithViewLogger(l Logger) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		if prefixLogger, ok := l.(logger); ok {
+			o.log = prefixLogger
+		} else {
+			o.log = wrapLogger(l)
+		}
+	}
+}
+
+// WithViewCallback defines the callback called upon recovering a message
+// from the log.
+func WithViewCallback(cb UpdateCallback) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.updateCallback = cb
+	}
+}
+
+// WithViewStorageBuilder defines a builder for the storage of each partition.
+func WithViewStorageBuilder(sb storage.Builder) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.builders.storage = sb
 	}
 }
 
@@ -525,7 +1525,198 @@ func WithViewTester(t Tester) ViewOption {
 		o.builders.storage = t.StorageBuilder()
 		o.builders.topicmgr = t.TopicManagerBuilder()
 		o.builders.consumerSarama = t.ConsumerBuilder()
-		o.clientID = t.RegisterView(table, codec)
+		// the view is registered once the topic prefix is known
+		o.tester = t
+	}
+}
+
+// WithViewVersions makes the view retain previous versions of each key in memory, so
+// they can be queried with View.GetAsOf. Versions are dropped if there are more than
+// maxVersions for a key, or if they were replaced before the retention window.
+// Passing 0 disables the respective limit, but at least one limit must be set.
+// Versions are built from the messages the view consumes from the table topic, i.e.
+// versions before the view was started (or recovered from its local storage) are not known.
+func WithViewVersions(maxVersions int, retention time.Duration) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.maxVersions = maxVersions
+		o.versionRetention = retention
+	}
+}
+
+// WithViewRecordMetadata makes the view keep the offset and timestamp of the last
+// message of each key in memory, so they can be read with RecordIterator.Offset and
+// RecordIterator.Timestamp and used by View.IteratorSince. The metadata is built from the
+// messages the view consumes from the table topic, i.e. it is unknown for values
+// recovered from the local storage.
+func WithViewRecordMetadata() ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.recordMetadata = true
+	}
+}
+
+// WithViewReadThrough makes View.Get fetch keys missing in the local storage from the
+// table topic, e.g. for views with a storage evicting keys (see storage.NewLRU). The
+// partition of the key is scanned from its oldest offset up to the high watermark, so
+// a miss costs a read of the whole partition and fails after the timeout. Fetched
+// values are not stored locally, which trades latency for completeness. Keys that are
+// not found in the topic are not fetched again for a few seconds. Fetches of the same
+// partition are serialized.
+func WithViewReadThrough(timeout time.Duration) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.readThroughTimeout = timeout
+	}
+}
+
+// WithViewExpvar publishes the core counters of the view as the expvar variable of the
+// name, e.g. for scraping /debug/vars, see WithExpvar.
+func WithViewExpvar(name string) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.expvarName = name
+	}
+}
+
+// WithViewTopicPrefix prepends the prefix to the table topic of the view, see
+// WithTopicPrefix.
+func WithViewTopicPrefix(prefix string) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.topicPrefix = prefix
+	}
+}
+
+// WithViewOffsetIndex makes the view maintain an index of the offset of the latest
+// message of each key in the table topic, see View.KeyOffset. The index is stored in a
+// separate storage created by the storage builder for the topic with the suffix
+// ".offset-index". With read-through (see WithViewReadThrough), keys in the index are
+// fetched by reading only their latest message instead of scanning the partition, and
+// keys missing in a complete index are not fetched at all.
+func WithViewOffsetIndex() ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.offsetIndex = true
+	}
+}
+
+// WithViewIndex adds a secondary index of the name to the view, which maps the values
+// returned by extract for the value of each key to the key, see View.GetByIndex. The
+// index is updated with every update of the view, including deletes, and stored in a
+// separate storage created by the storage builder for the topic with the suffix
+// ".secondary-index". The indexes of a partition are rebuilt from the local storage if
+// they are not up to date with it, e.g. after adding an index.
+func WithViewIndex(name string, extract IndexExtractor) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.indexes = append(o.indexes, tableIndex{name: name, extract: extract})
+	}
+}
+
+// WithViewStatsInterval sets the interval in which the stats of the partitions
+// are updated with the high water marks of the table topic. Defaults to 5 seconds.
+func WithViewStatsInterval(interval time.Duration) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.statsInterval = interval
+	}
+}
+
+// WithViewStatsDisabled disables collecting stats of the partitions.
+// The stats returned by View.Stats will not contain any partition stats.
+func WithViewStatsDisabled() ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.statsDisabled = true
+	}
+}
+
+// WithViewCompactionSchedule compacts the local storages of the view at the
+// times of the schedule. See WithCompactionSchedule.
+func WithViewCompactionSchedule(schedule CompactionSchedule) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.compactionSchedule = schedule
+	}
+}
+
+// WithViewStorageRebuild rebuilds corrupted local storages of the view instead
+// of failing. See WithStorageRebuild.
+func WithViewStorageRebuild(remove storage.Remover) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.removeStorage = remove
+	}
+}
+
+// WithViewStorageConcurrency limits how many local storages of the view are opened or
+// closed concurrently. See WithStorageConcurrency.
+func WithViewStorageConcurrency(concurrency int) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.storageConcurrency = concurrency
+	}
+}
+
+// WithViewTLS enables TLS for the connections of the view's default builders. See WithTLS.
+func WithViewTLS(config *tls.Config) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.saramaConfig = append(o.saramaConfig, tlsConfig(config))
+	}
+}
+
+// WithViewSASL enables SASL authentication for the connections of the view's default
+// builders. See WithSASL.
+func WithViewSASL(sasl SASL) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.saramaConfig = append(o.saramaConfig, saslConfig(sasl))
+	}
+}
+
+// WithViewShutdownReport sets a callback receiving the summary of the view's run when
+// Run returns: the last offsets and the time it took to close the storages by partition
+// and the error returned by Run. See WithShutdownReport.
+func WithViewShutdownReport(callback func(report *ShutdownReport)) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.shutdownReport = callback
+	}
+}
+
+// WithViewSaramaConfig modifies the sarama config of the view's default builders.
+// See WithSaramaConfig.
+func WithViewSaramaConfig(modify func(config *sarama.Config)) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.saramaConfig = append(o.saramaConfig, modify)
+	}
+}
+
+// ViewRegistry collects views, e.g. the monitor server of package web/monitor.
+type ViewRegistry interface {
+	AttachView(view *View)
+}
+
+// WithViewRegistry attaches the view to the registry when it is created, so services
+// with many views can register them with a shared monitor server without wiring
+// every view manually.
+func WithViewRegistry(registry ViewRegistry) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.registry = registry
+	}
+}
+
+// WithViewOAuthBearer enables SASL OAUTHBEARER for the connections of the view's default
+// builders. See WithOAuthBearer.
+func WithViewOAuthBearer(provider sarama.AccessTokenProvider) ViewOption {
+	return WithViewSASL(SASL{Mechanism: sarama.SASLTypeOAuth, TokenProvider: provider})
+}
+
+// WithViewTableRetention declares that the table of the view is stored in a topic with
+// cleanup.policy=compact,delete and the passed retention. Values older than the retention
+// are not returned by the view. See WithTableRetention.
+func WithViewTableRetention(retention time.Duration) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.tableRetention = retention
+	}
+}
+
+// WithViewTableMigration declares that the table of the view is written by a processor
+// using WithTableVersion and sets the version the view reads. Values of older versions
+// are upgraded by the migration when they are recovered or read from the local storage,
+// see WithTableVersion and WithTableMigration. The migration may be nil if the table
+// contains no older versions.
+func WithViewTableMigration(version int, migrate func(oldVersion int, raw []byte) ([]byte, error)) ViewOption {
+	return func(o *voptions, table Table, codec Codec) {
+		o.tableVersion = version
+		o.tableMigration = migrate
 	}
 }
 
@@ -534,22 +1725,71 @@ func (opt *voptions) applyOptions(topic Table, codec Codec, opts ...ViewOption)
 	opt.log = defaultLogger
 	opt.hasher = DefaultHasher()
 	opt.backoffResetTime = defaultBackoffRestTime
+	opt.statsInterval = statsHwmUpdateInterval
 
 	for _, o := range opts {
 		o(opt, topic, codec)
 	}
 
+	if opt.tester != nil {
+		opt.clientID = opt.tester.RegisterView(Table(opt.topicPrefix)+topic, codec)
+	}
+
 	// StorageBuilder should always be set as a default option in NewView
 	if opt.builders.storage == nil {
 		return fmt.Errorf("StorageBuilder not set")
 	}
 
+	if opt.maxVersions < 0 || opt.versionRetention < 0 {
+		return fmt.Errorf("invalid view versions: max versions and retention must not be negative")
+	}
+
+	if opt.statsInterval <= 0 {
+		return fmt.Errorf("invalid stats interval %v: must be positive", opt.statsInterval)
+	}
+
+	if opt.tableRetention < 0 {
+		return fmt.Errorf("invalid table retention %v: must not be negative", opt.tableRetention)
+	}
+
+	if opt.tableVersion < 0 {
+		return fmt.Errorf("invalid table version %d: must not be negative", opt.tableVersion)
+	}
+	if opt.tableMigration != nil && opt.tableVersion == 0 {
+		return fmt.Errorf("cannot use table migration without table version")
+	}
+
+	if opt.readThroughTimeout < 0 {
+		return fmt.Errorf("invalid read-through timeout %v: must not be negative", opt.readThroughTimeout)
+	}
+
+	indexNames := make(map[string]bool)
+	for _, idx := range opt.indexes {
+		if idx.name == "" || strings.ContainsRune(idx.name, 0) {
+			return fmt.Errorf("invalid index name %q: must be non-empty and not contain NUL", idx.name)
+		}
+		if idx.extract == nil {
+			return fmt.Errorf("invalid index %s: extractor is nil", idx.name)
+		}
+		if indexNames[idx.name] {
+			return fmt.Errorf("duplicate index %s", idx.name)
+		}
+		indexNames[idx.name] = true
+	}
+
+	if opt.storageConcurrency < 0 {
+		return fmt.Errorf("invalid storage concurrency %d: must not be negative", opt.storageConcurrency)
+	}
+	if opt.storageLimiter == nil {
+		opt.storageLimiter = newStorageLimiter(opt.storageConcurrency)
+	}
+
 	if opt.builders.consumerSarama == nil {
-		opt.builders.consumerSarama = DefaultSaramaConsumerBuilder
+		opt.builders.consumerSarama = opt.saramaConfig.saramaConsumerBuilder()
 	}
 
 	if opt.builders.topicmgr == nil {
-		opt.builders.topicmgr = DefaultTopicManagerBuilder
+		opt.builders.topicmgr = opt.saramaConfig.topicManagerBuilder()
 	}
 
 	if opt.builders.backoff == nil {
@@ -574,6 +1814,14 @@ type eoptions struct {
 
 	hasher         func() hash.Hash32
 	defaultHeaders Headers
+	validators     []OutputValidator
+	auditTopic     Stream
+	saramaConfig   configModifiers
+	ensureTopic    *ensureTopicConfig
+	batchSize      int
+	linger         time.Duration
+	topicPrefix    string
+	tester         Tester
 
 	builders struct {
 		topicmgr TopicManagerBuilder
@@ -581,6 +1829,13 @@ type eoptions struct {
 	}
 }
 
+// ensureTopicConfig is the configuration of the emitter's topic
+type ensureTopicConfig struct {
+	partitions  int
+	replication int
+	configs     map[string]string
+}
+
 // WithEmitterLogger sets the logger the emitter should use. By default,
 // emitters use the standard library logger.
 func WithEmitterLogger(l Logger) EmitterOption {
@@ -627,18 +1882,113 @@ func WithEmitterTester(t Tester) EmitterOption {
 	return func(o *eoptions, topic Stream, codec Codec) {
 		o.builders.producer = t.EmitterProducerBuilder()
 		o.builders.topicmgr = t.TopicManagerBuilder()
-		t.RegisterEmitter(topic, codec)
+		// the emitter is registered once the topic prefix is known
+		o.tester = t
 	}
 }
 
 // WithEmitterDefaultHeaders configures the emitter with default headers
-// which are included with every emit.
+// which are included with every emit, e.g. to stamp the producing service and
+// its version on all messages. Headers passed to EmitWithHeaders are merged with
+// the default headers, overriding defaults of the same key.
 func WithEmitterDefaultHeaders(hdr Headers) EmitterOption {
 	return func(o *eoptions, _ Stream, _ Codec) {
 		o.defaultHeaders = hdr
 	}
 }
 
+// WithEmitterAuditTopic writes an AuditRecord of every message the emitter emits to
+// the audit topic once the message was produced. The producer of the records is the
+// client ID (see WithEmitterClientID). Auditing is best effort, failing to write a record
+// only logs an error.
+func WithEmitterAuditTopic(topic Stream) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.auditTopic = topic
+	}
+}
+
+// WithEmitterTopicPrefix prepends the prefix to the topic and the audit topic of the
+// emitter, see WithTopicPrefix.
+func WithEmitterTopicPrefix(prefix string) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.topicPrefix = prefix
+	}
+}
+
+// WithEmitterTLS enables TLS for the connections of the emitter's default builders. See WithTLS.
+func WithEmitterTLS(config *tls.Config) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.saramaConfig = append(o.saramaConfig, tlsConfig(config))
+	}
+}
+
+// WithEmitterSASL enables SASL authentication for the connections of the emitter's default
+// builders. See WithSASL.
+func WithEmitterSASL(sasl SASL) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.saramaConfig = append(o.saramaConfig, saslConfig(sasl))
+	}
+}
+
+// WithEmitterOAuthBearer enables SASL OAUTHBEARER for the connections of the emitter's
+// default builders. See WithOAuthBearer.
+func WithEmitterOAuthBearer(provider sarama.AccessTokenProvider) EmitterOption {
+	return WithEmitterSASL(SASL{Mechanism: sarama.SASLTypeOAuth, TokenProvider: provider})
+}
+
+// WithEmitterSaramaConfig modifies the sarama config of the emitter's default builders.
+// See WithSaramaConfig.
+func WithEmitterSaramaConfig(modify func(config *sarama.Config)) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.saramaConfig = append(o.saramaConfig, modify)
+	}
+}
+
+// WithEmitterValidator adds a validator for the messages of the emitter. Emitting a
+// message failing the validation returns the validation error.
+// Multiple validators can be added, they are run in order.
+func WithEmitterValidator(validate OutputValidator) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.validators = append(o.validators, validate)
+	}
+}
+
+// WithEmitterEnsureTopic makes NewEmitter create the emitter's topic with the number of
+// partitions, the replication factor and the topic configs, e.g. retention.ms, instead
+// of relying on the broker's auto-create defaults. If the topic exists, its configuration
+// is checked according to the topic manager's MismatchBehavior.
+// If partitions is 0, the topic is not created, but NewEmitter fails if it does not exist.
+func WithEmitterEnsureTopic(partitions, replication int, configs map[string]string) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.ensureTopic = &ensureTopicConfig{
+			partitions:  partitions,
+			replication: replication,
+			configs:     configs,
+		}
+	}
+}
+
+// WithEmitterBatchSize sets the number of messages the emitter's default producer
+// collects before sending them to Kafka (sarama's Producer.Flush.Messages), e.g. for
+// bulk loads. A batch size requires a linger (see WithEmitterLinger), which sends
+// batches that do not fill up; NewEmitter fails otherwise. The option has no effect if
+// the producer is replaced by WithEmitterProducerBuilder.
+func WithEmitterBatchSize(size int) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.batchSize = size
+	}
+}
+
+// WithEmitterLinger sets the time the emitter's default producer collects messages
+// before sending them to Kafka (sarama's Producer.Flush.Frequency). Emitter.Flush and
+// Emitter.Finish wait for the collected messages, they do not send them early. The
+// option has no effect if the producer is replaced by WithEmitterProducerBuilder.
+func WithEmitterLinger(linger time.Duration) EmitterOption {
+	return func(o *eoptions, _ Stream, _ Codec) {
+		o.linger = linger
+	}
+}
+
 func (opt *eoptions) applyOptions(topic Stream, codec Codec, opts ...EmitterOption) {
 	opt.clientID = defaultClientID
 	opt.log = defaultLogger
@@ -648,17 +1998,138 @@ func (opt *eoptions) applyOptions(topic Stream, codec Codec, opts ...EmitterOpti
 		o(opt, topic, codec)
 	}
 
+	if opt.tester != nil {
+		opt.tester.RegisterEmitter(Stream(opt.topicPrefix)+topic, codec)
+	}
+
+	if opt.batchSize > 1 || opt.linger > 0 {
+		size, linger := opt.batchSize, opt.linger
+		opt.saramaConfig = append(opt.saramaConfig, func(config *sarama.Config) {
+			if size > 1 {
+				config.Producer.Flush.Messages = size
+			}
+			if linger > 0 {
+				config.Producer.Flush.Frequency = linger
+			}
+		})
+	}
+
 	// config not set, use default one
+	if opt.builders.producer == nil {
+		opt.builders.producer = opt.saramaConfig.producerBuilder()
+	}
+	if opt.builders.topicmgr == nil {
+		opt.builders.topicmgr = opt.saramaConfig.topicManagerBuilder()
+	}
+}
+
+// AskerOption defines a configuration option to be used when creating an
+// asker.
+type AskerOption func(*aoptions)
+
+// asker options
+type aoptions struct {
+	log      logger
+	clientID string
+	hasher   func() hash.Hash32
+
+	requestTopic  Stream
+	requestCodec  Codec
+	responseTopic Stream
+	responseCodec Codec
+
+	builders struct {
+		producer       ProducerBuilder
+		consumerSarama SaramaConsumerBuilder
+		topicmgr       TopicManagerBuilder
+	}
+}
+
+// WithAskerLogger sets the logger the asker should use. By default,
+// askers use the standard library logger.
+func WithAskerLogger(l Logger) AskerOption {
+	return func(o *aoptions) {
+		if prefixLogger, ok := l.(logger); ok {
+			o.log = prefixLogger
+		} else {
+			o.log = wrapLogger(l)
+		}
+	}
+}
+
+// WithAskerClientID defines the client ID used to identify with Kafka.
+func WithAskerClientID(clientID string) AskerOption {
+	return func(o *aoptions) {
+		o.clientID = clientID
+	}
+}
+
+// WithAskerHasher sets the hash function that assigns keys to partitions.
+func WithAskerHasher(hasher func() hash.Hash32) AskerOption {
+	return func(o *aoptions) {
+		o.hasher = hasher
+	}
+}
+
+// WithAskerProducerBuilder replaces the default producer builder.
+func WithAskerProducerBuilder(pb ProducerBuilder) AskerOption {
+	return func(o *aoptions) {
+		o.builders.producer = pb
+	}
+}
+
+// WithAskerConsumerSaramaBuilder replaces the default sarama consumer builder
+func WithAskerConsumerSaramaBuilder(cb SaramaConsumerBuilder) AskerOption {
+	return func(o *aoptions) {
+		o.builders.consumerSarama = cb
+	}
+}
+
+// WithAskerTopicManagerBuilder replaces the default topic manager builder.
+func WithAskerTopicManagerBuilder(tmb TopicManagerBuilder) AskerOption {
+	return func(o *aoptions) {
+		o.builders.topicmgr = tmb
+	}
+}
+
+// WithAskerTester configures the asker to use passed tester.
+// This is used for component tests
+func WithAskerTester(t Tester) AskerOption {
+	return func(o *aoptions) {
+		o.builders.producer = t.EmitterProducerBuilder()
+		o.builders.topicmgr = t.TopicManagerBuilder()
+		o.builders.consumerSarama = t.ConsumerBuilder()
+		t.RegisterEmitter(o.requestTopic, o.requestCodec)
+		// the response topic is consumed like a table by a view
+		o.clientID = t.RegisterView(Table(o.responseTopic), o.responseCodec)
+	}
+}
+
+func (opt *aoptions) applyOptions(requestTopic Stream, requestCodec Codec, responseTopic Stream, responseCodec Codec, opts ...AskerOption) {
+	opt.clientID = fmt.Sprintf("goka-asker-%s", responseTopic)
+	opt.log = defaultLogger
+	opt.hasher = DefaultHasher()
+	opt.requestTopic, opt.requestCodec = requestTopic, requestCodec
+	opt.responseTopic, opt.responseCodec = responseTopic, responseCodec
+
+	for _, o := range opts {
+		o(opt)
+	}
+
 	if opt.builders.producer == nil {
 		opt.builders.producer = DefaultProducerBuilder
 	}
+	if opt.builders.consumerSarama == nil {
+		opt.builders.consumerSarama = DefaultSaramaConsumerBuilder
+	}
 	if opt.builders.topicmgr == nil {
 		opt.builders.topicmgr = DefaultTopicManagerBuilder
 	}
 }
 
 type ctxOptions struct {
-	emitHeaders Headers
+	emitHeaders      Headers
+	consistencyToken func(ConsistencyToken)
 }
 
 // ContextOption defines a configuration option to be used when performing
@@ -677,8 +2148,127 @@ func WithCtxEmitHeaders(hdr Headers) ContextOption {
 	}
 }
 
+// WithCtxConsistencyToken passes the consistency token of a table write to cb once the
+// write is acknowledged by Kafka, e.g. to return it to the client that triggered the
+// write, so it can read its own write with View.GetAtLeast. It is only used by
+// Context.SetValue. cb is called from another goroutine than the callback and is
+// not called if the write fails or the group table is ephemeral.
+func WithCtxConsistencyToken(cb func(token ConsistencyToken)) ContextOption {
+	return func(opts *ctxOptions) {
+		opts.consistencyToken = cb
+	}
+}
+
 func (opt *ctxOptions) applyOptions(opts ...ContextOption) {
 	for _, o := range opts {
 		o(opt)
 	}
 }
+
+// CheckpointsOption defines a configuration option to be used when creating
+// checkpoints.
+type CheckpointsOption func(*cpoptions)
+
+// checkpoints options
+type cpoptions struct {
+	viewOptions    []ViewOption
+	emitterOptions []EmitterOption
+	timeout        time.Duration
+}
+
+// WithCheckpointsViewOptions passes options to the view reading the checkpoints. By
+// default, the view stores the checkpoints in memory.
+func WithCheckpointsViewOptions(options ...ViewOption) CheckpointsOption {
+	return func(o *cpoptions) {
+		o.viewOptions = append(o.viewOptions, options...)
+	}
+}
+
+// WithCheckpointsEmitterOptions passes options to the emitter writing the checkpoints.
+func WithCheckpointsEmitterOptions(options ...EmitterOption) CheckpointsOption {
+	return func(o *cpoptions) {
+		o.emitterOptions = append(o.emitterOptions, options...)
+	}
+}
+
+// WithCheckpointsTimeout sets how long writing a checkpoint waits until it is loaded.
+// Defaults to 10 seconds.
+func WithCheckpointsTimeout(timeout time.Duration) CheckpointsOption {
+	return func(o *cpoptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithCheckpointsTester configures the checkpoints to use the tester.
+func WithCheckpointsTester(t Tester) CheckpointsOption {
+	return func(o *cpoptions) {
+		o.viewOptions = append(o.viewOptions, WithViewTester(t))
+		o.emitterOptions = append(o.emitterOptions, WithEmitterTester(t))
+	}
+}
+
+func (opt *cpoptions) applyOptions(opts ...CheckpointsOption) {
+	opt.timeout = 10 * time.Second
+
+	for _, o := range opts {
+		o(opt)
+	}
+}
+
+// BackfillOption defines a configuration option to be used when creating a backfill.
+type BackfillOption func(*bfoptions)
+
+// backfill options
+type bfoptions struct {
+	processorOptions []ProcessorOption
+	start            time.Time
+	emitOutputs      bool
+	onOutput         ReadOnlyEmitCallback
+}
+
+// WithBackfillProcessorOptions passes options to the processor running the backfill.
+func WithBackfillProcessorOptions(options ...ProcessorOption) BackfillOption {
+	return func(o *bfoptions) {
+		o.processorOptions = append(o.processorOptions, options...)
+	}
+}
+
+// WithBackfillStart starts the backfill at the first messages of the input streams at
+// or after the start time. By default, the backfill starts at the oldest messages.
+// Tables are always recovered completely.
+func WithBackfillStart(start time.Time) BackfillOption {
+	return func(o *bfoptions) {
+		o.start = start
+	}
+}
+
+// WithBackfillEmitOutputs emits the messages of the backfill to the output topics of
+// the group graph. By default, the messages are not emitted, so the consumers of the
+// outputs do not receive the messages of the replayed inputs a second time.
+// Use it only if the outputs are topics of the backfilled version, too.
+func WithBackfillEmitOutputs() BackfillOption {
+	return func(o *bfoptions) {
+		o.emitOutputs = true
+	}
+}
+
+// WithBackfillOnOutput sets a callback receiving the messages the backfill does not
+// emit to the output topics. By default, they are logged.
+func WithBackfillOnOutput(onOutput ReadOnlyEmitCallback) BackfillOption {
+	return func(o *bfoptions) {
+		o.onOutput = onOutput
+	}
+}
+
+// WithBackfillTester configures the backfill to use the tester.
+func WithBackfillTester(t Tester) BackfillOption {
+	return func(o *bfoptions) {
+		o.processorOptions = append(o.processorOptions, WithTester(t))
+	}
+}
+
+func (opt *bfoptions) applyOptions(opts ...BackfillOption) {
+	for _, o := range opts {
+		o(opt)
+	}
+}
@@ -1,10 +1,14 @@
 package goka
 
 import (
+	"crypto/tls"
 	"fmt"
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/codec"
 	"github.com/lovoo/goka/internal/test"
 	"github.com/lovoo/goka/storage"
 )
@@ -27,3 +31,192 @@ func newMockOptions(t *testing.T) *poptions {
 	fmt.Printf("%+v\n", opts)
 	return opts
 }
+
+func TestOptions_ConsumerGroupID(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil))
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.consumerGroupID, "group")
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithConsumerGroupID("group-canary"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.consumerGroupID, "group-canary")
+}
+
+func TestOptions_Stats(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil))
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.statsInterval, statsHwmUpdateInterval)
+	test.AssertFalse(t, opts.statsDisabled)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithStatsInterval(time.Minute), WithStatsDisabled())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.statsInterval, time.Minute)
+	test.AssertTrue(t, opts.statsDisabled)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithStatsInterval(0))
+	test.AssertNotNil(t, err)
+}
+
+func TestOptions_MaxLoopbackHops(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil), Loop(new(codec.String), nil))
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithMaxLoopbackHops(3))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.maxLoopbackHops, 3)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithMaxLoopbackHops(-1))
+	test.AssertNotNil(t, err)
+
+	opts = new(poptions)
+	err = opts.applyOptions(DefineGroup("group", Input("input", new(codec.String), nil)), WithStorageBuilder(nullStorageBuilder()), WithMaxLoopbackHops(3))
+	test.AssertNotNil(t, err)
+}
+
+func TestOptions_TableRetention(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil), Persist(new(codec.String)))
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithTableRetention(time.Hour))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.tableRetention, time.Hour)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithTableRetention(-time.Hour))
+	test.AssertNotNil(t, err)
+
+	opts = new(poptions)
+	err = opts.applyOptions(DefineGroup("group", Input("input", new(codec.String), nil)), WithStorageBuilder(nullStorageBuilder()), WithTableRetention(time.Hour))
+	test.AssertNotNil(t, err)
+}
+
+func TestOptions_HotKeyDetection(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil))
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithHotKeyDetection(100, 0.1, nil))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.hotKeyCapacity, 100)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithHotKeyDetection(100, 0, nil))
+	test.AssertNotNil(t, err)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithHotKeyDetection(100, 0.1, nil), WithStatsDisabled())
+	test.AssertNotNil(t, err)
+}
+
+func TestOptions_ProvenanceHeaders(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil))
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()))
+	test.AssertNil(t, err)
+	test.AssertNil(t, opts.producerDefaultHeaders)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()),
+		WithProvenanceHeaders(),
+		WithInstanceID("instance-1"),
+		WithInstanceVersion("v2"),
+		WithOutputDefaultHeaders(Headers{"service": []byte("svc"), ProvenanceGroupHeader: []byte("other")}),
+	)
+	test.AssertNil(t, err)
+	hdr := opts.producerDefaultHeaders
+	test.AssertEqual(t, string(hdr[ProvenanceInstanceHeader]), "instance-1")
+	test.AssertEqual(t, string(hdr[ProvenanceInstanceVersionHeader]), "v2")
+	test.AssertEqual(t, string(hdr[ProvenanceGroupHeader]), "other")
+	test.AssertEqual(t, string(hdr["service"]), "svc")
+	test.AssertEqual(t, string(hdr[ProvenanceLibraryVersionHeader]), libraryVersion())
+}
+
+func TestOptions_TLS(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil))
+	tlsConfig := &tls.Config{ServerName: "kafka"}
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(opts.saramaConfig), 0)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg,
+		WithStorageBuilder(nullStorageBuilder()),
+		WithHotStandby(),
+		WithStandbyPromotion(nil),
+		WithTLS(tlsConfig),
+	)
+	test.AssertNil(t, err)
+	config := opts.saramaConfig.config()
+	test.AssertTrue(t, config.Net.TLS.Enable)
+	test.AssertTrue(t, config.Net.TLS.Config == tlsConfig)
+	test.AssertFalse(t, globalConfig.Net.TLS.Enable)
+	// the consumer group config of the promotion is modified too
+	test.AssertTrue(t, opts.groupConfig.Net.TLS.Enable)
+
+	vopts := new(voptions)
+	err = vopts.applyOptions("table", new(codec.String), WithViewStorageBuilder(nullStorageBuilder()), WithViewTLS(nil))
+	test.AssertNil(t, err)
+	test.AssertTrue(t, vopts.saramaConfig.config().Net.TLS.Enable)
+
+	eopts := new(eoptions)
+	eopts.applyOptions("topic", new(codec.String), WithEmitterTLS(tlsConfig))
+	test.AssertTrue(t, eopts.saramaConfig.config().Net.TLS.Config == tlsConfig)
+}
+
+func TestOptions_SaramaConfig(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil))
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg,
+		WithStorageBuilder(nullStorageBuilder()),
+		WithHotStandby(),
+		WithStandbyPromotion(nil),
+		WithSaramaConfig(func(config *sarama.Config) {
+			config.Version = sarama.V2_4_0_0
+		}),
+		WithConsumerSaramaConfig(func(config *sarama.Config) {
+			config.Consumer.Fetch.Default = 4 << 20
+		}),
+		WithProducerSaramaConfig(func(config *sarama.Config) {
+			config.Producer.Compression = sarama.CompressionZSTD
+		}),
+	)
+	test.AssertNil(t, err)
+
+	consumerConfig := opts.saramaConfig.with(opts.consumerConfig).config()
+	test.AssertEqual(t, consumerConfig.Version, sarama.V2_4_0_0)
+	test.AssertEqual(t, consumerConfig.Consumer.Fetch.Default, int32(4<<20))
+	test.AssertEqual(t, consumerConfig.Producer.Compression, globalConfig.Producer.Compression)
+	test.AssertEqual(t, opts.groupConfig.Consumer.Fetch.Default, int32(4<<20))
+
+	producerConfig := opts.saramaConfig.with(opts.producerConfig).config()
+	test.AssertEqual(t, producerConfig.Version, sarama.V2_4_0_0)
+	test.AssertEqual(t, producerConfig.Producer.Compression, sarama.CompressionZSTD)
+	test.AssertEqual(t, producerConfig.Consumer.Fetch.Default, globalConfig.Consumer.Fetch.Default)
+	test.AssertEqual(t, len(opts.saramaConfig), 1)
+
+	vopts := new(voptions)
+	err = vopts.applyOptions("table", new(codec.String), WithViewStorageBuilder(nullStorageBuilder()), WithViewSaramaConfig(func(config *sarama.Config) {
+		config.Version = sarama.V2_4_0_0
+	}))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, vopts.saramaConfig.config().Version, sarama.V2_4_0_0)
+
+	eopts := new(eoptions)
+	eopts.applyOptions("topic", new(codec.String), WithEmitterSaramaConfig(func(config *sarama.Config) {
+		config.Producer.Compression = sarama.CompressionZSTD
+	}))
+	test.AssertEqual(t, eopts.saramaConfig.config().Producer.Compression, sarama.CompressionZSTD)
+}
@@ -0,0 +1,232 @@
+package goka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// OutboxIDHeader is the header containing the ID of a message forwarded from the
+	// outbox. The ID is stable when a message is forwarded multiple times, e.g. after
+	// a crash of the processor, so it can be used to deduplicate messages.
+	OutboxIDHeader = "goka-outbox-id"
+
+	defaultOutboxRetryInterval = 5 * time.Second
+)
+
+// outboxEntry is a message in the outbox waiting to be forwarded
+type outboxEntry struct {
+	Topic   string  `json:"topic"`
+	Key     string  `json:"key"`
+	Value   []byte  `json:"value"`
+	Headers Headers `json:"headers,omitempty"`
+}
+
+// outbox stores messages for outbox streams in the outbox table of a partition
+// and forwards them once the input message that created them is committed.
+// All access to the table storage is synchronized by the outbox, as the processing
+// loop and the forwarder use it concurrently.
+type outbox struct {
+	m     sync.Mutex
+	table *PartitionTable
+	topic string
+
+	emitter          emitter
+	trackOutputStats func(ctx context.Context, topic string, size int)
+	retryInterval    time.Duration
+	log              logger
+
+	// committed entries to be forwarded
+	pending map[string]*outboxEntry
+	notify  chan struct{}
+}
+
+func newOutbox(table *PartitionTable, emitter emitter, trackOutputStats func(ctx context.Context, topic string, size int), retryInterval time.Duration, log logger) *outbox {
+	return &outbox{
+		table:            table,
+		topic:            table.topic,
+		emitter:          emitter,
+		trackOutputStats: trackOutputStats,
+		retryInterval:    retryInterval,
+		log:              log,
+		pending:          make(map[string]*outboxEntry),
+		notify:           make(chan struct{}, 1),
+	}
+}
+
+// outboxID creates the ID of the n-th outbox message emitted while processing
+// the passed input message. Offsets and counters are padded to forward messages in
+// input order.
+func outboxID(topic string, partition int32, offset int64, n int) string {
+	return fmt.Sprintf("%s/%d/%020d/%010d", topic, partition, offset, n)
+}
+
+// store writes the entry to the local outbox table and returns its encoded
+// value that has to be written to the outbox table topic.
+func (o *outbox) store(id string, entry *outboxEntry) ([]byte, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding outbox entry: %v", err)
+	}
+
+	o.m.Lock()
+	defer o.m.Unlock()
+	if err := o.table.Set(id, data); err != nil {
+		return nil, fmt.Errorf("error storing outbox entry: %v", err)
+	}
+	return data, nil
+}
+
+// storeNewestOffset stores the offset of an outbox table write
+func (o *outbox) storeNewestOffset(offset int64) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.table.storeNewestOffset(offset)
+}
+
+// enqueue schedules committed entries to be forwarded
+func (o *outbox) enqueue(entries map[string]*outboxEntry) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	for id, entry := range entries {
+		o.pending[id] = entry
+	}
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+}
+
+// load enqueues all entries of the recovered outbox table. Those were committed
+// by a previous run but not forwarded yet.
+func (o *outbox) load() error {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	it, err := o.table.Iterator()
+	if err != nil {
+		return fmt.Errorf("error iterating outbox: %v", err)
+	}
+	defer it.Release()
+
+	for it.Next() {
+		data, err := it.Value()
+		if err != nil {
+			return fmt.Errorf("error reading outbox entry: %v", err)
+		}
+		var entry outboxEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("error decoding outbox entry %s: %v", string(it.Key()), err)
+		}
+		o.pending[string(it.Key())] = &entry
+	}
+	if len(o.pending) > 0 {
+		select {
+		case o.notify <- struct{}{}:
+		default:
+		}
+	}
+	return it.Err()
+}
+
+// run forwards pending entries until the context is done
+func (o *outbox) run(ctx context.Context) error {
+	o.log.Debugf("starting outbox forwarder")
+	defer o.log.Debugf("outbox forwarder stopped")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-o.notify:
+		}
+
+		if err := o.forwardPending(ctx); err != nil {
+			o.log.Printf("error forwarding outbox, retrying in %v: %v", o.retryInterval, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(o.retryInterval):
+			}
+			// retry even if nothing new was committed
+			select {
+			case o.notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// forwardPending forwards all pending entries in order of their IDs and removes
+// them from the outbox. It stops at the first entry failing to be forwarded.
+func (o *outbox) forwardPending(ctx context.Context) error {
+	o.m.Lock()
+	ids := make([]string, 0, len(o.pending))
+	for id := range o.pending {
+		ids = append(ids, id)
+	}
+	o.m.Unlock()
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		o.m.Lock()
+		entry := o.pending[id]
+		o.m.Unlock()
+
+		if err := o.forward(ctx, id, entry); err != nil {
+			return err
+		}
+		// keep the entry if we stopped before the result was known
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		o.m.Lock()
+		delete(o.pending, id)
+		err := o.table.Delete(id)
+		o.m.Unlock()
+		if err != nil {
+			return fmt.Errorf("error deleting outbox entry %s: %v", id, err)
+		}
+
+		// If the tombstone gets lost, the entry will be forwarded again after the
+		// next recovery, which is tolerable as consumers can deduplicate it.
+		o.emitter(o.topic, id, nil, nil).Then(func(err error) {
+			if err != nil {
+				o.log.Printf("error deleting outbox entry %s from %s: %v", id, o.topic, err)
+			}
+		})
+	}
+	return nil
+}
+
+// forward emits the entry and waits for the result
+func (o *outbox) forward(ctx context.Context, id string, entry *outboxEntry) error {
+	hdr := entry.Headers.Merged(Headers{OutboxIDHeader: []byte(id)})
+
+	done := make(chan error, 1)
+	o.emitter(entry.Topic, entry.Key, entry.Value, hdr).Then(func(err error) {
+		done <- err
+	})
+	o.trackOutputStats(ctx, entry.Topic, len(entry.Value))
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("error forwarding outbox entry %s to %s: %v", id, entry.Topic, err)
+		}
+	}
+	return nil
+}
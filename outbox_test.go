@@ -0,0 +1,15 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestOutboxID(t *testing.T) {
+	test.AssertEqual(t, outboxID("topic", 1, 42, 3), "topic/1/00000000000000000042/0000000003")
+
+	// ids sort in the order the messages were emitted
+	test.AssertTrue(t, outboxID("topic", 1, 42, 9) < outboxID("topic", 1, 42, 10))
+	test.AssertTrue(t, outboxID("topic", 1, 42, 10) < outboxID("topic", 1, 43, 0))
+}
@@ -0,0 +1,22 @@
+package goka
+
+import "context"
+
+// OutputValidator validates a message before it is emitted. Messages failing the
+// validation are not emitted.
+type OutputValidator func(key string, value interface{}) error
+
+// validateOutput runs the validators of topic on the message. Rejected messages
+// are logged and counted in the output stats of the topic.
+func (pp *PartitionProcessor) validateOutput(ctx context.Context, topic string, key string, value interface{}) bool {
+	for _, validate := range pp.opts.outputValidators[topic] {
+		if err := validate(key, value); err != nil {
+			pp.log.Printf("rejecting message for key %s to %s: %v", key, topic, err)
+			pp.enqueueStatsUpdate(ctx, func() {
+				pp.stats.trackRejectedOutput(topic)
+			})
+			return false
+		}
+	}
+	return true
+}
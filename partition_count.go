@@ -0,0 +1,125 @@
+package goka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPartitionCountChanged is returned by Processor.Run if the number of partitions
+// of a consumed topic changed while the processor was running, see WithPartitionCountCheck.
+var ErrPartitionCountChanged = errors.New("partition count changed")
+
+// PartitionCountPolicy defines how a processor reacts to topics whose number of
+// partitions changed at runtime.
+type PartitionCountPolicy int
+
+const (
+	// PartitionCountFail stops the processor with ErrPartitionCountChanged. The topics
+	// of the group have to be adjusted before the processor can be started again.
+	PartitionCountFail PartitionCountPolicy = 0 + iota
+	// PartitionCountExtend extends the group table, loop and outbox topics to the new
+	// number of partitions of the input topics and then stops the processor with
+	// ErrPartitionCountChanged, so it consumes all partitions when it is started again.
+	// The partitions of keys change with the number of partitions, so the state of keys
+	// moving to another partition is not found anymore. Only use it if the group can
+	// rebuild or tolerate missing state.
+	PartitionCountExtend
+)
+
+// partitionExtender is implemented by topic managers that can add partitions to
+// existing topics.
+type partitionExtender interface {
+	ExtendPartitions(topic string, npar int) error
+}
+
+// ExtendPartitions increases the number of partitions of the topic to npar.
+func (m *topicManager) ExtendPartitions(topic string, npar int) error {
+	if err := m.admin.CreatePartitions(topic, int32(npar), nil, false); err != nil {
+		return fmt.Errorf("error extending topic %s to %d partitions: %v", topic, npar, err)
+	}
+	return nil
+}
+
+// watchPartitionCounts checks the partition counts of the copartitioned topics every
+// interval until the context is done or a count changed.
+func (g *Processor) watchPartitionCounts(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := g.checkPartitionCounts(); err != nil {
+				g.log.Printf("%v", err)
+				return err
+			}
+		}
+	}
+}
+
+// checkPartitionCounts returns an error wrapping ErrPartitionCountChanged if a copartitioned
+// topic does not have the partition count of the processor anymore. Errors fetching the
+// partitions are logged only, as the check is retried.
+func (g *Processor) checkPartitionCounts() error {
+	var (
+		changed []string
+		newPar  = -1
+	)
+	for _, topic := range g.graph.copartitioned().Topics() {
+		partitions, err := g.tmgr.Partitions(topic)
+		if err != nil {
+			g.log.Printf("error checking partitions of topic %s: %v", topic, err)
+			return nil
+		}
+		if len(partitions) == g.partitionCount {
+			continue
+		}
+		changed = append(changed, fmt.Sprintf("%s (%d)", topic, len(partitions)))
+		if newPar == -1 {
+			newPar = len(partitions)
+		} else if newPar != len(partitions) {
+			newPar = 0
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("%w: topics %v do not have %d partitions anymore", ErrPartitionCountChanged, changed, g.partitionCount)
+	if g.opts.partitionCountPolicy != PartitionCountExtend {
+		return err
+	}
+	// all copartitioned topics must have the same new count to be extended
+	if newPar < g.partitionCount || len(changed) != len(g.graph.copartitioned().Topics()) {
+		return fmt.Errorf("%w, cannot extend the topics of the group: input topics are not copartitioned", err)
+	}
+	extender, ok := g.tmgr.(partitionExtender)
+	if !ok {
+		return fmt.Errorf("%w, cannot extend the topics of the group: topic manager does not support extending topics", err)
+	}
+	for _, topic := range g.ownedTopics() {
+		if extendErr := extender.ExtendPartitions(topic, newPar); extendErr != nil {
+			return fmt.Errorf("%w, cannot extend the topics of the group: %v", err, extendErr)
+		}
+	}
+	return fmt.Errorf("%w, extended topics %v to %d partitions, restart the processor", err, g.ownedTopics(), newPar)
+}
+
+// ownedTopics returns the topics created by the processor, which have the partition
+// count of the input topics.
+func (g *Processor) ownedTopics() []string {
+	var topics []string
+	for _, ls := range g.graph.loopStreams() {
+		topics = append(topics, ls.Topic())
+	}
+	if gt := g.graph.GroupTable(); gt != nil && !g.graph.isEphemeralTable() {
+		topics = append(topics, gt.Topic())
+	}
+	if len(g.graph.OutboxStreams()) > 0 {
+		topics = append(topics, outboxName(g.graph.Group()))
+	}
+	return topics
+}
@@ -0,0 +1,75 @@
+package goka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+type extendingTopicManager struct {
+	*MockTopicManager
+	extended map[string]int
+}
+
+func (m *extendingTopicManager) ExtendPartitions(topic string, npar int) error {
+	m.extended[topic] = npar
+	return nil
+}
+
+func TestProcessor_checkPartitionCounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newProcessor := func(policy PartitionCountPolicy) (*Processor, *extendingTopicManager) {
+		tmgr := &extendingTopicManager{MockTopicManager: NewMockTopicManager(ctrl), extended: make(map[string]int)}
+		opts := new(poptions)
+		opts.partitionCountPolicy = policy
+		return &Processor{
+			graph: DefineGroup("group",
+				Input("input", new(codec.String), nil),
+				Loop(new(codec.String), nil),
+				Persist(new(codec.String)),
+			),
+			partitionCount: 2,
+			tmgr:           tmgr,
+			opts:           opts,
+			log:            defaultLogger,
+		}, tmgr
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		proc, tmgr := newProcessor(PartitionCountFail)
+		tmgr.EXPECT().Partitions("input").Return([]int32{0, 1}, nil)
+		test.AssertNil(t, proc.checkPartitionCounts())
+	})
+	t.Run("error", func(t *testing.T) {
+		proc, tmgr := newProcessor(PartitionCountFail)
+		tmgr.EXPECT().Partitions("input").Return(nil, errors.New("no metadata"))
+		test.AssertNil(t, proc.checkPartitionCounts())
+	})
+	t.Run("fail", func(t *testing.T) {
+		proc, tmgr := newProcessor(PartitionCountFail)
+		tmgr.EXPECT().Partitions("input").Return([]int32{0, 1, 2}, nil)
+		err := proc.checkPartitionCounts()
+		test.AssertTrue(t, errors.Is(err, ErrPartitionCountChanged))
+		test.AssertEqual(t, len(tmgr.extended), 0)
+	})
+	t.Run("extend", func(t *testing.T) {
+		proc, tmgr := newProcessor(PartitionCountExtend)
+		tmgr.EXPECT().Partitions("input").Return([]int32{0, 1, 2, 3}, nil)
+		err := proc.checkPartitionCounts()
+		test.AssertTrue(t, errors.Is(err, ErrPartitionCountChanged))
+		test.AssertEqual(t, tmgr.extended, map[string]int{"group-loop": 4, "group-table": 4})
+	})
+	t.Run("extend-unsupported", func(t *testing.T) {
+		proc, tmgr := newProcessor(PartitionCountExtend)
+		proc.tmgr = tmgr.MockTopicManager
+		tmgr.EXPECT().Partitions("input").Return([]int32{0, 1, 2, 3}, nil)
+		err := proc.checkPartitionCounts()
+		test.AssertTrue(t, errors.Is(err, ErrPartitionCountChanged))
+		test.AssertStringContains(t, err.Error(), "does not support")
+	})
+}
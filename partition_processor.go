@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/headers"
 	"github.com/lovoo/goka/multierr"
 )
 
@@ -44,7 +45,14 @@ type PartitionProcessor struct {
 
 	log logger
 
-	table   *PartitionTable
+	table *PartitionTable
+	// tableMutex serializes modifications of the table by the processing loop,
+	// the table gc and the table repair
+	tableMutex sync.Mutex
+	// inflight tracks the messages whose emits are not done yet
+	inflight sync.WaitGroup
+
+	outbox  *outbox
 	joins   map[string]*PartitionTable
 	lookups map[string]*View
 	graph   *GroupGraph
@@ -53,8 +61,10 @@ type PartitionProcessor struct {
 
 	partition int32
 
-	input       chan *sarama.ConsumerMessage
+	inputs      *prioritizedInputs
 	inputTopics []string
+	// lagGate pauses processing while lookup tables lag behind. It is optional.
+	lagGate *lookupLagGate
 
 	runnerGroup       *multierr.ErrGroup
 	cancelRunnerGroup func()
@@ -64,6 +74,9 @@ type PartitionProcessor struct {
 	runnerErrors chan error
 
 	runMode PPRunMode
+	// isSetup indicates that the partition setup callback was executed
+	// successfully, so the teardown has to be called on stop.
+	isSetup bool
 
 	consumer sarama.Consumer
 	tmgr     TopicManager
@@ -73,9 +86,13 @@ type PartitionProcessor struct {
 	responseStats   chan *PartitionProcStats
 	updateStats     chan func()
 	cancelStatsLoop context.CancelFunc
+	// hotKeys detects hot keys in the stats loop. It is optional.
+	hotKeys *hotKeyDetector
 
 	commit   commitCallback
 	producer Producer
+	// commitMeta is the metadata of the commits, computed once per session
+	commitMeta string
 
 	opts *poptions
 }
@@ -98,7 +115,7 @@ func newPartitionProcessor(partition int32,
 	for _, stream := range graph.InputStreams() {
 		topicMap[stream.Topic()] = true
 	}
-	if loop := graph.LoopStream(); loop != nil {
+	for _, loop := range graph.loopStreams() {
 		topicMap[loop.Topic()] = true
 	}
 
@@ -114,14 +131,25 @@ func newPartitionProcessor(partition int32,
 	for _, output := range graph.OutputStreams() {
 		outputList = append(outputList, output.Topic())
 	}
-	if graph.LoopStream() != nil {
-		outputList = append(outputList, graph.LoopStream().Topic())
+	for _, loop := range graph.loopStreams() {
+		outputList = append(outputList, loop.Topic())
 	}
 
 	if graph.GroupTable() != nil {
 		outputList = append(outputList, graph.GroupTable().Topic())
 	}
 
+	if len(graph.OutboxStreams()) > 0 {
+		outputList = append(outputList, outboxName(graph.Group()))
+		outputList = append(outputList, graph.OutboxStreams().Topics()...)
+	}
+
+	for _, s := range opts.inputSamplers {
+		if s.mirrorTopic != "" {
+			outputList = append(outputList, s.mirrorTopic)
+		}
+	}
+
 	log := logger.Prefix(fmt.Sprintf("PartitionProcessor (%d)", partition))
 
 	statsLoopCtx, cancel := context.WithCancel(context.Background())
@@ -137,7 +165,7 @@ func newPartitionProcessor(partition int32,
 		producer:        producer,
 		tmgr:            tmgr,
 		joins:           make(map[string]*PartitionTable),
-		input:           make(chan *sarama.ConsumerMessage, opts.partitionChannelSize),
+		inputs:          newPrioritizedInputs(topicList, opts.inputPriorities, opts.inputQuotas, opts.partitionChannelSize),
 		inputTopics:     topicList,
 		graph:           graph,
 		stats:           newPartitionProcStats(topicList, outputList),
@@ -146,10 +174,17 @@ func newPartitionProcessor(partition int32,
 		updateStats:     make(chan func(), 10),
 		cancelStatsLoop: cancel,
 		commit:          commit,
+		commitMeta:      opts.commitMetadata(time.Now()),
 		runMode:         runMode,
 	}
 
-	go partProc.runStatsLoop(statsLoopCtx)
+	if opts.hotKeyCapacity > 0 {
+		partProc.hotKeys = newHotKeyDetector(opts.hotKeyCapacity, opts.hotKeyMinShare, opts.hotKeyCallback)
+	}
+
+	if !opts.statsDisabled {
+		go partProc.runStatsLoop(statsLoopCtx)
+	}
 
 	if graph.GroupTable() != nil {
 		partProc.table = newPartitionTable(graph.GroupTable().Topic(),
@@ -162,13 +197,51 @@ func newPartitionProcessor(partition int32,
 			backoff,
 			backoffResetTime,
 		)
+		partProc.table.ephemeral = graph.isEphemeralTable()
+		partProc.table.configureStats(opts.statsInterval, opts.statsDisabled)
+		partProc.table.removeStorage = opts.removeStorage
+		partProc.table.storageLimiter = opts.storageLimiter
+		// the offset index uses the unwrapped storage builder, so configure it first
+		if opts.tableOffsetIndex {
+			partProc.table.configureOffsetIndex()
+		}
+		if opts.tableTTLInterval > 0 {
+			partProc.table.configureKeyTTL()
+		}
+		partProc.table.configureRetention(opts.tableRetention)
+		partProc.table.configureMigration(opts.tableVersion, opts.tableMigration)
+		if opts.recoveryHook != nil {
+			partProc.table.configureRecoveryHook(opts.recoveryHook)
+		}
+		if opts.readOnly {
+			partProc.table.configureReadOnly()
+		}
+	}
+
+	if len(graph.OutboxStreams()) > 0 {
+		table := newPartitionTable(outboxName(graph.Group()),
+			partition,
+			consumer,
+			tmgr,
+			DefaultUpdate,
+			opts.builders.storage,
+			log.Prefix("Outbox"),
+			backoff,
+			backoffResetTime,
+		)
+		table.configureStats(opts.statsInterval, opts.statsDisabled)
+		table.storageLimiter = opts.storageLimiter
+		if opts.readOnly {
+			table.configureReadOnly()
+		}
+		partProc.outbox = newOutbox(table, producer.EmitWithHeaders, partProc.enqueueTrackOutputStats, opts.outboxRetryInterval, log.Prefix("Outbox"))
 	}
 	return partProc
 }
 
 // EnqueueMessage enqueues a message in the partition processor's event channel for processing
 func (pp *PartitionProcessor) EnqueueMessage(msg *sarama.ConsumerMessage) {
-	pp.input <- msg
+	pp.inputs.channel(msg.Topic) <- msg
 }
 
 // Recovered returns whether the processor is running (i.e. all joins, lookups and the table is recovered and it's consuming messages)
@@ -216,6 +289,15 @@ func (pp *PartitionProcessor) Start(ctx context.Context) error {
 		})
 	}
 
+	if pp.outbox != nil {
+		go pp.outbox.table.RunStatsLoop(runnerCtx)
+		setupErrg.Go(func() error {
+			pp.log.Debugf("catching up outbox")
+			defer pp.log.Debugf("catching up outbox done")
+			return pp.outbox.table.SetupAndRecover(setupCtx, false)
+		})
+	}
+
 	for _, join := range pp.graph.JointTables() {
 		table := newPartitionTable(join.Topic(),
 			pp.partition,
@@ -227,7 +309,15 @@ func (pp *PartitionProcessor) Start(ctx context.Context) error {
 			NewSimpleBackoff(time.Second*10),
 			time.Minute,
 		)
+		table.configureStats(pp.opts.statsInterval, pp.opts.statsDisabled)
+		table.removeStorage = pp.opts.removeStorage
+		table.storageLimiter = pp.opts.storageLimiter
+		if m, ok := pp.opts.tableMigrations[join.Topic()]; ok {
+			table.configureMigration(m.version, m.migrate)
+		}
+		pp.tableMutex.Lock()
 		pp.joins[join.Topic()] = table
+		pp.tableMutex.Unlock()
 
 		go table.RunStatsLoop(runnerCtx)
 		setupErrg.Go(func() error {
@@ -261,6 +351,41 @@ func (pp *PartitionProcessor) Start(ctx context.Context) error {
 		})
 	}
 
+	if pp.runMode == runModeActive && pp.opts.partitionSetup != nil {
+		if err := pp.opts.partitionSetup(pp.partition, pp.table); err != nil {
+			return fmt.Errorf("error setting up partition %d: %v", pp.partition, err)
+		}
+		pp.isSetup = true
+	}
+
+	// forward the outbox entries left over by previous runs and all new ones
+	if pp.outbox != nil && pp.runMode == runModeActive {
+		if err := pp.outbox.load(); err != nil {
+			return fmt.Errorf("error loading outbox for partition %d: %v", pp.partition, err)
+		}
+		pp.runnerGroup.Go(func() error {
+			return pp.outbox.run(runnerCtx)
+		})
+	}
+
+	if pp.table != nil && pp.opts.tableGCPredicate != nil && pp.runMode == runModeActive {
+		pp.runnerGroup.Go(func() error {
+			return pp.runTableGC(runnerCtx)
+		})
+	}
+
+	if pp.table != nil && pp.opts.tableTTLInterval > 0 && pp.runMode == runModeActive {
+		pp.runnerGroup.Go(func() error {
+			return pp.runKeyExpiry(runnerCtx)
+		})
+	}
+
+	if pp.table != nil && pp.opts.tableRetention > 0 && pp.runMode == runModeActive {
+		pp.runnerGroup.Go(func() error {
+			return pp.runTableExpiry(runnerCtx)
+		})
+	}
+
 	// now run the processor in a runner-group
 	pp.runnerGroup.Go(func() error {
 		var err error
@@ -300,6 +425,11 @@ func (pp *PartitionProcessor) Stop() error {
 		errs.Collect(<-pp.Errors())
 	}
 
+	if pp.isSetup && pp.opts.partitionTeardown != nil {
+		pp.opts.partitionTeardown(pp.partition)
+	}
+	pp.isSetup = false
+
 	// stop the stats updating/serving loop
 	pp.cancelStatsLoop()
 
@@ -316,6 +446,11 @@ func (pp *PartitionProcessor) Stop() error {
 			return pp.table.Close()
 		})
 	}
+	if pp.outbox != nil {
+		errg.Go(func() error {
+			return pp.outbox.table.Close()
+		})
+	}
 	errs.Collect(errg.Wait().NilOrError())
 
 	return errs.NilOrError()
@@ -354,8 +489,6 @@ func (pp *PartitionProcessor) run(ctx context.Context) (rerr error) {
 			errs.Collect(err)
 			closeOnce.Do(func() { close(asyncErrs) })
 		}
-
-		wg sync.WaitGroup
 	)
 
 	defer func() {
@@ -366,7 +499,7 @@ func (pp *PartitionProcessor) run(ctx context.Context) (rerr error) {
 
 		done := make(chan struct{})
 		go func() {
-			wg.Wait()
+			pp.inflight.Wait()
 			close(done)
 		}()
 
@@ -378,31 +511,38 @@ func (pp *PartitionProcessor) run(ctx context.Context) (rerr error) {
 	}()
 
 	for {
-		select {
-		case ev, isOpen := <-pp.input:
-			// channel already closed, ev will be nil
-			if !isOpen {
-				return nil
-			}
-			err := pp.processMessage(ctx, &wg, ev, syncFailer, asyncFailer)
-			if err != nil {
-				return fmt.Errorf("error processing message: from %s %v", ev.Value, err)
+		ev, ok := pp.inputs.receive(ctx, asyncErrs)
+		if !ok {
+			select {
+			case <-asyncErrs:
+				pp.log.Debugf("Errors occurred asynchronously. Will exit partition processor")
+			default:
+				pp.log.Debugf("exiting, context is cancelled")
 			}
+			return
+		}
 
-			pp.enqueueStatsUpdate(ctx, func() { pp.updateStatsWithMessage(ev) })
-
-		case <-ctx.Done():
+		if pp.lagGate != nil && !pp.lagGate.wait(ctx) {
 			pp.log.Debugf("exiting, context is cancelled")
 			return
+		}
 
-		case <-asyncErrs:
-			pp.log.Debugf("Errors occurred asynchronously. Will exit partition processor")
-			return
+		start := time.Now()
+		err := pp.processMessageLocked(ctx, &pp.inflight, ev, syncFailer, asyncFailer)
+		if err != nil {
+			return fmt.Errorf("error processing message: from %s %v", ev.Value, err)
 		}
+		elapsed := time.Since(start)
+		pp.inputs.processed(ev.Topic, elapsed)
+
+		pp.enqueueStatsUpdate(ctx, func() { pp.updateStatsWithMessage(ev, elapsed) })
 	}
 }
 
 func (pp *PartitionProcessor) enqueueStatsUpdate(ctx context.Context, updater func()) {
+	if pp.opts.statsDisabled {
+		return
+	}
 	select {
 	case pp.updateStats <- updater:
 	case <-ctx.Done():
@@ -415,7 +555,7 @@ func (pp *PartitionProcessor) enqueueStatsUpdate(ctx context.Context, updater fu
 
 func (pp *PartitionProcessor) runStatsLoop(ctx context.Context) {
 
-	updateHwmStatsTicker := time.NewTicker(statsHwmUpdateInterval)
+	updateHwmStatsTicker := time.NewTicker(pp.opts.statsInterval)
 	defer updateHwmStatsTicker.Stop()
 	for {
 		select {
@@ -431,21 +571,29 @@ func (pp *PartitionProcessor) runStatsLoop(ctx context.Context) {
 			update()
 		case <-updateHwmStatsTicker.C:
 			pp.updateHwmStats()
+			if pp.hotKeys != nil {
+				pp.hotKeys.decay(pp.partition)
+			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-// updateStatsWithMessage updates the stats with a received message
-func (pp *PartitionProcessor) updateStatsWithMessage(ev *sarama.ConsumerMessage) {
+// updateStatsWithMessage updates the stats with a received message that took elapsed to process
+func (pp *PartitionProcessor) updateStatsWithMessage(ev *sarama.ConsumerMessage, elapsed time.Duration) {
+	pp.stats.ProcessingTime += elapsed
 	ip := pp.stats.Input[ev.Topic]
+	ip.ProcessingTime += elapsed
 	ip.Bytes += len(ev.Value)
 	ip.LastOffset = ev.Offset
 	if !ev.Timestamp.IsZero() {
 		ip.Delay = time.Since(ev.Timestamp)
 	}
 	ip.Count++
+	if pp.hotKeys != nil {
+		pp.hotKeys.observe(string(ev.Key))
+	}
 }
 
 // updateHwmStats updates the offset lag for all input topics based on the
@@ -497,10 +645,48 @@ func (pp *PartitionProcessor) collectStats(ctx context.Context) *PartitionProcSt
 		pp.log.Printf("Error retrieving stats: %v", err)
 	}
 
+	pp.addResourceStats(stats)
+	if pp.hotKeys != nil {
+		stats.HotKeys = pp.hotKeys.hotKeys()
+	}
+
 	return stats
 }
 
+// addResourceStats adds the backlog, the shares of the inputs and the memory used by
+// the storages to the stats.
+func (pp *PartitionProcessor) addResourceStats(stats *PartitionProcStats) {
+	stats.Backlog = pp.inputs.backlog()
+	for topic, input := range stats.Input {
+		input.Share = pp.inputs.shares.share(topic)
+	}
+
+	var (
+		count uint
+		bytes int
+	)
+	for _, input := range stats.Input {
+		count += input.Count
+		bytes += input.Bytes
+	}
+	if count > 0 {
+		stats.BacklogBytes = int64(stats.Backlog) * int64(bytes) / int64(count)
+	}
+
+	if stats.TableStats != nil {
+		stats.StorageMemory += stats.TableStats.StorageMemory
+	}
+	for _, join := range stats.Joined {
+		if join != nil {
+			stats.StorageMemory += join.StorageMemory
+		}
+	}
+}
+
 func (pp *PartitionProcessor) fetchStats(ctx context.Context) *PartitionProcStats {
+	if pp.opts.statsDisabled {
+		return nil
+	}
 	select {
 	case <-ctx.Done():
 		return nil
@@ -528,22 +714,62 @@ func (pp *PartitionProcessor) enqueueTrackOutputStats(ctx context.Context, topic
 	})
 }
 
+// emitterDefaultHeaders returns the default headers of the messages emitted while
+// processing msg, including the forwarded headers of msg
+func (pp *PartitionProcessor) emitterDefaultHeaders(msg *sarama.ConsumerMessage) Headers {
+	if len(pp.opts.forwardedHeaders) == 0 {
+		return pp.opts.producerDefaultHeaders
+	}
+	return pp.opts.producerDefaultHeaders.Merged(forwardedHeaders(pp.opts.forwardedHeaders, msg))
+}
+
+// processMessageLocked processes the message while holding the table mutex
+func (pp *PartitionProcessor) processMessageLocked(ctx context.Context, wg *sync.WaitGroup, msg *sarama.ConsumerMessage, syncFailer func(err error), asyncFailer func(err error)) error {
+	pp.tableMutex.Lock()
+	defer pp.tableMutex.Unlock()
+	return pp.processMessage(ctx, wg, msg, syncFailer, asyncFailer)
+}
+
 func (pp *PartitionProcessor) processMessage(ctx context.Context, wg *sync.WaitGroup, msg *sarama.ConsumerMessage, syncFailer func(err error), asyncFailer func(err error)) error {
+	overBudget := pp.overLatencyBudget(msg)
 	msgContext := &cbContext{
 		ctx:   ctx,
 		graph: pp.graph,
 
 		trackOutputStats:      pp.enqueueTrackOutputStats,
+		validateOutput:        pp.validateOutput,
 		pviews:                pp.joins,
 		views:                 pp.lookups,
-		commit:                func() { pp.commit(msg, "") },
+		commit:                func() { pp.commit(msg, pp.commitMeta) },
 		wg:                    wg,
 		msg:                   msg,
 		syncFailer:            syncFailer,
 		asyncFailer:           asyncFailer,
 		emitter:               pp.producer.EmitWithHeaders,
-		emitterDefaultHeaders: pp.opts.producerDefaultHeaders,
+		emitterDefaultHeaders: pp.emitterDefaultHeaders(msg),
+		maxLoopbackHops:       pp.opts.maxLoopbackHops,
+		replyTopics:           pp.opts.replyTopics,
+		overBudget:            overBudget,
+		log:                   pp.log,
 		table:                 pp.table,
+		outbox:                pp.outbox,
+	}
+
+	pp.sampleInput(ctx, msg)
+
+	if prefilter := pp.graph.prefilter(msg.Topic); prefilter != nil && !prefilter(string(msg.Key), msg.Value, headers.FromSarama(msg.Headers)) {
+		// mark the message upstream so we don't receive it again
+		pp.commit(msg, pp.commitMeta)
+		return nil
+	}
+
+	if pp.isTooOld(msg) {
+		pp.handleTooOld(ctx, wg, msg, asyncFailer)
+		return nil
+	}
+
+	if overBudget && pp.shed(ctx, msg) {
+		return nil
 	}
 
 	var (
@@ -556,7 +782,7 @@ func (pp *PartitionProcessor) processMessage(ctx context.Context, wg *sync.WaitG
 	case msg.Value == nil && pp.opts.nilHandling == NilIgnore:
 		// mark the message upstream so we don't receive it again.
 		// this is usually only an edge case in unit tests, as kafka probably never sends us nil messages
-		pp.commit(msg, "")
+		pp.commit(msg, pp.commitMeta)
 		// otherwise drop it.
 		return nil
 	case msg.Value == nil && pp.opts.nilHandling == NilProcess:
@@ -0,0 +1,37 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestPP_resourceStats(t *testing.T) {
+	pp := &PartitionProcessor{
+		stats:  newPartitionProcStats([]string{"input", "other"}, nil),
+		inputs: newPrioritizedInputs([]string{"input", "other"}, nil, nil, 10),
+	}
+
+	pp.updateStatsWithMessage(&sarama.ConsumerMessage{Topic: "input", Value: make([]byte, 10)}, time.Millisecond)
+	pp.updateStatsWithMessage(&sarama.ConsumerMessage{Topic: "input", Value: make([]byte, 20)}, 2*time.Millisecond)
+	pp.updateStatsWithMessage(&sarama.ConsumerMessage{Topic: "other", Value: make([]byte, 30)}, 3*time.Millisecond)
+	test.AssertEqual(t, pp.stats.ProcessingTime, 6*time.Millisecond)
+	test.AssertEqual(t, pp.stats.Input["input"].ProcessingTime, 3*time.Millisecond)
+
+	pp.inputs.channel("input") <- &sarama.ConsumerMessage{Topic: "input"}
+	pp.inputs.channel("other") <- &sarama.ConsumerMessage{Topic: "other"}
+
+	stats := pp.stats.clone()
+	stats.TableStats = &TableStats{StorageMemory: 100}
+	stats.Joined["join"] = &TableStats{StorageMemory: 50}
+	stats.Joined["stalled"] = nil
+	pp.addResourceStats(stats)
+
+	test.AssertEqual(t, stats.ProcessingTime, 6*time.Millisecond)
+	test.AssertEqual(t, stats.Backlog, 2)
+	// two messages of the average size of 20 bytes
+	test.AssertEqual(t, stats.BacklogBytes, int64(40))
+	test.AssertEqual(t, stats.StorageMemory, int64(150))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -16,6 +17,9 @@ const (
 	defaultPartitionChannelSize = 10
 	defaultStallPeriod          = 30 * time.Second
 	defaultStalledTimeout       = 2 * time.Minute
+	// recoveryBatchSize is the number of recovered messages written at once to
+	// storages supporting batches, see storage.Batcher
+	recoveryBatchSize = 10000
 
 	// internal offset we use to detect if the offset has never been stored locally
 	offsetNotStored int64 = -3
@@ -32,6 +36,10 @@ type Backoff interface {
 // It allows to setup and recover/catchup the table contents from kafka,
 // allow updates via Get/Set/Delete accessors
 type PartitionTable struct {
+	// timestamp of the newest message loaded in unix nanoseconds. It is accessed
+	// atomically, so keep it first in the struct for 64-bit alignment.
+	newestTimestamp int64
+
 	log            logger
 	topic          string
 	partition      int32
@@ -52,12 +60,55 @@ type PartitionTable struct {
 	offset int64
 	hwm    int64
 
+	// waiters for offsets to be loaded and the newest offset notified, see waitForOffset
+	waitersM       sync.Mutex
+	waiters        []*offsetWaiter
+	notified       bool
+	notifiedOffset int64
+
 	// stall config
 	stallPeriod    time.Duration
 	stalledTimeout time.Duration
 
+	// stats config
+	statsInterval time.Duration
+	statsDisabled bool
+
 	backoff             Backoff
 	backoffResetTimeout time.Duration
+
+	// versions retains previous values of the keys, if enabled
+	versions *versionStore
+	// meta keeps the offset and timestamp of the keys, if enabled
+	meta *recordMetaStore
+	// changes passes the changes after recovery to the observers of a view
+	changes *changeNotifier
+	// index maps the keys to the offsets of their latest messages, see configureOffsetIndex
+	index *offsetIndex
+	// secondary maintains the secondary indexes, see configureSecondaryIndexes
+	secondary *secondaryIndexes
+	// expiry stores the expiry times of keys with a TTL, see configureKeyTTL
+	expiry *keyExpiry
+
+	// removeStorage deletes a corrupted storage to rebuild it, if set
+	removeStorage storage.Remover
+	// storageLimiter limits the storages opened or closed concurrently, if set
+	storageLimiter storageLimiter
+	// overlay keeps the writes of a read-only processor instead of the storage, if set
+	overlay *tableOverlay
+
+	// retention of the table topic with cleanup.policy=compact,delete, 0 if values don't expire
+	retention time.Duration
+
+	// version of the values written to the table and the migration of older values, see WithTableVersion
+	version int
+	migrate storage.Migration
+
+	// ephemeral tables have no changelog topic, so they're neither recovered nor caught up
+	ephemeral bool
+
+	// recovery tracks the progress of the recovery, see RecoveryProgress
+	recovery *recoveryProgress
 }
 
 func newPartitionTableState() *Signal {
@@ -93,6 +144,8 @@ func newPartitionTable(topic string,
 		stallPeriod:    defaultStallPeriod,
 		stalledTimeout: defaultStalledTimeout,
 
+		statsInterval: statsHwmUpdateInterval,
+
 		stats:         newTableStats(),
 		requestStats:  make(chan bool),
 		responseStats: make(chan *TableStats, 1),
@@ -100,6 +153,8 @@ func newPartitionTable(topic string,
 
 		backoff:             backoff,
 		backoffResetTimeout: backoffResetTimeout,
+
+		recovery: new(recoveryProgress),
 	}
 
 	return pt
@@ -121,6 +176,10 @@ func (p *PartitionTable) SetupAndRecover(ctx context.Context, restartOnError boo
 	default:
 	}
 
+	if p.ephemeral {
+		return p.markRecovered(ctx)
+	}
+
 	if restartOnError {
 		return p.loadRestarting(ctx, true)
 	}
@@ -130,6 +189,10 @@ func (p *PartitionTable) SetupAndRecover(ctx context.Context, restartOnError boo
 // CatchupForever starts catching the partition table forever (until the context is cancelled).
 // Option restartOnError allows the view to stay open/intact even in case of consumer errors
 func (p *PartitionTable) CatchupForever(ctx context.Context, restartOnError bool) error {
+	if p.ephemeral {
+		<-ctx.Done()
+		return nil
+	}
 	if restartOnError {
 		return p.loadRestarting(ctx, false)
 	}
@@ -174,21 +237,65 @@ func (p *PartitionTable) loadRestarting(ctx context.Context, stopAfterCatchup bo
 func (p *PartitionTable) setup(ctx context.Context) error {
 	p.state.SetState(State(PartitionInitializing))
 	storage, err := p.createStorage(ctx)
+	if p.canRebuildStorage(err) {
+		storage, err = p.rebuildStorage(ctx, err)
+	}
 	if err != nil {
 		p.state.SetState(State(PartitionStopped))
-		return fmt.Errorf("error setting up partition table: %v", err)
+		return fmt.Errorf("error setting up partition table: %w", err)
+	}
+	if p.index != nil {
+		if err := p.index.open(p.topic, p.partition); err != nil {
+			storage.Close()
+			p.state.SetState(State(PartitionStopped))
+			return fmt.Errorf("error setting up partition table: %w", err)
+		}
+	}
+	if p.secondary != nil {
+		if err := p.secondary.open(p.topic, p.partition); err != nil {
+			storage.Close()
+			p.state.SetState(State(PartitionStopped))
+			return fmt.Errorf("error setting up partition table: %w", err)
+		}
+	}
+	if p.expiry != nil {
+		if err := p.expiry.open(p.topic, p.partition); err != nil {
+			storage.Close()
+			p.state.SetState(State(PartitionStopped))
+			return fmt.Errorf("error setting up partition table: %w", err)
+		}
 	}
 
 	p.st = storage
 	return nil
 }
 
-// Close closes the partition table
+// Close closes the partition table. The storage is closed even if closing the
+// indexes fails.
 func (p *PartitionTable) Close() error {
+	errs := new(multierr.Errors)
+	if p.index != nil {
+		if err := p.index.close(); err != nil {
+			errs.Collect(fmt.Errorf("error closing offset index: %v", err))
+		}
+	}
+	if p.secondary != nil {
+		if err := p.secondary.close(); err != nil {
+			errs.Collect(fmt.Errorf("error closing secondary index: %v", err))
+		}
+	}
+	if p.expiry != nil {
+		if err := p.expiry.close(); err != nil {
+			errs.Collect(fmt.Errorf("error closing key expiry: %v", err))
+		}
+	}
 	if p.st != nil {
-		return p.st.Close()
+		// closing cannot be cancelled, so wait for a slot in any case
+		p.storageLimiter.acquire(context.Background())
+		errs.Collect(p.st.Close())
+		p.storageLimiter.release()
 	}
-	return nil
+	return errs.NilOrError()
 }
 
 func (p *PartitionTable) createStorage(ctx context.Context) (*storageProxy, error) {
@@ -214,15 +321,21 @@ func (p *PartitionTable) createStorage(ctx context.Context) (*storageProxy, erro
 		}
 	}()
 
+	if err := p.storageLimiter.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer p.storageLimiter.release()
+
 	st, err = p.builder(p.topic, p.partition)
 	if err != nil {
-		return nil, fmt.Errorf("error building storage: %v", err)
+		return nil, fmt.Errorf("error building storage: %w", err)
 	}
 	err = st.Open()
 	if err != nil {
-		errs.Collect(st.Close())
-		errs.Collect(fmt.Errorf("error opening storage: %v", err))
-		return nil, errs.NilOrError()
+		if closeErr := st.Close(); closeErr != nil {
+			p.log.Printf("error closing storage of %s/%d after failing to open: %v", p.topic, p.partition, closeErr)
+		}
+		return nil, fmt.Errorf("error opening storage: %w", err)
 	}
 
 	// close the db if context was cancelled before the builder returned
@@ -300,10 +413,26 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 
 	// fetch local offset
 	storedOffset, err = p.st.GetOffset(offsetNotStored)
+	if p.canRebuildStorage(err) {
+		p.st, err = p.rebuildStorage(ctx, err)
+		storedOffset = offsetNotStored
+	}
 	if err != nil {
 		errs.Collect(fmt.Errorf("error reading local offset: %v", err))
 		return
 	}
+	if p.index != nil {
+		if err := p.index.check(storedOffset); err != nil {
+			errs.Collect(err)
+			return
+		}
+	}
+	if p.secondary != nil {
+		if err := p.secondary.rebuild(p.st, storedOffset); err != nil {
+			errs.Collect(err)
+			return
+		}
+	}
 
 	loadOffset, hwm, err := p.findOffsetToLoad(storedOffset)
 	if err != nil {
@@ -311,6 +440,22 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 		return
 	}
 
+	// the local offset is invalid if the table topic was recreated or the storage corrupted
+	invalidOffset := fmt.Errorf("local offset %d is not lower than hwm %d: %w", storedOffset, hwm, storage.ErrCorrupted)
+	if storedOffset != offsetNotStored && storedOffset >= hwm && p.canRebuildStorage(invalidOffset) {
+		p.st, err = p.rebuildStorage(ctx, invalidOffset)
+		if err != nil {
+			errs.Collect(err)
+			return
+		}
+		storedOffset = offsetNotStored
+		loadOffset, hwm, err = p.findOffsetToLoad(storedOffset)
+		if err != nil {
+			errs.Collect(err)
+			return
+		}
+	}
+
 	if storedOffset > 0 && hwm == 0 {
 		errs.Collect(fmt.Errorf("kafka tells us there's no message in the topic, but our cache has one. The table might be gone. Try to delete your local cache! Topic %s, partition %d, hwm %d, local offset %d", p.topic, p.partition, hwm, storedOffset))
 		return
@@ -323,6 +468,10 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 		loadOffset = hwm
 	}
 
+	if p.versions != nil {
+		p.versions.start(storedOffset == offsetNotStored)
+	}
+
 	// initialize recovery stats here, in case we don't do the recovery because
 	// we're up to date already
 	if stopAfterCatchup {
@@ -331,6 +480,7 @@ func (p *PartitionTable) load(ctx context.Context, stopAfterCatchup bool) (rerr
 			p.stats.Recovery.Hwm = hwm
 			p.stats.Recovery.Offset = loadOffset
 		})
+		p.recovery.begin(loadOffset, hwm, time.Now())
 	}
 
 	// we are exactly where we're supposed to be
@@ -399,6 +549,7 @@ func (p *PartitionTable) markRecovered(ctx context.Context) error {
 	)
 	defer ticker.Stop()
 
+	p.recovery.finish(p.partition, time.Now())
 	p.state.SetState(State(PartitionPreparing))
 	now := time.Now()
 	p.enqueueStatsUpdate(ctx, func() { p.stats.Recovery.RecoveryTime = now })
@@ -406,6 +557,15 @@ func (p *PartitionTable) markRecovered(ctx context.Context) error {
 	go func() {
 		defer close(done)
 		err := p.st.MarkRecovered()
+		if err == nil && p.index != nil {
+			err = p.index.markRecovered()
+		}
+		if err == nil && p.secondary != nil {
+			err = p.secondary.markRecovered()
+		}
+		if err == nil && p.expiry != nil {
+			err = p.expiry.markRecovered()
+		}
 		if err != nil {
 			done <- err
 		}
@@ -502,6 +662,31 @@ func (p *PartitionTable) loadMessages(ctx context.Context, cons sarama.Partition
 
 	lastMessage := time.Now()
 
+	// recovered messages are written in batches if the storage supports it
+	batched := stopAfterCatchup && p.st.startBatch()
+	if batched {
+		defer func() {
+			offset, pending := p.st.batchOffset, p.st.batchMessages > 0
+			if err := p.st.endBatch(); err != nil {
+				errs.Collect(fmt.Errorf("load: error writing batch: %v", err))
+			} else if pending {
+				if err := p.flushIndex(offset); err != nil {
+					errs.Collect(fmt.Errorf("load: %v", err))
+					return
+				}
+				if err := p.flushSecondaryIndexes(offset); err != nil {
+					errs.Collect(fmt.Errorf("load: %v", err))
+					return
+				}
+				if err := p.flushExpiry(); err != nil {
+					errs.Collect(fmt.Errorf("load: %v", err))
+					return
+				}
+				p.notifyOffset(offset)
+			}
+		}()
+	}
+
 	for {
 		select {
 		case msg, ok := <-cons.Messages():
@@ -523,13 +708,54 @@ func (p *PartitionTable) loadMessages(ctx context.Context, cons sarama.Partition
 			}
 
 			lastMessage = time.Now()
-			if err := p.storeEvent(string(msg.Key), msg.Value, msg.Offset, headers.FromSarama(msg.Headers)); err != nil {
+			ts := msg.Timestamp
+			if ts.IsZero() {
+				ts = time.Now()
+			}
+
+			// the old value is only read for change observers, which are not notified during recovery
+			var (
+				notifyChange bool
+				oldValue     []byte
+			)
+			if p.changes != nil && !stopAfterCatchup && p.changes.active() {
+				notifyChange = true
+				var err error
+				if oldValue, err = p.st.Get(string(msg.Key)); err != nil {
+					errs.Collect(fmt.Errorf("load: error reading old value: %v", err))
+					return
+				}
+			}
+
+			hdr := headers.FromSarama(msg.Headers)
+			value, err := p.migrateRecovered(msg.Value, hdr)
+			if err != nil {
+				errs.Collect(fmt.Errorf("load: error migrating value of key %s at offset %d: %v", msg.Key, msg.Offset, err))
+				return
+			}
+			// the version is added before storing the value, see versionStore.getAsOf
+			if p.versions != nil {
+				p.versions.add(string(msg.Key), msg.Value, ts)
+			}
+			if err := p.storeEvent(string(msg.Key), value, msg.Offset, hdr, ts); err != nil {
 				errs.Collect(fmt.Errorf("load: error updating storage: %v", err))
 				return
 			}
+			if notifyChange {
+				if err := p.changes.notify(ctx, string(msg.Key), oldValue, msg.Value, p.partition, msg.Offset, ts); err != nil {
+					p.log.Printf("error notifying change observers: %v", err)
+				}
+			}
+			if ts.UnixNano() > atomic.LoadInt64(&p.newestTimestamp) {
+				atomic.StoreInt64(&p.newestTimestamp, ts.UnixNano())
+			}
+			if p.meta != nil {
+				p.meta.add(string(msg.Key), msg.Value, msg.Offset, ts)
+			}
 
 			if stopAfterCatchup {
 				p.enqueueStatsUpdate(ctx, func() { p.stats.Recovery.Offset = msg.Offset })
+				p.recovery.advance(p.partition, msg.Offset, lastMessage)
 			}
 
 			p.enqueueStatsUpdate(ctx, func() { p.trackIncomingMessageStats(msg) })
@@ -551,7 +777,27 @@ func (p *PartitionTable) loadMessages(ctx context.Context, cons sarama.Partition
 	}
 }
 
+// configureRetention makes the table expire values older than the retention of its
+// topic with cleanup.policy=compact,delete.
+func (p *PartitionTable) configureRetention(retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	p.retention = retention
+	p.builder = storage.ExpiringBuilder(p.builder, retention)
+	p.stats.Retention = retention
+}
+
+// configureStats sets the interval of the stats loop or disables stats
+func (p *PartitionTable) configureStats(interval time.Duration, disabled bool) {
+	p.statsInterval = interval
+	p.statsDisabled = disabled
+}
+
 func (p *PartitionTable) enqueueStatsUpdate(ctx context.Context, updater func()) {
+	if p.statsDisabled {
+		return
+	}
 	select {
 	case p.updateStats <- updater:
 	case <-ctx.Done():
@@ -566,8 +812,11 @@ func (p *PartitionTable) enqueueStatsUpdate(ctx context.Context, updater func())
 // recover/catchup mechanism so clients can always request stats even if the partition table is not
 // running (like a processor table after it's recovered).
 func (p *PartitionTable) RunStatsLoop(ctx context.Context) {
+	if p.statsDisabled {
+		return
+	}
 
-	updateHwmStatsTicker := time.NewTicker(statsHwmUpdateInterval)
+	updateHwmStatsTicker := time.NewTicker(p.statsInterval)
 	defer updateHwmStatsTicker.Stop()
 	for {
 		select {
@@ -586,6 +835,7 @@ func (p *PartitionTable) RunStatsLoop(ctx context.Context) {
 func (p *PartitionTable) handleStatsRequest(ctx context.Context) {
 	stats := p.stats.clone()
 	stats.Status = PartitionStatus(p.state.State())
+	stats.StorageMemory = p.storageMemory(stats.Status)
 	select {
 	case p.responseStats <- stats:
 	case <-ctx.Done():
@@ -593,7 +843,22 @@ func (p *PartitionTable) handleStatsRequest(ctx context.Context) {
 	}
 }
 
+// storageMemory returns the memory used by the storage if it reports it. The storage
+// is only accessed after it was set up, i.e. from status connecting on.
+func (p *PartitionTable) storageMemory(status PartitionStatus) int64 {
+	if status == PartitionStopped || status == PartitionInitializing || p.st == nil {
+		return 0
+	}
+	if mr, ok := p.st.Storage.(storage.MemoryReporter); ok {
+		return mr.MemoryUsage()
+	}
+	return 0
+}
+
 func (p *PartitionTable) fetchStats(ctx context.Context) *TableStats {
+	if p.statsDisabled {
+		return nil
+	}
 	select {
 	case <-ctx.Done():
 		return nil
@@ -642,18 +907,66 @@ func (p *PartitionTable) updateHwmStats() {
 	}
 }
 
-func (p *PartitionTable) storeEvent(key string, value []byte, offset int64, headers Headers) error {
-	err := p.st.Update(key, value, offset, headers)
+// storeEvent updates the storage with a recovered message and stores its offset. While
+// the storage collects the writes in a batch (see storageProxy.startBatch), the batch is
+// written with the offset of its last message once it is full, see recoveryBatchSize.
+func (p *PartitionTable) storeEvent(key string, value []byte, offset int64, headers Headers, ts time.Time) error {
+	staged := p.st.staged()
+	err := p.updateIndexed(key, func() error {
+		return p.st.Update(key, value, offset, headers, ts)
+	})
 	if err != nil {
+		// the writes of the failed message must not be written with the batch
+		p.st.discardStaged(staged)
 		return fmt.Errorf("Error from the update callback while recovering from the log: %v", err)
 	}
-	err = p.st.SetOffset(offset)
+	if p.index != nil {
+		p.index.add(key, offset, value)
+	}
+	if err := p.addRecoveredExpiry(key, value, headers); err != nil {
+		return err
+	}
+	written, err := p.st.storeOffset(offset, recoveryBatchSize)
 	if err != nil {
 		return fmt.Errorf("Error updating offset in local storage while recovering from the log: %v", err)
 	}
+	if !written {
+		return nil
+	}
+	if err := p.flushIndex(offset); err != nil {
+		return err
+	}
+	if err := p.flushSecondaryIndexes(offset); err != nil {
+		return err
+	}
+	if err := p.flushExpiry(); err != nil {
+		return err
+	}
+	p.notifyOffset(offset)
+	return nil
+}
+
+// flushIndex writes the offset index up to the offset, if enabled.
+func (p *PartitionTable) flushIndex(offset int64) error {
+	if p.index == nil {
+		return nil
+	}
+	if err := p.index.flush(offset); err != nil {
+		return fmt.Errorf("Error updating offset index while recovering from the log: %v", err)
+	}
 	return nil
 }
 
+// newestMessageTime returns the timestamp of the newest message loaded into the
+// table or the zero time if no message was loaded yet.
+func (p *PartitionTable) newestMessageTime() time.Time {
+	ts := atomic.LoadInt64(&p.newestTimestamp)
+	if ts == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ts)
+}
+
 // IsRecovered returns whether the partition table is recovered
 func (p *PartitionTable) IsRecovered() bool {
 	return p.state.IsState(State(PartitionRunning))
@@ -674,6 +987,11 @@ func (p *PartitionTable) Get(key string) ([]byte, error) {
 	if err := p.readyToRead(); err != nil {
 		return nil, err
 	}
+	if p.overlay != nil {
+		if value, ok := p.overlay.get(key); ok {
+			return value, nil
+		}
+	}
 	return p.st.Get(key)
 }
 
@@ -682,6 +1000,11 @@ func (p *PartitionTable) Has(key string) (bool, error) {
 	if err := p.readyToRead(); err != nil {
 		return false, err
 	}
+	if p.overlay != nil {
+		if value, ok := p.overlay.get(key); ok {
+			return value != nil, nil
+		}
+	}
 	return p.st.Has(key)
 }
 
@@ -717,14 +1040,37 @@ func (p *PartitionTable) readyToRead() error {
 
 // Set sets a key value key in the partition table by modifying the underlying storage
 func (p *PartitionTable) Set(key string, value []byte) error {
+	if p.overlay != nil {
+		p.overlay.set(key, value)
+		return nil
+	}
 	return p.st.Set(key, value)
 }
 
 // Delete removes the passed key from the partition table by deleting from the underlying storage
 func (p *PartitionTable) Delete(key string) error {
+	if p.overlay != nil {
+		p.overlay.delete(key)
+		return nil
+	}
 	return p.st.Delete(key)
 }
 
+// deleteKey deletes the key from the storage, the offset index and the key expiry.
+// The caller emits the tombstone. Deleting expired keys also stores its offset.
+func (p *PartitionTable) deleteKey(key string) error {
+	if err := p.Delete(key); err != nil {
+		return fmt.Errorf("error deleting key (%s) from storage: %v", key, err)
+	}
+	if err := p.indexWrite(key, offsetNotStored, nil); err != nil {
+		return fmt.Errorf("error deleting key (%s) from offset index: %v", key, err)
+	}
+	if err := p.setKeyExpiry(key, time.Time{}); err != nil {
+		return fmt.Errorf("error deleting expiry of key (%s): %v", key, err)
+	}
+	return nil
+}
+
 func (p *PartitionTable) storeNewestOffset(newOffset int64) error {
 	p.offsetM.Lock()
 	defer p.offsetM.Unlock()
@@ -735,8 +1081,12 @@ func (p *PartitionTable) storeNewestOffset(newOffset int64) error {
 	}
 
 	if offsetNotStored != oldOffset && oldOffset <= newOffset {
-		return p.SetOffset(newOffset)
+		if err := p.SetOffset(newOffset); err != nil {
+			return err
+		}
 	}
+	// the value was stored before it was written, so it can be read now
+	p.notifyOffset(newOffset)
 	return nil
 }
 
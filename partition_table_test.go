@@ -106,6 +106,37 @@ func TestPT_createStorage(t *testing.T) {
 		test.AssertNotNil(t, err)
 		test.AssertNil(t, sp)
 	})
+	t.Run("limited", func(t *testing.T) {
+		pt, bm, ctrl := defaultPT(
+			t,
+			"some-topic",
+			0,
+			nil,
+			nil,
+		)
+		defer ctrl.Finish()
+		pt.storageLimiter = newStorageLimiter(1)
+
+		// another storage is being opened
+		test.AssertNil(t, pt.storageLimiter.acquire(context.Background()))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		sp, err := pt.createStorage(ctx)
+		test.AssertEqual(t, err, context.DeadlineExceeded)
+		test.AssertNil(t, sp)
+
+		pt.storageLimiter.release()
+		bm.mst.EXPECT().Open().Return(nil)
+		sp, err = pt.createStorage(context.Background())
+		test.AssertNil(t, err)
+		test.AssertNotNil(t, sp)
+		test.AssertEqual(t, len(pt.storageLimiter), 0)
+
+		pt.st = sp
+		bm.mst.EXPECT().Close().Return(nil)
+		test.AssertNil(t, pt.Close())
+		test.AssertEqual(t, len(pt.storageLimiter), 0)
+	})
 }
 
 func TestPT_setup(t *testing.T) {
@@ -727,7 +758,7 @@ func TestPT_storeEvent(t *testing.T) {
 		defer cancel()
 		err := pt.setup(ctx)
 		test.AssertNil(t, err)
-		err = pt.storeEvent(key, value, localOffset, nil)
+		err = pt.storeEvent(key, value, localOffset, nil, time.Now())
 		test.AssertEqual(t, actualKey, key)
 		test.AssertEqual(t, actualValue, value)
 		test.AssertNil(t, err)
@@ -758,7 +789,7 @@ func TestPT_storeEvent(t *testing.T) {
 		defer cancel()
 		err := pt.setup(ctx)
 		test.AssertNil(t, err)
-		err = pt.storeEvent(key, value, localOffset, nil)
+		err = pt.storeEvent(key, value, localOffset, nil, time.Now())
 		test.AssertNotNil(t, err)
 	})
 }
@@ -802,6 +833,35 @@ func TestPT_Close(t *testing.T) {
 		err := pt.Close()
 		test.AssertNil(t, err)
 	})
+	t.Run("index-error", func(t *testing.T) {
+		var (
+			partition int32
+			topic     = "some-topic"
+		)
+		pt, bm, ctrl := defaultPT(
+			t,
+			topic,
+			partition,
+			nil,
+			nil,
+		)
+		defer ctrl.Finish()
+		bm.mst.EXPECT().Open().Return(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		test.AssertNil(t, pt.setup(ctx))
+
+		// the storage is closed and the slot released even if closing the index fails
+		expirySt := NewMockStorage(ctrl)
+		expirySt.EXPECT().Close().Return(fmt.Errorf("close failed"))
+		pt.expiry = &keyExpiry{sidecar: sidecar{st: expirySt}}
+		pt.storageLimiter = newStorageLimiter(1)
+		bm.mst.EXPECT().Close().Return(nil)
+		err := pt.Close()
+		test.AssertNotNil(t, err)
+		test.AssertStringContains(t, err.Error(), "error closing key expiry")
+		test.AssertNil(t, pt.storageLimiter.acquire(ctx))
+	})
 }
 
 func TestPT_markRecovered(t *testing.T) {
@@ -1005,3 +1065,26 @@ func TestPT_SetupAndCatchupForever(t *testing.T) {
 		cancel()
 	})
 }
+
+func TestPT_statsDisabled(t *testing.T) {
+	pt, _, ctrl := defaultPT(
+		t,
+		"some-topic",
+		0,
+		nil,
+		nil,
+	)
+	defer ctrl.Finish()
+	pt.configureStats(time.Second, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// returns immediately instead of running until the context is done
+	pt.RunStatsLoop(ctx)
+	test.AssertNil(t, ctx.Err())
+
+	// does not block without a running stats loop
+	test.AssertTrue(t, pt.fetchStats(ctx) == nil)
+	test.AssertNil(t, ctx.Err())
+}
@@ -0,0 +1,35 @@
+package partitioning
+
+import (
+	"hash"
+	"hash/fnv"
+)
+
+// JumpConsistent returns a hasher assigning keys with jump consistent hashing
+// (Lamping and Veach, https://arxiv.org/abs/1406.2294). When the number of
+// partitions grows from n to n+1, only about 1/(n+1) of the keys move, all of
+// them to the new partition, while hashing modulo the number of partitions moves
+// almost all keys.
+//
+// numPartitions must match the number of partitions of the topics, so the
+// hasher must be replaced when adding partitions.
+func JumpConsistent(numPartitions int32) func() hash.Hash32 {
+	return func() hash.Hash32 {
+		return newBuffer(func(data []byte) uint32 {
+			h := fnv.New64a()
+			h.Write(data)
+			return uint32(jump(h.Sum64(), numPartitions))
+		})
+	}
+}
+
+// jump is the jump consistent hash function of the paper
+func jump(key uint64, buckets int32) int32 {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int32(b)
+}
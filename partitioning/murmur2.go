@@ -0,0 +1,55 @@
+package partitioning
+
+import (
+	"hash"
+)
+
+// Murmur2 returns a hasher compatible with the default partitioner of the Java
+// Kafka producer, so goka and Java services agree on the partition of a key.
+func Murmur2() func() hash.Hash32 {
+	return func() hash.Hash32 {
+		return newBuffer(func(data []byte) uint32 {
+			// the java partitioner drops the sign bit
+			return uint32(murmur2(data)) & 0x7fffffff
+		})
+	}
+}
+
+// murmur2 is a port of org.apache.kafka.common.utils.Utils.murmur2
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
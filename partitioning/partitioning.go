@@ -0,0 +1,76 @@
+// Package partitioning provides hashers to assign keys to partitions, to be
+// passed to goka.WithHasher, goka.WithViewHasher and goka.WithEmitterHasher.
+//
+// Goka and sarama assign a key to the partition
+//
+//	abs(int32(hasher.Sum32())) % numPartitions
+//
+// All hashers of this package return non-negative int32 values, so they assign
+// the same partitions in goka, sarama and other clients using the same hash.
+package partitioning
+
+import (
+	"errors"
+	"hash"
+
+	"github.com/Shopify/sarama"
+)
+
+// Partition returns the partition of the key using the same calculation as
+// goka's processors, views and emitters.
+func Partition(hasher func() hash.Hash32, key string, numPartitions int32) (int32, error) {
+	if numPartitions <= 0 {
+		return 0, errors.New("can't hash with 0 partitions")
+	}
+	h := hasher()
+	if _, err := h.Write([]byte(key)); err != nil {
+		return 0, err
+	}
+	hash := int32(h.Sum32())
+	if hash < 0 {
+		hash = -hash
+	}
+	return hash % numPartitions, nil
+}
+
+// Partitioner returns a sarama partitioner assigning keys to partitions with
+// the hasher, e.g. for producers not created by goka writing into goka topics.
+func Partitioner(hasher func() hash.Hash32) sarama.PartitionerConstructor {
+	return sarama.NewCustomHashPartitioner(hasher)
+}
+
+// buffer collects the written bytes of a key to hash them on Sum32.
+type buffer struct {
+	data []byte
+	sum  func(data []byte) uint32
+}
+
+func newBuffer(sum func(data []byte) uint32) *buffer {
+	return &buffer{sum: sum}
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+func (b *buffer) Sum(in []byte) []byte {
+	s := b.Sum32()
+	return append(in, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+func (b *buffer) Sum32() uint32 {
+	return b.sum(b.data)
+}
+
+func (b *buffer) Reset() {
+	b.data = b.data[:0]
+}
+
+func (b *buffer) Size() int {
+	return 4
+}
+
+func (b *buffer) BlockSize() int {
+	return 1
+}
@@ -0,0 +1,110 @@
+package partitioning
+
+import (
+	"fmt"
+	"hash/fnv"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestMurmur2(t *testing.T) {
+	// test vectors of the java implementation
+	for key, expected := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		test.AssertEqual(t, murmur2([]byte(key)), expected)
+
+		h := Murmur2()()
+		h.Write([]byte(key))
+		test.AssertEqual(t, h.Sum32(), uint32(expected)&0x7fffffff)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	var foobar int32 = -790332482
+
+	// split writes are hashed like a single write
+	h := Murmur2()()
+	h.Write([]byte("foo"))
+	h.Write([]byte("bar"))
+	test.AssertEqual(t, h.Sum32(), uint32(foobar)&0x7fffffff)
+	h.Reset()
+	h.Write([]byte("abc"))
+	test.AssertEqual(t, h.Sum32(), uint32(479470107))
+
+	partition, err := Partition(Murmur2(), "foobar", 10)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, partition, int32(uint32(foobar)&0x7fffffff)%10)
+
+	_, err = Partition(Murmur2(), "foobar", 0)
+	test.AssertNotNil(t, err)
+
+	// sarama assigns the same partitions
+	partitioner := Partitioner(Murmur2())("topic")
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		expected, err := partitioner.Partition(&sarama.ProducerMessage{Key: sarama.StringEncoder(key)}, 12)
+		test.AssertNil(t, err)
+		partition, err := Partition(Murmur2(), key, 12)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, partition, expected)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	hasher := Prefix("/", Murmur2())
+
+	p1, err := Partition(hasher, "user-1/order-1", 100)
+	test.AssertNil(t, err)
+	p2, err := Partition(hasher, "user-1/order-2", 100)
+	test.AssertNil(t, err)
+	p3, err := Partition(hasher, "user-1", 100)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, p1, p2)
+	test.AssertEqual(t, p1, p3)
+
+	// the first separator ends the prefix
+	p4, err := Partition(hasher, "user-1/order-1/item-1", 100)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, p1, p4)
+
+	h := Prefix("/", fnv.New32a)()
+	h.Write([]byte("user-2/order-1"))
+	test.AssertTrue(t, int32(h.Sum32()) >= 0)
+}
+
+func TestJumpConsistent(t *testing.T) {
+	const numKeys = 10000
+	var (
+		counts = make(map[int32]int)
+		moved  int
+	)
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before, err := Partition(JumpConsistent(10), key, 10)
+		test.AssertNil(t, err)
+		after, err := Partition(JumpConsistent(11), key, 11)
+		test.AssertNil(t, err)
+
+		counts[before]++
+		if before != after {
+			moved++
+			// keys only move to the new partition
+			test.AssertEqual(t, after, int32(10))
+		}
+	}
+
+	test.AssertEqual(t, len(counts), 10)
+	for partition, count := range counts {
+		test.AssertTrue(t, count > numKeys/10/2, partition, count)
+	}
+	// about 1/11 of the keys move
+	test.AssertTrue(t, moved > numKeys/11/2 && moved < numKeys/11*2, moved)
+}
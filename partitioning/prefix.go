@@ -0,0 +1,24 @@
+package partitioning
+
+import (
+	"bytes"
+	"hash"
+)
+
+// Prefix returns a hasher hashing only the prefix of the keys up to the first
+// separator with the passed hasher, so all keys with the same prefix are assigned
+// to the same partition, e.g. "user-1/order-1" and "user-1/order-2" with separator
+// "/". Keys without separator are hashed completely.
+func Prefix(separator string, hasher func() hash.Hash32) func() hash.Hash32 {
+	sep := []byte(separator)
+	return func() hash.Hash32 {
+		return newBuffer(func(data []byte) uint32 {
+			if idx := bytes.Index(data, sep); idx >= 0 && len(sep) > 0 {
+				data = data[:idx]
+			}
+			h := hasher()
+			h.Write(data)
+			return h.Sum32() & 0x7fffffff
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package goka
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Shopify/sarama"
+)
+
+// memberIDSuffixLength is the length of the suffix the broker appends to the client ID
+// to create the member ID, i.e. a dash followed by a UUID
+const memberIDSuffixLength = 37
+
+// PinningStrategy wraps a balance strategy to assign partitions to fixed instances.
+// The keys of pins are the client IDs of the instances, which Kafka uses as prefix of
+// the member IDs. The pinned partitions of all topics of the plan are moved to the
+// instance, so copartitioning is retained. If multiple members share a client ID,
+// the member with the lowest member ID gets the partitions.
+// Pinned partitions of instances that are not part of the group are assigned by the
+// wrapped strategy, so they are still consumed.
+func PinningStrategy(base sarama.BalanceStrategy, pins map[string][]int32) sarama.BalanceStrategy {
+	copied := make(map[string][]int32, len(pins))
+	for instance, partitions := range pins {
+		copied[instance] = append([]int32(nil), partitions...)
+	}
+	return &pinningStrategy{base: base, pins: copied}
+}
+
+type pinningStrategy struct {
+	base sarama.BalanceStrategy
+	pins map[string][]int32
+}
+
+// Name implements BalanceStrategy.
+func (s *pinningStrategy) Name() string {
+	return s.base.Name() + "+pin"
+}
+
+// Plan implements BalanceStrategy.
+func (s *pinningStrategy) Plan(members map[string]sarama.ConsumerGroupMemberMetadata, topics map[string][]int32) (sarama.BalanceStrategyPlan, error) {
+	plan, err := s.base.Plan(members, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs := make([]string, 0, len(members))
+	for memberID := range members {
+		memberIDs = append(memberIDs, memberID)
+	}
+	sort.Strings(memberIDs)
+
+	pinned := make(map[string]bool)
+	for _, memberID := range memberIDs {
+		instance := memberClientID(memberID)
+		if pinned[instance] {
+			continue
+		}
+		partitions, ok := s.pins[instance]
+		if !ok {
+			continue
+		}
+		pinned[instance] = true
+		for _, partition := range partitions {
+			movePartition(plan, members[memberID].Topics, memberID, partition)
+		}
+	}
+	return plan, nil
+}
+
+// AssignmentData implements BalanceStrategy.
+func (s *pinningStrategy) AssignmentData(memberID string, topics map[string][]int32, generationID int32) ([]byte, error) {
+	return s.base.AssignmentData(memberID, topics, generationID)
+}
+
+// memberClientID returns the client ID of a member ID
+func memberClientID(memberID string) string {
+	if len(memberID) <= memberIDSuffixLength {
+		return memberID
+	}
+	return memberID[:len(memberID)-memberIDSuffixLength]
+}
+
+// validatePartitionPins checks that every partition is pinned to one instance only
+func validatePartitionPins(pins map[string][]int32) error {
+	owners := make(map[int32]string)
+	for instance, partitions := range pins {
+		if instance == "" {
+			return fmt.Errorf("invalid partition pinning: empty client ID")
+		}
+		for _, partition := range partitions {
+			if partition < 0 {
+				return fmt.Errorf("invalid partition pinning: negative partition %d for %s", partition, instance)
+			}
+			if owner, ok := owners[partition]; ok && owner != instance {
+				return fmt.Errorf("invalid partition pinning: partition %d pinned to %s and %s", partition, owner, instance)
+			}
+			owners[partition] = instance
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestPinningStrategy(t *testing.T) {
+	strategy := PinningStrategy(CopartitioningStrategy, map[string][]int32{
+		"gpu-1": {0, 1},
+		"gpu-2": {3, 7},
+	})
+	test.AssertEqual(t, strategy.Name(), "copartition+pin")
+
+	topics := map[string][]int32{
+		"input": {0, 1, 2, 3},
+		"table": {0, 1, 2, 3},
+	}
+	member := sarama.ConsumerGroupMemberMetadata{
+		Topics: []string{"input", "table"},
+	}
+
+	t.Run("pinned", func(t *testing.T) {
+		plan, err := strategy.Plan(map[string]sarama.ConsumerGroupMemberMetadata{
+			"gpu-1-4b7a2c1e-0d5f-4a8e-9c3b-1f2e3d4c5b6a": member,
+			"gpu-2-0c9d8e7f-6a5b-4c3d-2e1f-0a9b8c7d6e5f": member,
+		}, topics)
+		test.AssertEqual(t, err, nil)
+		test.AssertEqual(t, plan["gpu-1-4b7a2c1e-0d5f-4a8e-9c3b-1f2e3d4c5b6a"], map[string][]int32{"input": {0, 1}, "table": {0, 1}})
+		test.AssertEqual(t, plan["gpu-2-0c9d8e7f-6a5b-4c3d-2e1f-0a9b8c7d6e5f"], map[string][]int32{"input": {2, 3}, "table": {2, 3}})
+	})
+
+	t.Run("absent", func(t *testing.T) {
+		// the partitions of gpu-2 stay with the members of the copartitioning strategy
+		plan, err := strategy.Plan(map[string]sarama.ConsumerGroupMemberMetadata{
+			"cpu-1-4b7a2c1e-0d5f-4a8e-9c3b-1f2e3d4c5b6a": member,
+			"gpu-1-0c9d8e7f-6a5b-4c3d-2e1f-0a9b8c7d6e5f": member,
+		}, topics)
+		test.AssertEqual(t, err, nil)
+		test.AssertEqual(t, plan["cpu-1-4b7a2c1e-0d5f-4a8e-9c3b-1f2e3d4c5b6a"]["input"], []int32{})
+		test.AssertEqual(t, plan["gpu-1-0c9d8e7f-6a5b-4c3d-2e1f-0a9b8c7d6e5f"]["input"], []int32{2, 3, 0, 1})
+	})
+
+	t.Run("shared-client-id", func(t *testing.T) {
+		plan, err := strategy.Plan(map[string]sarama.ConsumerGroupMemberMetadata{
+			"gpu-1-4b7a2c1e-0d5f-4a8e-9c3b-1f2e3d4c5b6a": member,
+			"gpu-1-0c9d8e7f-6a5b-4c3d-2e1f-0a9b8c7d6e5f": member,
+		}, topics)
+		test.AssertEqual(t, err, nil)
+		test.AssertEqual(t, plan["gpu-1-0c9d8e7f-6a5b-4c3d-2e1f-0a9b8c7d6e5f"]["input"], []int32{0, 1})
+		test.AssertEqual(t, plan["gpu-1-4b7a2c1e-0d5f-4a8e-9c3b-1f2e3d4c5b6a"]["input"], []int32{2, 3})
+	})
+}
+
+func TestValidatePartitionPins(t *testing.T) {
+	test.AssertEqual(t, validatePartitionPins(nil), nil)
+	test.AssertEqual(t, validatePartitionPins(map[string][]int32{"a": {0, 1}, "b": {2}}), nil)
+	test.AssertNotNil(t, validatePartitionPins(map[string][]int32{"": {0}}))
+	test.AssertNotNil(t, validatePartitionPins(map[string][]int32{"a": {-1}}))
+	test.AssertNotNil(t, validatePartitionPins(map[string][]int32{"a": {0}, "b": {0}}))
+}
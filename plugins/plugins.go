@@ -0,0 +1,250 @@
+// Package plugins loads codecs and process callbacks from Go plugins at runtime,
+// e.g. to adjust the field mappings of a routing processor without rebuilding it.
+//
+// A plugin is built with `go build -buildmode=plugin` against the same versions of goka
+// and its dependencies as the processor and exports the codec or callback as a symbol:
+//
+//	// in the plugin
+//	var Codec = new(codec.String)
+//	func Route(ctx goka.Context, msg interface{}) { ... }
+//
+//	// in the processor
+//	routes, err := plugins.NewCallback(plugins.Spec{Path: "routes.so", Symbol: "Route"})
+//	...
+//	goka.Input("events", eventCodec, routes.Process)
+//
+// Codec and Callback delegate to the loaded symbol and can be reloaded from another
+// plugin while the processor is running. Go plugins cannot be unloaded, so every version
+// of a plugin must be built to a new path.
+package plugins
+
+import (
+	"fmt"
+	"plugin"
+	"reflect"
+	"sync"
+
+	"github.com/lovoo/goka"
+)
+
+// Spec identifies a symbol of a plugin.
+type Spec struct {
+	// Path is the path of the plugin file
+	Path string `json:"path"`
+	// Symbol is the name of the exported variable or function
+	Symbol string `json:"symbol"`
+}
+
+// lookup opens the plugin and looks up the symbol
+func lookup(spec Spec) (plugin.Symbol, error) {
+	p, err := plugin.Open(spec.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening plugin %s: %v", spec.Path, err)
+	}
+	sym, err := p.Lookup(spec.Symbol)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up %s in plugin %s: %v", spec.Symbol, spec.Path, err)
+	}
+	return sym, nil
+}
+
+// LoadCodec loads a codec from a plugin. The symbol must be a variable of a type
+// implementing goka.Codec, e.g. var Codec = new(codec.String), a variable of type
+// goka.Codec or a function of type func() goka.Codec.
+func LoadCodec(spec Spec) (goka.Codec, error) {
+	sym, err := lookup(spec)
+	if err != nil {
+		return nil, err
+	}
+	codec, err := codecFromSymbol(sym)
+	if err != nil {
+		return nil, fmt.Errorf("invalid symbol %s in plugin %s: %v", spec.Symbol, spec.Path, err)
+	}
+	return codec, nil
+}
+
+// LoadCodecs loads the codecs of multiple topics, e.g. from a configuration file.
+func LoadCodecs(specs map[string]Spec) (map[string]goka.Codec, error) {
+	codecs := make(map[string]goka.Codec, len(specs))
+	for topic, spec := range specs {
+		codec, err := LoadCodec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("error loading codec for topic %s: %v", topic, err)
+		}
+		codecs[topic] = codec
+	}
+	return codecs, nil
+}
+
+func codecFromSymbol(sym plugin.Symbol) (goka.Codec, error) {
+	var codec goka.Codec
+	switch s := sym.(type) {
+	case func() goka.Codec:
+		codec = s()
+	case *goka.Codec:
+		codec = *s
+	case goka.Codec:
+		codec = s
+	default:
+		// variables are looked up as pointers, e.g. **codec.String for a variable
+		// initialized with new(codec.String)
+		v := reflect.ValueOf(sym)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return nil, fmt.Errorf("%T is not a codec", sym)
+		}
+		c, ok := v.Elem().Interface().(goka.Codec)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a codec", sym)
+		}
+		codec = c
+	}
+	if isNil(codec) {
+		return nil, fmt.Errorf("codec is nil")
+	}
+	return codec, nil
+}
+
+// isNil returns whether the interface is nil or holds a nil pointer
+func isNil(i interface{}) bool {
+	if i == nil {
+		return true
+	}
+	v := reflect.ValueOf(i)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// LoadCallback loads a process callback from a plugin. The symbol must be a function
+// of type func(goka.Context, interface{}), a variable holding such a function or of
+// type goka.ProcessCallback, or a function of type func() goka.ProcessCallback.
+func LoadCallback(spec Spec) (goka.ProcessCallback, error) {
+	sym, err := lookup(spec)
+	if err != nil {
+		return nil, err
+	}
+	cb, err := callbackFromSymbol(sym)
+	if err != nil {
+		return nil, fmt.Errorf("invalid symbol %s in plugin %s: %v", spec.Symbol, spec.Path, err)
+	}
+	return cb, nil
+}
+
+func callbackFromSymbol(sym plugin.Symbol) (goka.ProcessCallback, error) {
+	var cb goka.ProcessCallback
+	switch s := sym.(type) {
+	case func(goka.Context, interface{}):
+		cb = s
+	case goka.ProcessCallback:
+		cb = s
+	case *goka.ProcessCallback:
+		cb = *s
+	case *func(goka.Context, interface{}):
+		cb = *s
+	case func() goka.ProcessCallback:
+		cb = s()
+	default:
+		return nil, fmt.Errorf("%T is not a process callback", sym)
+	}
+	if cb == nil {
+		return nil, fmt.Errorf("callback is nil")
+	}
+	return cb, nil
+}
+
+// Codec is a codec delegating to a codec loaded from a plugin.
+type Codec struct {
+	m     sync.RWMutex
+	codec goka.Codec
+	spec  Spec
+}
+
+// NewCodec loads the codec from a plugin.
+func NewCodec(spec Spec) (*Codec, error) {
+	c := new(Codec)
+	if err := c.Reload(spec); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the codec from a plugin and replaces the current codec. If loading
+// fails, the current codec is kept.
+func (c *Codec) Reload(spec Spec) error {
+	codec, err := LoadCodec(spec)
+	if err != nil {
+		return err
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.codec = codec
+	c.spec = spec
+	return nil
+}
+
+// Spec returns the spec of the current codec.
+func (c *Codec) Spec() Spec {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.spec
+}
+
+// Encode encodes the value with the current codec.
+func (c *Codec) Encode(value interface{}) ([]byte, error) {
+	c.m.RLock()
+	codec := c.codec
+	c.m.RUnlock()
+	return codec.Encode(value)
+}
+
+// Decode decodes the data with the current codec.
+func (c *Codec) Decode(data []byte) (interface{}, error) {
+	c.m.RLock()
+	codec := c.codec
+	c.m.RUnlock()
+	return codec.Decode(data)
+}
+
+// Callback is a process callback delegating to a callback loaded from a plugin.
+type Callback struct {
+	m    sync.RWMutex
+	cb   goka.ProcessCallback
+	spec Spec
+}
+
+// NewCallback loads the callback from a plugin.
+func NewCallback(spec Spec) (*Callback, error) {
+	c := new(Callback)
+	if err := c.Reload(spec); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload loads the callback from a plugin and replaces the current callback. Messages
+// being processed finish with the previous callback. If loading fails, the current
+// callback is kept.
+func (c *Callback) Reload(spec Spec) error {
+	cb, err := LoadCallback(spec)
+	if err != nil {
+		return err
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.cb = cb
+	c.spec = spec
+	return nil
+}
+
+// Spec returns the spec of the current callback.
+func (c *Callback) Spec() Spec {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	return c.spec
+}
+
+// Process calls the current callback. Pass it as callback of an edge of the group graph.
+func (c *Callback) Process(ctx goka.Context, msg interface{}) {
+	c.m.RLock()
+	cb := c.cb
+	c.m.RUnlock()
+	cb(ctx, msg)
+}
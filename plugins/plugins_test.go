@@ -0,0 +1,119 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestCodecFromSymbol(t *testing.T) {
+	var (
+		stringCodec goka.Codec = new(codec.String)
+		// a plugin variable initialized with new(codec.String)
+		variable = new(codec.String)
+	)
+	for _, sym := range []interface{}{
+		stringCodec,
+		&stringCodec,
+		&variable,
+		func() goka.Codec { return new(codec.String) },
+	} {
+		c, err := codecFromSymbol(sym)
+		test.AssertNil(t, err)
+		data, err := c.Encode("value")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(data), "value")
+	}
+
+	var (
+		nilCodec    goka.Codec
+		nilVariable *codec.String
+	)
+	for _, sym := range []interface{}{
+		new(int),
+		&nilCodec,
+		&nilVariable,
+		func() goka.Codec { return nil },
+	} {
+		_, err := codecFromSymbol(sym)
+		test.AssertNotNil(t, err)
+	}
+}
+
+func TestCallbackFromSymbol(t *testing.T) {
+	var calls int
+	fn := func(ctx goka.Context, msg interface{}) { calls++ }
+	cb := goka.ProcessCallback(fn)
+	var nilCallback goka.ProcessCallback
+
+	for _, sym := range []interface{}{
+		fn,
+		cb,
+		&cb,
+		&fn,
+		func() goka.ProcessCallback { return fn },
+	} {
+		loaded, err := callbackFromSymbol(sym)
+		test.AssertNil(t, err)
+		loaded(nil, nil)
+	}
+	test.AssertEqual(t, calls, 5)
+
+	_, err := callbackFromSymbol(&nilCallback)
+	test.AssertNotNil(t, err)
+	_, err = callbackFromSymbol(func() goka.ProcessCallback { return nil })
+	test.AssertNotNil(t, err)
+	_, err = callbackFromSymbol("callback")
+	test.AssertNotNil(t, err)
+}
+
+func TestLoad_Missing(t *testing.T) {
+	spec := Spec{Path: "does-not-exist.so", Symbol: "Codec"}
+	_, err := NewCodec(spec)
+	test.AssertNotNil(t, err)
+	_, err = NewCallback(spec)
+	test.AssertNotNil(t, err)
+	_, err = LoadCodecs(map[string]Spec{"topic": spec})
+	test.AssertNotNil(t, err)
+
+	// failing reloads keep the current codec
+	c := &Codec{codec: new(codec.String)}
+	test.AssertNotNil(t, c.Reload(spec))
+	value, err := c.Decode([]byte("value"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, "value")
+}
+
+func TestLoad_Plugin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building a plugin is slow")
+	}
+	dir, err := ioutil.TempDir("", "goka-plugins")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.so")
+	out, err := exec.Command("go", "build", "-buildmode=plugin", "-o", path, "./testdata/plugin").CombinedOutput()
+	if err != nil {
+		t.Skipf("cannot build plugin: %v\n%s", err, out)
+	}
+
+	c, err := NewCodec(Spec{Path: path, Symbol: "Codec"})
+	test.AssertNil(t, err)
+	data, err := c.Encode("value")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(data), "value")
+
+	_, err = NewCodec(Spec{Path: path, Symbol: "NilCodec"})
+	test.AssertNotNil(t, err)
+	_, err = NewCodec(Spec{Path: path, Symbol: "Value"})
+	test.AssertNotNil(t, err)
+	_, err = NewCallback(Spec{Path: path, Symbol: "Codec"})
+	test.AssertNotNil(t, err)
+}
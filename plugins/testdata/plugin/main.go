@@ -0,0 +1,25 @@
+// Package main is a plugin loaded by the tests of the plugins package. It does not
+// import goka, as some of its dependencies cannot be built as plugin on all platforms.
+// Its codecs implement goka.Codec nonetheless.
+package main
+
+type stringCodec struct{}
+
+func (c *stringCodec) Encode(value interface{}) ([]byte, error) {
+	return []byte(value.(string)), nil
+}
+
+func (c *stringCodec) Decode(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+// Codec is looked up as **stringCodec
+var Codec = new(stringCodec)
+
+// NilCodec is looked up as **stringCodec holding nil
+var NilCodec *stringCodec
+
+// Value is not a codec
+var Value = "value"
+
+func main() {}
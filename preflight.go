@@ -0,0 +1,302 @@
+package goka
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+// PreflightTopic is the result of checking a topic of the group graph, see PreflightReport.
+type PreflightTopic struct {
+	Topic string
+	// Read and Write are the kinds of access the processor needs to the topic
+	Read  bool
+	Write bool
+	// Created is true if the processor creates the topic when it does not exist
+	Created bool
+	// Exists is false if the topic does not exist or is not visible to the client
+	Exists bool
+	// Partitions is the number of partitions of existing topics
+	Partitions int
+	// Problems lists why the processor cannot use the topic
+	Problems []string
+}
+
+func (t *PreflightTopic) access() string {
+	switch {
+	case t.Read && t.Write:
+		return "read/write"
+	case t.Write:
+		return "write"
+	default:
+		return "read"
+	}
+}
+
+func (t *PreflightTopic) addProblem(format string, args ...interface{}) {
+	t.Problems = append(t.Problems, fmt.Sprintf(format, args...))
+}
+
+// PreflightReport is the consolidated result of checking all topics of a group
+// graph before starting the processor, see Preflight and WithPreflight.
+type PreflightReport struct {
+	Group  Group
+	Topics []*PreflightTopic
+	// ACLsChecked is true if the topic ACLs were evaluated for the principal
+	ACLsChecked bool
+	// Notes contains information about checks that were skipped
+	Notes []string
+}
+
+// OK returns whether no problems were found.
+func (r *PreflightReport) OK() bool {
+	return len(r.Problems()) == 0
+}
+
+// Problems returns the problems of all topics, prefixed with the topic.
+func (r *PreflightReport) Problems() []string {
+	var problems []string
+	for _, t := range r.Topics {
+		for _, p := range t.Problems {
+			problems = append(problems, fmt.Sprintf("%s (%s): %s", t.Topic, t.access(), p))
+		}
+	}
+	return problems
+}
+
+// Err returns an error listing all problems or nil if there are none.
+func (r *PreflightReport) Err() error {
+	problems := r.Problems()
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("preflight of group %s found %d problems:\n\t%s", r.Group, len(problems), strings.Join(problems, "\n\t"))
+}
+
+// String returns the report listing every checked topic.
+func (r *PreflightReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "preflight of group %s:\n", r.Group)
+	for _, t := range r.Topics {
+		status := "ok"
+		switch {
+		case len(t.Problems) > 0:
+			status = strings.Join(t.Problems, "; ")
+		case !t.Exists:
+			status = "ok, will be created"
+		}
+		fmt.Fprintf(&b, "\t%s (%s): %s\n", t.Topic, t.access(), status)
+	}
+	for _, note := range r.Notes {
+		fmt.Fprintf(&b, "\tnote: %s\n", note)
+	}
+	return b.String()
+}
+
+// Preflight checks that the client can use every topic of the group graph without
+// starting a processor. It is meant to fail deployments with missing topics or
+// half-working permissions early, instead of surfacing them as failures while
+// processing. The options are the ones passed to NewProcessor, see WithPreflight
+// for the checks performed.
+// The returned error is only set if the checks could not be run; problems found
+// by the checks are returned in the report, see PreflightReport.Err.
+func Preflight(brokers []string, gg *GroupGraph, options ...ProcessorOption) (*PreflightReport, error) {
+	if err := gg.Validate(); err != nil {
+		return nil, err
+	}
+
+	opts := new(poptions)
+	if err := opts.applyOptions(gg, append(defaultProcessorOptions(gg), options...)...); err != nil {
+		return nil, fmt.Errorf(errApplyOptions, err)
+	}
+
+	tm, err := opts.builders.topicmgr(brokers)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating topic manager: %v", err)
+	}
+	report := preflight(tm, gg, opts.preflightPrincipal)
+	if err := tm.Close(); err != nil {
+		return nil, fmt.Errorf("Error closing topic manager: %v", err)
+	}
+	return report, nil
+}
+
+// topicACLLister is implemented by topic managers that can list the ACLs of all topics
+type topicACLLister interface {
+	topicACLs() ([]sarama.ResourceAcls, error)
+}
+
+// topicACLs lists the ACLs of all topics.
+func (m *topicManager) topicACLs() ([]sarama.ResourceAcls, error) {
+	request := &sarama.DescribeAclsRequest{
+		AclFilter: sarama.AclFilter{
+			ResourceType:              sarama.AclResourceTopic,
+			ResourcePatternTypeFilter: sarama.AclPatternAny,
+			Operation:                 sarama.AclOperationAny,
+			PermissionType:            sarama.AclPermissionAny,
+		},
+	}
+	if m.client.Config().Version.IsAtLeast(sarama.V2_0_0_0) {
+		request.Version = 1
+	}
+
+	broker, err := m.client.Controller()
+	if err != nil {
+		return nil, fmt.Errorf("error getting controller: %v", err)
+	}
+	resp, err := broker.DescribeAcls(request)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != sarama.ErrNoError {
+		return nil, resp.Err
+	}
+
+	acls := make([]sarama.ResourceAcls, 0, len(resp.ResourceAcls))
+	for _, racls := range resp.ResourceAcls {
+		acls = append(acls, *racls)
+	}
+	return acls, nil
+}
+
+// preflightTopics returns the topics of the group graph with the access the processor needs.
+func preflightTopics(gg *GroupGraph) []*PreflightTopic {
+	var (
+		topics []*PreflightTopic
+		byName = make(map[string]*PreflightTopic)
+	)
+	add := func(names []string, read, write, created bool) {
+		for _, topic := range names {
+			t := byName[topic]
+			if t == nil {
+				t = &PreflightTopic{Topic: topic, Created: created}
+				byName[topic] = t
+				topics = append(topics, t)
+			}
+			t.Read = t.Read || read
+			t.Write = t.Write || write
+		}
+	}
+
+	add(gg.inputs().Topics(), true, false, false)
+	add(gg.loopStreams().Topics(), true, true, true)
+	if gt := gg.GroupTable(); gt != nil && !gg.isEphemeralTable() {
+		add([]string{gt.Topic()}, true, true, true)
+	}
+	if len(gg.OutboxStreams()) > 0 {
+		add([]string{outboxName(gg.Group())}, true, true, true)
+		add(gg.OutboxStreams().Topics(), false, true, false)
+	}
+	add(gg.OutputStreams().Topics(), false, true, false)
+	return topics
+}
+
+// preflight checks that all topics of the group graph exist, or are created by the
+// processor, and that the partition offsets of the topics to read can be fetched.
+// If principal is set and the topic manager supports it, the topic ACLs are evaluated
+// for the principal as well.
+func preflight(tm TopicManager, gg *GroupGraph, principal string) *PreflightReport {
+	report := &PreflightReport{
+		Group:  gg.Group(),
+		Topics: preflightTopics(gg),
+	}
+
+	for _, t := range report.Topics {
+		partitions, err := tm.Partitions(t.Topic)
+		switch {
+		case err == errTopicNotFound:
+			if !t.Created {
+				t.addProblem("topic does not exist or is not visible to the client")
+			}
+			continue
+		case err != nil:
+			t.addProblem("error getting partitions: %v", err)
+			continue
+		}
+		t.Exists = true
+		t.Partitions = len(partitions)
+		if !t.Read {
+			continue
+		}
+		for _, partition := range partitions {
+			if _, err := tm.GetOffset(t.Topic, partition, sarama.OffsetNewest); err != nil {
+				t.addProblem("error getting offset of partition %d: %v", partition, err)
+				break
+			}
+		}
+	}
+
+	if principal == "" {
+		return report
+	}
+	lister, ok := tm.(topicACLLister)
+	if !ok {
+		report.Notes = append(report.Notes, "ACLs not checked: not supported by the topic manager")
+		return report
+	}
+	acls, err := lister.topicACLs()
+	if err == sarama.ErrSecurityDisabled {
+		report.Notes = append(report.Notes, "ACLs not checked: no authorizer configured on the cluster")
+		return report
+	} else if err != nil {
+		report.Notes = append(report.Notes, fmt.Sprintf("ACLs not checked: error listing ACLs: %v", err))
+		return report
+	}
+
+	report.ACLsChecked = true
+	for _, t := range report.Topics {
+		if t.Read && !aclAllows(acls, principal, t.Topic, sarama.AclOperationRead) {
+			t.addProblem("principal %s is not allowed to read", principal)
+		}
+		if t.Write && !aclAllows(acls, principal, t.Topic, sarama.AclOperationWrite) {
+			t.addProblem("principal %s is not allowed to write", principal)
+		}
+	}
+	return report
+}
+
+// aclAllows evaluates the topic ACLs like Kafka's authorizer: a matching DENY wins over
+// a matching ALLOW, and the operation is denied if no ACL matches. Only ACLs for all
+// hosts are considered, as the address the brokers see for the client is unknown.
+func aclAllows(acls []sarama.ResourceAcls, principal, topic string, op sarama.AclOperation) bool {
+	var allowed bool
+	for _, racls := range acls {
+		if !aclResourceMatches(racls.Resource, topic) {
+			continue
+		}
+		for _, acl := range racls.Acls {
+			if acl == nil || acl.Host != "*" {
+				continue
+			}
+			if acl.Principal != principal && acl.Principal != "User:*" {
+				continue
+			}
+			if acl.Operation != op && acl.Operation != sarama.AclOperationAll {
+				continue
+			}
+			switch acl.PermissionType {
+			case sarama.AclPermissionDeny:
+				return false
+			case sarama.AclPermissionAllow:
+				allowed = true
+			}
+		}
+	}
+	return allowed
+}
+
+func aclResourceMatches(resource sarama.Resource, topic string) bool {
+	if resource.ResourceType != sarama.AclResourceTopic {
+		return false
+	}
+	switch resource.ResourcePatternType {
+	case sarama.AclPatternPrefixed:
+		return strings.HasPrefix(topic, resource.ResourceName)
+	case sarama.AclPatternLiteral, sarama.AclPatternUnknown:
+		// ACLs described with version 0 have no pattern type and are literal
+		return resource.ResourceName == topic || resource.ResourceName == "*"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,217 @@
+package goka
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+// aclTopicManager adds listing ACLs to a topic manager
+type aclTopicManager struct {
+	TopicManager
+	acls []sarama.ResourceAcls
+	err  error
+}
+
+func (m *aclTopicManager) topicACLs() ([]sarama.ResourceAcls, error) {
+	return m.acls, m.err
+}
+
+func preflightTestGraph() *GroupGraph {
+	return DefineGroup("test",
+		Input("input", new(codec.String), func(ctx Context, msg interface{}) {}),
+		Lookup("lookup", new(codec.String)),
+		Loop(new(codec.String), func(ctx Context, msg interface{}) {}),
+		Output("output", new(codec.String)),
+		Persist(new(codec.String)),
+	)
+}
+
+func TestPreflight(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		tmgr := NewMockTopicManager(ctrl)
+		tmgr.EXPECT().Partitions("input").Return([]int32{0, 1}, nil)
+		tmgr.EXPECT().GetOffset("input", gomock.Any(), sarama.OffsetNewest).Return(int64(0), nil).Times(2)
+		tmgr.EXPECT().Partitions("lookup").Return([]int32{0}, nil)
+		tmgr.EXPECT().GetOffset("lookup", int32(0), sarama.OffsetNewest).Return(int64(0), nil)
+		tmgr.EXPECT().Partitions("test-loop").Return(nil, errTopicNotFound)
+		tmgr.EXPECT().Partitions("test-table").Return(nil, errTopicNotFound)
+		tmgr.EXPECT().Partitions("output").Return([]int32{0, 1}, nil)
+
+		report := preflight(tmgr, preflightTestGraph(), "")
+		test.AssertTrue(t, report.OK())
+		test.AssertNil(t, report.Err())
+		test.AssertFalse(t, report.ACLsChecked)
+		test.AssertEqual(t, len(report.Topics), 5)
+		test.AssertEqual(t, report.Topics[0].Partitions, 2)
+		test.AssertTrue(t, report.Topics[0].Read)
+		test.AssertFalse(t, report.Topics[0].Write)
+		test.AssertFalse(t, report.Topics[2].Exists)
+		test.AssertTrue(t, report.Topics[2].Created)
+		test.AssertTrue(t, strings.Contains(report.String(), "test-table (read/write): ok, will be created"))
+	})
+	t.Run("problems", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		tmgr := NewMockTopicManager(ctrl)
+		tmgr.EXPECT().Partitions("input").Return([]int32{0, 1}, nil)
+		tmgr.EXPECT().GetOffset("input", int32(0), sarama.OffsetNewest).Return(int64(0), sarama.ErrTopicAuthorizationFailed)
+		tmgr.EXPECT().Partitions("lookup").Return(nil, errTopicNotFound)
+		tmgr.EXPECT().Partitions("test-loop").Return([]int32{0, 1}, nil)
+		tmgr.EXPECT().GetOffset("test-loop", gomock.Any(), sarama.OffsetNewest).Return(int64(0), nil).Times(2)
+		tmgr.EXPECT().Partitions("test-table").Return(nil, errors.New("broker down"))
+		tmgr.EXPECT().Partitions("output").Return(nil, errTopicNotFound)
+
+		report := preflight(tmgr, preflightTestGraph(), "")
+		test.AssertFalse(t, report.OK())
+		test.AssertEqual(t, report.Problems(), []string{
+			"input (read): error getting offset of partition 0: kafka server: The client is not authorized to access this topic.",
+			"lookup (read): topic does not exist or is not visible to the client",
+			"test-table (read/write): error getting partitions: broker down",
+			"output (write): topic does not exist or is not visible to the client",
+		})
+		err := report.Err()
+		test.AssertNotNil(t, err)
+		test.AssertStringContains(t, err.Error(), "found 4 problems")
+	})
+}
+
+func TestPreflight_acls(t *testing.T) {
+	expectTopics := func(tmgr *MockTopicManager) {
+		tmgr.EXPECT().Partitions(gomock.Any()).Return([]int32{0}, nil).Times(5)
+		tmgr.EXPECT().GetOffset(gomock.Any(), int32(0), sarama.OffsetNewest).Return(int64(0), nil).Times(4)
+	}
+
+	t.Run("checked", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		tmgr := NewMockTopicManager(ctrl)
+		expectTopics(tmgr)
+
+		acls := []sarama.ResourceAcls{
+			{
+				Resource: sarama.Resource{ResourceType: sarama.AclResourceTopic, ResourceName: "input", ResourcePatternType: sarama.AclPatternLiteral},
+				Acls:     []*sarama.Acl{{Principal: "User:app", Host: "*", Operation: sarama.AclOperationRead, PermissionType: sarama.AclPermissionAllow}},
+			},
+			{
+				Resource: sarama.Resource{ResourceType: sarama.AclResourceTopic, ResourceName: "test-", ResourcePatternType: sarama.AclPatternPrefixed},
+				Acls:     []*sarama.Acl{{Principal: "User:app", Host: "*", Operation: sarama.AclOperationAll, PermissionType: sarama.AclPermissionAllow}},
+			},
+			{
+				Resource: sarama.Resource{ResourceType: sarama.AclResourceTopic, ResourceName: "*", ResourcePatternType: sarama.AclPatternLiteral},
+				Acls:     []*sarama.Acl{{Principal: "User:*", Host: "*", Operation: sarama.AclOperationWrite, PermissionType: sarama.AclPermissionAllow}},
+			},
+			{
+				Resource: sarama.Resource{ResourceType: sarama.AclResourceTopic, ResourceName: "output", ResourcePatternType: sarama.AclPatternLiteral},
+				Acls:     []*sarama.Acl{{Principal: "User:app", Host: "*", Operation: sarama.AclOperationWrite, PermissionType: sarama.AclPermissionDeny}},
+			},
+		}
+
+		report := preflight(&aclTopicManager{TopicManager: tmgr, acls: acls}, preflightTestGraph(), "User:app")
+		test.AssertTrue(t, report.ACLsChecked)
+		test.AssertEqual(t, report.Problems(), []string{
+			"lookup (read): principal User:app is not allowed to read",
+			"output (write): principal User:app is not allowed to write",
+		})
+	})
+
+	t.Run("security-disabled", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		tmgr := NewMockTopicManager(ctrl)
+		expectTopics(tmgr)
+
+		report := preflight(&aclTopicManager{TopicManager: tmgr, err: sarama.ErrSecurityDisabled}, preflightTestGraph(), "User:app")
+		test.AssertTrue(t, report.OK())
+		test.AssertFalse(t, report.ACLsChecked)
+		test.AssertEqual(t, len(report.Notes), 1)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		ctrl := NewMockController(t)
+		defer ctrl.Finish()
+		tmgr := NewMockTopicManager(ctrl)
+		expectTopics(tmgr)
+
+		report := preflight(tmgr, preflightTestGraph(), "User:app")
+		test.AssertTrue(t, report.OK())
+		test.AssertFalse(t, report.ACLsChecked)
+		test.AssertStringContains(t, report.String(), "ACLs not checked")
+	})
+}
+
+func TestAclAllows(t *testing.T) {
+	topicACL := func(name string, pattern sarama.AclResourcePatternType, acls ...*sarama.Acl) sarama.ResourceAcls {
+		return sarama.ResourceAcls{
+			Resource: sarama.Resource{ResourceType: sarama.AclResourceTopic, ResourceName: name, ResourcePatternType: pattern},
+			Acls:     acls,
+		}
+	}
+	allowRead := &sarama.Acl{Principal: "User:app", Host: "*", Operation: sarama.AclOperationRead, PermissionType: sarama.AclPermissionAllow}
+
+	// no ACLs deny
+	test.AssertFalse(t, aclAllows(nil, "User:app", "topic", sarama.AclOperationRead))
+
+	acls := []sarama.ResourceAcls{topicACL("topic", sarama.AclPatternLiteral, allowRead)}
+	test.AssertTrue(t, aclAllows(acls, "User:app", "topic", sarama.AclOperationRead))
+	test.AssertFalse(t, aclAllows(acls, "User:app", "topic", sarama.AclOperationWrite))
+	test.AssertFalse(t, aclAllows(acls, "User:other", "topic", sarama.AclOperationRead))
+	test.AssertFalse(t, aclAllows(acls, "User:app", "topic-2", sarama.AclOperationRead))
+
+	// ACLs of version 0 have no pattern type
+	acls = []sarama.ResourceAcls{topicACL("topic", sarama.AclPatternUnknown, allowRead)}
+	test.AssertTrue(t, aclAllows(acls, "User:app", "topic", sarama.AclOperationRead))
+
+	// ACLs for specific hosts are ignored
+	acls = []sarama.ResourceAcls{topicACL("topic", sarama.AclPatternLiteral,
+		&sarama.Acl{Principal: "User:app", Host: "10.0.0.1", Operation: sarama.AclOperationRead, PermissionType: sarama.AclPermissionAllow})}
+	test.AssertFalse(t, aclAllows(acls, "User:app", "topic", sarama.AclOperationRead))
+
+	// deny wins
+	acls = []sarama.ResourceAcls{
+		topicACL("top", sarama.AclPatternPrefixed, allowRead),
+		topicACL("*", sarama.AclPatternLiteral,
+			&sarama.Acl{Principal: "User:*", Host: "*", Operation: sarama.AclOperationAll, PermissionType: sarama.AclPermissionDeny}),
+	}
+	test.AssertFalse(t, aclAllows(acls, "User:app", "topic", sarama.AclOperationRead))
+}
+
+func TestProcessor_Preflight(t *testing.T) {
+	ctrl, bm := createMockBuilder(t)
+	defer ctrl.Finish()
+
+	bm.tmgr.EXPECT().Partitions("input").Return(nil, errTopicNotFound)
+	bm.tmgr.EXPECT().Partitions("output").Return(nil, errTopicNotFound)
+	bm.tmgr.EXPECT().Close().Return(nil)
+
+	graph := DefineGroup("test",
+		Input("input", new(codec.String), func(ctx Context, msg interface{}) {}),
+		Output("output", new(codec.String)),
+	)
+
+	_, err := NewProcessor([]string{"localhost:9092"}, graph,
+		WithTopicManagerBuilder(bm.getTopicManagerBuilder()),
+		WithPreflight(""),
+	)
+	test.AssertNotNil(t, err)
+	test.AssertStringContains(t, err.Error(), "input (read): topic does not exist")
+	test.AssertStringContains(t, err.Error(), "output (write): topic does not exist")
+
+	bm.tmgr.EXPECT().Partitions("input").Return([]int32{0}, nil)
+	bm.tmgr.EXPECT().GetOffset("input", int32(0), sarama.OffsetNewest).Return(int64(0), nil)
+	bm.tmgr.EXPECT().Partitions("output").Return([]int32{0}, nil)
+	bm.tmgr.EXPECT().Close().Return(nil)
+
+	report, err := Preflight([]string{"localhost:9092"}, graph,
+		WithTopicManagerBuilder(bm.getTopicManagerBuilder()),
+	)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, report.OK())
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -52,6 +53,11 @@ type Processor struct {
 
 	graph *GroupGraph
 
+	limiters  *processingLimiters
+	lagGate   *lookupLagGate
+	drain     *drainTracker
+	promotion *standbyPromotion
+
 	saramaConsumer sarama.Consumer
 	producer       Producer
 	tmgr           TopicManager
@@ -60,6 +66,12 @@ type Processor struct {
 
 	done   chan struct{}
 	cancel context.CancelFunc
+	// error returned by Run. Only valid after done is closed.
+	runErr error
+	// errors that did not stop the processor, see DebugDump
+	recentErrors recentErrors
+	// shutdown collects the shutdown report while running, nil without WithShutdownReport
+	shutdown *shutdownRecorder
 }
 
 // NewProcessor creates a processor instance in a group given the address of
@@ -68,13 +80,7 @@ type Processor struct {
 func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption) (*Processor, error) {
 	options = append(
 		// default options comes first
-		[]ProcessorOption{
-			WithClientID(fmt.Sprintf("goka-processor-%s", gg.Group())),
-			WithUpdateCallback(DefaultUpdate),
-			WithPartitionChannelSize(defaultPartitionChannelSize),
-			WithStorageBuilder(storage.DefaultBuilder(DefaultProcessorStoragePath(gg.Group()))),
-			WithRebalanceCallback(DefaultRebalance),
-		},
+		defaultProcessorOptions(gg),
 
 		// user-defined options (may overwrite default ones)
 		options...,
@@ -89,6 +95,10 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 	if err != nil {
 		return nil, fmt.Errorf(errApplyOptions, err)
 	}
+	if opts.topicPrefix != "" {
+		gg = gg.withTopicPrefix(opts.topicPrefix)
+		opts.prefixTopics()
+	}
 
 	npar, err := prepareTopics(brokers, gg, opts)
 	if err != nil {
@@ -98,14 +108,32 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 	// create views
 	lookupTables := make(map[string]*View)
 	for _, t := range gg.LookupTables() {
-		view, err := NewView(brokers, Table(t.Topic()), t.Codec(),
+		viewOpts := []ViewOption{
 			WithViewLogger(opts.log),
 			WithViewHasher(opts.hasher),
 			WithViewClientID(opts.clientID),
 			WithViewTopicManagerBuilder(opts.builders.topicmgr),
 			WithViewStorageBuilder(opts.builders.storage),
 			WithViewConsumerSaramaBuilder(opts.builders.consumerSarama),
-		)
+			WithViewStatsInterval(opts.statsInterval),
+		}
+		if opts.statsDisabled {
+			viewOpts = append(viewOpts, WithViewStatsDisabled())
+		}
+		if opts.removeStorage != nil {
+			viewOpts = append(viewOpts, WithViewStorageRebuild(opts.removeStorage))
+		}
+		if opts.storageLimiter != nil {
+			// share the limit of the processor's tables
+			limiter := opts.storageLimiter
+			viewOpts = append(viewOpts, func(o *voptions, table Table, codec Codec) {
+				o.storageLimiter = limiter
+			})
+		}
+		if m, ok := opts.tableMigrations[t.Topic()]; ok {
+			viewOpts = append(viewOpts, WithViewTableMigration(m.version, m.migrate))
+		}
+		view, err := NewView(brokers, Table(t.Topic()), t.Codec(), viewOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("error creating view: %v", err)
 		}
@@ -126,13 +154,44 @@ func NewProcessor(brokers []string, gg *GroupGraph, options ...ProcessorOption)
 
 		graph: gg,
 
+		limiters: newProcessingLimiters(opts.maxProcessingRate, opts.topicProcessingRates),
+
 		state: NewSignal(ProcStateIdle, ProcStateStarting, ProcStateSetup, ProcStateRunning, ProcStateStopping).SetState(ProcStateIdle),
 		done:  make(chan struct{}),
 	}
 
+	if opts.maxLookupLag > 0 {
+		processor.lagGate = newLookupLagGate(opts.maxLookupLag, lookupTables, processor.log)
+	}
+	if opts.drain {
+		processor.drain = newDrainTracker()
+	}
+	if opts.shutdownReport != nil {
+		processor.shutdown = newShutdownRecorder(string(gg.Group()))
+	}
+	if opts.promotionConfig != nil {
+		processor.promotion = newStandbyPromotion(opts.promotionConfig)
+	}
+	if opts.expvarName != "" {
+		if err := processor.publishExpvar(opts.expvarName); err != nil {
+			return nil, err
+		}
+	}
+
 	return processor, nil
 }
 
+// defaultProcessorOptions returns the options applied before the user-defined ones.
+func defaultProcessorOptions(gg *GroupGraph) []ProcessorOption {
+	return []ProcessorOption{
+		WithClientID(fmt.Sprintf("goka-processor-%s", gg.Group())),
+		WithUpdateCallback(DefaultUpdate),
+		WithPartitionChannelSize(defaultPartitionChannelSize),
+		WithStorageBuilder(storage.DefaultBuilder(DefaultProcessorStoragePath(gg.Group()))),
+		WithRebalanceCallback(DefaultRebalance),
+	}
+}
+
 // Graph returns the group graph of the processor.
 func (g *Processor) Graph() *GroupGraph {
 	return g.graph
@@ -182,6 +241,56 @@ func (g *Processor) Get(key string) (interface{}, error) {
 	return value, nil
 }
 
+// PartitionFor returns the partition of the key in the processor's topics, using
+// the processor's hasher and the partition count of its input topics.
+func (g *Processor) PartitionFor(key string) (int32, error) {
+	return g.hash(key)
+}
+
+// OwnsKey returns whether the partition of the key is currently assigned to this
+// processor instance.
+func (g *Processor) OwnsKey(key string) (bool, error) {
+	p, err := g.hash(key)
+	if err != nil {
+		return false, err
+	}
+	_, ok := g.getPartProc(p)
+	return ok, nil
+}
+
+// WaitForKeyOffset blocks until the group table partition of the key contains the
+// write at the passed offset of the table topic, e.g. the offset of a consistency token
+// passed by WithCtxConsistencyToken. Use it to wait for the update caused by a command
+// instead of polling Get. The partition of the key must be assigned to the processor.
+// If the write is not stored within timeout, ErrConsistencyTimeout is returned.
+func (g *Processor) WaitForKeyOffset(key string, offset int64, timeout time.Duration) error {
+	if g.isStateless() {
+		return fmt.Errorf("can't wait for table offset in stateless processor")
+	}
+	if g.graph.isEphemeralTable() {
+		return fmt.Errorf("can't wait for table offset of ephemeral table")
+	}
+
+	p, err := g.hash(key)
+	if err != nil {
+		return err
+	}
+	pproc, ok := g.getPartProc(p)
+	if !ok {
+		return fmt.Errorf("this processor does not contain partition %v", p)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := pproc.table.waitForOffset(ctx, offset); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("error waiting for offset %d of key %s: %w", offset, key, ErrConsistencyTimeout)
+		}
+		return err
+	}
+	return nil
+}
+
 func (g *Processor) find(key string) (storage.Storage, error) {
 	p, err := g.hash(key)
 	if err != nil {
@@ -249,6 +358,14 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 	ctx, g.cancel = context.WithCancel(ctx)
 	errg, ctx := multierr.NewErrGroup(ctx)
 	defer close(g.done)
+	g.shutdown.start()
+	defer func() {
+		report := g.shutdown.finish(g.recentErrors.list(), rerr)
+		if report != nil {
+			g.opts.shutdownReport(report)
+		}
+	}()
+	defer func() { g.runErr = rerr }()
 	defer g.cancel()
 
 	// set a starting state. From this point on we know that there's a cancel and a valid context set
@@ -263,14 +380,15 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 	}()
 
 	// create kafka consumer
-	consumerGroup, err := g.opts.builders.consumerGroup(g.brokers, string(g.graph.Group()), g.opts.clientID)
+	consumerGroup, err := g.opts.builders.consumerGroup(g.brokers, g.opts.consumerGroupID, g.opts.clientID)
 	if err != nil {
 		return fmt.Errorf(errBuildConsumer, err)
 	}
 
+	// get the errors channel before starting the goroutine, as closing the consumer group
+	// might replace the channel (e.g. in the tester)
+	consumerErrors := consumerGroup.Errors()
 	errg.Go(func() error {
-		consumerErrors := consumerGroup.Errors()
-
 		for {
 			select {
 			case err, ok := <-consumerErrors:
@@ -284,6 +402,7 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 				}
 
 				g.log.Printf("Error executing group consumer (continuing execution): %v", err)
+				g.recentErrors.add(err)
 			case <-ctx.Done():
 				//  drain the channel and log in case we still have errors in the channel, otherwise they would be muted.
 				for err := range consumerErrors {
@@ -303,11 +422,38 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 		return fmt.Errorf("Error creating topic manager for brokers [%s]: %v", strings.Join(g.brokers, ","), err)
 	}
 
+	// capture the end offsets before consuming anything
+	if g.drain != nil {
+		if err := g.drain.capture(g.tmgr, g.consumedTopics()); err != nil {
+			return fmt.Errorf("error capturing end offsets to drain: %v", err)
+		}
+		errg.Go(func() error {
+			select {
+			case <-g.drain.done:
+				g.log.Printf("all partitions drained, stopping")
+				g.cancel()
+			case <-ctx.Done():
+			}
+			return nil
+		})
+	}
+
 	// create kafka producer
 	g.log.Debugf("creating producer")
-	producer, err := g.opts.builders.producer(g.brokers, g.opts.clientID, g.opts.hasher)
-	if err != nil {
-		return fmt.Errorf(errBuildProducer, err)
+	var producer Producer
+	if g.opts.readOnly {
+		producer = newReadOnlyProducer(g.opts.readOnlyEmit, g.log)
+	} else {
+		producer, err = g.opts.builders.producer(g.brokers, g.opts.clientID, g.opts.hasher)
+		if err != nil {
+			return fmt.Errorf(errBuildProducer, err)
+		}
+	}
+	if g.opts.backfillOutputs {
+		producer = newBackfillProducer(producer, g.graph, g.opts.backfillEmit, g.log)
+	}
+	if g.opts.auditTopic != "" {
+		producer = newAuditProducer(producer, g.graph.prefixed(string(g.opts.auditTopic)), g.opts.instanceID, g.log)
 	}
 	g.producer = producer
 	defer func() {
@@ -335,6 +481,25 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 
 	g.waitForStartupTables(ctx)
 
+	if g.lagGate != nil {
+		errg.Go(func() error {
+			return g.lagGate.run(ctx)
+		})
+	}
+
+	if g.opts.compactionSchedule != nil {
+		errg.Go(func() error {
+			runCompactionSchedule(ctx, g.opts.compactionSchedule, g.tables, g.log)
+			return nil
+		})
+	}
+
+	if g.opts.partitionCheckInterval > 0 {
+		errg.Go(func() error {
+			return g.watchPartitionCounts(ctx, g.opts.partitionCheckInterval)
+		})
+	}
+
 	// run the main rebalance-consume-loop
 	errg.Go(func() error {
 		return g.rebalanceLoop(ctx, consumerGroup)
@@ -343,14 +508,20 @@ func (g *Processor) Run(ctx context.Context) (rerr error) {
 	return errg.Wait().NilOrError()
 }
 
-func (g *Processor) rebalanceLoop(ctx context.Context, consumerGroup sarama.ConsumerGroup) (rerr error) {
+// consumedTopics returns the input and loop topics consumed by the consumer group.
+func (g *Processor) consumedTopics() []string {
 	var topics []string
 	for _, e := range g.graph.InputStreams() {
 		topics = append(topics, e.Topic())
 	}
-	if g.graph.LoopStream() != nil {
-		topics = append(topics, g.graph.LoopStream().Topic())
+	for _, loop := range g.graph.loopStreams() {
+		topics = append(topics, loop.Topic())
 	}
+	return topics
+}
+
+func (g *Processor) rebalanceLoop(ctx context.Context, consumerGroup sarama.ConsumerGroup) (rerr error) {
+	topics := g.consumedTopics()
 
 	var errs = new(multierr.Errors)
 
@@ -368,27 +539,49 @@ func (g *Processor) rebalanceLoop(ctx context.Context, consumerGroup sarama.Cons
 	for {
 		var (
 			consumeErr = make(chan error)
+			rejoin     <-chan struct{}
 		)
+		// the session context is cancelled to rejoin the group
+		sessionCtx, endSession := context.WithCancel(ctx)
+		if g.promotion != nil {
+			// the session is not running, so the user data can be updated safely
+			if err := g.promotion.apply(); err != nil {
+				endSession()
+				errs.Collect(err)
+				return
+			}
+			rejoin = g.promotion.rejoin
+		}
 		go func() {
 			g.log.Debugf("consuming from consumer loop")
 			defer g.log.Debugf("consuming from consumer loop done")
 			defer close(consumeErr)
-			err := consumerGroup.Consume(ctx, topics, g)
+			err := consumerGroup.Consume(sessionCtx, topics, g)
 			if err != nil {
 				consumeErr <- err
 			}
 		}()
 		select {
 		case err := <-consumeErr:
+			endSession()
 			g.log.Debugf("Consumer group loop done, will stop here")
 
 			if err != nil {
 				errs.Collect(err)
 				return
 			}
+		case <-rejoin:
+			g.log.Printf("rejoining consumer group to promote standby partitions")
+			endSession()
+			if err := <-consumeErr; err != nil {
+				errs.Collect(err)
+				return
+			}
+			continue
 		case <-ctx.Done():
 			g.log.Debugf("context closed, waiting for processor to finish up")
 			err := <-consumeErr
+			endSession()
 			errs.Collect(err)
 			g.log.Debugf("context closed, waiting for processor to finish up")
 			return
@@ -432,8 +625,12 @@ func (g *Processor) waitForStartupTables(ctx context.Context) error {
 
 			select {
 			case <-ctx.Done():
+				return nil
 			case <-view.WaitRunning():
 			}
+			if g.opts.lookupMaxStaleness > 0 {
+				g.waitForFreshLookup(ctx, view)
+			}
 			return nil
 		})
 	}
@@ -519,6 +716,36 @@ func (g *Processor) waitForStartupTables(ctx context.Context) error {
 	}
 }
 
+// waitForFreshLookup waits until every partition of the view contains a message not
+// older than the max staleness, the warmup timeout passed or the context is done.
+func (g *Processor) waitForFreshLookup(ctx context.Context, view *View) {
+	var timeout <-chan time.Time
+	if g.opts.lookupWarmupTimeout > 0 {
+		timer := time.NewTimer(g.opts.lookupWarmupTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		stale := view.stalePartitions(g.opts.lookupMaxStaleness)
+		if len(stale) == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout:
+			g.log.Printf("lookup table %s is still stale after %v (partitions %v), starting anyway",
+				view.topic, g.opts.lookupWarmupTimeout, stale)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // find partitions that will any type of local state for this processor.
 // This includes joins and the group-table. If neither are present, it returns an empty list, because
 // it means that the processor is stateless and has only streaming-input.
@@ -544,12 +771,160 @@ func (g *Processor) findStatefulPartitions() ([]int32, error) {
 	return allPartitions, err
 }
 
+// WaitRunning blocks until the processor is running, i.e. it recovered all tables and
+// started processing. It returns an error if the context is done or the processor
+// terminated before, e.g. because it failed to start.
+func (g *Processor) WaitRunning(ctx context.Context) error {
+	select {
+	case <-g.state.WaitForState(ProcStateRunning):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-g.done:
+		if g.runErr != nil {
+			return fmt.Errorf("processor terminated: %w", g.runErr)
+		}
+		return errors.New("processor terminated")
+	}
+}
+
 // Recovered returns whether the processor is running, i.e. if the processor
 // has recovered all lookups/joins/tables and is running
 func (g *Processor) Recovered() bool {
 	return g.state.IsState(ProcStateRunning)
 }
 
+// TableLag returns the maximum number of messages of a joined or lookup table that
+// are not loaded yet. For joined tables, only the partitions currently assigned to
+// the processor are considered.
+func (g *Processor) TableLag(table Table) (int64, error) {
+	g.mTables.RLock()
+	defer g.mTables.RUnlock()
+
+	table = Table(g.graph.prefixed(string(table)))
+	if view, ok := g.lookupTables[string(table)]; ok {
+		return view.Lag()
+	}
+
+	var joined bool
+	for _, join := range g.graph.JointTables() {
+		joined = joined || join.Topic() == string(table)
+	}
+	if !joined {
+		return 0, fmt.Errorf("table %s is neither joined nor looked up by the processor", table)
+	}
+
+	var tables []*PartitionTable
+	for _, pproc := range g.partitions {
+		if join, ok := pproc.joins[string(table)]; ok {
+			tables = append(tables, join)
+		}
+	}
+	return maxLag(tables)
+}
+
+// CheckTable compares the local group table with its changelog, e.g. to validate
+// the local storages after a storage incident. If sample is larger than 1, only
+// about 1/sample of the keys are compared, selected by their hash. Otherwise all
+// keys are compared. The processing of each partition is paused while its
+// changelog is read, so full comparisons of large tables should be done off-peak.
+// It returns a report for each partition assigned to the processor.
+func (g *Processor) CheckTable(ctx context.Context, sample int) ([]*TableRepairReport, error) {
+	return g.repairTable(ctx, sample, false)
+}
+
+// RepairTable compares the local group table with its changelog like CheckTable and
+// replaces divergent local values with the values of the changelog.
+func (g *Processor) RepairTable(ctx context.Context, sample int) ([]*TableRepairReport, error) {
+	return g.repairTable(ctx, sample, true)
+}
+
+func (g *Processor) repairTable(ctx context.Context, sample int, repair bool) ([]*TableRepairReport, error) {
+	if g.graph.GroupTable() == nil || g.graph.isEphemeralTable() {
+		return nil, fmt.Errorf("cannot check table: processor has no group table with changelog")
+	}
+	if !g.state.IsState(ProcStateRunning) {
+		return nil, fmt.Errorf("cannot check table: processor is not running")
+	}
+
+	g.mTables.RLock()
+	partitions := make([]*PartitionProcessor, 0, len(g.partitions))
+	for _, pproc := range g.partitions {
+		partitions = append(partitions, pproc)
+	}
+	g.mTables.RUnlock()
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].partition < partitions[j].partition })
+
+	var reports []*TableRepairReport
+	for _, pproc := range partitions {
+		report, err := pproc.repairTable(ctx, sample, repair)
+		if err != nil {
+			return reports, fmt.Errorf("error checking table partition %d: %v", pproc.partition, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Compact compacts the local storages of the group table, joined and lookup tables
+// one after another, if the storages support compaction (see storage.Compactable).
+// Use it to compact outside of peak hours, or see WithCompactionSchedule.
+func (g *Processor) Compact(ctx context.Context) error {
+	return compactTables(ctx, g.tables())
+}
+
+// Snapshot copies the local storages of the group table, joined and lookup tables,
+// including their offsets, into the directory, which must not exist. Each partition
+// is copied consistently while the processor keeps running, so the snapshot can be
+// used to back up the tables or to bootstrap new instances. The storages have to
+// implement storage.Snapshotter, and the snapshot lists them in its manifest (see
+// SnapshotManifest). New instances can be bootstrapped from the snapshot with
+// storage.SnapshotBuilder.
+func (g *Processor) Snapshot(dir string) error {
+	return snapshotTables(dir, g.tables())
+}
+
+// tables returns the partition tables of the group table, joined and lookup tables
+func (g *Processor) tables() []*PartitionTable {
+	g.mTables.RLock()
+	defer g.mTables.RUnlock()
+
+	var tables []*PartitionTable
+	for _, pproc := range g.partitions {
+		if pproc.table != nil {
+			tables = append(tables, pproc.table)
+		}
+		for _, join := range pproc.joins {
+			tables = append(tables, join)
+		}
+	}
+	for _, view := range g.lookupTables {
+		tables = append(tables, view.partitions...)
+	}
+	return tables
+}
+
+// GetOffsets returns the oldest and newest offsets of all partitions of the topic, e.g.
+// to compute the progress of the processor in an input topic.
+// It can only be used while the processor is running.
+func (g *Processor) GetOffsets(topic string) (map[int32]PartitionOffsets, error) {
+	if !g.state.IsState(ProcStateSetup) && !g.state.IsState(ProcStateRunning) {
+		return nil, fmt.Errorf("cannot get offsets: processor is not running")
+	}
+	return GetOffsets(g.tmgr, g.graph.prefixed(topic))
+}
+
+// CommittedOffsets returns the offsets of all partitions of the topic committed by
+// the processor's consumer group, along with the metadata identifying the instance
+// that committed them.
+// It can only be used while the processor is running.
+func (g *Processor) CommittedOffsets(topic string) (map[int32]CommittedOffset, error) {
+	if !g.state.IsState(ProcStateSetup) && !g.state.IsState(ProcStateRunning) {
+		return nil, fmt.Errorf("cannot get committed offsets: processor is not running")
+	}
+	return GetCommittedOffsets(g.tmgr, g.opts.consumerGroupID, g.graph.prefixed(topic))
+}
+
 func (g *Processor) assignmentFromSession(session sarama.ConsumerGroupSession) (Assignment, error) {
 	var (
 		assignment Assignment
@@ -606,10 +981,31 @@ func (g *Processor) Setup(session sarama.ConsumerGroupSession) error {
 	if len(assignment) == 0 {
 		g.log.Printf("No partitions assigned. Claims were: %#v. Will probably sleep this generation", session.Claims())
 	}
+	if !g.opts.startTime.IsZero() {
+		if err := g.seekStartTime(session); err != nil {
+			return err
+		}
+	}
+
+	mark := session.MarkMessage
+	if g.opts.readOnly {
+		// read-only processors never commit offsets
+		mark = func(*sarama.ConsumerMessage, string) {}
+	}
+	commit := mark
+	if g.drain != nil {
+		g.drain.setClaims(session.Claims())
+		commit = func(msg *sarama.ConsumerMessage, meta string) {
+			mark(msg, meta)
+			g.drain.processed(msg.Topic, msg.Partition, msg.Offset)
+		}
+	}
+	commit = g.shutdown.trackCommits(commit)
+
 	// create partition views for all partitions
 	for partition := range assignment {
 		// create partition processor for our partition
-		pproc, err := g.createPartitionProcessor(session.Context(), partition, runModeActive, session.MarkMessage)
+		pproc, err := g.createPartitionProcessor(session.Context(), partition, runModeActive, commit)
 		if err != nil {
 			return fmt.Errorf("Error creating partition processor for %s/%d: %v", g.Graph().Group(), partition, err)
 		}
@@ -631,7 +1027,7 @@ func (g *Processor) Setup(session sarama.ConsumerGroupSession) error {
 			if _, ex := g.getPartProc(standby); ex {
 				continue
 			}
-			pproc, err := g.createPartitionProcessor(session.Context(), standby, runModePassive, session.MarkMessage)
+			pproc, err := g.createPartitionProcessor(session.Context(), standby, runModePassive, mark)
 			if err != nil {
 				return fmt.Errorf("Error creating partition processor for %s/%d: %v", g.Graph().Group(), standby, err)
 			}
@@ -666,7 +1062,9 @@ func (g *Processor) Cleanup(session sarama.ConsumerGroupSession) error {
 	for part, partition := range g.partitions {
 		partID, pproc := part, partition
 		errg.Go(func() error {
+			start := time.Now()
 			err := pproc.Stop()
+			g.shutdown.stopped(partID, time.Since(start), err)
 			if err != nil {
 				return fmt.Errorf("error stopping partition processor %d: %v", partID, err)
 			}
@@ -731,6 +1129,23 @@ func (g *Processor) ConsumeClaim(session sarama.ConsumerGroupSession, claim sara
 
 	messages := claim.Messages()
 	errors := part.Errors()
+	input := part.inputs.channel(claim.Topic())
+	isLoop := g.graph.isLoopTopic(claim.Topic())
+
+	// in drain mode, only consume up to the end offset captured on start
+	drainEnd := int64(-1)
+	if g.drain != nil {
+		drainEnd = g.drain.end(claim.Topic(), claim.Partition())
+		offset := claim.InitialOffset()
+		if offset < 0 {
+			var err error
+			offset, err = g.tmgr.GetOffset(claim.Topic(), claim.Partition(), offset)
+			if err != nil {
+				return fmt.Errorf("error resolving initial offset of %s/%d: %v", claim.Topic(), claim.Partition(), err)
+			}
+		}
+		g.drain.start(claim.Topic(), claim.Partition(), offset)
+	}
 
 	for {
 		select {
@@ -739,8 +1154,23 @@ func (g *Processor) ConsumeClaim(session sarama.ConsumerGroupSession, claim sara
 				return nil
 			}
 
+			// drop messages beyond the end to drain
+			if drainEnd >= 0 && msg.Offset >= drainEnd {
+				continue
+			}
+
+			// hold back delayed loopback messages until they are due
+			if isLoop && !waitLoopbackDelivery(session.Context(), msg) {
+				return nil
+			}
+
+			// throttle consumption if a rate limit is configured
+			if !g.limiters.wait(session.Context(), msg.Topic) {
+				return nil
+			}
+
 			select {
-			case part.input <- msg:
+			case input <- msg:
 			case err := <-errors:
 				if err != nil {
 					return newErrProcessing(err)
@@ -780,6 +1210,10 @@ func (g *Processor) StatsWithContext(ctx context.Context) *ProcessorStats {
 		partID, proc := partID, proc
 		errg.Go(func() error {
 			partStats := proc.fetchStats(ctx)
+			if partStats == nil {
+				// stats disabled or timed out
+				return nil
+			}
 
 			m.Lock()
 			defer m.Unlock()
@@ -820,7 +1254,7 @@ func (g *Processor) createPartitionProcessor(ctx context.Context, partition int3
 	if err != nil {
 		return nil, fmt.Errorf("processor [%s]: could not build backoff handler: %v", g.graph.Group(), err)
 	}
-	return newPartitionProcessor(partition,
+	pproc := newPartitionProcessor(partition,
 		g.graph,
 		commit,
 		g.log,
@@ -831,7 +1265,22 @@ func (g *Processor) createPartitionProcessor(ctx context.Context, partition int3
 		g.producer,
 		g.tmgr,
 		backoff,
-		g.opts.backoffResetTime), nil
+		g.opts.backoffResetTime)
+	pproc.lagGate = g.lagGate
+	return pproc, nil
+}
+
+// ShutdownReport returns the summary of the processor's run after Run returned, or nil
+// before. The report is only recorded if the processor was created with
+// WithShutdownReport, otherwise ShutdownReport always returns nil.
+func (g *Processor) ShutdownReport() *ShutdownReport {
+	return g.shutdown.get()
+}
+
+// Drained returns whether the processor stopped because it drained all its partitions,
+// see WithDrain.
+func (g *Processor) Drained() bool {
+	return g.drain != nil && g.drain.isDone()
 }
 
 // Stop stops the processor.
@@ -856,27 +1305,81 @@ func prepareTopics(brokers []string, gg *GroupGraph, opts *poptions) (npar int,
 		}
 	}()
 
+	if opts.preflight {
+		report := preflight(tm, gg, opts.preflightPrincipal)
+		if err = report.Err(); err != nil {
+			return 0, err
+		}
+		opts.log.Debugf("%s", report)
+	}
+
+	if opts.noTopicCreation {
+		return requireTopics(tm, gg)
+	}
+
 	// check co-partitioned (external) topics have the same number of partitions
 	npar, err = ensureCopartitioned(tm, gg.copartitioned().Topics())
 	if err != nil {
 		return 0, err
 	}
 
-	if ls := gg.LoopStream(); ls != nil {
+	for _, ls := range gg.loopStreams() {
 		if err = tm.EnsureStreamExists(ls.Topic(), npar); err != nil {
 			return 0, err
 		}
 	}
 
-	if gt := gg.GroupTable(); gt != nil {
+	if gt := gg.GroupTable(); gt != nil && !gg.isEphemeralTable() {
 		if err = tm.EnsureTableExists(gt.Topic(), npar); err != nil {
 			return 0, err
 		}
 	}
 
+	if len(gg.OutboxStreams()) > 0 {
+		if err = tm.EnsureTableExists(outboxName(gg.Group()), npar); err != nil {
+			return 0, err
+		}
+	}
+
 	return
 }
 
+// requireTopics checks that all topics of the group graph exist instead of creating
+// them, see WithNoTopicCreation. It returns the number of partitions like ensureCopartitioned.
+func requireTopics(tm TopicManager, gg *GroupGraph) (int, error) {
+	var (
+		topics  = preflightTopics(gg)
+		missing []string
+		created = make(map[string]int)
+	)
+	for _, t := range topics {
+		partitions, err := tm.Partitions(t.Topic)
+		switch {
+		case err == errTopicNotFound:
+			missing = append(missing, t.Topic)
+		case err != nil:
+			return 0, fmt.Errorf("Error fetching partitions for topic %s: %v", t.Topic, err)
+		case t.Created:
+			created[t.Topic] = len(partitions)
+		}
+	}
+	if len(missing) > 0 {
+		return 0, fmt.Errorf("topic creation is disabled, but %d topics of group %s do not exist: %s",
+			len(missing), gg.Group(), strings.Join(missing, ", "))
+	}
+
+	npar, err := ensureCopartitioned(tm, gg.copartitioned().Topics())
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range topics {
+		if n, ok := created[t.Topic]; ok && n != npar {
+			return 0, fmt.Errorf("topic %s has %d partitions, but the input topics have %d", t.Topic, n, npar)
+		}
+	}
+	return npar, nil
+}
+
 // returns the number of partitions the topics have, and an error if topics are
 // not copartitionea.
 func ensureCopartitioned(tm TopicManager, topics []string) (int, error) {
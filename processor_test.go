@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -46,7 +47,7 @@ func expectCGEmit(bm *builderMock, table string, msgs []*sarama.ConsumerMessage)
 func expectCGLoop(bm *builderMock, loop string, msgs []*sarama.ConsumerMessage) {
 	bm.tmgr.EXPECT().EnsureStreamExists(loop, 1).AnyTimes()
 	for _, msg := range msgs {
-		bm.producer.EXPECT().EmitWithHeaders(loop, string(msg.Key), gomock.Any(), nil).Return(NewPromise().finish(nil, nil))
+		bm.producer.EXPECT().EmitWithHeaders(loop, string(msg.Key), gomock.Any(), Headers{LoopbackHopsHeader: []byte("1")}).Return(NewPromise().finish(nil, nil))
 	}
 }
 
@@ -313,3 +314,116 @@ func TestProcessor_Run(t *testing.T) {
 		test.AssertTrue(t, strings.Contains(procErr.Error(), "consume-error"))
 	})
 }
+
+func TestProcessor_waitForFreshLookup(t *testing.T) {
+	pt, bm, ctrl := defaultPT(t, "lookup", 0, NewMockAutoConsumer(t, nil), nil)
+	defer ctrl.Finish()
+	bm.mst.EXPECT().Open().Return(nil)
+	test.AssertNil(t, pt.setup(context.Background()))
+	// the table lags behind its topic
+	bm.mst.EXPECT().GetOffset(offsetNotStored).Return(int64(4), nil).AnyTimes()
+	bm.tmgr.EXPECT().GetOffset("lookup", int32(0), sarama.OffsetNewest).Return(int64(10), nil).AnyTimes()
+
+	var (
+		view = &View{topic: "lookup", partitions: []*PartitionTable{pt}}
+		proc = &Processor{
+			opts: &poptions{lookupMaxStaleness: time.Minute},
+			log:  defaultLogger,
+		}
+		ctx = context.Background()
+	)
+
+	t.Run("timeout", func(t *testing.T) {
+		atomic.StoreInt64(&pt.newestTimestamp, time.Now().Add(-time.Hour).UnixNano())
+		proc.opts.lookupWarmupTimeout = 50 * time.Millisecond
+
+		start := time.Now()
+		proc.waitForFreshLookup(ctx, view)
+		test.AssertTrue(t, time.Since(start) >= proc.opts.lookupWarmupTimeout)
+	})
+
+	t.Run("fresh", func(t *testing.T) {
+		atomic.StoreInt64(&pt.newestTimestamp, 0)
+		proc.opts.lookupWarmupTimeout = 0
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt64(&pt.newestTimestamp, time.Now().UnixNano())
+		}()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			proc.waitForFreshLookup(ctx, view)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("lookup did not become fresh")
+		}
+	})
+}
+
+func TestProcessor_PartitionFor(t *testing.T) {
+	proc := &Processor{
+		opts:           &poptions{hasher: DefaultHasher()},
+		partitionCount: 10,
+		partitions:     make(map[int32]*PartitionProcessor),
+	}
+
+	partition, err := proc.PartitionFor("some-key")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, partition >= 0 && partition < 10)
+
+	owns, err := proc.OwnsKey("some-key")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, owns)
+
+	proc.partitions[partition] = new(PartitionProcessor)
+	owns, err = proc.OwnsKey("some-key")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, owns)
+
+	proc.partitionCount = 0
+	_, err = proc.PartitionFor("some-key")
+	test.AssertNotNil(t, err)
+}
+
+func TestProcessor_NoTopicCreation(t *testing.T) {
+	ctrl, bm := createMockBuilder(t)
+	defer ctrl.Finish()
+
+	graph := DefineGroup("test",
+		Input("input", new(codec.String), func(ctx Context, msg interface{}) {}),
+		Output("output", new(codec.String)),
+		Persist(new(codec.String)),
+	)
+
+	// missing topics are listed instead of created
+	bm.tmgr.EXPECT().Partitions("input").Return([]int32{0, 1}, nil)
+	bm.tmgr.EXPECT().Partitions("test-table").Return(nil, errTopicNotFound)
+	bm.tmgr.EXPECT().Partitions("output").Return(nil, errTopicNotFound)
+	bm.tmgr.EXPECT().Close().Return(nil)
+
+	_, err := NewProcessor([]string{"localhost:9092"}, graph,
+		WithTopicManagerBuilder(bm.getTopicManagerBuilder()),
+		WithNoTopicCreation(),
+	)
+	test.AssertNotNil(t, err)
+	test.AssertStringContains(t, err.Error(), "2 topics of group test do not exist: test-table, output")
+
+	// the group table must be copartitioned
+	bm.tmgr.EXPECT().Partitions("input").Return([]int32{0, 1}, nil).Times(2)
+	bm.tmgr.EXPECT().Partitions("test-table").Return([]int32{0}, nil)
+	bm.tmgr.EXPECT().Partitions("output").Return([]int32{0}, nil)
+	_, err = requireTopics(bm.tmgr, graph)
+	test.AssertNotNil(t, err)
+	test.AssertStringContains(t, err.Error(), "topic test-table has 1 partitions")
+
+	bm.tmgr.EXPECT().Partitions("input").Return([]int32{0, 1}, nil).Times(2)
+	bm.tmgr.EXPECT().Partitions("test-table").Return([]int32{0, 1}, nil)
+	bm.tmgr.EXPECT().Partitions("output").Return([]int32{0}, nil)
+	npar, err := requireTopics(bm.tmgr, graph)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, npar, 2)
+}
@@ -0,0 +1,161 @@
+package goka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// ErrPromotionDisabled is returned by Processor.PromoteStandby if the processor
+// was not created with WithStandbyPromotion.
+var ErrPromotionDisabled = errors.New("standby promotion not enabled (see WithStandbyPromotion)")
+
+// promotionRequest is the user data of a group member requesting partitions
+type promotionRequest struct {
+	Partitions []int32 `json:"promote"`
+}
+
+// PromotingStrategy wraps a balance strategy to assign the partitions requested by
+// Processor.PromoteStandby to the requesting members. The partitions of all topics of
+// the plan are moved, so copartitioning is retained. If multiple members request
+// a partition, the member with the lowest member ID gets it.
+func PromotingStrategy(base sarama.BalanceStrategy) sarama.BalanceStrategy {
+	return &promotingStrategy{base: base}
+}
+
+type promotingStrategy struct {
+	base sarama.BalanceStrategy
+}
+
+// Name implements BalanceStrategy.
+func (s *promotingStrategy) Name() string {
+	return s.base.Name() + "+promote"
+}
+
+// Plan implements BalanceStrategy.
+func (s *promotingStrategy) Plan(members map[string]sarama.ConsumerGroupMemberMetadata, topics map[string][]int32) (sarama.BalanceStrategyPlan, error) {
+	plan, err := s.base.Plan(members, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs := make([]string, 0, len(members))
+	for memberID := range members {
+		memberIDs = append(memberIDs, memberID)
+	}
+	sort.Strings(memberIDs)
+
+	promoted := make(map[int32]bool)
+	for _, memberID := range memberIDs {
+		meta := members[memberID]
+		if len(meta.UserData) == 0 {
+			continue
+		}
+		var req promotionRequest
+		if err := json.Unmarshal(meta.UserData, &req); err != nil {
+			// members might use the user data for other purposes
+			continue
+		}
+		for _, partition := range req.Partitions {
+			if promoted[partition] {
+				continue
+			}
+			promoted[partition] = true
+			movePartition(plan, meta.Topics, memberID, partition)
+		}
+	}
+	return plan, nil
+}
+
+// movePartition assigns the partition of the topics to the member, removing it from
+// the other members
+func movePartition(plan sarama.BalanceStrategyPlan, topics []string, memberID string, partition int32) {
+	for _, topic := range topics {
+		found := false
+		for _, assignment := range plan {
+			partitions := assignment[topic]
+			for i, p := range partitions {
+				if p == partition {
+					assignment[topic] = append(partitions[:i], partitions[i+1:]...)
+					found = true
+					break
+				}
+			}
+		}
+		// only move partitions that exist
+		if found {
+			plan.Add(memberID, topic, partition)
+		}
+	}
+}
+
+// AssignmentData implements BalanceStrategy.
+func (s *promotingStrategy) AssignmentData(memberID string, topics map[string][]int32, generationID int32) ([]byte, error) {
+	return s.base.AssignmentData(memberID, topics, generationID)
+}
+
+// standbyPromotion holds the partitions requested by the processor, which are passed
+// to the group leader in the user data of the consumer group config.
+type standbyPromotion struct {
+	m          sync.Mutex
+	config     *sarama.Config
+	partitions []int32
+	// rejoin is signalled to end the current session and rejoin the group
+	rejoin chan struct{}
+}
+
+func newStandbyPromotion(config *sarama.Config) *standbyPromotion {
+	return &standbyPromotion{
+		config: config,
+		rejoin: make(chan struct{}, 1),
+	}
+}
+
+// apply sets the requested partitions as user data. It must only be called
+// while no consumer group session is running.
+func (sp *standbyPromotion) apply() error {
+	sp.m.Lock()
+	defer sp.m.Unlock()
+	if len(sp.partitions) == 0 {
+		sp.config.Consumer.Group.Member.UserData = nil
+		return nil
+	}
+	data, err := json.Marshal(&promotionRequest{Partitions: sp.partitions})
+	if err != nil {
+		return fmt.Errorf("error encoding promotion request: %v", err)
+	}
+	sp.config.Consumer.Group.Member.UserData = data
+	return nil
+}
+
+// PromoteStandby requests the group to assign the partitions to this processor instance,
+// e.g. to move partitions off an instance that is about to be drained. The processor
+// rejoins the consumer group, which rebalances the partitions. The request is kept for
+// following rebalances until PromoteStandby is called again; calling it without
+// partitions returns to the group's default assignment.
+// The processor must be created with WithStandbyPromotion and WithHotStandby, so the
+// tables of the promoted partitions are already recovered.
+func (g *Processor) PromoteStandby(partitions ...int32) error {
+	if g.promotion == nil {
+		return ErrPromotionDisabled
+	}
+	for _, partition := range partitions {
+		if partition < 0 || int(partition) >= g.partitionCount {
+			return fmt.Errorf("invalid partition %d: processor has %d partitions", partition, g.partitionCount)
+		}
+	}
+
+	g.promotion.m.Lock()
+	g.promotion.partitions = append([]int32(nil), partitions...)
+	g.promotion.m.Unlock()
+
+	select {
+	case g.promotion.rejoin <- struct{}{}:
+	default:
+	}
+	return nil
+}
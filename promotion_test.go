@@ -0,0 +1,67 @@
+package goka
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestPromotingStrategy(t *testing.T) {
+	strategy := PromotingStrategy(CopartitioningStrategy)
+	test.AssertEqual(t, strategy.Name(), "copartition+promote")
+
+	topics := map[string][]int32{
+		"input": {0, 1, 2, 3},
+		"table": {0, 1, 2, 3},
+	}
+	member := func(userData string) sarama.ConsumerGroupMemberMetadata {
+		return sarama.ConsumerGroupMemberMetadata{
+			Topics:   []string{"input", "table"},
+			UserData: []byte(userData),
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		plan, err := strategy.Plan(map[string]sarama.ConsumerGroupMemberMetadata{
+			"a": member(""),
+			"b": member("not json"),
+		}, topics)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, plan["a"]["input"], []int32{0, 1})
+		test.AssertEqual(t, plan["b"]["input"], []int32{2, 3})
+	})
+
+	t.Run("promote", func(t *testing.T) {
+		plan, err := strategy.Plan(map[string]sarama.ConsumerGroupMemberMetadata{
+			"a": member(""),
+			"b": member(`{"promote":[0,7]}`),
+		}, topics)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, plan["a"], map[string][]int32{"input": {1}, "table": {1}})
+		test.AssertEqual(t, plan["b"], map[string][]int32{"input": {2, 3, 0}, "table": {2, 3, 0}})
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		plan, err := strategy.Plan(map[string]sarama.ConsumerGroupMemberMetadata{
+			"a": member(""),
+			"b": member(`{"promote":[0]}`),
+			"c": member(`{"promote":[0,1]}`),
+		}, topics)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, plan["a"]["input"], []int32{})
+		test.AssertEqual(t, plan["b"]["input"], []int32{2, 0})
+		test.AssertEqual(t, plan["c"]["input"], []int32{3, 1})
+	})
+}
+
+func TestStandbyPromotion_Apply(t *testing.T) {
+	config := DefaultConfig()
+	sp := newStandbyPromotion(config)
+	test.AssertNil(t, sp.apply())
+	test.AssertTrue(t, config.Consumer.Group.Member.UserData == nil)
+
+	sp.partitions = []int32{1, 2}
+	test.AssertNil(t, sp.apply())
+	test.AssertEqual(t, string(config.Consumer.Group.Member.UserData), `{"promote":[1,2]}`)
+}
@@ -0,0 +1,59 @@
+package goka
+
+import (
+	"runtime/debug"
+)
+
+const (
+	// ProvenanceInstanceHeader is the header containing the ID of the processor instance
+	// that emitted the message, see WithProvenanceHeaders and WithInstanceID
+	ProvenanceInstanceHeader = "goka-instance"
+	// ProvenanceInstanceVersionHeader is the header containing the version of the processor
+	// instance that emitted the message, see WithInstanceVersion
+	ProvenanceInstanceVersionHeader = "goka-instance-version"
+	// ProvenanceGroupHeader is the header containing the group of the processor that
+	// emitted the message
+	ProvenanceGroupHeader = "goka-group"
+	// ProvenanceLibraryVersionHeader is the header containing the version of goka
+	// used by the processor that emitted the message
+	ProvenanceLibraryVersionHeader = "goka-version"
+
+	gokaModule = "github.com/lovoo/goka"
+)
+
+// libraryVersion returns the version of the goka module the binary was built with,
+// "(devel)" if goka is the main module or an empty string if it is unknown.
+func libraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if info.Main.Path == gokaModule {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != gokaModule {
+			continue
+		}
+		if dep.Replace != nil && dep.Replace.Version != "" {
+			return dep.Replace.Version
+		}
+		return dep.Version
+	}
+	return ""
+}
+
+// provenance returns the headers identifying the processor instance
+func (opt *poptions) provenance(group Group) Headers {
+	hdr := Headers{
+		ProvenanceInstanceHeader: []byte(opt.instanceID),
+		ProvenanceGroupHeader:    []byte(group),
+	}
+	if opt.instanceVersion != "" {
+		hdr[ProvenanceInstanceVersionHeader] = []byte(opt.instanceVersion)
+	}
+	if version := libraryVersion(); version != "" {
+		hdr[ProvenanceLibraryVersionHeader] = []byte(version)
+	}
+	return hdr
+}
@@ -1,6 +1,8 @@
 package goka
 
 import (
+	"time"
+
 	"github.com/lovoo/goka/storage"
 )
 
@@ -11,6 +13,12 @@ type storageProxy struct {
 	stateless bool
 	update    UpdateCallback
 
+	// batch collects the writes of the update callback while recovering, if the
+	// storage supports batches. batchOffset is the offset of its last message.
+	batch         *storage.Batch
+	batchMessages int
+	batchOffset   int64
+
 	openedOnce once
 	closedOnce once
 }
@@ -29,7 +37,7 @@ func (s *storageProxy) Close() error {
 	return s.closedOnce.Do(s.Storage.Close)
 }
 
-func (s *storageProxy) Update(k string, v []byte, offset int64, headers Headers) error {
+func (s *storageProxy) Update(k string, v []byte, offset int64, headers Headers, ts time.Time) error {
 	return s.update(&DefaultUpdateContext{
 		storage:   s,
 		topic:     s.topic,
@@ -38,9 +46,22 @@ func (s *storageProxy) Update(k string, v []byte, offset int64, headers Headers)
 		key:       k,
 		value:     v,
 		headers:   headers,
+		timestamp: ts,
 	})
 }
 
+// SetAt stores the value with its timestamp if the storage supports it.
+func (s *storageProxy) SetAt(key string, value []byte, ts time.Time) error {
+	if s.batch != nil {
+		s.batch.Set(key, value)
+		return nil
+	}
+	if st, ok := s.Storage.(storage.TimestampSetter); ok {
+		return st.SetAt(key, value, ts)
+	}
+	return s.Storage.Set(key, value)
+}
+
 func (s *storageProxy) Stateless() bool {
 	return s.stateless
 }
@@ -48,3 +69,103 @@ func (s *storageProxy) Stateless() bool {
 func (s *storageProxy) MarkRecovered() error {
 	return s.Storage.MarkRecovered()
 }
+
+func (s *storageProxy) Set(key string, value []byte) error {
+	if s.batch != nil {
+		s.batch.Set(key, value)
+		return nil
+	}
+	return s.Storage.Set(key, value)
+}
+
+func (s *storageProxy) Delete(key string) error {
+	if s.batch != nil {
+		s.batch.Delete(key)
+		return nil
+	}
+	return s.Storage.Delete(key)
+}
+
+func (s *storageProxy) Get(key string) ([]byte, error) {
+	if s.batch != nil {
+		if value, ok := s.batch.Get(key); ok {
+			return value, nil
+		}
+	}
+	return s.Storage.Get(key)
+}
+
+func (s *storageProxy) Has(key string) (bool, error) {
+	if s.batch != nil {
+		if value, ok := s.batch.Get(key); ok {
+			return value != nil, nil
+		}
+	}
+	return s.Storage.Has(key)
+}
+
+// startBatch collects the following writes in a batch if the storage supports
+// batches and returns whether it does. Storages storing timestamps are written
+// directly, as batches contain the plain values.
+func (s *storageProxy) startBatch() bool {
+	if _, ok := s.Storage.(storage.Batcher); !ok {
+		return false
+	}
+	if _, ok := s.Storage.(storage.TimestampSetter); ok {
+		return false
+	}
+	s.batch = storage.NewBatch()
+	return true
+}
+
+// staged returns the number of writes collected in the batch, see discardStaged.
+func (s *storageProxy) staged() int {
+	if s.batch == nil {
+		return 0
+	}
+	return s.batch.Len()
+}
+
+// discardStaged removes the writes collected in the batch after the first n, e.g. the
+// writes of a failed update callback.
+func (s *storageProxy) discardStaged(n int) {
+	if s.batch != nil {
+		s.batch.Truncate(n)
+	}
+}
+
+// storeOffset stores the offset of a recovered message and returns whether the writes
+// of the message were written. While batching, the message is added to the batch,
+// which is written with the offset of its last message once it contains batchSize
+// messages.
+func (s *storageProxy) storeOffset(offset int64, batchSize int) (bool, error) {
+	if s.batch == nil {
+		return true, s.Storage.SetOffset(offset)
+	}
+	s.batchMessages++
+	s.batchOffset = offset
+	if s.batchMessages < batchSize {
+		return false, nil
+	}
+	return true, s.flushBatch()
+}
+
+// flushBatch writes the batch and stores the offset of its last message.
+func (s *storageProxy) flushBatch() error {
+	if s.batch == nil || s.batchMessages == 0 {
+		return nil
+	}
+	if err := storage.SetBatch(s.Storage, s.batch); err != nil {
+		return err
+	}
+	s.batch.Reset()
+	s.batchMessages = 0
+	return s.Storage.SetOffset(s.batchOffset)
+}
+
+// endBatch flushes the batch and writes directly again.
+func (s *storageProxy) endBatch() error {
+	err := s.flushBatch()
+	s.batch = nil
+	return err
+}
@@ -3,6 +3,10 @@ package goka
 import (
 	"bytes"
 	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
 )
 
 type nullProxy struct{}
@@ -25,5 +29,103 @@ func TestUpdateWithHeaders(t *testing.T) {
 			return nil
 		},
 	}
-	_ = s.Update("", nil, 0, Headers{"key": []byte("value")})
+	_ = s.Update("", nil, 0, Headers{"key": []byte("value")}, time.Time{})
+}
+
+func TestUpdateWithTimestamp(t *testing.T) {
+	var (
+		ts  = time.Now().Add(-time.Minute)
+		mem = storage.NewMemory()
+		s   = &storageProxy{
+			Storage: storage.NewExpiring(mem, time.Hour),
+			update:  DefaultUpdate,
+		}
+	)
+
+	test.AssertNil(t, s.Update("key", []byte("value"), 0, nil, ts))
+	value, err := s.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+
+	// messages older than the retention are expired right away
+	test.AssertNil(t, s.Update("key", []byte("value"), 1, nil, ts.Add(-time.Hour)))
+	value, err = mem.Get("key")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+}
+
+// batchMemory is a memory storage counting the written batches
+type batchMemory struct {
+	storage.Storage
+	batches int
+}
+
+func (m *batchMemory) SetBatch(b *storage.Batch) error {
+	m.batches++
+	for _, op := range b.Ops() {
+		if op.Value == nil {
+			m.Delete(op.Key)
+		} else {
+			m.Set(op.Key, op.Value)
+		}
+	}
+	return nil
+}
+
+func TestStorageProxy_batch(t *testing.T) {
+	var (
+		st = &batchMemory{Storage: storage.NewMemory()}
+		s  = &storageProxy{
+			Storage: st,
+			update:  DefaultUpdate,
+		}
+	)
+	test.AssertTrue(t, s.startBatch())
+
+	for i, key := range []string{"key", "other", "other"} {
+		var value []byte
+		if i < 2 {
+			value = []byte("value")
+		}
+		test.AssertNil(t, s.Update(key, value, int64(i+1), nil, time.Now()))
+		written, err := s.storeOffset(int64(i+1), 10)
+		test.AssertNil(t, err)
+		test.AssertFalse(t, written)
+	}
+
+	// discarded writes are not written with the batch
+	staged := s.staged()
+	test.AssertNil(t, s.Update("key", []byte("failed"), 4, nil, time.Now()))
+	test.AssertNil(t, s.Update("failed", []byte("failed"), 4, nil, time.Now()))
+	s.discardStaged(staged)
+	value, err := s.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+
+	// reads see the batch, the storage does not
+	value, err = s.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+	has, err := s.Has("other")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+	has, err = st.Has("key")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	test.AssertNil(t, s.endBatch())
+	test.AssertEqual(t, st.batches, 1)
+	value, err = st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+	offset, err := st.GetOffset(0)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(3))
+	has, err = st.Has("failed")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	// storages without batches are written directly
+	s = &storageProxy{Storage: storage.NewMemory(), update: DefaultUpdate}
+	test.AssertFalse(t, s.startBatch())
 }
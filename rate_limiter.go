@@ -0,0 +1,83 @@
+package goka
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces calls to wait evenly so that at most `rate` calls
+// per second pass the limiter. It is safe for concurrent use.
+type rateLimiter struct {
+	m        sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / rate),
+	}
+}
+
+// wait blocks until the next call is allowed by the limiter or the context
+// is done. It returns false if the context was done before.
+func (rl *rateLimiter) wait(ctx context.Context) bool {
+	if rl == nil {
+		return true
+	}
+
+	rl.m.Lock()
+	now := time.Now()
+	slot := rl.next
+	if slot.Before(now) {
+		slot = now
+	}
+	rl.next = slot.Add(rl.interval)
+	rl.m.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// processingLimiters bundles the global and per-topic rate limiters of a processor.
+type processingLimiters struct {
+	global *rateLimiter
+	topics map[string]*rateLimiter
+}
+
+func newProcessingLimiters(globalRate float64, topicRates map[string]float64) *processingLimiters {
+	pl := &processingLimiters{
+		topics: make(map[string]*rateLimiter),
+	}
+	if globalRate > 0 {
+		pl.global = newRateLimiter(globalRate)
+	}
+	for topic, rate := range topicRates {
+		pl.topics[topic] = newRateLimiter(rate)
+	}
+	return pl
+}
+
+// wait blocks until a message of passed topic may be processed.
+// It returns false if the context was done while waiting.
+func (pl *processingLimiters) wait(ctx context.Context, topic string) bool {
+	if pl == nil {
+		return true
+	}
+	if !pl.topics[topic].wait(ctx) {
+		return false
+	}
+	return pl.global.wait(ctx)
+}
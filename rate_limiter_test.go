@@ -0,0 +1,46 @@
+package goka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		var pl *processingLimiters
+		test.AssertTrue(t, pl.wait(context.Background(), "topic"))
+
+		pl = newProcessingLimiters(0, nil)
+		test.AssertTrue(t, pl.wait(context.Background(), "topic"))
+	})
+	t.Run("limit", func(t *testing.T) {
+		rl := newRateLimiter(100)
+		start := time.Now()
+		for i := 0; i < 11; i++ {
+			test.AssertTrue(t, rl.wait(context.Background()))
+		}
+		test.AssertTrue(t, time.Since(start) >= 100*time.Millisecond)
+	})
+	t.Run("topic", func(t *testing.T) {
+		pl := newProcessingLimiters(0, map[string]float64{"slow": 1})
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		// first message passes immediately, the second one has to wait
+		test.AssertTrue(t, pl.wait(ctx, "slow"))
+		test.AssertFalse(t, pl.wait(ctx, "slow"))
+
+		// other topics are not limited
+		test.AssertTrue(t, pl.wait(context.Background(), "fast"))
+	})
+	t.Run("cancel", func(t *testing.T) {
+		rl := newRateLimiter(0.1)
+		ctx, cancel := context.WithCancel(context.Background())
+		test.AssertTrue(t, rl.wait(ctx))
+		cancel()
+		test.AssertFalse(t, rl.wait(ctx))
+	})
+}
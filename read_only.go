@@ -0,0 +1,88 @@
+package goka
+
+import (
+	"sync"
+	"time"
+)
+
+// readOnlyGroupSuffix is appended to the consumer group of read-only processors
+const readOnlyGroupSuffix = "-readonly"
+
+// ReadOnlyEmitCallback receives the messages a read-only processor would have emitted,
+// see WithReadOnly.
+type ReadOnlyEmitCallback func(topic string, key string, value []byte, hdr Headers)
+
+// readOnlyProducer passes the messages to a callback instead of emitting them
+type readOnlyProducer struct {
+	onEmit ReadOnlyEmitCallback
+	log    logger
+}
+
+func newReadOnlyProducer(onEmit ReadOnlyEmitCallback, log logger) *readOnlyProducer {
+	return &readOnlyProducer{
+		onEmit: onEmit,
+		log:    log,
+	}
+}
+
+// Emit passes the message to the callback.
+func (p *readOnlyProducer) Emit(topic string, key string, value []byte) *Promise {
+	return p.EmitWithHeaders(topic, key, value, nil)
+}
+
+// EmitWithHeaders passes the message to the callback.
+func (p *readOnlyProducer) EmitWithHeaders(topic string, key string, value []byte, hdr Headers) *Promise {
+	if p.onEmit != nil {
+		p.onEmit(topic, key, value, hdr)
+	} else {
+		p.log.Printf("read-only: not emitting message for key %s to topic %s (%d bytes)", key, topic, len(value))
+	}
+	// the promise has no message, so no offsets are stored for the writes
+	return NewPromise().finish(nil, nil)
+}
+
+// Close does nothing.
+func (p *readOnlyProducer) Close() error {
+	return nil
+}
+
+// configureReadOnly keeps the writes of a read-only processor to the table and its key
+// expiry in memory and drops its writes to the offset index, so no storage is modified.
+func (p *PartitionTable) configureReadOnly() {
+	p.overlay = newTableOverlay()
+	if p.expiry != nil {
+		p.expiry.overlay = make(map[string]time.Time)
+	}
+}
+
+// tableOverlay keeps the writes to a table of a read-only processor in memory,
+// so the storage is not modified. Deleted keys are kept with nil values. The
+// overlay is not bounded, it grows with every key written by the processor.
+type tableOverlay struct {
+	m      sync.RWMutex
+	values map[string][]byte
+}
+
+func newTableOverlay() *tableOverlay {
+	return &tableOverlay{
+		values: make(map[string][]byte),
+	}
+}
+
+// get returns the value of the key and whether the overlay contains the key
+func (o *tableOverlay) get(key string) ([]byte, bool) {
+	o.m.RLock()
+	defer o.m.RUnlock()
+	value, ok := o.values[key]
+	return value, ok
+}
+
+func (o *tableOverlay) set(key string, value []byte) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.values[key] = value
+}
+
+func (o *tableOverlay) delete(key string) {
+	o.set(key, nil)
+}
@@ -0,0 +1,91 @@
+package goka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestPT_overlay(t *testing.T) {
+	mem := storage.NewMemory()
+	pt, bm, ctrl := defaultPT(t, "some-table", 0, nil, nil)
+	defer ctrl.Finish()
+	bm.st = mem
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	test.AssertNil(t, pt.setup(ctx))
+	pt.state.SetState(State(PartitionRunning))
+	pt.overlay = newTableOverlay()
+
+	test.AssertNil(t, mem.Set("stored", []byte("stored-value")))
+	test.AssertNil(t, mem.Set("deleted", []byte("deleted-value")))
+
+	test.AssertNil(t, pt.Set("stored", []byte("changed")))
+	test.AssertNil(t, pt.Set("new", []byte("new-value")))
+	test.AssertNil(t, pt.Delete("deleted"))
+
+	// the table sees the writes
+	value, err := pt.Get("stored")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "changed")
+	value, err = pt.Get("new")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "new-value")
+	value, err = pt.Get("deleted")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+	has, err := pt.Has("deleted")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+	has, err = pt.Has("new")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, has)
+
+	// the storage is unchanged
+	value, err = mem.Get("stored")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "stored-value")
+	has, err = mem.Has("new")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+	has, err = mem.Has("deleted")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, has)
+}
+
+func TestReadOnlyProducer(t *testing.T) {
+	var emitted []string
+	p := newReadOnlyProducer(func(topic string, key string, value []byte, hdr Headers) {
+		emitted = append(emitted, topic+"/"+key+"="+string(value)+"/"+string(hdr["h"]))
+	}, defaultLogger)
+
+	var done bool
+	p.Emit("topic", "key", []byte("value")).Then(func(err error) {
+		test.AssertNil(t, err)
+		done = true
+	})
+	p.EmitWithHeaders("other", "key", []byte("value"), Headers{"h": []byte("v")})
+	test.AssertTrue(t, done)
+	test.AssertEqual(t, emitted, []string{"topic/key=value/", "other/key=value/v"})
+	test.AssertNil(t, p.Close())
+}
+
+func TestOptions_ReadOnly(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil))
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithReadOnly(nil))
+	test.AssertNil(t, err)
+	test.AssertTrue(t, opts.readOnly)
+	test.AssertEqual(t, opts.consumerGroupID, "group-readonly")
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithReadOnly(nil), WithConsumerGroupID("debug"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.consumerGroupID, "debug")
+}
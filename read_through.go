@@ -0,0 +1,261 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// readThroughMissTTL is the time a key that was not found in the table topic is not
+// fetched again.
+const readThroughMissTTL = 5 * time.Second
+
+// readThroughMiss identifies a key that was not found in a partition
+type readThroughMiss struct {
+	partition int32
+	key       string
+}
+
+// readThrough fetches the values of keys missing in the local storage of a view from
+// the table topic, see WithViewReadThrough.
+type readThrough struct {
+	topic       string
+	timeout     time.Duration
+	missTTL     time.Duration
+	tmgr        TopicManager
+	newConsumer func() (sarama.Consumer, error)
+
+	// m guards the consumer and the partition locks
+	m        sync.Mutex
+	consumer sarama.Consumer
+	// partitions serializes the fetches by partition, as a consumer can consume a
+	// partition only once at a time
+	partitions map[int32]*sync.Mutex
+
+	// misses contains the expiry of the keys that were not found
+	missM     sync.Mutex
+	misses    map[readThroughMiss]time.Time
+	lastSweep time.Time
+}
+
+func newReadThrough(topic string, timeout time.Duration, tmgr TopicManager, newConsumer func() (sarama.Consumer, error)) *readThrough {
+	return &readThrough{
+		topic:       topic,
+		timeout:     timeout,
+		missTTL:     readThroughMissTTL,
+		tmgr:        tmgr,
+		newConsumer: newConsumer,
+		partitions:  make(map[int32]*sync.Mutex),
+		misses:      make(map[readThroughMiss]time.Time),
+	}
+}
+
+// fetch returns the latest value of the key in the partition of the table topic or nil
+// if the key does not exist or was deleted. Fetches of different partitions run
+// concurrently. Keys that were not found are not fetched again for a short time, see
+// readThroughMissTTL.
+func (r *readThrough) fetch(partition int32, key string, index *offsetIndex) ([]byte, error) {
+	miss := readThroughMiss{partition: partition, key: key}
+	if r.missed(miss) {
+		return nil, nil
+	}
+
+	unlock, err := r.lockPartition(partition)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// a concurrent fetch of the key may have missed it while waiting for the lock
+	if r.missed(miss) {
+		return nil, nil
+	}
+	value, err := r.fetchPartition(partition, key, index)
+	if err == nil && value == nil {
+		r.addMiss(miss)
+	}
+	return value, err
+}
+
+// lockPartition locks the partition and creates the consumer if needed.
+func (r *readThrough) lockPartition(partition int32) (func(), error) {
+	r.m.Lock()
+	if err := r.ensureConsumer(); err != nil {
+		r.m.Unlock()
+		return nil, err
+	}
+	pm, ok := r.partitions[partition]
+	if !ok {
+		pm = new(sync.Mutex)
+		r.partitions[partition] = pm
+	}
+	r.m.Unlock()
+
+	pm.Lock()
+	return pm.Unlock, nil
+}
+
+// partitionConsumer returns the consumer, which is nil after close.
+func (r *readThrough) partitionConsumer() (sarama.Consumer, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.consumer == nil {
+		return nil, fmt.Errorf("read-through consumer of %s is closed", r.topic)
+	}
+	return r.consumer, nil
+}
+
+func (r *readThrough) missed(miss readThroughMiss) bool {
+	r.missM.Lock()
+	defer r.missM.Unlock()
+	expires, ok := r.misses[miss]
+	return ok && time.Now().Before(expires)
+}
+
+// addMiss caches the miss and drops the expired misses once per TTL.
+func (r *readThrough) addMiss(miss readThroughMiss) {
+	r.missM.Lock()
+	defer r.missM.Unlock()
+	now := time.Now()
+	if now.Sub(r.lastSweep) >= r.missTTL {
+		for m, expires := range r.misses {
+			if !now.Before(expires) {
+				delete(r.misses, m)
+			}
+		}
+		r.lastSweep = now
+	}
+	r.misses[miss] = now.Add(r.missTTL)
+}
+
+// fetchPartition returns the latest value of the key in the partition. If the offset
+// index of the partition contains the key, only the message at the indexed offset is
+// read. Otherwise, unless the index is complete, the partition is scanned from the
+// oldest offset up to the high watermark at the time of the call. It must be called
+// with the partition locked.
+func (r *readThrough) fetchPartition(partition int32, key string, index *offsetIndex) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	if index != nil {
+		offset, ok, err := index.get(key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok && index.isComplete() {
+			return nil, nil
+		}
+		if ok {
+			value, found, err := r.fetchAt(ctx, partition, offset, key)
+			if err != nil || found {
+				return value, err
+			}
+			// the index is outdated, so fall back to scanning
+		}
+	}
+
+	oldest, err := r.tmgr.GetOffset(r.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting oldest offset of %s/%d: %v", r.topic, partition, err)
+	}
+	hwm, err := r.tmgr.GetOffset(r.topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting newest offset of %s/%d: %v", r.topic, partition, err)
+	}
+	if hwm <= oldest {
+		return nil, nil
+	}
+
+	consumer, err := r.partitionConsumer()
+	if err != nil {
+		return nil, err
+	}
+	pc, err := consumer.ConsumePartition(r.topic, partition, oldest)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming %s/%d: %v", r.topic, partition, err)
+	}
+	defer pc.Close()
+
+	var (
+		value []byte
+		errs  = pc.Errors()
+	)
+	for {
+		select {
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return nil, fmt.Errorf("consumer of %s/%d closed before offset %d", r.topic, partition, hwm-1)
+			}
+			if string(msg.Key) == key {
+				value = msg.Value
+			}
+			if consumedUpTo(msg, pc, hwm) {
+				return value, nil
+			}
+		case cerr, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			return nil, fmt.Errorf("error consuming %s/%d: %v", r.topic, partition, cerr)
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout fetching key %s from %s/%d after %v", key, r.topic, partition, r.timeout)
+		}
+	}
+}
+
+// fetchAt returns the value of the message at the offset and whether it has the key.
+func (r *readThrough) fetchAt(ctx context.Context, partition int32, offset int64, key string) ([]byte, bool, error) {
+	consumer, err := r.partitionConsumer()
+	if err != nil {
+		return nil, false, err
+	}
+	pc, err := consumer.ConsumePartition(r.topic, partition, offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("error consuming %s/%d at offset %d: %v", r.topic, partition, offset, err)
+	}
+	defer pc.Close()
+
+	select {
+	case msg, ok := <-pc.Messages():
+		if !ok || msg.Offset != offset || string(msg.Key) != key {
+			return nil, false, nil
+		}
+		return msg.Value, true, nil
+	case cerr, ok := <-pc.Errors():
+		if !ok {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("error consuming %s/%d at offset %d: %v", r.topic, partition, offset, cerr)
+	case <-ctx.Done():
+		return nil, false, fmt.Errorf("timeout fetching key %s from %s/%d at offset %d after %v", key, r.topic, partition, offset, r.timeout)
+	}
+}
+
+// ensureConsumer creates the consumer if needed. It must be called with the lock held.
+func (r *readThrough) ensureConsumer() error {
+	if r.consumer != nil {
+		return nil
+	}
+	consumer, err := r.newConsumer()
+	if err != nil {
+		return fmt.Errorf("error creating read-through consumer: %v", err)
+	}
+	r.consumer = consumer
+	return nil
+}
+
+// close closes the consumer if one was created.
+func (r *readThrough) close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.consumer == nil {
+		return nil
+	}
+	err := r.consumer.Close()
+	r.consumer = nil
+	return err
+}
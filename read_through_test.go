@@ -0,0 +1,109 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestReadThrough_fetch(t *testing.T) {
+	var (
+		ctrl     = gomock.NewController(t)
+		tmgr     = NewMockTopicManager(ctrl)
+		consumer = NewMockAutoConsumer(t, nil)
+		topic    = "table"
+		rt       = newReadThrough(topic, 10*time.Second, tmgr, func() (sarama.Consumer, error) {
+			return consumer, nil
+		})
+	)
+	defer ctrl.Finish()
+
+	// the latest value of the key is returned
+	pc := consumer.ExpectConsumePartition(topic, 0, 0)
+	for _, value := range []string{"a", "b", "c"} {
+		pc.YieldMessage(&sarama.ConsumerMessage{Key: []byte("key"), Value: []byte(value)})
+		pc.YieldMessage(&sarama.ConsumerMessage{Key: []byte("other"), Value: []byte("x")})
+	}
+	tmgr.EXPECT().GetOffset(topic, int32(0), sarama.OffsetOldest).Return(int64(0), nil)
+	tmgr.EXPECT().GetOffset(topic, int32(0), sarama.OffsetNewest).Return(int64(6), nil)
+	value, err := rt.fetch(0, "key", nil)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "c")
+
+	// deleted keys are missing
+	pc = consumer.ExpectConsumePartition(topic, 1, 0)
+	pc.YieldMessage(&sarama.ConsumerMessage{Key: []byte("key"), Value: []byte("a")})
+	pc.YieldMessage(&sarama.ConsumerMessage{Key: []byte("key")})
+	tmgr.EXPECT().GetOffset(topic, int32(1), sarama.OffsetOldest).Return(int64(0), nil)
+	tmgr.EXPECT().GetOffset(topic, int32(1), sarama.OffsetNewest).Return(int64(2), nil)
+	value, err = rt.fetch(1, "key", nil)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+
+	// empty partitions are not consumed
+	tmgr.EXPECT().GetOffset(topic, int32(2), sarama.OffsetOldest).Return(int64(5), nil)
+	tmgr.EXPECT().GetOffset(topic, int32(2), sarama.OffsetNewest).Return(int64(5), nil)
+	value, err = rt.fetch(2, "key", nil)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+
+	// misses are not fetched again until they expire
+	value, err = rt.fetch(2, "key", nil)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+	rt.misses[readThroughMiss{partition: 2, key: "key"}] = time.Now()
+	tmgr.EXPECT().GetOffset(topic, int32(2), sarama.OffsetOldest).Return(int64(5), nil)
+	tmgr.EXPECT().GetOffset(topic, int32(2), sarama.OffsetNewest).Return(int64(5), nil)
+	value, err = rt.fetch(2, "key", nil)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+
+	// fetches time out if the high watermark is not reached
+	rt.timeout = 10 * time.Millisecond
+	consumer.ExpectConsumePartition(topic, 3, 0)
+	tmgr.EXPECT().GetOffset(topic, int32(3), sarama.OffsetOldest).Return(int64(0), nil)
+	tmgr.EXPECT().GetOffset(topic, int32(3), sarama.OffsetNewest).Return(int64(1), nil)
+	_, err = rt.fetch(3, "key", nil)
+	test.AssertNotNil(t, err)
+}
+
+func TestReadThrough_fetchConcurrently(t *testing.T) {
+	var (
+		ctrl     = gomock.NewController(t)
+		tmgr     = NewMockTopicManager(ctrl)
+		consumer = NewMockAutoConsumer(t, nil)
+		topic    = "table"
+		rt       = newReadThrough(topic, 10*time.Second, tmgr, func() (sarama.Consumer, error) {
+			return consumer, nil
+		})
+	)
+	defer ctrl.Finish()
+
+	// a fetch waiting for the high watermark of partition 0 does not block partition 1
+	consumer.ExpectConsumePartition(topic, 0, 0)
+	tmgr.EXPECT().GetOffset(topic, int32(0), sarama.OffsetOldest).Return(int64(0), nil)
+	tmgr.EXPECT().GetOffset(topic, int32(0), sarama.OffsetNewest).Return(int64(1), nil)
+	rt.timeout = time.Second
+	done := make(chan error, 1)
+	go func() {
+		_, err := rt.fetch(0, "key", nil)
+		done <- err
+	}()
+
+	pc := consumer.ExpectConsumePartition(topic, 1, 0)
+	pc.YieldMessage(&sarama.ConsumerMessage{Key: []byte("key"), Value: []byte("a")})
+	tmgr.EXPECT().GetOffset(topic, int32(1), sarama.OffsetOldest).Return(int64(0), nil)
+	tmgr.EXPECT().GetOffset(topic, int32(1), sarama.OffsetNewest).Return(int64(1), nil)
+	value, err := rt.fetch(1, "key", nil)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "a")
+	select {
+	case <-done:
+		t.Fatalf("fetch of partition 0 returned before partition 1 was fetched")
+	default:
+	}
+	test.AssertNotNil(t, <-done)
+}
@@ -0,0 +1,44 @@
+package goka
+
+import (
+	"sync"
+	"time"
+)
+
+// recordMeta is the changelog position of the current value of a key
+type recordMeta struct {
+	offset int64
+	ts     time.Time
+}
+
+// recordMetaStore keeps the offset and timestamp of the last message of each key
+// of a partition table in memory, built from the messages consumed from the table topic.
+type recordMetaStore struct {
+	m    sync.RWMutex
+	keys map[string]recordMeta
+}
+
+func newRecordMetaStore() *recordMetaStore {
+	return &recordMetaStore{
+		keys: make(map[string]recordMeta),
+	}
+}
+
+// add sets the metadata of key. Deleted keys are dropped.
+func (rs *recordMetaStore) add(key string, value []byte, offset int64, ts time.Time) {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+	if value == nil {
+		delete(rs.keys, key)
+		return
+	}
+	rs.keys[key] = recordMeta{offset: offset, ts: ts}
+}
+
+// get returns the metadata of key, or false if it is not known
+func (rs *recordMetaStore) get(key string) (recordMeta, bool) {
+	rs.m.RLock()
+	defer rs.m.RUnlock()
+	meta, ok := rs.keys[key]
+	return meta, ok
+}
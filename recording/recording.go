@@ -0,0 +1,61 @@
+// Package recording contains the format of recorded messages, which are written by
+// sink.Recorder and replayed by tester.Replay.
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Record is a recorded message. Recordings are stored as JSON lines, one record per
+// line, with the value and header values encoded in base64.
+type Record struct {
+	Topic     string            `json:"topic"`
+	Partition int32             `json:"partition"`
+	Offset    int64             `json:"offset"`
+	Key       string            `json:"key"`
+	Value     []byte            `json:"value"`
+	Headers   map[string][]byte `json:"headers,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// Read reads a recording in the JSON lines format.
+func Read(r io.Reader) ([]*Record, error) {
+	var (
+		records []*Record
+		scanner = bufio.NewScanner(r)
+		line    int
+	)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		rec := new(Record)
+		if err := json.Unmarshal(data, rec); err != nil {
+			return nil, fmt.Errorf("error decoding record in line %d: %v", line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading records: %v", err)
+	}
+	return records, nil
+}
+
+// Write writes a recording in the JSON lines format.
+func Write(w io.Writer, records []*Record) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("error encoding record: %v", err)
+		}
+	}
+	return nil
+}
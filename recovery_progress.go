@@ -0,0 +1,174 @@
+package goka
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// recoveryHookInterval limits how often the recovery hook is called for a partition
+const recoveryHookInterval = time.Second
+
+// RecoveryProgress is the progress of the recovery of a table partition, see
+// Processor.RecoveryStats.
+type RecoveryProgress struct {
+	Topic     string
+	Partition int32
+
+	// Recovering is true until the partition is recovered
+	Recovering bool
+	// Offset is the last recovered offset
+	Offset int64
+	// Hwm is the high watermark the partition is recovered to
+	Hwm int64
+	// Rate is the average number of offsets recovered per second
+	Rate float64
+	// Remaining estimates the time until the partition is recovered from the rate, 0 if
+	// recovered or the rate is unknown yet
+	Remaining time.Duration
+}
+
+// recoveryProgress tracks the recovery of a partition table to estimate its rate and
+// remaining time, and passes the progress to the recovery hook, see WithRecoveryHook.
+// Its methods do nothing on nil, e.g. for tables created by tests.
+type recoveryProgress struct {
+	m           sync.Mutex
+	begun       bool
+	recovering  bool
+	start       time.Time
+	end         time.Time
+	startOffset int64
+	offset      int64
+	hwm         int64
+
+	hook     func(partition int32, offset, hwm int64)
+	lastHook time.Time
+}
+
+// begin starts tracking a recovery from the load offset to the high watermark.
+func (rp *recoveryProgress) begin(loadOffset, hwm int64, now time.Time) {
+	if rp == nil {
+		return
+	}
+	rp.m.Lock()
+	defer rp.m.Unlock()
+	rp.begun = true
+	rp.recovering = true
+	rp.start = now
+	rp.startOffset = loadOffset
+	rp.offset = loadOffset - 1
+	rp.hwm = hwm
+	rp.lastHook = now
+}
+
+// advance records the recovered offset. It calls the hook if the last call is at least
+// recoveryHookInterval ago.
+func (rp *recoveryProgress) advance(partition int32, offset int64, now time.Time) {
+	if rp == nil {
+		return
+	}
+	rp.m.Lock()
+	rp.offset = offset
+	var call bool
+	if rp.hook != nil && now.Sub(rp.lastHook) >= recoveryHookInterval {
+		rp.lastHook = now
+		call = true
+	}
+	hwm := rp.hwm
+	rp.m.Unlock()
+
+	if call {
+		rp.hook(partition, offset, hwm)
+	}
+}
+
+// finish marks the recovery as done and passes the final progress to the hook.
+func (rp *recoveryProgress) finish(partition int32, now time.Time) {
+	if rp == nil {
+		return
+	}
+	rp.m.Lock()
+	if !rp.begun || !rp.recovering {
+		rp.m.Unlock()
+		return
+	}
+	rp.recovering = false
+	rp.end = now
+	if rp.offset < rp.hwm-1 {
+		// recovered up to the hwm, e.g. if nothing was left to recover
+		rp.offset = rp.hwm - 1
+	}
+	offset, hwm, hook := rp.offset, rp.hwm, rp.hook
+	rp.m.Unlock()
+
+	if hook != nil {
+		hook(partition, offset, hwm)
+	}
+}
+
+// progress returns the progress of the recovery at now, or nil if it has not begun.
+func (rp *recoveryProgress) progress(now time.Time) *RecoveryProgress {
+	if rp == nil {
+		return nil
+	}
+	rp.m.Lock()
+	defer rp.m.Unlock()
+	if !rp.begun {
+		return nil
+	}
+
+	progress := &RecoveryProgress{
+		Recovering: rp.recovering,
+		Offset:     rp.offset,
+		Hwm:        rp.hwm,
+	}
+	if !rp.recovering {
+		now = rp.end
+	}
+	if elapsed := now.Sub(rp.start); elapsed > 0 {
+		progress.Rate = float64(rp.offset+1-rp.startOffset) / elapsed.Seconds()
+	}
+	if rp.recovering && progress.Rate > 0 {
+		remaining := float64(rp.hwm-1-rp.offset) / progress.Rate
+		progress.Remaining = time.Duration(remaining * float64(time.Second))
+	}
+	return progress
+}
+
+// configureRecoveryHook makes the table pass its recovery progress to the hook.
+func (p *PartitionTable) configureRecoveryHook(hook func(partition int32, offset, hwm int64)) {
+	p.recovery.m.Lock()
+	defer p.recovery.m.Unlock()
+	p.recovery.hook = hook
+}
+
+// RecoveryProgress returns the progress of the last recovery of the partition table, or
+// nil if it was not recovered yet.
+func (p *PartitionTable) RecoveryProgress() *RecoveryProgress {
+	progress := p.recovery.progress(time.Now())
+	if progress != nil {
+		progress.Topic = p.topic
+		progress.Partition = p.partition
+	}
+	return progress
+}
+
+// RecoveryStats returns the recovery progress of the partitions of the group table,
+// joined and lookup tables, e.g. to monitor long recoveries. Partitions are included
+// once their recovery started and stay included after being recovered. See also
+// WithRecoveryHook.
+func (g *Processor) RecoveryStats() []*RecoveryProgress {
+	var stats []*RecoveryProgress
+	for _, table := range g.tables() {
+		if progress := table.RecoveryProgress(); progress != nil {
+			stats = append(stats, progress)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Topic != stats[j].Topic {
+			return stats[i].Topic < stats[j].Topic
+		}
+		return stats[i].Partition < stats[j].Partition
+	})
+	return stats
+}
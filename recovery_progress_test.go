@@ -0,0 +1,54 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestRecoveryProgress(t *testing.T) {
+	type call struct {
+		partition   int32
+		offset, hwm int64
+	}
+	var (
+		calls []call
+		start = time.Now()
+		pt    = &PartitionTable{topic: "table", partition: 3, recovery: new(recoveryProgress)}
+	)
+	pt.configureRecoveryHook(func(partition int32, offset, hwm int64) {
+		calls = append(calls, call{partition, offset, hwm})
+	})
+	test.AssertTrue(t, pt.RecoveryProgress() == nil)
+
+	pt.recovery.begin(100, 400, start)
+	progress := pt.recovery.progress(start)
+	test.AssertEqual(t, progress.Offset, int64(99))
+	test.AssertEqual(t, progress.Remaining, time.Duration(0))
+
+	// the hook is called at most once per interval
+	pt.recovery.advance(3, 149, start.Add(500*time.Millisecond))
+	test.AssertEqual(t, len(calls), 0)
+	pt.recovery.advance(3, 199, start.Add(time.Second))
+	test.AssertEqual(t, calls, []call{{3, 199, 400}})
+
+	progress = pt.recovery.progress(start.Add(time.Second))
+	test.AssertTrue(t, progress.Recovering)
+	test.AssertEqual(t, progress.Rate, float64(100))
+	test.AssertEqual(t, progress.Remaining, 2*time.Second)
+
+	pt.recovery.finish(3, start.Add(3*time.Second))
+	test.AssertEqual(t, calls[1], call{3, 399, 400})
+
+	// the rate stays the one of the finished recovery
+	progress = pt.RecoveryProgress()
+	test.AssertEqual(t, progress.Topic, "table")
+	test.AssertEqual(t, progress.Partition, int32(3))
+	test.AssertFalse(t, progress.Recovering)
+	test.AssertEqual(t, progress.Rate, float64(100))
+	test.AssertEqual(t, progress.Remaining, time.Duration(0))
+
+	// tables without tracking have no progress
+	test.AssertTrue(t, (&PartitionTable{}).RecoveryProgress() == nil)
+}
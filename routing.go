@@ -0,0 +1,71 @@
+package goka
+
+import "strings"
+
+// Route passes the messages of an input topic matching its predicate to its callback,
+// see InputRouted.
+type Route struct {
+	match func(key string, hdr Headers) bool
+	cb    ProcessCallback
+}
+
+// RouteBy routes the messages for which match returns true to the callback.
+func RouteBy(match func(key string, hdr Headers) bool, cb ProcessCallback) Route {
+	return Route{match: match, cb: cb}
+}
+
+// RouteByHeader routes the messages with the header set to the value to the callback.
+func RouteByHeader(name, value string, cb ProcessCallback) Route {
+	return RouteBy(func(key string, hdr Headers) bool {
+		v, ok := hdr[name]
+		return ok && string(v) == value
+	}, cb)
+}
+
+// RouteByKeyPrefix routes the messages whose key has the prefix to the callback.
+func RouteByKeyPrefix(prefix string, cb ProcessCallback) Route {
+	return RouteBy(func(key string, hdr Headers) bool {
+		return strings.HasPrefix(key, prefix)
+	}, cb)
+}
+
+// RouteDefault routes all messages to the callback. Passed as last route to
+// InputRouted, it receives the messages not matching any other route.
+func RouteDefault(cb ProcessCallback) Route {
+	return RouteBy(func(key string, hdr Headers) bool {
+		return true
+	}, cb)
+}
+
+// InputRouted represents an edge of an input stream topic like Input, but each message
+// is passed to the callback of the first route matching its key and headers, e.g. to
+// process the different event types multiplexed into one topic by separate callbacks.
+// Messages not matching any route are committed without being decoded or processed.
+func InputRouted(topic Stream, c Codec, routes ...Route) Edge {
+	return &inputStream{&topicDef{string(topic), c}, routedCallback(routes), routedPrefilter(routes)}
+}
+
+// routedCallback returns a callback passing the messages to the first matching route.
+func routedCallback(routes []Route) ProcessCallback {
+	return func(ctx Context, msg interface{}) {
+		key, hdr := ctx.Key(), ctx.Headers()
+		for _, route := range routes {
+			if route.match(key, hdr) {
+				route.cb(ctx, msg)
+				return
+			}
+		}
+	}
+}
+
+// routedPrefilter returns a prefilter skipping the messages not matching any route.
+func routedPrefilter(routes []Route) Prefilter {
+	return func(key string, value []byte, hdr Headers) bool {
+		for _, route := range routes {
+			if route.match(key, hdr) {
+				return true
+			}
+		}
+		return false
+	}
+}
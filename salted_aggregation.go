@@ -0,0 +1,116 @@
+package goka
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lovoo/goka/codec"
+)
+
+// AggregateFunc adds msg to the aggregate agg and returns the new aggregate. agg is nil
+// for the first message.
+type AggregateFunc func(agg interface{}, msg interface{}) interface{}
+
+// MergeFunc merges the partial aggregate of a shard into the aggregate agg and returns
+// the new aggregate. agg is nil for the first merge.
+type MergeFunc func(agg interface{}, partial interface{}) interface{}
+
+// SaltedAggregation aggregates the messages of skewed keys in two stages, so a hot key
+// does not overload a single partition:
+//
+// 1. Add salts the key (see SaltKey) and loops the message back to the salted key, which
+// spreads the messages of a key over shards in multiple partitions. Each shard aggregates
+// its messages in the group table with the AggregateFunc.
+//
+// 2. A shard loops back a timer to itself when it receives its first message. When the timer
+// fires after the merge interval, the shard loops its partial aggregate back to the original
+// key, which merges it into the final aggregate with the MergeFunc, and deletes itself.
+//
+// So the final aggregate lags up to the merge interval behind. The partial aggregates are
+// stored in the group table with the salted keys, so the codec of the group table must
+// encode both partial and final aggregates. Keys of the group table must not contain the
+// SaltSeparator followed by a number to not collide with the salted keys.
+// Each message loops back 3 times, see WithMaxLoopbackHops.
+type SaltedAggregation struct {
+	name      string
+	shards    int
+	interval  time.Duration
+	msgCodec  Codec
+	aggCodec  Codec
+	aggregate AggregateFunc
+	merge     MergeFunc
+}
+
+// NewSaltedAggregation creates a two-stage aggregation spreading each key over shards
+// and merging the shards into the key every interval. The messages passed to Add are
+// encoded with msgCodec, the partial aggregates with aggCodec.
+// The edges of the aggregation must be added to the group graph, see Edges.
+func NewSaltedAggregation(name string, shards int, interval time.Duration, msgCodec Codec, aggCodec Codec, aggregate AggregateFunc, merge MergeFunc) (*SaltedAggregation, error) {
+	if shards < 2 {
+		return nil, fmt.Errorf("invalid number of shards %d: must be at least 2", shards)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid merge interval %v: must be positive", interval)
+	}
+	if aggregate == nil || merge == nil {
+		return nil, fmt.Errorf("salted aggregation needs an aggregate and a merge function")
+	}
+	return &SaltedAggregation{
+		name:      name,
+		shards:    shards,
+		interval:  interval,
+		msgCodec:  msgCodec,
+		aggCodec:  aggCodec,
+		aggregate: aggregate,
+		merge:     merge,
+	}, nil
+}
+
+// Edges returns the named loops of the aggregation, which have to be added to the
+// definition of the group. The group must persist a group table.
+func (a *SaltedAggregation) Edges() Edges {
+	return Edges{
+		NamedLoop(a.shardLoop(), a.msgCodec, a.aggregateShard),
+		NamedLoop(a.timerLoop(), new(codec.String), a.flushShard),
+		NamedLoop(a.mergeLoop(), a.aggCodec, a.mergeShard),
+	}
+}
+
+// Add adds msg to the aggregate of key. It can be called from any callback of the group.
+func (a *SaltedAggregation) Add(ctx Context, key string, msg interface{}) {
+	LoopbackTo(ctx, a.shardLoop(), SaltKey(key, a.shards), msg)
+}
+
+func (a *SaltedAggregation) shardLoop() string { return a.name + "-shard" }
+func (a *SaltedAggregation) timerLoop() string { return a.name + "-timer" }
+func (a *SaltedAggregation) mergeLoop() string { return a.name + "-merge" }
+
+// aggregateShard adds a message to the partial aggregate of a shard, starting the
+// timer for the merge with the first message.
+func (a *SaltedAggregation) aggregateShard(ctx Context, msg interface{}) {
+	partial := ctx.Value()
+	if partial == nil {
+		// the timers use a dedicated loop, which is not held back by other messages
+		LoopbackToAfter(ctx, a.timerLoop(), ctx.Key(), ctx.Key(), a.interval)
+	}
+	ctx.SetValue(a.aggregate(partial, msg))
+}
+
+// flushShard passes the partial aggregate of a shard to the original key and deletes it
+func (a *SaltedAggregation) flushShard(ctx Context, msg interface{}) {
+	partial := ctx.Value()
+	if partial == nil {
+		return
+	}
+	key, _, ok := UnsaltKey(ctx.Key())
+	if !ok {
+		ctx.Fail(fmt.Errorf("cannot merge shard of aggregation %s: key %s is not salted", a.name, ctx.Key()))
+	}
+	LoopbackTo(ctx, a.mergeLoop(), key, partial)
+	ctx.Delete()
+}
+
+// mergeShard merges the partial aggregate of a shard into the final aggregate
+func (a *SaltedAggregation) mergeShard(ctx Context, msg interface{}) {
+	ctx.SetValue(a.merge(ctx.Value(), msg))
+}
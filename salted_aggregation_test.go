@@ -0,0 +1,27 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestNewSaltedAggregation(t *testing.T) {
+	first := func(agg interface{}, msg interface{}) interface{} { return msg }
+
+	agg, err := NewSaltedAggregation("agg", 4, time.Second, new(codec.String), new(codec.String), first, first)
+	test.AssertNil(t, err)
+
+	gg := DefineGroup("group", append(agg.Edges(), Input("input", new(codec.String), cb), Persist(new(codec.String)))...)
+	test.AssertNil(t, gg.Validate())
+	test.AssertEqual(t, gg.namedLoopStream("agg-timer").Topic(), "group-loop-agg-timer")
+
+	_, err = NewSaltedAggregation("agg", 1, time.Second, new(codec.String), new(codec.String), first, first)
+	test.AssertNotNil(t, err)
+	_, err = NewSaltedAggregation("agg", 4, 0, new(codec.String), new(codec.String), first, first)
+	test.AssertNotNil(t, err)
+	_, err = NewSaltedAggregation("agg", 4, time.Second, new(codec.String), new(codec.String), first, nil)
+	test.AssertNotNil(t, err)
+}
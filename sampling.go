@@ -0,0 +1,68 @@
+package goka
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/headers"
+)
+
+const (
+	// MirrorTopicHeader is the header containing the topic of a mirrored input message
+	MirrorTopicHeader = "goka-mirror-topic"
+	// MirrorPartitionHeader is the header containing the partition of a mirrored input message
+	MirrorPartitionHeader = "goka-mirror-partition"
+	// MirrorOffsetHeader is the header containing the offset of a mirrored input message
+	MirrorOffsetHeader = "goka-mirror-offset"
+	// MirrorTimestampHeader is the header containing the timestamp of a mirrored input
+	// message in milliseconds since epoch
+	MirrorTimestampHeader = "goka-mirror-timestamp"
+)
+
+// SamplingCallback is called with the input messages sampled by WithInputSampling.
+// The message is only valid within the callback, copy it if it has to be kept.
+type SamplingCallback func(msg *sarama.ConsumerMessage)
+
+// inputSampler passes a share of the input messages to a callback or mirrors
+// them to a topic
+type inputSampler struct {
+	rate        float64
+	callback    SamplingCallback
+	mirrorTopic string
+}
+
+// sampleInput passes the message to all samplers selecting it
+func (pp *PartitionProcessor) sampleInput(ctx context.Context, msg *sarama.ConsumerMessage) {
+	for _, s := range pp.opts.inputSamplers {
+		if s.rate < 1 && rand.Float64() >= s.rate {
+			continue
+		}
+		if s.callback != nil {
+			s.callback(msg)
+			continue
+		}
+		pp.mirror(ctx, s.mirrorTopic, msg)
+	}
+}
+
+// mirror emits the message to topic, adding its metadata as headers. Mirroring
+// is best effort, errors are only logged.
+func (pp *PartitionProcessor) mirror(ctx context.Context, topic string, msg *sarama.ConsumerMessage) {
+	hdr := headers.FromSarama(msg.Headers).Merged(Headers{
+		MirrorTopicHeader:     []byte(msg.Topic),
+		MirrorPartitionHeader: []byte(strconv.FormatInt(int64(msg.Partition), 10)),
+		MirrorOffsetHeader:    []byte(strconv.FormatInt(msg.Offset, 10)),
+	})
+	if !msg.Timestamp.IsZero() {
+		hdr[MirrorTimestampHeader] = []byte(strconv.FormatInt(msg.Timestamp.UnixNano()/1e6, 10))
+	}
+
+	pp.producer.EmitWithHeaders(topic, string(msg.Key), msg.Value, hdr).Then(func(err error) {
+		if err != nil {
+			pp.log.Printf("error mirroring message %s/%d/%d to %s: %v", msg.Topic, msg.Partition, msg.Offset, topic, err)
+		}
+	})
+	pp.enqueueTrackOutputStats(ctx, topic, len(msg.Value))
+}
@@ -0,0 +1,80 @@
+package goka
+
+import (
+	"crypto/tls"
+	"hash"
+
+	"github.com/Shopify/sarama"
+)
+
+// configModifiers modify the sarama config of the default builders, e.g. to enable TLS.
+// Builders replaced by options are not modified. The config is created whenever a
+// builder is invoked, so modifiers may return changing values like rotated credentials.
+type configModifiers []func(*sarama.Config)
+
+// config returns a copy of the global config with the modifications applied
+func (m configModifiers) config() *sarama.Config {
+	config := globalConfig
+	m.apply(&config)
+	return &config
+}
+
+// with returns the modifiers followed by more, without changing m
+func (m configModifiers) with(more configModifiers) configModifiers {
+	if len(more) == 0 {
+		return m
+	}
+	return append(append(configModifiers(nil), m...), more...)
+}
+
+func (m configModifiers) apply(config *sarama.Config) {
+	for _, modify := range m {
+		modify(config)
+	}
+}
+
+func (m configModifiers) producerBuilder() ProducerBuilder {
+	if len(m) == 0 {
+		return DefaultProducerBuilder
+	}
+	return func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		return ProducerBuilderWithConfig(m.config())(brokers, clientID, hasher)
+	}
+}
+
+func (m configModifiers) topicManagerBuilder() TopicManagerBuilder {
+	if len(m) == 0 {
+		return DefaultTopicManagerBuilder
+	}
+	return func(brokers []string) (TopicManager, error) {
+		config := m.config()
+		config.ClientID = "goka-topic-manager"
+		return TopicManagerBuilderWithConfig(config, NewTopicManagerConfig())(brokers)
+	}
+}
+
+func (m configModifiers) consumerGroupBuilder() ConsumerGroupBuilder {
+	if len(m) == 0 {
+		return DefaultConsumerGroupBuilder
+	}
+	return func(brokers []string, group, clientID string) (sarama.ConsumerGroup, error) {
+		return ConsumerGroupBuilderWithConfig(m.config())(brokers, group, clientID)
+	}
+}
+
+func (m configModifiers) saramaConsumerBuilder() SaramaConsumerBuilder {
+	if len(m) == 0 {
+		return DefaultSaramaConsumerBuilder
+	}
+	return func(brokers []string, clientID string) (sarama.Consumer, error) {
+		return SaramaConsumerBuilderWithConfig(m.config())(brokers, clientID)
+	}
+}
+
+// tlsConfig enables TLS with the passed config
+func tlsConfig(tlsConfig *tls.Config) func(*sarama.Config) {
+	return func(config *sarama.Config) {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+}
@@ -0,0 +1,225 @@
+package goka
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/Shopify/sarama"
+)
+
+// SASL configures SASL authentication of the connections to Kafka, see WithSASL.
+type SASL struct {
+	// Mechanism is one of sarama.SASLTypePlaintext, sarama.SASLTypeSCRAMSHA256,
+	// sarama.SASLTypeSCRAMSHA512 or sarama.SASLTypeOAuth.
+	Mechanism sarama.SASLMechanism
+	// User and Password are the credentials, unless Credentials is set.
+	User     string
+	Password string
+	// Credentials returns the current credentials, e.g. to rotate secrets without
+	// restarting. With SCRAM they are fetched for every authentication, with PLAIN when
+	// a Kafka client is created.
+	Credentials func() (user, password string)
+	// AuthzID is the optional authorization identity of SCRAM.
+	AuthzID string
+	// TokenProvider returns the tokens of OAUTHBEARER, e.g. IAM or OIDC tokens. It is
+	// called for every authentication, so it should cache tokens until they expire.
+	TokenProvider sarama.AccessTokenProvider
+}
+
+// TokenProviderFunc is a sarama.AccessTokenProvider calling the function.
+type TokenProviderFunc func() (*sarama.AccessToken, error)
+
+// Token returns the result of the function.
+func (f TokenProviderFunc) Token() (*sarama.AccessToken, error) {
+	return f()
+}
+
+func (s *SASL) credentials() (string, string) {
+	if s.Credentials != nil {
+		return s.Credentials()
+	}
+	return s.User, s.Password
+}
+
+// saslConfig enables SASL with the passed settings
+func saslConfig(sasl SASL) func(*sarama.Config) {
+	return func(config *sarama.Config) {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Handshake = true
+		config.Net.SASL.Mechanism = sasl.Mechanism
+		config.Net.SASL.User, config.Net.SASL.Password = sasl.credentials()
+		config.Net.SASL.SCRAMAuthzID = sasl.AuthzID
+		config.Net.SASL.TokenProvider = sasl.TokenProvider
+
+		var hashFunc func() hash.Hash
+		switch sasl.Mechanism {
+		case sarama.SASLTypeSCRAMSHA256:
+			hashFunc = sha256.New
+		case sarama.SASLTypeSCRAMSHA512:
+			hashFunc = sha512.New
+		default:
+			return
+		}
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{
+				hash:        hashFunc,
+				credentials: sasl.credentials,
+			}
+		}
+	}
+}
+
+// scramClient implements the client side of SCRAM (RFC 5802). The user name and password
+// are used as they are, without normalizing them with SASLprep.
+type scramClient struct {
+	hash        func() hash.Hash
+	credentials func() (string, string)
+
+	step            int
+	user            string
+	password        string
+	authzID         string
+	nonce           string
+	gs2Header       string
+	clientFirstBare string
+	serverSignature []byte
+	done            bool
+}
+
+var scramEscaper = strings.NewReplacer("=", "=3D", ",", "=2C")
+
+// Begin starts the exchange. The passed credentials are ignored if the client fetches them.
+func (c *scramClient) Begin(user, password, authzID string) error {
+	if c.credentials != nil {
+		user, password = c.credentials()
+	}
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("error creating SCRAM nonce: %v", err)
+	}
+	*c = scramClient{
+		hash:        c.hash,
+		credentials: c.credentials,
+		user:        user,
+		password:    password,
+		authzID:     authzID,
+		nonce:       base64.RawStdEncoding.EncodeToString(nonce),
+	}
+	return nil
+}
+
+// Step returns the response to the server's challenge.
+func (c *scramClient) Step(challenge string) (string, error) {
+	defer func() { c.step++ }()
+	switch c.step {
+	case 0:
+		c.gs2Header = "n,,"
+		if c.authzID != "" {
+			c.gs2Header = "n,a=" + scramEscaper.Replace(c.authzID) + ","
+		}
+		c.clientFirstBare = "n=" + scramEscaper.Replace(c.user) + ",r=" + c.nonce
+		return c.gs2Header + c.clientFirstBare, nil
+	case 1:
+		return c.clientFinal(challenge)
+	case 2:
+		return "", c.verifyServerFinal(challenge)
+	default:
+		return "", errors.New("SCRAM exchange already finished")
+	}
+}
+
+// Done returns whether the exchange is finished.
+func (c *scramClient) Done() bool {
+	return c.done
+}
+
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	attrs := scramAttributes(serverFirst)
+	if msg, ok := attrs["e"]; ok {
+		return "", fmt.Errorf("SCRAM authentication failed: %s", msg)
+	}
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return "", errors.New("invalid SCRAM server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil || len(salt) == 0 {
+		return "", errors.New("invalid SCRAM salt")
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return "", errors.New("invalid SCRAM iteration count")
+	}
+
+	clientFinalWithoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(c.gs2Header)) + ",r=" + nonce
+	authMessage := []byte(c.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof)
+
+	saltedPassword := c.hi([]byte(c.password), salt, iterations)
+	clientKey := c.hmac(saltedPassword, []byte("Client Key"))
+	storedKey := c.hash()
+	storedKey.Write(clientKey)
+	clientSignature := c.hmac(storedKey.Sum(nil), authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	c.serverSignature = c.hmac(c.hmac(saltedPassword, []byte("Server Key")), authMessage)
+
+	return clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verifyServerFinal(serverFinal string) error {
+	attrs := scramAttributes(serverFinal)
+	if msg, ok := attrs["e"]; ok {
+		return fmt.Errorf("SCRAM authentication failed: %s", msg)
+	}
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || !hmac.Equal(signature, c.serverSignature) {
+		return errors.New("invalid SCRAM server signature")
+	}
+	c.done = true
+	return nil
+}
+
+func (c *scramClient) hmac(key, data []byte) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// hi is PBKDF2 with the HMAC as pseudorandom function and the hash's size as key length
+func (c *scramClient) hi(password, salt []byte, iterations int) []byte {
+	mac := hmac.New(c.hash, password)
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+// scramAttributes parses the comma separated attributes of a SCRAM message
+func scramAttributes(msg string) map[string]string {
+	attrs := make(map[string]string)
+	for _, attr := range strings.Split(msg, ",") {
+		if len(attr) >= 2 && attr[1] == '=' {
+			attrs[attr[:1]] = attr[2:]
+		}
+	}
+	return attrs
+}
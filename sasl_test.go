@@ -0,0 +1,137 @@
+package goka
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestSCRAMClient(t *testing.T) {
+	// test vector of RFC 7677
+	var (
+		serverFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+		clientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+		serverFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+	)
+
+	newClient := func() *scramClient {
+		c := &scramClient{hash: sha256.New}
+		test.AssertNil(t, c.Begin("user", "pencil", ""))
+		c.nonce = "rOprNGfwEbeRWgbNEkqO"
+		return c
+	}
+
+	t.Run("succeed", func(t *testing.T) {
+		c := newClient()
+		msg, err := c.Step("")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, msg, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO")
+		msg, err = c.Step(serverFirst)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, msg, clientFinal)
+		test.AssertFalse(t, c.Done())
+		msg, err = c.Step(serverFinal)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, msg, "")
+		test.AssertTrue(t, c.Done())
+	})
+	t.Run("fail-signature", func(t *testing.T) {
+		c := newClient()
+		c.Step("")
+		c.Step(serverFirst)
+		_, err := c.Step("v=AAAA")
+		test.AssertNotNil(t, err)
+		test.AssertFalse(t, c.Done())
+	})
+	t.Run("fail-nonce", func(t *testing.T) {
+		c := newClient()
+		c.Step("")
+		_, err := c.Step("r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+		test.AssertNotNil(t, err)
+	})
+	t.Run("fail-server-error", func(t *testing.T) {
+		c := newClient()
+		c.Step("")
+		_, err := c.Step("e=invalid-proof")
+		test.AssertNotNil(t, err)
+	})
+	t.Run("credentials", func(t *testing.T) {
+		c := &scramClient{
+			hash: sha256.New,
+			credentials: func() (string, string) {
+				return "rotated,user", "secret"
+			},
+		}
+		test.AssertNil(t, c.Begin("user", "pencil", "admin"))
+		msg, err := c.Step("")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, msg, "n,a=admin,n=rotated=2Cuser,r="+c.nonce)
+		test.AssertEqual(t, c.password, "secret")
+	})
+}
+
+func TestOptions_SASL(t *testing.T) {
+	var calls int
+	sasl := SASL{
+		Mechanism: sarama.SASLTypeSCRAMSHA512,
+		Credentials: func() (string, string) {
+			calls++
+			return "user", "password"
+		},
+	}
+
+	eopts := new(eoptions)
+	eopts.applyOptions("topic", new(codec.String), WithEmitterSASL(sasl))
+	config := eopts.saramaConfig.config()
+	test.AssertTrue(t, config.Net.SASL.Enable)
+	test.AssertEqual(t, config.Net.SASL.Mechanism, sarama.SASLMechanism(sarama.SASLTypeSCRAMSHA512))
+	test.AssertEqual(t, config.Net.SASL.User, "user")
+	test.AssertNil(t, config.Validate())
+	test.AssertEqual(t, calls, 1)
+	// the config is created for every client
+	eopts.saramaConfig.config()
+	test.AssertEqual(t, calls, 2)
+	test.AssertFalse(t, globalConfig.Net.SASL.Enable)
+
+	vopts := new(voptions)
+	err := vopts.applyOptions("table", new(codec.String), WithViewStorageBuilder(nullStorageBuilder()), WithViewSASL(SASL{
+		Mechanism: sarama.SASLTypePlaintext,
+		User:      "user",
+		Password:  "password",
+	}))
+	test.AssertNil(t, err)
+	config = vopts.saramaConfig.config()
+	test.AssertEqual(t, config.Net.SASL.Password, "password")
+	test.AssertTrue(t, config.Net.SASL.SCRAMClientGeneratorFunc == nil)
+}
+
+func TestOptions_OAuthBearer(t *testing.T) {
+	gg := DefineGroup("group", Input("input", new(codec.String), nil))
+	provider := TokenProviderFunc(func() (*sarama.AccessToken, error) {
+		return &sarama.AccessToken{Token: "token"}, nil
+	})
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithOAuthBearer(provider))
+	test.AssertNil(t, err)
+	config := opts.saramaConfig.config()
+	test.AssertTrue(t, config.Net.SASL.Enable)
+	test.AssertEqual(t, config.Net.SASL.Mechanism, sarama.SASLMechanism(sarama.SASLTypeOAuth))
+	test.AssertNil(t, config.Validate())
+	token, err := config.Net.SASL.TokenProvider.Token()
+	test.AssertNil(t, err)
+	test.AssertEqual(t, token.Token, "token")
+
+	vopts := new(voptions)
+	err = vopts.applyOptions("table", new(codec.String), WithViewStorageBuilder(nullStorageBuilder()), WithViewOAuthBearer(provider))
+	test.AssertNil(t, err)
+	test.AssertTrue(t, vopts.saramaConfig.config().Net.SASL.TokenProvider != nil)
+
+	eopts := new(eoptions)
+	eopts.applyOptions("topic", new(codec.String), WithEmitterOAuthBearer(nil))
+	// the provider is required
+	test.AssertTrue(t, eopts.saramaConfig.config().Validate() != nil)
+}
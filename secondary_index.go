@@ -0,0 +1,256 @@
+package goka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// secondaryIndexSuffix is appended to the table topic to build the storage of its
+// secondary indexes
+const secondaryIndexSuffix = ".secondary-index"
+
+// IndexExtractor returns the values under which the key is indexed for its value, see
+// WithViewIndex. Returning no values removes the key from the index.
+type IndexExtractor func(key string, value interface{}) []string
+
+// tableIndex is a named secondary index of a table.
+type tableIndex struct {
+	name    string
+	extract IndexExtractor
+}
+
+// secondaryIndexes maintains the secondary indexes of a partition table. The entries of
+// all indexes are stored in one storage next to the table's storage, each one mapping
+// index name, indexed value and key to nothing, so the keys of a value are found by
+// iterating over a prefix.
+type secondaryIndexes struct {
+	// the batch of the sidecar collects the entries until the offset of their messages
+	// is stored
+	sidecar
+	decode  func([]byte) (interface{}, error)
+	indexes []tableIndex
+}
+
+func newSecondaryIndexes(builder storage.Builder, decode func([]byte) (interface{}, error), indexes []tableIndex) *secondaryIndexes {
+	return &secondaryIndexes{
+		sidecar: newSidecar(builder, secondaryIndexSuffix, "secondary index"),
+		decode:  decode,
+		indexes: indexes,
+	}
+}
+
+// indexPrefix returns the prefix of the entries of the value in the index.
+func indexPrefix(name, value string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	buf.WriteByte(0)
+	var size [binary.MaxVarintLen64]byte
+	buf.Write(size[:binary.PutUvarint(size[:], uint64(len(value)))])
+	buf.WriteString(value)
+	return buf.Bytes()
+}
+
+// entries returns the entries of the key with the value in all indexes.
+func (si *secondaryIndexes) entries(key string, data []byte) (map[string]bool, error) {
+	entries := make(map[string]bool)
+	if data == nil {
+		return entries, nil
+	}
+	value, err := si.decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding value of key %s for secondary index: %v", key, err)
+	}
+	for _, idx := range si.indexes {
+		for _, v := range idx.extract(key, value) {
+			entries[string(indexPrefix(idx.name, v))+key] = true
+		}
+	}
+	return entries, nil
+}
+
+// update replaces the entries of the key for its old value by the entries for its new
+// value, a nil value meaning the key does not exist.
+func (si *secondaryIndexes) update(key string, oldData, newData []byte) error {
+	oldEntries, err := si.entries(key, oldData)
+	if err != nil {
+		return err
+	}
+	newEntries, err := si.entries(key, newData)
+	if err != nil {
+		return err
+	}
+
+	si.m.Lock()
+	defer si.m.Unlock()
+	for entry := range oldEntries {
+		if !newEntries[entry] {
+			si.batch.Delete(entry)
+		}
+	}
+	for entry := range newEntries {
+		if !oldEntries[entry] {
+			si.batch.Set(entry, []byte{})
+		}
+	}
+	return nil
+}
+
+// flush writes the updated entries and stores the offset of their last message.
+func (si *secondaryIndexes) flush(offset int64) error {
+	si.m.Lock()
+	defer si.m.Unlock()
+	if err := si.writeBatch(); err != nil {
+		return err
+	}
+	if offset == offsetNotStored {
+		return nil
+	}
+	return si.st.SetOffset(offset)
+}
+
+// rebuild replaces the entries of the indexes with the entries of the values in st if
+// the indexes are not at tableOffset, e.g. because they were enabled for an existing
+// storage or the table storage was rebuilt.
+func (si *secondaryIndexes) rebuild(st storage.Storage, tableOffset int64) error {
+	si.m.Lock()
+	offset, err := si.st.GetOffset(offsetNotStored)
+	si.m.Unlock()
+	if err != nil {
+		return fmt.Errorf("error reading offset of secondary index: %v", err)
+	}
+	if offset == tableOffset {
+		return nil
+	}
+
+	if err := si.clear(); err != nil {
+		return err
+	}
+
+	iter, err := st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error iterating table to rebuild secondary index: %v", err)
+	}
+	defer iter.Release()
+	for iter.Next() {
+		data, err := iter.Value()
+		if err != nil {
+			return fmt.Errorf("error reading table to rebuild secondary index: %v", err)
+		}
+		if err := si.update(string(iter.Key()), nil, data); err != nil {
+			return err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("error iterating table to rebuild secondary index: %v", err)
+	}
+	return si.flush(tableOffset)
+}
+
+// clear deletes all entries of the indexes.
+func (si *secondaryIndexes) clear() error {
+	si.m.Lock()
+	defer si.m.Unlock()
+	iter, err := si.st.Iterator()
+	if err != nil {
+		return fmt.Errorf("error iterating secondary index: %v", err)
+	}
+	batch := storage.NewBatch()
+	for iter.Next() {
+		batch.Delete(string(iter.Key()))
+	}
+	err = iter.Err()
+	iter.Release()
+	if err != nil {
+		return fmt.Errorf("error iterating secondary index: %v", err)
+	}
+	if err := storage.SetBatch(si.st, batch); err != nil {
+		return fmt.Errorf("error clearing secondary index: %v", err)
+	}
+	return nil
+}
+
+// has returns whether an index of the name exists.
+func (si *secondaryIndexes) has(name string) bool {
+	for _, idx := range si.indexes {
+		if idx.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the keys indexed under the value in the index.
+func (si *secondaryIndexes) lookup(name, value string) ([]string, error) {
+	si.m.Lock()
+	defer si.m.Unlock()
+	prefix := indexPrefix(name, value)
+	iter, err := storage.IteratorWithPrefix(si.st, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error iterating secondary index %s: %v", name, err)
+	}
+	defer iter.Release()
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()[len(prefix):]))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating secondary index %s: %v", name, err)
+	}
+	return keys, nil
+}
+
+// configureSecondaryIndexes makes the table maintain the indexes in a storage built by
+// the table's storage builder.
+func (p *PartitionTable) configureSecondaryIndexes(decode func([]byte) (interface{}, error), indexes []tableIndex) {
+	if len(indexes) == 0 {
+		return
+	}
+	p.secondary = newSecondaryIndexes(p.builder, decode, indexes)
+}
+
+// updateIndexed runs the update of the key and updates the secondary indexes with the
+// stored values of the key before and after the update.
+func (p *PartitionTable) updateIndexed(key string, update func() error) error {
+	if p.secondary == nil {
+		return update()
+	}
+	oldData, err := p.st.Get(key)
+	if err != nil {
+		return fmt.Errorf("error reading key %s for secondary index: %v", key, err)
+	}
+	if err := update(); err != nil {
+		return err
+	}
+	newData, err := p.st.Get(key)
+	if err != nil {
+		return fmt.Errorf("error reading key %s for secondary index: %v", key, err)
+	}
+	return p.secondary.update(key, oldData, newData)
+}
+
+// flushSecondaryIndexes writes the secondary indexes up to the offset, if enabled.
+func (p *PartitionTable) flushSecondaryIndexes(offset int64) error {
+	if p.secondary == nil {
+		return nil
+	}
+	if err := p.secondary.flush(offset); err != nil {
+		return fmt.Errorf("Error updating secondary index while recovering from the log: %v", err)
+	}
+	return nil
+}
+
+// GetByIndex returns the keys indexed under the value in the secondary index of the name.
+// The keys may include keys whose value changed since, e.g. after evicting them, so
+// callers should verify the values.
+func (p *PartitionTable) GetByIndex(index, value string) ([]string, error) {
+	if err := p.readyToRead(); err != nil {
+		return nil, err
+	}
+	if p.secondary == nil || !p.secondary.has(index) {
+		return nil, fmt.Errorf("table %s has no secondary index %s", p.topic, index)
+	}
+	return p.secondary.lookup(index, value)
+}
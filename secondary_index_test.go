@@ -0,0 +1,92 @@
+package goka
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func newIndexedTable(t *testing.T, st storage.Storage) (*PartitionTable, storage.Storage) {
+	indexStorage := storage.NewMemory()
+	pt := &PartitionTable{
+		topic: "table",
+		state: newPartitionTableState().SetState(State(PartitionRunning)),
+		st:    &storageProxy{Storage: st, update: DefaultUpdate},
+		builder: func(topic string, partition int32) (storage.Storage, error) {
+			test.AssertEqual(t, topic, "table"+secondaryIndexSuffix)
+			return indexStorage, nil
+		},
+	}
+	// values are comma separated tags
+	pt.configureSecondaryIndexes(new(codec.String).Decode, []tableIndex{{
+		name: "tag",
+		extract: func(key string, value interface{}) []string {
+			return strings.Split(value.(string), ",")
+		},
+	}})
+	test.AssertNil(t, pt.secondary.open("table", 0))
+	return pt, indexStorage
+}
+
+func TestSecondaryIndexes(t *testing.T) {
+	lookup := func(pt *PartitionTable, value string) []string {
+		keys, err := pt.GetByIndex("tag", value)
+		test.AssertNil(t, err)
+		return keys
+	}
+
+	t.Run("update", func(t *testing.T) {
+		pt, _ := newIndexedTable(t, storage.NewMemory())
+		defer pt.secondary.close()
+
+		test.AssertNil(t, pt.storeEvent("a", []byte("red,blue"), 0, nil, time.Time{}))
+		test.AssertNil(t, pt.storeEvent("b", []byte("red"), 1, nil, time.Time{}))
+		test.AssertEqual(t, lookup(pt, "red"), []string{"a", "b"})
+		test.AssertEqual(t, lookup(pt, "blue"), []string{"a"})
+		test.AssertTrue(t, lookup(pt, "green") == nil)
+
+		// changed values move the key
+		test.AssertNil(t, pt.storeEvent("a", []byte("green"), 2, nil, time.Time{}))
+		test.AssertEqual(t, lookup(pt, "red"), []string{"b"})
+		test.AssertTrue(t, lookup(pt, "blue") == nil)
+		test.AssertEqual(t, lookup(pt, "green"), []string{"a"})
+
+		// deletes remove the key
+		test.AssertNil(t, pt.storeEvent("b", nil, 3, nil, time.Time{}))
+		test.AssertTrue(t, lookup(pt, "red") == nil)
+
+		// values are not prefixes of each other
+		test.AssertTrue(t, lookup(pt, "gre") == nil)
+
+		_, err := pt.GetByIndex("color", "red")
+		test.AssertNotNil(t, err)
+	})
+
+	t.Run("rebuild", func(t *testing.T) {
+		st := storage.NewMemory()
+		test.AssertNil(t, st.Set("a", []byte("red")))
+		test.AssertNil(t, st.Set("b", []byte("blue")))
+		test.AssertNil(t, st.SetOffset(5))
+
+		pt, indexStorage := newIndexedTable(t, st)
+		defer pt.secondary.close()
+		test.AssertNil(t, indexStorage.Set(string(indexPrefix("tag", "stale"))+"c", []byte{}))
+
+		test.AssertNil(t, pt.secondary.rebuild(st, 5))
+		test.AssertEqual(t, lookup(pt, "red"), []string{"a"})
+		test.AssertEqual(t, lookup(pt, "blue"), []string{"b"})
+		test.AssertTrue(t, lookup(pt, "stale") == nil)
+		offset, err := indexStorage.GetOffset(offsetNotStored)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(5))
+
+		// indexes at the table offset are kept
+		test.AssertNil(t, st.Set("c", []byte("red")))
+		test.AssertNil(t, pt.secondary.rebuild(st, 5))
+		test.AssertEqual(t, lookup(pt, "red"), []string{"a"})
+	})
+}
@@ -0,0 +1,150 @@
+package goka
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// sharedResource counts the references to a resource shared between components,
+// which is created with the first reference and closed with the last one.
+type sharedResource struct {
+	m        sync.Mutex
+	resource io.Closer
+	refs     int
+}
+
+func (s *sharedResource) acquire(create func() (io.Closer, error)) (io.Closer, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.resource == nil {
+		resource, err := create()
+		if err != nil {
+			return nil, err
+		}
+		s.resource = resource
+	}
+	s.refs++
+	return s.resource, nil
+}
+
+func (s *sharedResource) release() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
+	resource := s.resource
+	s.resource = nil
+	return resource.Close()
+}
+
+// sharedRef is the reference of a component to a shared resource. Closing it only
+// closes the resource if it is the last reference.
+type sharedRef struct {
+	shared *sharedResource
+	once   sync.Once
+}
+
+func (r *sharedRef) Close() error {
+	var err error
+	r.once.Do(func() {
+		err = r.shared.release()
+	})
+	return err
+}
+
+// SharedProducerBuilder returns a producer builder sharing one producer between all
+// processors and emitters it is passed to, e.g. with WithProducerBuilder and
+// WithEmitterProducerBuilder, so they do not open their own broker connections.
+// The shared producer is created by builder when the first component starts, using the
+// brokers, client ID and hasher of that component. So all components must use the
+// same brokers and hasher. It is closed when the last component closed it, and
+// created again when another component starts afterwards.
+func SharedProducerBuilder(builder ProducerBuilder) ProducerBuilder {
+	shared := new(sharedResource)
+	return func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		producer, err := shared.acquire(func() (io.Closer, error) {
+			return builder(brokers, clientID, hasher)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &sharedProducerRef{Producer: producer.(Producer), sharedRef: sharedRef{shared: shared}}, nil
+	}
+}
+
+type sharedProducerRef struct {
+	Producer
+	sharedRef
+}
+
+func (r *sharedProducerRef) Close() error { return r.sharedRef.Close() }
+
+// SharedSaramaConsumerBuilder returns a consumer builder sharing one sarama consumer
+// between all views and processors it is passed to, e.g. with WithViewConsumerSaramaBuilder
+// and WithConsumerSaramaBuilder. The consumer multiplexes the partitions of all
+// components over the connections of a single client, which reduces the number of
+// connections and metadata requests of processes running many views.
+// The shared consumer is created by builder for the first component, using the brokers
+// and client ID of that component. It is closed when the last component closed it.
+// A sarama consumer consumes each partition only once, so the components must not
+// consume the same partitions, e.g. two views of the same table. Consuming a partition
+// already consumed by another component fails.
+func SharedSaramaConsumerBuilder(builder SaramaConsumerBuilder) SaramaConsumerBuilder {
+	shared := new(sharedResource)
+	return func(brokers []string, clientID string) (sarama.Consumer, error) {
+		consumer, err := shared.acquire(func() (io.Closer, error) {
+			return builder(brokers, clientID)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &sharedConsumerRef{Consumer: consumer.(sarama.Consumer), sharedRef: sharedRef{shared: shared}}, nil
+	}
+}
+
+// errPartitionAlreadyConsumed is returned by sarama when consuming a partition twice
+var errPartitionAlreadyConsumed = sarama.ConfigurationError("That topic/partition is already being consumed")
+
+type sharedConsumerRef struct {
+	sarama.Consumer
+	sharedRef
+}
+
+func (r *sharedConsumerRef) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	pc, err := r.Consumer.ConsumePartition(topic, partition, offset)
+	if err == errPartitionAlreadyConsumed {
+		return nil, fmt.Errorf("partition %s/%d is already consumed by another component sharing the consumer: %w", topic, partition, err)
+	}
+	return pc, err
+}
+
+func (r *sharedConsumerRef) Close() error { return r.sharedRef.Close() }
+
+// SharedTopicManagerBuilder returns a topic manager builder sharing one topic manager
+// between all components it is passed to, e.g. with WithViewTopicManagerBuilder and
+// WithTopicManagerBuilder. See SharedSaramaConsumerBuilder.
+func SharedTopicManagerBuilder(builder TopicManagerBuilder) TopicManagerBuilder {
+	shared := new(sharedResource)
+	return func(brokers []string) (TopicManager, error) {
+		tmgr, err := shared.acquire(func() (io.Closer, error) {
+			return builder(brokers)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &sharedTopicManagerRef{TopicManager: tmgr.(TopicManager), sharedRef: sharedRef{shared: shared}}, nil
+	}
+}
+
+type sharedTopicManagerRef struct {
+	TopicManager
+	sharedRef
+}
+
+func (r *sharedTopicManagerRef) Close() error { return r.sharedRef.Close() }
@@ -0,0 +1,124 @@
+package goka
+
+import (
+	"errors"
+	"fmt"
+	"hash"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestSharedProducerBuilder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var built int
+	builder := SharedProducerBuilder(func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		built++
+		return NewMockProducer(ctrl), nil
+	})
+
+	p1, err := builder(nil, "a", DefaultHasher())
+	test.AssertNil(t, err)
+	p2, err := builder(nil, "b", DefaultHasher())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, built, 1)
+
+	underlying := p1.(*sharedProducerRef).Producer.(*MockProducer)
+	test.AssertTrue(t, p2.(*sharedProducerRef).Producer == underlying)
+	underlying.EXPECT().Emit("topic", "key", []byte("value")).Return(NewPromise())
+	p2.Emit("topic", "key", []byte("value"))
+
+	// closing a reference twice does not release the producer of another reference
+	test.AssertNil(t, p1.Close())
+	test.AssertNil(t, p1.Close())
+
+	underlying.EXPECT().Close().Return(nil)
+	test.AssertNil(t, p2.Close())
+
+	// the producer is created again after all references were closed
+	p3, err := builder(nil, "c", DefaultHasher())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, built, 2)
+	p3.(*sharedProducerRef).Producer.(*MockProducer).EXPECT().Close().Return(nil)
+	test.AssertNil(t, p3.Close())
+
+	failing := SharedProducerBuilder(func(brokers []string, clientID string, hasher func() hash.Hash32) (Producer, error) {
+		return nil, errors.New("no brokers")
+	})
+	_, err = failing(nil, "a", DefaultHasher())
+	test.AssertNotNil(t, err)
+}
+
+type closeCountingConsumer struct {
+	sarama.Consumer
+	closed   int
+	consumed map[string]bool
+}
+
+func (c *closeCountingConsumer) ConsumePartition(topic string, partition int32, offset int64) (sarama.PartitionConsumer, error) {
+	// like the sarama consumer, consuming a partition twice fails
+	key := fmt.Sprintf("%s/%d", topic, partition)
+	if c.consumed[key] {
+		return nil, errPartitionAlreadyConsumed
+	}
+	c.consumed[key] = true
+	return nil, nil
+}
+
+func (c *closeCountingConsumer) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestSharedSaramaConsumerBuilder(t *testing.T) {
+	var consumers []*closeCountingConsumer
+	builder := SharedSaramaConsumerBuilder(func(brokers []string, clientID string) (sarama.Consumer, error) {
+		consumer := &closeCountingConsumer{consumed: make(map[string]bool)}
+		consumers = append(consumers, consumer)
+		return consumer, nil
+	})
+
+	c1, err := builder(nil, "view-a")
+	test.AssertNil(t, err)
+	c2, err := builder(nil, "view-b")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(consumers), 1)
+
+	_, err = c1.ConsumePartition("table", 0, 0)
+	test.AssertNil(t, err)
+	_, err = c2.ConsumePartition("table", 0, 0)
+	test.AssertTrue(t, errors.Is(err, errPartitionAlreadyConsumed))
+
+	test.AssertNil(t, c1.Close())
+	test.AssertEqual(t, consumers[0].closed, 0)
+	test.AssertNil(t, c2.Close())
+	test.AssertEqual(t, consumers[0].closed, 1)
+}
+
+func TestSharedTopicManagerBuilder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tmgr := NewMockTopicManager(ctrl)
+	builder := SharedTopicManagerBuilder(func(brokers []string) (TopicManager, error) {
+		return tmgr, nil
+	})
+
+	t1, err := builder(nil)
+	test.AssertNil(t, err)
+	t2, err := builder(nil)
+	test.AssertNil(t, err)
+
+	tmgr.EXPECT().Partitions("topic").Return([]int32{0, 1}, nil)
+	partitions, err := t1.Partitions("topic")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, partitions, []int32{0, 1})
+
+	test.AssertNil(t, t1.Close())
+	tmgr.EXPECT().Close().Return(nil)
+	test.AssertNil(t, t2.Close())
+}
@@ -0,0 +1,198 @@
+package goka
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// ShutdownReport summarizes the run of a processor or view after it stopped, e.g. to
+// verify a clean shutdown or to analyze an incident. See Processor.ShutdownReport.
+type ShutdownReport struct {
+	// Name is the group of the processor or the table of the view
+	Name    string
+	Started time.Time
+	Stopped time.Time
+	// Partitions contains the partitions by partition ID
+	Partitions map[int32]*PartitionShutdownReport
+	// Errors contains the errors that did not stop the processor and the error returned
+	// by Run, if any
+	Errors []string
+}
+
+// PartitionShutdownReport summarizes the run of a partition.
+type PartitionShutdownReport struct {
+	// Processed is the number of messages processed by a processor and marked for
+	// committing, summed up over all sessions. Views do not count their messages.
+	Processed int64
+	// LastOffsets contains the offset of the last processed message by topic. The offsets
+	// committed by processors are the next offsets, i.e. LastOffsets + 1.
+	LastOffsets map[string]int64
+	// StopDuration is the time it took to stop the partition the last time, including
+	// flushing and closing its storages
+	StopDuration time.Duration
+	// StopError is the error of stopping the partition the last time, if any
+	StopError string
+}
+
+// String returns a human readable multi-line summary of the report, e.g. to log it.
+func (r *ShutdownReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "shutdown report of %s: ran %v from %s", r.Name, r.Stopped.Sub(r.Started).Round(time.Millisecond), r.Started.Format(time.RFC3339))
+	partitions := make([]int32, 0, len(r.Partitions))
+	for partition := range r.Partitions {
+		partitions = append(partitions, partition)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	for _, partition := range partitions {
+		p := r.Partitions[partition]
+		topics := make([]string, 0, len(p.LastOffsets))
+		for topic := range p.LastOffsets {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+		offsets := make([]string, 0, len(topics))
+		for _, topic := range topics {
+			offsets = append(offsets, fmt.Sprintf("%s@%d", topic, p.LastOffsets[topic]))
+		}
+		fmt.Fprintf(&b, "\n  partition %d: processed %d, last offsets [%s], stopped in %v", partition, p.Processed, strings.Join(offsets, " "), p.StopDuration.Round(time.Millisecond))
+		if p.StopError != "" {
+			fmt.Fprintf(&b, " with error: %s", p.StopError)
+		}
+	}
+	for _, err := range r.Errors {
+		fmt.Fprintf(&b, "\n  error: %s", err)
+	}
+	return b.String()
+}
+
+// shutdownRecorder collects the data of the shutdown report while running.
+// A nil recorder records nothing.
+type shutdownRecorder struct {
+	m          sync.Mutex
+	name       string
+	started    time.Time
+	partitions map[int32]*PartitionShutdownReport
+	report     *ShutdownReport
+}
+
+func newShutdownRecorder(name string) *shutdownRecorder {
+	return &shutdownRecorder{
+		name:       name,
+		partitions: make(map[int32]*PartitionShutdownReport),
+	}
+}
+
+func (r *shutdownRecorder) start() {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.started = time.Now()
+}
+
+func (r *shutdownRecorder) partition(partition int32) *PartitionShutdownReport {
+	p, ok := r.partitions[partition]
+	if !ok {
+		p = &PartitionShutdownReport{LastOffsets: make(map[string]int64)}
+		r.partitions[partition] = p
+	}
+	return p
+}
+
+// trackCommits wraps the commit callback to count the committed messages
+func (r *shutdownRecorder) trackCommits(commit commitCallback) commitCallback {
+	if r == nil {
+		return commit
+	}
+	return func(msg *sarama.ConsumerMessage, meta string) {
+		commit(msg, meta)
+		r.processed(msg.Topic, msg.Partition, msg.Offset)
+	}
+}
+
+func (r *shutdownRecorder) processed(topic string, partition int32, offset int64) {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	p := r.partition(partition)
+	p.Processed++
+	if last, ok := p.LastOffsets[topic]; !ok || offset > last {
+		p.LastOffsets[topic] = offset
+	}
+}
+
+func (r *shutdownRecorder) offset(topic string, partition int32, offset int64) {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.partition(partition).LastOffsets[topic] = offset
+}
+
+func (r *shutdownRecorder) stopped(partition int32, duration time.Duration, err error) {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	p := r.partition(partition)
+	p.StopDuration = duration
+	p.StopError = ""
+	if err != nil {
+		p.StopError = err.Error()
+	}
+}
+
+// finish creates the report
+func (r *shutdownRecorder) finish(errs []timedError, err error) *ShutdownReport {
+	if r == nil {
+		return nil
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	report := &ShutdownReport{
+		Name:       r.name,
+		Started:    r.started,
+		Stopped:    time.Now(),
+		Partitions: make(map[int32]*PartitionShutdownReport, len(r.partitions)),
+	}
+	for partition, p := range r.partitions {
+		offsets := make(map[string]int64, len(p.LastOffsets))
+		for topic, offset := range p.LastOffsets {
+			offsets[topic] = offset
+		}
+		report.Partitions[partition] = &PartitionShutdownReport{
+			Processed:    p.Processed,
+			LastOffsets:  offsets,
+			StopDuration: p.StopDuration,
+			StopError:    p.StopError,
+		}
+	}
+	for _, e := range errs {
+		report.Errors = append(report.Errors, e.err.Error())
+	}
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	r.report = report
+	return report
+}
+
+// get returns the report or nil if it was not finished yet
+func (r *shutdownRecorder) get() *ShutdownReport {
+	if r == nil {
+		return nil
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.report
+}
@@ -0,0 +1,75 @@
+package goka
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// sidecar is a storage next to the storage of a partition table, e.g. of its offset
+// index, which is built by the table's storage builder for the table topic with a
+// suffix. Writes are collected in a batch until they are flushed.
+type sidecar struct {
+	builder storage.Builder
+	suffix  string
+	// name describes the sidecar in errors
+	name string
+
+	m     sync.Mutex
+	st    storage.Storage
+	batch *storage.Batch
+}
+
+func newSidecar(builder storage.Builder, suffix, name string) sidecar {
+	return sidecar{
+		builder: builder,
+		suffix:  suffix,
+		name:    name,
+		batch:   storage.NewBatch(),
+	}
+}
+
+// open builds and opens the storage of the sidecar.
+func (sc *sidecar) open(topic string, partition int32) error {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+	if sc.st != nil {
+		return nil
+	}
+	st, err := sc.builder(topic+sc.suffix, partition)
+	if err != nil {
+		return fmt.Errorf("error building %s storage: %v", sc.name, err)
+	}
+	if err := st.Open(); err != nil {
+		return fmt.Errorf("error opening %s storage: %v", sc.name, err)
+	}
+	sc.st = st
+	return nil
+}
+
+// writeBatch writes the collected writes. It must be called with the lock held.
+func (sc *sidecar) writeBatch() error {
+	if err := storage.SetBatch(sc.st, sc.batch); err != nil {
+		return fmt.Errorf("error writing %s: %v", sc.name, err)
+	}
+	sc.batch.Reset()
+	return nil
+}
+
+func (sc *sidecar) markRecovered() error {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+	return sc.st.MarkRecovered()
+}
+
+func (sc *sidecar) close() error {
+	sc.m.Lock()
+	defer sc.m.Unlock()
+	if sc.st == nil {
+		return nil
+	}
+	err := sc.st.Close()
+	sc.st = nil
+	return err
+}
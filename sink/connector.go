@@ -0,0 +1,232 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+const (
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+	defaultRetries       = 3
+	defaultRetryBackoff  = time.Second
+)
+
+// Option configures a Connector.
+type Option func(*options)
+
+type options struct {
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	retryBackoff  time.Duration
+	log           goka.Logger
+	procOpts      []goka.ProcessorOption
+}
+
+// WithBatchSize sets the maximum number of records per batch. A batch is written
+// when it is full or the flush interval passed. Defaults to 500.
+func WithBatchSize(size int) Option {
+	return func(o *options) {
+		o.batchSize = size
+	}
+}
+
+// WithFlushInterval sets the interval in which incomplete batches are written.
+// Defaults to 1 second.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.flushInterval = interval
+	}
+}
+
+// WithRetries sets how often a failed batch is retried and the backoff between the
+// attempts. If the last attempt fails, the connector's processor fails with the error.
+// Defaults to 3 retries with 1 second backoff.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.retries = retries
+		o.retryBackoff = backoff
+	}
+}
+
+// WithLogger sets the logger of the connector.
+func WithLogger(l goka.Logger) Option {
+	return func(o *options) {
+		o.log = l
+	}
+}
+
+// WithProcessorOptions passes options to the processor of the connector,
+// e.g. goka.WithTester or goka.WithConsumerGroupBuilder.
+func WithProcessorOptions(opts ...goka.ProcessorOption) Option {
+	return func(o *options) {
+		o.procOpts = append(o.procOpts, opts...)
+	}
+}
+
+// Connector consumes a topic and writes its messages in batches to a sink.
+type Connector struct {
+	sink Sink
+	proc *goka.Processor
+	opts *options
+
+	// m guards the batch and serializes the calls of the sink
+	m       sync.Mutex
+	batch   []*Record
+	commits []func(error)
+}
+
+// NewConnector creates a connector consuming the topic with the consumer group
+// and writing the messages decoded with codec to the sink.
+func NewConnector(brokers []string, group goka.Group, topic goka.Stream, codec goka.Codec, sink Sink, opts ...Option) (*Connector, error) {
+	o := &options{
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		retries:       defaultRetries,
+		retryBackoff:  defaultRetryBackoff,
+		log:           goka.DefaultLogger(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.batchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size %d: must be positive", o.batchSize)
+	}
+	if o.flushInterval <= 0 {
+		return nil, fmt.Errorf("invalid flush interval %v: must be positive", o.flushInterval)
+	}
+	if o.retries < 0 || o.retryBackoff < 0 {
+		return nil, fmt.Errorf("invalid retries: retries and backoff must not be negative")
+	}
+
+	c := &Connector{
+		sink: sink,
+		opts: o,
+	}
+	// deletions are passed to the sink as records without value
+	procOpts := append([]goka.ProcessorOption{goka.WithNilHandling(goka.NilProcess)}, o.procOpts...)
+	proc, err := goka.NewProcessor(brokers,
+		goka.DefineGroup(group, goka.Input(topic, codec, c.consume)),
+		procOpts...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating processor: %v", err)
+	}
+	c.proc = proc
+	return c, nil
+}
+
+// Processor returns the processor of the connector, e.g. to attach it to the monitor.
+func (c *Connector) Processor() *goka.Processor {
+	return c.proc
+}
+
+// Run opens the sink and consumes the topic until the context is cancelled or
+// writing a batch failed.
+func (c *Connector) Run(ctx context.Context) (rerr error) {
+	if err := c.sink.Open(ctx); err != nil {
+		return fmt.Errorf("error opening sink: %v", err)
+	}
+	defer func() {
+		if err := c.sink.Close(); err != nil && rerr == nil {
+			rerr = fmt.Errorf("error closing sink: %v", err)
+		}
+	}()
+
+	// the processor waits for the deferred commits when shutting down, so the
+	// batches are flushed until it returns, independent of ctx
+	flushCtx, stopFlushing := context.WithCancel(context.Background())
+	flushDone := make(chan struct{})
+	go func() {
+		defer close(flushDone)
+		c.flushPeriodically(flushCtx)
+	}()
+	defer func() {
+		stopFlushing()
+		<-flushDone
+	}()
+
+	return c.proc.Run(ctx)
+}
+
+func (c *Connector) flushPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(c.opts.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.m.Lock()
+			c.flush(ctx)
+			c.m.Unlock()
+		}
+	}
+}
+
+// consume adds the message to the batch, deferring its commit until the batch was written.
+func (c *Connector) consume(ctx goka.Context, msg interface{}) {
+	record := &Record{
+		Key:       ctx.Key(),
+		Value:     msg,
+		Topic:     string(ctx.Topic()),
+		Partition: ctx.Partition(),
+		Offset:    ctx.Offset(),
+		Timestamp: ctx.Timestamp(),
+		Headers:   ctx.Headers(),
+	}
+	c.add(ctx.Context(), record, ctx.DeferCommit())
+}
+
+// add adds the record to the batch and writes the batch if it is full. commit
+// is called with the result of writing the batch.
+func (c *Connector) add(ctx context.Context, record *Record, commit func(error)) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.batch = append(c.batch, record)
+	c.commits = append(c.commits, commit)
+	if len(c.batch) >= c.opts.batchSize {
+		c.flush(ctx)
+	}
+}
+
+// flush writes the batch and finishes the deferred commits of its messages.
+// c.m must be held.
+func (c *Connector) flush(ctx context.Context) {
+	if len(c.batch) == 0 {
+		return
+	}
+	err := c.write(ctx, c.batch)
+	for _, commit := range c.commits {
+		commit(err)
+	}
+	c.batch = nil
+	c.commits = nil
+}
+
+// write writes and flushes the records, retrying on error
+func (c *Connector) write(ctx context.Context, records []*Record) error {
+	for attempt := 0; ; attempt++ {
+		err := c.sink.WriteBatch(ctx, records)
+		if err == nil {
+			err = c.sink.Flush(ctx)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= c.opts.retries {
+			return fmt.Errorf("error writing batch of %d records (%d attempts): %v", len(records), attempt+1, err)
+		}
+		c.opts.log.Printf("error writing batch of %d records (attempt %d), retrying in %v: %v", len(records), attempt+1, c.opts.retryBackoff, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("error writing batch of %d records: %v", len(records), ctx.Err())
+		case <-time.After(c.opts.retryBackoff):
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+// recordingSink records the written batches and fails the first failures writes
+type recordingSink struct {
+	m        sync.Mutex
+	batches  [][]*Record
+	failures int
+	writes   int
+	flushes  int
+	opened   bool
+	closed   bool
+}
+
+func (s *recordingSink) Open(ctx context.Context) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.opened = true
+	return nil
+}
+
+func (s *recordingSink) WriteBatch(ctx context.Context, records []*Record) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.writes++
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("write failed")
+	}
+	s.batches = append(s.batches, records)
+	return nil
+}
+
+func (s *recordingSink) Flush(ctx context.Context) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.flushes++
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.closed = true
+	return nil
+}
+
+// keys returns the keys of the written batches
+func (s *recordingSink) keys() [][]string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var keys [][]string
+	for _, batch := range s.batches {
+		var batchKeys []string
+		for _, record := range batch {
+			batchKeys = append(batchKeys, record.Key)
+		}
+		keys = append(keys, batchKeys)
+	}
+	return keys
+}
+
+func runConnector(t *testing.T, sink Sink, opts ...Option) (*tester.Tester, func() error) {
+	gkt := tester.New(t)
+	opts = append(opts, WithProcessorOptions(goka.WithTester(gkt)))
+	conn, err := NewConnector(nil, "export", "input", new(codec.String), sink, opts...)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- conn.Run(ctx)
+	}()
+	return gkt, func() error {
+		cancel()
+		return <-errs
+	}
+}
+
+func TestConnector(t *testing.T) {
+	t.Run("batch-size", func(t *testing.T) {
+		sink := new(recordingSink)
+		conn := &Connector{
+			sink: sink,
+			opts: &options{batchSize: 2, log: goka.DefaultLogger()},
+		}
+		var commits []error
+		commit := func(err error) { commits = append(commits, err) }
+
+		conn.add(context.Background(), &Record{Key: "a", Value: "1"}, commit)
+		test.AssertEqual(t, len(commits), 0)
+		conn.add(context.Background(), &Record{Key: "b", Value: "2"}, commit)
+		test.AssertEqual(t, commits, []error{nil, nil})
+		conn.add(context.Background(), &Record{Key: "c"}, commit)
+		conn.add(context.Background(), &Record{Key: "d", Value: "4"}, commit)
+
+		test.AssertEqual(t, sink.keys(), [][]string{{"a", "b"}, {"c", "d"}})
+		test.AssertEqual(t, sink.flushes, 2)
+		test.AssertEqual(t, len(commits), 4)
+	})
+
+	t.Run("flush-interval", func(t *testing.T) {
+		sink := new(recordingSink)
+		gkt, stop := runConnector(t, sink, WithBatchSize(100), WithFlushInterval(10*time.Millisecond))
+
+		// the tester waits for the commit of the message, i.e. until the batch was written
+		gkt.Consume("input", "a", "1")
+		gkt.Consume("input", "b", nil)
+		test.AssertEqual(t, sink.keys(), [][]string{{"a"}, {"b"}})
+		test.AssertEqual(t, sink.batches[0][0].Value, "1")
+		test.AssertTrue(t, sink.batches[1][0].Value == nil)
+		test.AssertEqual(t, sink.batches[1][0].Offset, int64(1))
+
+		test.AssertNil(t, stop())
+		test.AssertTrue(t, sink.opened)
+		test.AssertTrue(t, sink.closed)
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		sink := &recordingSink{failures: 2}
+		gkt, stop := runConnector(t, sink, WithBatchSize(1), WithRetries(2, time.Millisecond))
+
+		gkt.Consume("input", "a", "1")
+		test.AssertEqual(t, sink.keys(), [][]string{{"a"}})
+		test.AssertEqual(t, sink.writes, 3)
+
+		test.AssertNil(t, stop())
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		sink := &recordingSink{failures: 2}
+		conn := &Connector{
+			sink: sink,
+			opts: &options{retries: 1, log: goka.DefaultLogger()},
+		}
+		err := conn.write(context.Background(), []*Record{{Key: "a"}})
+		test.AssertNotNil(t, err)
+		test.AssertStringContains(t, err.Error(), "2 attempts")
+		test.AssertEqual(t, sink.writes, 2)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, opt := range []Option{WithBatchSize(0), WithFlushInterval(0), WithRetries(-1, 0)} {
+			_, err := NewConnector(nil, "export", "input", new(codec.String), new(recordingSink), opt)
+			test.AssertNotNil(t, err)
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ElasticsearchOption configures an Elasticsearch sink.
+type ElasticsearchOption func(*Elasticsearch)
+
+// WithElasticsearchClient sets the HTTP client. Defaults to http.DefaultClient.
+func WithElasticsearchClient(client *http.Client) ElasticsearchOption {
+	return func(e *Elasticsearch) {
+		e.http.client = client
+	}
+}
+
+// WithElasticsearchHeader adds a header to the requests, e.g. for authorization.
+func WithElasticsearchHeader(key, value string) ElasticsearchOption {
+	return func(e *Elasticsearch) {
+		e.http.header.Add(key, value)
+	}
+}
+
+// WithElasticsearchMarshal sets the encoding of the documents. The values must be
+// encoded as JSON objects. Defaults to JSON.
+func WithElasticsearchMarshal(marshal Marshal) ElasticsearchOption {
+	return func(e *Elasticsearch) {
+		e.marshal = marshal
+	}
+}
+
+// Elasticsearch indexes the records as documents with the key as id using the
+// bulk API. Records without value delete their document.
+type Elasticsearch struct {
+	url     string
+	index   string
+	http    httpClient
+	marshal Marshal
+}
+
+// NewElasticsearch creates a sink writing to the index of the cluster at url,
+// e.g. http://localhost:9200.
+func NewElasticsearch(url string, index string, opts ...ElasticsearchOption) *Elasticsearch {
+	e := &Elasticsearch{
+		url:     strings.TrimSuffix(url, "/"),
+		index:   index,
+		http:    newHTTPClient(),
+		marshal: JSON,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// bulkAction is the action line of a bulk request
+type bulkAction struct {
+	Index  *bulkTarget `json:"index,omitempty"`
+	Delete *bulkTarget `json:"delete,omitempty"`
+}
+
+type bulkTarget struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// bulkResponse is the part of the bulk response needed to detect failed items
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string          `json:"_id"`
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// Open checks that the cluster is reachable.
+func (e *Elasticsearch) Open(ctx context.Context) error {
+	resp, err := e.http.do(ctx, http.MethodGet, e.url+"/", "", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// WriteBatch indexes or deletes the documents of the records in one bulk request.
+func (e *Elasticsearch) WriteBatch(ctx context.Context, records []*Record) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, record := range records {
+		target := &bulkTarget{Index: e.index, ID: record.Key}
+		if record.Value == nil {
+			if err := enc.Encode(&bulkAction{Delete: target}); err != nil {
+				return err
+			}
+			continue
+		}
+		doc, err := e.marshal(record.Value)
+		if err != nil {
+			return fmt.Errorf("error encoding value of key %s: %v", record.Key, err)
+		}
+		if err := enc.Encode(&bulkAction{Index: target}); err != nil {
+			return err
+		}
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+
+	resp, err := e.http.do(ctx, http.MethodPost, e.url+"/_bulk", "application/x-ndjson", &body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result bulkResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error decoding bulk response: %v", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	for _, item := range result.Items {
+		for action, status := range item {
+			// deleting a missing document is not an error
+			if action == "delete" && status.Status == http.StatusNotFound {
+				continue
+			}
+			if status.Status >= 300 {
+				return fmt.Errorf("error in bulk %s of document %s (status %d): %s", action, status.ID, status.Status, status.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// Flush does nothing, as the bulk request returns after the documents were written.
+func (e *Elasticsearch) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing.
+func (e *Elasticsearch) Close() error {
+	return nil
+}
@@ -0,0 +1,56 @@
+package sink
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestElasticsearch(t *testing.T) {
+	var (
+		body     string
+		response string
+		auth     string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if r.URL.Path == "/" {
+			return
+		}
+		test.AssertEqual(t, r.URL.Path, "/_bulk")
+		test.AssertEqual(t, r.Header.Get("Content-Type"), "application/x-ndjson")
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.Write([]byte(response))
+	}))
+	defer srv.Close()
+
+	es := NewElasticsearch(srv.URL+"/", "users", WithElasticsearchHeader("Authorization", "ApiKey secret"))
+	test.AssertNil(t, es.Open(context.Background()))
+	test.AssertEqual(t, auth, "ApiKey secret")
+
+	records := []*Record{
+		{Key: "a", Value: map[string]int{"age": 1}},
+		{Key: "b"},
+	}
+
+	response = `{"errors":false,"items":[]}`
+	test.AssertNil(t, es.WriteBatch(context.Background(), records))
+	test.AssertEqual(t, body, `{"index":{"_index":"users","_id":"a"}}
+{"age":1}
+{"delete":{"_index":"users","_id":"b"}}
+`)
+
+	// missing documents are ignored when deleting
+	response = `{"errors":true,"items":[{"index":{"_id":"a","status":201}},{"delete":{"_id":"b","status":404}}]}`
+	test.AssertNil(t, es.WriteBatch(context.Background(), records))
+
+	response = `{"errors":true,"items":[{"index":{"_id":"a","status":400,"error":{"type":"mapper_parsing_exception"}}}]}`
+	err := es.WriteBatch(context.Background(), records)
+	test.AssertNotNil(t, err)
+	test.AssertStringContains(t, err.Error(), "mapper_parsing_exception")
+}
@@ -0,0 +1,47 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// httpClient sends the requests of the HTTP based sinks
+type httpClient struct {
+	client *http.Client
+	header http.Header
+}
+
+func newHTTPClient() httpClient {
+	return httpClient{
+		client: http.DefaultClient,
+		header: make(http.Header),
+	}
+}
+
+// do sends the request and returns an error if the response has no 2xx status
+func (c *httpClient) do(ctx context.Context, method, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	req = req.WithContext(ctx)
+	for key, values := range c.header {
+		req.Header[key] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to %s: %v", url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("request to %s failed with status %d: %s", url, resp.StatusCode, msg)
+	}
+	return resp, nil
+}
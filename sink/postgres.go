@@ -0,0 +1,123 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// PostgresOption configures a Postgres sink.
+type PostgresOption func(*Postgres)
+
+// WithPostgresColumns sets the columns of the key and the value. Defaults to "key" and "value".
+// The key column must have a unique constraint.
+func WithPostgresColumns(key, value string) PostgresOption {
+	return func(p *Postgres) {
+		p.keyColumn = key
+		p.valueColumn = value
+	}
+}
+
+// WithPostgresMarshal sets the encoding of the values. Defaults to JSON.
+func WithPostgresMarshal(marshal Marshal) PostgresOption {
+	return func(p *Postgres) {
+		p.marshal = marshal
+	}
+}
+
+// Postgres upserts the records into a table with a key and a value column, e.g.
+//
+//	CREATE TABLE users (key text PRIMARY KEY, value jsonb)
+//
+// Records without value delete their key. Each batch is written in a transaction.
+type Postgres struct {
+	db          *sql.DB
+	table       string
+	keyColumn   string
+	valueColumn string
+	marshal     Marshal
+
+	upsert string
+	delete string
+}
+
+// NewPostgres creates a sink writing to the table of the database. The database
+// is not closed by the sink.
+func NewPostgres(db *sql.DB, table string, opts ...PostgresOption) *Postgres {
+	p := &Postgres{
+		db:          db,
+		table:       table,
+		keyColumn:   "key",
+		valueColumn: "value",
+		marshal:     JSON,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	table, key, value := quoteIdentifier(p.table), quoteIdentifier(p.keyColumn), quoteIdentifier(p.valueColumn)
+	p.upsert = fmt.Sprintf("INSERT INTO %s (%s, %s) VALUES ($1, $2) ON CONFLICT (%s) DO UPDATE SET %s = EXCLUDED.%s",
+		table, key, value, key, value, value)
+	p.delete = fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table, key)
+	return p
+}
+
+// quoteIdentifier quotes a table or column name. Schema-qualified names are
+// quoted per part.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.Replace(part, `"`, `""`, -1) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// Open checks the connection to the database.
+func (p *Postgres) Open(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+// WriteBatch upserts or deletes the records in one transaction.
+func (p *Postgres) WriteBatch(ctx context.Context, records []*Record) (rerr error) {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer func() {
+		if rerr != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, record := range records {
+		if record.Value == nil {
+			if _, err := tx.ExecContext(ctx, p.delete, record.Key); err != nil {
+				return fmt.Errorf("error deleting key %s: %v", record.Key, err)
+			}
+			continue
+		}
+		data, err := p.marshal(record.Value)
+		if err != nil {
+			return fmt.Errorf("error encoding value of key %s: %v", record.Key, err)
+		}
+		if _, err := tx.ExecContext(ctx, p.upsert, record.Key, string(data)); err != nil {
+			return fmt.Errorf("error upserting key %s: %v", record.Key, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Flush does nothing, as the batches are committed by WriteBatch.
+func (p *Postgres) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing, the database is closed by the caller.
+func (p *Postgres) Close() error {
+	return nil
+}
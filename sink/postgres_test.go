@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+// recordingDriver is a database/sql driver recording the executed statements
+type recordingDriver struct {
+	m          sync.Mutex
+	statements []string
+	fail       string
+}
+
+func (d *recordingDriver) Open(name string) (driver.Conn, error) {
+	return &recordingConn{d: d}, nil
+}
+
+// Connect and Driver implement driver.Connector, so the driver needs no registration
+func (d *recordingDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return d.Open("")
+}
+
+func (d *recordingDriver) Driver() driver.Driver { return d }
+
+func (d *recordingDriver) record(statement string) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+	if d.fail != "" && strings.Contains(statement, d.fail) {
+		return errors.New("statement failed")
+	}
+	d.statements = append(d.statements, statement)
+	return nil
+}
+
+type recordingConn struct {
+	d *recordingDriver
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return &recordingStmt{d: c.d, query: query}, nil
+}
+
+func (c *recordingConn) Close() error { return nil }
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return &recordingTx{d: c.d}, c.d.record("BEGIN")
+}
+
+type recordingTx struct {
+	d *recordingDriver
+}
+
+func (tx *recordingTx) Commit() error   { return tx.d.record("COMMIT") }
+func (tx *recordingTx) Rollback() error { return tx.d.record("ROLLBACK") }
+
+type recordingStmt struct {
+	d     *recordingDriver
+	query string
+}
+
+func (s *recordingStmt) Close() error  { return nil }
+func (s *recordingStmt) NumInput() int { return -1 }
+
+func (s *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), s.d.record(fmt.Sprintf("%s %v", s.query, args))
+}
+
+func (s *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestPostgres(t *testing.T) {
+	drv := new(recordingDriver)
+	db := sql.OpenDB(drv)
+	defer db.Close()
+
+	pg := NewPostgres(db, "export.users", WithPostgresColumns("id", `da"ta`))
+	test.AssertNil(t, pg.Open(context.Background()))
+
+	test.AssertNil(t, pg.WriteBatch(context.Background(), []*Record{
+		{Key: "a", Value: map[string]int{"age": 1}},
+		{Key: "b"},
+	}))
+	test.AssertEqual(t, drv.statements, []string{
+		"BEGIN",
+		`INSERT INTO "export"."users" ("id", "da""ta") VALUES ($1, $2) ON CONFLICT ("id") DO UPDATE SET "da""ta" = EXCLUDED."da""ta" [a {"age":1}]`,
+		`DELETE FROM "export"."users" WHERE "id" = $1 [b]`,
+		"COMMIT",
+	})
+
+	// failed statements roll back the transaction
+	drv.statements = nil
+	drv.fail = "DELETE"
+	err := pg.WriteBatch(context.Background(), []*Record{{Key: "a", Value: 1}, {Key: "b"}})
+	test.AssertNotNil(t, err)
+	test.AssertStringContains(t, err.Error(), "error deleting key b")
+	test.AssertEqual(t, drv.statements[len(drv.statements)-1], "ROLLBACK")
+}
@@ -0,0 +1,70 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/lovoo/goka/recording"
+)
+
+// Recorder is a sink writing the consumed messages as recording in the JSON lines
+// format of package recording, e.g. to record a slice of a topic for tester.Replay:
+//
+//	f, err := os.Create("recording.jsonl")
+//	...
+//	conn, err := sink.NewConnector(brokers, "recorder", "input", new(codec.Bytes), sink.NewRecorder(f))
+//
+// The connector must decode the messages with codec.Bytes. Like all sinks, messages
+// may be recorded twice after a failure.
+type Recorder struct {
+	w io.Writer
+}
+
+// NewRecorder creates a recorder writing to w. If w has a Sync method, like *os.File,
+// it is called on every flush of the connector.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w}
+}
+
+// Open does nothing.
+func (r *Recorder) Open(ctx context.Context) error {
+	return nil
+}
+
+// WriteBatch writes the records as JSON lines.
+func (r *Recorder) WriteBatch(ctx context.Context, records []*Record) error {
+	recs := make([]*recording.Record, 0, len(records))
+	for _, record := range records {
+		rec := &recording.Record{
+			Topic:     record.Topic,
+			Partition: record.Partition,
+			Offset:    record.Offset,
+			Key:       record.Key,
+			Headers:   record.Headers,
+			Timestamp: record.Timestamp,
+		}
+		if record.Value != nil {
+			value, ok := record.Value.([]byte)
+			if !ok {
+				return fmt.Errorf("cannot record value of type %T, the connector must use codec.Bytes", record.Value)
+			}
+			rec.Value = value
+		}
+		recs = append(recs, rec)
+	}
+	return recording.Write(r.w, recs)
+}
+
+// Flush syncs the writer if it has a Sync method.
+func (r *Recorder) Flush(ctx context.Context) error {
+	if syncer, ok := r.w.(interface{ Sync() error }); ok {
+		return syncer.Sync()
+	}
+	return nil
+}
+
+// Close does nothing. The writer is closed by the caller.
+func (r *Recorder) Close() error {
+	return nil
+}
@@ -0,0 +1,64 @@
+// Package sink writes the messages of a topic to external stores, e.g. to export a
+// table into a database or search index.
+//
+// A Sink writes batches of records. A Connector consumes a topic with a goka processor,
+// batches the decoded messages and passes them to the sink. The offsets of the messages
+// are only committed after their batch was written, so every message is written at least once:
+//
+//	db, err := sql.Open("postgres", dsn)
+//	...
+//	conn, err := sink.NewConnector(brokers, "user-export", "user-table", new(UserCodec),
+//		sink.NewPostgres(db, "users"),
+//		sink.WithBatchSize(1000),
+//	)
+//	...
+//	err = conn.Run(ctx)
+//
+// Messages with nil values (e.g. deletions in a table topic) are passed to the sink as
+// records with nil Value, which the built-in sinks delete from the store.
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+// Record is a decoded message passed to a sink.
+type Record struct {
+	Key string
+	// Value is the value decoded with the connector's codec or nil if the
+	// message has no value, i.e. the key was deleted.
+	Value interface{}
+
+	Topic     string
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+	Headers   goka.Headers
+}
+
+// Sink writes records to an external store. The methods are called by one
+// goroutine at a time.
+type Sink interface {
+	// Open is called once before the first batch is written.
+	Open(ctx context.Context) error
+	// WriteBatch writes the records. Records of the same key are passed in the
+	// order of their messages. WriteBatch is retried on error, so it must be idempotent.
+	WriteBatch(ctx context.Context, records []*Record) error
+	// Flush makes the written records durable. It is called after each successful
+	// WriteBatch, before the offsets of the records are committed.
+	Flush(ctx context.Context) error
+	// Close is called once after the last batch was written.
+	Close() error
+}
+
+// Marshal encodes the value of a record for the built-in sinks.
+type Marshal func(value interface{}) ([]byte, error)
+
+// JSON encodes values with encoding/json. It is the default Marshal of the built-in sinks.
+func JSON(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookOption configures a Webhook sink.
+type WebhookOption func(*Webhook)
+
+// WithWebhookClient sets the HTTP client. Defaults to http.DefaultClient.
+func WithWebhookClient(client *http.Client) WebhookOption {
+	return func(w *Webhook) {
+		w.http.client = client
+	}
+}
+
+// WithWebhookHeader adds a header to the requests, e.g. for authorization.
+func WithWebhookHeader(key, value string) WebhookOption {
+	return func(w *Webhook) {
+		w.http.header.Add(key, value)
+	}
+}
+
+// WithWebhookMarshal sets the encoding of the values. The values must be encoded
+// as JSON. Defaults to JSON.
+func WithWebhookMarshal(marshal Marshal) WebhookOption {
+	return func(w *Webhook) {
+		w.marshal = marshal
+	}
+}
+
+// Webhook posts each batch as JSON array of WebhookRecords to a URL. A batch
+// failed if the response does not have a 2xx status.
+type Webhook struct {
+	url     string
+	http    httpClient
+	marshal Marshal
+}
+
+// WebhookRecord is a record in the body of a webhook request.
+type WebhookRecord struct {
+	Key string `json:"key"`
+	// Value is the encoded value, or null if the key was deleted
+	Value     json.RawMessage `json:"value"`
+	Topic     string          `json:"topic"`
+	Partition int32           `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// NewWebhook creates a sink posting the records to url.
+func NewWebhook(url string, opts ...WebhookOption) *Webhook {
+	w := &Webhook{
+		url:     url,
+		http:    newHTTPClient(),
+		marshal: JSON,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Open does nothing.
+func (w *Webhook) Open(ctx context.Context) error {
+	return nil
+}
+
+// WriteBatch posts the records in one request.
+func (w *Webhook) WriteBatch(ctx context.Context, records []*Record) error {
+	body := make([]*WebhookRecord, 0, len(records))
+	for _, record := range records {
+		wr := &WebhookRecord{
+			Key:       record.Key,
+			Value:     json.RawMessage("null"),
+			Topic:     record.Topic,
+			Partition: record.Partition,
+			Offset:    record.Offset,
+			Timestamp: record.Timestamp,
+		}
+		if record.Value != nil {
+			data, err := w.marshal(record.Value)
+			if err != nil {
+				return fmt.Errorf("error encoding value of key %s: %v", record.Key, err)
+			}
+			wr.Value = data
+		}
+		body = append(body, wr)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %v", err)
+	}
+
+	resp, err := w.http.do(ctx, http.MethodPost, w.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Flush does nothing, as the request returns after the records were received.
+func (w *Webhook) Flush(ctx context.Context) error {
+	return nil
+}
+
+// Close does nothing.
+func (w *Webhook) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestWebhook(t *testing.T) {
+	var (
+		received []*WebhookRecord
+		status   = http.StatusOK
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		test.AssertEqual(t, r.Method, http.MethodPost)
+		test.AssertEqual(t, r.Header.Get("X-Token"), "secret")
+		test.AssertNil(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	hook := NewWebhook(srv.URL, WithWebhookHeader("X-Token", "secret"))
+	ts := time.Unix(1600000000, 0).UTC()
+	records := []*Record{
+		{Key: "a", Value: "1", Topic: "input", Partition: 1, Offset: 5, Timestamp: ts},
+		{Key: "b", Topic: "input", Partition: 1, Offset: 6, Timestamp: ts},
+	}
+
+	test.AssertNil(t, hook.WriteBatch(context.Background(), records))
+	test.AssertEqual(t, len(received), 2)
+	test.AssertEqual(t, *received[0], WebhookRecord{
+		Key: "a", Value: json.RawMessage(`"1"`), Topic: "input", Partition: 1, Offset: 5, Timestamp: ts,
+	})
+	test.AssertEqual(t, string(received[1].Value), "null")
+
+	status = http.StatusServiceUnavailable
+	err := hook.WriteBatch(context.Background(), records)
+	test.AssertNotNil(t, err)
+	test.AssertStringContains(t, err.Error(), "503")
+}
@@ -0,0 +1,141 @@
+package goka
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// SnapshotManifestFile is the file in a snapshot directory listing the copied storages
+// and their offsets.
+const SnapshotManifestFile = "snapshot.json"
+
+// SnapshotManifest lists the storages copied by Processor.Snapshot or View.Snapshot.
+type SnapshotManifest struct {
+	Storages []*SnapshotStorage `json:"storages"`
+}
+
+// SnapshotStorage is a storage copied into a snapshot. It is stored in the directory
+// <topic>.<partition> of the snapshot, the layout of storage.DefaultBuilder.
+type SnapshotStorage struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// Offset is the offset stored in the copy or -1 if none was stored
+	Offset int64 `json:"offset"`
+}
+
+// snapshotStorageDir returns the directory of the storage in the snapshot directory.
+func snapshotStorageDir(dir, topic string, partition int32) string {
+	return filepath.Join(dir, fmt.Sprintf("%s.%d", topic, partition))
+}
+
+// snapshotStorage copies the storage into the snapshot directory.
+func snapshotStorage(dir, topic string, partition int32, st storage.Storage) (*SnapshotStorage, error) {
+	snapshotter, ok := st.(storage.Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("cannot snapshot %s/%d: %v", topic, partition, storage.ErrNoSnapshots)
+	}
+	offset, err := snapshotter.Snapshot(snapshotStorageDir(dir, topic, partition))
+	if err != nil {
+		return nil, fmt.Errorf("error snapshotting %s/%d: %v", topic, partition, err)
+	}
+	return &SnapshotStorage{Topic: topic, Partition: partition, Offset: offset}, nil
+}
+
+// Snapshot copies the storage of the partition table and the storages of its offset
+// index, secondary indexes and key expiry, if configured, into the snapshot directory.
+// The sidecar storages are copied after the table, so they may contain newer
+// entries, which are repaired when recovering the table from its offset.
+func (p *PartitionTable) Snapshot(dir string) ([]*SnapshotStorage, error) {
+	if err := p.readyToRead(); err != nil {
+		return nil, err
+	}
+
+	table, err := snapshotStorage(dir, p.topic, p.partition, p.st.Storage)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []*SnapshotStorage{table}
+
+	sidecars := make(map[string]storage.Storage)
+	if p.index != nil {
+		p.index.m.Lock()
+		sidecars[offsetIndexSuffix] = p.index.st
+		p.index.m.Unlock()
+	}
+	if p.secondary != nil {
+		p.secondary.m.Lock()
+		sidecars[secondaryIndexSuffix] = p.secondary.st
+		p.secondary.m.Unlock()
+	}
+	if p.expiry != nil {
+		p.expiry.m.Lock()
+		sidecars[keyExpirySuffix] = p.expiry.st
+		p.expiry.m.Unlock()
+	}
+	for suffix, st := range sidecars {
+		if st == nil {
+			continue
+		}
+		sidecar, err := snapshotStorage(dir, p.topic+suffix, p.partition, st)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, sidecar)
+	}
+	return snapshots, nil
+}
+
+// snapshotTables copies the tables into the directory, which must not exist, and
+// writes the manifest.
+func snapshotTables(dir string, tables []*PartitionTable) error {
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("snapshot directory %s already exists", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating snapshot directory %s: %v", dir, err)
+	}
+
+	manifest := new(SnapshotManifest)
+	for _, table := range tables {
+		snapshots, err := table.Snapshot(dir)
+		if err != nil {
+			return err
+		}
+		manifest.Storages = append(manifest.Storages, snapshots...)
+	}
+	sort.Slice(manifest.Storages, func(i, j int) bool {
+		a, b := manifest.Storages[i], manifest.Storages[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot manifest: %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, SnapshotManifestFile), data, 0644); err != nil {
+		return fmt.Errorf("error writing snapshot manifest: %v", err)
+	}
+	return nil
+}
+
+// ReadSnapshotManifest reads the manifest of the snapshot in the directory.
+func ReadSnapshotManifest(dir string) (*SnapshotManifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, SnapshotManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot manifest: %v", err)
+	}
+	manifest := new(SnapshotManifest)
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("error decoding snapshot manifest: %v", err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,72 @@
+package goka
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestSnapshotTables(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_snapshot_test")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	var (
+		builder = storage.DefaultBuilder(filepath.Join(path, "storages"))
+		dir     = filepath.Join(path, "snapshot")
+		tables  []*PartitionTable
+	)
+	for partition := int32(0); partition < 2; partition++ {
+		st, err := builder("table", partition)
+		test.AssertNil(t, err)
+		defer st.Close()
+		test.AssertNil(t, st.MarkRecovered())
+
+		pt := &PartitionTable{
+			topic:     "table",
+			partition: partition,
+			state:     newPartitionTableState().SetState(State(PartitionRunning)),
+			st:        &storageProxy{Storage: st, update: DefaultUpdate},
+			builder:   builder,
+		}
+		pt.configureKeyTTL()
+		test.AssertNil(t, pt.expiry.open("table", partition))
+		defer pt.expiry.close()
+
+		hdr := expiryHeaders(nil, time.Now().Add(time.Hour))
+		test.AssertNil(t, pt.storeEvent("key", []byte("value"), 10+int64(partition), hdr, time.Time{}))
+		tables = append(tables, pt)
+	}
+
+	test.AssertNil(t, snapshotTables(dir, tables))
+	test.AssertNotNil(t, snapshotTables(dir, tables))
+
+	manifest, err := ReadSnapshotManifest(dir)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, manifest.Storages, []*SnapshotStorage{
+		{Topic: "table", Partition: 0, Offset: 10},
+		{Topic: "table", Partition: 1, Offset: 11},
+		{Topic: "table" + keyExpirySuffix, Partition: 0, Offset: -1},
+		{Topic: "table" + keyExpirySuffix, Partition: 1, Offset: -1},
+	})
+
+	// the copies are opened by a builder of the snapshot directory
+	st, err := storage.DefaultBuilder(dir)("table", 1)
+	test.AssertNil(t, err)
+	defer st.Close()
+	value, err := st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+	offset, err := st.GetOffset(0)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(11))
+
+	// tables must be recovered
+	tables[0].state.SetState(State(PartitionRecovering))
+	test.AssertNotNil(t, snapshotTables(filepath.Join(path, "recovering"), tables))
+}
@@ -0,0 +1,248 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultMaxBackoff   = time.Minute
+)
+
+// Option configures a Connector.
+type Option func(*options)
+
+type options struct {
+	pollInterval time.Duration
+	backoff      goka.Backoff
+	maxBackoff   time.Duration
+	log          goka.Logger
+}
+
+// WithPollInterval sets the interval in which the source is polled while it has
+// no messages. Defaults to 1 second.
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.pollInterval = interval
+	}
+}
+
+// WithBackoff sets the backoff after failed polls or emits and its maximum duration.
+// Defaults to goka.NewSimpleBackoff with a maximum of 1 minute.
+func WithBackoff(backoff goka.Backoff, max time.Duration) Option {
+	return func(o *options) {
+		o.backoff = backoff
+		o.maxBackoff = max
+	}
+}
+
+// WithLogger sets the logger of the connector.
+func WithLogger(l goka.Logger) Option {
+	return func(o *options) {
+		o.log = l
+	}
+}
+
+// Stats are the metrics of a connector.
+type Stats struct {
+	Polls   int64
+	Emitted int64
+	Errors  int64
+	// Position is the last stored position
+	Position  string
+	LastEmit  time.Time
+	LastError string
+}
+
+// Connector polls a source and emits its messages.
+type Connector struct {
+	name        string
+	source      Source
+	emitter     *goka.Emitter
+	checkpoints Checkpointer
+	opts        *options
+
+	m     sync.Mutex
+	stats Stats
+}
+
+// NewConnector creates a connector emitting the messages of the source with the emitter.
+// The positions are stored in checkpoints under the name of the connector.
+func NewConnector(name string, source Source, emitter *goka.Emitter, checkpoints Checkpointer, opts ...Option) (*Connector, error) {
+	o := &options{
+		pollInterval: defaultPollInterval,
+		backoff:      goka.NewSimpleBackoff(time.Second),
+		maxBackoff:   defaultMaxBackoff,
+		log:          goka.DefaultLogger(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("connector needs a name")
+	}
+	if o.pollInterval <= 0 {
+		return nil, fmt.Errorf("invalid poll interval %v: must be positive", o.pollInterval)
+	}
+	if o.backoff == nil || o.maxBackoff <= 0 {
+		return nil, fmt.Errorf("invalid backoff: backoff must be set and max backoff must be positive")
+	}
+
+	return &Connector{
+		name:        name,
+		source:      source,
+		emitter:     emitter,
+		checkpoints: checkpoints,
+		opts:        o,
+	}, nil
+}
+
+// Stats returns the metrics of the connector.
+func (c *Connector) Stats() Stats {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.stats
+}
+
+// Run opens the source at the stored position and emits its messages until the
+// context is cancelled. Failed polls or emits are retried with backoff after reopening
+// the source at the stored position. The emitter is not finished by the connector.
+func (c *Connector) Run(ctx context.Context) (rerr error) {
+	position, _, err := c.checkpoints.Get(c.name)
+	if err != nil {
+		return fmt.Errorf("error getting position of connector %s: %v", c.name, err)
+	}
+	c.m.Lock()
+	c.stats.Position = position
+	c.m.Unlock()
+
+	if err := c.source.Open(ctx, position); err != nil {
+		return fmt.Errorf("error opening source at position %q: %v", position, err)
+	}
+	defer func() {
+		if err := c.source.Close(); err != nil && rerr == nil {
+			rerr = fmt.Errorf("error closing source: %v", err)
+		}
+	}()
+
+	for {
+		msgs, err := c.source.Poll(ctx)
+		c.m.Lock()
+		c.stats.Polls++
+		c.m.Unlock()
+		if err == nil {
+			err = c.emit(msgs)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		wait := c.opts.pollInterval
+		switch {
+		case err != nil:
+			wait = c.opts.backoff.Duration()
+			if wait > c.opts.maxBackoff {
+				wait = c.opts.maxBackoff
+			}
+			c.m.Lock()
+			c.stats.Errors++
+			c.stats.LastError = err.Error()
+			position = c.stats.Position
+			c.m.Unlock()
+			c.opts.log.Printf("error in connector %s, reopening source at position %q in %v: %v", c.name, position, wait, err)
+		case len(msgs) > 0:
+			c.opts.backoff.Reset()
+			continue
+		default:
+			c.opts.backoff.Reset()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+
+		if err != nil {
+			if err := c.reopen(ctx, position); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// reopen opens the source at the position after a failure
+func (c *Connector) reopen(ctx context.Context, position string) error {
+	if err := c.source.Close(); err != nil {
+		c.opts.log.Printf("error closing source of connector %s: %v", c.name, err)
+	}
+	if err := c.source.Open(ctx, position); err != nil {
+		return fmt.Errorf("error reopening source at position %q: %v", position, err)
+	}
+	return nil
+}
+
+// emit emits the messages, waits until all are delivered and stores the position
+// of the last message.
+func (c *Connector) emit(msgs []*Message) (rerr error) {
+	defer func() {
+		for _, msg := range msgs {
+			if msg.Done != nil {
+				msg.Done(rerr)
+			}
+		}
+	}()
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	var (
+		wg      sync.WaitGroup
+		errM    sync.Mutex
+		emitErr error
+	)
+	for _, msg := range msgs {
+		promise, err := c.emitter.EmitWithHeaders(msg.Key, msg.Value, msg.Headers)
+		if err != nil {
+			errM.Lock()
+			emitErr = fmt.Errorf("error emitting message (key %s): %v", msg.Key, err)
+			errM.Unlock()
+			break
+		}
+		wg.Add(1)
+		key := msg.Key
+		promise.Then(func(err error) {
+			defer wg.Done()
+			if err != nil {
+				errM.Lock()
+				emitErr = fmt.Errorf("error emitting message (key %s): %v", key, err)
+				errM.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+	if emitErr != nil {
+		return emitErr
+	}
+
+	position := msgs[len(msgs)-1].Position
+	if position != "" {
+		if err := c.checkpoints.Set(c.name, position); err != nil {
+			return fmt.Errorf("error storing position %q: %v", position, err)
+		}
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.stats.Emitted += int64(len(msgs))
+	c.stats.LastEmit = time.Now()
+	if position != "" {
+		c.stats.Position = position
+	}
+	return nil
+}
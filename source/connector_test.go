@@ -0,0 +1,154 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+// memoryCheckpoints stores the positions in a map
+type memoryCheckpoints struct {
+	m         sync.Mutex
+	positions map[string]string
+}
+
+func (c *memoryCheckpoints) Get(name string) (string, bool, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	position, ok := c.positions[name]
+	return position, ok, nil
+}
+
+func (c *memoryCheckpoints) Set(name string, value string) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.positions[name] = value
+	return nil
+}
+
+// sliceSource returns the values as messages with their index as position.
+// Each poll returns up to two messages and fails once at failAt.
+type sliceSource struct {
+	m      sync.Mutex
+	values []string
+	next   int
+	failAt int
+	opens  []string
+	done   []error
+}
+
+func (s *sliceSource) Open(ctx context.Context, position string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.opens = append(s.opens, position)
+	s.next = 0
+	if position != "" {
+		next, err := strconv.Atoi(position)
+		if err != nil {
+			return err
+		}
+		s.next = next
+	}
+	return nil
+}
+
+func (s *sliceSource) Poll(ctx context.Context) ([]*Message, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var msgs []*Message
+	for len(msgs) < 2 && s.next < len(s.values) {
+		if s.next == s.failAt {
+			s.failAt = -1
+			if len(msgs) > 0 {
+				break
+			}
+			return nil, errors.New("poll failed")
+		}
+		s.next++
+		msgs = append(msgs, &Message{
+			Key:      s.values[s.next-1],
+			Value:    s.values[s.next-1],
+			Position: strconv.Itoa(s.next),
+			Done: func(err error) {
+				s.m.Lock()
+				defer s.m.Unlock()
+				s.done = append(s.done, err)
+			},
+		})
+	}
+	return msgs, nil
+}
+
+func (s *sliceSource) Close() error { return nil }
+
+func TestConnector(t *testing.T) {
+	gkt := tester.New(t)
+	emitter, err := goka.NewEmitter(nil, "output", new(codec.String), goka.WithEmitterTester(gkt))
+	test.AssertNil(t, err)
+	tracker := gkt.NewQueueTracker("output")
+
+	checkpoints := &memoryCheckpoints{positions: map[string]string{"conn": "1"}}
+	src := &sliceSource{values: []string{"a", "b", "c", "d", "e"}, failAt: 3}
+	conn, err := NewConnector("conn", src, emitter, checkpoints,
+		WithPollInterval(time.Millisecond),
+		WithBackoff(goka.NewSimpleBackoff(time.Millisecond), time.Millisecond),
+	)
+	test.AssertNil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.Run(ctx)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for conn.Stats().Position != "5" {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for connector")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	test.AssertNil(t, <-done)
+
+	// the source is opened at the stored position and reopened after the failure
+	test.AssertEqual(t, src.opens, []string{"1", "3"})
+	test.AssertEqual(t, checkpoints.positions["conn"], "5")
+
+	var keys []string
+	for {
+		key, _, ok := tracker.Next()
+		if !ok {
+			break
+		}
+		keys = append(keys, key)
+	}
+	test.AssertEqual(t, keys, []string{"b", "c", "d", "e"})
+
+	stats := conn.Stats()
+	test.AssertEqual(t, stats.Emitted, int64(4))
+	test.AssertEqual(t, stats.Errors, int64(1))
+	test.AssertEqual(t, stats.LastError, "poll failed")
+	test.AssertEqual(t, len(src.done), 4)
+	for _, err := range src.done {
+		test.AssertNil(t, err)
+	}
+}
+
+func TestConnector_Invalid(t *testing.T) {
+	checkpoints := &memoryCheckpoints{positions: map[string]string{}}
+	_, err := NewConnector("", new(sliceSource), nil, checkpoints)
+	test.AssertNotNil(t, err)
+	_, err = NewConnector("conn", new(sliceSource), nil, checkpoints, WithPollInterval(0))
+	test.AssertNotNil(t, err)
+	_, err = NewConnector("conn", new(sliceSource), nil, checkpoints, WithBackoff(nil, time.Second))
+	test.AssertNotNil(t, err)
+}
@@ -0,0 +1,117 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const defaultFileBatchSize = 1000
+
+// FileOption configures a File source.
+type FileOption func(*File)
+
+// WithFileKey sets the function returning the key of a line. Defaults to empty keys.
+func WithFileKey(key func(line string) string) FileOption {
+	return func(f *File) {
+		f.key = key
+	}
+}
+
+// WithFileBatchSize sets the maximum number of lines returned by a poll. Defaults to 1000.
+func WithFileBatchSize(size int) FileOption {
+	return func(f *File) {
+		f.batchSize = size
+	}
+}
+
+// File tails a file and returns each complete line as message with the line
+// (without line break) as string value. The position is the byte offset after the line.
+// Truncated or rotated files are not detected.
+type File struct {
+	path      string
+	key       func(line string) string
+	batchSize int
+
+	file   *os.File
+	reader *bufio.Reader
+	offset int64
+	// partial is an incomplete last line, which is completed by the next poll
+	partial string
+}
+
+// NewFile creates a source tailing the file at path.
+func NewFile(path string, opts ...FileOption) *File {
+	f := &File{
+		path:      path,
+		key:       func(string) string { return "" },
+		batchSize: defaultFileBatchSize,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Open opens the file and seeks to the position.
+func (f *File) Open(ctx context.Context, position string) error {
+	var offset int64
+	if position != "" {
+		var err error
+		if offset, err = strconv.ParseInt(position, 10, 64); err != nil {
+			return fmt.Errorf("invalid position %q: %v", position, err)
+		}
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return fmt.Errorf("error seeking to offset %d: %v", offset, err)
+	}
+	f.file = file
+	f.reader = bufio.NewReader(file)
+	f.offset = offset
+	f.partial = ""
+	return nil
+}
+
+// Poll returns the lines appended since the last poll.
+func (f *File) Poll(ctx context.Context) ([]*Message, error) {
+	var msgs []*Message
+	for len(msgs) < f.batchSize {
+		data, err := f.reader.ReadString('\n')
+		if err == io.EOF {
+			f.partial += data
+			return msgs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading file: %v", err)
+		}
+
+		line := f.partial + data
+		f.partial = ""
+		f.offset += int64(len(line))
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		msgs = append(msgs, &Message{
+			Key:      f.key(line),
+			Value:    line,
+			Position: strconv.FormatInt(f.offset, 10),
+		})
+	}
+	return msgs, nil
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,64 @@
+package source
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goka_source_TestFile")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "input.log")
+	test.AssertNil(t, ioutil.WriteFile(path, []byte("a 1\nb 2\r\nc"), 0644))
+
+	values := func(msgs []*Message) []interface{} {
+		var values []interface{}
+		for _, msg := range msgs {
+			values = append(values, msg.Value)
+		}
+		return values
+	}
+
+	src := NewFile(path, WithFileKey(func(line string) string { return line[:1] }))
+	test.AssertNil(t, src.Open(context.Background(), ""))
+
+	msgs, err := src.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, values(msgs), []interface{}{"a 1", "b 2"})
+	test.AssertEqual(t, msgs[1].Key, "b")
+	test.AssertEqual(t, msgs[1].Position, "9")
+
+	// the incomplete line is returned when it's completed
+	msgs, err = src.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(msgs), 0)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	test.AssertNil(t, err)
+	_, err = f.WriteString(" 3\nd 4\n")
+	test.AssertNil(t, err)
+	test.AssertNil(t, f.Close())
+
+	msgs, err = src.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, values(msgs), []interface{}{"c 3", "d 4"})
+	test.AssertEqual(t, msgs[1].Position, "17")
+	test.AssertNil(t, src.Close())
+
+	// reopening continues at the position
+	src = NewFile(path, WithFileBatchSize(1))
+	test.AssertNil(t, src.Open(context.Background(), "9"))
+	msgs, err = src.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, values(msgs), []interface{}{"c 3"})
+	test.AssertEqual(t, msgs[0].Key, "")
+	test.AssertNil(t, src.Close())
+
+	test.AssertNotNil(t, src.Open(context.Background(), "x"))
+}
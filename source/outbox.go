@@ -0,0 +1,103 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const defaultOutboxBatchSize = 100
+
+// OutboxOption configures an Outbox source.
+type OutboxOption func(*Outbox)
+
+// WithOutboxBatchSize sets the maximum number of rows returned by a poll. Defaults to 100.
+func WithOutboxBatchSize(size int) OutboxOption {
+	return func(o *Outbox) {
+		o.batchSize = size
+	}
+}
+
+// WithOutboxStartPosition sets the position passed to the query if no position
+// was stored yet. Defaults to "0".
+func WithOutboxStartPosition(position string) OutboxOption {
+	return func(o *Outbox) {
+		o.start = position
+	}
+}
+
+// Outbox reads the rows of an outbox table, which are written by an application in
+// the same transaction as its changes. The query is called with the position
+// of the last row and the batch size and must return the position, key and value
+// of the following rows in order, e.g.
+//
+//	SELECT id, key, value FROM outbox WHERE id > $1 ORDER BY id LIMIT $2
+//
+// The values are returned as []byte, so the emitter should use codec.Bytes.
+// Emitted rows are not deleted by the source.
+type Outbox struct {
+	db        *sql.DB
+	query     string
+	batchSize int
+	start     string
+
+	position string
+}
+
+// NewOutbox creates a source reading rows with the query from the database.
+// The database is not closed by the source.
+func NewOutbox(db *sql.DB, query string, opts ...OutboxOption) *Outbox {
+	o := &Outbox{
+		db:        db,
+		query:     query,
+		batchSize: defaultOutboxBatchSize,
+		start:     "0",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Open sets the position to read from.
+func (o *Outbox) Open(ctx context.Context, position string) error {
+	if position == "" {
+		position = o.start
+	}
+	o.position = position
+	return o.db.PingContext(ctx)
+}
+
+// Poll queries the rows after the last returned row.
+func (o *Outbox) Poll(ctx context.Context) ([]*Message, error) {
+	rows, err := o.db.QueryContext(ctx, o.query, o.position, o.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("error querying outbox: %v", err)
+	}
+	defer rows.Close()
+
+	var msgs []*Message
+	for rows.Next() {
+		var (
+			msg   Message
+			value []byte
+		)
+		if err := rows.Scan(&msg.Position, &msg.Key, &value); err != nil {
+			return nil, fmt.Errorf("error scanning outbox row: %v", err)
+		}
+		msg.Value = value
+		msgs = append(msgs, &msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error reading outbox rows: %v", err)
+	}
+	if len(msgs) > 0 {
+		o.position = msgs[len(msgs)-1].Position
+	}
+	return msgs, nil
+}
+
+// Close does nothing, the database is closed by the caller.
+func (o *Outbox) Close() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+// outboxDriver is a database/sql driver returning the rows after the position
+// passed as first argument, limited by the second argument
+type outboxDriver struct {
+	rows [][]driver.Value
+}
+
+func (d *outboxDriver) Open(name string) (driver.Conn, error)            { return &outboxConn{d: d}, nil }
+func (d *outboxDriver) Connect(ctx context.Context) (driver.Conn, error) { return d.Open("") }
+func (d *outboxDriver) Driver() driver.Driver                            { return d }
+
+type outboxConn struct {
+	d *outboxDriver
+}
+
+func (c *outboxConn) Prepare(query string) (driver.Stmt, error) { return &outboxStmt{d: c.d}, nil }
+func (c *outboxConn) Close() error                              { return nil }
+func (c *outboxConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not supported") }
+
+type outboxStmt struct {
+	d *outboxDriver
+}
+
+func (s *outboxStmt) Close() error  { return nil }
+func (s *outboxStmt) NumInput() int { return 2 }
+func (s *outboxStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (s *outboxStmt) Query(args []driver.Value) (driver.Rows, error) {
+	position, limit := args[0].(string), args[1].(int64)
+	rows := &outboxRows{}
+	for _, row := range s.d.rows {
+		if row[0].(string) > position && int64(len(rows.rows)) < limit {
+			rows.rows = append(rows.rows, row)
+		}
+	}
+	return rows, nil
+}
+
+type outboxRows struct {
+	rows [][]driver.Value
+}
+
+func (r *outboxRows) Columns() []string { return []string{"id", "key", "value"} }
+func (r *outboxRows) Close() error      { return nil }
+func (r *outboxRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestOutbox(t *testing.T) {
+	drv := &outboxDriver{rows: [][]driver.Value{
+		{"1", "a", []byte("1")},
+		{"2", "b", []byte("2")},
+		{"3", "c", nil},
+	}}
+	db := sql.OpenDB(drv)
+	defer db.Close()
+
+	src := NewOutbox(db, "SELECT id, key, value FROM outbox WHERE id > $1 ORDER BY id LIMIT $2", WithOutboxBatchSize(2))
+	test.AssertNil(t, src.Open(context.Background(), ""))
+
+	msgs, err := src.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(msgs), 2)
+	test.AssertEqual(t, msgs[0].Key, "a")
+	test.AssertEqual(t, msgs[0].Value, []byte("1"))
+	test.AssertEqual(t, msgs[1].Position, "2")
+
+	msgs, err = src.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(msgs), 1)
+	test.AssertEqual(t, msgs[0].Key, "c")
+	test.AssertEqual(t, msgs[0].Value, []byte(nil))
+
+	msgs, err = src.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(msgs), 0)
+
+	// reopening continues at the position
+	test.AssertNil(t, src.Open(context.Background(), "1"))
+	msgs, err = src.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, msgs[0].Key, "b")
+}
@@ -0,0 +1,58 @@
+// Package source emits the messages of external systems into Kafka, e.g. to publish
+// the rows of a database outbox table or the lines appended to a file.
+//
+// A Source is polled for new messages by a Connector, which emits them with a goka
+// Emitter. After the messages of a poll were emitted, the connector stores the position
+// of the last message with a Checkpointer, e.g. goka.Checkpoints. When restarted, the
+// source is opened at the stored position, so every message is emitted at least once:
+//
+//	checkpoints, err := goka.NewCheckpoints(brokers, "source-checkpoints")
+//	...
+//	emitter, err := goka.NewEmitter(brokers, "orders", new(codec.Bytes))
+//	...
+//	conn, err := source.NewConnector("orders-outbox",
+//		source.NewOutbox(db, "SELECT id, key, value FROM outbox WHERE id > $1 ORDER BY id LIMIT $2"),
+//		emitter, checkpoints)
+//	...
+//	err = conn.Run(ctx)
+package source
+
+import (
+	"context"
+
+	"github.com/lovoo/goka"
+)
+
+// Message is a message read from a source.
+type Message struct {
+	Key string
+	// Value is encoded with the codec of the connector's emitter.
+	Value   interface{}
+	Headers goka.Headers
+	// Position is the position of the source after this message. The connector
+	// stores the position of the last message of each poll, empty positions are not stored.
+	Position string
+	// Done is called, if set, when the message was emitted and its position stored,
+	// or with the error if emitting failed.
+	Done func(error)
+}
+
+// Source is an external system read by a Connector. The methods are called by one
+// goroutine at a time.
+type Source interface {
+	// Open prepares reading from the position, which is empty if no position
+	// was stored yet.
+	Open(ctx context.Context, position string) error
+	// Poll returns the next messages. It returns no messages if there are none
+	// available, in which case the connector polls again after its poll interval.
+	Poll(ctx context.Context) ([]*Message, error)
+	// Close closes the source.
+	Close() error
+}
+
+// Checkpointer stores the positions of the connectors by name.
+// It is implemented by goka.Checkpoints.
+type Checkpointer interface {
+	Get(name string) (string, bool, error)
+	Set(name string, value string) error
+}
@@ -0,0 +1,121 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+// webhookPollTimeout is the maximum time a poll waits for a request
+const webhookPollTimeout = time.Second
+
+// WebhookMessage is a message in the body of a webhook request.
+type WebhookMessage struct {
+	Key string `json:"key"`
+	// Value is passed as []byte to the emitter, so the emitter should use codec.Bytes.
+	Value   json.RawMessage   `json:"value"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// webhookRequest is a received request waiting for its messages to be emitted
+type webhookRequest struct {
+	msgs []*WebhookMessage
+	done chan error
+}
+
+// Webhook receives messages as JSON array of WebhookMessages posted to its handler.
+// The handler responds after the messages were emitted, with status 200 or 502 if
+// emitting failed, so the clients can retry. The messages have no position.
+type Webhook struct {
+	requests chan *webhookRequest
+}
+
+// NewWebhook creates a webhook source. Its handler must be registered with an HTTP server.
+func NewWebhook() *Webhook {
+	return &Webhook{
+		requests: make(chan *webhookRequest),
+	}
+}
+
+// ServeHTTP receives the messages of a POST request and waits until they were emitted.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req := &webhookRequest{done: make(chan error, 1)}
+	if err := json.NewDecoder(r.Body).Decode(&req.msgs); err != nil {
+		http.Error(rw, fmt.Sprintf("invalid messages: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.msgs) == 0 {
+		return
+	}
+
+	select {
+	case <-r.Context().Done():
+		return
+	case w.requests <- req:
+	}
+
+	select {
+	case <-r.Context().Done():
+	case err := <-req.done:
+		if err != nil {
+			http.Error(rw, fmt.Sprintf("error emitting messages: %v", err), http.StatusBadGateway)
+		}
+	}
+}
+
+// Open does nothing.
+func (w *Webhook) Open(ctx context.Context, position string) error {
+	return nil
+}
+
+// Poll waits for a request and returns its messages and the messages of further
+// pending requests.
+func (w *Webhook) Poll(ctx context.Context) ([]*Message, error) {
+	var msgs []*Message
+	add := func(req *webhookRequest) {
+		for _, wm := range req.msgs {
+			msg := &Message{
+				Key:   wm.Key,
+				Value: []byte(wm.Value),
+			}
+			if len(wm.Headers) > 0 {
+				msg.Headers = make(goka.Headers, len(wm.Headers))
+				for key, value := range wm.Headers {
+					msg.Headers[key] = []byte(value)
+				}
+			}
+			msgs = append(msgs, msg)
+		}
+		msgs[len(msgs)-1].Done = func(err error) { req.done <- err }
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, nil
+	case <-time.After(webhookPollTimeout):
+		return nil, nil
+	case req := <-w.requests:
+		add(req)
+	}
+	for {
+		select {
+		case req := <-w.requests:
+			add(req)
+		default:
+			return msgs, nil
+		}
+	}
+}
+
+// Close does nothing.
+func (w *Webhook) Close() error {
+	return nil
+}
@@ -0,0 +1,61 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestWebhook(t *testing.T) {
+	hook := NewWebhook()
+	srv := httptest.NewServer(hook)
+	defer srv.Close()
+
+	post := func(body string) chan int {
+		status := make(chan int, 1)
+		go func() {
+			resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+			if err != nil {
+				t.Errorf("error posting: %v", err)
+				status <- 0
+				return
+			}
+			resp.Body.Close()
+			status <- resp.StatusCode
+		}()
+		return status
+	}
+
+	status := post(`[{"key":"a","value":{"n":1},"headers":{"h":"v"}},{"key":"b","value":null}]`)
+	msgs, err := hook.Poll(context.Background())
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(msgs), 2)
+	test.AssertEqual(t, msgs[0].Key, "a")
+	test.AssertEqual(t, string(msgs[0].Value.([]byte)), `{"n":1}`)
+	test.AssertEqual(t, string(msgs[0].Headers["h"]), "v")
+	test.AssertTrue(t, msgs[0].Done == nil)
+
+	// the request is answered when the messages were emitted
+	msgs[1].Done(nil)
+	test.AssertEqual(t, <-status, http.StatusOK)
+
+	status = post(`[{"key":"c","value":1}]`)
+	msgs, err = hook.Poll(context.Background())
+	test.AssertNil(t, err)
+	msgs[0].Done(errors.New("emit failed"))
+	test.AssertEqual(t, <-status, http.StatusBadGateway)
+
+	test.AssertEqual(t, <-post(`{"key":"c"}`), http.StatusBadRequest)
+
+	// polls without requests return no messages
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	msgs, err = hook.Poll(ctx)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, len(msgs), 0)
+}
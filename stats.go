@@ -40,6 +40,15 @@ type InputStats struct {
 	OffsetLag  int64
 	LastOffset int64
 	Delay      time.Duration
+	// ProcessingTime is the time spent decoding and processing the messages in the callback
+	ProcessingTime time.Duration
+	// TooOld is the number of messages skipped or forwarded for being too old, see WithMaxMessageAge
+	TooOld uint
+	// Shed is the number of messages skipped for exceeding the latency budget, see WithLatencyBudget
+	Shed uint
+	// Share is the recent share of the partition's processing time used by the topic.
+	// It is only tracked if the processor has input quotas, see WithInputQuota.
+	Share float64
 }
 
 // OutputStats represents the number of messages and the number of bytes emitted
@@ -47,6 +56,8 @@ type InputStats struct {
 type OutputStats struct {
 	Count uint
 	Bytes int
+	// Rejected is the number of messages rejected by an output validator
+	Rejected uint
 }
 
 // PartitionProcStats represents metrics and measurements of a partition processor
@@ -59,6 +70,21 @@ type PartitionProcStats struct {
 
 	Input  map[string]*InputStats
 	Output map[string]*OutputStats
+
+	// ProcessingTime is the time spent decoding and processing input messages in the
+	// callbacks. Compare it across partitions to find hot partitions.
+	ProcessingTime time.Duration
+	// Backlog is the number of input messages queued for processing
+	Backlog int
+	// BacklogBytes approximates the memory of the queued input messages by their average size
+	BacklogBytes int64
+	// StorageMemory approximates the memory used by the storages of the group table and
+	// joined tables, see TableStats.StorageMemory
+	StorageMemory int64
+
+	// HotKeys are the keys receiving at least the minimum share of the input messages
+	// configured with WithHotKeyDetection, most frequent first
+	HotKeys []HotKey
 }
 
 // RecoveryStats groups statistics during recovery
@@ -80,6 +106,13 @@ type TableStats struct {
 
 	Recovery *RecoveryStats
 
+	// Retention of the table topic after which values expire, 0 if they don't expire
+	Retention time.Duration
+
+	// StorageMemory approximates the memory used by the storage, e.g. the block cache
+	// of LevelDB. It is 0 if the storage does not implement storage.MemoryReporter.
+	StorageMemory int64
+
 	Input  *InputStats
 	Writes *OutputStats
 }
@@ -168,10 +201,12 @@ func (ts *TableStats) reset() {
 
 func (ts *TableStats) clone() *TableStats {
 	return &TableStats{
-		Input:    ts.Input.clone(),
-		Writes:   ts.Writes.clone(),
-		Recovery: ts.Recovery.clone(),
-		Stalled:  ts.Stalled,
+		Input:         ts.Input.clone(),
+		Writes:        ts.Writes.clone(),
+		Recovery:      ts.Recovery.clone(),
+		Stalled:       ts.Stalled,
+		Retention:     ts.Retention,
+		StorageMemory: ts.StorageMemory,
 	}
 }
 
@@ -181,6 +216,7 @@ func (s *PartitionProcStats) clone() *PartitionProcStats {
 	pps.Joined = make(map[string]*TableStats)
 	pps.Input = inputStatsMap(s.Input).clone()
 	pps.Output = outputStatsMap(s.Output).clone()
+	pps.ProcessingTime = s.ProcessingTime
 
 	return pps
 }
@@ -195,9 +231,23 @@ func (s *PartitionProcStats) trackOutput(topic string, valueLen int) {
 	outStats.Bytes += valueLen
 }
 
+func (s *PartitionProcStats) trackRejectedOutput(topic string) {
+	outStats := s.Output[topic]
+	if outStats == nil {
+		log.Printf("no out stats for topic %s", topic)
+		return
+	}
+	outStats.Rejected++
+}
+
 // ViewStats represents the metrics of all partitions of a view.
 type ViewStats struct {
 	Partitions map[int32]*TableStats
+
+	// Lookups is the number of values requested with Get, Hits the number of those
+	// that existed. Both count since the view was created.
+	Lookups int64
+	Hits    int64
 }
 
 func newViewStats() *ViewStats {
@@ -0,0 +1,216 @@
+// Package badger provides a storage backed by Badger, an LSM tree with a separate
+// value log, which suits write-heavy tables better than LevelDB:
+//
+//	goka.WithStorageBuilder(badger.BadgerBuilder("/var/lib/goka"))
+//
+// The package is a separate module, so applications not using Badger don't depend on it.
+package badger
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/lovoo/goka/storage"
+)
+
+const (
+	offsetKey = "__offset"
+	// gcInterval is the interval of the value log garbage collection
+	gcInterval = 5 * time.Minute
+	// gcDiscardRatio is the ratio of stale data at which a value log file is rewritten
+	gcDiscardRatio = 0.5
+)
+
+type badgerStorage struct {
+	// offset is the offset set during recovery, which is written on MarkRecovered
+	offset    int64
+	recovered chan struct{}
+	close     chan struct{}
+	closeWg   sync.WaitGroup
+
+	db *badger.DB
+}
+
+// New creates a new Storage backed by the Badger database.
+func New(db *badger.DB) (storage.Storage, error) {
+	if db == nil {
+		return nil, errors.New("invalid badger database")
+	}
+	return &badgerStorage{
+		db:        db,
+		recovered: make(chan struct{}),
+		close:     make(chan struct{}),
+	}, nil
+}
+
+func (s *badgerStorage) Has(key string) (bool, error) {
+	err := s.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte(key))
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error checking for existence in badger (key %s): %v", key, err)
+	}
+	return true, nil
+}
+
+func (s *badgerStorage) Get(key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		value, err = item.ValueCopy(nil)
+		return err
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting from badger (key %s): %v", key, err)
+	}
+	// distinguish empty values from missing keys
+	if value == nil {
+		value = []byte{}
+	}
+	return value, nil
+}
+
+func (s *badgerStorage) Set(key string, value []byte) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(key), value)
+	})
+	if err != nil {
+		return fmt.Errorf("error setting to badger (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *badgerStorage) Delete(key string) error {
+	err := s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting from badger (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *badgerStorage) GetOffset(defValue int64) (int64, error) {
+	// during the recovery the local offset is newer than the stored one
+	select {
+	case <-s.recovered:
+	default:
+		if offset := atomic.LoadInt64(&s.offset); offset != 0 {
+			return offset, nil
+		}
+	}
+
+	data, err := s.Get(offsetKey)
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return defValue, nil
+	}
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding offset: %w (%v)", storage.ErrCorrupted, err)
+	}
+	return value, nil
+}
+
+func (s *badgerStorage) putOffset(offset int64) error {
+	return s.Set(offsetKey, []byte(strconv.FormatInt(offset, 10)))
+}
+
+// SetOffset stores the offset. During the recovery, the offset is only written
+// when the storage is marked as recovered or closed.
+func (s *badgerStorage) SetOffset(offset int64) error {
+	atomic.StoreInt64(&s.offset, offset)
+
+	select {
+	case <-s.recovered:
+		return s.putOffset(offset)
+	default:
+	}
+	return nil
+}
+
+func (s *badgerStorage) MarkRecovered() error {
+	if offset := atomic.LoadInt64(&s.offset); offset != 0 {
+		if err := s.putOffset(offset); err != nil {
+			return err
+		}
+	}
+	close(s.recovered)
+	return nil
+}
+
+func (s *badgerStorage) Iterator() (storage.Iterator, error) {
+	return s.newIterator(nil, nil), nil
+}
+
+// IteratorWithRange iterates the range [start, limit). If limit is empty, it
+// iterates the keys with the prefix start.
+func (s *badgerStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
+	if len(limit) == 0 {
+		return s.newIterator(start, nil), nil
+	}
+	it := s.newIterator(nil, limit)
+	it.start = start
+	return it, nil
+}
+
+// Open starts the garbage collection of the value log.
+func (s *badgerStorage) Open() error {
+	s.closeWg.Add(1)
+	go func() {
+		defer s.closeWg.Done()
+		ticker := time.NewTicker(gcInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.close:
+				return
+			case <-ticker.C:
+				s.collectGarbage()
+			}
+		}
+	}()
+	return nil
+}
+
+// collectGarbage rewrites value log files until there is nothing left to collect
+func (s *badgerStorage) collectGarbage() {
+	for s.db.RunValueLogGC(gcDiscardRatio) == nil {
+	}
+}
+
+// CompactNow compacts the LSM tree into one level and collects the garbage of the value log.
+func (s *badgerStorage) CompactNow() error {
+	if err := s.db.Flatten(1); err != nil {
+		return fmt.Errorf("error compacting badger: %v", err)
+	}
+	s.collectGarbage()
+	return nil
+}
+
+func (s *badgerStorage) Close() error {
+	close(s.close)
+	s.closeWg.Wait()
+	if offset := atomic.LoadInt64(&s.offset); offset != 0 {
+		if err := s.putOffset(offset); err != nil {
+			s.db.Close()
+			return err
+		}
+	}
+	return s.db.Close()
+}
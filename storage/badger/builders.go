@@ -0,0 +1,27 @@
+package badger
+
+import (
+	"fmt"
+	"path/filepath"
+
+	badger "github.com/dgraph-io/badger/v4"
+	"github.com/lovoo/goka/storage"
+)
+
+// BadgerBuilder builds Badger storages with the default options in the given path.
+func BadgerBuilder(path string) storage.Builder {
+	return BuilderWithOptions(path, badger.DefaultOptions("").WithLogger(nil))
+}
+
+// BuilderWithOptions builds Badger storages with the given options in the given path.
+// The directories of the options are replaced by the directory of each partition.
+func BuilderWithOptions(path string, opts badger.Options) storage.Builder {
+	return func(topic string, partition int32) (storage.Storage, error) {
+		dir := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		db, err := badger.Open(opts.WithDir(dir).WithValueDir(dir))
+		if err != nil {
+			return nil, fmt.Errorf("error opening badger %s: %v", dir, err)
+		}
+		return New(db)
+	}
+}
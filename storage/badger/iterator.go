@@ -0,0 +1,108 @@
+package badger
+
+import (
+	"bytes"
+
+	badger "github.com/dgraph-io/badger/v4"
+)
+
+// iterator iterates a read-only transaction, skipping the offset key
+type iterator struct {
+	txn  *badger.Txn
+	iter *badger.Iterator
+	// start is the first key and limit the first key not iterated anymore, if set
+	start []byte
+	limit []byte
+
+	started  bool
+	seeked   bool
+	released bool
+}
+
+func (s *badgerStorage) newIterator(prefix, limit []byte) *iterator {
+	txn := s.db.NewTransaction(false)
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	return &iterator{
+		txn:   txn,
+		iter:  txn.NewIterator(opts),
+		limit: limit,
+	}
+}
+
+func (i *iterator) valid() bool {
+	if i.released || !i.iter.Valid() {
+		return false
+	}
+	return i.limit == nil || bytes.Compare(i.iter.Item().Key(), i.limit) < 0
+}
+
+// skipOffset moves the iterator behind the offset key
+func (i *iterator) skipOffset() {
+	if i.iter.Valid() && string(i.iter.Item().Key()) == offsetKey {
+		i.iter.Next()
+	}
+}
+
+func (i *iterator) Next() bool {
+	if i.released {
+		return false
+	}
+	switch {
+	case i.seeked:
+		// the seeked key is the current one
+		i.seeked = false
+	case !i.started:
+		if i.start != nil {
+			i.iter.Seek(i.start)
+		} else {
+			i.iter.Rewind()
+		}
+	default:
+		i.iter.Next()
+	}
+	i.started = true
+	i.skipOffset()
+	return i.valid()
+}
+
+func (i *iterator) Err() error {
+	return nil
+}
+
+func (i *iterator) Key() []byte {
+	if !i.started || !i.valid() {
+		return nil
+	}
+	return i.iter.Item().Key()
+}
+
+func (i *iterator) Value() ([]byte, error) {
+	if !i.started || !i.valid() {
+		return nil, nil
+	}
+	return i.iter.Item().ValueCopy(nil)
+}
+
+func (i *iterator) Release() {
+	if i.released {
+		return
+	}
+	i.released = true
+	i.iter.Close()
+	i.txn.Discard()
+}
+
+func (i *iterator) Seek(key []byte) bool {
+	if i.released {
+		return false
+	}
+	if i.start != nil && bytes.Compare(key, i.start) < 0 {
+		key = i.start
+	}
+	i.iter.Seek(key)
+	i.skipOffset()
+	i.started = true
+	i.seeked = true
+	return i.valid()
+}
@@ -0,0 +1,106 @@
+package storage
+
+// BatchOp is a write of a batch. A nil value deletes the key.
+type BatchOp struct {
+	Key   string
+	Value []byte
+}
+
+// Batch collects writes to apply them to a storage at once, see SetBatch.
+type Batch struct {
+	ops []BatchOp
+	// index of the last write of each key
+	index map[string]int
+}
+
+// NewBatch returns an empty batch.
+func NewBatch() *Batch {
+	return &Batch{
+		index: make(map[string]int),
+	}
+}
+
+// Set adds a write of the key-value pair.
+func (b *Batch) Set(key string, value []byte) {
+	b.index[key] = len(b.ops)
+	b.ops = append(b.ops, BatchOp{Key: key, Value: value})
+}
+
+// Delete adds a deletion of the key.
+func (b *Batch) Delete(key string) {
+	b.Set(key, nil)
+}
+
+// Get returns the value of the last write of the key in the batch and whether the
+// batch contains a write of the key. The value is nil if the key was deleted.
+func (b *Batch) Get(key string) ([]byte, bool) {
+	i, ok := b.index[key]
+	if !ok {
+		return nil, false
+	}
+	return b.ops[i].Value, true
+}
+
+// Ops returns the writes in the order they were added.
+func (b *Batch) Ops() []BatchOp {
+	return b.ops
+}
+
+// Len returns the number of writes.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Truncate removes the writes after the first n, e.g. to discard the writes of a failed
+// update. Reads of the truncated keys return their last write before.
+func (b *Batch) Truncate(n int) {
+	if n < 0 || n >= len(b.ops) {
+		return
+	}
+	truncated := make(map[string]bool)
+	for _, op := range b.ops[n:] {
+		truncated[op.Key] = true
+		delete(b.index, op.Key)
+	}
+	b.ops = b.ops[:n]
+	for i, op := range b.ops {
+		if truncated[op.Key] {
+			b.index[op.Key] = i
+		}
+	}
+}
+
+// Reset removes all writes, so the batch can be reused.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+	for key := range b.index {
+		delete(b.index, key)
+	}
+}
+
+// Batcher is implemented by storages that write a batch faster than its writes one by
+// one, e.g. in a single LevelDB write.
+type Batcher interface {
+	// SetBatch applies the writes of the batch atomically.
+	SetBatch(b *Batch) error
+}
+
+// SetBatch applies the writes of the batch to the storage, at once if it implements
+// Batcher, otherwise one by one.
+func SetBatch(st Storage, b *Batch) error {
+	if batcher, ok := st.(Batcher); ok {
+		return batcher.SetBatch(b)
+	}
+	for _, op := range b.ops {
+		var err error
+		if op.Value == nil {
+			err = st.Delete(op.Key)
+		} else {
+			err = st.Set(op.Key, op.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
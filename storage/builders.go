@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
@@ -19,7 +20,7 @@ func DefaultBuilder(path string) Builder {
 		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
 		db, err := leveldb.OpenFile(fp, nil)
 		if err != nil {
-			return nil, fmt.Errorf("error opening leveldb: %v", err)
+			return nil, openError(fp, err)
 		}
 		return New(db)
 	}
@@ -32,12 +33,20 @@ func BuilderWithOptions(path string, opts *opt.Options) Builder {
 		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
 		db, err := leveldb.OpenFile(fp, opts)
 		if err != nil {
-			return nil, fmt.Errorf("error opening leveldb: %v", err)
+			return nil, openError(fp, err)
 		}
 		return New(db)
 	}
 }
 
+// openError wraps ErrCorrupted if the LevelDB failed to open because it is corrupted.
+func openError(path string, err error) error {
+	if errors.IsCorrupted(err) {
+		return fmt.Errorf("error opening leveldb %s: %w (%v)", path, ErrCorrupted, err)
+	}
+	return fmt.Errorf("error opening leveldb: %v", err)
+}
+
 // MemoryBuilder builds in-memory storage.
 func MemoryBuilder() Builder {
 	return func(topic string, partition int32) (Storage, error) {
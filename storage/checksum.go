@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+const checksumSize = 4
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksumMismatch is wrapped by the errors of checksum storages reading a
+// value that does not match its checksum. It wraps ErrCorrupted.
+var ErrChecksumMismatch = fmt.Errorf("checksum mismatch: %w", ErrCorrupted)
+
+// checksum stores a CRC-32C checksum with each value and verifies it on read.
+type checksum struct {
+	Storage
+	verifyOnOpen bool
+}
+
+// NewChecksum wraps the storage to store a CRC-32C checksum with each value and
+// verify it on read, so silent corruption of the local storage is reported as
+// an error wrapping ErrChecksumMismatch instead of returning a broken value.
+// If verifyOnOpen is set, all values are verified when opening the storage, so a
+// corrupted storage fails to open and can be rebuilt from the table topic.
+//
+// The checksums change the format of the stored values, so the wrapped storage
+// must be empty when enabling or disabling checksums.
+func NewChecksum(st Storage, verifyOnOpen bool) Storage {
+	return &checksum{
+		Storage:      st,
+		verifyOnOpen: verifyOnOpen,
+	}
+}
+
+// ChecksumBuilder wraps the storages created by builder with NewChecksum.
+func ChecksumBuilder(builder Builder, verifyOnOpen bool) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewChecksum(st, verifyOnOpen), nil
+	}
+}
+
+func (c *checksum) Open() error {
+	if err := c.Storage.Open(); err != nil {
+		return err
+	}
+	if c.verifyOnOpen {
+		return c.Verify()
+	}
+	return nil
+}
+
+// Verify checks the checksums of all values in the storage.
+func (c *checksum) Verify() error {
+	iter, err := c.Iterator()
+	if err != nil {
+		return err
+	}
+	defer iter.Release()
+
+	for iter.Next() {
+		if _, err := iter.Value(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+func (c *checksum) Get(key string) ([]byte, error) {
+	data, err := c.Storage.Get(key)
+	if err != nil || data == nil {
+		return data, err
+	}
+	return verifyChecksum(key, data)
+}
+
+func (c *checksum) Set(key string, value []byte) error {
+	data := make([]byte, checksumSize+len(value))
+	binary.BigEndian.PutUint32(data, crc32.Checksum(value, crcTable))
+	copy(data[checksumSize:], value)
+	return c.Storage.Set(key, data)
+}
+
+func (c *checksum) Iterator() (Iterator, error) {
+	iter, err := c.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &checksumIterator{iter}, nil
+}
+
+func (c *checksum) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	iter, err := c.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &checksumIterator{iter}, nil
+}
+
+// CompactNow compacts the wrapped storage if it is Compactable.
+func (c *checksum) CompactNow() error {
+	if st, ok := c.Storage.(Compactable); ok {
+		return st.CompactNow()
+	}
+	return nil
+}
+
+// MemoryUsage returns the memory used by the wrapped storage if it is a MemoryReporter.
+func (c *checksum) MemoryUsage() int64 {
+	if st, ok := c.Storage.(MemoryReporter); ok {
+		return st.MemoryUsage()
+	}
+	return 0
+}
+
+// Snapshot snapshots the wrapped storage if it is a Snapshotter. The copy contains the
+// wrapped values, so it has to be opened with the same wrapper.
+func (c *checksum) Snapshot(dir string) (int64, error) {
+	if st, ok := c.Storage.(Snapshotter); ok {
+		return st.Snapshot(dir)
+	}
+	return 0, ErrNoSnapshots
+}
+
+// verifyChecksum returns the value without its checksum or an error if they
+// don't match.
+func verifyChecksum(key string, data []byte) ([]byte, error) {
+	if len(data) < checksumSize {
+		return nil, fmt.Errorf("error reading key %s: %w (value too short)", key, ErrChecksumMismatch)
+	}
+	value := data[checksumSize:]
+	if binary.BigEndian.Uint32(data) != crc32.Checksum(value, crcTable) {
+		return nil, fmt.Errorf("error reading key %s: %w", key, ErrChecksumMismatch)
+	}
+	return value, nil
+}
+
+type checksumIterator struct {
+	Iterator
+}
+
+func (i *checksumIterator) Value() ([]byte, error) {
+	data, err := i.Iterator.Value()
+	if err != nil || data == nil {
+		return data, err
+	}
+	return verifyChecksum(string(i.Key()), data)
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestChecksum(t *testing.T) {
+	t.Run("get-set", func(t *testing.T) {
+		mem := NewMemory()
+		st := NewChecksum(mem, false)
+		test.AssertNil(t, st.Open())
+
+		test.AssertNil(t, st.Set("key", []byte("value")))
+		value, err := st.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value")
+
+		// the wrapped storage contains the checksum
+		raw, err := mem.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, len(raw), checksumSize+len("value"))
+
+		value, err = st.Get("not-existing")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, value == nil)
+	})
+
+	t.Run("corrupted", func(t *testing.T) {
+		mem := NewMemory()
+		st := NewChecksum(mem, false)
+		test.AssertNil(t, st.Open())
+		test.AssertNil(t, st.Set("key", []byte("value")))
+
+		raw, _ := mem.Get("key")
+		broken := append([]byte(nil), raw...)
+		broken[len(broken)-1] = 'X'
+		test.AssertNil(t, mem.Set("key", broken))
+
+		_, err := st.Get("key")
+		test.AssertTrue(t, errors.Is(err, ErrChecksumMismatch))
+		test.AssertTrue(t, errors.Is(err, ErrCorrupted))
+
+		test.AssertNil(t, mem.Set("short", []byte{1}))
+		_, err = st.Get("short")
+		test.AssertTrue(t, errors.Is(err, ErrChecksumMismatch))
+	})
+
+	t.Run("iterator", func(t *testing.T) {
+		mem := NewMemory()
+		st := NewChecksum(mem, false)
+		test.AssertNil(t, st.Open())
+		test.AssertNil(t, st.Set("key-1", []byte("value-1")))
+		test.AssertNil(t, st.Set("key-2", []byte("value-2")))
+		test.AssertNil(t, mem.Set("key-3", []byte("no checksum")))
+
+		iter, err := st.Iterator()
+		test.AssertNil(t, err)
+		defer iter.Release()
+
+		values := make(map[string]string)
+		var errs int
+		for iter.Next() {
+			value, err := iter.Value()
+			if err != nil {
+				test.AssertTrue(t, errors.Is(err, ErrChecksumMismatch))
+				errs++
+				continue
+			}
+			values[string(iter.Key())] = string(value)
+		}
+		test.AssertEqual(t, values, map[string]string{"key-1": "value-1", "key-2": "value-2"})
+		test.AssertEqual(t, errs, 1)
+	})
+
+	t.Run("verify-on-open", func(t *testing.T) {
+		mem := NewMemory()
+		test.AssertNil(t, NewChecksum(mem, false).Set("key", []byte("value")))
+		test.AssertNil(t, NewChecksum(mem, true).Open())
+
+		test.AssertNil(t, mem.Set("key", []byte("broken")))
+		err := NewChecksum(mem, true).Open()
+		test.AssertTrue(t, errors.Is(err, ErrCorrupted))
+	})
+}
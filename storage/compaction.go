@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Compactable is implemented by storages that can be compacted on demand, e.g.
+// to compact outside of peak hours instead of relying on the storage to compact
+// while it is written to.
+type Compactable interface {
+	// CompactNow compacts the whole storage. It blocks until the compaction is done.
+	CompactNow() error
+}
+
+// CompactNow compacts the whole key range of the LevelDB.
+func (s *storage) CompactNow() error {
+	if err := s.db.CompactRange(util.Range{}); err != nil {
+		return fmt.Errorf("error compacting leveldb: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrCorrupted is wrapped by the errors of storages whose data is corrupted, e.g.
+// a LevelDB that fails to open because of a broken manifest or an offset that
+// cannot be decoded. Check with errors.Is(err, storage.ErrCorrupted).
+var ErrCorrupted = errors.New("storage is corrupted")
+
+// Remover deletes the storage of a topic partition, so it can be rebuilt from
+// scratch by the Builder of the storage.
+type Remover func(topic string, partition int32) error
+
+// DefaultRemover deletes LevelDB storages created by DefaultBuilder or
+// BuilderWithOptions in the given path.
+func DefaultRemover(path string) Remover {
+	return func(topic string, partition int32) error {
+		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		if err := os.RemoveAll(fp); err != nil {
+			return fmt.Errorf("error removing leveldb %s: %v", fp, err)
+		}
+		return nil
+	}
+}
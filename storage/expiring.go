@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const timestampSize = 8
+
+// TimestampSetter is implemented by storages storing the time a value was
+// written, e.g. the timestamp of the message the value was recovered from.
+type TimestampSetter interface {
+	// SetAt stores a key-value pair written at ts.
+	SetAt(key string, value []byte, ts time.Time) error
+}
+
+// Expirable is implemented by storages expiring keys after a retention, see NewExpiring.
+type Expirable interface {
+	// Retention returns how long keys are kept after they were written.
+	Retention() time.Duration
+	// ExpiredKeys returns the keys that were written before the retention.
+	ExpiredKeys() ([]string, error)
+}
+
+// expiring stores the time of writing with each value and hides values older
+// than the retention.
+type expiring struct {
+	Storage
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewExpiring wraps the storage to store the time a value was written with each
+// value and to treat values older than retention as deleted. It matches tables
+// stored in topics with cleanup.policy=compact,delete, where Kafka deletes values
+// older than the topic's retention.ms. Use SetAt to store a value with the timestamp
+// of its message, Set stores it with the current time.
+// Expired values are not returned by Get, Has and the iterators, but stay in the
+// wrapped storage until they are overwritten or deleted, e.g. by deleting the keys
+// returned by ExpiredKeys.
+//
+// The timestamps change the format of the stored values, so the wrapped storage
+// must be empty when enabling or disabling expiry.
+func NewExpiring(st Storage, retention time.Duration) Storage {
+	return &expiring{
+		Storage:   st,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// ExpiringBuilder wraps the storages created by builder with NewExpiring.
+func ExpiringBuilder(builder Builder, retention time.Duration) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewExpiring(st, retention), nil
+	}
+}
+
+// Retention returns how long keys are kept after they were written.
+func (e *expiring) Retention() time.Duration {
+	return e.retention
+}
+
+func (e *expiring) expired(ts time.Time) bool {
+	return e.now().Sub(ts) > e.retention
+}
+
+func (e *expiring) Has(key string) (bool, error) {
+	value, err := e.Get(key)
+	return value != nil, err
+}
+
+func (e *expiring) Get(key string) ([]byte, error) {
+	data, err := e.Storage.Get(key)
+	if err != nil || data == nil {
+		return data, err
+	}
+	value, ts, err := decodeTimestamp(key, data)
+	if err != nil || e.expired(ts) {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (e *expiring) Set(key string, value []byte) error {
+	return e.SetAt(key, value, e.now())
+}
+
+// SetAt stores the value written at ts. Values that are already expired are deleted.
+func (e *expiring) SetAt(key string, value []byte, ts time.Time) error {
+	if ts.IsZero() {
+		ts = e.now()
+	}
+	if e.expired(ts) {
+		return e.Storage.Delete(key)
+	}
+	data := make([]byte, timestampSize+len(value))
+	binary.BigEndian.PutUint64(data, uint64(ts.UnixNano()/int64(time.Millisecond)))
+	copy(data[timestampSize:], value)
+	return e.Storage.Set(key, data)
+}
+
+// ExpiredKeys returns the keys that were written before the retention.
+func (e *expiring) ExpiredKeys() ([]string, error) {
+	iter, err := e.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+
+	var keys []string
+	for iter.Next() {
+		data, err := iter.Value()
+		if err != nil {
+			return nil, err
+		}
+		_, ts, err := decodeTimestamp(string(iter.Key()), data)
+		if err != nil {
+			return nil, err
+		}
+		if e.expired(ts) {
+			keys = append(keys, string(iter.Key()))
+		}
+	}
+	return keys, iter.Err()
+}
+
+func (e *expiring) Iterator() (Iterator, error) {
+	iter, err := e.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &expiringIterator{Iterator: iter, e: e}, nil
+}
+
+func (e *expiring) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	iter, err := e.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &expiringIterator{Iterator: iter, e: e}, nil
+}
+
+// CompactNow compacts the wrapped storage if it is Compactable.
+func (e *expiring) CompactNow() error {
+	if st, ok := e.Storage.(Compactable); ok {
+		return st.CompactNow()
+	}
+	return nil
+}
+
+// MemoryUsage returns the memory used by the wrapped storage if it is a MemoryReporter.
+func (e *expiring) MemoryUsage() int64 {
+	if st, ok := e.Storage.(MemoryReporter); ok {
+		return st.MemoryUsage()
+	}
+	return 0
+}
+
+// Snapshot snapshots the wrapped storage if it is a Snapshotter. The copy contains the
+// wrapped values, so it has to be opened with the same wrapper.
+func (e *expiring) Snapshot(dir string) (int64, error) {
+	if st, ok := e.Storage.(Snapshotter); ok {
+		return st.Snapshot(dir)
+	}
+	return 0, ErrNoSnapshots
+}
+
+// decodeTimestamp returns the value and the time it was written.
+func decodeTimestamp(key string, data []byte) ([]byte, time.Time, error) {
+	if len(data) < timestampSize {
+		return nil, time.Time{}, fmt.Errorf("error reading key %s: %w (value too short for timestamp)", key, ErrCorrupted)
+	}
+	ms := int64(binary.BigEndian.Uint64(data))
+	return data[timestampSize:], time.Unix(0, ms*int64(time.Millisecond)), nil
+}
+
+// expiringIterator skips expired values.
+type expiringIterator struct {
+	Iterator
+	e     *expiring
+	value []byte
+	err   error
+}
+
+func (i *expiringIterator) Next() bool {
+	for i.Iterator.Next() {
+		data, err := i.Iterator.Value()
+		if err != nil {
+			i.value, i.err = nil, err
+			return true
+		}
+		if data == nil {
+			i.value, i.err = nil, nil
+			return true
+		}
+		value, ts, err := decodeTimestamp(string(i.Key()), data)
+		if err != nil {
+			i.value, i.err = nil, err
+			return true
+		}
+		if i.e.expired(ts) {
+			continue
+		}
+		i.value, i.err = value, nil
+		return true
+	}
+	return false
+}
+
+func (i *expiringIterator) Value() ([]byte, error) {
+	return i.value, i.err
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestExpiring(t *testing.T) {
+	var (
+		now       = time.Unix(1000000, 0)
+		retention = time.Hour
+	)
+	newExpiring := func() (Storage, Storage) {
+		mem := NewMemory()
+		st := NewExpiring(mem, retention)
+		st.(*expiring).now = func() time.Time { return now }
+		test.AssertNil(t, st.Open())
+		return st, mem
+	}
+
+	t.Run("get-set", func(t *testing.T) {
+		st, mem := newExpiring()
+
+		test.AssertNil(t, st.Set("key", []byte("value")))
+		value, err := st.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value")
+
+		raw, err := mem.Get("key")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, len(raw), timestampSize+len("value"))
+
+		test.AssertNil(t, st.(TimestampSetter).SetAt("old", []byte("value"), now.Add(-2*retention)))
+		has, err := st.Has("old")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, has)
+		// values already expired when written are deleted
+		raw, err = mem.Get("old")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, raw == nil)
+
+		test.AssertNil(t, mem.Set("short", []byte{1}))
+		_, err = st.Get("short")
+		test.AssertTrue(t, errors.Is(err, ErrCorrupted))
+	})
+
+	t.Run("expire", func(t *testing.T) {
+		st, mem := newExpiring()
+		test.AssertNil(t, st.(TimestampSetter).SetAt("key-1", []byte("value-1"), now.Add(-30*time.Minute)))
+		test.AssertNil(t, st.Set("key-2", []byte("value-2")))
+		test.AssertNil(t, st.(TimestampSetter).SetAt("key-3", []byte("value-3"), now.Add(-50*time.Minute)))
+
+		// time passes, so key-1 and key-3 expire
+		now = now.Add(45 * time.Minute)
+		defer func() { now = now.Add(-45 * time.Minute) }()
+
+		value, err := st.Get("key-1")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, value == nil)
+
+		iter, err := st.Iterator()
+		test.AssertNil(t, err)
+		var keys []string
+		for iter.Next() {
+			value, err := iter.Value()
+			test.AssertNil(t, err)
+			keys = append(keys, string(iter.Key())+"="+string(value))
+		}
+		iter.Release()
+		test.AssertEqual(t, keys, []string{"key-2=value-2"})
+
+		expired, err := st.(Expirable).ExpiredKeys()
+		test.AssertNil(t, err)
+		test.AssertEqual(t, expired, []string{"key-1", "key-3"})
+		test.AssertEqual(t, st.(Expirable).Retention(), retention)
+
+		// the expired values stay in the wrapped storage until deleted
+		has, err := mem.Has("key-1")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, has)
+	})
+}
@@ -6,7 +6,7 @@ import (
 )
 
 // iterator wraps an Iterator implementation and handles the value decoding and
-// offset key skipping.
+// internal key skipping.
 type iterator struct {
 	iter ldbiter.Iterator
 	snap *leveldb.Snapshot
@@ -14,7 +14,7 @@ type iterator struct {
 
 func (i *iterator) Next() bool {
 	next := i.iter.Next()
-	if string(i.iter.Key()) == offsetKey {
+	for next && isInternalKey(i.iter.Key()) {
 		next = i.iter.Next()
 	}
 
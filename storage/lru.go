@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// lruEntry is a key-value pair in the recency list of the lru storage
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+// lru is an in-memory storage bounded in the number of entries and their size,
+// which evicts the least recently used entries.
+type lru struct {
+	maxEntries int
+	maxBytes   int64
+
+	m sync.Mutex
+	// recency contains the entries, the most recently used first
+	recency *list.List
+	entries map[string]*list.Element
+	// size of all keys and values, accessed atomically
+	size int64
+	// offset is an int64 once set, it is read by partition tables waiting for offsets
+	offset atomic.Value
+}
+
+// NewLRU returns an in-memory storage holding at most maxEntries entries with at most
+// maxBytes of keys and values, evicting the least recently written or read entries
+// when a bound is exceeded. A bound of 0 disables it. The most recent entry is never
+// evicted, even if it exceeds maxBytes on its own.
+//
+// Evicted keys are treated as missing, so the storage suits views acting as a cache
+// of a table, which fetch missing values elsewhere, e.g. from the table's topic. It
+// must not be used for group tables, as processors would lose their state.
+func NewLRU(maxEntries int, maxBytes int64) Storage {
+	return &lru{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		recency:    list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// LRUBuilder builds in-memory storages bounded by NewLRU, one per partition, so the
+// bounds apply to each partition.
+func LRUBuilder(maxEntries int, maxBytes int64) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		return NewLRU(maxEntries, maxBytes), nil
+	}
+}
+
+func (l *lru) Has(key string) (bool, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	_, has := l.entries[key]
+	return has, nil
+}
+
+func (l *lru) Get(key string) ([]byte, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	elem, ok := l.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	l.recency.MoveToFront(elem)
+	return elem.Value.(*lruEntry).value, nil
+}
+
+func (l *lru) Set(key string, value []byte) error {
+	if value == nil {
+		return fmt.Errorf("cannot write nil value")
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		atomic.AddInt64(&l.size, int64(len(value)-len(entry.value)))
+		entry.value = value
+		l.recency.MoveToFront(elem)
+	} else {
+		l.entries[key] = l.recency.PushFront(&lruEntry{key: key, value: value})
+		atomic.AddInt64(&l.size, int64(len(key)+len(value)))
+	}
+	l.evict()
+	return nil
+}
+
+// evict removes the least recently used entries until the bounds are met
+func (l *lru) evict() {
+	for l.recency.Len() > 1 &&
+		((l.maxEntries > 0 && l.recency.Len() > l.maxEntries) ||
+			(l.maxBytes > 0 && atomic.LoadInt64(&l.size) > l.maxBytes)) {
+		l.remove(l.recency.Back())
+	}
+}
+
+func (l *lru) remove(elem *list.Element) {
+	entry := l.recency.Remove(elem).(*lruEntry)
+	delete(l.entries, entry.key)
+	atomic.AddInt64(&l.size, -int64(len(entry.key)+len(entry.value)))
+}
+
+func (l *lru) Delete(key string) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		l.remove(elem)
+	}
+	return nil
+}
+
+// MemoryUsage returns the size of all keys and values.
+func (l *lru) MemoryUsage() int64 {
+	return atomic.LoadInt64(&l.size)
+}
+
+// Iterator returns an iterator on a snapshot of the storage in key order. Iterating
+// does not change the recency of the entries.
+func (l *lru) Iterator() (Iterator, error) {
+	return l.snapshot(func(key string) bool { return true }), nil
+}
+
+// IteratorWithRange returns an iterator on a snapshot of the keys in [start, limit).
+// If limit is empty, it iterates over the keys with the prefix start.
+func (l *lru) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	if len(limit) == 0 {
+		limit = util.BytesPrefix(start).Limit
+	}
+	return l.snapshot(func(key string) bool {
+		return bytes.Compare([]byte(key), start) >= 0 && (limit == nil || bytes.Compare([]byte(key), limit) < 0)
+	}), nil
+}
+
+func (l *lru) snapshot(include func(key string) bool) Iterator {
+	l.m.Lock()
+	defer l.m.Unlock()
+	var (
+		keys    []string
+		storage = make(map[string][]byte)
+	)
+	for key, elem := range l.entries {
+		if include(key) {
+			keys = append(keys, key)
+			storage[key] = elem.Value.(*lruEntry).value
+		}
+	}
+	sort.Strings(keys)
+	return &memiter{-1, keys, storage}
+}
+
+func (l *lru) MarkRecovered() error {
+	return nil
+}
+
+func (l *lru) SetOffset(offset int64) error {
+	l.offset.Store(offset)
+	return nil
+}
+
+func (l *lru) GetOffset(defValue int64) (int64, error) {
+	offset, ok := l.offset.Load().(int64)
+	if !ok {
+		return defValue, nil
+	}
+	return offset, nil
+}
+
+func (l *lru) Open() error {
+	return nil
+}
+
+func (l *lru) Close() error {
+	return nil
+}
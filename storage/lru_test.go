@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestLRU(t *testing.T) {
+	t.Run("max-entries", func(t *testing.T) {
+		st := NewLRU(2, 0)
+		test.AssertNil(t, st.Set("a", []byte("1")))
+		test.AssertNil(t, st.Set("b", []byte("2")))
+
+		// reading a makes b the least recently used entry
+		value, err := st.Get("a")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, value, []byte("1"))
+		test.AssertNil(t, st.Set("c", []byte("3")))
+
+		has, _ := st.Has("b")
+		test.AssertFalse(t, has)
+		value, _ = st.Get("a")
+		test.AssertEqual(t, value, []byte("1"))
+		value, _ = st.Get("c")
+		test.AssertEqual(t, value, []byte("3"))
+	})
+	t.Run("max-bytes", func(t *testing.T) {
+		st := NewLRU(0, 10)
+		test.AssertNil(t, st.Set("a", []byte("1234")))
+		test.AssertNil(t, st.Set("b", []byte("1234")))
+		test.AssertEqual(t, st.(MemoryReporter).MemoryUsage(), int64(10))
+
+		test.AssertNil(t, st.Set("c", []byte("1")))
+		has, _ := st.Has("a")
+		test.AssertFalse(t, has)
+		test.AssertEqual(t, st.(MemoryReporter).MemoryUsage(), int64(7))
+
+		// an entry exceeding the bound on its own is kept
+		test.AssertNil(t, st.Set("d", []byte("0123456789")))
+		test.AssertEqual(t, st.(MemoryReporter).MemoryUsage(), int64(11))
+		value, _ := st.Get("d")
+		test.AssertEqual(t, value, []byte("0123456789"))
+
+		test.AssertNil(t, st.Delete("d"))
+		test.AssertEqual(t, st.(MemoryReporter).MemoryUsage(), int64(0))
+	})
+	t.Run("iterator", func(t *testing.T) {
+		st := NewLRU(0, 0)
+		for _, key := range []string{"key-2", "other", "key-1"} {
+			test.AssertNil(t, st.Set(key, []byte(key)))
+		}
+		test.AssertNil(t, st.SetOffset(3))
+
+		var keys []string
+		iter, err := st.Iterator()
+		test.AssertNil(t, err)
+		for iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		test.AssertEqual(t, keys, []string{"key-1", "key-2", "other"})
+
+		keys = nil
+		iter, err = st.IteratorWithRange([]byte("key"), nil)
+		test.AssertNil(t, err)
+		for iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		test.AssertEqual(t, keys, []string{"key-1", "key-2"})
+
+		offset, err := st.GetOffset(0)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(3))
+	})
+}
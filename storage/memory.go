@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
@@ -21,7 +22,7 @@ func (i *memiter) exhausted() bool {
 
 func (i *memiter) Next() bool {
 	i.current++
-	if string(i.Key()) == offsetKey {
+	for !i.exhausted() && isInternalKey([]byte(i.keys[i.current])) {
 		i.current++
 	}
 	return !i.exhausted()
@@ -71,9 +72,12 @@ func (i *memiter) Seek(key []byte) bool {
 }
 
 type memory struct {
-	keys      []string
-	storage   map[string][]byte
-	offset    *int64
+	// size of all keys and values, accessed atomically
+	size    int64
+	keys    []string
+	storage map[string][]byte
+	// offset is an int64 once set, it is read by partition tables waiting for offsets
+	offset    atomic.Value
 	recovered bool
 }
 
@@ -100,15 +104,22 @@ func (m *memory) Set(key string, value []byte) error {
 	if value == nil {
 		return fmt.Errorf("cannot write nil value")
 	}
-	if _, exists := m.storage[key]; !exists {
+	if old, exists := m.storage[key]; !exists {
 		m.keys = append(m.keys, key)
 		sort.Strings(m.keys)
+		atomic.AddInt64(&m.size, int64(len(key)))
+	} else {
+		atomic.AddInt64(&m.size, -int64(len(old)))
 	}
+	atomic.AddInt64(&m.size, int64(len(value)))
 	m.storage[key] = value
 	return nil
 }
 
 func (m *memory) Delete(key string) error {
+	if old, exists := m.storage[key]; exists {
+		atomic.AddInt64(&m.size, -int64(len(key)+len(old)))
+	}
 	delete(m.storage, key)
 	for i, k := range m.keys {
 		if k == key {
@@ -144,7 +155,7 @@ func (m *memory) IteratorWithRange(start, limit []byte) (Iterator, error) {
 	}
 	storage := make(map[string][]byte)
 	for _, k := range m.keys {
-		if bytes.Compare([]byte(k), start) > -1 && bytes.Compare([]byte(k), limit) < 1 {
+		if bytes.Compare([]byte(k), start) > -1 && (limit == nil || bytes.Compare([]byte(k), limit) < 0) {
 			keys = append(keys, k)
 			storage[k] = m.storage[k]
 		}
@@ -153,6 +164,11 @@ func (m *memory) IteratorWithRange(start, limit []byte) (Iterator, error) {
 	return &memiter{-1, keys, storage}, nil
 }
 
+// MemoryUsage returns the size of all keys and values.
+func (m *memory) MemoryUsage() int64 {
+	return atomic.LoadInt64(&m.size)
+}
+
 func (m *memory) MarkRecovered() error {
 	return nil
 }
@@ -162,16 +178,17 @@ func (m *memory) Recovered() bool {
 }
 
 func (m *memory) SetOffset(offset int64) error {
-	m.offset = &offset
+	m.offset.Store(offset)
 	return nil
 }
 
 func (m *memory) GetOffset(defValue int64) (int64, error) {
-	if m.offset == nil {
+	offset, ok := m.offset.Load().(int64)
+	if !ok {
 		return defValue, nil
 	}
 
-	return *m.offset, nil
+	return offset, nil
 }
 
 func (m *memory) Open() error {
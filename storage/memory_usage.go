@@ -0,0 +1,24 @@
+package storage
+
+import "strconv"
+
+// MemoryReporter is implemented by storages that can report approximately how much
+// memory they use, e.g. to attribute memory to the partitions of a table.
+type MemoryReporter interface {
+	// MemoryUsage returns the approximate number of bytes of memory used by the storage.
+	MemoryUsage() int64
+}
+
+// MemoryUsage returns the size of the LevelDB block cache. It returns 0 if the
+// size cannot be read, e.g. because the storage is closed.
+func (s *storage) MemoryUsage() int64 {
+	cached, err := s.db.GetProperty("leveldb.cachedblock")
+	if err != nil {
+		return 0
+	}
+	size, err := strconv.ParseInt(cached, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return size
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func TestMemoryUsage_memory(t *testing.T) {
+	st := NewMemory()
+	mr := st.(MemoryReporter)
+	test.AssertEqual(t, mr.MemoryUsage(), int64(0))
+
+	test.AssertNil(t, st.Set("key", []byte("value")))
+	test.AssertEqual(t, mr.MemoryUsage(), int64(8))
+	test.AssertNil(t, st.Set("key", []byte("v")))
+	test.AssertEqual(t, mr.MemoryUsage(), int64(4))
+	test.AssertNil(t, st.Set("other", []byte("value")))
+	test.AssertEqual(t, mr.MemoryUsage(), int64(14))
+	test.AssertNil(t, st.Delete("key"))
+	test.AssertEqual(t, mr.MemoryUsage(), int64(10))
+	test.AssertNil(t, st.Delete("key"))
+	test.AssertEqual(t, mr.MemoryUsage(), int64(10))
+
+	// wrappers report the memory of the wrapped storage
+	test.AssertEqual(t, NewChecksum(st, false).(MemoryReporter).MemoryUsage(), int64(10))
+	test.AssertEqual(t, NewExpiring(st, time.Hour).(MemoryReporter).MemoryUsage(), int64(10))
+	test.AssertEqual(t, NewChecksum(NewNull(), false).(MemoryReporter).MemoryUsage(), int64(0))
+}
+
+func TestMemoryUsage_leveldb(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_storage_TestMemoryUsage")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	db, err := leveldb.OpenFile(path, nil)
+	test.AssertNil(t, err)
+	st, err := New(db)
+	test.AssertNil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		test.AssertNil(t, st.Set(keys[i%len(keys)], make([]byte, 1000)))
+	}
+	// flush the values to tables and read them to fill the block cache
+	test.AssertNil(t, st.(Compactable).CompactNow())
+	for _, key := range keys {
+		_, err := st.Get(key)
+		test.AssertNil(t, err)
+	}
+	test.AssertTrue(t, st.(MemoryReporter).MemoryUsage() > 0)
+
+	test.AssertNil(t, st.Close())
+	test.AssertEqual(t, st.(MemoryReporter).MemoryUsage(), int64(0))
+}
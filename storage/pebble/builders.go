@@ -0,0 +1,55 @@
+package pebble
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/lovoo/goka/storage"
+)
+
+const defaultCacheSize = 8 << 20
+
+// Options tunes the Pebble databases of a builder.
+type Options struct {
+	// CacheSize is the size of the block cache in bytes, which is shared by all
+	// partitions of the builder. Defaults to 8 MB.
+	CacheSize int64
+	// MaxConcurrentCompactions is the maximum number of concurrent compactions of each
+	// partition. Defaults to Pebble's default of 1.
+	MaxConcurrentCompactions int
+	// Configure modifies the Pebble options of each partition, e.g. to tune the
+	// memtables or the levels.
+	Configure func(opts *pebble.Options)
+}
+
+// PebbleBuilder builds Pebble storages with the default options in the given path.
+func PebbleBuilder(path string) storage.Builder {
+	return BuilderWithOptions(path, Options{})
+}
+
+// BuilderWithOptions builds Pebble storages with the given options in the given path.
+func BuilderWithOptions(path string, opts Options) storage.Builder {
+	cacheSize := opts.CacheSize
+	if cacheSize <= 0 {
+		cacheSize = defaultCacheSize
+	}
+	// the cache is referenced by the builder for the lifetime of the process
+	cache := pebble.NewCache(cacheSize)
+
+	return func(topic string, partition int32) (storage.Storage, error) {
+		dir := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		pebbleOpts := &pebble.Options{Cache: cache}
+		if n := opts.MaxConcurrentCompactions; n > 0 {
+			pebbleOpts.MaxConcurrentCompactions = func() int { return n }
+		}
+		if opts.Configure != nil {
+			opts.Configure(pebbleOpts)
+		}
+		db, err := pebble.Open(dir, pebbleOpts)
+		if err != nil {
+			return nil, fmt.Errorf("error opening pebble %s: %v", dir, err)
+		}
+		return New(db)
+	}
+}
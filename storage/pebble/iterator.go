@@ -0,0 +1,102 @@
+package pebble
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// iterator iterates a consistent view of the database, skipping the offset key
+type iterator struct {
+	iter  *pebble.Iterator
+	start []byte
+
+	started  bool
+	seeked   bool
+	released bool
+}
+
+func (s *pebbleStorage) newIterator(opts *pebble.IterOptions) (*iterator, error) {
+	iter, err := s.db.NewIter(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pebble iterator: %v", err)
+	}
+	return &iterator{
+		iter:  iter,
+		start: opts.LowerBound,
+	}, nil
+}
+
+// skipOffset moves the iterator behind the offset key
+func (i *iterator) skipOffset() {
+	if i.iter.Valid() && string(i.iter.Key()) == offsetKey {
+		i.iter.Next()
+	}
+}
+
+func (i *iterator) Next() bool {
+	if i.released {
+		return false
+	}
+	switch {
+	case i.seeked:
+		// the seeked key is the current one
+		i.seeked = false
+	case !i.started:
+		i.iter.First()
+	default:
+		i.iter.Next()
+	}
+	i.started = true
+	i.skipOffset()
+	return i.iter.Valid()
+}
+
+func (i *iterator) Err() error {
+	if i.released {
+		return nil
+	}
+	return i.iter.Error()
+}
+
+func (i *iterator) Key() []byte {
+	if !i.started || i.released || !i.iter.Valid() {
+		return nil
+	}
+	return i.iter.Key()
+}
+
+func (i *iterator) Value() ([]byte, error) {
+	if !i.started || i.released || !i.iter.Valid() {
+		return nil, nil
+	}
+	value, err := i.iter.ValueAndErr()
+	if err != nil {
+		return nil, err
+	}
+	// the value is only valid until the iterator moves
+	return append([]byte{}, value...), nil
+}
+
+func (i *iterator) Release() {
+	if i.released {
+		return
+	}
+	i.released = true
+	i.iter.Close()
+}
+
+func (i *iterator) Seek(key []byte) bool {
+	if i.released {
+		return false
+	}
+	if i.start != nil && bytes.Compare(key, i.start) < 0 {
+		key = i.start
+	}
+	i.iter.SeekGE(key)
+	i.skipOffset()
+	i.started = true
+	i.seeked = true
+	return i.iter.Valid()
+}
@@ -0,0 +1,199 @@
+// Package pebble provides a storage backed by Pebble, the LevelDB/RocksDB inspired
+// key-value store of CockroachDB, which is maintained and tunable, e.g. its block cache
+// and compactions:
+//
+//	goka.WithStorageBuilder(pebble.BuilderWithOptions("/var/lib/goka", pebble.Options{
+//		CacheSize:                256 << 20,
+//		MaxConcurrentCompactions: 4,
+//	}))
+//
+// The package is a separate module, so applications not using Pebble don't depend on it.
+package pebble
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/lovoo/goka/storage"
+)
+
+const offsetKey = "__offset"
+
+type pebbleStorage struct {
+	// offset is the offset set during recovery, which is written on MarkRecovered
+	offset    int64
+	recovered chan struct{}
+
+	db *pebble.DB
+}
+
+// New creates a new Storage backed by the Pebble database.
+func New(db *pebble.DB) (storage.Storage, error) {
+	if db == nil {
+		return nil, errors.New("invalid pebble database")
+	}
+	return &pebbleStorage{
+		db:        db,
+		recovered: make(chan struct{}),
+	}, nil
+}
+
+func (s *pebbleStorage) Has(key string) (bool, error) {
+	_, closer, err := s.db.Get([]byte(key))
+	if err == pebble.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error checking for existence in pebble (key %s): %v", key, err)
+	}
+	closer.Close()
+	return true, nil
+}
+
+func (s *pebbleStorage) Get(key string) ([]byte, error) {
+	data, closer, err := s.db.Get([]byte(key))
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error getting from pebble (key %s): %v", key, err)
+	}
+	defer closer.Close()
+	// the data is only valid until the closer is closed. The copy distinguishes
+	// empty values from missing keys.
+	return append([]byte{}, data...), nil
+}
+
+func (s *pebbleStorage) Set(key string, value []byte) error {
+	if err := s.db.Set([]byte(key), value, pebble.NoSync); err != nil {
+		return fmt.Errorf("error setting to pebble (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *pebbleStorage) Delete(key string) error {
+	if err := s.db.Delete([]byte(key), pebble.NoSync); err != nil {
+		return fmt.Errorf("error deleting from pebble (key %s): %v", key, err)
+	}
+	return nil
+}
+
+func (s *pebbleStorage) GetOffset(defValue int64) (int64, error) {
+	// during the recovery the local offset is newer than the stored one
+	select {
+	case <-s.recovered:
+	default:
+		if offset := atomic.LoadInt64(&s.offset); offset != 0 {
+			return offset, nil
+		}
+	}
+
+	data, err := s.Get(offsetKey)
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return defValue, nil
+	}
+	value, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error decoding offset: %w (%v)", storage.ErrCorrupted, err)
+	}
+	return value, nil
+}
+
+func (s *pebbleStorage) putOffset(offset int64) error {
+	return s.Set(offsetKey, []byte(strconv.FormatInt(offset, 10)))
+}
+
+// SetOffset stores the offset. During the recovery, the offset is only written
+// when the storage is marked as recovered or closed.
+func (s *pebbleStorage) SetOffset(offset int64) error {
+	atomic.StoreInt64(&s.offset, offset)
+
+	select {
+	case <-s.recovered:
+		return s.putOffset(offset)
+	default:
+	}
+	return nil
+}
+
+func (s *pebbleStorage) MarkRecovered() error {
+	if offset := atomic.LoadInt64(&s.offset); offset != 0 {
+		if err := s.putOffset(offset); err != nil {
+			return err
+		}
+	}
+	close(s.recovered)
+	return nil
+}
+
+func (s *pebbleStorage) Iterator() (storage.Iterator, error) {
+	return s.newIterator(&pebble.IterOptions{})
+}
+
+// IteratorWithRange iterates the range [start, limit). If limit is empty, it
+// iterates the keys with the prefix start.
+func (s *pebbleStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
+	if len(limit) == 0 {
+		limit = prefixEnd(start)
+	}
+	return s.newIterator(&pebble.IterOptions{
+		LowerBound: start,
+		UpperBound: limit,
+	})
+}
+
+// prefixEnd returns the first key after all keys with the prefix, or nil if there
+// is none, i.e. the prefix consists of 0xff bytes only.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func (s *pebbleStorage) Open() error {
+	return nil
+}
+
+// CompactNow compacts the whole key range of the database.
+func (s *pebbleStorage) CompactNow() error {
+	iter, err := s.db.NewIter(&pebble.IterOptions{})
+	if err != nil {
+		return fmt.Errorf("error compacting pebble: %v", err)
+	}
+	var first, last []byte
+	if iter.First() {
+		first = append(first, iter.Key()...)
+		iter.Last()
+		last = append(last, iter.Key()...)
+	}
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("error compacting pebble: %v", err)
+	}
+	if first == nil {
+		return nil
+	}
+	// the end of the range is exclusive
+	if err := s.db.Compact(first, append(last, 0), true); err != nil {
+		return fmt.Errorf("error compacting pebble: %v", err)
+	}
+	return nil
+}
+
+func (s *pebbleStorage) Close() error {
+	if offset := atomic.LoadInt64(&s.offset); offset != 0 {
+		if err := s.putOffset(offset); err != nil {
+			s.db.Close()
+			return err
+		}
+	}
+	return s.db.Close()
+}
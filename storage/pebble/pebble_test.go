@@ -0,0 +1,135 @@
+package pebble
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func newStorage(t *testing.T, path string) storage.Storage {
+	st, err := PebbleBuilder(path)("topic", 0)
+	test.AssertNil(t, err)
+	test.AssertNil(t, st.Open())
+	return st
+}
+
+func TestPebbleStorage(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_storage_pebble_test")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	st := newStorage(t, path)
+
+	value, err := st.Get("key-1")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+	has, err := st.Has("key-1")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	test.AssertNil(t, st.Set("key-1", []byte("value-1")))
+	test.AssertNil(t, st.Set("key-2", []byte("value-2")))
+	test.AssertNil(t, st.Set("key-3", []byte{}))
+	test.AssertNil(t, st.Set("other", []byte("value")))
+
+	value, err = st.Get("key-1")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value-1"))
+	value, err = st.Get("key-3")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte{})
+	has, err = st.Has("key-2")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, has)
+
+	test.AssertNil(t, st.Delete("key-2"))
+	has, err = st.Has("key-2")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	// the offset is kept in memory during the recovery
+	offset, err := st.GetOffset(-1)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(-1))
+	test.AssertNil(t, st.SetOffset(10))
+	offset, err = st.GetOffset(-1)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(10))
+	test.AssertNil(t, st.MarkRecovered())
+	test.AssertNil(t, st.SetOffset(11))
+
+	test.AssertNil(t, st.(storage.Compactable).CompactNow())
+	test.AssertNil(t, st.Close())
+
+	// the values and the offset are persisted
+	st = newStorage(t, path)
+	defer st.Close()
+	value, err = st.Get("key-1")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value-1"))
+	offset, err = st.GetOffset(-1)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(11))
+}
+
+func TestPebbleIterator(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_storage_pebble_test")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	st := newStorage(t, path)
+	defer st.Close()
+	for _, key := range []string{"a1", "a2", "b1", "b2", "c1"} {
+		test.AssertNil(t, st.Set(key, []byte("value-"+key)))
+	}
+	test.AssertNil(t, st.MarkRecovered())
+	test.AssertNil(t, st.SetOffset(5))
+
+	keys := func(it storage.Iterator) []string {
+		defer it.Release()
+		var keys []string
+		for it.Next() {
+			value, err := it.Value()
+			test.AssertNil(t, err)
+			test.AssertEqual(t, string(value), "value-"+string(it.Key()))
+			keys = append(keys, string(it.Key()))
+		}
+		test.AssertNil(t, it.Err())
+		return keys
+	}
+
+	it, err := st.Iterator()
+	test.AssertNil(t, err)
+	// the offset is not returned
+	test.AssertEqual(t, keys(it), []string{"a1", "a2", "b1", "b2", "c1"})
+
+	it, err = st.IteratorWithRange([]byte("b"), nil)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, keys(it), []string{"b1", "b2"})
+
+	it, err = st.IteratorWithRange([]byte("a2"), []byte("c"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, keys(it), []string{"a2", "b1", "b2"})
+
+	it, err = st.Iterator()
+	test.AssertNil(t, err)
+	test.AssertTrue(t, it.Seek([]byte("b2")))
+	test.AssertEqual(t, keys(it), []string{"b2", "c1"})
+
+	// released iterators are exhausted
+	it, err = st.Iterator()
+	test.AssertNil(t, err)
+	it.Release()
+	test.AssertFalse(t, it.Next())
+	test.AssertFalse(t, it.Seek([]byte("a")))
+}
+
+func TestPrefixEnd(t *testing.T) {
+	test.AssertEqual(t, prefixEnd([]byte("b")), []byte("c"))
+	test.AssertEqual(t, prefixEnd([]byte{'a', 0xff}), []byte("b"))
+	test.AssertTrue(t, prefixEnd([]byte{0xff, 0xff}) == nil)
+	test.AssertTrue(t, prefixEnd(nil) == nil)
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Placement chooses one of the paths for the storage of a topic partition, e.g. to
+// distribute the storages across multiple disks.
+type Placement func(paths []string, topic string, partition int32) (string, error)
+
+// RoundRobinPlacement distributes the partitions evenly by partition number, so the
+// partitions of copartitioned tables share a path.
+func RoundRobinPlacement(paths []string, topic string, partition int32) (string, error) {
+	return paths[int(partition)%len(paths)], nil
+}
+
+// FreeSpacePlacement returns a placement putting the storage on the path with the most
+// available disk space. As storages created at the same time, e.g. when a processor
+// starts, do not use disk space yet, reserve bytes are deducted from the free space of
+// a path for every storage placed on it. The paths must exist. It is only supported on
+// Linux, macOS and FreeBSD.
+func FreeSpacePlacement(reserve uint64) Placement {
+	return freeSpacePlacement(reserve, freeSpace)
+}
+
+func freeSpacePlacement(reserve uint64, free func(path string) (uint64, error)) Placement {
+	var (
+		m      sync.Mutex
+		placed = make(map[string]uint64)
+	)
+	return func(paths []string, topic string, partition int32) (string, error) {
+		m.Lock()
+		defer m.Unlock()
+
+		var (
+			best     string
+			bestFree uint64
+		)
+		for _, path := range paths {
+			pathFree, err := free(path)
+			if err != nil {
+				return "", fmt.Errorf("error getting free space of %s: %v", path, err)
+			}
+			if reserved := placed[path] * reserve; reserved < pathFree {
+				pathFree -= reserved
+			} else {
+				pathFree = 0
+			}
+			if best == "" || pathFree > bestFree {
+				best, bestFree = path, pathFree
+			}
+		}
+		placed[best]++
+		return best, nil
+	}
+}
+
+// PlacementBuilder builds LevelDB storages with the given options in one of the paths
+// chosen by the placement. Storages that already exist in one of the paths are
+// opened there, so a partition keeps its path across restarts even if the placement
+// would choose another path, e.g. because the free space changed.
+func PlacementBuilder(paths []string, placement Placement, opts *opt.Options) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		if len(paths) == 0 {
+			return nil, errors.New("no storage paths configured")
+		}
+		path, err := storagePath(paths, placement, topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		fp := filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition))
+		db, err := leveldb.OpenFile(fp, opts)
+		if err != nil {
+			return nil, openError(fp, err)
+		}
+		return New(db)
+	}
+}
+
+// PlacementRemover deletes LevelDB storages created by PlacementBuilder in any of the paths.
+func PlacementRemover(paths []string) Remover {
+	return func(topic string, partition int32) error {
+		for _, path := range paths {
+			if err := DefaultRemover(path)(topic, partition); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// storagePath returns the path containing the storage of the partition or the path
+// chosen by the placement if it does not exist yet
+func storagePath(paths []string, placement Placement, topic string, partition int32) (string, error) {
+	for _, path := range paths {
+		_, err := os.Stat(filepath.Join(path, fmt.Sprintf("%s.%d", topic, partition)))
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fmt.Errorf("error checking for storage in %s: %v", path, err)
+		}
+	}
+	path, err := placement(paths, topic, partition)
+	if err != nil {
+		return "", fmt.Errorf("error placing storage of %s/%d: %v", topic, partition, err)
+	}
+	return path, nil
+}
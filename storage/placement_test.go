@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestPlacementBuilder(t *testing.T) {
+	root, err := ioutil.TempDir("", "goka_storage_placement")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(root)
+	paths := []string{filepath.Join(root, "disk0"), filepath.Join(root, "disk1")}
+
+	build := PlacementBuilder(paths, RoundRobinPlacement, nil)
+	for partition := int32(0); partition < 4; partition++ {
+		st, err := build("topic", partition)
+		test.AssertNil(t, err)
+		test.AssertNil(t, st.Set("key", []byte("value")))
+		test.AssertNil(t, st.Close())
+	}
+	for partition, path := range []string{"disk0/topic.0", "disk1/topic.1", "disk0/topic.2", "disk1/topic.3"} {
+		_, err := os.Stat(filepath.Join(root, path))
+		test.AssertNil(t, err)
+		_, err = os.Stat(filepath.Join(root, paths[1-partition%2], filepath.Base(path)))
+		test.AssertTrue(t, os.IsNotExist(err))
+	}
+
+	// existing storages are opened where they are, regardless of the placement
+	build = PlacementBuilder(paths, func(paths []string, topic string, partition int32) (string, error) {
+		return paths[0], nil
+	}, nil)
+	st, err := build("topic", 1)
+	test.AssertNil(t, err)
+	value, err := st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+	test.AssertNil(t, st.Close())
+
+	test.AssertNil(t, PlacementRemover(paths)("topic", 1))
+	_, err = os.Stat(filepath.Join(paths[1], "topic.1"))
+	test.AssertTrue(t, os.IsNotExist(err))
+
+	_, err = PlacementBuilder(nil, RoundRobinPlacement, nil)("topic", 0)
+	test.AssertNotNil(t, err)
+}
+
+func TestFreeSpacePlacement(t *testing.T) {
+	root, err := ioutil.TempDir("", "goka_storage_placement_free")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(root)
+
+	path, err := FreeSpacePlacement(0)([]string{root}, "topic", 0)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, path, root)
+
+	_, err = FreeSpacePlacement(0)([]string{filepath.Join(root, "missing")}, "topic", 0)
+	test.AssertNotNil(t, err)
+
+	// the free space does not change while the storages are created
+	free := map[string]uint64{"a": 1000, "b": 700}
+	placement := freeSpacePlacement(200, func(path string) (uint64, error) {
+		return free[path], nil
+	})
+	var placed []string
+	for partition := int32(0); partition < 5; partition++ {
+		path, err := placement([]string{"a", "b"}, "topic", partition)
+		test.AssertNil(t, err)
+		placed = append(placed, path)
+	}
+	test.AssertEqual(t, placed, []string{"a", "a", "b", "a", "b"})
+}
@@ -9,7 +9,8 @@ import (
 	redis "gopkg.in/redis.v5"
 )
 
-// RedisBuilder builds redis storage.
+// RedisBuilder builds redis storage. Each partition is stored in the hash
+// "<namespace>:<topic>:<partition>".
 func RedisBuilder(client *redis.Client, namespace string) storage.Builder {
 	return func(topic string, partition int32) (storage.Storage, error) {
 		if namespace == "" {
@@ -18,3 +19,17 @@ func RedisBuilder(client *redis.Client, namespace string) storage.Builder {
 		return New(client, fmt.Sprintf("%s:%s:%d", namespace, topic, partition))
 	}
 }
+
+// SharedBuilder builds redis storage that is shared by all instances using the same
+// client address and namespace, so several views of a table keep a single
+// materialization instead of a local copy each. Each partition is stored in the hash
+// "<namespace>:<topic>:<partition>". The storage must only be used for views, as
+// writes are not visible before the offset of their message is stored.
+func SharedBuilder(client *redis.Client, namespace string) storage.Builder {
+	return func(topic string, partition int32) (storage.Storage, error) {
+		if namespace == "" {
+			return nil, errors.New("missing namespace to redis storage")
+		}
+		return NewShared(client, fmt.Sprintf("%s:%s:%d", namespace, topic, partition))
+	}
+}
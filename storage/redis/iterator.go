@@ -0,0 +1,127 @@
+package redis
+
+import (
+	"bytes"
+	"strings"
+
+	redis "gopkg.in/redis.v5"
+)
+
+// scanCount is the number of fields requested per HSCAN call
+const scanCount = 1000
+
+// redisIterator iterates over a hash with HSCAN, fetching the next batch of pairs
+// whenever the current one is consumed.
+type redisIterator struct {
+	client *redis.Client
+	hash   string
+	match  string
+	// start and limit filter the keys to [start, limit) if limit is set
+	start, limit []byte
+	// seek filters the keys to be greater or equal after Seek
+	seek []byte
+
+	cursor  uint64
+	scanned bool
+	// pairs contains the fields and values of the current batch alternately
+	pairs  []string
+	pos    int
+	peeked bool
+	err    error
+}
+
+func newIterator(client *redis.Client, hash, match string, start, limit []byte) *redisIterator {
+	return &redisIterator{
+		client: client,
+		hash:   hash,
+		match:  match,
+		start:  start,
+		limit:  limit,
+		pos:    -2,
+	}
+}
+
+// escapePattern escapes the glob characters of a HSCAN match pattern
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (i *redisIterator) accept(key string) bool {
+	if key == offsetKey {
+		return false
+	}
+	if len(i.limit) > 0 && (bytes.Compare([]byte(key), i.start) < 0 || bytes.Compare([]byte(key), i.limit) >= 0) {
+		return false
+	}
+	return i.seek == nil || bytes.Compare([]byte(key), i.seek) >= 0
+}
+
+func (i *redisIterator) Next() bool {
+	if i.peeked {
+		i.peeked = false
+		return true
+	}
+	for i.err == nil {
+		i.pos += 2
+		if i.pos+1 < len(i.pairs) {
+			if i.accept(i.pairs[i.pos]) {
+				return true
+			}
+			continue
+		}
+		if i.scanned && i.cursor == 0 {
+			return false
+		}
+		i.pairs, i.cursor, i.err = i.client.HScan(i.hash, i.cursor, i.match, scanCount).Result()
+		i.scanned = true
+		i.pos = -2
+	}
+	i.pairs = nil
+	return false
+}
+
+func (i *redisIterator) exhausted() bool {
+	return i.pos < 0 || i.pos+1 >= len(i.pairs)
+}
+
+func (i *redisIterator) Key() []byte {
+	if i.exhausted() {
+		return nil
+	}
+	return []byte(i.pairs[i.pos])
+}
+
+func (i *redisIterator) Err() error {
+	return i.err
+}
+
+func (i *redisIterator) Value() ([]byte, error) {
+	if i.exhausted() {
+		return nil, nil
+	}
+	return []byte(i.pairs[i.pos+1]), nil
+}
+
+func (i *redisIterator) Release() {
+	i.pairs = nil
+	i.cursor = 0
+	i.scanned = true
+	i.peeked = false
+}
+
+// Seek restarts the scan and returns only the keys greater or equal to key from then
+// on. As the hash is unordered, the keys are still returned in no particular order.
+func (i *redisIterator) Seek(key []byte) bool {
+	i.seek = append([]byte(nil), key...)
+	i.cursor, i.scanned, i.pairs, i.pos, i.peeked = 0, false, nil, -2, false
+	i.peeked = i.Next()
+	return i.peeked
+}
@@ -38,14 +38,10 @@ func (s *redisStorage) Has(key string) (bool, error) {
 }
 
 func (s *redisStorage) Get(key string) ([]byte, error) {
-	has, err := s.client.HExists(s.hash, key).Result()
-	if err != nil {
-		return nil, fmt.Errorf("error checking for existence in redis (key %s): %v", key, err)
-	} else if !has {
-		return nil, nil
-	}
 	value, err := s.client.HGet(s.hash, key).Bytes()
-	if err != nil {
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
 		return nil, fmt.Errorf("error getting from redis (key %s): %v", key, err)
 	}
 	return value, nil
@@ -83,38 +79,22 @@ func (s *redisStorage) Delete(key string) error {
 	return s.client.HDel(s.hash, key).Err()
 }
 
+// Iterator returns an iterator over the hash built on HSCAN. The pairs are returned in
+// no particular order and pairs modified during the iteration may be returned twice
+// or not at all.
 func (s *redisStorage) Iterator() (storage.Iterator, error) {
-	var current uint64
-	var keys []string
-	var err error
-
-	keys, current, err = s.client.HScan(s.hash, current, "", 0).Result()
-	if err != nil {
-		return nil, err
-	}
-	return &redisIterator{
-		current: current,
-		keys:    keys,
-		client:  s.client,
-		hash:    s.hash,
-	}, nil
+	return newIterator(s.client, s.hash, "", nil, nil), nil
 }
 
+// IteratorWithRange returns an iterator over the keys in [start, limit). If limit is
+// empty, all keys with the prefix start are returned. As Redis hashes are not sorted,
+// the whole hash is scanned and filtered, except for prefixes, which are matched by
+// Redis.
 func (s *redisStorage) IteratorWithRange(start, limit []byte) (storage.Iterator, error) {
-	var current uint64
-	var keys []string
-	var err error
-
-	keys, current, err = s.client.HScan(s.hash, current, string(start), 0).Result()
-	if err != nil {
-		return nil, err
+	if len(limit) == 0 {
+		return newIterator(s.client, s.hash, escapePattern(string(start))+"*", nil, nil), nil
 	}
-	return &redisIterator{
-		current: current,
-		keys:    keys,
-		client:  s.client,
-		hash:    s.hash,
-	}, nil
+	return newIterator(s.client, s.hash, "", start, limit), nil
 }
 
 func (s *redisStorage) Recovered() bool {
@@ -132,50 +112,3 @@ func (s *redisStorage) Open() error {
 func (s *redisStorage) Close() error {
 	return nil
 }
-
-type redisIterator struct {
-	current uint64
-	keys    []string
-	client  *redis.Client
-	hash    string
-}
-
-func (i *redisIterator) exhausted() bool {
-	return uint64(len(i.keys)) <= i.current
-}
-
-func (i *redisIterator) Next() bool {
-	i.current++
-	if string(i.Key()) == offsetKey {
-		i.current++
-	}
-	return !i.exhausted()
-}
-
-func (i *redisIterator) Key() []byte {
-	if i.exhausted() {
-		return nil
-	}
-	key := i.keys[i.current]
-	return []byte(key)
-}
-
-func (i *redisIterator) Err() error {
-	return nil
-}
-
-func (i *redisIterator) Value() ([]byte, error) {
-	if i.exhausted() {
-		return nil, nil
-	}
-	key := i.keys[i.current]
-	return i.client.HGet(i.hash, key).Bytes()
-}
-
-func (i *redisIterator) Release() {
-	i.current = uint64(len(i.keys))
-}
-
-func (i *redisIterator) Seek(key []byte) bool {
-	return !i.exhausted()
-}
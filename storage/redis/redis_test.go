@@ -0,0 +1,158 @@
+package redis
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+
+	redis "gopkg.in/redis.v5"
+)
+
+func newClient(t *testing.T) (*redis.Client, func()) {
+	server, err := miniredis.Run()
+	test.AssertNil(t, err)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	return client, func() {
+		client.Close()
+		server.Close()
+	}
+}
+
+func iteratedKeys(t *testing.T, it storage.Iterator) []string {
+	defer it.Release()
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	test.AssertNil(t, it.Err())
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRedisStorage(t *testing.T) {
+	client, stop := newClient(t)
+	defer stop()
+
+	st, err := RedisBuilder(client, "goka")("topic", 0)
+	test.AssertNil(t, err)
+	test.AssertNil(t, st.Open())
+
+	value, err := st.Get("key-1")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+	has, err := st.Has("key-1")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	test.AssertNil(t, st.Set("key-1", []byte("value-1")))
+	test.AssertNil(t, st.Set("key-2", []byte("value-2")))
+	test.AssertNil(t, st.Set("other", []byte("value")))
+
+	value, err = st.Get("key-1")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value-1"))
+	has, err = st.Has("key-2")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, has)
+
+	test.AssertNil(t, st.Delete("key-2"))
+	has, err = st.Has("key-2")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	offset, err := st.GetOffset(-1)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(-1))
+	test.AssertNil(t, st.SetOffset(10))
+	offset, err = st.GetOffset(-1)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(10))
+
+	// the offset is not iterated
+	it, err := st.Iterator()
+	test.AssertNil(t, err)
+	test.AssertEqual(t, iteratedKeys(t, it), []string{"key-1", "other"})
+
+	test.AssertNil(t, st.Close())
+}
+
+func TestRedisStorage_IteratorWithRange(t *testing.T) {
+	client, stop := newClient(t)
+	defer stop()
+
+	st, err := New(client, "hash")
+	test.AssertNil(t, err)
+	for _, key := range []string{"a", "b", "b*", "ba", "c"} {
+		test.AssertNil(t, st.Set(key, []byte(key)))
+	}
+
+	// an empty limit scans the prefix, glob characters are matched literally
+	it, err := st.IteratorWithRange([]byte("b"), nil)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, iteratedKeys(t, it), []string{"b", "b*", "ba"})
+	it, err = st.IteratorWithRange([]byte("b*"), nil)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, iteratedKeys(t, it), []string{"b*"})
+
+	it, err = st.IteratorWithRange([]byte("a"), []byte("ba"))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, iteratedKeys(t, it), []string{"a", "b", "b*"})
+
+	// seeking skips the smaller keys
+	it, err = st.Iterator()
+	test.AssertNil(t, err)
+	test.AssertTrue(t, it.Seek([]byte("c")))
+	test.AssertEqual(t, iteratedKeys(t, it), []string{"c"})
+}
+
+func TestSharedStorage(t *testing.T) {
+	client, stop := newClient(t)
+	defer stop()
+
+	build := SharedBuilder(client, "goka")
+	first, err := build("topic", 0)
+	test.AssertNil(t, err)
+	second, err := build("topic", 0)
+	test.AssertNil(t, err)
+
+	// writes are staged until the offset of their message is set
+	test.AssertNil(t, first.Set("key", []byte("value-1")))
+	value, err := second.Get("key")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+	test.AssertNil(t, first.SetOffset(1))
+	value, err = second.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value-1"))
+
+	// writes of offsets that are already applied are skipped
+	test.AssertNil(t, first.Set("key", []byte("value-2")))
+	test.AssertNil(t, first.SetOffset(2))
+	test.AssertNil(t, second.Set("key", []byte("value-1")))
+	test.AssertNil(t, second.SetOffset(1))
+	value, err = second.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, value, []byte("value-2"))
+	offset, err := second.GetOffset(-1)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(2))
+
+	test.AssertNil(t, second.Delete("key"))
+	test.AssertNil(t, second.SetOffset(3))
+	has, err := first.Has("key")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	test.AssertNotNil(t, first.Set("__offset", []byte("5")))
+
+	// closing with staged writes discards them and fails
+	test.AssertNil(t, first.Set("other", []byte("value")))
+	test.AssertNotNil(t, first.Close())
+	has, err = second.Has("other")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+	test.AssertNil(t, second.Close())
+}
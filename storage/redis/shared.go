@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/lovoo/goka/storage"
+
+	redis "gopkg.in/redis.v5"
+)
+
+// applyScript applies the staged writes of a message and stores its offset, unless
+// another instance already stored the same or a newer offset. KEYS[1] is the hash,
+// ARGV[1] the offset, followed by triples of operation, key and value.
+var applyScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], '__offset') or '-1')
+if current ~= nil and tonumber(ARGV[1]) <= current then
+	return 0
+end
+for i = 2, #ARGV, 3 do
+	if ARGV[i] == 's' then
+		redis.call('HSET', KEYS[1], ARGV[i+1], ARGV[i+2])
+	else
+		redis.call('HDEL', KEYS[1], ARGV[i+1])
+	end
+end
+redis.call('HSET', KEYS[1], '__offset', ARGV[1])
+return 1
+`)
+
+// sharedStorage is a redis storage shared by several instances consuming the same
+// partition, e.g. the views of a table in multiple processes. Writes are staged until
+// the offset of their message is set and then applied atomically, only if the offset
+// is newer than the stored one. So the instance that is furthest ahead materializes
+// the partition and the others skip writes that are already applied.
+// Every write must be followed by SetOffset with the offset of its message, as views
+// do when updating their tables. Writes that are still staged are not visible to reads
+// and are discarded when the storage is closed, which makes Close fail.
+type sharedStorage struct {
+	*redisStorage
+	staged []interface{}
+}
+
+// NewShared creates a new Storage backed by Redis that can be shared by several
+// instances, see SharedBuilder.
+func NewShared(client *redis.Client, hash string) (storage.Storage, error) {
+	st, err := New(client, hash)
+	if err != nil {
+		return nil, err
+	}
+	return &sharedStorage{redisStorage: st.(*redisStorage)}, nil
+}
+
+func (s *sharedStorage) Set(key string, value []byte) error {
+	if key == offsetKey {
+		return errors.New("cannot set the offset key in shared redis storage")
+	}
+	s.staged = append(s.staged, "s", key, value)
+	return nil
+}
+
+func (s *sharedStorage) Delete(key string) error {
+	s.staged = append(s.staged, "d", key, "")
+	return nil
+}
+
+func (s *sharedStorage) SetOffset(offset int64) error {
+	args := append([]interface{}{strconv.FormatInt(offset, 10)}, s.staged...)
+	s.staged = s.staged[:0]
+	if err := applyScript.Run(s.client, []string{s.hash}, args...).Err(); err != nil && err != redis.Nil {
+		return fmt.Errorf("error applying writes of offset %d to redis: %v", offset, err)
+	}
+	return nil
+}
+
+func (s *sharedStorage) Close() error {
+	if len(s.staged) > 0 {
+		writes := len(s.staged) / 3
+		s.staged = nil
+		return fmt.Errorf("discarded %d writes to redis hash %s without offset", writes, s.hash)
+	}
+	return s.redisStorage.Close()
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// snapshotBatchSize is the number of key-value pairs written to the copy at once
+const snapshotBatchSize = 10000
+
+// ErrNoSnapshots is returned by wrapping storages if the wrapped storage does not
+// support snapshots.
+var ErrNoSnapshots = errors.New("storage does not support snapshots")
+
+// Snapshotter is implemented by storages that can copy their state to a directory,
+// e.g. to back up a table or to bootstrap a new instance from the copy.
+type Snapshotter interface {
+	// Snapshot writes a consistent copy of the storage, including its offset, to the
+	// directory, which must not exist. It returns the offset stored in the copy or -1
+	// if the storage has no offset stored yet.
+	Snapshot(dir string) (int64, error)
+}
+
+// Snapshot copies a snapshot of the LevelDB into a new LevelDB in the directory. The
+// storage can be written to while it is copied.
+func (s *storage) Snapshot(dir string) (int64, error) {
+	if _, err := os.Stat(dir); err == nil {
+		return 0, fmt.Errorf("snapshot directory %s already exists", dir)
+	} else if !os.IsNotExist(err) {
+		return 0, fmt.Errorf("error checking snapshot directory %s: %v", dir, err)
+	}
+
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return 0, fmt.Errorf("error getting leveldb snapshot: %v", err)
+	}
+	defer snap.Release()
+
+	db, err := leveldb.OpenFile(dir, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error creating snapshot leveldb in %s: %v", dir, err)
+	}
+
+	offset, err := copySnapshot(snap, db)
+	if err != nil {
+		db.Close()
+		return 0, err
+	}
+	if err := db.Close(); err != nil {
+		return 0, fmt.Errorf("error closing snapshot leveldb in %s: %v", dir, err)
+	}
+	return offset, nil
+}
+
+// copySnapshot writes the pairs of the snapshot to the db in batches and returns the
+// offset contained in the snapshot.
+func copySnapshot(snap *leveldb.Snapshot, db *leveldb.DB) (int64, error) {
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+
+	offset := int64(-1)
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		if string(iter.Key()) == offsetKey {
+			value, err := strconv.ParseInt(string(iter.Value()), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("error decoding offset: %w (%v)", ErrCorrupted, err)
+			}
+			offset = value
+		}
+		// the batch copies key and value
+		batch.Put(iter.Key(), iter.Value())
+		if batch.Len() >= snapshotBatchSize {
+			if err := db.Write(batch, nil); err != nil {
+				return 0, fmt.Errorf("error writing snapshot: %v", err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, fmt.Errorf("error iterating leveldb snapshot: %v", err)
+	}
+	if err := db.Write(batch, nil); err != nil {
+		return 0, fmt.Errorf("error writing snapshot: %v", err)
+	}
+	return offset, nil
+}
+
+// SnapshotBuilder returns a builder that seeds the empty storages built by the builder
+// with their copies in the snapshot directory, which was written by Snapshot in the
+// layout of DefaultBuilder, e.g. by goka's Processor.Snapshot. The seeded storages get
+// the offset of the snapshot, so the table is recovered from that offset instead of
+// replaying the whole topic. Storages with values or an offset and storages missing in
+// the snapshot are left untouched.
+// The snapshot contains the values as written by the wrappers of the storage, so the
+// builder has to be wrapped by the same wrappers as the one that wrote the snapshot,
+// e.g. ChecksumBuilder(SnapshotBuilder(dir, DefaultBuilder(path))).
+// The offset is stored when the storage is marked as recovered or closed, so the table
+// is recovered from the beginning if the instance crashes earlier.
+func SnapshotBuilder(dir string, builder Builder) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s.%d", topic, partition))
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return st, nil
+		}
+		if err := restoreSnapshot(st, path); err != nil {
+			st.Close()
+			return nil, fmt.Errorf("error restoring %s/%d from snapshot %s: %v", topic, partition, dir, err)
+		}
+		return st, nil
+	}
+}
+
+// restoreSnapshot copies the snapshot in the path into the storage if it is empty.
+func restoreSnapshot(st Storage, path string) error {
+	empty, err := isEmpty(st)
+	if err != nil || !empty {
+		return err
+	}
+
+	db, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true})
+	if err != nil {
+		return openError(path, err)
+	}
+	snap, err := New(db)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	defer snap.Close()
+
+	iter, err := snap.Iterator()
+	if err != nil {
+		return err
+	}
+	defer iter.Release()
+
+	batch := NewBatch()
+	for iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		// copy the value, which is reused by the iterator, keeping empty values non-nil
+		batch.Set(string(iter.Key()), append([]byte{}, value...))
+		if batch.Len() >= snapshotBatchSize {
+			if err := SetBatch(st, batch); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("error iterating snapshot: %v", err)
+	}
+	if err := SetBatch(st, batch); err != nil {
+		return err
+	}
+
+	offset, err := snap.GetOffset(-1)
+	if err != nil || offset < 0 {
+		return err
+	}
+	return st.SetOffset(offset)
+}
+
+// isEmpty returns whether the storage has neither values nor an offset.
+func isEmpty(st Storage) (bool, error) {
+	offset, err := st.GetOffset(-1)
+	if err != nil || offset >= 0 {
+		return false, err
+	}
+	iter, err := st.Iterator()
+	if err != nil {
+		return false, err
+	}
+	defer iter.Release()
+	if iter.Next() {
+		return false, nil
+	}
+	return true, iter.Err()
+}
@@ -12,10 +12,18 @@ import (
 )
 
 const (
-	offsetKey                    = "__offset"
+	offsetKey = "__offset"
+	// versionedKey marks storages whose values are stored with their version, see NewVersioned
+	versionedKey                 = "__versioned"
 	recoveryCommitOffsetInterval = 30 * time.Second
 )
 
+// isInternalKey returns whether the key is written by the storage itself instead of
+// containing a value, so it is skipped by iterators.
+func isInternalKey(key []byte) bool {
+	return string(key) == offsetKey || string(key) == versionedKey
+}
+
 // Iterator provides iteration access to the stored values.
 type Iterator interface {
 	// Next moves the iterator to the next key-value pair and whether such a pair
@@ -77,12 +85,18 @@ type Storage interface {
 	// Iterator returns an iterator that traverses over a snapshot of the storage.
 	Iterator() (Iterator, error)
 
-	// Iterator returns a new iterator that iterates over the key-value
-	// pairs. Start and limit define a half-open range [start, limit). If either
-	// is nil, the range will be unbounded on the respective side.
+	// IteratorWithRange returns a new iterator that iterates over the key-value
+	// pairs. Start and limit define a half-open range [start, limit). If limit
+	// is empty, the iterator returns the pairs whose key has the prefix start.
 	IteratorWithRange(start, limit []byte) (Iterator, error)
 }
 
+// IteratorWithPrefix returns an iterator over the key-value pairs of the storage whose
+// key has the prefix.
+func IteratorWithPrefix(st Storage, prefix []byte) (Iterator, error) {
+	return st.IteratorWithRange(prefix, nil)
+}
+
 type storage struct {
 	offset    int64
 	recovered chan struct{}
@@ -177,7 +191,7 @@ func (s *storage) GetOffset(defValue int64) (int64, error) {
 
 	value, err := strconv.ParseInt(string(data), 10, 64)
 	if err != nil {
-		return 0, fmt.Errorf("error decoding offset: %v", err)
+		return 0, fmt.Errorf("error decoding offset: %w (%v)", ErrCorrupted, err)
 	}
 
 	return value, nil
@@ -190,6 +204,22 @@ func (s *storage) Set(key string, value []byte) error {
 	return nil
 }
 
+// SetBatch applies the writes of the batch in a single LevelDB write.
+func (s *storage) SetBatch(b *Batch) error {
+	batch := new(leveldb.Batch)
+	for _, op := range b.Ops() {
+		if op.Value == nil {
+			batch.Delete([]byte(op.Key))
+		} else {
+			batch.Put([]byte(op.Key), op.Value)
+		}
+	}
+	if err := s.db.Write(batch, nil); err != nil {
+		return fmt.Errorf("error writing batch of %d writes to leveldb: %v", b.Len(), err)
+	}
+	return nil
+}
+
 func (s *storage) putOffset(offset int64) error {
 	return s.Set(offsetKey, []byte(strconv.FormatInt(offset, 10)))
 }
@@ -1,9 +1,11 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -85,6 +87,23 @@ func TestMemIter(t *testing.T) {
 	test.AssertTrue(t, iter.Next())
 	test.AssertEqual(t, iter.Key(), k)
 
+	// ranges exclude the limit
+	var keys []string
+	iter, err = storage.IteratorWithRange([]byte("key-1"), []byte("key-3"))
+	test.AssertNil(t, err)
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	test.AssertEqual(t, keys, []string{"key-1", "key-2"})
+
+	keys = nil
+	iter, err = IteratorWithPrefix(storage, []byte("key-"))
+	test.AssertNil(t, err)
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	test.AssertEqual(t, keys, []string{"key-1", "key-2", "key-3"})
+
 	iter, err = storage.Iterator()
 	test.AssertNil(t, err)
 	ok := iter.Seek([]byte("key-2"))
@@ -268,4 +287,200 @@ func TestLeveldbStorage(t *testing.T) {
 		test.AssertNil(t, err)
 
 	})
+	t.Run("compact", func(t *testing.T) {
+		st := newStorage(true, t)
+		defer st.Close()
+
+		for i := 0; i < 1000; i++ {
+			test.AssertNil(t, st.Set(fmt.Sprintf("key-%d", i%10), []byte(fmt.Sprintf("value-%d", i))))
+		}
+		compactable, ok := st.(Compactable)
+		test.AssertTrue(t, ok)
+		test.AssertNil(t, compactable.CompactNow())
+
+		value, err := st.Get("key-9")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value-999")
+	})
+	t.Run("batch", func(t *testing.T) {
+		st := newStorage(true, t)
+		defer st.Close()
+		test.AssertNil(t, st.Set("deleted", []byte("value")))
+
+		b := NewBatch()
+		b.Set("key-1", []byte("value-1"))
+		b.Set("key-2", []byte("value-2"))
+		b.Set("key-1", []byte("value-3"))
+		b.Delete("deleted")
+		value, ok := b.Get("key-1")
+		test.AssertTrue(t, ok)
+		test.AssertEqual(t, string(value), "value-3")
+
+		test.AssertNil(t, SetBatch(st, b))
+		value, err := st.Get("key-1")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value-3")
+		has, err := st.Has("deleted")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, has)
+
+		// storages without batches apply the writes one by one
+		mem := NewMemory()
+		test.AssertNil(t, SetBatch(mem, b))
+		value, err = mem.Get("key-2")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value-2")
+
+		b.Reset()
+		test.AssertEqual(t, b.Len(), 0)
+		_, ok = b.Get("key-1")
+		test.AssertFalse(t, ok)
+	})
+	t.Run("snapshot", func(t *testing.T) {
+		st := newStorage(true, t)
+		defer st.Close()
+		test.AssertNil(t, st.Open())
+		test.AssertNil(t, st.MarkRecovered())
+
+		dir := filepath.Join(os.TempDir(), "goka_storage_snapshot_test")
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+
+		// without an offset
+		test.AssertNil(t, st.Set("key-1", []byte("value-1")))
+		offset, err := st.(Snapshotter).Snapshot(dir)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(-1))
+
+		// existing directories are not overwritten
+		_, err = st.(Snapshotter).Snapshot(dir)
+		test.AssertNotNil(t, err)
+		os.RemoveAll(dir)
+
+		test.AssertNil(t, st.SetOffset(42))
+		offset, err = NewChecksum(st, false).(Snapshotter).Snapshot(dir)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(42))
+
+		// the copy is independent of the storage
+		test.AssertNil(t, st.Set("key-2", []byte("value-2")))
+
+		db, err := leveldb.OpenFile(dir, nil)
+		test.AssertNil(t, err)
+		snap, err := New(db)
+		test.AssertNil(t, err)
+		defer snap.Close()
+		value, err := snap.Get("key-1")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value-1")
+		has, err := snap.Has("key-2")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, has)
+		offset, err = snap.GetOffset(0)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(42))
+
+		_, err = NewChecksum(NewMemory(), false).(Snapshotter).Snapshot(dir)
+		test.AssertTrue(t, errors.Is(err, ErrNoSnapshots))
+	})
+	t.Run("snapshot-builder", func(t *testing.T) {
+		st := newStorage(true, t)
+		test.AssertNil(t, st.Open())
+		test.AssertNil(t, st.MarkRecovered())
+		test.AssertNil(t, st.Set("key-1", []byte("value-1")))
+		test.AssertNil(t, st.Set("empty", []byte{}))
+		test.AssertNil(t, st.SetOffset(42))
+
+		dir := filepath.Join(os.TempDir(), "goka_storage_snapshot_builder_test")
+		os.RemoveAll(dir)
+		defer os.RemoveAll(dir)
+		_, err := st.(Snapshotter).Snapshot(filepath.Join(dir, "snapshot", "table.0"))
+		test.AssertNil(t, err)
+		test.AssertNil(t, st.Close())
+
+		builder := SnapshotBuilder(filepath.Join(dir, "snapshot"), DefaultBuilder(filepath.Join(dir, "storages")))
+
+		// empty storages are seeded with the snapshot
+		restored, err := builder("table", 0)
+		test.AssertNil(t, err)
+		value, err := restored.Get("key-1")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "value-1")
+		value, err = restored.Get("empty")
+		test.AssertNil(t, err)
+		test.AssertTrue(t, value != nil && len(value) == 0)
+		offset, err := restored.GetOffset(-1)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(42))
+
+		test.AssertNil(t, restored.Delete("key-1"))
+		test.AssertNil(t, restored.SetOffset(43))
+		test.AssertNil(t, restored.Close())
+
+		// storages with state are not seeded again
+		restored, err = builder("table", 0)
+		test.AssertNil(t, err)
+		has, err := restored.Has("key-1")
+		test.AssertNil(t, err)
+		test.AssertFalse(t, has)
+		offset, err = restored.GetOffset(-1)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(43))
+		test.AssertNil(t, restored.Close())
+
+		// storages missing in the snapshot stay empty
+		other, err := builder("table", 1)
+		test.AssertNil(t, err)
+		defer other.Close()
+		offset, err = other.GetOffset(-1)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offset, int64(-1))
+	})
+}
+
+func TestLeveldbCorrupted(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_storage_leveldb_corrupted")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	build := DefaultBuilder(path)
+	st, err := build("topic", 0)
+	test.AssertNil(t, err)
+	test.AssertNil(t, st.Set("key", []byte("value")))
+	test.AssertNil(t, st.Close())
+
+	// break the manifest
+	manifests, err := filepath.Glob(filepath.Join(path, "topic.0", "MANIFEST-*"))
+	test.AssertNil(t, err)
+	test.AssertTrue(t, len(manifests) > 0)
+	for _, manifest := range manifests {
+		test.AssertNil(t, ioutil.WriteFile(manifest, []byte("garbage"), 0644))
+	}
+
+	_, err = build("topic", 0)
+	test.AssertNotNil(t, err)
+	test.AssertTrue(t, errors.Is(err, ErrCorrupted))
+
+	test.AssertNil(t, DefaultRemover(path)("topic", 0))
+	st, err = build("topic", 0)
+	test.AssertNil(t, err)
+	defer st.Close()
+	value, err := st.Get("key")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+}
+
+func TestLeveldbCorruptedOffset(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_storage_leveldb_corrupted_offset")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	st, err := DefaultBuilder(path)("topic", 0)
+	test.AssertNil(t, err)
+	defer st.Close()
+	test.AssertNil(t, st.MarkRecovered())
+	test.AssertNil(t, st.Set(offsetKey, []byte("not-a-number")))
+
+	_, err = st.GetOffset(0)
+	test.AssertTrue(t, errors.Is(err, ErrCorrupted))
 }
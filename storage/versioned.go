@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// ErrUnversionedStorage is returned when opening a versioned storage that contains
+// values stored without versions and cannot be migrated, see NewVersioned. It wraps
+// ErrCorrupted, so the storage is rebuilt if the table is configured to.
+var ErrUnversionedStorage = fmt.Errorf("storage contains values without versions: %w", ErrCorrupted)
+
+// Migration upgrades a value written with an older version of the code to the current
+// version, see NewVersioned.
+type Migration func(oldVersion int, raw []byte) ([]byte, error)
+
+// versioned stores the version of the code that wrote each value with the value and
+// migrates values of older versions on read.
+type versioned struct {
+	Storage
+	version int
+	migrate Migration
+}
+
+// NewVersioned wraps the storage to store version with each value and to upgrade
+// values of older versions with migrate when they are read, so values written by
+// older versions of the code are upgraded lazily instead of rewriting the storage.
+// Migrated values are not written back. Reading a value of a newer version fails,
+// e.g. after rolling back the code.
+//
+// The versions change the format of the stored values, so versioned storages are marked
+// when they are opened. Opening a storage that is not marked but contains values stores
+// them as version 0 in a single batch, if the wrapped storage is a Batcher. Otherwise it
+// fails with ErrUnversionedStorage, so the storage has to be rebuilt from the table topic
+// (see goka.WithStorageRebuild). Disabling versions requires an empty storage.
+func NewVersioned(st Storage, version int, migrate Migration) Storage {
+	return &versioned{
+		Storage: st,
+		version: version,
+		migrate: migrate,
+	}
+}
+
+// VersionedBuilder wraps the storages created by builder with NewVersioned.
+func VersionedBuilder(builder Builder, version int, migrate Migration) Builder {
+	return func(topic string, partition int32) (Storage, error) {
+		st, err := builder(topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		return NewVersioned(st, version, migrate), nil
+	}
+}
+
+// Open opens the wrapped storage and marks it as versioned, migrating the values
+// stored without versions.
+func (v *versioned) Open() error {
+	if err := v.Storage.Open(); err != nil {
+		return err
+	}
+	marked, err := v.Storage.Has(versionedKey)
+	if err != nil {
+		return fmt.Errorf("error reading version marker: %v", err)
+	}
+	if marked {
+		return nil
+	}
+	return v.markVersioned()
+}
+
+// markVersioned frames the values stored without versions as version 0 and sets the
+// marker. The values and the marker are written at once, so an interrupted migration
+// does not leave values framed twice.
+func (v *versioned) markVersioned() error {
+	iter, err := v.Storage.Iterator()
+	if err != nil {
+		return fmt.Errorf("error iterating storage: %v", err)
+	}
+	defer iter.Release()
+
+	batch := NewBatch()
+	for iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return fmt.Errorf("error reading unversioned key %s: %v", iter.Key(), err)
+		}
+		batch.Set(string(iter.Key()), frame(0, value))
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("error iterating storage: %v", err)
+	}
+
+	if batch.Len() == 0 {
+		return v.Storage.Set(versionedKey, []byte{1})
+	}
+	if _, ok := v.Storage.(Batcher); !ok {
+		return ErrUnversionedStorage
+	}
+	batch.Set(versionedKey, []byte{1})
+	if err := SetBatch(v.Storage, batch); err != nil {
+		return fmt.Errorf("error migrating %d unversioned values: %v", batch.Len()-1, err)
+	}
+	return nil
+}
+
+func (v *versioned) Get(key string) ([]byte, error) {
+	data, err := v.Storage.Get(key)
+	if err != nil || data == nil {
+		return data, err
+	}
+	return v.upgrade(key, data)
+}
+
+func (v *versioned) Set(key string, value []byte) error {
+	return v.Storage.Set(key, v.frame(value))
+}
+
+// SetAt stores the value with its timestamp if the wrapped storage supports it.
+func (v *versioned) SetAt(key string, value []byte, ts time.Time) error {
+	if st, ok := v.Storage.(TimestampSetter); ok {
+		return st.SetAt(key, v.frame(value), ts)
+	}
+	return v.Set(key, value)
+}
+
+func (v *versioned) Iterator() (Iterator, error) {
+	iter, err := v.Storage.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	return &versionedIterator{iter, v}, nil
+}
+
+func (v *versioned) IteratorWithRange(start, limit []byte) (Iterator, error) {
+	iter, err := v.Storage.IteratorWithRange(start, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &versionedIterator{iter, v}, nil
+}
+
+// MemoryUsage returns the memory used by the wrapped storage if it is a MemoryReporter.
+func (v *versioned) MemoryUsage() int64 {
+	if st, ok := v.Storage.(MemoryReporter); ok {
+		return st.MemoryUsage()
+	}
+	return 0
+}
+
+// Snapshot snapshots the wrapped storage if it is a Snapshotter. The copy contains the
+// wrapped values, so it has to be opened with the same wrapper.
+func (v *versioned) Snapshot(dir string) (int64, error) {
+	if st, ok := v.Storage.(Snapshotter); ok {
+		return st.Snapshot(dir)
+	}
+	return 0, ErrNoSnapshots
+}
+
+// frame prepends the current version to the value
+func (v *versioned) frame(value []byte) []byte {
+	return frame(v.version, value)
+}
+
+// frame prepends the version to the value
+func frame(version int, value []byte) []byte {
+	data := make([]byte, binary.MaxVarintLen64+len(value))
+	n := binary.PutUvarint(data, uint64(version))
+	return append(data[:n], value...)
+}
+
+// upgrade returns the value without its version, migrated if it is older than
+// the current version
+func (v *versioned) upgrade(key string, data []byte) ([]byte, error) {
+	version, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("error reading key %s: %w (invalid version)", key, ErrCorrupted)
+	}
+	value := data[n:]
+	switch {
+	case int(version) == v.version:
+		return value, nil
+	case int(version) > v.version:
+		return nil, fmt.Errorf("error reading key %s: value of version %d is newer than version %d", key, version, v.version)
+	case v.migrate == nil:
+		return nil, fmt.Errorf("error reading key %s: no migration of version %d to %d", key, version, v.version)
+	}
+	migrated, err := v.migrate(int(version), value)
+	if err != nil {
+		return nil, fmt.Errorf("error migrating key %s from version %d to %d: %v", key, version, v.version, err)
+	}
+	return migrated, nil
+}
+
+type versionedIterator struct {
+	Iterator
+	v *versioned
+}
+
+// Next moves to the next value, skipping the version marker.
+func (i *versionedIterator) Next() bool {
+	for i.Iterator.Next() {
+		if string(i.Iterator.Key()) != versionedKey {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *versionedIterator) Value() ([]byte, error) {
+	data, err := i.Iterator.Value()
+	if err != nil || data == nil {
+		return data, err
+	}
+	return i.v.upgrade(string(i.Key()), data)
+}
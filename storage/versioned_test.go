@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestVersioned(t *testing.T) {
+	var (
+		mem     = NewMemory()
+		migrate = func(oldVersion int, raw []byte) ([]byte, error) {
+			if oldVersion == 0 {
+				return nil, errors.New("unsupported")
+			}
+			return append([]byte("migrated-"), raw...), nil
+		}
+		v1 = NewVersioned(mem, 1, nil)
+		v2 = NewVersioned(mem, 2, migrate)
+	)
+
+	test.AssertNil(t, v1.Set("old", []byte("value")))
+	value, err := v1.Get("old")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+
+	// old values are migrated on read, but not written back
+	test.AssertNil(t, v2.Set("new", []byte("value")))
+	value, err = v2.Get("old")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "migrated-value")
+	value, err = v2.Get("new")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+	value, err = v1.Get("old")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+
+	iter, err := v2.Iterator()
+	test.AssertNil(t, err)
+	values := map[string]string{}
+	for iter.Next() {
+		value, err := iter.Value()
+		test.AssertNil(t, err)
+		values[string(iter.Key())] = string(value)
+	}
+	test.AssertEqual(t, values, map[string]string{"old": "migrated-value", "new": "value"})
+
+	// newer values and failed migrations cannot be read
+	_, err = v1.Get("new")
+	test.AssertNotNil(t, err)
+	test.AssertNil(t, NewVersioned(mem, 0, nil).Set("zero", []byte("value")))
+	_, err = v2.Get("zero")
+	test.AssertNotNil(t, err)
+	_, err = v1.Get("zero")
+	test.AssertNotNil(t, err)
+
+	value, err = v2.Get("missing")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+}
+
+func TestVersioned_Open(t *testing.T) {
+	mem := NewMemory()
+	v := NewVersioned(mem, 1, nil)
+	test.AssertNil(t, v.Open())
+	test.AssertNil(t, v.Set("key", []byte("value")))
+
+	// the marker is not iterated and the storage can be opened again
+	iter, err := v.Iterator()
+	test.AssertNil(t, err)
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Release()
+	test.AssertEqual(t, keys, []string{"key"})
+	test.AssertNil(t, NewVersioned(mem, 2, nil).Open())
+
+	// storages written without versions that cannot be migrated are rebuilt
+	unversioned := NewMemory()
+	test.AssertNil(t, unversioned.Set("key", []byte("value")))
+	err = NewVersioned(unversioned, 1, nil).Open()
+	test.AssertTrue(t, errors.Is(err, ErrUnversionedStorage))
+	test.AssertTrue(t, errors.Is(err, ErrCorrupted))
+
+	// storages with an offset but without values are marked
+	recovered := NewMemory()
+	test.AssertNil(t, recovered.SetOffset(10))
+	test.AssertNil(t, NewVersioned(recovered, 1, nil).Open())
+}
+
+func TestVersioned_OpenMigrates(t *testing.T) {
+	path, err := ioutil.TempDir("", "goka_storage_TestVersioned_OpenMigrates")
+	test.AssertNil(t, err)
+	defer os.RemoveAll(path)
+
+	builder := BuilderWithOptions(path, nil)
+	st, err := builder("topic", 0)
+	test.AssertNil(t, err)
+	test.AssertNil(t, st.Open())
+	test.AssertNil(t, st.MarkRecovered())
+	test.AssertNil(t, st.Set("key", []byte("value")))
+	test.AssertNil(t, st.SetOffset(10))
+	test.AssertNil(t, st.Close())
+
+	migrate := func(oldVersion int, raw []byte) ([]byte, error) {
+		return append([]byte(fmt.Sprintf("migrated-%d-", oldVersion)), raw...), nil
+	}
+	st, err = builder("topic", 0)
+	test.AssertNil(t, err)
+	v := NewVersioned(st, 1, migrate)
+	test.AssertNil(t, v.Open())
+	test.AssertNil(t, v.MarkRecovered())
+
+	value, err := v.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "migrated-0-value")
+	offset, err := v.GetOffset(-1)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, offset, int64(10))
+
+	// the values are migrated once
+	test.AssertNil(t, v.Close())
+	st, err = builder("topic", 0)
+	test.AssertNil(t, err)
+	v = NewVersioned(st, 1, migrate)
+	test.AssertNil(t, v.Open())
+	test.AssertNil(t, v.MarkRecovered())
+	value, err = v.Get("key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "migrated-0-value")
+
+	// the marker is internal to the storage
+	iter, err := st.Iterator()
+	test.AssertNil(t, err)
+	var keys []string
+	for iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	iter.Release()
+	test.AssertEqual(t, keys, []string{"key"})
+	test.AssertNil(t, st.Close())
+}
@@ -0,0 +1,33 @@
+package goka
+
+import "context"
+
+// storageLimiter limits how many storages are opened or closed concurrently. A nil
+// limiter does not limit.
+type storageLimiter chan struct{}
+
+func newStorageLimiter(concurrency int) storageLimiter {
+	if concurrency <= 0 {
+		return nil
+	}
+	return make(storageLimiter, concurrency)
+}
+
+// acquire waits for a free slot or until the context is done
+func (l storageLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l storageLimiter) release() {
+	if l != nil {
+		<-l
+	}
+}
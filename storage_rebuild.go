@@ -0,0 +1,42 @@
+package goka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// canRebuildStorage returns whether the error is caused by a corrupted storage
+// that can be rebuilt from the table topic.
+func (p *PartitionTable) canRebuildStorage(err error) bool {
+	return err != nil && p.removeStorage != nil && !p.ephemeral && errors.Is(err, storage.ErrCorrupted)
+}
+
+// rebuildStorage closes and removes the corrupted storage and creates an empty one,
+// which is then recovered from the table topic.
+func (p *PartitionTable) rebuildStorage(ctx context.Context, cause error) (*storageProxy, error) {
+	p.log.Printf("rebuilding corrupted storage of %s/%d from the table topic: %v", p.topic, p.partition, cause)
+
+	if p.st != nil {
+		// the storage is removed anyway, so closing errors don't matter
+		if err := p.st.Close(); err != nil {
+			p.log.Printf("error closing corrupted storage of %s/%d: %v", p.topic, p.partition, err)
+		}
+	}
+
+	if err := p.removeStorage(p.topic, p.partition); err != nil {
+		return nil, fmt.Errorf("error rebuilding corrupted storage (%v): %v", cause, err)
+	}
+
+	st, err := p.createStorage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error rebuilding corrupted storage (%v): %v", cause, err)
+	}
+	if st == nil {
+		// context was cancelled while creating the storage
+		return nil, ctx.Err()
+	}
+	return st, nil
+}
@@ -0,0 +1,115 @@
+package goka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/mock/gomock"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestPT_rebuildStorage(t *testing.T) {
+	t.Run("setup_corrupted", func(t *testing.T) {
+		pt, bm, ctrl := defaultPT(t, "some-topic", 0, nil, nil)
+		defer ctrl.Finish()
+
+		var removed int
+		pt.removeStorage = func(topic string, partition int32) error {
+			removed++
+			return nil
+		}
+		pt.builder = func(topic string, partition int32) (storage.Storage, error) {
+			if removed == 0 {
+				return nil, fmt.Errorf("error opening: %w", storage.ErrCorrupted)
+			}
+			return bm.mst, nil
+		}
+		bm.mst.EXPECT().Open().Return(nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		test.AssertNil(t, pt.setup(ctx))
+		test.AssertEqual(t, removed, 1)
+	})
+	t.Run("open_corrupted", func(t *testing.T) {
+		pt, bm, ctrl := defaultPT(t, "some-topic", 0, nil, nil)
+		defer ctrl.Finish()
+
+		var removed int
+		pt.removeStorage = func(topic string, partition int32) error {
+			removed++
+			return nil
+		}
+		gomock.InOrder(
+			bm.mst.EXPECT().Open().Return(fmt.Errorf("error verifying: %w", storage.ErrChecksumMismatch)),
+			bm.mst.EXPECT().Close().Return(nil),
+			bm.mst.EXPECT().Open().Return(nil),
+		)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		test.AssertNil(t, pt.setup(ctx))
+		test.AssertEqual(t, removed, 1)
+	})
+	t.Run("setup_corrupted_no_rebuild", func(t *testing.T) {
+		pt, _, ctrl := defaultPT(t, "some-topic", 0, nil, nil)
+		defer ctrl.Finish()
+
+		pt.builder = func(topic string, partition int32) (storage.Storage, error) {
+			return nil, fmt.Errorf("error opening: %w", storage.ErrCorrupted)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err := pt.setup(ctx)
+		test.AssertNotNil(t, err)
+		test.AssertTrue(t, errors.Is(err, storage.ErrCorrupted))
+	})
+	t.Run("remove_fails", func(t *testing.T) {
+		pt, _, ctrl := defaultPT(t, "some-topic", 0, nil, nil)
+		defer ctrl.Finish()
+
+		pt.removeStorage = func(topic string, partition int32) error {
+			return errors.New("permission denied")
+		}
+		pt.builder = func(topic string, partition int32) (storage.Storage, error) {
+			return nil, fmt.Errorf("error opening: %w", storage.ErrCorrupted)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		test.AssertNotNil(t, pt.setup(ctx))
+	})
+	t.Run("load_invalid_offset", func(t *testing.T) {
+		var (
+			hwm   int64 = 1312
+			local int64 = 1314
+		)
+		pt, bm, ctrl := defaultPT(t, "some-topic", 0, nil, nil)
+		defer ctrl.Finish()
+
+		var removed int
+		pt.removeStorage = func(topic string, partition int32) error {
+			removed++
+			return nil
+		}
+		bm.mst.EXPECT().Open().Return(nil).Times(2)
+		bm.mst.EXPECT().GetOffset(offsetNotStored).Return(local, nil)
+		bm.mst.EXPECT().Close().Return(nil)
+		bm.tmgr.EXPECT().GetOffset(pt.topic, pt.partition, sarama.OffsetOldest).Return(hwm, nil).Times(2)
+		bm.tmgr.EXPECT().GetOffset(pt.topic, pt.partition, sarama.OffsetNewest).Return(hwm, nil).Times(2)
+		bm.mst.EXPECT().MarkRecovered().Return(nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		test.AssertNil(t, pt.setup(ctx))
+		test.AssertNil(t, pt.load(ctx, true))
+		test.AssertEqual(t, removed, 1)
+		test.AssertTrue(t, pt.state.IsState(State(PartitionRunning)))
+	})
+}
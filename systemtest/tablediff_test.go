@@ -0,0 +1,52 @@
+package systemtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tablediff"
+)
+
+// Tests reading a table topic with tablediff. This requires a (local) running kafka cluster.
+func TestTableDiffReadTopic(t *testing.T) {
+	if !*systemtest {
+		t.Skipf("Ignoring systemtest. pass '-args -systemtest' to `go test` to include them")
+	}
+
+	table := fmt.Sprintf("goka-systemtest-tablediff-%d", time.Now().Unix())
+
+	tmc := goka.NewTopicManagerConfig()
+	tmc.Table.Replication = 1
+	tm, err := goka.TopicManagerBuilderWithConfig(goka.DefaultConfig(), tmc)([]string{*broker})
+	test.AssertNil(t, err)
+	test.AssertNil(t, tm.EnsureTableExists(table, 2))
+	test.AssertNil(t, tm.Close())
+
+	em, err := goka.NewEmitter([]string{*broker}, goka.Stream(table), new(codec.String))
+	test.AssertNil(t, err)
+	test.AssertNil(t, em.EmitSync("key-1", "value-1"))
+	test.AssertNil(t, em.EmitSync("key-2", "value-1"))
+	test.AssertNil(t, em.EmitSync("key-2", "value-2"))
+	test.AssertNil(t, em.EmitSync("deleted", "value-1"))
+	test.AssertNil(t, em.EmitSync("deleted", nil))
+	test.AssertNil(t, em.Finish())
+
+	client, err := sarama.NewClient([]string{*broker}, goka.DefaultConfig())
+	test.AssertNil(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	snapshot, err := tablediff.ReadTopic(ctx, client, table)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, snapshot, tablediff.Snapshot{
+		"key-1": []byte("value-1"),
+		"key-2": []byte("value-2"),
+	})
+}
@@ -0,0 +1,158 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// number of keys deleted by the table GC without releasing the table
+const tableGCBatchSize = 100
+
+// TableGCPredicate decides whether a key of the group table is garbage and
+// has to be deleted by the table GC. The value is decoded with the codec of the
+// group table.
+type TableGCPredicate func(key string, value interface{}) bool
+
+// runTableGC collects the garbage of the group table every interval until the
+// context is done.
+func (pp *PartitionProcessor) runTableGC(ctx context.Context) error {
+	pp.log.Debugf("starting table gc")
+	defer pp.log.Debugf("table gc stopped")
+
+	ticker := time.NewTicker(pp.opts.tableGCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		deleted, err := pp.collectTableGarbage(ctx)
+		if err != nil {
+			return fmt.Errorf("error collecting garbage of partition %d: %v", pp.partition, err)
+		}
+		if deleted > 0 {
+			pp.log.Debugf("table gc deleted %d keys", deleted)
+		}
+	}
+}
+
+// collectTableGarbage scans the group table for keys matching the gc predicate and
+// deletes them locally and in the table topic by emitting a tombstone.
+// The scan runs concurrently to the processing loop. As the loop might have modified
+// a key in the meantime, the predicate is evaluated again right before the deletion.
+func (pp *PartitionProcessor) collectTableGarbage(ctx context.Context) (int, error) {
+	keys, err := pp.scanTableGarbage(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	for len(keys) > 0 {
+		select {
+		case <-ctx.Done():
+			return deleted, nil
+		default:
+		}
+
+		n := len(keys)
+		if n > tableGCBatchSize {
+			n = tableGCBatchSize
+		}
+		batchDeleted, err := pp.deleteTableGarbage(ctx, keys[:n])
+		deleted += batchDeleted
+		if err != nil {
+			return deleted, err
+		}
+		keys = keys[n:]
+	}
+	return deleted, nil
+}
+
+// scanTableGarbage returns the keys of the group table matching the gc predicate.
+func (pp *PartitionProcessor) scanTableGarbage(ctx context.Context) ([]string, error) {
+	it, err := pp.table.Iterator()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating table: %v", err)
+	}
+	defer it.Release()
+
+	var keys []string
+	for it.Next() {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		default:
+		}
+
+		data, err := it.Value()
+		if err != nil {
+			return nil, fmt.Errorf("error reading value of key %s: %v", string(it.Key()), err)
+		}
+		isGarbage, err := pp.isTableGarbage(string(it.Key()), data)
+		if err != nil {
+			return nil, err
+		}
+		if isGarbage {
+			keys = append(keys, string(it.Key()))
+		}
+	}
+	return keys, it.Err()
+}
+
+// deleteTableGarbage deletes the passed keys if they are still garbage. It blocks
+// the processing loop while deleting.
+func (pp *PartitionProcessor) deleteTableGarbage(ctx context.Context, keys []string) (int, error) {
+	pp.tableMutex.Lock()
+	defer pp.tableMutex.Unlock()
+
+	var deleted int
+	for _, key := range keys {
+		data, err := pp.table.Get(key)
+		if err != nil {
+			return deleted, fmt.Errorf("error reading value of key %s: %v", key, err)
+		}
+		if data == nil {
+			continue
+		}
+		isGarbage, err := pp.isTableGarbage(key, data)
+		if err != nil {
+			return deleted, err
+		}
+		if !isGarbage {
+			continue
+		}
+
+		if err := pp.table.Delete(key); err != nil {
+			return deleted, fmt.Errorf("error deleting key %s from storage: %v", key, err)
+		}
+		deleted++
+
+		if pp.graph.isEphemeralTable() {
+			continue
+		}
+
+		// If the tombstone gets lost, the key is restored on the next recovery and
+		// deleted again by the next gc run.
+		key := key
+		topic := pp.graph.GroupTable().Topic()
+		pp.producer.EmitWithHeaders(topic, key, nil, pp.opts.producerDefaultHeaders).Then(func(err error) {
+			if err != nil {
+				pp.log.Printf("error emitting tombstone for key %s to %s: %v", key, topic, err)
+			}
+		})
+		pp.enqueueTrackOutputStats(ctx, topic, 0)
+	}
+	return deleted, nil
+}
+
+func (pp *PartitionProcessor) isTableGarbage(key string, data []byte) (bool, error) {
+	value, err := pp.graph.GroupTable().Codec().Decode(data)
+	if err != nil {
+		return false, fmt.Errorf("error decoding value of key %s: %v", key, err)
+	}
+	return pp.opts.tableGCPredicate(key, value), nil
+}
@@ -0,0 +1,150 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+const defaultLookupLagCheckInterval = time.Second
+
+// Lag returns the number of messages in the table topic partition that are not
+// loaded into the table yet.
+func (p *PartitionTable) Lag() (int64, error) {
+	offset, err := p.st.GetOffset(offsetNotStored)
+	if err != nil {
+		return 0, fmt.Errorf("error reading local offset: %v", err)
+	}
+
+	// the consumer knows the hwm while consuming, otherwise ask the broker
+	hwm := p.consumer.HighWaterMarks()[p.topic][p.partition]
+	if hwm == 0 {
+		hwm, err = p.tmgr.GetOffset(p.topic, p.partition, sarama.OffsetNewest)
+		if err != nil {
+			return 0, fmt.Errorf("error reading hwm of %s/%d: %v", p.topic, p.partition, err)
+		}
+	}
+
+	lag := hwm
+	if offset != offsetNotStored {
+		// the stored offset is the offset of the last loaded message
+		lag = hwm - offset - 1
+	}
+	if lag < 0 {
+		return 0, nil
+	}
+	return lag, nil
+}
+
+// maxLag returns the maximum lag of the passed partition tables.
+func maxLag(tables []*PartitionTable) (int64, error) {
+	var max int64
+	for _, table := range tables {
+		lag, err := table.Lag()
+		if err != nil {
+			return 0, err
+		}
+		if lag > max {
+			max = lag
+		}
+	}
+	return max, nil
+}
+
+// lookupLagGate pauses the processing of input messages while a lookup table
+// lags behind its topic more than the max lookup lag.
+type lookupLagGate struct {
+	maxLag   int64
+	interval time.Duration
+	views    map[string]*View
+	log      logger
+
+	m sync.RWMutex
+	// open is closed while processing may proceed
+	open chan struct{}
+}
+
+func newLookupLagGate(maxLag int64, views map[string]*View, log logger) *lookupLagGate {
+	open := make(chan struct{})
+	close(open)
+	return &lookupLagGate{
+		maxLag:   maxLag,
+		interval: defaultLookupLagCheckInterval,
+		views:    views,
+		log:      log,
+		open:     open,
+	}
+}
+
+// run checks the lag of the lookup tables every interval until the context is done
+func (lg *lookupLagGate) run(ctx context.Context) error {
+	ticker := time.NewTicker(lg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		lagging, err := lg.laggingTables()
+		if err != nil {
+			// don't block processing because the lag is unknown
+			lg.log.Printf("error checking lookup lag: %v", err)
+			lagging = nil
+		}
+		lg.update(lagging)
+	}
+}
+
+// laggingTables returns the lookup tables lagging more than the max lag
+func (lg *lookupLagGate) laggingTables() ([]string, error) {
+	var lagging []string
+	for topic, view := range lg.views {
+		lag, err := view.Lag()
+		if err != nil {
+			return nil, fmt.Errorf("error getting lag of lookup table %s: %v", topic, err)
+		}
+		if lag > lg.maxLag {
+			lagging = append(lagging, topic)
+		}
+	}
+	return lagging, nil
+}
+
+// update opens or closes the gate depending on the lagging tables
+func (lg *lookupLagGate) update(lagging []string) {
+	lg.m.Lock()
+	defer lg.m.Unlock()
+
+	select {
+	case <-lg.open:
+		if len(lagging) > 0 {
+			lg.log.Printf("pausing processing, lookup tables %v lag more than %d messages", lagging, lg.maxLag)
+			lg.open = make(chan struct{})
+		}
+	default:
+		if len(lagging) == 0 {
+			lg.log.Printf("resuming processing, lookup tables caught up")
+			close(lg.open)
+		}
+	}
+}
+
+// wait blocks while the gate is closed. It returns false if the context is done.
+func (lg *lookupLagGate) wait(ctx context.Context) bool {
+	lg.m.RLock()
+	open := lg.open
+	lg.m.RUnlock()
+
+	select {
+	case <-open:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,73 @@
+package goka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestPT_Lag(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		stored int64
+		hwm    int64
+		lag    int64
+	}{
+		{name: "lagging", stored: 4, hwm: 10, lag: 5},
+		{name: "caught-up", stored: 9, hwm: 10, lag: 0},
+		{name: "not-stored", stored: offsetNotStored, hwm: 10, lag: 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pt, bm, ctrl := defaultPT(t, "some-topic", 0, NewMockAutoConsumer(t, nil), nil)
+			defer ctrl.Finish()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			bm.mst.EXPECT().Open().Return(nil)
+			test.AssertNil(t, pt.setup(ctx))
+
+			bm.mst.EXPECT().GetOffset(offsetNotStored).Return(tc.stored, nil)
+			bm.tmgr.EXPECT().GetOffset("some-topic", int32(0), sarama.OffsetNewest).Return(tc.hwm, nil)
+
+			lag, err := pt.Lag()
+			test.AssertNil(t, err)
+			test.AssertEqual(t, lag, tc.lag)
+		})
+	}
+}
+
+func TestLookupLagGate(t *testing.T) {
+	lg := newLookupLagGate(10, nil, defaultLogger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// open by default
+	test.AssertTrue(t, lg.wait(ctx))
+
+	lg.update([]string{"lookup"})
+	waited := make(chan bool, 1)
+	go func() {
+		waited <- lg.wait(ctx)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatalf("gate did not block while lookup table is lagging")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	lg.update(nil)
+	select {
+	case ok := <-waited:
+		test.AssertTrue(t, ok)
+	case <-time.After(time.Second):
+		t.Fatalf("gate did not open after lookup table caught up")
+	}
+
+	lg.update([]string{"lookup"})
+	cancel()
+	test.AssertFalse(t, lg.wait(ctx))
+}
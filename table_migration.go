@@ -0,0 +1,69 @@
+package goka
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// TableVersionHeader is the header of group table messages containing the version of
+// the processor that wrote the value, see WithTableVersion. Messages without the header
+// are version 0.
+const TableVersionHeader = "goka-table-version"
+
+// tableMigration is the version and migration of a joined or looked up table, see
+// WithJoinTableMigration.
+type tableMigration struct {
+	version int
+	migrate storage.Migration
+}
+
+// configureMigration makes the table store the version with each value and migrate
+// values of older versions, both when recovering them from the table topic and when
+// reading them from the local storage.
+func (p *PartitionTable) configureMigration(version int, migrate storage.Migration) {
+	if version <= 0 {
+		return
+	}
+	p.version = version
+	p.migrate = migrate
+	p.builder = storage.VersionedBuilder(p.builder, version, migrate)
+}
+
+// migrateRecovered migrates a value recovered from the table topic that was written
+// by an older version.
+func (p *PartitionTable) migrateRecovered(value []byte, hdr Headers) ([]byte, error) {
+	if p.version <= 0 || value == nil {
+		return value, nil
+	}
+	version := 0
+	if raw, ok := hdr[TableVersionHeader]; ok {
+		var err error
+		if version, err = strconv.Atoi(string(raw)); err != nil {
+			return nil, fmt.Errorf("invalid table version header %q: %v", raw, err)
+		}
+	}
+	switch {
+	case version == p.version:
+		return value, nil
+	case version > p.version:
+		return nil, fmt.Errorf("value of version %d is newer than version %d", version, p.version)
+	case p.migrate == nil:
+		return nil, fmt.Errorf("no migration of version %d to %d", version, p.version)
+	}
+	migrated, err := p.migrate(version, value)
+	if err != nil {
+		return nil, fmt.Errorf("error migrating value from version %d to %d: %v", version, p.version, err)
+	}
+	return migrated, nil
+}
+
+// versionHeaders adds the version header to the headers of a table message, if
+// the table is versioned.
+func (p *PartitionTable) versionHeaders(hdr Headers) Headers {
+	if p.version <= 0 {
+		return hdr
+	}
+	return hdr.Merged(Headers{TableVersionHeader: []byte(strconv.Itoa(p.version))})
+}
@@ -0,0 +1,83 @@
+package goka
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestPT_migrateRecovered(t *testing.T) {
+	pt := &PartitionTable{builder: storage.MemoryBuilder()}
+	pt.configureMigration(2, func(oldVersion int, raw []byte) ([]byte, error) {
+		return []byte(strings.Repeat(string(raw), 2-oldVersion+1)), nil
+	})
+
+	// values without header are version 0
+	value, err := pt.migrateRecovered([]byte("a"), nil)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "aaa")
+
+	value, err = pt.migrateRecovered([]byte("a"), Headers{TableVersionHeader: []byte("1")})
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "aa")
+
+	value, err = pt.migrateRecovered([]byte("a"), pt.versionHeaders(nil))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "a")
+
+	// deletes are not migrated
+	value, err = pt.migrateRecovered(nil, nil)
+	test.AssertNil(t, err)
+	test.AssertTrue(t, value == nil)
+
+	_, err = pt.migrateRecovered([]byte("a"), Headers{TableVersionHeader: []byte("3")})
+	test.AssertNotNil(t, err)
+	_, err = pt.migrateRecovered([]byte("a"), Headers{TableVersionHeader: []byte("x")})
+	test.AssertNotNil(t, err)
+}
+
+func TestOptions_JoinTableMigration(t *testing.T) {
+	gg := DefineGroup("group",
+		Input("input", new(codec.String), nil),
+		Join("join", new(codec.String)),
+		Lookup("lookup", new(codec.String)),
+	)
+	migrate := func(oldVersion int, raw []byte) ([]byte, error) { return raw, nil }
+
+	opts := new(poptions)
+	err := opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()),
+		WithJoinTableMigration("join", 2, migrate),
+		WithJoinTableMigration("lookup", 1, nil),
+	)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.tableMigrations["join"].version, 2)
+	test.AssertEqual(t, opts.tableMigrations["lookup"].version, 1)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithJoinTableMigration("other", 1, migrate))
+	test.AssertNotNil(t, err)
+
+	opts = new(poptions)
+	err = opts.applyOptions(gg, WithStorageBuilder(nullStorageBuilder()), WithJoinTableMigration("join", 0, migrate))
+	test.AssertNotNil(t, err)
+}
+
+func TestOptions_ViewTableMigration(t *testing.T) {
+	migrate := func(oldVersion int, raw []byte) ([]byte, error) { return raw, nil }
+
+	opts := new(voptions)
+	err := opts.applyOptions("table", new(codec.String), WithViewStorageBuilder(storage.MemoryBuilder()), WithViewTableMigration(2, migrate))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, opts.tableVersion, 2)
+
+	opts = new(voptions)
+	err = opts.applyOptions("table", new(codec.String), WithViewStorageBuilder(storage.MemoryBuilder()), WithViewTableMigration(-1, nil))
+	test.AssertNotNil(t, err)
+
+	opts = new(voptions)
+	err = opts.applyOptions("table", new(codec.String), WithViewStorageBuilder(storage.MemoryBuilder()), WithViewTableMigration(0, migrate))
+	test.AssertNotNil(t, err)
+}
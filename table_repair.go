@@ -0,0 +1,234 @@
+package goka
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/multierr"
+)
+
+// maxRepairReportKeys limits the number of divergent keys listed in a report
+const maxRepairReportKeys = 100
+
+// changelogIdleTimeout limits how long reading the changelog waits for the next message,
+// e.g. if the offsets before the high watermark are transaction markers that are never
+// delivered.
+const changelogIdleTimeout = 30 * time.Second
+
+// TableRepairReport is the result of comparing a partition of the group table
+// with its changelog, see Processor.CheckTable and Processor.RepairTable.
+type TableRepairReport struct {
+	Partition int32
+	// Hwm is the offset of the changelog the partition was compared up to
+	Hwm int64
+	// Checked is the number of local keys that were compared
+	Checked int
+	// Missing is the number of keys in the changelog that are missing locally
+	Missing int
+	// Extra is the number of local keys that were deleted in or are missing in the changelog
+	Extra int
+	// Diverged is the number of local keys whose value differs from the changelog
+	Diverged int
+	// Keys lists up to 100 of the divergent keys
+	Keys []string
+	// Repaired is true if the divergences were repaired
+	Repaired bool
+}
+
+// Divergent returns the number of keys differing between the local table and the changelog.
+func (r *TableRepairReport) Divergent() int {
+	return r.Missing + r.Extra + r.Diverged
+}
+
+func (r *TableRepairReport) addKey(key string) {
+	if len(r.Keys) < maxRepairReportKeys {
+		r.Keys = append(r.Keys, key)
+	}
+}
+
+// inRepairSample returns whether the key is part of the sample of 1/sample of all keys
+func inRepairSample(key string, sample int) bool {
+	return sample <= 1 || crc32.ChecksumIEEE([]byte(key))%uint32(sample) == 0
+}
+
+// repairTable compares the group table partition with its changelog and repairs it if
+// requested. The processing of the partition is paused while comparing.
+func (pp *PartitionProcessor) repairTable(ctx context.Context, sample int, repair bool) (*TableRepairReport, error) {
+	pp.tableMutex.Lock()
+	defer pp.tableMutex.Unlock()
+
+	// wait for the emits of processed messages, so the changelog contains all local writes
+	done := make(chan struct{})
+	go func() {
+		pp.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	hwm, err := pp.table.tmgr.GetOffset(pp.table.topic, pp.partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting hwm of %s/%d: %v", pp.table.topic, pp.partition, err)
+	}
+	return pp.table.compareWithChangelog(ctx, hwm, sample, repair)
+}
+
+// compareWithChangelog compares the local values of the sampled keys with the values
+// of the changelog up to hwm. Divergent local values are replaced with the changelog
+// values if repair is set.
+func (p *PartitionTable) compareWithChangelog(ctx context.Context, hwm int64, sample int, repair bool) (*TableRepairReport, error) {
+	changelog, err := p.readChangelog(ctx, hwm, sample)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &TableRepairReport{
+		Partition: p.partition,
+		Hwm:       hwm,
+	}
+
+	// values to repair, nil values are deleted
+	repairs := make(map[string][]byte)
+
+	iter, err := p.Iterator()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating %s/%d: %v", p.topic, p.partition, err)
+	}
+	for iter.Next() {
+		key := string(iter.Key())
+		if !inRepairSample(key, sample) {
+			continue
+		}
+		report.Checked++
+
+		expected, ok := changelog[key]
+		delete(changelog, key)
+
+		value, err := iter.Value()
+		switch {
+		case !ok:
+			report.Extra++
+		case err != nil, !bytes.Equal(value, expected):
+			// values that fail to read, e.g. with a checksum mismatch, diverge as well
+			report.Diverged++
+		default:
+			continue
+		}
+		report.addKey(key)
+		repairs[key] = expected
+	}
+	err = iter.Err()
+	iter.Release()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating %s/%d: %v", p.topic, p.partition, err)
+	}
+
+	for key, value := range changelog {
+		report.Missing++
+		report.addKey(key)
+		repairs[key] = value
+	}
+
+	if !repair || len(repairs) == 0 {
+		return report, nil
+	}
+
+	for key, value := range repairs {
+		if value == nil {
+			err = p.Delete(key)
+		} else {
+			err = p.Set(key, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error repairing key %s in %s/%d: %v", key, p.topic, p.partition, err)
+		}
+	}
+	p.log.Printf("repaired %d divergent keys in %s/%d", report.Divergent(), p.topic, p.partition)
+	report.Repaired = true
+	return report, nil
+}
+
+// expired returns whether a message written at ts is older than the retention of the table.
+func (p *PartitionTable) expired(ts time.Time) bool {
+	return p.retention > 0 && !ts.IsZero() && time.Since(ts) > p.retention
+}
+
+// readChangelog reads the latest values of the sampled keys from the table topic up to hwm.
+func (p *PartitionTable) readChangelog(ctx context.Context, hwm int64, sample int) (values map[string][]byte, rerr error) {
+	values = make(map[string][]byte)
+
+	oldest, err := p.tmgr.GetOffset(p.topic, p.partition, sarama.OffsetOldest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting oldest offset of %s/%d: %v", p.topic, p.partition, err)
+	}
+	if oldest >= hwm {
+		return values, nil
+	}
+
+	cons, err := p.consumer.ConsumePartition(p.topic, p.partition, oldest)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming %s/%d: %v", p.topic, p.partition, err)
+	}
+	defer func() {
+		errs := new(multierr.Errors)
+		errs.Collect(rerr)
+		cons.AsyncClose()
+		p.drainConsumer(cons, errs)
+		rerr = errs.NilOrError()
+	}()
+
+	idle := time.NewTimer(changelogIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-idle.C:
+			return nil, fmt.Errorf("timeout reading %s/%d up to offset %d: no message for %v", p.topic, p.partition, hwm-1, changelogIdleTimeout)
+		case consErr, ok := <-cons.Errors():
+			if !ok {
+				return nil, fmt.Errorf("consumer of %s/%d closed unexpectedly", p.topic, p.partition)
+			}
+			return nil, fmt.Errorf("error reading %s/%d: %v", p.topic, p.partition, consErr)
+		case msg, ok := <-cons.Messages():
+			if !ok {
+				return nil, fmt.Errorf("consumer of %s/%d closed unexpectedly", p.topic, p.partition)
+			}
+			if msg == nil {
+				continue
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(changelogIdleTimeout)
+			if key := string(msg.Key); inRepairSample(key, sample) {
+				if msg.Value == nil || p.expired(msg.Timestamp) {
+					delete(values, key)
+				} else {
+					values[key] = msg.Value
+				}
+			}
+			if consumedUpTo(msg, cons, hwm) {
+				return values, nil
+			}
+		}
+	}
+}
+
+// consumedUpTo returns whether msg is the last message before hwm, or the last message
+// the partition consumer knows of, e.g. if the partition was truncated after getting hwm.
+func consumedUpTo(msg *sarama.ConsumerMessage, cons sarama.PartitionConsumer, hwm int64) bool {
+	if msg.Offset+1 >= hwm {
+		return true
+	}
+	consumerHwm := cons.HighWaterMarkOffset()
+	return consumerHwm > 0 && msg.Offset+1 >= consumerHwm
+}
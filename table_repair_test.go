@@ -0,0 +1,121 @@
+package goka
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestPT_compareWithChangelog(t *testing.T) {
+	var (
+		topic           = "some-topic"
+		partition int32 = 0
+		oldest    int64 = 0
+		hwm       int64 = 5
+		changelog       = []*sarama.ConsumerMessage{
+			{Key: []byte("ok"), Value: []byte("v1")},
+			{Key: []byte("diverged"), Value: []byte("v1")},
+			{Key: []byte("diverged"), Value: []byte("v2")},
+			{Key: []byte("deleted"), Value: []byte("v1")},
+			{Key: []byte("deleted"), Value: nil},
+		}
+	)
+
+	setup := func(t *testing.T) (*PartitionTable, func()) {
+		consumer := defaultSaramaAutoConsumerMock(t)
+		pt, bm, ctrl := defaultPT(t, topic, partition, consumer, nil)
+		bm.st = storage.NewMemory()
+
+		partConsumer := consumer.ExpectConsumePartition(topic, partition, oldest)
+		// the mock consumer yields the messages from offset 0
+		for _, msg := range changelog {
+			partConsumer.YieldMessage(msg)
+		}
+		bm.tmgr.EXPECT().GetOffset(topic, partition, sarama.OffsetOldest).Return(oldest, nil)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		test.AssertNil(t, pt.setup(ctx))
+		pt.state.SetState(State(PartitionRunning))
+
+		test.AssertNil(t, pt.Set("ok", []byte("v1")))
+		test.AssertNil(t, pt.Set("diverged", []byte("v1")))
+		test.AssertNil(t, pt.Set("deleted", []byte("v1")))
+		test.AssertNil(t, pt.Set("extra", []byte("v1")))
+		return pt, ctrl.Finish
+	}
+
+	t.Run("check", func(t *testing.T) {
+		pt, finish := setup(t)
+		defer finish()
+
+		report, err := pt.compareWithChangelog(context.Background(), hwm, 1, false)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, report.Checked, 4)
+		test.AssertEqual(t, report.Diverged, 1)
+		test.AssertEqual(t, report.Extra, 2)
+		test.AssertEqual(t, report.Missing, 0)
+		test.AssertFalse(t, report.Repaired)
+		sort.Strings(report.Keys)
+		test.AssertEqual(t, report.Keys, []string{"deleted", "diverged", "extra"})
+
+		// nothing changed
+		value, err := pt.Get("diverged")
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "v1")
+	})
+
+	t.Run("repair", func(t *testing.T) {
+		pt, finish := setup(t)
+		defer finish()
+		test.AssertNil(t, pt.Delete("ok"))
+
+		report, err := pt.compareWithChangelog(context.Background(), hwm, 1, true)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, report.Divergent(), 4)
+		test.AssertEqual(t, report.Missing, 1)
+		test.AssertTrue(t, report.Repaired)
+
+		for key, expected := range map[string]string{"ok": "v1", "diverged": "v2"} {
+			value, err := pt.Get(key)
+			test.AssertNil(t, err)
+			test.AssertEqual(t, string(value), expected)
+		}
+		for _, key := range []string{"deleted", "extra"} {
+			has, err := pt.Has(key)
+			test.AssertNil(t, err)
+			test.AssertFalse(t, has)
+		}
+	})
+}
+
+func TestInRepairSample(t *testing.T) {
+	var sampled int
+	for i := 0; i < 1000; i++ {
+		key := time.Duration(i).String()
+		test.AssertTrue(t, inRepairSample(key, 1))
+		test.AssertTrue(t, inRepairSample(key, 0))
+		if inRepairSample(key, 10) {
+			sampled++
+		}
+	}
+	test.AssertTrue(t, sampled > 50 && sampled < 150, sampled)
+}
+
+func TestConsumedUpTo(t *testing.T) {
+	consumer := defaultSaramaAutoConsumerMock(t)
+	pc := consumer.ExpectConsumePartition("topic", 0, 0)
+	for i := 0; i < 3; i++ {
+		pc.YieldMessage(&sarama.ConsumerMessage{})
+	}
+
+	test.AssertFalse(t, consumedUpTo(&sarama.ConsumerMessage{Offset: 1}, pc, 10))
+	test.AssertTrue(t, consumedUpTo(&sarama.ConsumerMessage{Offset: 1}, pc, 2))
+	// the consumer knows of no message after offset 2
+	test.AssertTrue(t, consumedUpTo(&sarama.ConsumerMessage{Offset: 2}, pc, 10))
+}
@@ -0,0 +1,115 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lovoo/goka/storage"
+)
+
+// bounds of the interval to delete expired keys from the group table
+const (
+	minTableExpiryInterval = time.Second
+	maxTableExpiryInterval = time.Hour
+)
+
+// tableExpiryInterval returns how often expired keys are deleted for the retention.
+func tableExpiryInterval(retention time.Duration) time.Duration {
+	interval := retention / 10
+	if interval < minTableExpiryInterval {
+		return minTableExpiryInterval
+	}
+	if interval > maxTableExpiryInterval {
+		return maxTableExpiryInterval
+	}
+	return interval
+}
+
+// expiredKeys returns the keys of the table older than its retention.
+func (p *PartitionTable) expiredKeys() ([]string, error) {
+	if p.st == nil {
+		return nil, nil
+	}
+	st, ok := p.st.Storage.(storage.Expirable)
+	if !ok {
+		return nil, nil
+	}
+	return st.ExpiredKeys()
+}
+
+// runTableExpiry deletes the expired keys from the local storage of the group table
+// until the context is done. Kafka deletes them from the table topic itself, so no
+// tombstones are emitted.
+func (pp *PartitionProcessor) runTableExpiry(ctx context.Context) error {
+	ticker := time.NewTicker(tableExpiryInterval(pp.opts.tableRetention))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		deleted, err := pp.expireTable(ctx)
+		if err != nil {
+			return fmt.Errorf("error expiring keys of partition %d: %v", pp.partition, err)
+		}
+		if deleted > 0 {
+			pp.log.Debugf("deleted %d expired keys", deleted)
+		}
+	}
+}
+
+// expireTable deletes the expired keys of the group table in batches, blocking the
+// processing loop while deleting.
+func (pp *PartitionProcessor) expireTable(ctx context.Context) (int, error) {
+	keys, err := pp.table.expiredKeys()
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	for len(keys) > 0 {
+		select {
+		case <-ctx.Done():
+			return deleted, nil
+		default:
+		}
+
+		n := len(keys)
+		if n > tableGCBatchSize {
+			n = tableGCBatchSize
+		}
+		batchDeleted, err := pp.deleteExpired(keys[:n])
+		deleted += batchDeleted
+		if err != nil {
+			return deleted, err
+		}
+		keys = keys[n:]
+	}
+	return deleted, nil
+}
+
+func (pp *PartitionProcessor) deleteExpired(keys []string) (int, error) {
+	pp.tableMutex.Lock()
+	defer pp.tableMutex.Unlock()
+
+	var deleted int
+	for _, key := range keys {
+		// the key might have been set again since it was found to be expired
+		data, err := pp.table.Get(key)
+		if err != nil {
+			return deleted, fmt.Errorf("error reading value of key %s: %v", key, err)
+		}
+		if data != nil {
+			continue
+		}
+		if err := pp.table.Delete(key); err != nil {
+			return deleted, fmt.Errorf("error deleting key %s from storage: %v", key, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,95 @@
+package goka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestTableExpiryInterval(t *testing.T) {
+	test.AssertEqual(t, tableExpiryInterval(time.Second), minTableExpiryInterval)
+	test.AssertEqual(t, tableExpiryInterval(time.Hour), 6*time.Minute)
+	test.AssertEqual(t, tableExpiryInterval(7*24*time.Hour), maxTableExpiryInterval)
+}
+
+func TestPP_expireTable(t *testing.T) {
+	var (
+		topic           = "some-table"
+		partition int32 = 0
+		mem             = storage.NewMemory()
+		st              = storage.NewExpiring(mem, time.Hour)
+	)
+
+	pt, bm, ctrl := defaultPT(t, topic, partition, nil, nil)
+	defer ctrl.Finish()
+	bm.st = st
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	test.AssertNil(t, pt.setup(ctx))
+	pt.state.SetState(State(PartitionRunning))
+
+	setter := st.(storage.TimestampSetter)
+	test.AssertNil(t, setter.SetAt("expired", []byte("value"), time.Now().Add(-59*time.Minute)))
+	test.AssertNil(t, setter.SetAt("live", []byte("value"), time.Now()))
+
+	pp := &PartitionProcessor{
+		table: pt,
+		log:   defaultLogger,
+	}
+
+	// nothing is expired yet
+	deleted, err := pp.expireTable(ctx)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, deleted, 0)
+
+	// expire the key without waiting for an hour by setting its timestamp to 0
+	test.AssertNil(t, mem.Set("expired", append(make([]byte, 8), "value"...)))
+
+	deleted, err = pp.expireTable(ctx)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, deleted, 1)
+
+	has, err := mem.Has("expired")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+	value, err := pt.Get("live")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, string(value), "value")
+}
+
+func TestPT_compareWithChangelogRetention(t *testing.T) {
+	var (
+		topic           = "some-table"
+		partition int32 = 0
+		now             = time.Now()
+	)
+
+	consumer := defaultSaramaAutoConsumerMock(t)
+	pt, bm, ctrl := defaultPT(t, topic, partition, consumer, nil)
+	defer ctrl.Finish()
+	bm.st = storage.NewMemory()
+	pt.configureRetention(time.Hour)
+
+	partConsumer := consumer.ExpectConsumePartition(topic, partition, 0)
+	partConsumer.YieldMessage(&sarama.ConsumerMessage{Key: []byte("expired"), Value: []byte("v1"), Timestamp: now.Add(-2 * time.Hour)})
+	partConsumer.YieldMessage(&sarama.ConsumerMessage{Key: []byte("live"), Value: []byte("v1"), Timestamp: now})
+	bm.tmgr.EXPECT().GetOffset(topic, partition, sarama.OffsetOldest).Return(int64(0), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	test.AssertNil(t, pt.setup(ctx))
+	pt.state.SetState(State(PartitionRunning))
+	test.AssertNil(t, pt.Set("live", []byte("v1")))
+
+	// the old key missing locally has expired and is not divergent
+	report, err := pt.compareWithChangelog(ctx, 2, 1, false)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, report.Checked, 1)
+	test.AssertEqual(t, report.Divergent(), 0)
+	test.AssertEqual(t, pt.stats.Retention, time.Hour)
+}
@@ -0,0 +1,284 @@
+package goka
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/storage"
+)
+
+// TableExpiresHeader is the header of group table messages containing the time the key
+// expires in milliseconds since the epoch, see SetValueWithTTL.
+const TableExpiresHeader = "goka-table-expires"
+
+// keyExpirySuffix is appended to the table topic to build the storage of the expiry
+// times of its keys
+const keyExpirySuffix = ".ttl"
+
+// keyExpiry stores the expiry times of the keys of a partition table with a TTL. It is
+// stored in its own storage next to the table's storage and updated with every recovered
+// message and every write of the processor.
+type keyExpiry struct {
+	// the batch of the sidecar collects the expiry times while recovering
+	sidecar
+	// overlay keeps the expiry times set by a read-only processor instead of the
+	// storage, if set. Removed expiry times are kept with the zero time.
+	overlay map[string]time.Time
+}
+
+func newKeyExpiry(builder storage.Builder) *keyExpiry {
+	return &keyExpiry{
+		sidecar: newSidecar(builder, keyExpirySuffix, "key expiry"),
+	}
+}
+
+// add sets the expiry time of the key, the zero time removing it.
+func (ke *keyExpiry) add(key string, expires time.Time) {
+	ke.m.Lock()
+	defer ke.m.Unlock()
+	if expires.IsZero() {
+		ke.batch.Delete(key)
+		return
+	}
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], uint64(expires.UnixNano()))
+	ke.batch.Set(key, data[:])
+}
+
+// set sets the expiry time of a key written by the processor, the zero time removing it.
+func (ke *keyExpiry) set(key string, expires time.Time) error {
+	ke.m.Lock()
+	if ke.overlay != nil {
+		ke.overlay[key] = expires
+		ke.m.Unlock()
+		return nil
+	}
+	ke.m.Unlock()
+	ke.add(key, expires)
+	return ke.flush()
+}
+
+// flush writes the added expiry times.
+func (ke *keyExpiry) flush() error {
+	ke.m.Lock()
+	defer ke.m.Unlock()
+	return ke.writeBatch()
+}
+
+// expires returns the expiry time of the key and whether it has one.
+func (ke *keyExpiry) expires(key string) (time.Time, bool, error) {
+	ke.m.Lock()
+	defer ke.m.Unlock()
+	if expires, ok := ke.overlay[key]; ok {
+		return expires, !expires.IsZero(), nil
+	}
+	data, err := ke.st.Get(key)
+	if err != nil || data == nil {
+		return time.Time{}, false, err
+	}
+	if len(data) != 8 {
+		return time.Time{}, false, fmt.Errorf("invalid expiry of key %s: %w", key, storage.ErrCorrupted)
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(data))), true, nil
+}
+
+// expired returns the keys that expired at now.
+func (ke *keyExpiry) expired(now time.Time) ([]string, error) {
+	ke.m.Lock()
+	defer ke.m.Unlock()
+	iter, err := ke.st.Iterator()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating key expiry: %v", err)
+	}
+	defer iter.Release()
+
+	var keys []string
+	for iter.Next() {
+		if _, ok := ke.overlay[string(iter.Key())]; ok {
+			continue
+		}
+		data, err := iter.Value()
+		if err != nil {
+			return nil, fmt.Errorf("error reading expiry of key %s: %v", iter.Key(), err)
+		}
+		if len(data) != 8 {
+			return nil, fmt.Errorf("invalid expiry of key %s: %w", iter.Key(), storage.ErrCorrupted)
+		}
+		if !now.Before(time.Unix(0, int64(binary.BigEndian.Uint64(data)))) {
+			keys = append(keys, string(iter.Key()))
+		}
+	}
+	for key, expires := range ke.overlay {
+		if !expires.IsZero() && !now.Before(expires) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, iter.Err()
+}
+
+// expiresHeader returns the expiry time of a table message from its headers, which is
+// zero if the message has none.
+func expiresHeader(hdr Headers) (time.Time, error) {
+	raw, ok := hdr[TableExpiresHeader]
+	if !ok {
+		return time.Time{}, nil
+	}
+	millis, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid table expiry header %q: %v", raw, err)
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), nil
+}
+
+// expiryHeaders adds the expiry time to the headers of a table message, if not zero.
+func expiryHeaders(hdr Headers, expires time.Time) Headers {
+	if expires.IsZero() {
+		return hdr
+	}
+	return hdr.Merged(Headers{TableExpiresHeader: []byte(strconv.FormatInt(expires.UnixNano()/int64(time.Millisecond), 10))})
+}
+
+// configureKeyTTL makes the table store the expiry times of its keys in a storage built
+// by the table's storage builder.
+func (p *PartitionTable) configureKeyTTL() {
+	p.expiry = newKeyExpiry(p.builder)
+}
+
+// addRecoveredExpiry adds the expiry time of a recovered message, if TTLs are enabled.
+func (p *PartitionTable) addRecoveredExpiry(key string, value []byte, hdr Headers) error {
+	if p.expiry == nil {
+		return nil
+	}
+	expires, err := expiresHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("Error reading expiry of key %s while recovering from the log: %v", key, err)
+	}
+	if value == nil {
+		expires = time.Time{}
+	}
+	p.expiry.add(key, expires)
+	return nil
+}
+
+// flushExpiry writes the recovered expiry times, if TTLs are enabled.
+func (p *PartitionTable) flushExpiry() error {
+	if p.expiry == nil {
+		return nil
+	}
+	if err := p.expiry.flush(); err != nil {
+		return fmt.Errorf("Error updating key expiry while recovering from the log: %v", err)
+	}
+	return nil
+}
+
+// setKeyExpiry sets the expiry time of the key written by the processor, the zero time
+// removing it.
+func (p *PartitionTable) setKeyExpiry(key string, expires time.Time) error {
+	if p.expiry == nil {
+		if !expires.IsZero() {
+			return fmt.Errorf("cannot set value with TTL without WithTableTTL")
+		}
+		return nil
+	}
+	return p.expiry.set(key, expires)
+}
+
+// runKeyExpiry deletes the expired keys of the group table every interval until the
+// context is done.
+func (pp *PartitionProcessor) runKeyExpiry(ctx context.Context) error {
+	ticker := time.NewTicker(pp.opts.tableTTLInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		deleted, err := pp.expireKeys(ctx, time.Now())
+		if err != nil {
+			return fmt.Errorf("error expiring keys of partition %d: %v", pp.partition, err)
+		}
+		if deleted > 0 {
+			pp.log.Debugf("deleted %d keys after their TTL", deleted)
+		}
+	}
+}
+
+// expireKeys deletes the keys of the group table that expired at now in batches,
+// blocking the processing loop while deleting.
+func (pp *PartitionProcessor) expireKeys(ctx context.Context, now time.Time) (int, error) {
+	keys, err := pp.table.expiry.expired(now)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int
+	for len(keys) > 0 {
+		select {
+		case <-ctx.Done():
+			return deleted, nil
+		default:
+		}
+
+		n := len(keys)
+		if n > tableGCBatchSize {
+			n = tableGCBatchSize
+		}
+		batchDeleted, err := pp.deleteExpiredKeys(ctx, keys[:n], now)
+		deleted += batchDeleted
+		if err != nil {
+			return deleted, err
+		}
+		keys = keys[n:]
+	}
+	return deleted, nil
+}
+
+// deleteExpiredKeys deletes the passed keys if they are still expired, locally and in
+// the table topic by emitting a tombstone.
+func (pp *PartitionProcessor) deleteExpiredKeys(ctx context.Context, keys []string, now time.Time) (int, error) {
+	pp.tableMutex.Lock()
+	defer pp.tableMutex.Unlock()
+
+	var deleted int
+	for _, key := range keys {
+		// the key might have been set again since it was found to be expired
+		expires, ok, err := pp.table.expiry.expires(key)
+		if err != nil {
+			return deleted, err
+		}
+		if !ok || now.Before(expires) {
+			continue
+		}
+
+		if err := pp.table.deleteKey(key); err != nil {
+			return deleted, err
+		}
+		deleted++
+
+		if pp.graph.isEphemeralTable() {
+			continue
+		}
+
+		// If the tombstone gets lost, the key is restored with its expiry time on the
+		// next recovery and deleted again.
+		key := key
+		topic := pp.graph.GroupTable().Topic()
+		pp.producer.EmitWithHeaders(topic, key, nil, pp.opts.producerDefaultHeaders).ThenWithMessage(func(msg *sarama.ProducerMessage, err error) {
+			if err == nil && msg != nil {
+				err = pp.table.storeNewestOffset(msg.Offset)
+			}
+			if err != nil {
+				pp.log.Printf("error emitting tombstone for key %s to %s: %v", key, topic, err)
+			}
+		})
+		pp.enqueueTrackOutputStats(ctx, topic, 0)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,95 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+func TestKeyExpiry(t *testing.T) {
+	var (
+		now = time.Now()
+		pt  = &PartitionTable{
+			topic: "table",
+			st:    &storageProxy{Storage: storage.NewMemory(), update: DefaultUpdate},
+			builder: func(topic string, partition int32) (storage.Storage, error) {
+				test.AssertEqual(t, topic, "table"+keyExpirySuffix)
+				return storage.NewMemory(), nil
+			},
+		}
+	)
+
+	// values with TTL require the key expiry
+	test.AssertNotNil(t, pt.setKeyExpiry("a", now))
+	test.AssertNil(t, pt.setKeyExpiry("a", time.Time{}))
+
+	pt.configureKeyTTL()
+	test.AssertNil(t, pt.expiry.open("table", 0))
+	defer pt.expiry.close()
+
+	// the expiry times are recovered from the headers
+	hdr := expiryHeaders(nil, now.Add(-time.Second))
+	test.AssertNil(t, pt.storeEvent("a", []byte("1"), 0, hdr, time.Time{}))
+	test.AssertNil(t, pt.storeEvent("b", []byte("2"), 1, expiryHeaders(nil, now.Add(time.Hour)), time.Time{}))
+	test.AssertNil(t, pt.storeEvent("c", []byte("3"), 2, nil, time.Time{}))
+
+	expires, ok, err := pt.expiry.expires("a")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, expires.UnixNano()/int64(time.Millisecond), now.Add(-time.Second).UnixNano()/int64(time.Millisecond))
+	_, ok, err = pt.expiry.expires("c")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, ok)
+
+	keys, err := pt.expiry.expired(now)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, keys, []string{"a"})
+
+	// tombstones and values without TTL remove the expiry time
+	test.AssertNil(t, pt.storeEvent("a", nil, 3, hdr, time.Time{}))
+	test.AssertNil(t, pt.storeEvent("b", []byte("2"), 4, nil, time.Time{}))
+	keys, err = pt.expiry.expired(now.Add(2 * time.Hour))
+	test.AssertNil(t, err)
+	test.AssertTrue(t, keys == nil)
+
+	// invalid headers fail the recovery
+	test.AssertNotNil(t, pt.storeEvent("d", []byte("4"), 5, Headers{TableExpiresHeader: []byte("x")}, time.Time{}))
+}
+
+func TestKeyExpiry_readOnly(t *testing.T) {
+	var (
+		now = time.Now()
+		ttl = storage.NewMemory()
+		pt  = &PartitionTable{
+			topic: "table",
+			st:    &storageProxy{Storage: storage.NewMemory(), update: DefaultUpdate},
+			builder: func(topic string, partition int32) (storage.Storage, error) {
+				return ttl, nil
+			},
+		}
+	)
+	pt.configureKeyTTL()
+	pt.configureReadOnly()
+	test.AssertNil(t, pt.expiry.open("table", 0))
+	defer pt.expiry.close()
+	test.AssertNil(t, pt.storeEvent("a", []byte("1"), 0, expiryHeaders(nil, now.Add(time.Hour)), time.Time{}))
+
+	// the writes of the processor are kept in memory
+	test.AssertNil(t, pt.setKeyExpiry("a", time.Time{}))
+	test.AssertNil(t, pt.setKeyExpiry("b", now.Add(-time.Second)))
+	has, err := ttl.Has("a")
+	test.AssertNil(t, err)
+	test.AssertTrue(t, has)
+	has, err = ttl.Has("b")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, has)
+
+	_, ok, err := pt.expiry.expires("a")
+	test.AssertNil(t, err)
+	test.AssertFalse(t, ok)
+	keys, err := pt.expiry.expired(now.Add(2 * time.Hour))
+	test.AssertNil(t, err)
+	test.AssertEqual(t, keys, []string{"b"})
+}
@@ -0,0 +1,136 @@
+package goka
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrVersionNotRetained is returned when querying a version of a key that is
+// older than the retained versions.
+var ErrVersionNotRetained = errors.New("version not retained")
+
+// tableVersion is the value of a key starting at a point in time.
+// A nil value marks a deletion.
+type tableVersion struct {
+	ts    time.Time
+	value []byte
+}
+
+// keyVersions holds the versions of one key ordered by timestamp
+type keyVersions struct {
+	versions []tableVersion
+	// truncated is set when older versions were dropped
+	truncated bool
+}
+
+// versionStore retains previous versions of the keys of a partition table
+// in memory, built from the messages consumed from the table topic.
+type versionStore struct {
+	m           sync.RWMutex
+	maxVersions int
+	retention   time.Duration
+	keys        map[string]*keyVersions
+	// since is the timestamp of the first tracked message. Versions before
+	// are unknown.
+	since time.Time
+	// fromOldest is set if the tracked messages start at the oldest offset of the
+	// partition, i.e. keys did not exist before their first version.
+	fromOldest bool
+}
+
+func newVersionStore(maxVersions int, retention time.Duration) *versionStore {
+	return &versionStore{
+		maxVersions: maxVersions,
+		retention:   retention,
+		keys:        make(map[string]*keyVersions),
+	}
+}
+
+// start is called when the partition table starts loading messages. fromOldest is
+// set if the table loads from the oldest offset into an empty storage.
+func (vs *versionStore) start(fromOldest bool) {
+	vs.m.Lock()
+	defer vs.m.Unlock()
+	if vs.since.IsZero() {
+		vs.fromOldest = fromOldest
+	}
+}
+
+// add adds a new version of key starting at ts
+func (vs *versionStore) add(key string, value []byte, ts time.Time) {
+	vs.m.Lock()
+	defer vs.m.Unlock()
+
+	if vs.since.IsZero() || ts.Before(vs.since) {
+		vs.since = ts
+	}
+
+	kv, ok := vs.keys[key]
+	if !ok {
+		kv = new(keyVersions)
+		vs.keys[key] = kv
+	}
+
+	// messages are usually in order, but timestamps set by the producer might not be
+	idx := sort.Search(len(kv.versions), func(i int) bool {
+		return kv.versions[i].ts.After(ts)
+	})
+	kv.versions = append(kv.versions, tableVersion{})
+	copy(kv.versions[idx+1:], kv.versions[idx:])
+	kv.versions[idx] = tableVersion{ts: ts, value: value}
+
+	vs.prune(kv, time.Now())
+}
+
+// prune drops versions exceeding the maximum number of versions or the retention.
+// The newest version before the retention window is kept, as it is valid at the
+// start of the window.
+func (vs *versionStore) prune(kv *keyVersions, now time.Time) {
+	drop := 0
+	if vs.maxVersions > 0 && len(kv.versions) > vs.maxVersions {
+		drop = len(kv.versions) - vs.maxVersions
+	}
+	if vs.retention > 0 {
+		cutoff := now.Add(-vs.retention)
+		for i := drop; i < len(kv.versions)-1 && !kv.versions[i+1].ts.After(cutoff); i++ {
+			drop = i + 1
+		}
+	}
+	if drop > 0 {
+		kv.versions = append(kv.versions[:0], kv.versions[drop:]...)
+		kv.truncated = true
+	}
+}
+
+// getAsOf returns the value of key valid at ts, or nil if the key did not exist.
+// Keys without versions did not change since tracking started, so their value is read
+// with current. Versions are added before the value is stored, so current is called
+// while holding the lock. It returns ErrVersionNotRetained if the version is not
+// retained anymore or is older than the tracked messages.
+func (vs *versionStore) getAsOf(key string, ts time.Time, current func(key string) ([]byte, error)) ([]byte, error) {
+	vs.m.RLock()
+	defer vs.m.RUnlock()
+
+	if vs.since.IsZero() || ts.Before(vs.since) {
+		return nil, ErrVersionNotRetained
+	}
+
+	kv, ok := vs.keys[key]
+	if !ok {
+		return current(key)
+	}
+
+	idx := sort.Search(len(kv.versions), func(i int) bool {
+		return kv.versions[i].ts.After(ts)
+	})
+	if idx == 0 {
+		// the value before the first version is only known if it did not exist
+		if kv.truncated || !vs.fromOldest {
+			return nil, ErrVersionNotRetained
+		}
+		return nil, nil
+	}
+	return kv.versions[idx-1].value, nil
+}
@@ -0,0 +1,111 @@
+package goka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestVersionStore(t *testing.T) {
+	var (
+		t0 = time.Now().Add(-time.Hour)
+		t1 = t0.Add(time.Minute)
+		t2 = t0.Add(2 * time.Minute)
+	)
+
+	noCurrent := func(key string) ([]byte, error) {
+		t.Fatalf("unexpected read of the current value of %s", key)
+		return nil, nil
+	}
+
+	t.Run("as-of", func(t *testing.T) {
+		vs := newVersionStore(10, 0)
+		vs.start(true)
+		vs.add("key", []byte("v1"), t0)
+		vs.add("key", []byte("v2"), t1)
+		vs.add("key", nil, t2)
+		vs.add("other", []byte("o1"), t1)
+
+		value, err := vs.getAsOf("key", t0.Add(time.Second), noCurrent)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "v1")
+
+		value, err = vs.getAsOf("key", t1, noCurrent)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "v2")
+
+		// deleted
+		value, err = vs.getAsOf("key", t2.Add(time.Second), noCurrent)
+		test.AssertNil(t, err)
+		test.AssertTrue(t, value == nil)
+
+		// did not exist yet
+		value, err = vs.getAsOf("other", t0, noCurrent)
+		test.AssertNil(t, err)
+		test.AssertTrue(t, value == nil)
+
+		// before tracking started
+		_, err = vs.getAsOf("key", t0.Add(-time.Second), noCurrent)
+		test.AssertEqual(t, err, ErrVersionNotRetained)
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		vs := newVersionStore(10, 0)
+		vs.start(false)
+		vs.add("key", []byte("v1"), t1)
+
+		// keys without versions did not change since tracking started
+		value, err := vs.getAsOf("other", t1, func(key string) ([]byte, error) {
+			return []byte("current"), nil
+		})
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "current")
+
+		// the value before the first version is unknown if tracking did not start
+		// at the oldest offset
+		_, err = vs.getAsOf("key", t1.Add(-time.Second), noCurrent)
+		test.AssertEqual(t, err, ErrVersionNotRetained)
+	})
+
+	t.Run("out-of-order", func(t *testing.T) {
+		vs := newVersionStore(10, 0)
+		vs.add("key", []byte("v2"), t1)
+		vs.add("key", []byte("v1"), t0)
+
+		value, err := vs.getAsOf("key", t0, noCurrent)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "v1")
+		value, err = vs.getAsOf("key", t2, noCurrent)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "v2")
+	})
+
+	t.Run("max-versions", func(t *testing.T) {
+		vs := newVersionStore(2, 0)
+		vs.add("key", []byte("v1"), t0)
+		vs.add("key", []byte("v2"), t1)
+		vs.add("key", []byte("v3"), t2)
+
+		_, err := vs.getAsOf("key", t0, noCurrent)
+		test.AssertEqual(t, err, ErrVersionNotRetained)
+		value, err := vs.getAsOf("key", t1, noCurrent)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "v2")
+	})
+
+	t.Run("retention", func(t *testing.T) {
+		vs := newVersionStore(0, 30*time.Minute)
+		vs.add("key", []byte("v1"), t0)
+		vs.add("key", []byte("v2"), t1)
+		vs.add("key", []byte("v3"), time.Now().Add(-time.Minute))
+
+		// v2 is still valid at the start of the retention window
+		value, err := vs.getAsOf("key", time.Now().Add(-20*time.Minute), noCurrent)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, string(value), "v2")
+
+		_, err = vs.getAsOf("key", t0, noCurrent)
+		test.AssertEqual(t, err, ErrVersionNotRetained)
+	})
+}
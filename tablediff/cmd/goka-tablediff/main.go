@@ -0,0 +1,138 @@
+// goka-tablediff compares two goka tables key by key, each read either from a
+// table topic or from a local LevelDB storage, and prints a summary of the
+// differences. It exits with status 1 if the tables differ.
+//
+//	goka-tablediff -left-brokers old:9092 -right-brokers new:9092 -topic user-table
+//	goka-tablediff -left-brokers localhost:9092 -topic user-table -partition 3 -right-storage /tmp/goka/user-table.3
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/storage"
+	"github.com/lovoo/goka/tablediff"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+var (
+	leftBrokers  = flag.String("left-brokers", "", "comma separated brokers of the left table topic")
+	leftTopic    = flag.String("left-topic", "", "left table topic (defaults to -topic)")
+	leftStorage  = flag.String("left-storage", "", "path of the left LevelDB storage instead of a table topic")
+	rightBrokers = flag.String("right-brokers", "", "comma separated brokers of the right table topic")
+	rightTopic   = flag.String("right-topic", "", "right table topic (defaults to -topic)")
+	rightStorage = flag.String("right-storage", "", "path of the right LevelDB storage instead of a table topic")
+	topic        = flag.String("topic", "", "table topic of both sides")
+	partition    = flag.Int("partition", -1, "only read this partition of the table topics")
+	codecName    = flag.String("codec", "bytes", "codec to compare values with: bytes, string or int64")
+	maxKeys      = flag.Int("keys", 20, "maximum number of differing keys to print per category")
+)
+
+func main() {
+	flag.Parse()
+
+	valueCodec, err := codecByName(*codecName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		<-sigs
+		cancel()
+	}()
+
+	left, err := read(ctx, *leftBrokers, orDefault(*leftTopic, *topic), *leftStorage)
+	if err != nil {
+		log.Fatalf("error reading left table: %v", err)
+	}
+	right, err := read(ctx, *rightBrokers, orDefault(*rightTopic, *topic), *rightStorage)
+	if err != nil {
+		log.Fatalf("error reading right table: %v", err)
+	}
+
+	report, err := tablediff.Diff(left, right, valueCodec)
+	if err != nil {
+		log.Fatalf("error comparing tables: %v", err)
+	}
+
+	fmt.Println(report)
+	printKeys("only left", report.OnlyLeft)
+	printKeys("only right", report.OnlyRight)
+	printKeys("different", report.Different)
+	if !report.Identical() {
+		os.Exit(1)
+	}
+}
+
+func read(ctx context.Context, brokers, topic, path string) (tablediff.Snapshot, error) {
+	if path != "" {
+		db, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true})
+		if err != nil {
+			return nil, fmt.Errorf("error opening leveldb %s: %v", path, err)
+		}
+		st, err := storage.New(db)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		return tablediff.ReadStorage(st)
+	}
+
+	if brokers == "" || topic == "" {
+		return nil, fmt.Errorf("either a storage path or brokers and topic are required")
+	}
+	client, err := sarama.NewClient(strings.Split(brokers, ","), goka.DefaultConfig())
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+	defer client.Close()
+
+	if *partition >= 0 {
+		return tablediff.ReadTopic(ctx, client, topic, int32(*partition))
+	}
+	return tablediff.ReadTopic(ctx, client, topic)
+}
+
+func codecByName(name string) (goka.Codec, error) {
+	switch name {
+	case "bytes":
+		return nil, nil
+	case "string":
+		return new(codec.String), nil
+	case "int64":
+		return new(codec.Int64), nil
+	default:
+		return nil, fmt.Errorf("unknown codec %s", name)
+	}
+}
+
+func orDefault(value, def string) string {
+	if value != "" {
+		return value
+	}
+	return def
+}
+
+func printKeys(category string, keys []string) {
+	for i, key := range keys {
+		if i == *maxKeys {
+			fmt.Printf("%s: ... %d more\n", category, len(keys)-i)
+			return
+		}
+		fmt.Printf("%s: %s\n", category, key)
+	}
+}
@@ -0,0 +1,110 @@
+// Package tablediff compares goka tables key by key, e.g. to validate that a table
+// was copied completely when migrating between clusters or environments.
+//
+// A table is read into a snapshot from a table topic (ReadTopic) or a local
+// storage (ReadStorage). Two snapshots are then compared with Diff:
+//
+//	left, err := tablediff.ReadTopic(ctx, oldClient, "user-table")
+//	...
+//	right, err := tablediff.ReadTopic(ctx, newClient, "user-table")
+//	...
+//	report, err := tablediff.Diff(left, right, new(UserCodec))
+//	...
+//	fmt.Println(report)
+package tablediff
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/lovoo/goka"
+)
+
+// Snapshot contains the encoded values of a table by key.
+type Snapshot map[string][]byte
+
+// Report is the result of comparing two table snapshots.
+type Report struct {
+	// Left and Right are the number of keys of the compared snapshots
+	Left  int
+	Right int
+	// Equal is the number of keys with equal values in both snapshots
+	Equal int
+	// OnlyLeft and OnlyRight contain the keys missing in the other snapshot
+	OnlyLeft  []string
+	OnlyRight []string
+	// Different contains the keys with different values
+	Different []string
+}
+
+// Identical returns true if both snapshots contain the same keys with equal values.
+func (r *Report) Identical() bool {
+	return len(r.OnlyLeft) == 0 && len(r.OnlyRight) == 0 && len(r.Different) == 0
+}
+
+// String returns a summary of the report.
+func (r *Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "left: %d keys, right: %d keys, equal: %d", r.Left, r.Right, r.Equal)
+	fmt.Fprintf(&sb, ", only left: %d, only right: %d, different: %d", len(r.OnlyLeft), len(r.OnlyRight), len(r.Different))
+	return sb.String()
+}
+
+// Diff compares the snapshots key by key. Values are equal if they're encoded
+// equally or, if a codec is passed, if the decoded values are deeply equal. The
+// latter allows codecs with a non-deterministic encoding, e.g. of maps.
+func Diff(left, right Snapshot, codec goka.Codec) (*Report, error) {
+	report := &Report{
+		Left:  len(left),
+		Right: len(right),
+	}
+
+	for key, leftValue := range left {
+		rightValue, ok := right[key]
+		if !ok {
+			report.OnlyLeft = append(report.OnlyLeft, key)
+			continue
+		}
+		equal, err := equalValues(leftValue, rightValue, codec)
+		if err != nil {
+			return nil, fmt.Errorf("error comparing key %s: %v", key, err)
+		}
+		if equal {
+			report.Equal++
+		} else {
+			report.Different = append(report.Different, key)
+		}
+	}
+	for key := range right {
+		if _, ok := left[key]; !ok {
+			report.OnlyRight = append(report.OnlyRight, key)
+		}
+	}
+
+	sort.Strings(report.OnlyLeft)
+	sort.Strings(report.OnlyRight)
+	sort.Strings(report.Different)
+	return report, nil
+}
+
+func equalValues(left, right []byte, codec goka.Codec) (bool, error) {
+	if bytes.Equal(left, right) {
+		return true, nil
+	}
+	if codec == nil {
+		return false, nil
+	}
+
+	leftValue, err := codec.Decode(left)
+	if err != nil {
+		return false, fmt.Errorf("error decoding left value: %v", err)
+	}
+	rightValue, err := codec.Decode(right)
+	if err != nil {
+		return false, fmt.Errorf("error decoding right value: %v", err)
+	}
+	return reflect.DeepEqual(leftValue, rightValue), nil
+}
@@ -0,0 +1,80 @@
+package tablediff
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/storage"
+)
+
+type jsonCodec struct{}
+
+func (c *jsonCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (c *jsonCodec) Decode(data []byte) (interface{}, error) {
+	var value map[string]interface{}
+	return value, json.Unmarshal(data, &value)
+}
+
+func TestDiff(t *testing.T) {
+	left := Snapshot{
+		"equal":     []byte(`{"a":1,"b":2}`),
+		"reordered": []byte(`{"a":1,"b":2}`),
+		"different": []byte(`{"a":1}`),
+		"left":      []byte(`{}`),
+	}
+	right := Snapshot{
+		"equal":     []byte(`{"a":1,"b":2}`),
+		"reordered": []byte(`{"b":2,"a":1}`),
+		"different": []byte(`{"a":2}`),
+		"right":     []byte(`{}`),
+	}
+
+	t.Run("bytes", func(t *testing.T) {
+		report, err := Diff(left, right, nil)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, report.Left, 4)
+		test.AssertEqual(t, report.Right, 4)
+		test.AssertEqual(t, report.Equal, 1)
+		test.AssertEqual(t, report.OnlyLeft, []string{"left"})
+		test.AssertEqual(t, report.OnlyRight, []string{"right"})
+		test.AssertEqual(t, report.Different, []string{"different", "reordered"})
+		test.AssertFalse(t, report.Identical())
+		test.AssertEqual(t, report.String(), "left: 4 keys, right: 4 keys, equal: 1, only left: 1, only right: 1, different: 2")
+	})
+
+	t.Run("codec", func(t *testing.T) {
+		report, err := Diff(left, right, new(jsonCodec))
+		test.AssertNil(t, err)
+		test.AssertEqual(t, report.Equal, 2)
+		test.AssertEqual(t, report.Different, []string{"different"})
+	})
+
+	t.Run("decode-error", func(t *testing.T) {
+		_, err := Diff(Snapshot{"key": []byte("{")}, Snapshot{"key": []byte("}")}, new(jsonCodec))
+		test.AssertNotNil(t, err)
+	})
+
+	t.Run("identical", func(t *testing.T) {
+		report, err := Diff(left, left, nil)
+		test.AssertNil(t, err)
+		test.AssertTrue(t, report.Identical())
+	})
+}
+
+func TestReadStorage(t *testing.T) {
+	st := storage.NewMemory()
+	test.AssertNil(t, st.Set("key-1", []byte("value-1")))
+	test.AssertNil(t, st.Set("key-2", []byte("value-2")))
+	test.AssertNil(t, st.SetOffset(10))
+
+	snapshot, err := ReadStorage(st)
+	test.AssertNil(t, err)
+	test.AssertEqual(t, snapshot, Snapshot{
+		"key-1": []byte("value-1"),
+		"key-2": []byte("value-2"),
+	})
+}
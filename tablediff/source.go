@@ -0,0 +1,150 @@
+package tablediff
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka/multierr"
+	"github.com/lovoo/goka/storage"
+)
+
+// idleTimeout limits how long reading a partition waits for the next message, e.g. if
+// the offsets before the high water mark are transaction markers that are never delivered.
+const idleTimeout = 30 * time.Second
+
+// ReadTopic reads the latest value of each key of the table topic up to the
+// current high water marks. Deleted keys are not part of the snapshot. If no
+// partitions are passed, all partitions of the topic are read.
+func ReadTopic(ctx context.Context, client sarama.Client, topic string, partitions ...int32) (Snapshot, error) {
+	if len(partitions) == 0 {
+		var err error
+		partitions, err = client.Partitions(topic)
+		if err != nil {
+			return nil, fmt.Errorf("error getting partitions of %s: %v", topic, err)
+		}
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("error creating consumer: %v", err)
+	}
+	defer consumer.Close()
+
+	var (
+		m        sync.Mutex
+		snapshot = make(Snapshot)
+	)
+	errg, ctx := multierr.NewErrGroup(ctx)
+	for _, partition := range partitions {
+		partition := partition
+		errg.Go(func() error {
+			values, err := readPartition(ctx, client, consumer, topic, partition)
+			if err != nil {
+				return err
+			}
+			m.Lock()
+			defer m.Unlock()
+			for key, value := range values {
+				snapshot[key] = value
+			}
+			return nil
+		})
+	}
+	if err := errg.Wait().NilOrError(); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func readPartition(ctx context.Context, client sarama.Client, consumer sarama.Consumer, topic string, partition int32) (Snapshot, error) {
+	values := make(Snapshot)
+
+	oldest, err := client.GetOffset(topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting oldest offset of %s/%d: %v", topic, partition, err)
+	}
+	hwm, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return nil, fmt.Errorf("error getting hwm of %s/%d: %v", topic, partition, err)
+	}
+	if oldest >= hwm {
+		return values, nil
+	}
+
+	cons, err := consumer.ConsumePartition(topic, partition, oldest)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming %s/%d: %v", topic, partition, err)
+	}
+	defer cons.Close()
+
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-idle.C:
+			return nil, fmt.Errorf("timeout reading %s/%d up to offset %d: no message for %v", topic, partition, hwm-1, idleTimeout)
+		case consErr, ok := <-cons.Errors():
+			if !ok {
+				return nil, fmt.Errorf("consumer of %s/%d closed unexpectedly", topic, partition)
+			}
+			return nil, fmt.Errorf("error reading %s/%d: %v", topic, partition, consErr)
+		case msg, ok := <-cons.Messages():
+			if !ok {
+				return nil, fmt.Errorf("consumer of %s/%d closed unexpectedly", topic, partition)
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(idleTimeout)
+
+			if msg.Value == nil {
+				delete(values, string(msg.Key))
+			} else {
+				values[string(msg.Key)] = msg.Value
+			}
+			if consumedUpTo(msg, cons, hwm) {
+				return values, nil
+			}
+		}
+	}
+}
+
+// consumedUpTo returns whether the partition is read up to hwm, or up to the high water
+// mark of the consumer if that is lower.
+func consumedUpTo(msg *sarama.ConsumerMessage, cons sarama.PartitionConsumer, hwm int64) bool {
+	if msg.Offset+1 >= hwm {
+		return true
+	}
+	consumerHwm := cons.HighWaterMarkOffset()
+	return consumerHwm > 0 && msg.Offset+1 >= consumerHwm
+}
+
+// ReadStorage reads all values of a local storage, e.g. of a processor or view
+// partition opened with storage.DefaultBuilder.
+func ReadStorage(st storage.Storage) (Snapshot, error) {
+	iter, err := st.Iterator()
+	if err != nil {
+		return nil, fmt.Errorf("error iterating storage: %v", err)
+	}
+	defer iter.Release()
+
+	snapshot := make(Snapshot)
+	for iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return nil, fmt.Errorf("error reading key %s: %v", iter.Key(), err)
+		}
+		// the iterator's buffers are reused
+		snapshot[string(iter.Key())] = append([]byte(nil), value...)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating storage: %v", err)
+	}
+	return snapshot, nil
+}
@@ -13,6 +13,8 @@ type consumerMock struct {
 	tester         *Tester
 	requiredTopics map[string]bool
 	partConsumers  map[string]*partConsumerMock
+	// topics whose partition consumer was closed
+	closedTopics map[string]bool
 }
 
 func newConsumerMock(tt *Tester) *consumerMock {
@@ -20,6 +22,7 @@ func newConsumerMock(tt *Tester) *consumerMock {
 		tester:         tt,
 		requiredTopics: make(map[string]bool),
 		partConsumers:  make(map[string]*partConsumerMock),
+		closedTopics:   make(map[string]bool),
 	}
 }
 
@@ -52,6 +55,7 @@ func (cm *consumerMock) ConsumePartition(topic string, partition int32, offset i
 		queue:    cm.tester.getOrCreateQueue(topic),
 		messages: make(chan *sarama.ConsumerMessage),
 		errors:   make(chan *sarama.ConsumerError),
+		done:     make(chan struct{}),
 		closer: func() error {
 			cm.Lock()
 			defer cm.Unlock()
@@ -59,6 +63,7 @@ func (cm *consumerMock) ConsumePartition(topic string, partition int32, offset i
 				return fmt.Errorf("partition consumer seems already closed")
 			}
 			delete(cm.partConsumers, topic)
+			cm.closedTopics[topic] = true
 			return nil
 		},
 	}
@@ -81,7 +86,8 @@ func (cm *consumerMock) waitRequiredConsumersStartup() {
 
 		for topic := range cm.requiredTopics {
 			_, ok := cm.partConsumers[topic]
-			if !ok {
+			// closed consumers of stopped views do not block
+			if !ok && !cm.closedTopics[topic] {
 				return false
 			}
 		}
@@ -93,6 +99,8 @@ func (cm *consumerMock) waitRequiredConsumersStartup() {
 }
 
 func (cm *consumerMock) requirePartConsumer(topic string) {
+	cm.Lock()
+	defer cm.Unlock()
 	cm.requiredTopics[topic] = true
 }
 
@@ -102,33 +110,61 @@ type partConsumerMock struct {
 	messages chan *sarama.ConsumerMessage
 	errors   chan *sarama.ConsumerError
 	queue    *queue
+
+	// mCatchup is held while catching up, so the channels are not closed while sending
+	mCatchup sync.Mutex
+	// done is closed when closing the consumer to stop catching up
+	done chan struct{}
+}
+
+// send sends the message unless the consumer is closed
+func (pcm *partConsumerMock) send(msg *sarama.ConsumerMessage) bool {
+	select {
+	case pcm.messages <- msg:
+		return true
+	case <-pcm.done:
+		return false
+	}
 }
 
 func (pcm *partConsumerMock) catchup() int {
+	pcm.mCatchup.Lock()
+	defer pcm.mCatchup.Unlock()
+
 	var numCatchup int
 	for _, msg := range pcm.queue.messagesFromOffset(pcm.hwm) {
-		pcm.messages <- &sarama.ConsumerMessage{
+		sent := pcm.send(&sarama.ConsumerMessage{
 			Headers:   msg.saramaHeaders(),
 			Key:       []byte(msg.key),
 			Value:     msg.value,
 			Topic:     pcm.queue.topic,
 			Partition: 0,
 			Offset:    msg.offset,
-		}
+			Timestamp: msg.timestamp,
+		})
 
 		// we'll send a nil that is being ignored by the partition_table to make sure the other message
 		// really went through the channel
-		pcm.messages <- nil
+		if !sent {
+			break
+		}
 		numCatchup++
 		pcm.hwm = msg.offset + 1
+		if !pcm.send(nil) {
+			break
+		}
 	}
 
 	return numCatchup
 }
 
 func (pcm *partConsumerMock) Close() error {
+	close(pcm.done)
+	// wait for a running catchup to stop before closing the channels
+	pcm.mCatchup.Lock()
 	close(pcm.messages)
 	close(pcm.errors)
+	pcm.mCatchup.Unlock()
 	return pcm.closer()
 }
 
@@ -15,6 +15,9 @@ import (
 type consumerGroup struct {
 	errs chan error
 
+	// ID of the consumer group
+	group string
+
 	// use the same offset counter for all topics
 	offset            int64
 	currentGeneration int32
@@ -34,30 +37,38 @@ const (
 	cgStateSetup
 	cgStateConsuming
 	cgStateCleaning
+	// cgStateClosed is the state after consuming stopped, which does not block the tester
+	cgStateClosed
 )
 
 func newConsumerGroup(t T, tt *Tester) *consumerGroup {
 	return &consumerGroup{
 		errs:  make(chan error, 1),
-		state: goka.NewSignal(cgStateStopped, cgStateRebalancing, cgStateSetup, cgStateConsuming, cgStateCleaning).SetState(cgStateStopped),
+		state: goka.NewSignal(cgStateStopped, cgStateRebalancing, cgStateSetup, cgStateConsuming, cgStateCleaning, cgStateClosed).SetState(cgStateStopped),
 		tt:    tt,
 	}
 }
 
 func (cg *consumerGroup) catchupAndWait() int {
-	if cg.currentSession == nil {
+	cg.mu.RLock()
+	session := cg.currentSession
+	cg.mu.RUnlock()
+	if session == nil {
+		if cg.state.IsState(cgStateClosed) {
+			return 0
+		}
 		panic("There is currently no session. Cannot catchup, but we shouldn't be at this point")
 	}
-	return cg.currentSession.catchupAndWait()
+	return session.catchupAndWait()
 }
 
 // Consume starts consuming from the consumergroup
 func (cg *consumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
-	if !cg.state.IsState(cgStateStopped) {
+	if !cg.state.IsState(cgStateStopped) && !cg.state.IsState(cgStateClosed) {
 		return fmt.Errorf("Tried to double-consume this consumer-group, which is not supported by the mock")
 	}
 	logger.Printf("consuming consumergroup with topics %v", topics)
-	defer cg.state.SetState(cgStateStopped)
+	defer cg.state.SetState(cgStateClosed)
 	if len(topics) == 0 {
 		return fmt.Errorf("no topics specified")
 	}
@@ -67,7 +78,9 @@ func (cg *consumerGroup) Consume(ctx context.Context, topics []string, handler s
 		cg.currentGeneration++
 		session := newCgSession(ctx, cg.currentGeneration, cg, topics)
 
+		cg.mu.Lock()
 		cg.currentSession = session
+		cg.mu.Unlock()
 
 		cg.state.SetState(cgStateSetup)
 		err := handler.Setup(session)
@@ -102,7 +115,9 @@ func (cg *consumerGroup) Consume(ctx context.Context, topics []string, handler s
 		errs.Collect(handler.Cleanup(session))
 
 		// remove current sessions
+		cg.mu.Lock()
 		cg.currentSession = nil
+		cg.mu.Unlock()
 
 		err = errs.NilOrError()
 		if err != nil {
@@ -134,8 +149,12 @@ func (cg *consumerGroup) Errors() <-chan error {
 	return cg.errs
 }
 
+// waitRunning waits until the group is consuming or stopped consuming
 func (cg *consumerGroup) waitRunning() {
-	<-cg.state.WaitForState(cgStateConsuming)
+	select {
+	case <-cg.state.WaitForState(cgStateConsuming):
+	case <-cg.state.WaitForState(cgStateClosed):
+	}
 }
 
 func (cg *consumerGroup) nextOffset() int64 {
@@ -246,6 +265,7 @@ func (cgs *cgSession) MarkOffset(topic string, partition int32, offset int64, me
 	}
 
 	cgs.queues[topic].setHwmIfNewer(offset + 1)
+	cgs.consumerGroup.tt.commit(cgs.consumerGroup.group, topic, offset+1, metadata)
 }
 
 func (cgs *cgSession) Commit() {
@@ -319,11 +339,12 @@ func (cgs *cgSession) pushMessageToClaim(claim *cgClaim, msg *message) {
 
 	select {
 	case claim.msgs <- &sarama.ConsumerMessage{
-		Headers: msg.saramaHeaders(),
-		Key:     []byte(msg.key),
-		Value:   msg.value,
-		Topic:   claim.Topic(),
-		Offset:  msg.offset,
+		Headers:   msg.saramaHeaders(),
+		Key:       []byte(msg.key),
+		Value:     msg.value,
+		Topic:     claim.Topic(),
+		Offset:    msg.offset,
+		Timestamp: msg.timestamp,
 	}:
 	// context closed already, so don't push as no consumer will be listening
 	case <-cgs.ctx.Done():
@@ -40,7 +40,9 @@ func (p *producerMock) Close() error {
 }
 
 // flushingProducer wraps the producer and
-// waits for all consumers after the Emit.
+// waits for all consumers after the Emit. Like Tester.Consume, it waits for the
+// consumers to be started first, so messages are not missed by consumers that are
+// being replaced, e.g. by views switching from recovery to catchup.
 type flushingProducer struct {
 	tester   *Tester
 	producer goka.Producer
@@ -49,6 +51,7 @@ type flushingProducer struct {
 // Emit using the underlying producer
 func (e *flushingProducer) EmitWithHeaders(topic string, key string, value []byte, header goka.Headers) *goka.Promise {
 	prom := e.producer.EmitWithHeaders(topic, key, value, header)
+	e.tester.waitStartup()
 	e.tester.waitForClients()
 	return prom
 }
@@ -56,6 +59,7 @@ func (e *flushingProducer) EmitWithHeaders(topic string, key string, value []byt
 // Emit using the underlying producer
 func (e *flushingProducer) Emit(topic string, key string, value []byte) *goka.Promise {
 	prom := e.producer.Emit(topic, key, value)
+	e.tester.waitStartup()
 	e.tester.waitForClients()
 	return prom
 }
@@ -2,16 +2,18 @@ package tester
 
 import (
 	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/lovoo/goka"
 )
 
 type message struct {
-	offset  int64
-	key     string
-	value   []byte
-	headers goka.Headers
+	offset    int64
+	key       string
+	value     []byte
+	headers   goka.Headers
+	timestamp time.Time
 }
 
 // Convert message headers to an array of SaramaHeaders
@@ -48,15 +50,16 @@ func (q *queue) Hwm() int64 {
 	return hwm
 }
 
-func (q *queue) push(key string, value []byte, hdr goka.Headers) int64 {
+func (q *queue) push(key string, value []byte, hdr goka.Headers, ts time.Time) int64 {
 	q.Lock()
 	defer q.Unlock()
 	offset := q.hwm
 	q.messages = append(q.messages, &message{
-		offset:  offset,
-		key:     key,
-		value:   value,
-		headers: hdr,
+		offset:    offset,
+		key:       key,
+		value:     value,
+		headers:   hdr,
+		timestamp: ts,
 	})
 	q.hwm++
 	return offset
@@ -0,0 +1,213 @@
+package tester
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/recording"
+)
+
+// Record is a recorded message, see package recording. Recordings of live topics are
+// written by sink.Recorder.
+type Record = recording.Record
+
+// ReplayResult is the outcome of a replay, which can be stored as JSON and compared
+// with the result of another version of the code.
+type ReplayResult struct {
+	// Tables contains the final values of all tables by table and key
+	Tables map[string]map[string][]byte `json:"tables"`
+	// Outputs contains the messages emitted to the tracked topics during the replay
+	Outputs map[string][]*Record `json:"outputs"`
+}
+
+// Replay consumes the recorded messages in the order of their timestamps and returns
+// the final table values and the messages emitted to the outputs while replaying.
+// Messages of the same topic partition are consumed in the order of their offsets.
+// The messages are consumed raw with their recorded headers and timestamps, so
+// ctx.Timestamp() returns the recorded time instead of the wall clock. Like Consume,
+// it blocks until all processors and views have processed each message, but does not
+// wait in between, so the recording is replayed at maximum speed.
+func (tt *Tester) Replay(records []*Record, outputs ...goka.Stream) *ReplayResult {
+	tt.waitStartup()
+
+	trackers := make(map[string]*QueueTracker, len(outputs))
+	for _, output := range outputs {
+		trackers[string(output)] = tt.NewQueueTracker(string(output))
+	}
+
+	for _, rec := range replayOrder(records) {
+		tt.pushMessage(rec.Topic, rec.Key, rec.Value, goka.Headers(rec.Headers), rec.Timestamp)
+		tt.waitForClients()
+	}
+
+	result := &ReplayResult{
+		Tables:  tt.tableValues(),
+		Outputs: make(map[string][]*Record, len(trackers)),
+	}
+	for topic, tracker := range trackers {
+		records := []*Record{}
+		for {
+			offset := tracker.NextOffset()
+			hdr, key, value, ok := tracker.NextRawWithHeaders()
+			if !ok {
+				break
+			}
+			records = append(records, &Record{
+				Topic:   topic,
+				Offset:  offset,
+				Key:     key,
+				Value:   value,
+				Headers: hdr,
+			})
+		}
+		result.Outputs[topic] = records
+	}
+	return result
+}
+
+// replayOrder merges the partitions of the records by timestamp. The records of a
+// partition keep the order of their offsets like when consuming the topic, even if
+// their timestamps are not ascending. Records with equal offsets keep their order.
+func replayOrder(records []*Record) []*Record {
+	type topicPartition struct {
+		topic     string
+		partition int32
+	}
+	var (
+		partitions [][]*Record
+		index      = make(map[topicPartition]int)
+	)
+	for _, rec := range records {
+		tp := topicPartition{rec.Topic, rec.Partition}
+		i, ok := index[tp]
+		if !ok {
+			i = len(partitions)
+			index[tp] = i
+			partitions = append(partitions, nil)
+		}
+		partitions[i] = append(partitions[i], rec)
+	}
+	for _, partition := range partitions {
+		partition := partition
+		sort.SliceStable(partition, func(i, j int) bool {
+			return partition[i].Offset < partition[j].Offset
+		})
+	}
+
+	sorted := make([]*Record, 0, len(records))
+	for len(sorted) < len(records) {
+		next := -1
+		for i, partition := range partitions {
+			if len(partition) > 0 && (next < 0 || partition[0].Timestamp.Before(partitions[next][0].Timestamp)) {
+				next = i
+			}
+		}
+		sorted = append(sorted, partitions[next][0])
+		partitions[next] = partitions[next][1:]
+	}
+	return sorted
+}
+
+// tableValues returns the values of all storages
+func (tt *Tester) tableValues() map[string]map[string][]byte {
+	tt.mStorages.Lock()
+	defer tt.mStorages.Unlock()
+
+	tables := make(map[string]map[string][]byte, len(tt.storages))
+	for table, st := range tt.storages {
+		values := make(map[string][]byte)
+		it, err := st.Iterator()
+		if err != nil {
+			tt.t.Fatalf("error iterating table %s: %v", table, err)
+		}
+		for it.Next() {
+			value, err := it.Value()
+			if err != nil {
+				tt.t.Fatalf("error reading value of table %s: %v", table, err)
+			}
+			values[string(it.Key())] = append([]byte(nil), value...)
+		}
+		it.Release()
+		tables[table] = values
+	}
+	return tables
+}
+
+// Diff returns the differences to another result, e.g. the result of the previous
+// version of the code, or nil if the results are equal. Output messages are compared
+// by key, value and headers in the order they were emitted.
+func (r *ReplayResult) Diff(other *ReplayResult) []string {
+	var diffs []string
+
+	for _, table := range unionKeys(r.Tables, other.Tables) {
+		values, otherValues := r.Tables[table], other.Tables[table]
+		for _, key := range unionKeys(values, otherValues) {
+			value, ok := values[key]
+			otherValue, otherOk := otherValues[key]
+			switch {
+			case !ok:
+				diffs = append(diffs, fmt.Sprintf("table %s: key %s missing", table, key))
+			case !otherOk:
+				diffs = append(diffs, fmt.Sprintf("table %s: key %s unexpected", table, key))
+			case !bytes.Equal(value, otherValue):
+				diffs = append(diffs, fmt.Sprintf("table %s: key %s has value %q, expected %q", table, key, value, otherValue))
+			}
+		}
+	}
+
+	for _, topic := range unionKeys(r.Outputs, other.Outputs) {
+		records, otherRecords := r.Outputs[topic], other.Outputs[topic]
+		if len(records) != len(otherRecords) {
+			diffs = append(diffs, fmt.Sprintf("output %s: %d messages, expected %d", topic, len(records), len(otherRecords)))
+		}
+		for i := 0; i < len(records) && i < len(otherRecords); i++ {
+			rec, otherRec := records[i], otherRecords[i]
+			if rec.Key != otherRec.Key || !bytes.Equal(rec.Value, otherRec.Value) || !equalHeaders(rec.Headers, otherRec.Headers) {
+				diffs = append(diffs, fmt.Sprintf("output %s: message %d is %s=%q, expected %s=%q", topic, i, rec.Key, rec.Value, otherRec.Key, otherRec.Value))
+			}
+		}
+	}
+	return diffs
+}
+
+func equalHeaders(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		otherValue, ok := b[key]
+		if !ok || !bytes.Equal(value, otherValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// unionKeys returns the sorted keys of two maps with string keys
+func unionKeys(a, b interface{}) []string {
+	set := make(map[string]struct{})
+	for _, m := range []interface{}{a, b} {
+		switch m := m.(type) {
+		case map[string]map[string][]byte:
+			for key := range m {
+				set[key] = struct{}{}
+			}
+		case map[string][]byte:
+			for key := range m {
+				set[key] = struct{}{}
+			}
+		case map[string][]*Record:
+			for key := range m {
+				set[key] = struct{}{}
+			}
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -5,15 +5,18 @@ import (
 	"hash"
 	"reflect"
 	"sync"
+	"time"
 
 	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
 	"github.com/lovoo/goka/storage"
 
 	"github.com/Shopify/sarama"
 )
 
 type emitOption struct {
-	headers goka.Headers
+	headers   goka.Headers
+	timestamp time.Time
 }
 
 // EmitOption defines a configuration option for emitting messages
@@ -32,6 +35,14 @@ func WithHeaders(hdr goka.Headers) EmitOption {
 	}
 }
 
+// WithTimestamp sets the timestamp of the message, e.g. to test the handling of old
+// messages. By default, messages have no timestamp.
+func WithTimestamp(ts time.Time) EmitOption {
+	return func(opts *emitOption) {
+		opts.timestamp = ts
+	}
+}
+
 func (opt *emitOption) applyOptions(opts ...EmitOption) {
 	for _, o := range opts {
 		o(opt)
@@ -75,6 +86,10 @@ type Tester struct {
 
 	mStorages sync.Mutex
 	storages  map[string]storage.Storage
+
+	// committed offsets by consumer group and topic
+	mCommits sync.RWMutex
+	commits  map[string]map[string]goka.CommittedOffset
 }
 
 // New creates a new tester instance
@@ -88,6 +103,7 @@ func New(t T) *Tester {
 		codecs:      make(map[string]goka.Codec),
 		topicQueues: make(map[string]*queue),
 		storages:    make(map[string]storage.Storage),
+		commits:     make(map[string]map[string]goka.CommittedOffset),
 	}
 	tt.tmgr = NewMockTopicManager(tt, 1, 1)
 	tt.producer = newProducerMock(tt.handleEmit)
@@ -121,6 +137,7 @@ func (tt *Tester) ConsumerGroupBuilder() goka.ConsumerGroupBuilder {
 			return nil, fmt.Errorf("Did not expect a group graph")
 		}
 
+		client.consumerGroup.group = group
 		return client.consumerGroup, nil
 	}
 }
@@ -160,12 +177,12 @@ func (tt *Tester) handleEmit(topic string, key string, value []byte, options ...
 	opts := new(emitOption)
 	opts.applyOptions(options...)
 	_, finisher := goka.NewPromiseWithFinisher()
-	offset := tt.pushMessage(topic, key, value, opts.headers)
+	offset := tt.pushMessage(topic, key, value, opts.headers, opts.timestamp)
 	return finisher(&sarama.ProducerMessage{Offset: offset}, nil)
 }
 
-func (tt *Tester) pushMessage(topic string, key string, data []byte, hdr goka.Headers) int64 {
-	return tt.getOrCreateQueue(topic).push(key, data, hdr)
+func (tt *Tester) pushMessage(topic string, key string, data []byte, hdr goka.Headers, ts time.Time) int64 {
+	return tt.getOrCreateQueue(topic).push(key, data, hdr, ts)
 }
 
 func (tt *Tester) ProducerBuilder() goka.ProducerBuilder {
@@ -204,6 +221,13 @@ func (tt *Tester) RegisterGroupGraph(gg *goka.GroupGraph) string {
 		tt.registerCodec(output.Topic(), output.Codec())
 	}
 
+	for _, outbox := range gg.OutboxStreams() {
+		tt.registerCodec(outbox.Topic(), outbox.Codec())
+	}
+	if len(gg.OutboxStreams()) > 0 {
+		tt.registerCodec(string(goka.OutboxTable(gg.Group())), new(codec.Bytes))
+	}
+
 	for _, join := range gg.JointTables() {
 		tt.registerCodec(join.Topic(), join.Codec())
 	}
@@ -211,6 +235,9 @@ func (tt *Tester) RegisterGroupGraph(gg *goka.GroupGraph) string {
 	if loop := gg.LoopStream(); loop != nil {
 		tt.registerCodec(loop.Topic(), loop.Codec())
 	}
+	for _, loop := range gg.NamedLoopStreams() {
+		tt.registerCodec(loop.Topic(), loop.Codec())
+	}
 
 	for _, lookup := range gg.LookupTables() {
 		tt.registerCodec(lookup.Topic(), lookup.Codec())
@@ -350,6 +377,28 @@ func (tt *Tester) ClearValues() {
 
 }
 
+// commit stores the offset committed by a consumer group
+func (tt *Tester) commit(group string, topic string, offset int64, metadata string) {
+	tt.mCommits.Lock()
+	defer tt.mCommits.Unlock()
+
+	if tt.commits[group] == nil {
+		tt.commits[group] = make(map[string]goka.CommittedOffset)
+	}
+	tt.commits[group][topic] = goka.CommittedOffset{
+		Offset:   offset,
+		Metadata: goka.ParseCommitMetadata(metadata),
+	}
+}
+
+// committedOffset returns the offset committed by a consumer group
+func (tt *Tester) committedOffset(group string, topic string) (goka.CommittedOffset, bool) {
+	tt.mCommits.RLock()
+	defer tt.mCommits.RUnlock()
+	offset, ok := tt.commits[group][topic]
+	return offset, ok
+}
+
 // NewQueueTracker creates a new queue tracker
 func (tt *Tester) NewQueueTracker(topic string) *QueueTracker {
 	return newQueueTracker(tt, tt.t, topic)
@@ -413,13 +462,13 @@ func (tt *Tester) Consume(topic string, key string, msg interface{}, options ...
 	opts.applyOptions(options...)
 	value := reflect.ValueOf(msg)
 	if msg == nil || (value.Kind() == reflect.Ptr && value.IsNil()) {
-		tt.pushMessage(topic, key, nil, opts.headers)
+		tt.pushMessage(topic, key, nil, opts.headers, opts.timestamp)
 	} else {
 		data, err := tt.codecForTopic(topic).Encode(msg)
 		if err != nil {
 			panic(fmt.Errorf("Error encoding value %v: %v", msg, err))
 		}
-		tt.pushMessage(topic, key, data, opts.headers)
+		tt.pushMessage(topic, key, data, opts.headers, opts.timestamp)
 	}
 
 	tt.waitForClients()
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/Shopify/sarama"
+	"github.com/lovoo/goka"
 )
 
 // MockTopicManager mimicks the behavior of the real topic manager
@@ -58,6 +59,15 @@ func (tm *MockTopicManager) GetOffset(topicName string, partitionID int32, time
 	}
 }
 
+// GetCommittedOffsets returns the offset of the topic's only partition committed by the group
+func (tm *MockTopicManager) GetCommittedOffsets(group string, topic string) (map[int32]goka.CommittedOffset, error) {
+	offsets := make(map[int32]goka.CommittedOffset)
+	if offset, ok := tm.tt.committedOffset(group, topic); ok {
+		offsets[0] = offset
+	}
+	return offsets, nil
+}
+
 // Close has no action on the mock
 func (tm *MockTopicManager) Close() error {
 	return nil
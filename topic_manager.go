@@ -29,6 +29,13 @@ type TopicManager interface {
 	Close() error
 }
 
+// PartitionOffsets contains the oldest offset and the high water mark, i.e.
+// the offset of the next message to be written, of a topic partition.
+type PartitionOffsets struct {
+	Oldest int64
+	Newest int64
+}
+
 type topicManager struct {
 	admin              sarama.ClusterAdmin
 	client             sarama.Client
@@ -135,6 +142,81 @@ func (m *topicManager) GetOffset(topic string, partitionID int32, time int64) (i
 	return m.client.GetOffset(topic, partitionID, time)
 }
 
+// GetOffsets returns the oldest and newest offset of all partitions of a topic using the
+// passed topic manager.
+func GetOffsets(tm TopicManager, topic string) (map[int32]PartitionOffsets, error) {
+	partitions, err := tm.Partitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("error getting partitions of topic %s: %v", topic, err)
+	}
+
+	offsets := make(map[int32]PartitionOffsets, len(partitions))
+	for _, partition := range partitions {
+		oldest, err := tm.GetOffset(topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("error getting oldest offset of %s/%d: %v", topic, partition, err)
+		}
+		newest, err := tm.GetOffset(topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("error getting newest offset of %s/%d: %v", topic, partition, err)
+		}
+		offsets[partition] = PartitionOffsets{
+			Oldest: oldest,
+			Newest: newest,
+		}
+	}
+	return offsets, nil
+}
+
+// GetCommittedOffsets returns the offsets of all partitions of a topic committed by the
+// consumer group, along with their metadata. It fails if the topic manager cannot list
+// committed offsets, which the default topic manager and the tester's topic manager can.
+func GetCommittedOffsets(tm TopicManager, group string, topic string) (map[int32]CommittedOffset, error) {
+	lister, ok := tm.(committedOffsetsLister)
+	if !ok {
+		return nil, fmt.Errorf("topic manager does not support listing committed offsets")
+	}
+	return lister.GetCommittedOffsets(group, topic)
+}
+
+// committedOffsetsLister is implemented by topic managers listing the committed offsets
+// of consumer groups, see GetCommittedOffsets.
+type committedOffsetsLister interface {
+	GetCommittedOffsets(group string, topic string) (map[int32]CommittedOffset, error)
+}
+
+func (m *topicManager) GetCommittedOffsets(group string, topic string) (map[int32]CommittedOffset, error) {
+	partitions, err := m.Partitions(topic)
+	if err != nil {
+		return nil, fmt.Errorf("error getting partitions of topic %s: %v", topic, err)
+	}
+
+	resp, err := m.admin.ListConsumerGroupOffsets(group, map[string][]int32{topic: partitions})
+	if err != nil {
+		return nil, fmt.Errorf("error listing offsets of group %s for topic %s: %v", group, topic, err)
+	}
+
+	offsets := make(map[int32]CommittedOffset, len(partitions))
+	for _, partition := range partitions {
+		block := resp.GetBlock(topic, partition)
+		if block == nil {
+			continue
+		}
+		if block.Err != sarama.ErrNoError {
+			return nil, fmt.Errorf("error getting offset of group %s for %s/%d: %v", group, topic, partition, block.Err)
+		}
+		// no offset committed yet
+		if block.Offset < 0 {
+			continue
+		}
+		offsets[partition] = CommittedOffset{
+			Offset:   block.Offset,
+			Metadata: ParseCommitMetadata(block.Metadata),
+		}
+	}
+	return offsets, nil
+}
+
 func (m *topicManager) createTopic(topic string, npar, rfactor int, config map[string]string) error {
 	m.topicManagerConfig.Logger.Debugf("creating topic %s with npar=%d, rfactor=%d, config=%#v", topic, npar, rfactor, config)
 	topicDetail := &sarama.TopicDetail{}
@@ -291,14 +373,17 @@ func (m *topicManager) EnsureTopicExists(topic string, npar, rfactor int, config
 }
 
 func (m *topicManager) EnsureTableExists(topic string, npar int) error {
-
+	config := map[string]string{
+		"cleanup.policy": m.topicManagerConfig.tableCleanupPolicy(),
+	}
+	if retention := m.topicManagerConfig.Table.Retention; retention > 0 {
+		config["retention.ms"] = fmt.Sprintf("%d", retention.Milliseconds())
+	}
 	return m.ensureExists(
 		topic,
 		npar,
 		m.topicManagerConfig.Table.Replication,
-		map[string]string{
-			"cleanup.policy": m.topicManagerConfig.tableCleanupPolicy(),
-		})
+		config)
 }
 
 // TMConfigMismatchBehavior configures how configuration mismatches of a topic (replication, num partitions, compaction) should be
@@ -322,8 +407,12 @@ type TopicManagerConfig struct {
 	Table  struct {
 		Replication int
 		// CleanupPolicy allows to overwrite the default cleanup policy for streams.
-		// Defaults to 'compact' if not set
+		// Defaults to 'compact' if not set, or 'compact,delete' if Retention is set.
 		CleanupPolicy string
+		// Retention sets retention.ms of tables, after which Kafka deletes old values
+		// of tables with cleanup.policy=compact,delete. Tables are retained forever if
+		// not set. Use WithTableRetention to expire the values in the local storage as well.
+		Retention time.Duration
 	}
 	Stream struct {
 		Replication int
@@ -348,6 +437,9 @@ func (tmc *TopicManagerConfig) tableCleanupPolicy() string {
 	if tmc.Table.CleanupPolicy != "" {
 		return tmc.Table.CleanupPolicy
 	}
+	if tmc.Table.Retention > 0 {
+		return "compact,delete"
+	}
 	return "compact"
 }
 
@@ -212,6 +212,51 @@ func TestTM_GetOffset(t *testing.T) {
 	})
 }
 
+func TestTM_GetOffsets(t *testing.T) {
+	t.Run("succeed", func(t *testing.T) {
+		tm, bm, ctrl := createTopicManager(t)
+		defer ctrl.Finish()
+		var (
+			topic = "some-topic"
+		)
+		bm.client.EXPECT().RefreshMetadata().Return(nil)
+		bm.client.EXPECT().Topics().Return([]string{topic}, nil)
+		bm.client.EXPECT().Partitions(topic).Return([]int32{0, 1}, nil)
+		bm.client.EXPECT().GetOffset(topic, int32(0), sarama.OffsetOldest).Return(int64(0), nil)
+		bm.client.EXPECT().GetOffset(topic, int32(0), sarama.OffsetNewest).Return(int64(10), nil)
+		bm.client.EXPECT().GetOffset(topic, int32(1), sarama.OffsetOldest).Return(int64(5), nil)
+		bm.client.EXPECT().GetOffset(topic, int32(1), sarama.OffsetNewest).Return(int64(20), nil)
+		offsets, err := GetOffsets(tm, topic)
+		test.AssertNil(t, err)
+		test.AssertEqual(t, offsets, map[int32]PartitionOffsets{
+			0: {Oldest: 0, Newest: 10},
+			1: {Oldest: 5, Newest: 20},
+		})
+	})
+	t.Run("fail", func(t *testing.T) {
+		tm, bm, ctrl := createTopicManager(t)
+		defer ctrl.Finish()
+		var (
+			topic = "some-topic"
+		)
+		bm.client.EXPECT().RefreshMetadata().Return(nil)
+		bm.client.EXPECT().Topics().Return([]string{topic}, nil)
+		bm.client.EXPECT().Partitions(topic).Return([]int32{0}, nil)
+		bm.client.EXPECT().GetOffset(topic, int32(0), sarama.OffsetOldest).Return(int64(0), errors.New("some-error"))
+		_, err := GetOffsets(tm, topic)
+		test.AssertNotNil(t, err)
+	})
+}
+
+func TestTM_GetCommittedOffsets(t *testing.T) {
+	ctrl := NewMockController(t)
+	defer ctrl.Finish()
+
+	// topic managers that cannot list committed offsets fail
+	_, err := GetCommittedOffsets(NewMockTopicManager(ctrl), "group", "topic")
+	test.AssertNotNil(t, err)
+}
+
 func TestTM_EnsureStreamExists(t *testing.T) {
 	t.Run("exists", func(t *testing.T) {
 		tm, bm, ctrl := createTopicManager(t)
@@ -268,6 +313,30 @@ func TestTM_EnsureStreamExists(t *testing.T) {
 	})
 }
 
+func TestTM_EnsureTableExists(t *testing.T) {
+	t.Run("retention", func(t *testing.T) {
+		tm, bm, ctrl := createTopicManager(t)
+		defer ctrl.Finish()
+		var (
+			topic = "some-table"
+			npar  = 1
+		)
+
+		tm.topicManagerConfig.Table.Replication = 1
+		tm.topicManagerConfig.Table.Retention = 24 * time.Hour
+		bm.client.EXPECT().RefreshMetadata().Return(nil)
+		bm.client.EXPECT().Topics().Return(nil, nil)
+		bm.admin.EXPECT().CreateTopic(topic, gomock.Any(), false).DoAndReturn(func(topic string, detail *sarama.TopicDetail, validateOnly bool) error {
+			test.AssertEqual(t, *detail.ConfigEntries["cleanup.policy"], "compact,delete")
+			test.AssertEqual(t, *detail.ConfigEntries["retention.ms"], "86400000")
+			return nil
+		})
+
+		err := tm.EnsureTableExists(topic, npar)
+		test.AssertNil(t, err)
+	})
+}
+
 func TestTM_createTopic(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		tm, bm, ctrl := createTopicManager(t)
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/lovoo/goka/multierr"
@@ -40,6 +42,10 @@ type Getter func(string) (interface{}, error)
 
 // View is a materialized (i.e. persistent) cache of a group table.
 type View struct {
+	// lookups and hits count the calls of Get and those returning a value, accessed atomically
+	lookups int64
+	hits    int64
+
 	brokers    []string
 	topic      string
 	opts       *voptions
@@ -48,6 +54,16 @@ type View struct {
 	consumer   sarama.Consumer
 	tmgr       TopicManager
 	state      *Signal
+	changes    *changeNotifier
+	// readThrough fetches keys missing in the local storage from the table topic. It is optional.
+	readThrough *readThrough
+
+	// done is closed when Run returns, with runErr being the returned error
+	done     chan struct{}
+	doneOnce sync.Once
+	runErr   error
+	// shutdown collects the shutdown report while running, nil without WithViewShutdownReport
+	shutdown *shutdownRecorder
 }
 
 // NewView creates a new View object from a group.
@@ -69,6 +85,7 @@ func NewView(brokers []string, topic Table, codec Codec, options ...ViewOption)
 	if err != nil {
 		return nil, fmt.Errorf("Error applying user-defined options: %v", err)
 	}
+	topic = Table(opts.topicPrefix) + topic
 
 	consumer, err := opts.builders.consumerSarama(brokers, opts.clientID)
 	if err != nil {
@@ -89,20 +106,93 @@ func NewView(brokers []string, topic Table, codec Codec, options ...ViewOption)
 		consumer: consumer,
 		tmgr:     tmgr,
 		state:    newViewSignal(),
+		changes:  newChangeNotifier(opts.tableCodec),
+		done:     make(chan struct{}),
+	}
+	if opts.shutdownReport != nil {
+		v.shutdown = newShutdownRecorder(string(topic))
 	}
 
 	if err = v.createPartitions(brokers); err != nil {
 		return nil, err
 	}
 
+	if opts.readThroughTimeout > 0 {
+		v.readThrough = newReadThrough(string(topic), opts.readThroughTimeout, tmgr, func() (sarama.Consumer, error) {
+			return opts.builders.consumerSarama(brokers, opts.clientID+"-read-through")
+		})
+	}
+
+	if opts.expvarName != "" {
+		if err := v.publishExpvar(opts.expvarName); err != nil {
+			return nil, err
+		}
+	}
+	if opts.registry != nil {
+		opts.registry.AttachView(v)
+	}
+
 	return v, err
 }
 
+// ShutdownReport returns the summary of the view's run after Run returned, or nil before.
+// The report is only recorded if the view was created with WithViewShutdownReport,
+// otherwise ShutdownReport always returns nil.
+func (v *View) ShutdownReport() *ShutdownReport {
+	return v.shutdown.get()
+}
+
 // WaitRunning returns a channel that will be closed when the view enters the running state
 func (v *View) WaitRunning() <-chan struct{} {
 	return v.state.WaitForState(State(ViewStateRunning))
 }
 
+// WaitRecovered blocks until the view has recovered and is running. It returns an
+// error if the context is done or the view stopped running before.
+func (v *View) WaitRecovered(ctx context.Context) error {
+	select {
+	case <-v.WaitRunning():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-v.done:
+		if v.runErr != nil {
+			return fmt.Errorf("view terminated: %w", v.runErr)
+		}
+		return errors.New("view terminated")
+	}
+}
+
+// Lag returns the maximum number of messages of all partitions of the table topic
+// that are not loaded into the view yet.
+func (v *View) Lag() (int64, error) {
+	return maxLag(v.partitions)
+}
+
+// stalePartitions returns the partitions whose newest loaded message is older than
+// maxStaleness. Partitions that were empty when recovered are not stale, neither are
+// partitions that loaded all messages of their topic partition, e.g. idle partitions
+// recovered from the local storage.
+func (v *View) stalePartitions(maxStaleness time.Duration) []int32 {
+	var (
+		stale []int32
+		now   = time.Now()
+	)
+	for _, p := range v.partitions {
+		if progress := p.recovery.progress(now); progress != nil && progress.Hwm == 0 {
+			continue
+		}
+		if now.Sub(p.newestMessageTime()) <= maxStaleness {
+			continue
+		}
+		if lag, err := p.Lag(); err == nil && lag == 0 {
+			continue
+		}
+		stale = append(stale, p.partition)
+	}
+	return stale
+}
+
 func (v *View) createPartitions(brokers []string) (rerr error) {
 	tm, err := v.opts.builders.topicmgr(brokers)
 	if err != nil {
@@ -132,7 +222,7 @@ func (v *View) createPartitions(brokers []string) (rerr error) {
 		if err != nil {
 			return fmt.Errorf("Error creating backoff: %v", err)
 		}
-		v.partitions = append(v.partitions, newPartitionTable(v.topic,
+		pt := newPartitionTable(v.topic,
 			p,
 			v.consumer,
 			v.tmgr,
@@ -141,7 +231,24 @@ func (v *View) createPartitions(brokers []string) (rerr error) {
 			v.log.Prefix(fmt.Sprintf("PartTable-%d", partID)),
 			backoff,
 			v.opts.backoffResetTime,
-		))
+		)
+		pt.configureStats(v.opts.statsInterval, v.opts.statsDisabled)
+		pt.removeStorage = v.opts.removeStorage
+		pt.storageLimiter = v.opts.storageLimiter
+		if v.opts.offsetIndex {
+			pt.configureOffsetIndex()
+		}
+		pt.configureSecondaryIndexes(v.opts.tableCodec.Decode, v.opts.indexes)
+		pt.configureRetention(v.opts.tableRetention)
+		pt.configureMigration(v.opts.tableVersion, v.opts.tableMigration)
+		if v.opts.maxVersions > 0 || v.opts.versionRetention > 0 {
+			pt.versions = newVersionStore(v.opts.maxVersions, v.opts.versionRetention)
+		}
+		if v.opts.recordMetadata {
+			pt.meta = newRecordMetaStore()
+		}
+		pt.changes = v.changes
+		v.partitions = append(v.partitions, pt)
 	}
 
 	return nil
@@ -229,6 +336,20 @@ func (v *View) Run(ctx context.Context) (rerr error) {
 	v.log.Debugf("starting")
 	defer v.log.Debugf("stopped")
 
+	defer v.doneOnce.Do(func() {
+		v.runErr = rerr
+		if v.done != nil {
+			close(v.done)
+		}
+	})
+	v.shutdown.start()
+	defer func() {
+		report := v.shutdown.finish(nil, rerr)
+		if report != nil {
+			v.opts.shutdownReport(report)
+		}
+	}()
+
 	// update the view state asynchronously by observing
 	// the partition's state and translating that to the view
 	v.runStateMerger(ctx)
@@ -252,6 +373,13 @@ func (v *View) Run(ctx context.Context) (rerr error) {
 		})
 	}
 
+	if v.opts.compactionSchedule != nil {
+		compactCtx, cancelCompact := context.WithCancel(ctx)
+		defer cancelCompact()
+		partitions := v.partitions
+		go runCompactionSchedule(compactCtx, v.opts.compactionSchedule, func() []*PartitionTable { return partitions }, v.log)
+	}
+
 	err := recoverErrg.Wait().NilOrError()
 	if err != nil {
 		rerr = fmt.Errorf("Error recovering partitions for view %s: %v", v.Topic(), err)
@@ -286,10 +414,21 @@ func (v *View) close() error {
 	for _, p := range v.partitions {
 		p := p
 		errg.Go(func() error {
-			return p.Close()
+			if v.shutdown != nil && p.st != nil {
+				if offset, err := p.st.GetOffset(-1); err == nil && offset >= 0 {
+					v.shutdown.offset(v.topic, p.partition, offset)
+				}
+			}
+			start := time.Now()
+			err := p.Close()
+			v.shutdown.stopped(p.partition, time.Since(start), err)
+			return err
 		})
 	}
 	v.partitions = nil
+	if v.readThrough != nil {
+		errg.Go(v.readThrough.close)
+	}
 	return errg.Wait().NilOrError()
 }
 
@@ -313,6 +452,12 @@ func (v *View) hash(key string) (int32, error) {
 	return hash % int32(len(v.partitions)), nil
 }
 
+// PartitionFor returns the partition of the key in the view's table topic, using
+// the view's hasher and the partition count of the table topic.
+func (v *View) PartitionFor(key string) (int32, error) {
+	return v.hash(key)
+}
+
 func (v *View) find(key string) (*PartitionTable, error) {
 	h, err := v.hash(key)
 	if err != nil {
@@ -326,6 +471,23 @@ func (v *View) Topic() string {
 	return v.topic
 }
 
+// Compact compacts the local storages of all partitions one after another, if the
+// storages support compaction (see storage.Compactable).
+func (v *View) Compact(ctx context.Context) error {
+	return compactTables(ctx, v.partitions)
+}
+
+// Snapshot copies the local storages of the view's partitions, including their
+// offsets, into the directory, which must not exist. See Processor.Snapshot.
+func (v *View) Snapshot(dir string) error {
+	return snapshotTables(dir, v.partitions)
+}
+
+// GetOffsets returns the oldest and newest offsets of all partitions of the view's table topic.
+func (v *View) GetOffsets() (map[int32]PartitionOffsets, error) {
+	return GetOffsets(v.tmgr, v.topic)
+}
+
 // Get returns the value for the key in the view, if exists. Nil if it doesn't.
 // Get can be called by multiple goroutines concurrently.
 // Get can only be called after Recovered returns true.
@@ -340,8 +502,19 @@ func (v *View) Get(key string) (interface{}, error) {
 	data, err := partTable.Get(key)
 	if err != nil {
 		return nil, fmt.Errorf("error getting value (key %s): %v", key, err)
+	}
+	atomic.AddInt64(&v.lookups, 1)
+	if data == nil && v.readThrough != nil {
+		if data, err = v.readThrough.fetch(partTable.partition, key, partTable.index); err != nil {
+			return nil, fmt.Errorf("error reading through (key %s): %v", key, err)
+		}
+		if data == nil {
+			return nil, nil
+		}
 	} else if data == nil {
 		return nil, nil
+	} else {
+		atomic.AddInt64(&v.hits, 1)
 	}
 
 	// decode value
@@ -354,6 +527,34 @@ func (v *View) Get(key string) (interface{}, error) {
 	return value, nil
 }
 
+// GetAsOf returns the value the key had at the passed time. Nil is returned if
+// the key did not exist at that time. The view must be created with
+// WithViewVersions. If the requested version is not retained anymore, or cannot
+// be determined because it is older than the messages the view consumed,
+// ErrVersionNotRetained is returned.
+func (v *View) GetAsOf(key string, ts time.Time) (interface{}, error) {
+	partTable, err := v.find(key)
+	if err != nil {
+		return nil, err
+	}
+	if partTable.versions == nil {
+		return nil, fmt.Errorf("view %s does not retain versions (see WithViewVersions)", v.topic)
+	}
+
+	data, err := partTable.versions.getAsOf(key, ts, partTable.Get)
+	if err != nil {
+		return nil, fmt.Errorf("error getting value (key %s) as of %v: %w", key, ts, err)
+	} else if data == nil {
+		return nil, nil
+	}
+
+	value, err := v.opts.tableCodec.Decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding value (key %s): %v", key, err)
+	}
+	return value, nil
+}
+
 // Has checks whether a value for passed key exists in the view.
 func (v *View) Has(key string) (bool, error) {
 	// find partition where key is located
@@ -365,6 +566,59 @@ func (v *View) Has(key string) (bool, error) {
 	return partTable.Has(key)
 }
 
+// GetByIndex returns the values of the keys indexed under value in the secondary index,
+// see WithViewIndex. The result maps the keys to their values.
+func (v *View) GetByIndex(index, value string) (map[string]interface{}, error) {
+	var extract IndexExtractor
+	for _, idx := range v.opts.indexes {
+		if idx.name == index {
+			extract = idx.extract
+		}
+	}
+	if extract == nil {
+		return nil, fmt.Errorf("view has no index %s", index)
+	}
+
+	values := make(map[string]interface{})
+	for _, pt := range v.partitions {
+		keys, err := pt.GetByIndex(index, value)
+		if err != nil {
+			return nil, fmt.Errorf("error looking up index %s: %v", index, err)
+		}
+		for _, key := range keys {
+			data, err := pt.Get(key)
+			if err != nil {
+				return nil, fmt.Errorf("error getting value (key %s): %v", key, err)
+			}
+			if data == nil {
+				continue
+			}
+			decoded, err := v.opts.tableCodec.Decode(data)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding value (key %s): %v", key, err)
+			}
+			// skip keys changed without updating the index, e.g. by Evict
+			for _, indexed := range extract(key, decoded) {
+				if indexed == value {
+					values[key] = decoded
+					break
+				}
+			}
+		}
+	}
+	return values, nil
+}
+
+// KeyOffset returns the offset of the latest message of the key in the table topic and
+// whether the offset is known. It requires WithViewOffsetIndex.
+func (v *View) KeyOffset(key string) (int64, bool, error) {
+	partTable, err := v.find(key)
+	if err != nil {
+		return 0, false, err
+	}
+	return partTable.KeyOffset(key)
+}
+
 // Iterator returns an iterator that iterates over the state of the View.
 func (v *View) Iterator() (Iterator, error) {
 	iters := make([]storage.Iterator, 0, len(v.partitions))
@@ -385,9 +639,34 @@ func (v *View) Iterator() (Iterator, error) {
 	return &iterator{
 		iter:  storage.NewMultiIterator(iters),
 		codec: v.opts.tableCodec,
+		view:  v,
 	}, nil
 }
 
+// IteratorSince returns an iterator over the state of the View that only returns the
+// values set by messages at or after the passed offsets of the table topic's partitions,
+// e.g. the offsets following the last values processed by a previous export.
+// Partitions missing in offsets are iterated completely, as are values whose offset
+// is not known. The view must be created with WithViewRecordMetadata.
+// The offsets are kept in memory only and are not known for the values recovered from
+// the local storage. So after restarting the view, all values not updated since are
+// returned again, i.e. exports based on IteratorSince are at-least-once.
+func (v *View) IteratorSince(offsets map[int32]int64) (Iterator, error) {
+	if !v.opts.recordMetadata {
+		return nil, fmt.Errorf("view %s does not keep record metadata (see WithViewRecordMetadata)", v.topic)
+	}
+	iter, err := v.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	since := make(map[int32]int64, len(offsets))
+	for partition, offset := range offsets {
+		since[partition] = offset
+	}
+	iter.(*iterator).since = since
+	return iter, nil
+}
+
 // IteratorWithRange returns an iterator that iterates over the state of the View. This iterator is build using the range.
 func (v *View) IteratorWithRange(start, limit string) (Iterator, error) {
 	iters := make([]storage.Iterator, 0, len(v.partitions))
@@ -408,9 +687,28 @@ func (v *View) IteratorWithRange(start, limit string) (Iterator, error) {
 	return &iterator{
 		iter:  storage.NewMultiIterator(iters),
 		codec: v.opts.tableCodec,
+		view:  v,
 	}, nil
 }
 
+// IterateRange returns an iterator over the keys in [start, limit). Only the matching
+// keys are read from the local storages instead of walking the entire table. The keys
+// are ordered within each partition, but not across partitions. Use IteratePrefix to
+// iterate over all keys with a prefix.
+func (v *View) IterateRange(start, limit string) (Iterator, error) {
+	if limit == "" {
+		return nil, fmt.Errorf("missing limit of range starting at %q", start)
+	}
+	return v.IteratorWithRange(start, limit)
+}
+
+// IteratePrefix returns an iterator over the keys with the prefix, e.g. all keys of a
+// tenant if keys are prefixed with the tenant. Like IterateRange, only the matching
+// keys are read.
+func (v *View) IteratePrefix(prefix string) (Iterator, error) {
+	return v.IteratorWithRange(prefix, "")
+}
+
 // Evict removes the given key only from the local cache. In order to delete a
 // key from Kafka and other Views, context.Delete should be used on a Processor.
 func (v *View) Evict(key string) error {
@@ -465,6 +763,16 @@ func (v *View) ObserveStateChanges() *StateChangeObserver {
 	return v.state.ObserveStateChange()
 }
 
+// Changes returns a ChangeObserver receiving the changes of the view's table as the
+// view consumes its topic after recovery. Each change holds the decoded new value and,
+// if the key existed in the local storage, the old value.
+// Like ObserveStateChanges, the channel must be read continuously, otherwise the view
+// blocks once the channel's buffer is full until the observer is stopped.
+// If the observer is not needed anymore, the caller must call observer.Stop().
+func (v *View) Changes() *ChangeObserver {
+	return v.changes.observe(changeObserverBufferSize)
+}
+
 // Stats returns a set of performance metrics of the view.
 func (v *View) Stats(ctx context.Context) *ViewStats {
 	return v.statsWithContext(ctx)
@@ -482,6 +790,9 @@ func (v *View) statsWithContext(ctx context.Context) *ViewStats {
 
 		errg.Go(func() error {
 			tableStats := partTable.fetchStats(ctx)
+			if tableStats == nil {
+				return nil
+			}
 			m.Lock()
 			defer m.Unlock()
 
@@ -494,5 +805,7 @@ func (v *View) statsWithContext(ctx context.Context) *ViewStats {
 	if err != nil {
 		v.log.Printf("Error retrieving stats: %v", err)
 	}
+	stats.Lookups = atomic.LoadInt64(&v.lookups)
+	stats.Hits = atomic.LoadInt64(&v.hits)
 	return stats
 }
@@ -0,0 +1,128 @@
+package goka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// changeObserverBufferSize is the capacity of the channel of a ChangeObserver
+const changeObserverBufferSize = 128
+
+// ChangeEvent is a change of a key of a view's table, decoded with the view's codec.
+type ChangeEvent struct {
+	Key string
+	// OldValue is the value of the key in the local storage before the change,
+	// or nil if the key did not exist.
+	OldValue interface{}
+	// Value is the new value of the key, or nil if the key was deleted.
+	Value interface{}
+
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+}
+
+// ChangeObserver wraps a channel that receives the changes of a view.
+type ChangeObserver struct {
+	c chan *ChangeEvent
+	// closed is closed when the observer is closed to avoid sending to a closed channel
+	closed chan struct{}
+	stop   func()
+}
+
+// C returns the channel to receive the changes. It is closed when the observer
+// is stopped.
+func (o *ChangeObserver) C() <-chan *ChangeEvent {
+	return o.c
+}
+
+// Stop stops the observer and closes its channel.
+func (o *ChangeObserver) Stop() {
+	o.stop()
+}
+
+// changeNotifier passes the changes of the partition tables of a view to the
+// registered observers
+type changeNotifier struct {
+	m         sync.RWMutex
+	codec     Codec
+	observers []*ChangeObserver
+}
+
+func newChangeNotifier(codec Codec) *changeNotifier {
+	return &changeNotifier{codec: codec}
+}
+
+func (cn *changeNotifier) observe(bufferSize int) *ChangeObserver {
+	cn.m.Lock()
+	defer cn.m.Unlock()
+
+	observer := &ChangeObserver{
+		c:      make(chan *ChangeEvent, bufferSize),
+		closed: make(chan struct{}),
+	}
+	var once sync.Once
+	observer.stop = func() {
+		once.Do(func() {
+			close(observer.closed)
+			cn.m.Lock()
+			defer cn.m.Unlock()
+			for idx, obs := range cn.observers {
+				if obs == observer {
+					cn.observers = append(cn.observers[:idx], cn.observers[idx+1:]...)
+					break
+				}
+			}
+			close(observer.c)
+		})
+	}
+	cn.observers = append(cn.observers, observer)
+	return observer
+}
+
+// active returns whether any observer is registered
+func (cn *changeNotifier) active() bool {
+	cn.m.RLock()
+	defer cn.m.RUnlock()
+	return len(cn.observers) > 0
+}
+
+// notify decodes the change and sends it to all observers. It blocks until all observers
+// received the change, were stopped or the context is done.
+func (cn *changeNotifier) notify(ctx context.Context, key string, oldData, data []byte, partition int32, offset int64, ts time.Time) error {
+	cn.m.RLock()
+	defer cn.m.RUnlock()
+	if len(cn.observers) == 0 {
+		return nil
+	}
+
+	event := &ChangeEvent{
+		Key:       key,
+		Partition: partition,
+		Offset:    offset,
+		Timestamp: ts,
+	}
+	var err error
+	if oldData != nil {
+		if event.OldValue, err = cn.codec.Decode(oldData); err != nil {
+			return fmt.Errorf("error decoding old value (key %s): %v", key, err)
+		}
+	}
+	if data != nil {
+		if event.Value, err = cn.codec.Decode(data); err != nil {
+			return fmt.Errorf("error decoding value (key %s): %v", key, err)
+		}
+	}
+
+	for _, obs := range cn.observers {
+		select {
+		case <-obs.closed:
+		case <-ctx.Done():
+			return nil
+		case obs.c <- event:
+		}
+	}
+	return nil
+}
@@ -123,6 +123,20 @@ func TestView_hash(t *testing.T) {
 	})
 }
 
+func TestView_PartitionFor(t *testing.T) {
+	view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
+	defer ctrl.Finish()
+
+	view.partitions = []*PartitionTable{{}, {}, {}}
+	view.opts.hasher = func() hash.Hash32 {
+		return newConstHasher(5)
+	}
+
+	partition, err := view.PartitionFor("some-key")
+	test.AssertNil(t, err)
+	test.AssertEqual(t, partition, int32(2))
+}
+
 func TestView_find(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
@@ -383,6 +397,49 @@ func TestView_Recovered(t *testing.T) {
 	})
 }
 
+func TestView_stalePartitions(t *testing.T) {
+	var ctrls []*gomock.Controller
+	defer func() {
+		for _, ctrl := range ctrls {
+			ctrl.Finish()
+		}
+	}()
+	// newTable creates a partition table that stored the offset and whose topic
+	// partition has the hwm
+	newTable := func(partition int32, stored, hwm int64) *PartitionTable {
+		pt, bm, ctrl := defaultPT(t, "some-topic", partition, NewMockAutoConsumer(t, nil), nil)
+		ctrls = append(ctrls, ctrl)
+
+		bm.mst.EXPECT().Open().Return(nil)
+		test.AssertNil(t, pt.setup(context.Background()))
+		bm.mst.EXPECT().GetOffset(offsetNotStored).Return(stored, nil).AnyTimes()
+		bm.tmgr.EXPECT().GetOffset("some-topic", partition, sarama.OffsetNewest).Return(hwm, nil).AnyTimes()
+		return pt
+	}
+
+	var (
+		now   = time.Now()
+		fresh = newTable(0, 9, 10)
+		stale = newTable(1, 8, 10)
+		empty = newTable(2, offsetNotStored, 0)
+		// no message was loaded into a partition that is not empty
+		unloaded = newTable(3, offsetNotStored, 10)
+		// the partition was recovered from the local storage and received no messages since
+		idle = newTable(4, 9, 10)
+	)
+	atomic.StoreInt64(&fresh.newestTimestamp, now.UnixNano())
+	atomic.StoreInt64(&stale.newestTimestamp, now.Add(-time.Hour).UnixNano())
+	fresh.recovery.begin(0, 10, now)
+	stale.recovery.begin(0, 10, now)
+	empty.recovery.begin(0, 0, now)
+	unloaded.recovery.begin(0, 10, now)
+	idle.recovery.begin(10, 10, now)
+
+	view := &View{partitions: []*PartitionTable{fresh, stale, empty, unloaded, idle}}
+	test.AssertEqual(t, view.stalePartitions(time.Minute), []int32{1, 3})
+	test.AssertEqual(t, view.stalePartitions(2*time.Hour), []int32{3})
+}
+
 func TestView_Topic(t *testing.T) {
 	t.Run("succeed", func(t *testing.T) {
 		view, _, ctrl := createTestView(t, NewMockAutoConsumer(t, DefaultConfig()))
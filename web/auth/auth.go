@@ -0,0 +1,111 @@
+// Package auth provides authorization for the HTTP servers of the web packages,
+// which are open to everyone otherwise. Pass Middleware with an Authorizer to the
+// servers with their WithMiddleware option, e.g.
+//
+//	monitor.NewServer("/monitor", router,
+//		monitor.WithMiddleware(auth.Middleware(auth.BearerToken(token))))
+//
+// The authorizers can be combined with Any and All. Credentials should only be
+// sent over TLS.
+package auth
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Authorizer decides whether a request is authorized.
+type Authorizer func(r *http.Request) bool
+
+// Middleware rejects requests not authorized by authorize with 401 Unauthorized.
+func Middleware(authorize Authorizer) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !authorize(r) {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BearerToken authorizes requests whose Authorization header contains one of the
+// tokens as bearer token.
+func BearerToken(tokens ...string) Authorizer {
+	return func(r *http.Request) bool {
+		header := r.Header.Get("Authorization")
+		const prefix = "Bearer "
+		if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+			return false
+		}
+		return containsSecret(tokens, header[len(prefix):])
+	}
+}
+
+// BasicAuth authorizes requests with the user and password as HTTP basic authentication.
+func BasicAuth(user, password string) Authorizer {
+	return func(r *http.Request) bool {
+		u, p, ok := r.BasicAuth()
+		if !ok {
+			return false
+		}
+		// evaluate both to not leak which one is wrong by timing
+		userOK := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		passwordOK := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		return userOK && passwordOK
+	}
+}
+
+// ClientCertificate authorizes requests over TLS with a verified client certificate
+// accepted by accept, e.g. checking its common name. The server must verify client
+// certificates, i.e. use tls.RequireAndVerifyClientCert or tls.VerifyClientCertIfGiven
+// as ClientAuth of its TLS config. If accept is nil, every verified certificate is accepted.
+func ClientCertificate(accept func(cert *x509.Certificate) bool) Authorizer {
+	return func(r *http.Request) bool {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return false
+		}
+		return accept == nil || accept(r.TLS.VerifiedChains[0][0])
+	}
+}
+
+// Any authorizes requests authorized by at least one of the authorizers.
+func Any(authorizers ...Authorizer) Authorizer {
+	return func(r *http.Request) bool {
+		for _, authorize := range authorizers {
+			if authorize(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// All authorizes requests authorized by all authorizers, e.g. to require a client
+// certificate and a token.
+func All(authorizers ...Authorizer) Authorizer {
+	return func(r *http.Request) bool {
+		for _, authorize := range authorizers {
+			if !authorize(r) {
+				return false
+			}
+		}
+		return len(authorizers) > 0
+	}
+}
+
+// containsSecret compares the secret with all candidates in constant time
+func containsSecret(candidates []string, secret string) bool {
+	var found bool
+	for _, candidate := range candidates {
+		if candidate != "" && subtle.ConstantTimeCompare([]byte(candidate), []byte(secret)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func TestBearerToken(t *testing.T) {
+	authorize := BearerToken("a", "b", "")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	test.AssertFalse(t, authorize(req))
+
+	for header, authorized := range map[string]bool{
+		"Bearer a":  true,
+		"bearer b":  true,
+		"Bearer c":  false,
+		"Bearer ":   false,
+		"Basic a":   false,
+		"Bearer":    false,
+		"Bearer aa": false,
+	} {
+		req.Header.Set("Authorization", header)
+		test.AssertEqual(t, authorize(req), authorized)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	authorize := BasicAuth("user", "password")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	test.AssertFalse(t, authorize(req))
+	req.SetBasicAuth("user", "wrong")
+	test.AssertFalse(t, authorize(req))
+	req.SetBasicAuth("other", "password")
+	test.AssertFalse(t, authorize(req))
+	req.SetBasicAuth("user", "password")
+	test.AssertTrue(t, authorize(req))
+}
+
+func TestClientCertificate(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "client"}}
+	authorize := ClientCertificate(func(cert *x509.Certificate) bool {
+		return cert.Subject.CommonName == "client"
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	test.AssertFalse(t, authorize(req))
+	req.TLS = &tls.ConnectionState{}
+	test.AssertFalse(t, authorize(req))
+	// only verified certificates are accepted
+	req.TLS.PeerCertificates = []*x509.Certificate{cert}
+	test.AssertFalse(t, authorize(req))
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	test.AssertTrue(t, authorize(req))
+	test.AssertTrue(t, ClientCertificate(nil)(req))
+
+	cert.Subject.CommonName = "other"
+	test.AssertFalse(t, authorize(req))
+}
+
+func TestAnyAll(t *testing.T) {
+	yes := func(r *http.Request) bool { return true }
+	no := func(r *http.Request) bool { return false }
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	test.AssertTrue(t, Any(no, yes)(req))
+	test.AssertFalse(t, Any(no, no)(req))
+	test.AssertFalse(t, Any()(req))
+	test.AssertTrue(t, All(yes, yes)(req))
+	test.AssertFalse(t, All(yes, no)(req))
+	test.AssertFalse(t, All()(req))
+}
+
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	sub := router.PathPrefix("/secured").Subrouter()
+	sub.Use(Middleware(BearerToken("token")))
+	sub.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {})
+	router.HandleFunc("/open", func(w http.ResponseWriter, r *http.Request) {})
+
+	serve := func(path, header string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	test.AssertEqual(t, serve("/secured/", ""), http.StatusUnauthorized)
+	test.AssertEqual(t, serve("/secured/", "Bearer wrong"), http.StatusUnauthorized)
+	test.AssertEqual(t, serve("/secured/", "Bearer token"), http.StatusOK)
+	test.AssertEqual(t, serve("/open", ""), http.StatusOK)
+}
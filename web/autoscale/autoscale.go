@@ -0,0 +1,350 @@
+// Package autoscale exports the lag and processing rate of consumer groups in formats
+// consumable by autoscalers, so processors can be scaled on their backlog.
+//
+// The server serves the metrics of all attached groups as JSON, e.g. for the
+// metrics-api scaler of KEDA using the valueLocation "lag" on
+// <basePath>/groups/<group>, and in the Prometheus text format on <basePath>/metrics,
+// e.g. to be provided to a HorizontalPodAutoscaler as external metrics by the Prometheus
+// adapter.
+// The metrics are computed from the offsets committed by the consumer groups, so the
+// server can run in any instance of the processor or as a separate deployment.
+package autoscale
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+)
+
+const defaultInterval = 10 * time.Second
+
+// PartitionLag is the lag of a consumer group in a topic partition.
+type PartitionLag struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// Committed is the offset committed by the group, -1 if the group has not committed yet
+	Committed int64 `json:"committed"`
+	Hwm       int64 `json:"hwm"`
+	Lag       int64 `json:"lag"`
+}
+
+// GroupMetrics contains the lag and processing rate of a consumer group.
+type GroupMetrics struct {
+	Group string `json:"group"`
+	// Lag is the number of messages of all consumed partitions not processed yet
+	Lag int64 `json:"lag"`
+	// MaxPartitionLag is the largest lag of a single partition
+	MaxPartitionLag int64 `json:"maxPartitionLag"`
+	// Rate is the number of messages per second processed by the group since the last update
+	Rate float64 `json:"rate"`
+	// InputRate is the number of messages per second written to the consumed topics since the last update
+	InputRate float64 `json:"inputRate"`
+	// Partitions contains the lag of every consumed partition
+	Partitions []PartitionLag `json:"partitions"`
+	Updated    time.Time      `json:"updated"`
+	// Error is set if the last update failed, the metrics are then the ones of the last successful update
+	Error string `json:"error,omitempty"`
+}
+
+type group struct {
+	name    string
+	topics  []string
+	metrics *GroupMetrics
+	// sums of the committed offsets and hwms of the last update to compute the rates
+	committed int64
+	hwm       int64
+}
+
+// Server periodically computes the metrics of the attached consumer groups and
+// provides HTTP routes to export them.
+type Server struct {
+	log  goka.Logger
+	m    sync.RWMutex
+	tmgr goka.TopicManager
+
+	basePath      string
+	interval      time.Duration
+	initialOffset int64
+	groups        []*group
+	middlewares   []mux.MiddlewareFunc
+}
+
+// NewServer creates a new Server using the topic manager to fetch the offsets of
+// the consumer groups. Call Run to update the metrics.
+func NewServer(basePath string, router *mux.Router, tmgr goka.TopicManager, opts ...Option) *Server {
+	srv := &Server{
+		log:           goka.DefaultLogger(),
+		tmgr:          tmgr,
+		basePath:      basePath,
+		interval:      defaultInterval,
+		initialOffset: sarama.OffsetNewest,
+	}
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	sub := router.PathPrefix(basePath).Subrouter()
+	sub.Use(srv.middlewares...)
+	sub.HandleFunc("/groups", srv.renderGroups)
+	sub.HandleFunc("/groups/{group}", srv.renderGroup)
+	sub.HandleFunc("/metrics", srv.renderPrometheus)
+
+	return srv
+}
+
+// BasePath returns the base path of the routes.
+func (s *Server) BasePath() string {
+	return s.basePath
+}
+
+// AttachGraph attaches the consumer group of the group graph, consuming its input
+// and loop topics.
+func (s *Server) AttachGraph(gg *goka.GroupGraph) {
+	var topics []string
+	for _, edge := range gg.InputStreams() {
+		topics = append(topics, edge.Topic())
+	}
+	if loop := gg.LoopStream(); loop != nil {
+		topics = append(topics, loop.Topic())
+	}
+	for _, edge := range gg.NamedLoopStreams() {
+		topics = append(topics, edge.Topic())
+	}
+	s.AttachGroup(string(gg.Group()), topics...)
+}
+
+// AttachGroup attaches a consumer group consuming the passed topics.
+func (s *Server) AttachGroup(name string, topics ...string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.groups = append(s.groups, &group{
+		name:   name,
+		topics: topics,
+	})
+}
+
+// Run updates the metrics of the attached groups periodically until the context is done.
+func (s *Server) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		s.update(time.Now())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Metrics returns the metrics of the group of the last update, or false if the
+// group is not attached or was not updated yet.
+func (s *Server) Metrics(name string) (GroupMetrics, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for _, g := range s.groups {
+		if g.name == name && g.metrics != nil {
+			return *g.metrics, true
+		}
+	}
+	return GroupMetrics{}, false
+}
+
+func (s *Server) allMetrics() []GroupMetrics {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	var metrics []GroupMetrics
+	for _, g := range s.groups {
+		if g.metrics != nil {
+			metrics = append(metrics, *g.metrics)
+		}
+	}
+	return metrics
+}
+
+// update computes the metrics of all attached groups.
+func (s *Server) update(now time.Time) {
+	s.m.RLock()
+	groups := append([]*group(nil), s.groups...)
+	s.m.RUnlock()
+
+	for _, g := range groups {
+		partitions, err := s.groupLag(g)
+
+		s.m.Lock()
+		if err != nil {
+			s.log.Printf("error updating lag of group %s: %v", g.name, err)
+			if g.metrics != nil {
+				g.metrics.Error = err.Error()
+			}
+			s.m.Unlock()
+			continue
+		}
+		g.update(partitions, now)
+		s.m.Unlock()
+	}
+}
+
+// groupLag returns the lag of the group in all partitions of its topics.
+func (s *Server) groupLag(g *group) ([]PartitionLag, error) {
+	var lags []PartitionLag
+	for _, topic := range g.topics {
+		offsets, err := goka.GetOffsets(s.tmgr, topic)
+		if err != nil {
+			return nil, err
+		}
+		committed, err := goka.GetCommittedOffsets(s.tmgr, g.name, topic)
+		if err != nil {
+			return nil, err
+		}
+		for partition, offset := range offsets {
+			pl := PartitionLag{
+				Topic:     topic,
+				Partition: partition,
+				Committed: -1,
+				Hwm:       offset.Newest,
+			}
+			start := offset.Newest
+			if s.initialOffset == sarama.OffsetOldest {
+				start = offset.Oldest
+			}
+			if c, ok := committed[partition]; ok {
+				pl.Committed = c.Offset
+				start = c.Offset
+			}
+			if lag := pl.Hwm - start; lag > 0 {
+				pl.Lag = lag
+			}
+			lags = append(lags, pl)
+		}
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags, nil
+}
+
+// update sets the metrics of the group from the partition lags. Must be called while holding the lock.
+func (g *group) update(partitions []PartitionLag, now time.Time) {
+	metrics := &GroupMetrics{
+		Group:      g.name,
+		Partitions: partitions,
+		Updated:    now,
+	}
+
+	var committed, hwm int64
+	for _, pl := range partitions {
+		metrics.Lag += pl.Lag
+		if pl.Lag > metrics.MaxPartitionLag {
+			metrics.MaxPartitionLag = pl.Lag
+		}
+		if pl.Committed >= 0 {
+			committed += pl.Committed
+		}
+		hwm += pl.Hwm
+	}
+
+	if g.metrics != nil {
+		if elapsed := now.Sub(g.metrics.Updated).Seconds(); elapsed > 0 {
+			metrics.Rate = rate(committed-g.committed, elapsed)
+			metrics.InputRate = rate(hwm-g.hwm, elapsed)
+		}
+	}
+	g.metrics, g.committed, g.hwm = metrics, committed, hwm
+}
+
+// rate returns the number of messages per second, ignoring offset resets.
+func rate(delta int64, seconds float64) float64 {
+	if delta < 0 {
+		return 0
+	}
+	return float64(delta) / seconds
+}
+
+func (s *Server) renderGroups(w http.ResponseWriter, r *http.Request) {
+	s.renderJSON(w, s.allMetrics())
+}
+
+func (s *Server) renderGroup(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["group"]
+	metrics, ok := s.Metrics(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no metrics for group %s", name), http.StatusNotFound)
+		return
+	}
+	s.renderJSON(w, metrics)
+}
+
+func (s *Server) renderJSON(w http.ResponseWriter, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		s.log.Printf("error writing metrics: %v", err)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (s *Server) renderPrometheus(w http.ResponseWriter, r *http.Request) {
+	metrics := s.allMetrics()
+
+	var b strings.Builder
+	gauge := func(name, help string, values func(m GroupMetrics)) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+		for _, m := range metrics {
+			values(m)
+		}
+	}
+	sample := func(name string, value float64, labels ...string) {
+		b.WriteString(name)
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		fmt.Fprintf(&b, "} %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+	}
+
+	gauge("goka_group_lag", "Number of messages not processed by the consumer group.", func(m GroupMetrics) {
+		sample("goka_group_lag", float64(m.Lag), "group", m.Group)
+	})
+	gauge("goka_group_max_partition_lag", "Largest number of messages of a partition not processed by the consumer group.", func(m GroupMetrics) {
+		sample("goka_group_max_partition_lag", float64(m.MaxPartitionLag), "group", m.Group)
+	})
+	gauge("goka_group_partition_lag", "Number of messages of the partition not processed by the consumer group.", func(m GroupMetrics) {
+		for _, pl := range m.Partitions {
+			sample("goka_group_partition_lag", float64(pl.Lag), "group", m.Group, "topic", pl.Topic, "partition", strconv.Itoa(int(pl.Partition)))
+		}
+	})
+	gauge("goka_group_process_rate", "Messages per second processed by the consumer group.", func(m GroupMetrics) {
+		sample("goka_group_process_rate", m.Rate, "group", m.Group)
+	})
+	gauge("goka_group_input_rate", "Messages per second written to the topics consumed by the consumer group.", func(m GroupMetrics) {
+		sample("goka_group_input_rate", m.InputRate, "group", m.Group)
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		s.log.Printf("error writing metrics: %v", err)
+	}
+}
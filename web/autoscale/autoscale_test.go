@@ -0,0 +1,160 @@
+package autoscale
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+)
+
+func get(t *testing.T, router *mux.Router, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+// topicManager adds listing committed offsets to the mock topic manager
+type topicManager struct {
+	*goka.MockTopicManager
+	ctrl *gomock.Controller
+}
+
+func newTopicManager(ctrl *gomock.Controller) *topicManager {
+	return &topicManager{
+		MockTopicManager: goka.NewMockTopicManager(ctrl),
+		ctrl:             ctrl,
+	}
+}
+
+func (tm *topicManager) GetCommittedOffsets(group string, topic string) (map[int32]goka.CommittedOffset, error) {
+	ret := tm.ctrl.Call(tm, "GetCommittedOffsets", group, topic)
+	offsets, _ := ret[0].(map[int32]goka.CommittedOffset)
+	err, _ := ret[1].(error)
+	return offsets, err
+}
+
+func (tm *topicManager) expectCommittedOffsets(group string, topic string) *gomock.Call {
+	return tm.ctrl.RecordCall(tm, "GetCommittedOffsets", group, topic)
+}
+
+// expectOffsets expects the calls of goka.GetOffsets returning the offsets of the topic
+func expectOffsets(tmgr *topicManager, topic string, offsets map[int32]goka.PartitionOffsets) {
+	var partitions []int32
+	for partition, offset := range offsets {
+		partitions = append(partitions, partition)
+		tmgr.EXPECT().GetOffset(topic, partition, sarama.OffsetOldest).Return(offset.Oldest, nil)
+		tmgr.EXPECT().GetOffset(topic, partition, sarama.OffsetNewest).Return(offset.Newest, nil)
+	}
+	tmgr.EXPECT().Partitions(topic).Return(partitions, nil)
+}
+
+func TestServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	tmgr := newTopicManager(ctrl)
+
+	router := mux.NewRouter()
+	srv := NewServer("/autoscale", router, tmgr)
+	srv.AttachGraph(goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		goka.Loop(new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+	))
+
+	// unknown before the first update
+	test.AssertEqual(t, get(t, router, "/autoscale/groups/group").Code, http.StatusNotFound)
+
+	now := time.Now()
+	expectOffsets(tmgr, "input", map[int32]goka.PartitionOffsets{
+		0: {Oldest: 0, Newest: 100},
+		1: {Oldest: 10, Newest: 50},
+	})
+	tmgr.expectCommittedOffsets("group", "input").Return(map[int32]goka.CommittedOffset{
+		0: {Offset: 80},
+	}, nil)
+	expectOffsets(tmgr, "group-loop", map[int32]goka.PartitionOffsets{
+		0: {Oldest: 0, Newest: 5},
+		1: {Oldest: 0, Newest: 0},
+	})
+	tmgr.expectCommittedOffsets("group", "group-loop").Return(map[int32]goka.CommittedOffset{
+		0: {Offset: 5},
+		1: {Offset: 0},
+	}, nil)
+	srv.update(now)
+
+	metrics, ok := srv.Metrics("group")
+	test.AssertTrue(t, ok)
+	// uncommitted partitions start at the newest offset by default
+	test.AssertEqual(t, metrics.Lag, int64(20))
+	test.AssertEqual(t, metrics.MaxPartitionLag, int64(20))
+	test.AssertEqual(t, len(metrics.Partitions), 4)
+	test.AssertEqual(t, metrics.Partitions[3], PartitionLag{Topic: "input", Partition: 1, Committed: -1, Hwm: 50})
+	test.AssertEqual(t, metrics.Rate, float64(0))
+
+	// the second update computes the rates
+	expectOffsets(tmgr, "input", map[int32]goka.PartitionOffsets{
+		0: {Oldest: 0, Newest: 120},
+		1: {Oldest: 10, Newest: 50},
+	})
+	tmgr.expectCommittedOffsets("group", "input").Return(map[int32]goka.CommittedOffset{
+		0: {Offset: 110},
+	}, nil)
+	expectOffsets(tmgr, "group-loop", map[int32]goka.PartitionOffsets{
+		0: {Oldest: 0, Newest: 5},
+	})
+	tmgr.expectCommittedOffsets("group", "group-loop").Return(map[int32]goka.CommittedOffset{
+		0: {Offset: 5},
+	}, nil)
+	srv.update(now.Add(10 * time.Second))
+
+	rec := get(t, router, "/autoscale/groups/group")
+	test.AssertEqual(t, rec.Code, http.StatusOK)
+	var served GroupMetrics
+	test.AssertNil(t, json.Unmarshal(rec.Body.Bytes(), &served))
+	test.AssertEqual(t, served.Lag, int64(10))
+	test.AssertEqual(t, served.Rate, float64(3))
+	test.AssertEqual(t, served.InputRate, float64(2))
+
+	// failed updates keep the last metrics
+	tmgr.EXPECT().Partitions("input").Return(nil, errors.New("broker down"))
+	srv.update(now.Add(20 * time.Second))
+	metrics, _ = srv.Metrics("group")
+	test.AssertEqual(t, metrics.Lag, int64(10))
+	test.AssertStringContains(t, metrics.Error, "broker down")
+
+	rec = get(t, router, "/autoscale/metrics")
+	test.AssertEqual(t, rec.Code, http.StatusOK)
+	body := rec.Body.String()
+	test.AssertStringContains(t, body, "# TYPE goka_group_lag gauge\ngoka_group_lag{group=\"group\"} 10\n")
+	test.AssertStringContains(t, body, "goka_group_partition_lag{group=\"group\",topic=\"input\",partition=\"0\"} 10\n")
+	test.AssertStringContains(t, body, "goka_group_process_rate{group=\"group\"} 3\n")
+	test.AssertTrue(t, strings.HasSuffix(body, "goka_group_input_rate{group=\"group\"} 2\n"))
+}
+
+func TestServer_initialOffsetOldest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	tmgr := newTopicManager(ctrl)
+
+	srv := NewServer("/", mux.NewRouter(), tmgr, WithInitialOffset(sarama.OffsetOldest))
+	srv.AttachGroup("group", "input")
+
+	expectOffsets(tmgr, "input", map[int32]goka.PartitionOffsets{
+		0: {Oldest: 10, Newest: 50},
+	})
+	tmgr.expectCommittedOffsets("group", "input").Return(map[int32]goka.CommittedOffset{}, nil)
+	srv.update(time.Now())
+
+	metrics, ok := srv.Metrics("group")
+	test.AssertTrue(t, ok)
+	test.AssertEqual(t, metrics.Lag, int64(40))
+}
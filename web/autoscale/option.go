@@ -0,0 +1,43 @@
+package autoscale
+
+import (
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+)
+
+// Option is a function that applies a configuration to the server.
+type Option func(s *Server)
+
+// WithLogger sets the logger to use. By default, it logs to standard out.
+func WithLogger(l goka.Logger) Option {
+	return func(s *Server) {
+		s.log = l
+	}
+}
+
+// WithInterval sets how often the lag of the groups is updated. Defaults to 10 seconds.
+func WithInterval(interval time.Duration) Option {
+	return func(s *Server) {
+		s.interval = interval
+	}
+}
+
+// WithInitialOffset sets where the groups start consuming partitions without committed
+// offsets, which must match Consumer.Offsets.Initial of the processors' config.
+// With sarama.OffsetOldest, all messages of those partitions count as lag. With
+// sarama.OffsetNewest, the default, those partitions have no lag.
+func WithInitialOffset(offset int64) Option {
+	return func(s *Server) {
+		s.initialOffset = offset
+	}
+}
+
+// WithMiddleware adds middlewares to all routes of the server, e.g. to authorize
+// the requests with auth.Middleware.
+func WithMiddleware(middlewares ...mux.MiddlewareFunc) Option {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
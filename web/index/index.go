@@ -20,21 +20,27 @@ type Server struct {
 	log goka.Logger
 	m   sync.RWMutex
 
-	basePath   string
-	components []*component
+	basePath    string
+	components  []*component
+	middlewares []mux.MiddlewareFunc
 }
 
 type ComponentPathProvider interface {
 	BasePath() string
 }
 
-func NewServer(basePath string, router *mux.Router) *Server {
+func NewServer(basePath string, router *mux.Router, opts ...Option) *Server {
 	srv := &Server{
 		log:      goka.DefaultLogger(),
 		basePath: basePath,
 	}
 
+	for _, opt := range opts {
+		opt(srv)
+	}
+
 	sub := router.PathPrefix(basePath).Subrouter()
+	sub.Use(srv.middlewares...)
 	sub.HandleFunc("/", srv.index)
 
 	return srv
@@ -0,0 +1,14 @@
+package index
+
+import "github.com/gorilla/mux"
+
+// Option is a function that applies a configuration to the server.
+type Option func(s *Server)
+
+// WithMiddleware adds middlewares to all routes of the server, e.g. to authorize
+// the requests with auth.Middleware.
+func WithMiddleware(middlewares ...mux.MiddlewareFunc) Option {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
@@ -0,0 +1,145 @@
+package monitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/web/auth"
+)
+
+// ActionAuthorizer decides whether the request may trigger an action, e.g. by
+// checking a token in its headers. See WithActions and the authorizers of package auth.
+type ActionAuthorizer = auth.Authorizer
+
+// actionResult is the JSON response of an action
+type actionResult struct {
+	Action  string                    `json:"action"`
+	Error   string                    `json:"error,omitempty"`
+	Reports []*goka.TableRepairReport `json:"reports,omitempty"`
+}
+
+// registerActions adds the routes of the actions, which only accept POST requests
+func (s *Server) registerActions(sub *mux.Router) {
+	actions := sub.PathPrefix("/actions").Methods(http.MethodPost).Subrouter()
+	actions.HandleFunc("/processor/{idx}/compact", s.authorized(s.compactProcessor))
+	actions.HandleFunc("/processor/{idx}/check", s.authorized(s.checkProcessorTable))
+	actions.HandleFunc("/processor/{idx}/repair", s.authorized(s.repairProcessorTable))
+	actions.HandleFunc("/view/{idx}/compact", s.authorized(s.compactView))
+}
+
+// authorized rejects requests not authorized by the action authorizer
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorizeAction(r) {
+			http.Error(w, "action not authorized", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) processor(r *http.Request) (*goka.Processor, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	idx, err := strconv.Atoi(mux.Vars(r)["idx"])
+	if err != nil || idx < 0 || idx >= len(s.processors) {
+		return nil, false
+	}
+	return s.processors[idx], true
+}
+
+func (s *Server) view(r *http.Request) (*goka.View, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	idx, err := strconv.Atoi(mux.Vars(r)["idx"])
+	if err != nil || idx < 0 || idx >= len(s.views) {
+		return nil, false
+	}
+	return s.views[idx], true
+}
+
+// compacts the local storages of a processor
+func (s *Server) compactProcessor(w http.ResponseWriter, r *http.Request) {
+	proc, ok := s.processor(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.log.Printf("compacting storages of processor %s triggered by %s", proc.Graph().Group(), r.RemoteAddr)
+	s.writeResult(w, &actionResult{Action: "compact"}, proc.Compact(r.Context()))
+}
+
+// compacts the local storages of a view
+func (s *Server) compactView(w http.ResponseWriter, r *http.Request) {
+	view, ok := s.view(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.log.Printf("compacting storages of view %s triggered by %s", view.Topic(), r.RemoteAddr)
+	s.writeResult(w, &actionResult{Action: "compact"}, view.Compact(r.Context()))
+}
+
+// compares the group table of a processor with its changelog, see goka.Processor.CheckTable.
+// The sample can be passed as query parameter.
+func (s *Server) checkProcessorTable(w http.ResponseWriter, r *http.Request) {
+	s.repairTable(w, r, false)
+}
+
+// repairs the group table of a processor from its changelog, see goka.Processor.RepairTable
+func (s *Server) repairProcessorTable(w http.ResponseWriter, r *http.Request) {
+	s.repairTable(w, r, true)
+}
+
+func (s *Server) repairTable(w http.ResponseWriter, r *http.Request, repair bool) {
+	proc, ok := s.processor(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var sample int
+	if param := r.URL.Query().Get("sample"); param != "" {
+		var err error
+		sample, err = strconv.Atoi(param)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid sample %q", param), http.StatusBadRequest)
+			return
+		}
+	}
+
+	result := &actionResult{Action: "check"}
+	if repair {
+		result.Action = "repair"
+	}
+	s.log.Printf("%s of table of processor %s triggered by %s", result.Action, proc.Graph().Group(), r.RemoteAddr)
+
+	var err error
+	if repair {
+		result.Reports, err = proc.RepairTable(r.Context(), sample)
+	} else {
+		result.Reports, err = proc.CheckTable(r.Context(), sample)
+	}
+	s.writeResult(w, result, err)
+}
+
+// writeResult writes the result of an action as JSON
+func (s *Server) writeResult(w http.ResponseWriter, result *actionResult, err error) {
+	status := http.StatusOK
+	if err != nil {
+		s.log.Printf("error running action %s: %v", result.Action, err)
+		result.Error = err.Error()
+		status = http.StatusInternalServerError
+	}
+	marshalled, err := json.Marshal(result)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(marshalled)
+}
@@ -0,0 +1,91 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+func request(router *mux.Router, method, path string, token string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("X-Token", token)
+	}
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestActions(t *testing.T) {
+	gkt := tester.New(t)
+
+	view, err := goka.NewView(nil, goka.GroupTable("group"), new(codec.String), goka.WithViewTester(gkt))
+	test.AssertNil(t, err)
+	proc, err := goka.NewProcessor(nil, goka.DefineGroup("stateless",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+	), goka.WithTester(gkt))
+	test.AssertNil(t, err)
+
+	t.Run("disabled", func(t *testing.T) {
+		router := mux.NewRouter()
+		srv := NewServer("/monitor", router)
+		srv.AttachView(view)
+		rec := request(router, http.MethodPost, "/monitor/actions/view/0/compact", "")
+		test.AssertEqual(t, rec.Code, http.StatusNotFound)
+	})
+
+	router := mux.NewRouter()
+	srv := NewServer("/monitor", router, WithActions(func(r *http.Request) bool {
+		return r.Header.Get("X-Token") == "secret"
+	}))
+	srv.AttachView(view)
+	srv.AttachProcessor(proc)
+
+	t.Run("unauthorized", func(t *testing.T) {
+		rec := request(router, http.MethodPost, "/monitor/actions/view/0/compact", "")
+		test.AssertEqual(t, rec.Code, http.StatusForbidden)
+		rec = request(router, http.MethodPost, "/monitor/actions/view/0/compact", "wrong")
+		test.AssertEqual(t, rec.Code, http.StatusForbidden)
+	})
+
+	t.Run("method", func(t *testing.T) {
+		rec := request(router, http.MethodGet, "/monitor/actions/view/0/compact", "secret")
+		test.AssertEqual(t, rec.Code, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		rec := request(router, http.MethodPost, "/monitor/actions/view/1/compact", "secret")
+		test.AssertEqual(t, rec.Code, http.StatusNotFound)
+		rec = request(router, http.MethodPost, "/monitor/actions/processor/x/compact", "secret")
+		test.AssertEqual(t, rec.Code, http.StatusNotFound)
+	})
+
+	t.Run("compact", func(t *testing.T) {
+		rec := request(router, http.MethodPost, "/monitor/actions/view/0/compact", "secret")
+		test.AssertEqual(t, rec.Code, http.StatusOK)
+		var result actionResult
+		test.AssertNil(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		test.AssertEqual(t, result.Action, "compact")
+		test.AssertEqual(t, result.Error, "")
+	})
+
+	t.Run("check", func(t *testing.T) {
+		rec := request(router, http.MethodPost, "/monitor/actions/processor/0/check?sample=x", "secret")
+		test.AssertEqual(t, rec.Code, http.StatusBadRequest)
+
+		// the processor has no group table to check
+		rec = request(router, http.MethodPost, "/monitor/actions/processor/0/check?sample=10", "secret")
+		test.AssertEqual(t, rec.Code, http.StatusInternalServerError)
+		var result actionResult
+		test.AssertNil(t, json.Unmarshal(rec.Body.Bytes(), &result))
+		test.AssertEqual(t, result.Action, "check")
+		test.AssertTrue(t, result.Error != "")
+	})
+}
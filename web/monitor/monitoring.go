@@ -24,9 +24,13 @@ type Server struct {
 	log goka.Logger
 	m   sync.RWMutex
 
-	basePath   string
-	views      []*goka.View
-	processors []*goka.Processor
+	basePath    string
+	views       []*goka.View
+	processors  []*goka.Processor
+	middlewares []mux.MiddlewareFunc
+
+	// authorizeAction is set if the action routes are enabled
+	authorizeAction ActionAuthorizer
 }
 
 // NewServer creates a new Server
@@ -41,10 +45,18 @@ func NewServer(basePath string, router *mux.Router, opts ...Option) *Server {
 	}
 
 	sub := router.PathPrefix(basePath).Subrouter()
+	sub.Use(srv.middlewares...)
 	sub.HandleFunc("/", srv.index)
 	sub.HandleFunc("/processor/{idx}", srv.renderProcessor)
 	sub.HandleFunc("/view/{idx}", srv.renderView)
+	sub.HandleFunc("/topology", srv.renderTopology)
+	sub.HandleFunc("/data/topology", srv.renderTopologyData)
+	sub.HandleFunc("/data/views", srv.renderViewMetrics)
+	sub.HandleFunc("/data/views/{idx}", srv.renderViewMetric)
 	sub.HandleFunc("/data/{type}/{idx}", srv.renderData)
+	if srv.authorizeAction != nil {
+		srv.registerActions(sub)
+	}
 
 	return srv
 }
@@ -65,7 +77,8 @@ func (s *Server) AttachProcessor(processor *goka.Processor) {
 	s.processors = append(s.processors, processor)
 }
 
-// AttachView attaches a processor to the monitor.
+// AttachView attaches a view to the monitor. Views can attach themselves when they
+// are created by passing the server with goka.WithViewRegistry.
 func (s *Server) AttachView(view *goka.View) {
 	s.m.Lock()
 	defer s.m.Unlock()
@@ -193,3 +206,46 @@ func (s *Server) renderView(w http.ResponseWriter, r *http.Request) {
 		s.log.Printf("error rendering view details: %v", err)
 	}
 }
+
+// renders the topology page
+func (s *Server) renderTopology(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := templates.LoadTemplates(append(baseTemplates, "web/templates/monitor/topology.go.html")...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	params := map[string]interface{}{
+		"base_path":  s.basePath,
+		"page_title": "Topology",
+		"processors": s.processors,
+		"views":      s.views,
+	}
+
+	if err = tmpl.Execute(w, params); err != nil {
+		s.log.Printf("error rendering topology: %v", err)
+	}
+}
+
+// renders the group graphs of all processors including their stats as JSON
+func (s *Server) renderTopologyData(w http.ResponseWriter, r *http.Request) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	topo := newTopology()
+	for idx, proc := range s.processors {
+		topo.addProcessor(ctx, idx, proc)
+	}
+
+	marshalled, err := json.Marshal(topo)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Write(marshalled)
+}
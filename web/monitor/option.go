@@ -1,6 +1,9 @@
 package monitor
 
-import "github.com/lovoo/goka"
+import (
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+)
 
 // Option is a function that applies a configuration to the server.
 type Option func(s *Server)
@@ -11,3 +14,28 @@ func WithLogger(l goka.Logger) Option {
 		s.log = l
 	}
 }
+
+// WithActions enables the action routes, which let operators trigger maintenance
+// on the attached processors and views of a running instance with POST requests:
+//
+//	<basePath>/actions/processor/<idx>/compact  compacts the local storages
+//	<basePath>/actions/processor/<idx>/check    compares the group table with its changelog
+//	<basePath>/actions/processor/<idx>/repair   repairs the group table from its changelog
+//	<basePath>/actions/view/<idx>/compact       compacts the local storages
+//
+// check and repair take an optional query parameter sample, see goka.Processor.CheckTable.
+// Every request must be authorized by authorize, otherwise it is rejected with 403.
+// The actions are disabled by default.
+func WithActions(authorize ActionAuthorizer) Option {
+	return func(s *Server) {
+		s.authorizeAction = authorize
+	}
+}
+
+// WithMiddleware adds middlewares to all routes of the server, e.g. to authorize
+// the requests with auth.Middleware.
+func WithMiddleware(middlewares ...mux.MiddlewareFunc) Option {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"github.com/lovoo/goka"
+)
+
+// node types of the topology
+const (
+	nodeGroup  = "group"
+	nodeStream = "stream"
+	nodeTable  = "table"
+)
+
+// edge types of the topology, named like the edges of the group graph
+const (
+	edgeInput  = "input"
+	edgeJoin   = "join"
+	edgeLookup = "lookup"
+	edgeLoop   = "loop"
+	edgeTable  = "table"
+	edgeOutput = "output"
+	edgeOutbox = "outbox"
+)
+
+// topologyNode is a processor group or a topic in the topology
+type topologyNode struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// Index of the processor in the monitor, only set for groups
+	Index int `json:"index"`
+}
+
+// topologyLink is an edge between a topic and a processor group, annotated
+// with the traffic seen by the processor on that edge.
+type topologyLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Type   string `json:"type"`
+
+	Count     uint  `json:"count"`
+	Bytes     int   `json:"bytes"`
+	OffsetLag int64 `json:"offsetLag"`
+	// Delay is the maximum delay of all partitions
+	Delay time.Duration `json:"delay"`
+}
+
+// topology represents all group graphs of the processors attached to the monitor.
+type topology struct {
+	Now   time.Time       `json:"now"`
+	Nodes []*topologyNode `json:"nodes"`
+	Links []*topologyLink `json:"links"`
+}
+
+func newTopology() *topology {
+	return &topology{
+		Now: time.Now(),
+	}
+}
+
+func (t *topology) addNode(id, nodeType string, index int) {
+	for _, n := range t.Nodes {
+		if n.ID == id {
+			return
+		}
+	}
+	t.Nodes = append(t.Nodes, &topologyNode{
+		ID:    id,
+		Type:  nodeType,
+		Index: index,
+	})
+}
+
+func (t *topology) addLink(source, target, linkType string) *topologyLink {
+	link := &topologyLink{
+		Source: source,
+		Target: target,
+		Type:   linkType,
+	}
+	t.Links = append(t.Links, link)
+	return link
+}
+
+// addProcessor adds the group graph of the processor to the topology and annotates
+// the edges with the processor's stats.
+func (t *topology) addProcessor(ctx context.Context, idx int, proc *goka.Processor) {
+	var (
+		gg    = proc.Graph()
+		group = string(gg.Group())
+		stats = proc.StatsWithContext(ctx)
+	)
+
+	t.addNode(group, nodeGroup, idx)
+
+	addInputs := func(edges goka.Edges, nodeType, linkType string) {
+		for _, e := range edges {
+			t.addNode(e.Topic(), nodeType, -1)
+			link := t.addLink(e.Topic(), group, linkType)
+			link.trackInput(stats, e.Topic())
+		}
+	}
+	addInputs(gg.InputStreams(), nodeStream, edgeInput)
+	addInputs(gg.JointTables(), nodeTable, edgeJoin)
+	addInputs(gg.LookupTables(), nodeTable, edgeLookup)
+
+	addLoop := func(loop goka.Edge) {
+		t.addNode(loop.Topic(), nodeStream, -1)
+		t.addLink(group, loop.Topic(), edgeLoop).trackOutput(stats, loop.Topic())
+		t.addLink(loop.Topic(), group, edgeLoop).trackInput(stats, loop.Topic())
+	}
+	if loop := gg.LoopStream(); loop != nil {
+		addLoop(loop)
+	}
+	for _, loop := range gg.NamedLoopStreams() {
+		addLoop(loop)
+	}
+
+	if table := gg.GroupTable(); table != nil {
+		t.addNode(table.Topic(), nodeTable, -1)
+		t.addLink(group, table.Topic(), edgeTable).trackOutput(stats, table.Topic())
+	}
+
+	for _, e := range gg.OutputStreams() {
+		t.addNode(e.Topic(), nodeStream, -1)
+		t.addLink(group, e.Topic(), edgeOutput).trackOutput(stats, e.Topic())
+	}
+
+	for _, e := range gg.OutboxStreams() {
+		t.addNode(e.Topic(), nodeStream, -1)
+		t.addLink(group, e.Topic(), edgeOutbox).trackOutput(stats, e.Topic())
+	}
+}
+
+// trackInput sums up the input stats of all partitions for the link's topic.
+// Joined and lookup tables are tracked via their table stats.
+func (l *topologyLink) trackInput(stats *goka.ProcessorStats, topic string) {
+	if stats == nil {
+		return
+	}
+
+	addTableStats := func(ts *goka.TableStats) {
+		if ts == nil || ts.Input == nil {
+			return
+		}
+		l.addInputStats(ts.Input)
+	}
+
+	switch l.Type {
+	case edgeLookup:
+		if view, ok := stats.Lookup[topic]; ok && view != nil {
+			for _, ts := range view.Partitions {
+				addTableStats(ts)
+			}
+		}
+	case edgeJoin:
+		for _, part := range stats.Group {
+			if part != nil {
+				addTableStats(part.Joined[topic])
+			}
+		}
+	default:
+		for _, part := range stats.Group {
+			if part == nil {
+				continue
+			}
+			if input, ok := part.Input[topic]; ok && input != nil {
+				l.addInputStats(input)
+			}
+		}
+	}
+}
+
+func (l *topologyLink) addInputStats(input *goka.InputStats) {
+	l.Count += input.Count
+	l.Bytes += input.Bytes
+	l.OffsetLag += input.OffsetLag
+	if input.Delay > l.Delay {
+		l.Delay = input.Delay
+	}
+}
+
+// trackOutput sums up the output stats of all partitions for the link's topic
+func (l *topologyLink) trackOutput(stats *goka.ProcessorStats, topic string) {
+	if stats == nil {
+		return
+	}
+	for _, part := range stats.Group {
+		if part == nil {
+			continue
+		}
+		if output, ok := part.Output[topic]; ok && output != nil {
+			l.Count += output.Count
+			l.Bytes += output.Bytes
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+func TestTopologyData(t *testing.T) {
+	gkt := tester.New(t)
+	router := mux.NewRouter()
+	srv := NewServer("/monitor", router)
+
+	proc, err := goka.NewProcessor(nil, goka.DefineGroup("group",
+		goka.Input("input", new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		goka.Join("joined", new(codec.String)),
+		goka.Lookup("lookup", new(codec.String)),
+		goka.Output("output", new(codec.String)),
+		goka.Loop(new(codec.String), func(ctx goka.Context, msg interface{}) {}),
+		goka.Persist(new(codec.String)),
+	), goka.WithTester(gkt))
+	test.AssertNil(t, err)
+	srv.AttachProcessor(proc)
+
+	cancel, wait := test.Run(t, proc.Run)
+	defer func() {
+		cancel()
+		wait()
+	}()
+	proc.WaitForReady()
+	gkt.Consume("input", "key", "value")
+
+	rec := request(router, http.MethodGet, "/monitor/data/topology", "")
+	test.AssertEqual(t, rec.Code, http.StatusOK)
+
+	var topo topology
+	test.AssertNil(t, json.Unmarshal(rec.Body.Bytes(), &topo))
+
+	nodes := make(map[string]string)
+	for _, node := range topo.Nodes {
+		nodes[node.ID] = node.Type
+	}
+	test.AssertEqual(t, nodes, map[string]string{
+		"group":       nodeGroup,
+		"input":       nodeStream,
+		"joined":      nodeTable,
+		"lookup":      nodeTable,
+		"group-loop":  nodeStream,
+		"group-table": nodeTable,
+		"output":      nodeStream,
+	})
+
+	links := make(map[string]string)
+	for _, link := range topo.Links {
+		links[link.Source+">"+link.Target] = link.Type
+		if link.Source == "input" {
+			// the links are annotated with the processor's stats
+			test.AssertEqual(t, link.Count, uint(1))
+		}
+	}
+	test.AssertEqual(t, links, map[string]string{
+		"input>group":       edgeInput,
+		"joined>group":      edgeJoin,
+		"lookup>group":      edgeLookup,
+		"group>group-loop":  edgeLoop,
+		"group-loop>group":  edgeLoop,
+		"group>group-table": edgeTable,
+		"group>output":      edgeOutput,
+	})
+}
@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+)
+
+// viewMetrics summarizes the statistics of a view.
+type viewMetrics struct {
+	Index int
+	Topic string
+	State string
+	// Lag is the number of messages of the table topic not yet consumed
+	Lag int64
+	// StorageMemory approximates the memory used by the storages of all partitions
+	StorageMemory int64
+	Lookups       int64
+	Hits          int64
+	// HitRate is the share of lookups that returned a value, 0 without lookups
+	HitRate float64
+}
+
+var viewStateNames = map[goka.ViewState]string{
+	goka.ViewStateIdle:         "idle",
+	goka.ViewStateInitializing: "initializing",
+	goka.ViewStateConnecting:   "connecting",
+	goka.ViewStateCatchUp:      "catching up",
+	goka.ViewStateRunning:      "running",
+}
+
+func newViewMetrics(idx int, view *goka.View, stats *goka.ViewStats) *viewMetrics {
+	metrics := &viewMetrics{
+		Index:   idx,
+		Topic:   view.Topic(),
+		State:   viewStateNames[view.CurrentState()],
+		Lookups: stats.Lookups,
+		Hits:    stats.Hits,
+	}
+	for _, partition := range stats.Partitions {
+		metrics.StorageMemory += partition.StorageMemory
+		if partition.Recovery == nil {
+			continue
+		}
+		// the offset is the last consumed message, the hwm the next one to be written
+		if lag := partition.Recovery.Hwm - partition.Recovery.Offset - 1; lag > 0 {
+			metrics.Lag += lag
+		}
+	}
+	if stats.Lookups > 0 {
+		metrics.HitRate = float64(stats.Hits) / float64(stats.Lookups)
+	}
+	return metrics
+}
+
+// renders the metrics of all views as JSON
+func (s *Server) renderViewMetrics(w http.ResponseWriter, r *http.Request) {
+	s.m.RLock()
+	views := append([]*goka.View(nil), s.views...)
+	s.m.RUnlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	metrics := make([]*viewMetrics, 0, len(views))
+	for idx, view := range views {
+		metrics = append(metrics, newViewMetrics(idx, view, view.Stats(ctx)))
+	}
+
+	marshalled, err := json.Marshal(metrics)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(marshalled)
+}
+
+// renders the metrics of one view as JSON for the view details page
+func (s *Server) renderViewMetric(w http.ResponseWriter, r *http.Request) {
+	s.m.RLock()
+	views := append([]*goka.View(nil), s.views...)
+	s.m.RUnlock()
+
+	idx, err := strconv.Atoi(mux.Vars(r)["idx"])
+	if err != nil || idx < 0 || idx >= len(views) {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	marshalled, err := json.Marshal(newViewMetrics(idx, views[idx], views[idx].Stats(ctx)))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(marshalled)
+}
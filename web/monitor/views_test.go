@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+	"github.com/lovoo/goka/codec"
+	"github.com/lovoo/goka/internal/test"
+	"github.com/lovoo/goka/tester"
+)
+
+func TestViewMetrics(t *testing.T) {
+	gkt := tester.New(t)
+	router := mux.NewRouter()
+	srv := NewServer("/monitor", router)
+
+	view, err := goka.NewView(nil, goka.GroupTable("group"), new(codec.String),
+		goka.WithViewTester(gkt),
+		goka.WithViewRegistry(srv),
+	)
+	test.AssertNil(t, err)
+
+	cancel, wait := test.Run(t, view.Run)
+	defer func() {
+		cancel()
+		wait()
+	}()
+	test.AssertNil(t, view.WaitRecovered(context.Background()))
+
+	gkt.SetTableValue(goka.GroupTable("group"), "key", "value")
+	for _, key := range []string{"key", "key", "key", "missing"} {
+		_, err := view.Get(key)
+		test.AssertNil(t, err)
+	}
+
+	rec := request(router, http.MethodGet, "/monitor/data/views", "")
+	test.AssertEqual(t, rec.Code, http.StatusOK)
+	var metrics []*viewMetrics
+	test.AssertNil(t, json.Unmarshal(rec.Body.Bytes(), &metrics))
+	// the view attached itself
+	test.AssertEqual(t, len(metrics), 1)
+	test.AssertEqual(t, metrics[0].Topic, "group-table")
+	test.AssertEqual(t, metrics[0].State, "running")
+	test.AssertEqual(t, metrics[0].Lookups, int64(4))
+	test.AssertEqual(t, metrics[0].Hits, int64(3))
+	test.AssertEqual(t, metrics[0].HitRate, 0.75)
+
+	// the metrics of a single view are rendered on its details page
+	rec = request(router, http.MethodGet, "/monitor/data/views/0", "")
+	test.AssertEqual(t, rec.Code, http.StatusOK)
+	var metric viewMetrics
+	test.AssertNil(t, json.Unmarshal(rec.Body.Bytes(), &metric))
+	test.AssertEqual(t, metric.Lookups, int64(4))
+	test.AssertEqual(t, metric.HitRate, 0.75)
+	test.AssertEqual(t, request(router, http.MethodGet, "/monitor/data/views/1", "").Code, http.StatusNotFound)
+
+	rec = request(router, http.MethodGet, "/monitor/view/0", "")
+	test.AssertEqual(t, rec.Code, http.StatusOK)
+	test.AssertStringContains(t, rec.Body.String(), "/monitor/data/views/0")
+}
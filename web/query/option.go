@@ -1,6 +1,9 @@
 package query
 
-import "github.com/lovoo/goka"
+import (
+	"github.com/gorilla/mux"
+	"github.com/lovoo/goka"
+)
 
 // Option is a function that applies a configuration to the server.
 type Option func(s *Server)
@@ -20,3 +23,11 @@ func WithLogger(l goka.Logger) Option {
 		s.log = l
 	}
 }
+
+// WithMiddleware adds middlewares to all routes of the server, e.g. to authorize
+// the requests with auth.Middleware.
+func WithMiddleware(middlewares ...mux.MiddlewareFunc) Option {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
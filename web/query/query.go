@@ -46,10 +46,11 @@ type Server struct {
 	log goka.Logger
 	m   sync.RWMutex
 
-	basePath  string
-	loader    templates.Loader
-	sources   map[string]goka.Getter
-	humanizer Humanizer
+	basePath    string
+	loader      templates.Loader
+	sources     map[string]goka.Getter
+	humanizer   Humanizer
+	middlewares []mux.MiddlewareFunc
 }
 
 // NewServer creates a server with the given options.
@@ -67,6 +68,7 @@ func NewServer(basePath string, router *mux.Router, opts ...Option) *Server {
 	}
 
 	sub := router.PathPrefix(basePath).Subrouter()
+	sub.Use(srv.middlewares...)
 	sub.HandleFunc("/", srv.index)
 	sub.HandleFunc("/{name}", srv.source)
 	sub.HandleFunc("/{name}/{key:.*}", srv.key)
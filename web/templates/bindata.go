@@ -8,6 +8,7 @@
 // web/templates/monitor/details_view.go.html
 // web/templates/monitor/index.go.html
 // web/templates/monitor/menu.go.html
+// web/templates/monitor/topology.go.html
 // web/templates/query/index.go.html
 
 package templates
@@ -224,7 +225,7 @@ func bindataWebTemplatesMonitorDetailsprocessorGoHtml() (*asset, error) {
 	return a, nil
 }
 
-var _bindataWebTemplatesMonitorDetailsviewGoHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x58\x5f\x6f\xdb\x38\x12\x7f\xcf\xa7\x98\xe3\x3d\x58\x42\x6c\x29\x7f\x7a\x2f\xb6\xe5\xc3\xb5\xb9\x45\x03\xa4\xd9\xa2\x0d\xba\x0f\xbb\x8b\x82\x11\xc7\x36\xbb\x32\x29\x90\x94\x9c\xac\xa0\xef\xbe\x20\x25\x4b\x94\xe2\x34\x29\x76\xfb\x60\x9b\xf3\xe7\x37\xc3\x99\xe1\x8f\x6c\xaa\x8a\xe1\x9a\x0b\x04\x92\x4a\x61\x50\x18\x52\xd7\x27\x4b\xc6\x4b\x48\x33\xaa\x75\x42\x94\xdc\x93\xd5\x09\x80\x2f\xb3\xa6\x94\x0b\x54\x4e\x33\xd6\x65\xb3\x1d\x9b\x9d\x5f\x1c\x74\xdb\xf3\xd5\x17\x8e\x7b\xa8\xaa\xc8\x70\x93\x61\x5d\x2f\xe3\xed\xf9\xea\xe4\x89\x67\x4e\x05\x66\xe0\x3e\x67\x0c\xd7\xb4\xc8\x4c\x8b\xf1\xbc\xdd\x16\x29\xe3\x62\xd3\xd9\xd9\x78\x97\xab\x3b\x7a\x9f\x21\x68\x43\x0d\xd7\x86\xa7\x7a\x19\x6f\x2f\x3b\xa4\x98\xf1\xb2\x8d\x7e\x04\x77\x76\x2f\xd9\xa3\x0f\x67\x1c\x56\x6b\xd2\x2c\xdc\xe7\x4c\x1b\xc5\x73\x64\x9e\xad\xb5\xb6\x09\xf9\x12\x2b\x53\x43\x81\x33\x03\x57\x8b\x84\x7c\xa4\xca\x70\xc3\xa5\x20\xa0\xe4\x5e\xe7\x54\x24\xe4\x82\xac\x3a\xf1\x32\x36\xdb\xef\xb8\x7f\x36\xd4\x14\x1a\xe4\x1a\xcc\x16\x21\x57\x32\x45\xad\xa5\x1a\x82\x59\x23\x7c\x05\x90\x06\x56\x28\x2e\x36\xa0\x30\x95\x25\xaa\x47\x02\xa9\xcc\x1a\x98\x4b\xb2\xfa\xd4\x4a\x7f\x08\xa9\x10\x60\xf8\x0e\x3d\xa4\x37\x64\x75\x2d\x52\xb9\xb3\xea\x3b\x45\xd7\x6b\x9e\x3e\x45\x5c\xc6\xe3\xaa\x7d\xbf\x8c\x77\x7c\x87\xb6\x0a\x39\xd5\x1a\x59\xb7\x01\xd0\x12\xd6\x54\x91\x95\xd5\xbf\x90\xf7\x6d\xb1\xbb\x47\x65\x41\x76\xa8\x35\xdd\xa0\x3e\xc0\x20\x83\x1c\x15\x68\x4c\xa5\x60\x64\xf5\xe9\xe5\x6a\x1e\xc1\xca\xe8\x66\x63\xb7\x7c\x8f\x5b\x2e\x18\xbc\xff\xe5\x03\x59\xdd\xd0\xcd\x8f\x03\x15\x39\xa3\xe6\xef\xa4\x74\xff\x68\x9e\x81\x79\x6b\x35\x2f\xe0\x88\x0e\x47\xae\xd7\x1a\x8d\x9e\xba\xd1\x2b\xed\x11\xe7\xdd\x36\xc9\xea\x67\xa7\x85\x97\xb7\x68\xc7\x03\x18\x66\xf4\xf1\x19\x24\xd7\xdb\xa3\x38\xe3\x29\xb1\x16\xa3\xf3\xb7\x34\xf6\x40\x03\x67\x09\xb1\xc0\x9f\x3b\x4e\x20\x23\x47\x6b\xe6\x1d\xfb\xd8\x1d\xf2\x11\x69\xc0\x88\x3f\x96\x3a\x55\x3c\x37\x60\x1e\x73\xbb\x11\x7c\x30\xf1\x37\x5a\xd2\x46\x4a\x3a\x92\x29\xa9\x82\x8c\x6a\xf3\xa5\x4d\x40\x43\x02\xec\x32\xca\x64\x4a\xb3\x20\x5c\x78\x56\xda\x1d\xe7\x0f\x34\x87\x04\xaa\xb3\x39\xd1\x46\xe6\x96\x63\xa6\x70\x3e\x27\x5c\x70\xc3\x69\xc6\xff\xb4\x55\x99\xc2\xc5\xdc\xf2\xb0\xc0\xd4\x34\xeb\xcb\x39\x69\xe7\xb5\x59\xbf\x99\x93\x5c\x61\x4e\xdb\xe5\x7f\xe6\x40\x54\x21\x84\x5d\xd5\x0b\x3f\x35\x8d\xa9\xbe\x93\xb7\x54\x48\x48\xe0\xfc\xec\xf0\x6f\x60\xa3\x50\x30\x54\x57\x68\x28\xcf\x6c\xfa\xeb\x42\xa4\x96\x9e\x82\xfc\x40\x54\x3a\xac\x4e\xba\xf2\xf1\xb5\xa7\x80\x24\x01\x51\x64\x59\x58\x79\x15\x57\x68\x0a\x25\x16\x9d\xa4\xee\x9d\x6d\xbc\x66\x3a\xbf\x0c\x3a\xe6\x87\xb5\x85\x1a\x44\xf4\xeb\x07\x49\x5f\xc8\x5f\x9d\x65\xd4\xf0\xe4\xef\x0b\xdf\x81\xaf\x83\x4e\x99\x65\xc8\x06\xf9\x41\x8f\x45\x74\xa3\x27\x0b\x4f\x5f\x8f\x22\x2b\x4c\xff\x2f\x98\x1b\xd5\x26\xba\x8e\x0e\x7c\xd9\xfd\x70\xda\x7f\x25\x40\x08\xfc\xf7\xbb\x36\xf3\x56\x7b\x2b\xf7\x8b\xa7\x71\x7a\xbb\x04\x02\x81\x7b\xb8\xa2\x06\x83\x3e\x81\x10\x66\xd0\x89\x47\x61\x3e\x1b\xaa\x8c\x33\x0a\x21\x76\xcd\x8e\xce\x9e\x0b\x61\x49\x05\x12\x78\x56\x7f\x43\x37\x4f\xf7\xfa\x7e\xbf\x83\xd9\x58\xd8\x70\xc1\x62\xdc\xad\x54\x16\xc2\x3c\x17\xc5\xb2\x54\xaf\xf3\x5d\xe3\x18\x32\x34\x13\x0d\xe9\x16\xd3\x3f\x80\xaf\x61\x8f\xb0\xa5\x25\x02\x85\x5c\x61\xc9\x65\xa1\x81\x51\x43\x2d\xff\x50\xc1\xc0\x7e\x9b\x2d\xee\xc0\x48\xfb\xcd\xd5\x10\x2c\x95\x4a\x61\x6a\xa0\xa4\x59\x81\x7a\x94\x86\x3d\xb7\x87\x33\x3b\x38\xc3\xd1\x06\x4d\x60\xb6\x5c\x87\xe3\xa1\xea\x5c\x46\x03\x15\xc7\xc0\xf8\x7a\x6d\xb3\xe8\xd2\x74\x85\x02\x2e\x5a\x0a\xd6\x03\x07\x1b\xdf\xb2\xe3\x95\xf5\x4a\x20\xe8\x86\x02\x66\x7d\x5e\x76\xed\xf7\x72\x80\xd0\x8e\x78\xe1\xce\xa0\x4f\x0f\xa3\xd4\x60\xdc\xf4\xf1\xdc\xb4\x6c\xee\xc7\x1d\xe9\xc2\xf8\x90\xea\x62\x00\x5d\x0f\x33\xf2\x7b\xde\x06\xb9\x16\x79\x61\xa2\x77\x56\x31\x08\xe0\xc9\x9f\x03\xf7\x86\x64\x00\xe6\x2e\xb2\x23\x60\x4e\x7e\x1c\xcc\x3f\xd0\xc3\x46\xeb\xb6\xd1\xd3\xa6\x5b\xe1\x93\x39\x76\x97\xd7\x38\x85\x2b\x2b\x0c\xe3\x9e\x5c\x07\x6e\x0d\xfd\xc1\x64\x69\xd8\x6a\x72\xda\xf8\x75\x8c\x19\x19\xf9\x13\x7f\x40\x16\x9c\x85\xa7\x93\x65\x6c\xd8\xea\x37\x31\x39\x1d\x6c\xdc\x73\x2c\xf4\x0b\x46\x3e\x65\x9c\x4e\xf4\xab\x6c\x6d\x51\x5f\x9f\x86\xc7\x08\x2f\x58\x76\xed\x7f\x3d\xf8\xa1\xc7\x3f\x56\x95\x43\x1b\x9a\xe1\xbc\xa1\x9b\xd7\xbb\xbb\x76\x76\xe6\x17\xa1\x57\x33\xef\xbe\x5a\x0c\x2f\xac\x8d\x92\x45\xfe\x6e\x4b\xb9\x80\x04\xbe\x46\xa9\xfd\xe5\xdd\x81\xd1\xc7\xfe\x9e\x5c\x0c\x1c\x3b\x9b\x1b\xae\x0d\x24\x1e\xd0\x20\xb7\x68\x47\xf3\xa0\xbb\xfe\xca\xa9\xf3\xbb\x1e\xdf\x59\xde\x68\x7d\x8d\xa8\xd6\x7c\x23\x82\x27\x06\x00\x55\x3d\x3d\x22\x2d\x8f\x09\x2b\x98\xdc\xca\xfd\x64\xde\xdf\x28\xe1\x31\x33\x80\x49\xb7\x91\x09\xcc\x6d\x76\x1a\xaf\x85\x09\xda\x34\x8f\xf9\xd4\x4f\x64\xe1\x88\x3a\xc2\xa8\xe1\xe4\x20\x8c\xb4\x54\xe6\xed\x63\xe0\x45\x69\x95\x81\x7f\x1e\xe3\x18\xac\x21\xd0\x2c\xeb\x0b\xab\x7d\x75\xf3\xb0\x98\x02\x0a\x83\xca\xdd\x0e\x0a\x77\xb2\x44\x77\x61\x0c\x1a\xc3\x9a\x57\x9a\xc6\x0c\x53\x13\x90\x7f\x8f\x9e\x8f\x61\xab\xf9\x5f\x96\x05\xa4\x3f\xbb\xf7\xf2\x81\x84\x91\x05\x0b\x06\x9d\xf5\xb6\xc6\xa2\xad\xd9\x65\xc1\xb1\x27\xce\xc0\xca\xa5\x18\x84\x11\xcd\x73\x14\x2c\x20\x46\x91\x30\x72\xff\x11\x45\x16\x90\x41\xc4\x29\x18\x55\x60\xf8\x5a\xe0\x07\x6e\x82\x30\x6a\x36\x1e\x84\x87\xf2\xf5\x23\xbd\xe7\x82\xc9\xbd\x25\xbe\x6b\x9b\x43\x49\xb3\x7e\xf4\x42\xe8\x47\x8e\x5d\x46\xdf\xb4\x14\x01\xa9\xaa\xe8\x9e\x6a\xfc\x9a\x53\xb3\xad\xeb\xd8\x6e\x3f\xb6\xf5\x8a\xab\x2a\x2a\xa9\xd2\x11\x67\x0f\x75\x4d\xa6\xc3\x77\x64\x97\x54\x3d\x85\x8b\xb3\xb3\xb3\xbe\x93\xf6\x56\xb6\x3d\xe4\x06\xda\x57\x6f\xf6\x78\xf2\x4f\xc5\x6c\x9f\xf1\xcd\x2b\xdd\xfd\x69\xa3\x79\xd2\xb7\x5f\x55\x85\x82\xd5\xf5\xc9\x5f\x01\x00\x00\xff\xff\xb6\xfc\x7d\x2a\x1a\x11\x00\x00")
+var _bindataWebTemplatesMonitorDetailsviewGoHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xd5\x58\x5b\x6f\xdb\x36\x14\x7e\xcf\xaf\xe0\x38\x0c\x96\x96\x44\xce\xa5\x7b\xb1\x63\x0f\x6d\xb3\xa1\x01\x9a\xae\x68\x83\xee\x61\x1b\x0a\x5a\xa2\x6d\xb6\xba\x81\xa4\xec\xb8\x86\xfe\xfb\x0e\x29\x89\x22\x65\xb9\x76\xba\xed\x61\x79\x70\xac\x73\xe7\xb9\x7c\x87\xf2\x76\x1b\xd1\x39\x4b\x29\xc2\x61\x96\x4a\x9a\x4a\x5c\x96\x27\x37\x11\x5b\xa1\x30\x26\x42\x4c\x30\xcf\xd6\x78\x7a\x82\x90\x4d\x53\xa2\x04\x94\xb8\xe6\x74\x79\xf1\x79\x12\x9d\x5f\x5e\x35\xbc\xe5\xe5\xf4\x03\xa3\x6b\xb4\xdd\x06\x92\xc9\x98\x96\xe5\xcd\x10\x68\x27\x3b\x9a\x39\x49\x69\x8c\xf4\xe7\x39\x04\x45\x8a\x58\xd6\x36\xf6\xcb\x2d\x29\x89\x58\xba\x30\x72\xca\xdf\x75\xe5\x4f\x48\x22\x99\x90\x2c\x14\xe0\xef\xda\x18\x1a\x82\xa5\xda\x79\x8f\xd9\xf3\x59\x16\x6d\x6c\x6b\x92\xcc\x62\xda\x88\x54\x0f\xfa\xf3\x5c\x48\xce\x72\x1a\x59\xb2\x4a\x5a\xc5\x63\x53\x14\x8d\xbb\x04\x2d\x86\x74\x2a\x26\xf8\x3d\x04\x49\x51\x36\x47\xa0\x89\x56\x10\x36\x9e\x6a\xd2\xcd\x50\x2e\xbf\xa2\xf6\xa6\x48\x66\x94\x2b\xbd\x84\x0a\x41\x16\x54\xa8\xef\x24\x56\x69\xe1\x20\xc3\xb2\x54\xa0\x98\x2c\x16\x90\x1b\x34\xa3\x4b\x96\x46\xe8\xd5\xef\xf7\x78\xfa\x9a\x2c\x0e\x98\x7e\x9e\xe7\x3c\x7b\x64\x89\x8a\x2b\xa1\x49\xc6\x37\xa8\x10\x34\x42\xb3\x8d\x8e\x51\xc8\x8c\xf7\xfb\x83\xc8\xd9\x97\xe3\x03\x8f\xb3\xec\x73\x91\x83\xd6\xeb\xea\xcb\x53\x15\x11\xa7\xb2\xe0\xa9\x3a\x20\x41\x2b\x12\x17\x14\x4f\x5f\x31\x79\xc8\xce\xfb\x25\xe1\xf4\xb0\x19\xf4\xae\xb7\x08\x40\x71\xaa\xa9\x24\x3a\x15\xbf\x91\xaa\x85\x76\x7a\x00\xb1\x68\x82\x55\x81\xef\x29\x34\x4e\x28\xf0\x41\xc3\xae\x19\x20\xa8\xb6\xeb\xb4\x71\xb7\xa3\xff\x9b\x71\x7a\xd0\x6d\xff\xbf\x98\xa7\xb7\x4d\x3b\x62\x04\xc0\x25\x20\x86\x09\x06\x24\x32\xe4\x43\xdd\x01\x67\x2c\x44\x33\x8f\x30\x08\x21\x8c\x57\xc6\x5d\x63\xc7\x0c\xa8\x92\x11\x28\x2a\xb8\x6a\x2c\x4e\xc3\x6c\x45\xf9\x06\x23\x00\xc7\xca\xcc\x35\x9e\xbe\xab\xa9\x4f\xb2\x54\xa4\x40\x4f\xa8\x65\xe9\x19\x9e\xde\xa5\x61\x96\x28\xf6\x03\x27\xf3\x39\x0b\x0f\xf7\xed\xa1\x34\x3e\x80\x0f\x95\x85\x1c\xca\x04\xb3\xdf\x1c\x00\x89\x0c\xcd\x09\xa0\xbe\xe2\x3f\x1d\xa2\x6a\x33\x60\x30\x07\x8e\x80\xa7\x14\xea\xfd\xee\x9b\xe0\xee\xdb\xc0\xad\xc7\x50\x91\x47\x10\xc0\x3f\x08\x69\xb6\x91\x7b\xcc\xbc\x50\x9c\x03\x76\x52\x63\x27\x9b\xcf\x05\x95\xe2\xcc\xac\x02\xc4\xcc\x31\xf1\xf4\x37\xcd\x45\x87\x8f\xa8\xda\x03\x45\x34\x26\x9b\x3d\x96\x74\x6d\x7b\xed\x1c\x8d\x6e\x06\xcc\xde\x1b\x4c\xc0\xff\x06\x7a\x89\x10\x30\x40\x22\xb9\xc9\xd5\x41\xe8\xa3\x1c\x7e\x22\x2b\x52\x51\xb1\x01\x99\x15\xe1\x70\x1a\x21\x3f\xd4\x01\x08\x34\x41\xd1\x75\x10\x67\x21\x89\x3d\x7f\x6c\x49\x09\x3d\xce\xf7\x24\x07\x89\xed\xc5\x08\xc3\xf2\xca\x15\xc6\x9c\xa1\xcb\x11\x66\x29\x20\x02\x89\xd9\x17\x95\x95\x33\x74\x35\x52\xd7\x9a\x94\x86\xb2\x7a\xbe\x1e\xe1\xba\x5f\xab\xe7\x67\x23\x9c\x73\x0a\xeb\xae\x7a\xfc\x69\x84\x30\x4c\xa3\x5a\x1c\xb8\x1c\xdb\xa1\x41\xf5\xc5\x43\xf6\x86\xa4\x19\x78\xbd\xbc\x68\xfe\x1c\x19\x4e\xd3\x88\xf2\x5b\x0a\xb7\xa8\x58\x85\x3f\x2f\xd2\x50\xc1\x93\xd7\xae\x53\x7f\x7b\x62\xd2\xc7\xe6\x16\x03\x4d\x26\x28\x2d\xe2\x18\x04\xda\x8c\x57\x5b\x6c\x6c\x28\x65\xab\xac\xfc\x55\xdd\xf9\xc1\xa9\x98\xed\x56\x25\xca\xf1\x68\xe7\x0f\x04\x4d\x22\xff\xd0\x92\x41\x85\x93\x7f\x8d\x6d\x05\x08\xd2\x30\xe3\x98\x46\x4e\x7c\xa8\xb5\x05\x55\xd0\x7c\x3c\xb6\xf8\x65\xc7\x33\xa4\xfe\x97\x34\xd2\xad\x5a\x79\x17\x41\x83\x97\xe6\x8b\xe6\x7e\x07\x06\x31\xfa\xf9\xab\x32\xa3\x9a\xfb\x26\x5b\x8f\x77\xfd\xb4\x72\x13\xe4\xa5\x30\x2c\xb7\x90\x2a\xaf\x0d\xc0\x47\xe7\xc8\x90\x3b\x6e\xe0\xa8\x5c\x6a\x21\x1f\x0d\x75\xb1\x83\x8b\x7d\x2e\x14\xa8\x80\x8b\xbd\x7c\x18\xc9\xdd\xb3\xbe\x5a\x27\xe0\xbe\x43\xac\xb0\x60\xdc\xad\x56\x98\x15\xa9\xdc\xe7\x45\xa1\x54\xcb\xb3\x55\x87\x43\x14\x53\x39\x10\x28\x5c\xd2\xf0\x33\x94\x11\xad\x29\x5a\x92\x15\x85\x0b\x11\x74\xfc\x8a\x65\x50\x36\x68\x1f\xa2\xf0\x87\x00\xd6\xaa\xff\x00\x0c\x09\x92\x99\xfa\xcf\xb8\x6b\x2c\xcc\x38\x1c\x49\x56\x97\x29\xd1\x09\x43\xcd\x6d\x33\xb3\xce\x0c\x07\x0b\x2a\x3d\xb9\x64\xc2\xef\x36\x95\x51\xe9\x34\x14\xb8\x8a\xd8\x7c\xae\xa2\x30\x61\xea\x44\x21\x96\xd6\x10\x2c\x1c\x05\xe5\x5f\xa1\xe3\xad\xd2\x82\x5a\x9b\xa6\x80\x0c\x1b\x27\xea\xd9\xae\xa5\x63\xa1\x6e\xf1\x42\xcf\xa0\x0d\x0f\x9d\xd0\x50\xb7\xe8\x5e\x6f\x05\x1d\xbf\x1d\x9e\x3f\x6c\x42\x1d\x3b\xa6\x4b\x37\x22\xbb\xe6\xb5\x93\xbb\x34\x2f\x64\xf0\x52\x31\x1c\x07\x16\x7d\x9f\x71\xab\x49\x1c\x63\x7a\x91\xf5\x18\xd3\xf4\x7e\x63\xf6\x40\xbb\x85\x16\x75\xa1\xcf\xaa\x6a\xf9\x3b\x7d\xac\x97\x57\x37\x84\x5b\x45\xf4\x87\x2d\xb8\x3a\x6a\x15\xfc\xa1\xc1\x8d\x8c\xa6\x83\xd3\x4a\xcf\x20\x66\x20\xb3\x5f\xd9\x23\x8d\xbc\x0b\xff\x74\x00\x9b\x28\x9a\xfe\x99\x0e\x4e\x9d\x83\x5b\x8a\x85\x38\x20\x64\x43\xc6\xe9\x40\x1c\x25\xab\x92\x7a\x7c\x18\x16\x22\x1c\x90\x34\xe5\x3f\xde\x78\x53\xe3\xa7\x65\xa5\x29\x43\xd5\x9c\x10\xd8\xf1\xea\xba\x9c\x46\xfc\xca\xb7\x72\x66\xed\xab\xb1\xbb\xb0\x16\x3c\x2b\xf2\x97\x4b\x02\xa3\x3c\x41\x1f\x83\x50\x7d\xb3\x76\x60\xf0\xb6\xdd\x93\x63\x47\xd1\xc8\xbc\x86\x2d\x07\xba\xad\x21\x27\xb6\x20\x21\xb9\x67\xd6\xdf\xea\x4c\xeb\xdd\x45\x3b\x73\x6c\x5a\xeb\x63\x00\x57\x61\xb6\x48\xbd\x1d\x01\x84\xb6\xe5\x59\x0f\x75\xd5\x47\xdc\xa2\x01\x00\xcc\x60\xd4\x6e\x14\xbf\x4f\x0c\x92\x67\x0e\x32\x80\xfd\x05\x0f\x82\xde\xa5\xd2\xab\xc3\xec\xd3\x29\x77\x68\x7e\x07\x3a\xfc\xa0\xc2\x64\xcf\x0f\xe0\xa5\x46\xbe\xd8\x78\x96\x97\x9a\xe9\xd9\xf3\x08\x10\xab\x04\x3b\x2f\xfa\x36\xbb\xba\x58\x9c\x21\x9a\x4a\xb8\xc5\xaa\xed\xc0\x69\x02\xcd\xab\x17\x86\x53\x98\xa8\xba\xa5\x09\x1a\xc3\x72\xf0\xf0\xf7\x9d\xeb\xa3\x5f\x73\x9e\xc7\xb1\x87\xdb\xd9\x9d\x65\x8f\xc0\x52\xc6\x3c\xa7\xb2\xd6\xd1\xa2\x60\x29\x93\xd8\xeb\xbb\xe2\x38\x52\x3a\x44\x38\x3a\x81\x2b\x60\x1a\x79\x58\x72\xb0\xac\x5f\x44\xa1\x2d\xb1\xe3\x11\x6e\xce\xbc\xa0\xfe\xb1\x86\x1f\x99\x04\xbb\xd5\xc1\x3d\xbf\x49\x5f\xd9\x73\xe3\xab\x5f\xfe\xed\xab\x57\x52\x91\xac\xce\x83\x2d\x93\x34\x72\x47\x5d\xf5\x4c\x28\x9d\xf4\x36\x3f\x35\xd4\x07\x39\xd9\x19\xcd\xda\x8d\xbe\xce\xd1\xfe\x31\xee\x48\x1e\x33\xf9\xb5\x8a\xd7\x5a\xd7\x3f\x19\xdd\xeb\x1f\x93\x86\x97\x17\x57\xcf\xf4\x87\xef\x60\x02\xba\x67\x2f\x8e\xf1\x5f\xfd\x6a\x73\x6c\x0c\x8d\x9a\xfa\x61\xe8\xc9\x71\x83\x92\x02\xca\x1f\xe1\x2a\xd0\xc6\x7a\x09\xca\x3f\x34\xda\xa6\x0d\xba\xb5\x9e\x73\x2a\x96\x76\x95\xad\x0a\x42\x95\x3e\x09\x20\xe1\xed\x36\x98\xc1\xa5\xea\x63\x4e\xe4\xb2\x2c\x87\xaa\xc9\x87\xaa\x6c\x43\x60\x80\x19\x11\xb0\xe8\xb1\x2c\xa1\x19\x9d\xb7\x05\xbb\xf5\x0e\x59\x12\x7b\x4c\xd5\x8d\xd1\x13\xfe\x1a\x5e\xa6\xb3\xb5\xda\xd1\x77\x6a\x5c\x00\x12\xbc\xfa\x34\xf0\x86\x04\x57\xa2\x16\x1d\xd4\x4d\x4f\xe1\x02\x93\xa8\x7e\x93\x8a\x37\x27\x4d\x87\x6a\x0d\x03\x25\x37\xc3\xea\x15\x4e\xff\x8c\x5c\xbd\xef\xd5\xff\xb6\x5b\x88\xa7\x2c\x4f\xfe\x06\xca\x3a\x5e\x55\x86\x16\x00\x00")
 
 func bindataWebTemplatesMonitorDetailsviewGoHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -241,10 +242,10 @@ func bindataWebTemplatesMonitorDetailsviewGoHtml() (*asset, error) {
 
 	info := bindataFileInfo{
 		name:        "web/templates/monitor/details_view.go.html",
-		size:        4378,
+		size:        5766,
 		md5checksum: "",
 		mode:        os.FileMode(420),
-		modTime:     time.Unix(1602774383, 0),
+		modTime:     time.Unix(1792241600, 0),
 	}
 
 	a := &asset{bytes: bytes, info: info}
@@ -280,7 +281,7 @@ func bindataWebTemplatesMonitorIndexGoHtml() (*asset, error) {
 	return a, nil
 }
 
-var _bindataWebTemplatesMonitorMenuGoHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x8e\x41\xca\x83\x30\x10\x46\xf7\x9e\x62\x08\x2e\xfe\x1f\x4a\xb2\x2f\x31\x5b\x2f\xd0\xbd\xa4\x3a\xd6\x80\x4d\x42\xa2\x6d\x61\x98\xbb\x97\x54\x70\x25\xa5\xab\x99\xc5\xe3\x7b\x8f\x68\xc0\xd1\x79\x04\x71\x47\xbf\x76\x7d\xf0\x0b\xfa\x45\x30\x57\x44\xc9\xfa\x1b\x42\xed\xfc\x80\xaf\x13\xd4\x31\x85\x1e\xce\x0d\xc8\xf2\x60\xce\x21\x65\xe6\x0a\x40\xcf\xce\x68\x0b\x53\xc2\xb1\x11\x44\xb5\xbc\xda\x8c\x5d\xb4\xcb\xc4\xac\x76\x56\x11\x6d\x4b\xcc\xc2\x10\x7d\xd6\x64\x9b\x6c\x9c\x64\x9b\xc2\x1a\x99\xe1\x6f\x87\xff\xb5\xb2\x46\xab\xd9\x99\x8a\x08\xfd\xf0\x35\xe7\xe1\xf0\xf9\x43\x49\xc1\x0e\x23\x2e\x21\xba\xbe\xe8\x0b\x71\x68\xde\xee\x3b\x00\x00\xff\xff\xfc\x37\x76\xe3\x2b\x01\x00\x00")
+var _bindataWebTemplatesMonitorMenuGoHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x8e\x3d\x6a\x03\x31\x10\x46\xfb\x3d\xc5\x20\xb6\x48\x20\x48\x7d\x90\xd5\xfa\x02\xee\x8d\xb2\x1a\x7b\x05\x9b\x19\x21\xc9\xf9\x61\x98\xbb\x07\x25\xc1\xa4\x30\x49\xba\xaf\x78\x7c\xef\x89\x24\x3c\x65\x42\x30\xcf\x48\x97\xe3\xc2\xd4\x91\xba\x51\x9d\x00\xfc\x96\x83\x8f\xb0\x56\x3c\xed\x8c\xc8\x6c\x9f\x62\xc3\x63\x89\x7d\x55\x75\x9d\x0b\x6f\x7c\x7e\x37\xe1\xf0\xbd\xbc\x8b\xc1\xbb\x2d\x87\x49\xa4\x46\x3a\x23\xcc\x99\x12\xbe\x3d\xc0\x5c\x2a\x2f\xf0\xb8\x03\x3b\x06\xb6\xc6\xb5\xfd\x6d\xb8\xb2\x4e\xe4\xeb\x49\xd5\x04\x91\xcf\x37\xbb\xaf\xb1\xac\x76\x5f\xf9\x52\x54\xe1\xee\x0a\xdf\xff\xcc\x40\x4a\xaa\xbf\xe4\xbc\x64\x7c\xfd\x47\xc9\xc0\x6e\x46\x1c\xb8\xe4\x65\xe8\x07\x71\xd3\x8c\x94\x54\xa7\x0f\x00\x00\x00\xff\xff\x03\x00\x25\x8b\x1c\xe2\x66\x01\x00\x00")
 
 func bindataWebTemplatesMonitorMenuGoHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -297,10 +298,38 @@ func bindataWebTemplatesMonitorMenuGoHtml() (*asset, error) {
 
 	info := bindataFileInfo{
 		name:        "web/templates/monitor/menu.go.html",
-		size:        299,
+		size:        358,
 		md5checksum: "",
 		mode:        os.FileMode(420),
-		modTime:     time.Unix(1559056733, 0),
+		modTime:     time.Unix(1792214952, 0),
+	}
+
+	a := &asset{bytes: bytes, info: info}
+
+	return a, nil
+}
+
+var _bindataWebTemplatesMonitorTopologyGoHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xac\x59\xfb\x6f\xdb\x38\xf2\xff\x3d\x7f\xc5\x7c\x19\x60\x21\x6d\x64\x59\x8e\x9b\xed\xe6\xe1\x7c\xb1\xbb\xdd\xdb\x5b\x5c\x0a\x1c\xae\x05\xf6\x0e\x45\x51\x30\x22\x6d\xb3\x91\x49\x1f\x49\x3f\x74\xa9\xff\xf7\xc3\x50\x4f\xca\x92\x93\x05\x0e\x2d\x12\x89\x33\x9c\xf9\xcc\x70\x1e\x1c\xe5\xf9\x99\xf1\xb9\x90\x1c\x48\xaa\xa4\xe5\xd2\x92\xc3\xe1\xec\x8e\x89\x2d\xa4\x19\x35\x66\x46\xb4\xda\x91\xfb\x33\x80\xf6\x1a\xb2\x52\x21\xb9\x76\x94\x2e\x2d\x1b\xad\xd8\x68\x72\x59\xd2\x00\xee\x96\x93\xfb\x8f\x6a\xad\x32\xb5\xc8\xef\xc6\xcb\xc9\xfd\x59\x45\x68\x6d\x5b\x53\xc9\x33\x70\x3f\x47\x8c\xcf\xe9\x26\xb3\xb5\x80\x61\xce\x25\xa7\x4c\xc8\x45\x8b\x13\xd5\x4d\xef\x7f\xd3\x6a\xb3\x86\xdf\x34\x5d\x2f\xcd\xdd\x78\x39\xf5\xe8\x66\x4d\x25\x58\x61\x33\x3e\x23\x7f\xd7\x2a\xe5\xc6\x28\x0d\x0b\xdc\x42\xc0\xd8\x1c\xd7\x53\x95\x29\x7d\x73\x3e\x9d\xbe\xa5\x8f\x6f\xc9\xfd\x77\xe7\xd7\x3f\xbc\xbd\xbe\x2d\x98\xee\xc6\x28\x61\x50\xe4\x07\xab\x39\x5d\x81\x55\x6b\x91\x76\xe5\x5d\xa5\x8f\x3f\x5e\xa5\x85\xbc\xe9\xe5\x2d\x18\xc7\xfb\x82\xc0\x8f\xf4\x31\xe3\xfd\xf2\xe6\x09\x65\x6f\x78\x23\xcf\x22\xeb\xb1\xb8\xef\x56\x8c\x9a\xe5\x2d\x70\xb6\xe0\x06\xcc\x52\xed\x60\xc5\x8d\xa1\xf8\xb6\xe6\x1a\x0c\x4f\x95\x64\x40\x25\x03\x35\x9f\x1b\x6e\x21\xa3\x8b\x08\x34\x67\xe5\x16\xaa\x39\x2e\x2d\x84\x5c\xc4\xb5\xdc\xbb\x31\x13\xdb\xfb\xb3\xe1\x43\x1a\x3d\x2a\x96\xfb\x67\x63\xb6\x0b\x10\x6c\x46\x6c\x19\x0f\x04\x76\x82\xd9\xe5\x8c\x4c\x26\x93\x84\xc0\x92\x8b\xc5\xd2\xce\xc8\xdb\x24\x21\xf7\x77\x63\xb3\x5d\xdc\x77\xd5\x79\x2f\x25\xf1\xce\x79\xa5\x61\x3d\xaf\xc4\x43\x9c\x09\xf9\x04\xcf\x35\x05\x60\x2e\xb2\xec\x06\xa4\x92\xfc\xb6\xb5\x6a\xac\x56\x4f\x7c\xa4\xd6\x34\x15\x36\xbf\x81\x24\x7e\xdb\x90\x0f\x43\x82\xe3\x4c\xa9\xa7\xcd\x3a\x1a\xa4\x7f\x55\x42\xc2\xf3\xb1\x1e\x3c\x0e\xaa\x35\xcd\x6f\xe0\x2a\x82\xe9\x0b\xaa\xa4\x62\x1c\x2c\xdf\x5b\xdf\x10\x25\xed\xc8\x88\xff\xf0\x1b\x98\x5c\xae\xf7\x8d\x0c\x80\xb5\x12\xd2\x72\x3d\xe2\x5b\x2e\xad\xe9\x5a\x3b\x68\x4e\x46\x1f\x79\x36\xa8\x23\xf1\x75\x14\x7e\x3c\xbf\xba\xba\x3a\x96\x7c\x37\x2e\x0f\xa4\x7a\x37\xa9\x16\x6b\x0b\x36\x5f\xf3\x19\x41\x4b\xc6\x5f\xe9\x96\x16\xab\xad\x00\xd9\x52\x8d\x61\xf6\x71\xa9\xb9\x59\xaa\x8c\xc1\x0c\x26\x49\x92\x34\x0a\x90\x01\xbd\xf1\x0b\x86\xbf\x81\x99\x07\x96\xb8\xec\x24\x37\x40\xaa\xbc\x6d\x0e\x06\x80\x14\xb9\xe6\xc8\x65\x1a\x7a\x64\x97\x3a\x8e\x5a\x26\x55\x4d\x3c\xdc\x36\x31\x8e\x00\x30\x86\x67\xc0\xa6\xb1\xe1\x19\x4f\x6d\x40\x6a\x37\x92\xd0\x87\xea\x62\x1b\x66\x70\x61\xb6\x8b\x98\x5a\xab\x03\xe2\x96\xba\x7c\x45\xd8\xfb\x8c\xc5\x1a\x72\xd6\xac\x8e\xb8\x5e\x73\xc9\x02\xc2\xf8\xdc\x90\xb0\x7e\x5d\x51\xfd\xc4\x35\x09\x6b\x5e\x80\x52\x8e\x60\x24\x02\x42\x35\xd6\xf1\x1e\xf2\x56\xf0\xdd\xcf\x6a\x8f\x3c\x09\x8c\xae\x60\x92\xc0\x24\xe9\x63\xd4\x7c\xfe\x4f\x12\xc1\xe5\x65\x3f\xed\x5f\x24\x82\xa4\x87\x54\x00\xfb\xc3\x59\x1d\xc1\x0f\x83\x1c\x7f\x2d\xcc\xed\x67\x51\x5a\x60\x67\x42\x3b\x36\x56\x75\xd0\x95\x1e\x58\x53\xbb\xec\xc3\xed\xcc\x7f\x9f\x44\xa3\xab\x87\x49\x12\x25\x0f\x49\x74\xd5\xc7\x86\xe1\x8c\x9c\xe7\xd7\xd7\xd7\x9e\xd3\xf1\x7c\x30\x97\x1f\x68\xce\x35\xcc\xbc\x43\x58\x74\x0f\xd2\x65\xd0\xab\x38\x31\x8a\x07\x19\x3d\x4e\x23\x56\x9b\x8c\x5a\xa1\x64\x11\x75\x73\xa5\x53\xfe\xa1\x5e\x0c\x3c\x63\x1c\x31\x20\x08\x98\x44\x35\xf7\x83\x90\x4f\x41\x18\x0b\x16\xcc\x37\x32\x45\x51\x01\x0b\xbd\xdc\x01\xd0\xdc\x6e\xb4\x04\x16\x0b\xd6\x20\x05\x38\x84\x31\x13\xc6\x52\x99\xf2\x60\xf2\x26\x09\xfb\xb4\xa5\x4b\xaa\x17\xbc\xa5\xef\x3d\x95\xf9\xcf\x8a\xe5\x41\x18\x63\xd6\xc9\x85\x5d\x06\xa3\x37\xc9\xc0\x6e\x8e\xb5\xaa\xb5\xfb\x17\xb7\x10\xb8\x4c\x81\x31\x5c\x46\x55\x7e\x8c\xe1\x32\x6c\x7b\x67\x3c\x86\x27\xce\xd7\xce\x97\xb0\x56\x46\xa0\x65\xc6\xb5\xb1\x8c\x1a\x0b\xe8\x05\x30\x96\x5a\x03\x8f\xdc\xee\x38\x97\xb0\x59\x33\x6a\xb9\x39\x3a\x0a\xf3\x73\xfe\xfb\x3b\xac\x27\x07\xff\x98\x50\x0e\x7a\xef\x83\x93\x52\xd0\x7d\x06\x21\x9f\xfe\xc6\x73\x98\x41\xed\xda\xcc\x77\x2d\x8a\x31\x6a\xa3\x53\x0e\x33\xc8\xe2\xe2\x31\x16\x0c\xbe\x7d\xab\x5f\xdb\x1e\x47\x7e\x8b\x0e\xb5\x8e\xbf\x78\xac\xf9\x8b\xd7\xdb\xb3\xa3\x83\x2b\x55\x5c\x00\x19\xdd\x13\xb8\xa8\x44\x5c\x00\xb9\xc1\xd7\x2c\xc6\xe2\x7b\x3b\x58\xd4\xd0\x57\xff\xa0\x96\x7b\x86\x44\x20\xd5\xee\xd8\x1a\x74\x0a\xcc\x7c\xdf\x7c\x2a\x1d\x11\x64\xe1\xe7\x36\x3a\x31\x87\xe0\xff\x70\xc3\x40\xbc\xb5\x8a\x7b\xbb\x33\x95\x6e\x10\x2b\xfe\x4e\xcc\xe7\x30\x83\x40\xaa\x1d\x8c\x9c\xce\xd8\x81\x1a\xbb\xd6\x10\x7b\xfb\x51\x59\xbd\xe7\x6e\x06\xc9\x80\x52\x27\x45\xa3\xb5\xdf\xbe\x0d\x23\x28\x99\x83\x2c\x4e\xd5\x46\xda\x4a\xbb\x7b\x09\x61\x5c\xa3\x3b\xed\xd4\x07\x2c\x09\x2f\x84\x47\x56\xf2\x64\x0e\x54\x6c\xd5\x5f\xc4\x9e\xb3\x20\x09\xe1\x02\xc8\xd8\x90\x36\x42\xb4\x31\x8b\x8b\x6b\xda\x03\x5d\xc0\xfd\xb1\x95\x85\xb8\x8b\x19\x10\xec\xa6\x50\x1c\x7f\xbd\xe3\x05\x73\xdd\xe6\x61\x93\x98\xa6\x8b\xb6\x35\x4d\x75\xf2\x51\x94\xd2\xd8\x34\xc6\x1d\x5e\x91\x02\x88\x95\x0c\x88\xb1\x54\x63\x4d\x1f\x2e\x49\x65\xf4\xb0\x69\xec\x2e\x32\x31\x4d\xad\xd8\xf2\x10\x1a\x9d\x31\xcd\xd6\x4b\xfa\xd1\x85\x7a\x90\xc4\xd3\x30\xd6\xdc\xc9\x0d\x5a\xe5\xb6\xf8\xcf\xe2\xf9\x1e\x0b\x68\xbc\xef\xa1\xe4\x8e\x92\xfb\x94\x43\x0f\x68\x34\xe6\x05\xcc\x95\xa2\x0a\xf5\xa0\xbe\x8a\xe1\x15\x6a\xb9\x64\xff\x53\x4f\x0d\x79\x47\x6e\xb2\xac\x87\x94\xf7\x92\x0e\xe1\x70\x98\x68\x2e\x19\xd7\xd5\xd4\xd7\x0e\x98\xea\xae\xe4\x9b\x80\xf0\x2b\x0a\xcc\x0a\x6d\x5d\x23\x8b\x90\x6a\x63\x38\x34\x4a\xab\x52\xbe\x43\xa8\x7c\x07\xef\xa8\xe5\xb5\x44\x57\x31\xda\x1b\x91\x77\x45\xf7\x65\xc1\x9b\xb4\xc0\xbb\xae\xa2\xf9\xc6\x70\xe0\x7b\x61\xac\x90\x8b\xa2\x41\x80\x51\x60\x97\x38\x06\xe5\x6a\x63\xb1\xad\xe4\x06\x7f\x3e\x66\xbc\x23\xb8\x60\x9f\xc1\x97\x78\x45\xd7\x6d\x0c\x8c\x9b\xd6\x21\x76\x12\xa6\x00\x55\xeb\x9c\x35\x6d\xe9\x93\x8c\x05\xf3\x8a\x6a\xe1\xaf\x8a\xb7\x2b\xa7\x4e\xbe\x2f\x31\x35\x46\x2c\x64\xcd\x19\x81\xec\x9c\x7c\xbb\x00\x40\x57\x25\xba\xf2\xf6\xac\x47\xb0\x7f\x08\xed\x96\xdc\xd4\xbd\x1e\x0f\xb8\xe5\x68\xb0\x12\x42\x59\xff\x60\x56\x77\xa3\xaa\x05\xf9\x28\x9a\x93\x7b\x4f\xed\x32\x5e\xd1\x7d\x50\x2e\x45\xa5\x88\xb0\x17\x76\x76\x02\xf6\x17\xbc\x8e\xfc\x4a\xd3\x65\xf0\x32\xca\xa1\xbe\xd7\x99\x47\xf0\xbf\x54\x3b\x1c\xbf\x76\xed\x51\x03\xff\xb9\x26\x72\x03\x65\x6b\xe9\x52\x35\xb5\xfc\xa6\x34\xc5\x23\x1d\x4e\x58\x80\x8e\x2f\xc6\xd8\x3f\xca\xb1\x03\x47\x94\x94\x66\xfc\x41\x48\x4e\x75\x10\xc6\x4c\xad\xa8\x90\xc1\xa7\x24\xaa\x7c\xf8\x39\x8c\x35\x95\x0b\x1e\x7c\x9a\x44\xf0\xe3\xe7\x63\x89\xe8\x8d\xf2\x40\xdc\x75\xb5\x1c\x7a\x7e\xca\xb2\x80\xb8\xa1\x91\x84\x31\xa3\x96\x56\x6e\x2b\xdd\xe1\x1d\x00\xae\xc5\x7c\x2f\x6c\x80\xf5\x79\xa5\xb6\xdc\x2f\xcf\x2d\x1d\x71\x71\xf7\x0b\x87\xaf\xf5\xf5\x8d\xbd\x98\x2c\x46\x45\x69\x24\x1b\x9d\x05\xe7\x6e\xca\x09\xbb\xec\x2b\xae\x17\xdc\xe1\xeb\x95\xe3\xbe\x58\xbc\x50\x5d\xcb\x00\x72\xf7\x6a\xd7\x4f\x59\xe7\x3a\xd5\x57\xb8\x8b\xc1\xa2\x38\x92\xd7\xc9\x67\x5e\x5f\xf7\x26\xe1\xff\x07\x72\xce\xae\xaf\xa6\x6f\xe6\x04\x6e\xca\x31\xe5\xf5\xea\x47\xbb\x72\x00\x7b\x05\x88\x56\x0c\x05\xac\x2f\x9b\x7a\xe2\xae\xbe\xc0\xd4\xf3\xcf\x51\x9c\x38\x96\xd7\x04\x0b\xf2\x9d\x8c\x96\xb6\xae\xa3\x78\xc1\x8f\x0b\xe4\xe4\x39\x93\x16\x9a\xde\x40\x41\x52\x87\x82\x52\x83\xfa\x36\x77\x6c\x3f\x16\x4e\x98\x35\x43\x9d\x67\x3d\x12\x2b\xc3\xbb\x4d\xe0\xe8\x18\x06\xc7\xb0\xf6\x1b\x4a\x39\xe5\xa2\x0a\xd2\xaf\xe8\x9c\x12\xd7\x91\xa7\x16\x2f\xb8\x09\x05\x74\x59\x52\x9a\x65\x01\xde\x81\x82\xe6\x66\x11\x7a\xaa\x6b\xb5\x31\xc7\x62\x3a\x6c\x28\x62\xf4\xbf\xa3\xd8\xa5\x30\x9e\xac\xa2\xcd\x15\xa9\x86\x97\x82\xf2\x03\x4f\x57\x12\x40\x33\x3e\xd3\x0e\xe2\x96\x61\x4b\xcd\xe7\x38\xe1\x3f\x3f\xc7\x8f\xd4\xf0\x2f\x58\x59\x0e\x87\xf1\xba\xfa\x02\x3c\x2e\xf2\x5a\x48\xc6\xf7\x7d\x42\x4a\x0d\xa9\xd0\x69\xc6\x87\xd5\x68\x12\xc1\xe4\xb2\x63\xc7\x01\x78\x66\xf8\x09\xdc\x9a\xa7\x76\x58\x26\x7e\x9e\x19\x5d\x0f\x92\xf3\xd3\xe4\x2a\xf7\x27\x3f\x0e\xb2\x94\x1f\x9b\x1c\x4f\x07\xf9\x59\x3f\xe0\x9e\x3c\xab\xa5\x31\xc4\x3b\xb9\x1a\xa2\x22\xdc\x37\x47\x44\x14\x18\xe0\xd7\x87\xf0\x74\xdc\x17\xc1\xd5\xca\xaf\xe2\x40\xa2\xc2\x83\xfe\xd7\x9c\x17\xd3\xac\xf9\x96\xf8\xa9\x08\xb3\xcf\xa7\x95\x97\xb9\x54\x60\x28\xca\x05\x8a\xf0\x0b\x42\xeb\xd2\x8d\x44\x13\xb8\x9f\xa1\xbb\xc8\x5b\x91\x3e\xb5\x81\x75\x71\x61\x8d\xa9\xfc\x74\xd2\x80\x72\x1a\xc3\x4b\x3b\xab\xbe\x11\xec\x61\x04\xac\xfa\xc0\x70\x34\x76\x38\xfe\xbc\xcd\x9f\xb7\xf9\xf3\x5e\x7e\x5d\x5d\xb2\xcc\xbf\xb5\x0d\xd8\x1e\xbe\x07\xb6\xc7\x3c\xc9\xf1\x29\x0f\xe1\x7b\xb8\xec\x6e\x2c\x7d\x4b\xde\x17\x09\x55\xe1\xc1\x59\x36\xf2\x96\x72\x5c\xfa\xc9\x2d\xe9\x86\xea\x1e\x21\x81\x24\x9a\x54\xad\xb6\x32\xaf\x91\x50\x59\xe0\xeb\xf6\x0f\xac\xea\x25\x4d\x0e\x9d\x72\x67\x89\x3a\xf0\x00\x37\xba\x71\xe0\xef\x58\x7a\xa8\xa2\x2d\xff\xb3\xa2\xf3\xb6\xe8\xbc\x57\xb4\xff\x8e\x11\x54\x2a\xb3\x9a\x4a\x33\x57\x7a\xf5\x3a\xa5\x05\x7f\x86\x77\xe9\xc2\x73\x6d\x2f\x22\x0e\x12\x92\x53\xba\xfd\xb7\x56\x68\x97\x5f\xef\xca\x2b\x20\xfe\x32\xae\x43\x9a\xa1\x0d\x6e\x54\x0f\x92\x78\xd2\x3b\xa4\xb7\x07\xc8\x9d\x90\x4c\xed\x62\xc3\xed\xef\x98\x68\x5b\x9a\x35\x7d\xc4\x37\x94\x4d\xe3\xaf\x06\xf3\xaa\x53\xd4\xf1\x46\x3a\xae\xe6\x0e\x12\x75\xc6\xd1\xb6\xda\x08\x2e\x93\x24\x69\x27\xf0\x78\x0c\xd8\xe6\x40\x58\x10\x52\x58\x41\xb3\x2c\x3f\xfb\xb3\x0a\x6b\xbc\xd5\x9a\x8f\xdb\xc7\x13\xd8\x63\x60\x3d\xae\x1b\x70\x5c\xfd\x7c\x37\x2e\xfe\xa0\x72\x7f\xe6\xfd\xb9\xac\x7c\x28\x7f\x3d\x3f\x73\xc9\x0e\x87\xb3\xff\x02\x00\x00\xff\xff\x03\x00\x74\xfe\xe5\x17\xf8\x1d\x00\x00")
+
+func bindataWebTemplatesMonitorTopologyGoHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_bindataWebTemplatesMonitorTopologyGoHtml,
+		"web/templates/monitor/topology.go.html",
+	)
+}
+
+func bindataWebTemplatesMonitorTopologyGoHtml() (*asset, error) {
+	bytes, err := bindataWebTemplatesMonitorTopologyGoHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{
+		name:        "web/templates/monitor/topology.go.html",
+		size:        7672,
+		md5checksum: "",
+		mode:        os.FileMode(420),
+		modTime:     time.Unix(1792214952, 0),
 	}
 
 	a := &asset{bytes: bytes, info: info}
@@ -407,6 +436,7 @@ var _bindata = map[string]func() (*asset, error){
 	"web/templates/monitor/details_view.go.html":      bindataWebTemplatesMonitorDetailsviewGoHtml,
 	"web/templates/monitor/index.go.html":             bindataWebTemplatesMonitorIndexGoHtml,
 	"web/templates/monitor/menu.go.html":              bindataWebTemplatesMonitorMenuGoHtml,
+	"web/templates/monitor/topology.go.html":          bindataWebTemplatesMonitorTopologyGoHtml,
 	"web/templates/query/index.go.html":               bindataWebTemplatesQueryIndexGoHtml,
 }
 
@@ -476,6 +506,7 @@ var _bintree = &bintree{Func: nil, Children: map[string]*bintree{
 				"details_view.go.html":      {Func: bindataWebTemplatesMonitorDetailsviewGoHtml, Children: map[string]*bintree{}},
 				"index.go.html":             {Func: bindataWebTemplatesMonitorIndexGoHtml, Children: map[string]*bintree{}},
 				"menu.go.html":              {Func: bindataWebTemplatesMonitorMenuGoHtml, Children: map[string]*bintree{}},
+				"topology.go.html":          {Func: bindataWebTemplatesMonitorTopologyGoHtml, Children: map[string]*bintree{}},
 			}},
 			"query": {Func: nil, Children: map[string]*bintree{
 				"index.go.html": {Func: bindataWebTemplatesQueryIndexGoHtml, Children: map[string]*bintree{}},